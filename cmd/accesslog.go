@@ -0,0 +1,98 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"text/tabwriter"
+	"time"
+
+	"graphsense-cli/internal"
+
+	"github.com/nicksnyder/go-i18n/v2/i18n"
+	"github.com/spf13/cobra"
+)
+
+var (
+	accessLogSince time.Duration
+	accessLogLimit int
+)
+
+var accessLogCmd = &cobra.Command{
+	Use:   "access-log <instance_name>",
+	Short: "Show who is using a GraphSense instance",
+	Long: `Show request counts, clients and query latencies recorded for an instance's MCP endpoint,
+followed by the most recent requests. Requests are recorded when they go through the
+reverse proxy of 'proxy enable' or through 'gateway start'; clients can identify themselves
+with an X-Client-Id header.`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return showAccessLog(args[0], accessLogSince, accessLogLimit)
+	},
+}
+
+func init() {
+	accessLogCmd.Flags().DurationVar(&accessLogSince, "since", 24*time.Hour, "Only include requests from this long ago")
+	accessLogCmd.Flags().IntVar(&accessLogLimit, "limit", 20, "Number of recent requests to show")
+	addOutputFlag(accessLogCmd)
+}
+
+func showAccessLog(instanceName string, since time.Duration, limit int) error {
+	structured, err := structuredOutput()
+	if err != nil {
+		return err
+	}
+
+	entries, err := internal.GetAccessLog(instanceName, time.Now().Add(-since), 0)
+	if err != nil {
+		return err
+	}
+
+	summary := internal.SummarizeAccess(entries)
+	recent := entries
+	if limit > 0 && len(recent) > limit {
+		recent = recent[:limit]
+	}
+
+	if structured {
+		return printStructured(struct {
+			Summary internal.AccessSummary `json:"summary" yaml:"summary"`
+			Recent  []internal.AccessEntry `json:"recent" yaml:"recent"`
+		}{summary, recent})
+	}
+
+	internal.Log.Info("Access log:", "instance", instanceName, "since", since)
+	fmt.Println()
+
+	if summary.Requests == 0 {
+		internal.Log.Info("No requests recorded.")
+		return nil
+	}
+
+	fmt.Println(internal.Localize(&i18n.Message{ID: "AccessLogRequests", Other: "  Requests: {{.Requests}} ({{.Errors}} errors)"}, map[string]any{"Requests": summary.Requests, "Errors": summary.Errors}))
+	fmt.Println(internal.Localize(&i18n.Message{ID: "AccessLogLatency", Other: "  Latency:  p50 {{.P50}}ms, p95 {{.P95}}ms, max {{.Max}}ms"}, map[string]any{"P50": fmt.Sprintf("%.1f", summary.P50LatencyMs), "P95": fmt.Sprintf("%.1f", summary.P95LatencyMs), "Max": fmt.Sprintf("%.1f", summary.MaxLatencyMs)}))
+	fmt.Println()
+
+	var clients []string
+	for client := range summary.Clients {
+		clients = append(clients, client)
+	}
+	sort.Slice(clients, func(i, j int) bool {
+		return summary.Clients[clients[i]] > summary.Clients[clients[j]]
+	})
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 3, ' ', 0)
+	fmt.Fprintln(w, internal.Localize(&i18n.Message{ID: "AccessLogClientsHeader", Other: "CLIENT\tREQUESTS"}, nil))
+	for _, client := range clients {
+		fmt.Fprintf(w, "%s\t%d\n", client, summary.Clients[client])
+	}
+	fmt.Fprintln(w)
+
+	fmt.Fprintln(w, internal.Localize(&i18n.Message{ID: "AccessLogRequestsHeader", Other: "TIME\tCLIENT\tREQUEST\tSTATUS\tLATENCY"}, nil))
+	for _, entry := range recent {
+		fmt.Fprintf(w, "%s\t%s\t%s %s\t%d\t%.1fms\n",
+			entry.CreatedAt.Local().Format("2006-01-02 15:04:05"), entry.Client, entry.Method, entry.Path, entry.Status, entry.LatencyMs)
+	}
+
+	return w.Flush()
+}
@@ -0,0 +1,52 @@
+package cmd
+
+import (
+	"fmt"
+	"strings"
+
+	"graphsense-cli/internal"
+
+	"github.com/spf13/cobra"
+)
+
+var setAutostartCmd = &cobra.Command{
+	Use:   "set-autostart <instance_name> <policy>",
+	Short: "Change whether an instance is recovered after a Docker restart",
+	Long: `Change the autostart policy 'status --repair' applies to an instance whose containers
+stopped because the Docker daemon or the host restarted:
+
+  unless-stopped  recover it unless it was stopped with the stop command (default)
+  always          always recover it
+  never           leave it stopped`,
+	Args: cobra.ExactArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return setAutostart(args[0], strings.ToLower(args[1]))
+	},
+}
+
+func setAutostart(instanceName, policy string) error {
+	release, err := internal.LockInstance(instanceName)
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	if err := internal.ValidateAutostart(policy); err != nil {
+		return err
+	}
+	if !internal.InstanceExists(instanceName) {
+		return fmt.Errorf("instance '%s' does not exist", instanceName)
+	}
+
+	config, err := internal.GetInstanceConfig(instanceName)
+	if err != nil {
+		return err
+	}
+	config.Autostart = policy
+	if err := internal.SaveDeployment(config, internal.DeployStatusComplete); err != nil {
+		return fmt.Errorf("failed to record autostart policy: %v", err)
+	}
+
+	internal.Log.Success("Autostart policy changed", "instance", instanceName, "policy", policy)
+	return nil
+}
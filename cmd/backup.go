@@ -0,0 +1,80 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"graphsense-cli/internal"
+
+	"github.com/spf13/cobra"
+)
+
+var backupOutput string
+
+var backupCmd = &cobra.Command{
+	Use:   "backup <instance_name>",
+	Short: "Back up the data of a GraphSense instance",
+	Long: `Dump the PostgreSQL and Neo4j databases of an instance and bundle them with the
+instance metadata into a timestamped tar.gz (default directory: ~/.graphsense/backups).
+Neo4j is briefly stopped while its database is dumped.`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return backupInstance(args[0], backupOutput)
+	},
+}
+
+func init() {
+	backupCmd.Flags().StringVarP(&backupOutput, "output", "o", "", "Directory to write the backup to (default: ~/.graphsense/backups)")
+}
+
+func backupInstance(instanceName, outputDir string) error {
+	release, err := internal.LockInstance(instanceName)
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	if !internal.InstanceExists(instanceName) {
+		return fmt.Errorf("instance '%s' does not exist", instanceName)
+	}
+
+	config, err := internal.GetInstanceConfig(instanceName)
+	if err != nil {
+		return err
+	}
+	if config.IsSingleContainer() {
+		return fmt.Errorf("instance '%s' runs in single-container mode, which does not support backups", instanceName)
+	}
+
+	if outputDir == "" {
+		outputDir, err = internal.GetBackupDir()
+		if err != nil {
+			return err
+		}
+	}
+
+	outputDir, err = filepath.Abs(outputDir)
+	if err != nil {
+		return fmt.Errorf("failed to get absolute path: %v", err)
+	}
+
+	internal.Log.Info("Backing up instance", "instance", instanceName)
+
+	archivePath, err := internal.CreateBackup(config, outputDir)
+	if err != nil {
+		return fmt.Errorf("failed to back up instance %s: %v", instanceName, err)
+	}
+
+	info, err := os.Stat(archivePath)
+	if err != nil {
+		return err
+	}
+
+	if err := internal.StoreBackup(instanceName, archivePath, info.Size()); err != nil {
+		internal.Log.Warning("Failed to record backup", "error", err)
+	}
+
+	internal.Log.Success("Backup written", "path", archivePath, "bytes", info.Size())
+	return nil
+}
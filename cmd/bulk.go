@@ -0,0 +1,220 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+
+	"graphsense-cli/internal"
+
+	"github.com/nicksnyder/go-i18n/v2/i18n"
+	"github.com/spf13/cobra"
+)
+
+var (
+	bulkAll     bool
+	bulkFilters []string
+)
+
+// addBulkFlags registers --all and --filter on a command that acts on instances
+func addBulkFlags(cmd *cobra.Command) {
+	cmd.Flags().BoolVar(&bulkAll, "all", false, "Act on all instances")
+	cmd.Flags().StringArrayVar(&bulkFilters, "filter", nil, "With --all, only act on instances matching key=pattern (keys: name, repo, label; patterns may use * wildcards), e.g. label=team=backend")
+}
+
+// bulkArgs accepts instance names, or none when --all is set
+func bulkArgs(cmd *cobra.Command, args []string) error {
+	if bulkAll && len(args) > 0 {
+		return fmt.Errorf("--all does not take instance names")
+	}
+	if !bulkAll && len(args) == 0 {
+		return fmt.Errorf("requires at least one instance name or --all")
+	}
+	if len(bulkFilters) > 0 && !bulkAll {
+		return fmt.Errorf("--filter requires --all")
+	}
+	return nil
+}
+
+// resolveInstances returns the instance names a bulk command acts on
+func resolveInstances(args []string) ([]string, error) {
+	if !bulkAll {
+		return args, nil
+	}
+
+	filters, err := parseInstanceFilters(bulkFilters)
+	if err != nil {
+		return nil, err
+	}
+
+	projects, err := internal.GetGraphsenseProjects()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list instances: %v", err)
+	}
+
+	var names []string
+	for _, name := range projects {
+		if matchesInstanceFilters(name, filters) {
+			names = append(names, name)
+		}
+	}
+	if len(names) == 0 {
+		return nil, fmt.Errorf("no instances match")
+	}
+	return names, nil
+}
+
+// resolveRecordedInstances is resolveInstances for instances recorded in instances.db that
+// have no containers left, which --all selects instead of the running compose projects
+func resolveRecordedInstances(args []string) ([]string, error) {
+	if !bulkAll {
+		return args, nil
+	}
+
+	filters, err := parseInstanceFilters(bulkFilters)
+	if err != nil {
+		return nil, err
+	}
+
+	recorded, err := internal.GetInstanceNames()
+	if err != nil {
+		return nil, err
+	}
+	projects, err := internal.GetGraphsenseProjects()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list instances: %v", err)
+	}
+	running := make(map[string]bool)
+	for _, name := range projects {
+		running[name] = true
+	}
+
+	var names []string
+	for _, name := range recorded {
+		if !running[name] && matchesInstanceFilters(name, filters) {
+			names = append(names, name)
+		}
+	}
+	if len(names) == 0 {
+		return nil, fmt.Errorf("no instances without containers match")
+	}
+	return names, nil
+}
+
+// instanceFilter is one key=pattern filter. For label filters, pattern is label[=pattern].
+type instanceFilter struct {
+	key     string
+	pattern string
+}
+
+// parseInstanceFilters parses key=pattern filters
+func parseInstanceFilters(values []string) ([]instanceFilter, error) {
+	var filters []instanceFilter
+	for _, value := range values {
+		key, pattern, ok := strings.Cut(value, "=")
+		if !ok || pattern == "" {
+			return nil, fmt.Errorf("invalid filter '%s': expected key=pattern", value)
+		}
+		if key != "name" && key != "repo" && key != "label" {
+			return nil, fmt.Errorf("invalid filter key '%s': must be name, repo or label", key)
+		}
+		glob := pattern
+		if key == "label" {
+			var labelKey string
+			labelKey, glob, _ = strings.Cut(pattern, "=")
+			if err := internal.ValidateLabelKey(labelKey); err != nil {
+				return nil, fmt.Errorf("invalid filter '%s': %v", value, err)
+			}
+		}
+		if _, err := filepath.Match(glob, ""); err != nil {
+			return nil, fmt.Errorf("invalid filter pattern '%s': %v", glob, err)
+		}
+		filters = append(filters, instanceFilter{key: key, pattern: pattern})
+	}
+	return filters, nil
+}
+
+// matchesInstanceFilters reports whether an instance matches every filter.
+// Patterns without wildcards match as substrings; a label filter without a pattern matches
+// instances that have the label.
+func matchesInstanceFilters(instanceName string, filters []instanceFilter) bool {
+	for _, filter := range filters {
+		value, pattern := instanceName, filter.pattern
+		switch filter.key {
+		case "repo":
+			config, err := internal.GetInstanceConfig(instanceName)
+			if err != nil {
+				return false
+			}
+			value = config.RepoPath
+		case "label":
+			labels, err := internal.GetInstanceLabels(instanceName)
+			if err != nil {
+				return false
+			}
+			labelKey, labelPattern, hasPattern := strings.Cut(filter.pattern, "=")
+			labelValue, ok := labels[labelKey]
+			if !ok {
+				return false
+			}
+			if !hasPattern {
+				continue
+			}
+			value, pattern = labelValue, labelPattern
+		}
+
+		if !matchesPattern(value, pattern) {
+			return false
+		}
+	}
+	return true
+}
+
+// matchesPattern matches value against a filter pattern: a glob if it has wildcards,
+// otherwise a substring
+func matchesPattern(value, pattern string) bool {
+	if !strings.ContainsAny(pattern, "*?[") {
+		return strings.Contains(value, pattern)
+	}
+	matched, _ := filepath.Match(pattern, value)
+	return matched
+}
+
+// runBulk runs action for every instance. A single instance behaves exactly like the
+// one-instance commands; several are all attempted, followed by a summary table, and
+// the result is an error if any of them failed.
+func runBulk(names []string, action func(instanceName string) error) error {
+	if len(names) == 1 {
+		return action(names[0])
+	}
+
+	errs := make([]error, len(names))
+	failed := 0
+	for i, name := range names {
+		if errs[i] = action(name); errs[i] != nil {
+			internal.Log.Error("Failed", "instance", name, "error", errs[i])
+			failed++
+		}
+	}
+
+	fmt.Println()
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 3, ' ', 0)
+	fmt.Fprintln(w, internal.Localize(&i18n.Message{ID: "BulkTableHeader", Other: "INSTANCE\tRESULT\tERROR"}, nil))
+	for i, name := range names {
+		if errs[i] != nil {
+			fmt.Fprintf(w, "%s\t%s\t%v\n", name, internal.Localize(&i18n.Message{ID: "ResultFailed", Other: "failed"}, nil), errs[i])
+		} else {
+			fmt.Fprintf(w, "%s\t%s\t\n", name, internal.Localize(&i18n.Message{ID: "ResultOK", Other: "ok"}, nil))
+		}
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("%d of %d instances failed", failed, len(names))
+	}
+	return nil
+}
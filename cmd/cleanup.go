@@ -1,6 +1,9 @@
 package cmd
 
 import (
+	"context"
+	"fmt"
+
 	"graphsense-cli/internal"
 
 	"github.com/spf13/cobra"
@@ -8,28 +11,88 @@ import (
 
 var cleanupCmd = &cobra.Command{
 	Use:   "cleanup",
-	Short: "Clean up stopped containers and unused volumes",
-	Long:  "Remove all stopped containers and unused volumes to free up disk space.",
+	Short: "Clean up containers and volumes of orphaned GraphSense projects",
+	Long: `Remove the stopped containers and unused volumes of GraphSense compose projects that no
+instance in instances.db owns, such as those left behind by a deploy whose record was lost,
+to free up disk space. Instances that are only stopped keep their containers and data, and
+containers and volumes of other compose projects or outside compose are never touched.
+
+With --images, also remove GraphSense app, database and embedding images that no container
+uses any more, such as the ones left behind by upgrades. The most recent images of each
+repository are kept so an upgrade can still be rolled back.`,
 	RunE: func(cmd *cobra.Command, args []string) error {
+		if cleanupKeepImages < 0 {
+			return fmt.Errorf("--keep must not be negative")
+		}
 		return cleanup()
 	},
 }
 
+var (
+	cleanupImages     bool
+	cleanupKeepImages int
+)
+
+func init() {
+	cleanupCmd.Flags().BoolVar(&cleanupImages, "images", false, "Also remove GraphSense images no instance uses any more")
+	cleanupCmd.Flags().IntVar(&cleanupKeepImages, "keep", internal.DefaultKeepImages, "With --images, the most recent images of each repository to keep")
+}
+
 func cleanup() error {
-	internal.Log.Info("Cleaning up stopped containers and unused volumes...")
-	
-	// Clean up stopped containers
-	err := internal.RunDockerCompose([]string{"container", "prune", "-f"}, nil)
+	internal.Log.Info("Cleaning up orphaned GraphSense containers and volumes...")
+
+	docker, err := internal.GetDockerClient()
 	if err != nil {
-		internal.Log.Warning("Failed to clean up containers, continuing...")
+		return err
 	}
+	ctx := context.Background()
 
-	// Clean up unused volumes  
-	err = internal.RunDockerCompose([]string{"volume", "prune", "-f"}, nil)
+	projects, err := internal.GetOrphanedProjects()
 	if err != nil {
-		internal.Log.Warning("Failed to clean up volumes, continuing...")
+		return err
+	}
+
+	var containers, volumes int
+	var reclaimed uint64
+	for _, project := range projects {
+		count, size, err := docker.PruneContainers(ctx, project)
+		if err != nil {
+			internal.Log.Warning("Failed to clean up containers, continuing...", "project", project, "error", err)
+			continue
+		}
+		containers += count
+		reclaimed += size
+
+		// Volumes still used by a running container of the project are kept
+		count, size, err = docker.PruneVolumes(ctx, project)
+		if err != nil {
+			internal.Log.Warning("Failed to clean up volumes, continuing...", "project", project, "error", err)
+			continue
+		}
+		volumes += count
+		reclaimed += size
+	}
+	internal.Log.Info("Removed orphaned containers and volumes", "projects", len(projects), "containers", containers, "volumes", volumes, "reclaimed", internal.FormatSize(int64(reclaimed)))
+
+	if cleanupImages {
+		cleanupUnusedImages(ctx)
 	}
 
 	internal.Log.Success("Cleanup completed.")
 	return nil
 }
+
+// cleanupUnusedImages removes the GraphSense images no container uses
+func cleanupUnusedImages(ctx context.Context) {
+	images, err := internal.FindUnusedImages(ctx, cleanupKeepImages)
+	if err != nil {
+		internal.Log.Warning("Failed to find unused images, continuing...", "error", err)
+		return
+	}
+	count, reclaimed, err := internal.RemoveImages(ctx, images)
+	if err != nil {
+		internal.Log.Warning("Failed to clean up images, continuing...", "error", err)
+		return
+	}
+	internal.Log.Info("Removed unused images", "images", count, "reclaimed", internal.FormatSize(reclaimed))
+}
@@ -0,0 +1,171 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+
+	"graphsense-cli/internal"
+
+	"github.com/spf13/cobra"
+)
+
+var clonePort int
+
+var cloneCmd = &cobra.Command{
+	Use:   "clone <instance_name> <new_name>",
+	Short: "Clone an instance including its indexed data",
+	Long: `Create a second, independent instance from a copy of an existing instance's data.
+
+The source instance is stopped while its volumes are copied, then started again. The clone
+indexes the same repository, runs the same images and configuration on its own ports, and
+can be changed or removed without affecting the source. Copying needs as much free disk
+space as the source's volumes use.`,
+	Args: cobra.ExactArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return cloneInstance(args[0], args[1], clonePort)
+	},
+}
+
+func init() {
+	cloneCmd.Flags().IntVar(&clonePort, "port", 0, "Base port for the clone (default: auto-assigned)")
+	addPortSchemeFlags(cloneCmd)
+}
+
+func cloneInstance(sourceName, newName string, basePort int) error {
+	newName = internal.SanitizeInstanceName(newName)
+	if newName == sourceName {
+		return fmt.Errorf("the clone needs a name other than '%s'", sourceName)
+	}
+	for _, name := range []string{sourceName, newName} {
+		release, err := internal.LockInstance(name)
+		if err != nil {
+			return err
+		}
+		defer release()
+	}
+
+	if !internal.InstanceExists(sourceName) {
+		return fmt.Errorf("instance '%s' does not exist", sourceName)
+	}
+	if err := checkNameAvailable(newName); err != nil {
+		return err
+	}
+
+	source, status, err := internal.GetDeployment(sourceName)
+	if err != nil {
+		return err
+	}
+	if source == nil {
+		if source, err = internal.GetInstanceConfig(sourceName); err != nil {
+			return err
+		}
+	} else if status != internal.DeployStatusComplete {
+		return fmt.Errorf("the deploy of '%s' did not complete. Finish it with 'deploy --resume %s' first", sourceName, sourceName)
+	}
+
+	scheme, err := portScheme(basePort)
+	if err != nil {
+		return err
+	}
+	// The clone publishes its ports where the source does
+	scheme.BindAddress = source.BindAddress
+	ports, err := internal.ReservePortSet(scheme, newName)
+	if err != nil {
+		return fmt.Errorf("failed to find available ports: %v", err)
+	}
+	// The ports stay reserved once the clone is recorded
+	recorded := false
+	defer func() {
+		if !recorded {
+			internal.ReleasePorts(newName)
+		}
+	}()
+
+	clone := *source
+	clone.InstanceName = newName
+	ports.Apply(&clone)
+
+	coAPIKey, anthropicAPIKey, err := internal.LoadAPIKeys()
+	if err != nil {
+		if clone.LocalEmbeddings() == nil {
+			return fmt.Errorf("failed to load API keys: %v", err)
+		}
+		internal.Log.Warning("No API keys loaded", "error", err)
+	}
+	clone.CoAPIKey = coAPIKey
+	clone.AnthropicAPIKey = anthropicAPIKey
+	// Fail before anything is stopped if the database credentials cannot be read
+	if _, err := source.Credentials(); err != nil {
+		return err
+	}
+
+	internal.Log.Info("Cloning instance", "instance", sourceName, "clone", newName)
+
+	docker, err := internal.GetDockerClient()
+	if err != nil {
+		return err
+	}
+	running, err := internal.AppRunning(sourceName)
+	if err != nil {
+		return err
+	}
+
+	// Database files are only consistent while the databases are stopped
+	internal.Log.Info("Stopping instance while its volumes are copied", "instance", sourceName)
+	if err := docker.StopProject(context.Background(), sourceName); err != nil {
+		return fmt.Errorf("failed to stop instance %s: %v", sourceName, err)
+	}
+	volumes, copyErr := internal.CopyInstanceVolumes(sourceName, newName)
+	if running {
+		if err := docker.StartProject(context.Background(), sourceName); err != nil {
+			internal.Log.Error("Failed to restart instance", "instance", sourceName, "error", err)
+		}
+	}
+	if copyErr != nil {
+		return copyErr
+	}
+
+	// The copied databases keep the passwords of the source
+	if err := internal.CopyInstanceCredentials(source, &clone); err != nil {
+		internal.RemoveVolumes(volumes)
+		return err
+	}
+	if err := internal.CopyInstanceTLS(source, &clone); err != nil {
+		internal.DeleteInstanceCredentials(newName, clone.CredentialStore)
+		internal.RemoveVolumes(volumes)
+		return err
+	}
+	if err := internal.SaveDeployment(&clone, internal.DeployStatusComplete); err != nil {
+		internal.DeleteInstanceCredentials(newName, clone.CredentialStore)
+		internal.DeleteInstanceTLS(newName)
+		internal.RemoveVolumes(volumes)
+		return err
+	}
+	recorded = true
+
+	internal.Log.Info("Starting services for instance", "instance", newName)
+	if err := internal.StartServices(&clone); err != nil {
+		return fmt.Errorf("%v. Remove the clone with 'graphsense-cli remove %s'", err, newName)
+	}
+
+	if _, err := internal.WaitForHealthy(context.Background(), &clone, internal.DefaultHealthOptions); err != nil {
+		internal.Log.Warning("Health check failed, but continuing", "error", err)
+	}
+	if err := internal.StoreInstanceContainers(&clone); err != nil {
+		internal.Log.Warning("Failed to store container information", "error", err)
+	}
+	if err := internal.TouchInstance(newName, "cloned"); err != nil {
+		internal.Log.Warning("Failed to record activity", "error", err)
+	}
+
+	syncProxyRoutes()
+	internal.Log.Success("Instance cloned", "instance", newName, "source", sourceName)
+	host := clone.HostAddress()
+	internal.Log.Info("MCP server", "url", clone.AppURL())
+	if !clone.IsSingleContainer() {
+		internal.Log.Info("PostgreSQL", "address", fmt.Sprintf("%s:%d", host, clone.PostgresPort))
+		internal.Log.Info("Neo4j Bolt", "url", fmt.Sprintf("bolt://%s:%d", host, clone.Neo4jBoltPort))
+	}
+	printProxyURL(newName)
+	return nil
+}
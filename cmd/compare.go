@@ -0,0 +1,91 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"graphsense-cli/internal"
+
+	"github.com/nicksnyder/go-i18n/v2/i18n"
+	"github.com/spf13/cobra"
+)
+
+var compareAll bool
+
+var compareCmd = &cobra.Command{
+	Use:   "compare <instance_a> <instance_b>",
+	Short: "Compare the configuration of two instances",
+	Long: `Show the configuration of two instances side by side: ports, images and their digests,
+database engine versions, environment, resource limits and volume sizes. Only the settings
+the instances disagree on are shown, unless --all is given.
+
+Environment values that hold secrets are redacted, and the instance name is replaced by
+<instance> so that settings derived from it compare equal.`,
+	Args: cobra.ExactArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return compareInstances(args[0], args[1])
+	},
+}
+
+func init() {
+	compareCmd.Flags().BoolVar(&compareAll, "all", false, "Also show the settings both instances agree on")
+	addOutputFlag(compareCmd)
+}
+
+func compareInstances(a, b string) error {
+	structured, err := structuredOutput()
+	if err != nil {
+		return err
+	}
+	for _, name := range []string{a, b} {
+		if !internal.InstanceExists(name) {
+			return fmt.Errorf("instance '%s' does not exist", name)
+		}
+	}
+
+	rows, err := internal.CompareInstances(a, b)
+	if err != nil {
+		return err
+	}
+	shown := make([]internal.CompareRow, 0, len(rows))
+	for _, row := range rows {
+		if compareAll || row.Differs() {
+			shown = append(shown, row)
+		}
+	}
+
+	if structured {
+		return printStructured(shown)
+	}
+
+	if len(shown) == 0 {
+		internal.Log.Info("The instances have the same configuration", "a", a, "b", b)
+		return nil
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 3, ' ', 0)
+	fmt.Fprintf(w, "%s\t%s\t%s\t\n", internal.Localize(&i18n.Message{ID: "CompareTableHeader", Other: "SECTION\tSETTING"}, nil), a, b)
+	section := ""
+	for _, row := range shown {
+		label := ""
+		if row.Section != section {
+			section = row.Section
+			label = section
+		}
+		marker := " "
+		if row.Differs() {
+			marker = internal.Symbol("≠", "*")
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", label, row.Key, compareValue(row.A), compareValue(row.B), marker)
+	}
+	return w.Flush()
+}
+
+// compareValue returns a compared value for printing, with a dash for missing settings
+func compareValue(value string) string {
+	if value == "" {
+		return "-"
+	}
+	return value
+}
@@ -0,0 +1,122 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"graphsense-cli/internal"
+
+	"github.com/spf13/cobra"
+)
+
+var completionCmd = &cobra.Command{
+	Use:   "completion bash|zsh|fish|powershell",
+	Short: "Generate a shell completion script",
+	Long: `Generate a completion script for your shell. Instance names complete from instances.db.
+
+Bash:
+  source <(graphsense-cli completion bash)
+  # or permanently:
+  graphsense-cli completion bash > /etc/bash_completion.d/graphsense-cli
+
+Zsh:
+  graphsense-cli completion zsh > "${fpath[1]}/_graphsense-cli"
+
+Fish:
+  graphsense-cli completion fish > ~/.config/fish/completions/graphsense-cli.fish
+
+PowerShell:
+  graphsense-cli completion powershell | Out-String | Invoke-Expression`,
+	Args:                  cobra.MatchAll(cobra.ExactArgs(1), cobra.OnlyValidArgs),
+	ValidArgs:             []string{"bash", "zsh", "fish", "powershell"},
+	DisableFlagsInUseLine: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		switch args[0] {
+		case "bash":
+			return rootCmd.GenBashCompletionV2(os.Stdout, true)
+		case "zsh":
+			return rootCmd.GenZshCompletion(os.Stdout)
+		case "fish":
+			return rootCmd.GenFishCompletion(os.Stdout, true)
+		case "powershell":
+			return rootCmd.GenPowerShellCompletionWithDesc(os.Stdout)
+		default:
+			return fmt.Errorf("unsupported shell '%s'", args[0])
+		}
+	},
+}
+
+// completeInstanceNames completes the first argument with the instances recorded in instances.db
+func completeInstanceNames(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	if len(args) > 0 {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+	return instanceNameCompletions(toComplete), cobra.ShellCompDirectiveNoFileComp
+}
+
+// completeInstanceNamesRepeated completes any number of distinct instance names
+func completeInstanceNamesRepeated(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	var names []string
+	for _, name := range instanceNameCompletions(toComplete) {
+		if !slices.Contains(args, name) {
+			names = append(names, name)
+		}
+	}
+	return names, cobra.ShellCompDirectiveNoFileComp
+}
+
+// completeSetLogLevelArgs completes an instance name followed by a log level
+func completeSetLogLevelArgs(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	if len(args) == 1 {
+		return internal.AppLogLevels, cobra.ShellCompDirectiveNoFileComp
+	}
+	return completeInstanceNames(cmd, args, toComplete)
+}
+
+// completeSetAutostartArgs completes an instance name followed by an autostart policy
+func completeSetAutostartArgs(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	if len(args) == 1 {
+		return internal.AutostartPolicies, cobra.ShellCompDirectiveNoFileComp
+	}
+	return completeInstanceNames(cmd, args, toComplete)
+}
+
+// completeLogsArgs completes an instance name followed by one of its services
+func completeLogsArgs(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	switch len(args) {
+	case 0:
+		return instanceNameCompletions(toComplete), cobra.ShellCompDirectiveNoFileComp
+	case 1:
+		return []string{"app", "postgres", "neo4j"}, cobra.ShellCompDirectiveNoFileComp
+	default:
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+}
+
+// instanceNameCompletions returns the recorded instance names starting with prefix
+func instanceNameCompletions(prefix string) []string {
+	// Opening the database creates it and logs to stdout, which would end up in the completions
+	graphsenseDir, err := internal.GetGraphsenseDir()
+	if err != nil {
+		return nil
+	}
+	if _, err := os.Stat(filepath.Join(graphsenseDir, "instances.db")); err != nil {
+		return nil
+	}
+
+	names, err := internal.GetInstanceNames()
+	if err != nil {
+		return nil
+	}
+
+	var matches []string
+	for _, name := range names {
+		if strings.HasPrefix(name, prefix) {
+			matches = append(matches, name)
+		}
+	}
+	return matches
+}
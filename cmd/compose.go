@@ -0,0 +1,65 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+
+	"graphsense-cli/internal"
+
+	"github.com/spf13/cobra"
+)
+
+var composeCmd = &cobra.Command{
+	Use:   "compose <instance_name> -- <args...>",
+	Short: "Run docker compose for an instance",
+	Long: `Run any docker compose subcommand against an instance, with its project name, compose
+files and environment rendered from its recorded deploy configuration.
+
+Changes made this way, such as recreating services with different options, are not
+recorded and are undone by the next upgrade.`,
+	Example: `  graphsense-cli compose my-analysis -- ps
+  graphsense-cli compose my-analysis -- run --rm app sh
+  graphsense-cli compose my-analysis -- top neo4j`,
+	Args: func(cmd *cobra.Command, args []string) error {
+		if cmd.ArgsLenAtDash() != 1 || len(args) < 2 {
+			return fmt.Errorf("requires an instance name followed by -- and the compose arguments")
+		}
+		return nil
+	},
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return runCompose(args[0], args[1:])
+	},
+}
+
+// runCompose runs docker compose with args for an instance and exits with its exit code
+func runCompose(instanceName string, args []string) error {
+	config, err := composeInstanceConfig(instanceName)
+	if err != nil {
+		return err
+	}
+
+	files, err := internal.PrepareComposeFiles(config)
+	if err != nil {
+		return err
+	}
+	defer files.Cleanup()
+
+	runner, err := internal.GetComposeRunner()
+	if err != nil {
+		return err
+	}
+	envVars := map[string]string{
+		"COMPOSE_PROJECT_NAME": instanceName,
+	}
+	if err := runner.RunInteractive(files.Args(args...), files.Env(envVars)); err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			files.Cleanup()
+			os.Exit(exitErr.ExitCode())
+		}
+		return fmt.Errorf("failed to run docker compose: %v", err)
+	}
+	return nil
+}
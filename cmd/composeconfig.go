@@ -0,0 +1,65 @@
+package cmd
+
+import (
+	"fmt"
+
+	"graphsense-cli/internal"
+
+	"github.com/spf13/cobra"
+)
+
+var composeConfigShowSecrets bool
+
+var composeConfigCmd = &cobra.Command{
+	Use:   "compose-config <instance_name>",
+	Short: "Print the resolved compose configuration of an instance",
+	Long: `Print the fully resolved docker compose configuration of an instance, rendered from its
+recorded deploy configuration the same way deploy and upgrade render it. This shows the
+mounts, ports, images and environment every service is started with.
+
+Values of environment variables holding keys, passwords, secrets or tokens are masked
+unless --show-secrets is given.`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return printComposeConfig(args[0])
+	},
+}
+
+func init() {
+	composeConfigCmd.Flags().BoolVar(&composeConfigShowSecrets, "show-secrets", false, "Print secret environment values instead of masking them")
+}
+
+func printComposeConfig(instanceName string) error {
+	config, err := composeInstanceConfig(instanceName)
+	if err != nil {
+		return err
+	}
+
+	output, err := internal.ResolveComposeConfig(config, composeConfigShowSecrets)
+	if err != nil {
+		return err
+	}
+	fmt.Print(output)
+	return nil
+}
+
+// composeInstanceConfig returns the configuration of an instance with the API keys its
+// compose files are rendered with
+func composeInstanceConfig(instanceName string) (*internal.DeployConfig, error) {
+	config, err := internal.GetInstanceConfig(instanceName)
+	if err != nil {
+		return nil, err
+	}
+	if config.IsSingleContainer() {
+		return nil, fmt.Errorf("instance '%s' runs in single-container mode and has no compose project", instanceName)
+	}
+
+	// The API keys are not recorded with the deploy
+	coAPIKey, anthropicAPIKey, err := internal.LoadAPIKeys()
+	if err != nil {
+		internal.Log.Warning("No API keys loaded, the configuration is rendered without them", "error", err)
+	}
+	config.CoAPIKey = coAPIKey
+	config.AnthropicAPIKey = anthropicAPIKey
+	return config, nil
+}
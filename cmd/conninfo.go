@@ -0,0 +1,69 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"graphsense-cli/internal"
+
+	"github.com/spf13/cobra"
+)
+
+var conninfoFormat string
+
+var conninfoCmd = &cobra.Command{
+	Use:   "conninfo <instance_name>",
+	Short: "Print database connection strings for an instance",
+	Long: `Print ready-to-use PostgreSQL and Neo4j connection details for an instance, for
+plugging external tools and notebooks into its data. In read-only mode the passwords are
+left out.
+
+Formats:
+  dsn   POSTGRES_URL and NEO4J_URI, one per line
+  env   shell export lines, e.g. eval "$(graphsense-cli conninfo my-instance --format env)"
+  json  all connection details as a JSON object`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return showConnInfo(args[0], conninfoFormat)
+	},
+}
+
+func init() {
+	conninfoCmd.Flags().StringVar(&conninfoFormat, "format", "dsn", "Output format: dsn, env or json")
+}
+
+func showConnInfo(instanceName, format string) error {
+	if format != "dsn" && format != "env" && format != "json" {
+		return fmt.Errorf("invalid format '%s': must be dsn, env or json", format)
+	}
+
+	config, err := internal.GetInstanceConfig(instanceName)
+	if err != nil {
+		return err
+	}
+	info, err := internal.GetConnInfo(config)
+	if err != nil {
+		return err
+	}
+	// The passwords would let the holder change the databases
+	if readOnly {
+		info = info.WithoutPasswords()
+	}
+
+	switch format {
+	case "env":
+		for _, env := range info.EnvVars() {
+			fmt.Printf("export %s=%q\n", env[0], env[1])
+		}
+	case "json":
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(info)
+	default:
+		fmt.Println(info.PostgresURL)
+		fmt.Println(info.Neo4jURI)
+	}
+
+	return nil
+}
@@ -0,0 +1,76 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"graphsense-cli/internal"
+
+	"github.com/nicksnyder/go-i18n/v2/i18n"
+	"github.com/spf13/cobra"
+)
+
+var credentialsCmd = &cobra.Command{
+	Use:   "credentials <instance_name>",
+	Short: "Print the database credentials of an instance",
+	Long: `Print the PostgreSQL and Neo4j users and passwords of an instance.
+
+Every instance gets its own random passwords when it is deployed, and Neo4j requires
+authentication. They are stored in the OS keyring, or in ~/.graphsense/credentials/ readable
+only by you where no keyring is available, and reach the containers through the environment
+of docker compose. Instances deployed before passwords were generated keep the fixed
+postgres/postgres login and Neo4j without authentication.
+
+The credentials are kept with the data by 'remove --keep-data', follow the instance through
+rename and clone, and are deleted with it by remove.`,
+	Example: `  graphsense-cli credentials my-analysis
+  PGPASSWORD=$(graphsense-cli credentials my-analysis -o json | jq -r .postgres_password)`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return showCredentials(args[0])
+	},
+}
+
+func init() {
+	addOutputFlag(credentialsCmd)
+}
+
+func showCredentials(instanceName string) error {
+	structured, err := structuredOutput()
+	if err != nil {
+		return err
+	}
+
+	config, err := internal.GetInstanceConfig(instanceName)
+	if err != nil {
+		return err
+	}
+	credentials, err := config.Credentials()
+	if err != nil {
+		return err
+	}
+	if structured {
+		return printStructured(credentials)
+	}
+
+	location := "none, the legacy defaults"
+	switch credentials.Store {
+	case internal.CredentialStoreKeyring:
+		location = "OS keyring"
+	case internal.CredentialStoreFile:
+		location, _ = internal.CredentialsFile(instanceName)
+	}
+	neo4jPassword := credentials.Neo4jPassword
+	if neo4jPassword == "" {
+		neo4jPassword = internal.Localize(&i18n.Message{ID: "AuthenticationDisabled", Other: "- (authentication disabled)"}, nil)
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 3, ' ', 0)
+	fmt.Fprintf(w, "%s\t%s\n", internal.Localize(&i18n.Message{ID: "CredentialsStoredIn", Other: "Stored in:"}, nil), location)
+	fmt.Fprintf(w, "%s\t%s\n", internal.Localize(&i18n.Message{ID: "CredentialsPostgresUser", Other: "PostgreSQL user:"}, nil), credentials.PostgresUser)
+	fmt.Fprintf(w, "%s\t%s\n", internal.Localize(&i18n.Message{ID: "CredentialsPostgresPassword", Other: "PostgreSQL password:"}, nil), credentials.PostgresPassword)
+	fmt.Fprintf(w, "%s\t%s\n", internal.Localize(&i18n.Message{ID: "CredentialsNeo4jUser", Other: "Neo4j user:"}, nil), credentials.Neo4jUser)
+	fmt.Fprintf(w, "%s\t%s\n", internal.Localize(&i18n.Message{ID: "CredentialsNeo4jPassword", Other: "Neo4j password:"}, nil), neo4jPassword)
+	return w.Flush()
+}
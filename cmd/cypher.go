@@ -0,0 +1,62 @@
+package cmd
+
+import (
+	"fmt"
+
+	"graphsense-cli/internal"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	cypherQuery  string
+	cypherFormat string
+)
+
+var cypherCmd = &cobra.Command{
+	Use:   "cypher <instance_name>",
+	Short: "Open cypher-shell connected to an instance's graph",
+	Long: `Open an interactive cypher-shell in the neo4j container of an instance, connected to its
+graph database. With --query, the query is run once and cypher-shell exits.`,
+	Example: `  graphsense-cli cypher my-analysis
+  graphsense-cli cypher my-analysis --query "MATCH (n) RETURN labels(n), count(*)"`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return runCypherShell(args[0], cypherQuery)
+	},
+}
+
+func init() {
+	cypherCmd.Flags().StringVar(&cypherQuery, "query", "", "Run this Cypher query and exit instead of starting an interactive session")
+	cypherCmd.Flags().StringVar(&cypherFormat, "format", "auto", "cypher-shell output format: auto, verbose or plain")
+}
+
+// runCypherShell runs cypher-shell in the neo4j container of an instance, interactively or for one query
+func runCypherShell(instanceName, query string) error {
+	if cypherFormat != "auto" && cypherFormat != "verbose" && cypherFormat != "plain" {
+		return fmt.Errorf("invalid format '%s': must be auto, verbose or plain", cypherFormat)
+	}
+
+	config, err := internal.GetInstanceConfig(instanceName)
+	if err != nil {
+		return err
+	}
+	if config.IsSingleContainer() {
+		return fmt.Errorf("instance '%s' runs in single-container mode, which does not expose Neo4j", instanceName)
+	}
+
+	env, err := config.CypherShellEnv()
+	if err != nil {
+		return err
+	}
+
+	// cypher-shell reads the password from NEO4J_PASSWORD
+	command := []string{"cypher-shell", "-u", internal.Neo4jUser, "-d", internal.Neo4jDB, "--format", cypherFormat}
+	if readOnly {
+		command = append(command, "--access-mode", "read")
+	}
+	if query != "" {
+		command = append(command, query)
+	}
+	return runExecEnv(instanceName, "neo4j", env, command)
+}
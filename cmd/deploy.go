@@ -1,26 +1,161 @@
 package cmd
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"os"
+	"os/signal"
 	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
 
 	"graphsense-cli/internal"
 
+	"github.com/nicksnyder/go-i18n/v2/i18n"
 	"github.com/spf13/cobra"
 )
 
 var (
-	port int
+	port            int
+	resume          string
+	autoSuffix      bool
+	healthTimeout   time.Duration
+	healthInterval  time.Duration
+	singleContainer bool
+	embeddingModel  string
+	noSubmodules    bool
+	cloneDepth      int
+	cloneSparse     []string
+	cloneLFS        string
+	autostart       string
+	deployLabels    []string
+	cpuset          string
+	neo4jCPUSet     string
+	numaNode        int
+	indexWorkers    int
+	indexBatchSize  int
+	nice            bool
+	noKeyCheck      bool
+	deployTLS       bool
+	tlsOptions      internal.TLSOptions
+	memoryLimit     string
+	neo4jHeap       string
+	neo4jPageCache  string
+	deployGPU       string
+	cpuLimit        string
+	deployProfile   string
+	deployImageTag  string
+	registerMCP     []string
+	deployTTL       time.Duration
+	deployForce     bool
+	// serviceMemoryLimits and serviceCPULimits hold --<service>-memory and --<service>-cpus
+	serviceMemoryLimits = make(map[string]*string)
+	serviceCPULimits    = make(map[string]*string)
+	// serviceImageTags holds --postgres-image-tag and --neo4j-image-tag
+	serviceImageTags = make(map[string]*string)
 )
 
 var deployCmd = &cobra.Command{
-	Use:   "deploy <repo_path> [instance_name]",
+	Use:   "deploy <repo_path|git_url> [instance_name]",
 	Short: "Deploy a new GraphSense instance",
 	Long: `Deploy a new GraphSense instance for the given repository.
-If instance_name is not provided, it will be generated from the repository name.`,
-	Args: cobra.MinimumNArgs(1),
+If instance_name is not provided, it will be generated from the repository name, followed by
+the checked-out branch unless that is the default branch, e.g. graphsense-myrepo-feature-x.
+
+Deploy progress is checkpointed per stage. A deploy interrupted with Ctrl+C stops at
+the end of its current stage, and an interrupted or failed deploy can be continued
+from its first incomplete stage with --resume <instance_name>. --resume also deploys an
+instance again whose definition was kept by 'remove --containers-only' or '--data-only'.
+
+Initialized git submodules are indexed with the repository; --no-submodules hides them.
+When the repository is a linked git worktree, the main checkout's git directory is
+mounted read-only as well so that git metadata resolves inside the container.
+
+A Git URL is cloned to ~/.graphsense/repos/<instance_name>, which is removed with the
+instance. --depth truncates its history, --sparse checks out only the given directories
+and --lfs skip leaves Git LFS files as pointers.
+
+Scripts the repository's .graphsense.yaml declares to run on this machine are shown and
+only run once confirmed. Without a terminal to ask on, and for Git URLs, the deploy fails
+unless --allow-scripts or the allow_scripts setting allows them.
+
+--label team=backend labels the instance, for 'list --filter label=team=backend' and the
+--filter of the bulk commands. Labels are also set as Docker labels on its containers.
+
+--cpuset pins the instance's containers to CPUs of the Docker host, e.g. 0-3,8, and
+--numa-node to the CPUs of one NUMA node of a local host. --neo4j-cpuset gives Neo4j CPUs
+of its own, isolating its indexing load from the rest of the instance and the host.
+
+--memory and --cpus limit each of the instance's containers, e.g. --memory 4g --cpus 2, so
+that a busy Neo4j cannot take the whole machine down. --neo4j-memory, --postgres-memory,
+--app-memory and the matching --<service>-cpus flags set a service's limits instead.
+
+--neo4j-heap and --neo4j-pagecache size Neo4j's heap and page cache, e.g. --neo4j-heap 4g,
+for repositories too large to index with Neo4j's defaults. Together they must fit into a
+memory limit of Neo4j.
+
+--gpu passes NVIDIA GPUs of the Docker host through to the app container, for local
+embedding models running inside the app: all of them, --gpu=2 for a number of them or
+--gpu=device=0,1 for given devices. The host needs the NVIDIA Container Toolkit.
+
+--index-workers and --index-batch-size throttle how hard the app indexes, and --nice keeps
+indexing in the background with one worker, small batches and a low CPU weight. Change them
+later with set-indexing.
+
+Ports are published on 127.0.0.1 only, unless --bind-address names another IPv4 or IPv6
+address or 0.0.0.0 for all interfaces. Instances on a remote Docker host publish on all
+interfaces by default.
+
+--tls serves the MCP endpoint over HTTPS, for instances reachable beyond localhost. It uses
+the certificate and key given with --cert and --key, or generates a self-signed certificate
+for localhost, the bind address and the host name. They are kept in
+~/.graphsense/tls/<instance_name> and mounted into the app container.
+
+--image-tag pins the app image to a tag, e.g. v0.4.2, and --postgres-image-tag and
+--neo4j-image-tag pin the databases. The image and digest each service runs are recorded
+and shown by list and status.
+
+--profile deploys with a named profile from the profiles section of ~/.graphsense/config.yaml,
+which bundles ports, limits, Neo4j memory, indexing settings, images, image tags, a TTL and
+environment variables of the services. Flags given on the command line take precedence over the profile.
+
+While the services start, each is shown pulling, creating, starting and healthy. With
+--plain or when output is not a terminal, e.g. in CI, every step is logged on its own line.
+
+--register-mcp claude,cursor adds the deployed instance to the config files of those MCP
+clients, as 'mcp-config --write' does. remove takes the entries out again.
+
+--ttl 72h lets the instance expire 72 hours after it was deployed: 'gc', and 'supervise'
+while it runs, then stop or remove it, as the gc section of the config file says. Change
+the TTL later with set-ttl.
+
+Before deploying, the repository is scanned: whether it is a git checkout, how many files and
+lines it holds, binary assets of 20MB or more and vendored directories such as node_modules,
+and roughly how long indexing takes and how much memory and disk it needs. If anything looks
+wrong, deploy asks before going on; --force deploys without asking.`,
+	Args: cobra.RangeArgs(0, 2),
 	RunE: func(cmd *cobra.Command, args []string) error {
+		for _, client := range registerMCP {
+			if _, err := internal.ResolveMCPClient(client); err != nil {
+				return err
+			}
+		}
+		if resume != "" {
+			if len(args) > 0 {
+				return fmt.Errorf("--resume does not take a repository path")
+			}
+			if deployProfile != "" {
+				return fmt.Errorf("--profile cannot be used with --resume, which deploys the recorded settings")
+			}
+			return resumeDeploy(resume)
+		}
+
+		if len(args) < 1 {
+			return fmt.Errorf("requires a repository path")
+		}
+
 		repoPath := args[0]
 		var instanceName string
 		
@@ -28,124 +163,958 @@ If instance_name is not provided, it will be generated from the repository name.
 			instanceName = args[1]
 		}
 
-		return deployInstance(repoPath, instanceName, port)
+		// Only deploys started here scan the repository and ask before indexing a risky one;
+		// batch deploys, the API and the other commands deploying skip it
+		var customize func(config *internal.DeployConfig)
+		if deployProfile != "" {
+			var err error
+			customize, err = applyDeployProfile(cmd, deployProfile)
+			if err != nil {
+				return err
+			}
+		}
+		return deployInstanceWith(repoPath, instanceName, port, customize, true)
 	},
 }
 
 func init() {
 	deployCmd.Flags().IntVar(&port, "port", 0, "Base port for the instance (default: auto-assigned)")
+	deployCmd.Flags().StringVar(&deployProfile, "profile", "", "Deploy with the settings of this profile from the config file; flags override them")
+	addPortSchemeFlags(deployCmd)
+	deployCmd.Flags().StringVar(&resume, "resume", "", "Resume an interrupted or failed deploy of the given instance, or deploy a removed one whose definition was kept")
+	deployCmd.Flags().DurationVar(&healthTimeout, "health-timeout", internal.DefaultHealthOptions.Timeout, "How long to wait for all services to become healthy")
+	deployCmd.Flags().DurationVar(&healthInterval, "health-interval", internal.DefaultHealthOptions.Interval, "How often to probe services while waiting for them to become healthy")
+	deployCmd.Flags().BoolVar(&singleContainer, "single-container", false, "Run the all-in-one image as a single container instead of separate app, PostgreSQL and Neo4j services")
+	deployCmd.Flags().StringVar(&embeddingModel, "embedding-model", "", "Serve embeddings from a model inside the instance instead of the Cohere API (local:<path-or-name>)")
+	deployCmd.Flags().BoolVar(&noSubmodules, "no-submodules", false, "Hide the repository's git submodules from the index")
+	deployCmd.Flags().IntVar(&cloneDepth, "depth", 0, "Clone only this many commits of a Git URL's history")
+	deployCmd.Flags().StringSliceVar(&cloneSparse, "sparse", nil, "Check out only these directories of a Git URL (comma-separated or repeated)")
+	deployCmd.Flags().StringVar(&cloneLFS, "lfs", internal.LFSFetch, "Git LFS policy for a Git URL: fetch or skip")
+	deployCmd.Flags().StringVar(&autostart, "autostart", internal.AutostartUnlessStopped, "Whether 'status --repair' restarts the instance after a Docker restart: unless-stopped, always or never")
+	deployCmd.Flags().StringVar(&portSchemeFlags.BindAddress, "bind-address", "", "Host address to publish the instance's ports on, IPv4 or IPv6; 0.0.0.0 for all interfaces (default 127.0.0.1)")
+	deployCmd.Flags().StringArrayVar(&deployLabels, "label", nil, "Label the instance with key=value, e.g. team=backend; repeat for several labels")
+	deployCmd.Flags().StringVar(&cpuset, "cpuset", "", "Pin the instance's containers to these CPUs of the Docker host, e.g. 0-3,8")
+	deployCmd.Flags().StringVar(&neo4jCPUSet, "neo4j-cpuset", "", "Pin Neo4j to these CPUs instead of those of --cpuset")
+	deployCmd.Flags().IntVar(&numaNode, "numa-node", -1, "Pin the instance's containers to the CPUs of this NUMA node of a local Docker host")
+	deployCmd.MarkFlagsMutuallyExclusive("cpuset", "numa-node")
+	deployCmd.Flags().StringVar(&memoryLimit, "memory", "", "Memory limit of each of the instance's containers, e.g. 4g")
+	deployCmd.Flags().StringVar(&cpuLimit, "cpus", "", "Number of CPUs each of the instance's containers may use, e.g. 2 or 0.5")
+	for _, service := range internal.LimitedServices {
+		serviceMemoryLimits[service] = deployCmd.Flags().String(service+"-memory", "", fmt.Sprintf("Memory limit of the %s container instead of --memory", service))
+		serviceCPULimits[service] = deployCmd.Flags().String(service+"-cpus", "", fmt.Sprintf("Number of CPUs the %s container may use instead of --cpus", service))
+	}
+	deployCmd.Flags().StringVar(&neo4jHeap, "neo4j-heap", "", "Size of Neo4j's heap, e.g. 4g (default: Neo4j's)")
+	deployCmd.Flags().StringVar(&neo4jPageCache, "neo4j-pagecache", "", "Size of Neo4j's page cache, e.g. 2g (default: Neo4j's)")
+	deployCmd.Flags().StringVar(&deployImageTag, "image-tag", "", "Pin the GraphSense app image to this tag, e.g. v0.4.2 (default: the compose file's tag)")
+	for _, service := range []string{"postgres", "neo4j"} {
+		serviceImageTags[service] = deployCmd.Flags().String(service+"-image-tag", "", fmt.Sprintf("Pin the %s image to this tag (default: the compose file's tag)", service))
+	}
+	deployCmd.Flags().StringVar(&deployGPU, "gpu", "", "Pass NVIDIA GPUs through to the app container: all, a number of GPUs or device=<id>,<id>")
+	deployCmd.Flags().Lookup("gpu").NoOptDefVal = internal.GPUAll
+	deployCmd.Flags().IntVar(&indexWorkers, "index-workers", 0, "Number of files the app indexes in parallel (default: the app's)")
+	deployCmd.Flags().IntVar(&indexBatchSize, "index-batch-size", 0, "Number of files the app indexes per batch (default: the app's)")
+	deployCmd.Flags().BoolVar(&nice, "nice", false, "Index in the background: one worker, small batches and a low CPU weight")
+	deployCmd.Flags().BoolVar(&noKeyCheck, "no-key-check", false, "Deploy without checking the API keys with their providers first")
+	deployCmd.Flags().BoolVar(&deployTLS, "tls", false, "Serve the MCP endpoint over HTTPS")
+	deployCmd.Flags().StringVar(&tlsOptions.CertPath, "cert", "", "With --tls, PEM certificate to serve, including any intermediate certificates")
+	deployCmd.Flags().StringVar(&tlsOptions.KeyPath, "key", "", "With --tls, PEM private key of --cert")
+	deployCmd.Flags().BoolVar(&tlsOptions.SelfSigned, "self-signed", false, "With --tls, generate a self-signed certificate (the default without --cert)")
+	deployCmd.Flags().StringSliceVar(&registerMCP, "register-mcp", nil, "Add the instance to these MCP clients' config files, and take it out again on remove: "+strings.Join(append([]string{"claude"}, internal.MCPClients...), ", "))
+	deployCmd.RegisterFlagCompletionFunc("register-mcp", func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+		return append([]string{"claude"}, internal.MCPClients...), cobra.ShellCompDirectiveNoFileComp
+	})
+	deployCmd.Flags().DurationVar(&deployTTL, "ttl", 0, "Let the instance expire this long after it is deployed, e.g. 72h, for gc to stop or remove it")
+	deployCmd.Flags().BoolVar(&deployForce, "force", false, "Deploy without asking when the repository scan finds a large repository, binary assets or vendored directories")
+	deployCmd.Flags().BoolVar(&autoSuffix, "auto-suffix", false, "Append a numeric suffix to the instance name if a non-GraphSense compose project already uses it")
+}
+
+// applyDeployProfile sets the deploy flags of a profile that were not given on the command line
+// and returns a customize function applying its settings that have no flag
+func applyDeployProfile(cmd *cobra.Command, name string) (func(config *internal.DeployConfig), error) {
+	settings, err := internal.LoadConfig()
+	if err != nil {
+		return nil, err
+	}
+	profile, err := settings.DeployProfile(name)
+	if err != nil {
+		return nil, err
+	}
+	if singleContainer {
+		if err := internal.CheckSingleContainerEnv(profile.Env); err != nil {
+			return nil, fmt.Errorf("invalid profile '%s': %v", name, err)
+		}
+	}
+
+	for flag, value := range profile.FlagValues() {
+		if cmd.Flags().Changed(flag) {
+			continue
+		}
+		if err := cmd.Flags().Set(flag, value); err != nil {
+			return nil, fmt.Errorf("invalid profile '%s': --%s: %v", name, flag, err)
+		}
+	}
+	internal.Log.Info("Using deploy profile", "profile", name)
+
+	return func(config *internal.DeployConfig) {
+		if profile.AppImage != "" {
+			config.AppImage = profile.AppImage
+		}
+		config.ServiceEnv = profile.Env
+	}, nil
 }
 
 func deployInstance(repoPath, instanceName string, basePort int) error {
-	// Validate repo path
-	if _, err := os.Stat(repoPath); os.IsNotExist(err) {
-		return fmt.Errorf("repository path does not exist: %s", repoPath)
+	return deployInstanceWith(repoPath, instanceName, basePort, nil, false)
+}
+
+// deployInstanceWith deploys like deployInstance, letting customize adjust settings that have
+// no deploy flag before the instance is created. Interactive deploys, started by the deploy
+// command, scan the repository once the instance is known to be free, see scanRepository,
+// and may ask before running its host scripts, see approveHostScripts.
+func deployInstanceWith(repoPath, instanceName string, basePort int, customize func(config *internal.DeployConfig), interactive bool) error {
+	var repoURL, absRepoPath string
+	cloneOptions := internal.CloneOptions{Depth: cloneDepth, Sparse: cloneSparse, LFS: cloneLFS}
+	if internal.IsGitURL(repoPath) {
+		if err := cloneOptions.Validate(); err != nil {
+			return err
+		}
+		repoURL = repoPath
+	} else {
+		if cloneDepth != 0 || len(cloneSparse) > 0 || cloneLFS != internal.LFSFetch {
+			return fmt.Errorf("--depth, --sparse and --lfs only apply when deploying from a Git URL")
+		}
+
+		// Validate repo path
+		if _, err := os.Stat(repoPath); os.IsNotExist(err) {
+			return fmt.Errorf("repository path does not exist: %s", repoPath)
+		}
+
+		// Convert to absolute path
+		var err error
+		absRepoPath, err = filepath.Abs(repoPath)
+		if err != nil {
+			return fmt.Errorf("failed to get absolute path: %v", err)
+		}
+	}
+
+	// The repository is bind-mounted by the Docker engine, so it has to exist on that machine
+	if internal.IsRemoteDocker() {
+		if repoURL != "" {
+			internal.Log.Warning("Deploying to a remote Docker host: the repository is cloned on this machine and must exist at the same path on that host", "host", internal.DockerHostAddress())
+		} else {
+			internal.Log.Warning("Deploying to a remote Docker host: the repository must exist at the same path on that host", "host", internal.DockerHostAddress(), "path", absRepoPath)
+		}
 	}
 
-	// Convert to absolute path
-	absRepoPath, err := filepath.Abs(repoPath)
+	if err := internal.ValidateAutostart(autostart); err != nil {
+		return err
+	}
+	if deployTTL < 0 {
+		return fmt.Errorf("--ttl must not be negative")
+	}
+	labels, err := internal.ParseLabels(deployLabels)
+	if err != nil {
+		return err
+	}
+	instanceCPUs, neo4jCPUs, err := deployCPUSets()
+	if err != nil {
+		return err
+	}
+	limits, serviceLimits, err := deployLimits()
+	if err != nil {
+		return err
+	}
+	heap, pageCache, err := deployNeo4jMemory()
 	if err != nil {
-		return fmt.Errorf("failed to get absolute path: %v", err)
+		return err
+	}
+	if err := internal.CheckNeo4jMemory(&internal.DeployConfig{Limits: limits, ServiceLimits: serviceLimits, Neo4jHeap: heap, Neo4jPageCache: pageCache}); err != nil {
+		return err
+	}
+	gpu, err := deployGPURequest()
+	if err != nil {
+		return err
+	}
+	imageTags, err := deployImageTags()
+	if err != nil {
+		return err
+	}
+	if err := internal.ValidateIndexing(indexWorkers, indexBatchSize); err != nil {
+		return err
+	}
+	if !deployTLS && (tlsOptions.CertPath != "" || tlsOptions.KeyPath != "" || tlsOptions.SelfSigned) {
+		return fmt.Errorf("--cert, --key and --self-signed need --tls")
+	}
+	if err := tlsOptions.Validate(); err != nil {
+		return err
+	}
+
+	var localModel *internal.LocalEmbeddingModel
+	if embeddingModel != "" {
+		if singleContainer {
+			return fmt.Errorf("--embedding-model is not supported with --single-container")
+		}
+		localModel, err = internal.ParseEmbeddingModel(embeddingModel)
+		if err != nil {
+			return err
+		}
 	}
 
 	// Generate instance name if not provided
 	if instanceName == "" {
-		instanceName = internal.GenerateInstanceName(absRepoPath)
+		if repoURL != "" {
+			instanceName = internal.GenerateURLInstanceName(repoURL)
+		} else {
+			instanceName = internal.GenerateInstanceName(absRepoPath)
+		}
 	}
 
 	// Sanitize instance name
 	instanceName = internal.SanitizeInstanceName(instanceName)
 
-	internal.Log.Info(fmt.Sprintf("Deploying instance: %s for repository: %s", instanceName, absRepoPath))
+	// Never mix our containers into a compose project someone else created
+	foreign, err := internal.IsForeignProject(instanceName)
+	if err != nil {
+		return err
+	}
+	if foreign {
+		if !autoSuffix {
+			return fmt.Errorf("compose project '%s' already exists and was not created by graphsense-cli. Choose another instance name or use --auto-suffix", instanceName)
+		}
+		suffixed := internal.NextFreeInstanceName(instanceName)
+		internal.Log.Warning("Compose project belongs to another application, using another instance name", "project", instanceName, "instance", suffixed)
+		instanceName = suffixed
+	}
+
+	// Keep other processes from deploying or removing the instance while it is set up
+	release, err := internal.LockInstance(instanceName)
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	internal.Log.Info("Deploying instance", "instance", instanceName, "repo", repoPath)
+
+	// Refuse to start over an interrupted or failed deploy. This comes before the check for
+	// existing containers, which such a deploy may have left behind, to point at --resume.
+	if previous, status, err := internal.GetDeployment(instanceName); err == nil && previous != nil && status != internal.DeployStatusComplete {
+		if status == internal.DeployStatusRemoved {
+			return fmt.Errorf("the definition of '%s' was kept when it was removed. Use 'deploy --resume %s' to deploy it again, or 'remove --config-only %s' to forget it", instanceName, instanceName, instanceName)
+		}
+		return fmt.Errorf("a previous deploy of '%s' did not complete. Use 'deploy --resume %s' to continue it", instanceName, instanceName)
+	}
 
 	// Check if instance already exists
 	if internal.InstanceExists(instanceName) {
 		return fmt.Errorf("instance '%s' already exists. Use 'remove' command first", instanceName)
 	}
 
-	// Get available ports
-	appPort, err := internal.FindAvailablePortSet(basePort)
+	// Enforce the quotas from ~/.graphsense/config.yaml
+	settings, err := internal.LoadConfig()
 	if err != nil {
-		return fmt.Errorf("failed to find available ports: %v", err)
+		return err
+	}
+	if err := internal.CheckQuotas(settings.Quotas); err != nil {
+		var quotaErr *internal.QuotaError
+		if errors.As(err, &quotaErr) && len(quotaErr.Suggestions) > 0 {
+			internal.Log.Info("Consider removing one of these idle instances first:")
+			for _, idle := range quotaErr.Suggestions {
+				fmt.Println(internal.Localize(&i18n.Message{ID: "IdleInstance", Other: "  - {{.Instance}} (last used: {{.LastUsed}}, disk: {{.Disk}})"}, map[string]any{"Instance": idle.Name, "LastUsed": formatLastUsed(idle.LastUsed), "Disk": internal.FormatSize(idle.DiskUsage)}))
+			}
+		}
+		return err
+	}
+
+	if repoURL != "" {
+		absRepoPath, err = internal.GetManagedRepoDir(instanceName)
+		if err != nil {
+			return err
+		}
+		// A clone left over from an earlier deploy with this name belongs to no instance
+		if err := os.RemoveAll(absRepoPath); err != nil {
+			return fmt.Errorf("failed to remove stale clone %s: %v", absRepoPath, err)
+		}
+		internal.Log.Info("Cloning repository", "url", repoURL, "path", absRepoPath)
+		if err := internal.CloneRepository(repoURL, absRepoPath, cloneOptions); err != nil {
+			os.RemoveAll(absRepoPath)
+			return err
+		}
+	}
+	allowHostScripts, err := checkRepository(absRepoPath, repoURL != "", interactive)
+	if err != nil {
+		// Nothing but the clone was created yet
+		if repoURL != "" {
+			os.RemoveAll(absRepoPath)
+		}
+		return err
 	}
-	
-	postgresPort := appPort + 100
-	neo4jBoltPort := appPort + 200
 
-	// Load API keys from ~/.graphsense/.env
-	coAPIKey, anthropicAPIKey, err := internal.LoadAPIKeys()
+	// Get available ports
+	scheme, err := portScheme(basePort)
+	if err != nil {
+		return err
+	}
+	if !singleContainer {
+		if err := internal.CheckBindAddressSupport(scheme.BindAddress); err != nil {
+			// Only the default address falls back to all interfaces; a chosen one is never widened
+			if portSchemeFlags.BindAddress != "" || settings.Ports.BindAddress != "" {
+				return err
+			}
+			internal.Log.Warning("Publishing ports on all interfaces", "reason", err)
+			scheme.BindAddress = ""
+		}
+	}
+	ports, err := internal.ReservePortSet(scheme, instanceName)
 	if err != nil {
-		return fmt.Errorf("failed to load API keys: %v", err)
+		return fmt.Errorf("failed to find available ports: %v", err)
 	}
 
 	// Create deployment configuration
 	config := &internal.DeployConfig{
-		RepoPath:         absRepoPath,
-		InstanceName:     instanceName,
-		AppPort:          appPort,
-		PostgresPort:     postgresPort,
-		Neo4jBoltPort:    neo4jBoltPort,
-		CoAPIKey:         coAPIKey,
-		AnthropicAPIKey:  anthropicAPIKey,
+		RepoPath:       absRepoPath,
+		RepoURL:        repoURL,
+		InstanceName:   instanceName,
+		BindAddress:    scheme.BindAddress,
+		Labels:         labels,
+		CPUSet:         instanceCPUs,
+		Neo4jCPUSet:    neo4jCPUs,
+		IndexWorkers:   indexWorkers,
+		IndexBatchSize: indexBatchSize,
+		Nice:           nice,
+		Limits:         limits,
+		ServiceLimits:  serviceLimits,
+		Neo4jHeap:      heap,
+		Neo4jPageCache: pageCache,
+		GPU:            gpu,
+
+		AllowHostScripts: allowHostScripts,
+	}
+	ports.Apply(config)
+	if localModel != nil {
+		config.EmbeddingModel = localModel.String()
+		if localModel.Path == "" {
+			internal.Log.Warning("Embedding model is downloaded on first start; use a local model directory on air-gapped hosts", "model", localModel.Name)
+		}
+	}
+	config.ExcludeSubmodules = noSubmodules
+	if autostart != internal.AutostartUnlessStopped {
+		config.Autostart = autostart
+	}
+	if deployTTL > 0 {
+		config.ExpiresAt = time.Now().Add(deployTTL)
+	}
+	internal.WarnUninitializedSubmodules(config)
+	if singleContainer {
+		config.Mode = internal.DeployModeSingle
+		internal.Log.Warning("Single-container mode keeps all data in one container volume; it cannot be backed up or restored")
 	}
 
-	// Create temporary environment file
-	envFile, err := internal.CreateTempEnvFile(config)
+	if customize != nil {
+		customize(config)
+	}
+	if len(imageTags) > 0 {
+		config.ImageTags = imageTags
+		// Compose deploys resolve the tags when the compose files are prepared
+		if config.IsSingleContainer() {
+			config.PinImageTags(map[string]string{"app": internal.SingleContainerImage(config)})
+		}
+	}
+
+	// Drop checkpoints left behind by an earlier instance with the same name
+	if err := internal.ClearCheckpoints(instanceName); err != nil {
+		internal.ReleasePorts(instanceName)
+		return err
+	}
+
+	createdCredentials, err := internal.SetupCredentials(config)
 	if err != nil {
-		return fmt.Errorf("failed to create environment file: %v", err)
+		internal.ReleasePorts(instanceName)
+		return fmt.Errorf("failed to set up database credentials: %v", err)
+	}
+	if deployTLS {
+		if err := internal.SetupTLS(config, tlsOptions); err != nil {
+			internal.ReleasePorts(instanceName)
+			if createdCredentials {
+				internal.DeleteInstanceCredentials(instanceName, config.CredentialStore)
+			}
+			return fmt.Errorf("failed to set up TLS: %v", err)
+		}
 	}
-	defer os.Remove(envFile)
 
-	// Create instance-specific docker-compose override
-	composeOverride, err := internal.CreateComposeOverride(config)
+	err = runDeploy(config, nil, interactive)
+	// The ports, credentials and a clone are only worth keeping for a deploy that can be resumed
 	if err != nil {
-		return fmt.Errorf("failed to create compose override: %v", err)
+		if recorded, _, _ := internal.GetDeployment(instanceName); recorded == nil {
+			releaseDeployResources(config, createdCredentials)
+		}
 	}
-	defer os.Remove(composeOverride)
+	return err
+}
 
-	// Deploy the instance using the docker-compose.yml in the target repository
-	internal.Log.Info(fmt.Sprintf("Starting services for instance: %s", instanceName))
+// releaseDeployResources releases what a deploy that cannot be resumed held besides its
+// containers: its reserved ports, its database credentials if deleteCredentials is set, its
+// TLS certificate and a managed clone
+func releaseDeployResources(config *internal.DeployConfig, deleteCredentials bool) {
+	instanceName := config.InstanceName
+	if err := internal.ReleasePorts(instanceName); err != nil {
+		internal.Log.Warning("Failed to release reserved ports", "error", err)
+	}
+	if deleteCredentials {
+		if err := internal.DeleteInstanceCredentials(instanceName, config.CredentialStore); err != nil {
+			internal.Log.Warning("Failed to delete database credentials", "error", err)
+		}
+	}
+	if config.TLS {
+		if err := internal.DeleteInstanceTLS(instanceName); err != nil {
+			internal.Log.Warning("Failed to delete TLS certificate", "error", err)
+		}
+	}
+	if config.IsManagedRepo() {
+		if err := internal.RemoveManagedRepo(config); err != nil {
+			internal.Log.Warning("Failed to remove repository clone", "error", err)
+		}
+	}
+}
 
-	envVars := map[string]string{
-		"COMPOSE_PROJECT_NAME": instanceName,
+// deployImageTags returns the tags --image-tag and --<service>-image-tag pin services to,
+// keyed by service name
+func deployImageTags() (map[string]string, error) {
+	tags := make(map[string]string)
+	if deployImageTag != "" {
+		tags["app"] = deployImageTag
+	}
+	for service, tag := range serviceImageTags {
+		if *tag == "" {
+			continue
+		}
+		if singleContainer {
+			return nil, fmt.Errorf("--%s-image-tag is not supported with --single-container", service)
+		}
+		tags[service] = *tag
+	}
+	for _, tag := range tags {
+		if err := internal.ValidateImageTag(tag); err != nil {
+			return nil, err
+		}
+	}
+	return tags, nil
+}
+
+// checkRepository scans the repository of an interactive deploy and decides whether the
+// scripts it declares to run on the host during the deploy may run
+func checkRepository(repoPath string, managed, interactive bool) (bool, error) {
+	if interactive {
+		if err := scanRepository(repoPath); err != nil {
+			return false, err
+		}
 	}
+	return approveHostScripts(repoPath, managed, interactive, internal.HookPreIndex, internal.HookPostDeploy)
+}
 
-	// Use the docker-compose.yml from ~/oss/code-graph-rag/
-	homeDir, err := os.UserHomeDir()
+// scanRepository scans a repository before it is deployed and prints what it found. If the scan
+// warns about anything it asks whether to go on unless --force is given, failing the deploy if
+// the answer is no or there is no terminal to ask on.
+func scanRepository(repoPath string) error {
+	internal.Log.Info("Scanning repository", "path", repoPath)
+	scan, err := internal.ScanRepository(repoPath)
 	if err != nil {
-		return fmt.Errorf("failed to get user home directory: %v", err)
+		return err
+	}
+
+	for _, result := range scan.Checks() {
+		printCheck(result)
+	}
+
+	if scan.Warnings() == 0 || deployForce {
+		return nil
+	}
+	if !isTerminal(os.Stdin) || !confirm(internal.Localize(&i18n.Message{ID: "ConfirmDeployAnyway", Other: "Deploy anyway? (y/N): "}, nil)) {
+		return fmt.Errorf("deploy cancelled: repository scan found warnings; use --force to deploy anyway")
+	}
+	return nil
+}
+
+// approveHostScripts decides whether the scripts a repository declares to run on the host at
+// hooks may run, failing if there are any that may not. They run with --allow-scripts or the
+// allow_scripts setting; otherwise interactive commands show them and ask on a terminal.
+// Scripts of repositories cloned from a Git URL are never run without the opt-in, as nobody
+// looked at the clone.
+func approveHostScripts(repoPath string, managed, interactive bool, hooks ...string) (bool, error) {
+	scripts, err := internal.HostScripts(repoPath, hooks...)
+	if err != nil || len(scripts) == 0 {
+		return false, err
+	}
+	if allowScripts {
+		return true, nil
+	}
+	if settings, err := internal.LoadConfig(); err == nil && settings.AllowScripts {
+		return true, nil
+	}
+	if managed || !interactive || !isTerminal(os.Stdin) {
+		return false, internal.ErrHostScriptsNotAllowed
+	}
+
+	internal.Log.Warning("The repository declares scripts that run on this machine with your permissions", "file", internal.RepoConfigFile)
+	for _, script := range scripts {
+		fmt.Printf("  %s: %s\n", script.Hook, script.Run)
 	}
-	
-	composeFile := filepath.Join(homeDir, "oss", "code-graph-rag", "docker-compose.yml")
-	if _, err := os.Stat(composeFile); os.IsNotExist(err) {
-		return fmt.Errorf("docker-compose.yml not found at: %s", composeFile)
+	if !confirm(internal.Localize(&i18n.Message{ID: "ConfirmHostScripts", Other: "Run these scripts? (y/N): "}, nil)) {
+		return false, internal.ErrHostScriptsNotAllowed
 	}
+	return true, nil
+}
 
-	err = internal.RunDockerCompose([]string{
-		"-f", composeFile,
-		"-f", composeOverride,
-		"--env-file", envFile,
-		"up", "-d",
-	}, envVars)
+// deployCPUSets returns the CPUs the instance and Neo4j are pinned to by --cpuset,
+// --numa-node and --neo4j-cpuset
+func deployCPUSets() (string, string, error) {
+	var instanceCPUs, neo4jCPUs string
+	var err error
+	switch {
+	case cpuset != "":
+		instanceCPUs, err = internal.ParseCPUSet(cpuset)
+	case numaNode >= 0:
+		instanceCPUs, err = internal.NUMANodeCPUSet(numaNode)
+	}
 	if err != nil {
-		return fmt.Errorf("failed to deploy instance %s: %v", instanceName, err)
+		return "", "", err
+	}
+	if neo4jCPUSet != "" {
+		if singleContainer {
+			return "", "", fmt.Errorf("--neo4j-cpuset is not supported with --single-container")
+		}
+		if neo4jCPUs, err = internal.ParseCPUSet(neo4jCPUSet); err != nil {
+			return "", "", err
+		}
 	}
 
-	// Wait for services to be healthy
-	if err := internal.WaitForHealthy(instanceName, 60); err != nil {
-		internal.Log.Warning("Health check failed, but continuing...")
+	for _, cpus := range []string{instanceCPUs, neo4jCPUs} {
+		if cpus == "" {
+			continue
+		}
+		if err := internal.CheckCPUSetAvailable(cpus); err != nil {
+			return "", "", err
+		}
 	}
+	return instanceCPUs, neo4jCPUs, nil
+}
 
-	// Store container information in database
-	if err := internal.StoreInstanceContainers(config); err != nil {
-		internal.Log.Warning(fmt.Sprintf("Failed to store container information: %v", err))
+// deployLimits returns the memory and CPU limits of the instance and of single services given
+// by --memory, --cpus and their per-service variants
+func deployLimits() (internal.ResourceLimits, map[string]internal.ResourceLimits, error) {
+	definition := internal.DefinitionLimits{Memory: memoryLimit, CPUs: cpuLimit}
+	for _, service := range internal.LimitedServices {
+		memory, cpus := *serviceMemoryLimits[service], *serviceCPULimits[service]
+		if memory == "" && cpus == "" {
+			continue
+		}
+		if singleContainer {
+			return internal.ResourceLimits{}, nil, fmt.Errorf("--%s-memory and --%s-cpus are not supported with --single-container; use --memory and --cpus", service, service)
+		}
+		if definition.Services == nil {
+			definition.Services = make(map[string]internal.DefinitionLimits)
+		}
+		definition.Services[service] = internal.DefinitionLimits{Memory: memory, CPUs: cpus}
+	}
+
+	limits, serviceLimits, err := definition.Parse()
+	if err != nil {
+		return internal.ResourceLimits{}, nil, err
+	}
+	if err := internal.CheckLimitsAvailable(limits, serviceLimits); err != nil {
+		return internal.ResourceLimits{}, nil, err
+	}
+	if !singleContainer && (!limits.IsZero() || len(serviceLimits) > 0) {
+		if runner, err := internal.GetComposeRunner(); err == nil && !runner.V2 {
+			internal.Log.Warning("Memory and CPU limits are ignored; install Docker Compose v2 to enforce them", "runner", runner)
+		}
+	}
+	return limits, serviceLimits, nil
+}
+
+// deployNeo4jMemory returns the sizes of Neo4j's heap and page cache given by --neo4j-heap
+// and --neo4j-pagecache
+func deployNeo4jMemory() (int64, int64, error) {
+	if singleContainer && (neo4jHeap != "" || neo4jPageCache != "") {
+		return 0, 0, fmt.Errorf("--neo4j-heap and --neo4j-pagecache are not supported with --single-container")
+	}
+	heap, err := internal.ParseNeo4jMemory("heap", neo4jHeap)
+	if err != nil {
+		return 0, 0, err
+	}
+	pageCache, err := internal.ParseNeo4jMemory("page cache", neo4jPageCache)
+	if err != nil {
+		return 0, 0, err
+	}
+	return heap, pageCache, nil
+}
+
+// deployGPURequest returns the GPUs --gpu passes through to the app, checking that the
+// Docker host can pass them
+func deployGPURequest() (string, error) {
+	if deployGPU == "" {
+		return "", nil
+	}
+	gpu, err := internal.ParseGPURequest(deployGPU)
+	if err != nil {
+		return "", err
+	}
+	if err := internal.CheckGPUSupport(); err != nil {
+		return "", err
+	}
+	return gpu, nil
+}
+
+// resumeDeploy continues an interrupted or failed deploy from its first incomplete stage
+func resumeDeploy(instanceName string) error {
+	instanceName = internal.SanitizeInstanceName(instanceName)
+	release, err := internal.LockInstance(instanceName)
+	if err != nil {
+		return err
+	}
+	defer release()
+
+
+	config, status, err := internal.GetDeployment(instanceName)
+	if err != nil {
+		return err
+	}
+	if config == nil {
+		return fmt.Errorf("no recorded deploy found for instance '%s'", instanceName)
+	}
+	if status == internal.DeployStatusComplete {
+		return fmt.Errorf("instance '%s' is already deployed", instanceName)
+	}
+
+	completed, err := internal.GetCheckpoints(instanceName)
+	if err != nil {
+		return err
+	}
+
+	if status == internal.DeployStatusRemoved {
+		internal.Log.Info("Deploying instance again from its kept definition", "instance", instanceName, "repo", config.RepoPath)
+	} else {
+		internal.Log.Info("Resuming deploy of instance", "instance", instanceName, "repo", config.RepoPath)
+	}
+	if len(completed) > 0 {
+		internal.Log.Info("Already completed stages", "stages", strings.Join(completed, ", "))
+	}
+	config.AllowHostScripts, err = approveHostScripts(config.RepoPath, config.IsManagedRepo(), true, internal.HookPreIndex, internal.HookPostDeploy)
+	if err != nil {
+		return err
 	}
 
-	internal.Log.Success(fmt.Sprintf("Instance '%s' deployed successfully!", instanceName))
+	return runDeploy(config, completed, true)
+}
+
+// runDeploy provisions an instance in stages, skipping the already completed ones
+// and stopping at a stage boundary on SIGINT/SIGTERM. Only interactive deploys ask whether
+// to clean up after an interruption.
+func runDeploy(config *internal.DeployConfig, completed []string, interactive bool) error {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	// Restore default signal behaviour after the first signal so a second Ctrl+C aborts immediately
+	go func() {
+		<-ctx.Done()
+		stop()
+	}()
+
+	instanceName := config.InstanceName
+	var files *internal.ComposeFiles
+
+	defer func() {
+		if files != nil {
+			files.Cleanup()
+		}
+	}()
+
+	envVars := map[string]string{
+		"COMPOSE_PROJECT_NAME": instanceName,
+	}
+
+	// A resumed deploy may start at the health check, so both stages share one progress display
+	progress := newDeployProgress(config)
+	defer progress.Stop()
+
+	provisioner := &internal.Provisioner{Stages: []internal.Stage{
+		{Name: "prepare", Always: true, Run: func(ctx context.Context) error {
+			// Load API keys from ~/.graphsense/.env
+			coAPIKey, anthropicAPIKey, err := internal.LoadAPIKeys()
+			if err != nil {
+				// Instances with a local embedding model can run without any API keys
+				if config.LocalEmbeddings() == nil {
+					return fmt.Errorf("failed to load API keys: %v", err)
+				}
+				internal.Log.Warning("No API keys loaded", "error", err)
+			}
+			config.CoAPIKey = coAPIKey
+			config.AnthropicAPIKey = anthropicAPIKey
+			// A bad key would only show up as a crash-looping app after the health check timed out
+			if !noKeyCheck {
+				if err := internal.CheckDeployKeys(ctx, config); err != nil {
+					return err
+				}
+			}
+
+			if !config.IsSingleContainer() {
+				files, err = internal.PrepareComposeFiles(config)
+				if err != nil {
+					return err
+				}
+			}
+
+			return internal.SaveDeployment(config, internal.DeployStatusInProgress)
+		}},
+		{Name: "pre-index", Run: func(ctx context.Context) error {
+			// The app starts indexing as soon as it starts
+			return internal.RunLifecycleScripts(ctx, config, internal.HookPreIndex)
+		}},
+		{Name: "start-services", Run: func(ctx context.Context) error {
+			internal.Log.Info("Starting services for instance", "instance", instanceName)
+			internal.RecordIndexedCommit(config)
+			progress.Start()
+
+			if config.IsSingleContainer() {
+				progress.SetAll(internal.StepStarting)
+				if err := internal.RunSingleContainer(config); err != nil {
+					progress.SetAll(internal.StepFailed)
+					progress.Stop()
+					return err
+				}
+				progress.SetAll(internal.StepStarted)
+				return nil
+			}
+
+			err := internal.StreamDockerCompose(files.Args("up", "-d"), files.Env(envVars), progress.ComposeLine)
+			if err != nil {
+				err = progress.Fail(err)
+				progress.Stop()
+				return fmt.Errorf("failed to deploy instance %s: %v", instanceName, err)
+			}
+			return nil
+		}},
+		{Name: "health-check", Run: func(ctx context.Context) error {
+			// Wait for services to be healthy
+			progress.Start()
+			defer progress.Stop()
+			opts := internal.HealthOptions{Timeout: healthTimeout, Interval: healthInterval, Report: progress.Health}
+			if results, err := internal.WaitForHealthy(ctx, config, opts); err != nil {
+				if ctx.Err() != nil {
+					return err
+				}
+				progress.FailUnhealthy(results)
+				progress.Stop()
+				internal.Log.Warning("Health check failed, but continuing", "error", err)
+			}
+			return nil
+		}},
+		{Name: "verify-indexes", Run: func(ctx context.Context) error {
+			// The all-in-one image has no separate Neo4j to inspect
+			if config.IsSingleContainer() {
+				return nil
+			}
+
+			// Missing indexes do not break queries, they make them slow, so only warn
+			report, err := internal.VerifyIndexes(instanceName)
+			switch {
+			case err != nil:
+				internal.Log.Warning("Could not check Neo4j indexes", "error", err)
+			case report.Degraded:
+				internal.Log.Warning("Neo4j indexes are not all ONLINE. Indexing may still be running; check again with 'graphsense-cli status'", "instance", instanceName, "indexes", report.Summary())
+			default:
+				internal.Log.Success("Neo4j indexes are ONLINE")
+			}
+			return nil
+		}},
+		{Name: "post-deploy", Run: func(ctx context.Context) error {
+			return internal.RunLifecycleScripts(ctx, config, internal.HookPostDeploy)
+		}},
+		{Name: "register", Run: func(ctx context.Context) error {
+			// Store container information in database
+			if err := internal.StoreInstanceContainers(config); err != nil {
+				internal.Log.Warning("Failed to store container information", "error", err)
+			}
+			// The digests make the deploy reproducible even from a moving tag such as latest
+			if err := internal.RecordDeployedImages(instanceName); err != nil {
+				internal.Log.Warning("Failed to record image digests", "error", err)
+			}
+			// Record the database engine versions so upgrades can detect store format changes
+			if config.IsSingleContainer() {
+				// The all-in-one image manages its own storage
+			} else if versions, err := internal.GetEngineVersions(instanceName); err == nil {
+				config.PostgresVersion = versions.Postgres
+				config.Neo4jVersion = versions.Neo4j
+			} else {
+				internal.Log.Warning("Failed to detect database versions", "error", err)
+			}
+
+			if err := internal.TouchInstance(instanceName, "deployed"); err != nil {
+				internal.Log.Warning("Failed to record activity", "error", err)
+			}
+			if err := internal.SaveDeployment(config, internal.DeployStatusComplete); err != nil {
+				return err
+			}
+			syncProxyRoutes()
+			return nil
+		}},
+	}}
+
+	provisioner.Completed = completed
+	provisioner.Checkpoint = func(stage string) error {
+		return internal.SaveCheckpoint(instanceName, stage)
+	}
+
+	if err := provisioner.Run(ctx); err != nil {
+		if errors.Is(err, internal.ErrInterrupted) {
+			return handleInterruptedDeploy(provisioner, config, files, interactive)
+		}
+		internal.Notify(internal.NewNotification(internal.NotifyDeployFailed, instanceName, "", err.Error()))
+
+		// Only deploys that got as far as being recorded can be resumed
+		if len(provisioner.Completed) > 0 {
+			if saveErr := internal.SaveDeployment(config, internal.DeployStatusFailed); saveErr == nil {
+				internal.Log.Info("Fix the problem and run 'graphsense-cli deploy --resume' to retry from the failed stage", "instance", instanceName, "stage", provisioner.Current)
+			}
+		} else {
+			dropUnstartedDeploy(instanceName)
+		}
+		return err
+	}
+
+	internal.Log.Success("Instance deployed successfully!", "instance", instanceName)
 	internal.Log.Info("Access URLs:")
-	internal.Log.Info(fmt.Sprintf("  MCP Server: http://localhost:%d", appPort))
-	internal.Log.Info(fmt.Sprintf("  PostgreSQL: localhost:%d", postgresPort))
-	internal.Log.Info(fmt.Sprintf("  Neo4j Bolt: bolt://localhost:%d", neo4jBoltPort))
+	host := config.HostAddress()
+	internal.Log.Info("MCP server", "url", config.AppURL())
+	if !config.IsSingleContainer() {
+		internal.Log.Info("PostgreSQL", "address", fmt.Sprintf("%s:%d", host, config.PostgresPort))
+		internal.Log.Info("Neo4j Bolt", "url", fmt.Sprintf("bolt://%s:%d", host, config.Neo4jBoltPort))
+	}
+	printProxyURL(instanceName)
+	printSelfSignedHint(config)
+	registerMCPClients(config)
+
+	if err := printTips(config); err != nil {
+		internal.Log.Warning("Failed to render tips", "error", err)
+	}
+	internal.Log.Info("Run 'graphsense-cli tips' to see these tips again.", "instance", instanceName)
 
 	return nil
 }
+
+// registerMCPClients adds a deployed instance to the config files of the MCP clients given
+// with --register-mcp, and again to those it was in before a remove that kept its definition.
+// Failures are logged, since the instance itself is deployed.
+func registerMCPClients(config *internal.DeployConfig) {
+	internal.RefreshMCPRegistrations(config.InstanceName, config)
+	for _, client := range registerMCP {
+		path, err := internal.RegisterMCP(config, client)
+		if err != nil {
+			internal.Log.Warning("Failed to add the instance to the MCP config", "client", client, "error", err)
+			continue
+		}
+		internal.Log.Info("Added MCP server; restart the client or reload its MCP servers to connect", "instance", config.InstanceName, "client", client, "config", path)
+	}
+}
+
+// printSelfSignedHint tells where to find the certificate clients of a self-signed instance
+// have to trust
+func printSelfSignedHint(config *internal.DeployConfig) {
+	if !config.TLS {
+		return
+	}
+	cert, err := internal.LoadInstanceCertificate(config.InstanceName)
+	if err != nil || !internal.IsSelfSigned(cert) {
+		return
+	}
+	if dir, err := internal.TLSDir(config.InstanceName); err == nil {
+		internal.Log.Info("The certificate is self-signed; have MCP clients trust it", "certificate", filepath.Join(dir, internal.TLSCertFile))
+	}
+}
+
+// dropUnstartedDeploy forgets a deploy that stopped before anything was recorded, unless it
+// deploys an instance again whose definition remove kept
+func dropUnstartedDeploy(instanceName string) {
+	if _, status, err := internal.GetDeployment(instanceName); err == nil && status == internal.DeployStatusRemoved {
+		return
+	}
+	internal.RemoveDeployment(instanceName)
+}
+
+// handleInterruptedDeploy reports the partial state of an interrupted deploy and, for
+// interactive deploys on a terminal, offers to clean it up, otherwise leaving it in place
+// for --resume
+func handleInterruptedDeploy(provisioner *internal.Provisioner, config *internal.DeployConfig, files *internal.ComposeFiles, interactive bool) error {
+	instanceName := config.InstanceName
+
+	fmt.Println()
+	if provisioner.Current != "" {
+		internal.Log.Warning("Deploy interrupted", "instance", instanceName, "stage", provisioner.Current)
+	} else {
+		internal.Log.Warning("Deploy interrupted", "instance", instanceName)
+	}
+
+	if len(provisioner.Completed) > 0 {
+		internal.Log.Info("Completed stages", "stages", strings.Join(provisioner.Completed, ", "))
+	} else {
+		internal.Log.Info("No stages completed.")
+	}
+
+	containers, err := internal.GetProjectContainers(instanceName)
+	if err == nil && len(containers) > 0 {
+		internal.Log.Info("Containers created so far:")
+		for _, container := range containers {
+			fmt.Printf("  - %s\n", container)
+		}
+	}
+
+	// Nothing was recorded or started, so there is nothing to resume or clean up
+	if len(provisioner.Completed) == 0 && len(containers) == 0 {
+		dropUnstartedDeploy(instanceName)
+		return internal.ErrInterrupted
+	}
+
+	// Deploys of deploy-batch, serve and the other commands deploying in the background, and
+	// deploys without a terminal, cannot ask
+	if !interactive || !isTerminal(os.Stdin) || !confirm(internal.Localize(&i18n.Message{ID: "ConfirmCleanUpDeploy", Other: "Clean up partially created resources? (y/N): "}, nil)) {
+		internal.Log.Info("Partial deploy kept. Run 'graphsense-cli deploy --resume' to continue.", "instance", instanceName)
+		return internal.ErrInterrupted
+	}
+
+	internal.Log.Info("Cleaning up instance", "instance", instanceName)
+
+	args := []string{"down", "-v", "--remove-orphans"}
+	envVars := map[string]string{"COMPOSE_PROJECT_NAME": instanceName}
+	if files != nil {
+		args = files.Args(args...)
+		envVars = files.Env(envVars)
+	}
+
+	if config.IsSingleContainer() {
+		if docker, err := internal.GetDockerClient(); err != nil {
+			internal.Log.Warning("Failed to remove containers", "error", err)
+		} else if err := docker.RemoveProject(context.Background(), instanceName); err != nil {
+			internal.Log.Warning("Failed to remove containers", "error", err)
+		}
+	} else if err := internal.RunDockerCompose(args, envVars); err != nil {
+		internal.Log.Warning("Failed to remove containers", "error", err)
+	}
+
+	if err := internal.RemoveInstanceContainers(instanceName); err != nil {
+		internal.Log.Warning("Failed to remove container information", "error", err)
+	}
+	if err := internal.RemoveDeployment(instanceName); err != nil {
+		internal.Log.Warning("Failed to remove deployment record", "error", err)
+	}
+	// The volumes the databases were initialised with are gone, and nothing is left to resume
+	releaseDeployResources(config, true)
+
+	internal.Log.Success("Partial deploy cleaned up.", "instance", instanceName)
+	return internal.ErrInterrupted
+}
+
+// newDeployProgress returns the progress display of a deploy: redrawn in place on a terminal,
+// logged one step per line with --plain, in CI logs and when other output would break it
+func newDeployProgress(config *internal.DeployConfig) *internal.DeployProgress {
+	live := !batchDeploying && isTerminal(os.Stdout) && !internal.PlainOutput() && logFormat == internal.LogFormatText && !quiet && !verbose && !debug
+	return internal.NewDeployProgress(config, os.Stdout, live)
+}
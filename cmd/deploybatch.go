@@ -0,0 +1,174 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sync"
+	"syscall"
+	"text/tabwriter"
+	"time"
+
+	"graphsense-cli/internal"
+
+	"github.com/nicksnyder/go-i18n/v2/i18n"
+	"github.com/spf13/cobra"
+)
+
+var batchParallel int
+
+// batchDeploying is set while deploy-batch runs several deploys at once. Their progress is
+// logged rather than drawn.
+var batchDeploying bool
+
+var deployBatchCmd = &cobra.Command{
+	Use:   "deploy-batch <manifest.yaml>",
+	Short: "Deploy the repositories listed in a manifest file concurrently",
+	Long: `Deploy an instance for every repository listed in a YAML manifest, several at once, and
+finish with a summary table of the results. Each entry needs a repository path or Git URL
+and may give the instance name, base port and labels:
+
+  parallel: 4
+  repos:
+    - repo: /work/api
+      name: api
+      port: 9000
+      labels:
+        team: backend
+    - repo: https://github.com/example/web.git
+    - repo: ../billing
+
+Relative paths are resolved against the directory of the manifest. Instance names are
+generated from the repositories as deploy does, and the manifest is rejected before anything
+is deployed if two repositories would get the same name.
+
+--parallel (default 3, or parallel: in the manifest) limits how many instances are deployed
+at once. A failed deploy does not stop the others; the command fails if any of them did.
+Ctrl+C stops starting new deploys and interrupts the running ones at a stage boundary,
+keeping them for 'deploy --resume'.`,
+	Example: `  graphsense-cli deploy-batch repos.yaml
+  graphsense-cli deploy-batch repos.yaml --parallel 5`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return deployBatch(args[0], cmd.Flags().Changed("parallel"))
+	},
+}
+
+func init() {
+	deployBatchCmd.Flags().IntVar(&batchParallel, "parallel", internal.DefaultBatchParallel, "Number of instances to deploy at once")
+	deployBatchCmd.Flags().BoolVar(&noKeyCheck, "no-key-check", false, "Deploy without checking the API keys with their providers first")
+}
+
+// batchResult is the outcome of deploying one entry of a batch manifest
+type batchResult struct {
+	instance string
+	repo     string
+	started  bool
+	duration time.Duration
+	err      error
+}
+
+func deployBatch(file string, parallelSet bool) error {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return fmt.Errorf("failed to read batch manifest: %v", err)
+	}
+	dir, err := filepath.Abs(filepath.Dir(file))
+	if err != nil {
+		return fmt.Errorf("failed to get absolute path: %v", err)
+	}
+	manifest, err := internal.ParseBatchManifest(data, dir)
+	if err != nil {
+		return err
+	}
+
+	parallel := batchParallel
+	if !parallelSet && manifest.Parallel > 0 {
+		parallel = manifest.Parallel
+	}
+	if parallel < 1 {
+		return fmt.Errorf("--parallel must be at least 1")
+	}
+	parallel = min(parallel, len(manifest.Repos))
+	batchDeploying = parallel > 1
+
+	// Stop starting deploys on Ctrl+C; the running ones stop at their next stage boundary
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	go func() {
+		<-ctx.Done()
+		stop()
+	}()
+
+	internal.Log.Info("Deploying repositories", "repos", len(manifest.Repos), "parallel", parallel)
+
+	results := make([]batchResult, len(manifest.Repos))
+	slots := make(chan struct{}, parallel)
+	var wg sync.WaitGroup
+	for i, entry := range manifest.Repos {
+		results[i] = batchResult{instance: entry.InstanceName(), repo: entry.Repo}
+		select {
+		case slots <- struct{}{}:
+		case <-ctx.Done():
+		}
+		if ctx.Err() != nil {
+			results[i].err = internal.ErrInterrupted
+			continue
+		}
+
+		wg.Add(1)
+		go func(result *batchResult, entry internal.BatchEntry) {
+			defer wg.Done()
+			defer func() { <-slots }()
+			result.started = true
+			start := time.Now()
+			result.err = deployInstanceWith(entry.Repo, result.instance, entry.Port, func(config *internal.DeployConfig) {
+				if len(entry.Labels) > 0 {
+					config.Labels = entry.Labels
+				}
+			}, false)
+			result.duration = time.Since(start)
+			if result.err != nil {
+				internal.Log.Error("Failed", "instance", result.instance, "error", result.err)
+			}
+		}(&results[i], entry)
+	}
+	wg.Wait()
+
+	return printBatchSummary(results)
+}
+
+// printBatchSummary prints the result of every entry of a batch and returns an error if any
+// of them failed
+func printBatchSummary(results []batchResult) error {
+	fmt.Println()
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 3, ' ', 0)
+	fmt.Fprintln(w, internal.Localize(&i18n.Message{ID: "BatchTableHeader", Other: "INSTANCE\tREPOSITORY\tRESULT\tDURATION\tERROR"}, nil))
+	failed := 0
+	for _, result := range results {
+		duration := "-"
+		if result.started {
+			duration = result.duration.Round(time.Second).String()
+		}
+		switch {
+		case result.err == nil:
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t\n", result.instance, result.repo, internal.Localize(&i18n.Message{ID: "ResultOK", Other: "ok"}, nil), duration)
+		case !result.started:
+			failed++
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%v\n", result.instance, result.repo, internal.Localize(&i18n.Message{ID: "ResultSkipped", Other: "skipped"}, nil), duration, result.err)
+		default:
+			failed++
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%v\n", result.instance, result.repo, internal.Localize(&i18n.Message{ID: "ResultFailed", Other: "failed"}, nil), duration, result.err)
+		}
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("%d of %d repositories failed to deploy", failed, len(results))
+	}
+	return nil
+}
@@ -0,0 +1,68 @@
+package cmd
+
+import (
+	"fmt"
+
+	"graphsense-cli/internal"
+
+	"github.com/nicksnyder/go-i18n/v2/i18n"
+	"github.com/spf13/cobra"
+)
+
+var doctorCmd = &cobra.Command{
+	Use:   "doctor",
+	Short: "Check that this machine can run GraphSense instances",
+	Long: `Run preflight checks: docker installed and running, docker compose available,
+~/.graphsense writable, API keys present, compose template resolvable and enough free disk space.
+Exits with a non-zero status if any check fails.`,
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return runDoctor()
+	},
+}
+
+func runDoctor() error {
+	internal.Log.Info("Running preflight checks...")
+	fmt.Println()
+
+	results := internal.RunPreflightChecks()
+
+	failed := 0
+	for _, result := range results {
+		if result.Status == internal.CheckFail {
+			failed++
+		}
+		printCheck(result)
+	}
+
+	fmt.Println()
+	if failed > 0 {
+		return fmt.Errorf("%d of %d checks failed", failed, len(results))
+	}
+
+	internal.Log.Success("All checks passed.")
+	return nil
+}
+
+// Labels of check results in plain output, where they replace the emojis
+var (
+	checkPassLabel = &i18n.Message{ID: "CheckPassLabel", Other: "[OK]"}
+	checkWarnLabel = &i18n.Message{ID: "CheckWarnLabel", Other: "[WARN]"}
+	checkFailLabel = &i18n.Message{ID: "CheckFailLabel", Other: "[FAIL]"}
+	checkHintLabel = &i18n.Message{ID: "CheckHintLabel", Other: "Hint:"}
+)
+
+// printCheck prints the result of a check, with its hint unless it passed
+func printCheck(result internal.CheckResult) {
+	switch result.Status {
+	case internal.CheckPass:
+		fmt.Printf("  %s %s: %s\n", internal.Symbol("✅", internal.Localize(checkPassLabel, nil)), result.Name, result.Detail)
+	case internal.CheckWarn:
+		fmt.Printf("  %s %s: %s\n", internal.Symbol("⚠️ ", internal.Localize(checkWarnLabel, nil)), result.Name, result.Detail)
+	default:
+		fmt.Printf("  %s %s: %s\n", internal.Symbol("❌", internal.Localize(checkFailLabel, nil)), result.Name, result.Detail)
+	}
+	if result.Hint != "" && result.Status != internal.CheckPass {
+		fmt.Printf("     %s %s\n", internal.Symbol("→", internal.Localize(checkHintLabel, nil)), result.Hint)
+	}
+}
@@ -0,0 +1,75 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"graphsense-cli/internal"
+
+	"github.com/nicksnyder/go-i18n/v2/i18n"
+	"github.com/spf13/cobra"
+)
+
+var duCmd = &cobra.Command{
+	Use:   "du [instance_name]",
+	Short: "Show the disk usage of instances",
+	Long: `Show how much disk space each instance uses, counting its named volumes (databases,
+logs, plugins, cloned repositories) and the writable layers of its containers.
+
+Instances are listed largest first, each followed by its volumes and containers, largest
+first. Without an instance name every instance is shown.`,
+	Args: cobra.MaximumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return showDiskUsage(args)
+	},
+}
+
+func init() {
+	addOutputFlag(duCmd)
+}
+
+func showDiskUsage(args []string) error {
+	structured, err := structuredOutput()
+	if err != nil {
+		return err
+	}
+
+	names := args
+	if len(names) == 0 {
+		if names, err = internal.GetGraphsenseProjects(); err != nil {
+			return fmt.Errorf("failed to list instances: %v", err)
+		}
+	} else if !internal.InstanceExists(names[0]) {
+		return fmt.Errorf("instance '%s' does not exist", names[0])
+	}
+
+	report, err := internal.GetDiskUsageReport(names)
+	if err != nil {
+		return err
+	}
+
+	if structured {
+		return printStructured(report)
+	}
+
+	if len(report) == 0 {
+		internal.Log.Info("No GraphSense instances found.")
+		return nil
+	}
+
+	var total int64
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 3, ' ', 0)
+	fmt.Fprintln(w, internal.Localize(&i18n.Message{ID: "DuTableHeader", Other: "NAME\tTYPE\tSIZE"}, nil))
+	for _, usage := range report {
+		fmt.Fprintf(w, "%s\t%s\t%s\n", usage.Instance, internal.Localize(&i18n.Message{ID: "DuInstance", Other: "instance"}, nil), internal.FormatSize(usage.Total))
+		for _, item := range usage.Items {
+			fmt.Fprintf(w, "  %s\t%s\t%s\n", item.Name, item.Kind, internal.FormatSize(item.Size))
+		}
+		total += usage.Total
+	}
+	if len(report) > 1 {
+		fmt.Fprintf(w, "%s\t\t%s\n", internal.Localize(&i18n.Message{ID: "DuTotal", Other: "TOTAL"}, nil), internal.FormatSize(total))
+	}
+	return w.Flush()
+}
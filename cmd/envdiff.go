@@ -0,0 +1,36 @@
+package cmd
+
+import (
+	"fmt"
+
+	"graphsense-cli/internal"
+
+	"github.com/nicksnyder/go-i18n/v2/i18n"
+)
+
+// reviewConfigChanges prints how the configuration config would apply differs from what the
+// instance runs now and asks for confirmation unless yes is set. It reports whether to go ahead.
+func reviewConfigChanges(config *internal.DeployConfig, yes bool) (bool, error) {
+	running, err := internal.RunningConfig(config.InstanceName)
+	if err != nil {
+		return false, fmt.Errorf("failed to inspect running configuration: %v", err)
+	}
+	effective, err := internal.EffectiveConfig(config)
+	if err != nil {
+		return false, err
+	}
+
+	changes := internal.DiffConfigs(running, effective)
+	if len(changes) == 0 {
+		internal.Log.Info("No configuration changes", "instance", config.InstanceName)
+		return true, nil
+	}
+
+	internal.Log.Info("Configuration changes", "instance", config.InstanceName, "changes", len(changes))
+	fmt.Print(internal.FormatConfigDiff(changes))
+
+	if yes {
+		return true, nil
+	}
+	return confirm(internal.Localize(&i18n.Message{ID: "ConfirmApplyChanges", Other: "Apply these changes? (y/N): "}, nil)), nil
+}
@@ -0,0 +1,80 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"graphsense-cli/internal"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	eventsJSON  bool
+	eventsSince time.Duration
+)
+
+var eventsCmd = &cobra.Command{
+	Use:   "events [instance_name]",
+	Short: "Stream container events of instances",
+	Long: `Stream the start, stop, restart, die and oom events of the containers of an instance, or
+of every instance, as Docker reports them, until interrupted. A container Docker restarts
+after a crash shows up as die, with its exit code, followed by start; a container killed for
+running out of memory shows up as oom.
+
+--json prints every event as a JSON object on a line of its own, for log shippers and
+alerting pipelines. --since first replays the events of the given past period.`,
+	Example: `  graphsense-cli events
+  graphsense-cli events my-analysis --since 1h
+  graphsense-cli events --json | jq 'select(.action == "oom")'`,
+	Args: cobra.MaximumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		var instanceName string
+		if len(args) > 0 {
+			instanceName = args[0]
+		}
+		return streamEvents(instanceName)
+	},
+}
+
+func init() {
+	eventsCmd.Flags().BoolVar(&eventsJSON, "json", false, "Print every event as a JSON object on a line of its own")
+	eventsCmd.Flags().DurationVar(&eventsSince, "since", 0, "Replay the events of this past period first, e.g. 1h")
+}
+
+func streamEvents(instanceName string) error {
+	if instanceName != "" && !internal.InstanceExists(instanceName) {
+		return fmt.Errorf("instance '%s' does not exist", instanceName)
+	}
+	if eventsSince < 0 {
+		return fmt.Errorf("--since must not be negative")
+	}
+	var since time.Time
+	if eventsSince > 0 {
+		since = time.Now().Add(-eventsSince)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	if !eventsJSON {
+		internal.Log.Info("Streaming container events, press Ctrl+C to stop")
+	}
+	encoder := json.NewEncoder(os.Stdout)
+	return internal.StreamInstanceEvents(ctx, instanceName, since, func(event internal.InstanceEvent) {
+		if eventsJSON {
+			encoder.Encode(event)
+			return
+		}
+		description := event.String()
+		if event.Action == "oom" || (event.ExitCode != nil && *event.ExitCode != 0) {
+			description = internal.Colorize(internal.ColorRed, description)
+		}
+		fmt.Printf("%s  %s  %s  %s\n", event.Time.Local().Format(time.RFC3339), event.Instance, event.Service, description)
+	})
+}
@@ -0,0 +1,133 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"sort"
+
+	"graphsense-cli/internal"
+
+	"github.com/spf13/cobra"
+)
+
+// defaultShell starts bash where the image has it and sh otherwise
+var defaultShell = []string{"sh", "-c", "if command -v bash >/dev/null 2>&1; then exec bash; else exec sh; fi"}
+
+var execUser string
+
+var execCmd = &cobra.Command{
+	Use:   "exec <instance_name> [service] [-- command...]",
+	Short: "Run a command in a container of an instance",
+	Long: `Run a command in a container of an instance with docker exec, resolving the container
+from the instance and service name. The service defaults to app and the command to an
+interactive shell (bash, or sh where bash is not installed).`,
+	Example: `  graphsense-cli exec my-analysis
+  graphsense-cli exec my-analysis postgres -- psql -U postgres graphsense
+  graphsense-cli exec my-analysis -- ls /home/repo`,
+	Args: execArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		instanceName, service, command := splitExecArgs(cmd, args)
+		return runExec(instanceName, service, command)
+	},
+}
+
+var shellCmd = &cobra.Command{
+	Use:   "shell <instance_name> [service]",
+	Short: "Open a shell in a container of an instance",
+	Long:  "Open an interactive shell in a container of an instance. The service defaults to app.",
+	Args:  cobra.RangeArgs(1, 2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		service := "app"
+		if len(args) > 1 {
+			service = args[1]
+		}
+		return runExec(args[0], service, nil)
+	},
+}
+
+func init() {
+	execCmd.Flags().StringVarP(&execUser, "user", "u", "", "User to run the command as (name or uid)")
+	shellCmd.Flags().StringVarP(&execUser, "user", "u", "", "User to run the shell as (name or uid)")
+}
+
+// execArgs accepts an instance name and optional service before --, and anything after it
+func execArgs(cmd *cobra.Command, args []string) error {
+	before := len(args)
+	if dash := cmd.ArgsLenAtDash(); dash >= 0 {
+		before = dash
+	}
+	if before < 1 || before > 2 {
+		return fmt.Errorf("requires an instance name and optional service before --, got %d argument(s)", before)
+	}
+	return nil
+}
+
+// splitExecArgs returns the instance, service and command of exec's arguments
+func splitExecArgs(cmd *cobra.Command, args []string) (string, string, []string) {
+	before, command := args, []string(nil)
+	if dash := cmd.ArgsLenAtDash(); dash >= 0 {
+		before, command = args[:dash], args[dash:]
+	}
+	service := "app"
+	if len(before) > 1 {
+		service = before[1]
+	}
+	return before[0], service, command
+}
+
+// runExec runs command, or a shell, in a service container of an instance and exits with
+// the command's exit code
+func runExec(instanceName, service string, command []string) error {
+	return runExecEnv(instanceName, service, nil, command)
+}
+
+// runExecEnv is runExec with env set in the container. The values are passed through the
+// environment of docker exec, which keeps secrets off its command line.
+func runExecEnv(instanceName, service string, env map[string]string, command []string) error {
+	container, err := internal.ServiceContainer(instanceName, service)
+	if err != nil {
+		return err
+	}
+	if len(command) == 0 {
+		command = defaultShell
+	}
+
+	args := []string{"exec", "-i"}
+	// Allocating a TTY without one attached fails, and would mangle piped output
+	if isTerminal(os.Stdin) && isTerminal(os.Stdout) {
+		args = append(args, "-t")
+	}
+	if execUser != "" {
+		args = append(args, "--user", execUser)
+	}
+	names := make([]string, 0, len(env))
+	for name := range env {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		args = append(args, "-e", name)
+	}
+	args = append(append(args, container), command...)
+
+	cmd := internal.CommandEnv(env, "docker", args...)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			os.Exit(exitErr.ExitCode())
+		}
+		return fmt.Errorf("failed to run docker exec: %v", err)
+	}
+	return nil
+}
+
+// isTerminal reports whether f is an interactive terminal
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
@@ -0,0 +1,49 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"graphsense-cli/internal"
+
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v3"
+)
+
+var exportCmd = &cobra.Command{
+	Use:   "export <instance_name>",
+	Short: "Print an instance's definition as YAML",
+	Long: `Print the deploy configuration of an instance as YAML: its repository, mode, ports,
+images, settings and labels. The definition can be versioned in git and deployed again,
+on this or another machine, with 'graphsense-cli import'.
+
+API keys are not exported; import reads them from ~/.graphsense/.env like deploy does.
+The instance's data is not exported either, use backup and restore for that.`,
+	Example: `  graphsense-cli export my-analysis > my-analysis.yaml`,
+	Args:    cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return exportInstance(args[0])
+	},
+}
+
+func exportInstance(instanceName string) error {
+	config, status, err := internal.GetDeployment(instanceName)
+	if err != nil {
+		return err
+	}
+	if config == nil {
+		if !internal.InstanceExists(instanceName) {
+			return fmt.Errorf("instance '%s' does not exist", instanceName)
+		}
+		if config, err = internal.GetInstanceConfig(instanceName); err != nil {
+			return err
+		}
+	} else if status != internal.DeployStatusComplete {
+		return fmt.Errorf("the deploy of '%s' did not complete. Finish it with 'deploy --resume %s' first", instanceName, instanceName)
+	}
+
+	encoder := yaml.NewEncoder(os.Stdout)
+	encoder.SetIndent(2)
+	defer encoder.Close()
+	return encoder.Encode(internal.NewInstanceDefinition(config))
+}
@@ -0,0 +1,116 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"strconv"
+	"syscall"
+	"time"
+
+	"graphsense-cli/internal"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	gatewayPort    int
+	gatewayAddress string
+)
+
+var gatewayCmd = &cobra.Command{
+	Use:   "gateway",
+	Short: "Serve every instance on one port",
+	Long: `Run an HTTP reverse proxy that serves the MCP endpoint of every instance at
+http://127.0.0.1:<port>/i/<instance_name>/, so MCP clients and scripts need one stable port
+however many instances exist and whichever ports they were given.
+
+Unlike 'proxy', the gateway runs inside graphsense-cli and needs neither Docker nor
+certificates. Instances are looked up on every request, so instances deployed, renamed or
+given new ports while it runs are served right away.`,
+}
+
+var gatewayStartCmd = &cobra.Command{
+	Use:   "start",
+	Short: "Run the gateway until interrupted",
+	Long: `Serve every deployed instance at /i/<instance_name>/ until interrupted with Ctrl+C.
+GET / lists the instances and the addresses they are forwarded to.
+
+Requests through the gateway are recorded in the access log of the instance. Instances
+deployed with --tls are reached over HTTPS, checking their own certificate, while the
+gateway itself serves plain HTTP; keep it on 127.0.0.1 unless the network is trusted.`,
+	Example: `  graphsense-cli gateway start
+  graphsense-cli gateway start --port 8000 &
+  curl -s http://127.0.0.1:8000/`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return startGateway(gatewayAddress, gatewayPort)
+	},
+}
+
+func init() {
+	gatewayStartCmd.Flags().IntVar(&gatewayPort, "port", internal.DefaultGatewayPort, "Port to serve the gateway on")
+	gatewayStartCmd.Flags().StringVar(&gatewayAddress, "address", "127.0.0.1", "Address to listen on (0.0.0.0 for all interfaces)")
+	gatewayCmd.AddCommand(gatewayStartCmd)
+}
+
+func startGateway(address string, port int) error {
+	if port < 1 || port > 65535 {
+		return fmt.Errorf("invalid port %d", port)
+	}
+
+	gateway, err := internal.NewGateway()
+	if err != nil {
+		return err
+	}
+	defer gateway.Close()
+
+	server := &http.Server{
+		Addr:              net.JoinHostPort(address, strconv.Itoa(port)),
+		Handler:           gateway,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	// Listening first reports a port in use before anything waits for requests
+	listener, err := net.Listen("tcp", server.Addr)
+	if err != nil {
+		return fmt.Errorf("failed to start the gateway: %v", err)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	serveErr := make(chan error, 1)
+	go func() {
+		serveErr <- server.Serve(listener)
+	}()
+
+	base := "http://" + server.Addr
+	internal.Log.Success("Gateway started", "url", base)
+	routes, err := internal.GatewayRoutes()
+	if err != nil {
+		internal.Log.Warning("Failed to list instances", "error", err)
+	}
+	for _, route := range routes {
+		internal.Log.Info("Route", "url", base+route.Path, "upstream", route.Upstream)
+	}
+	internal.Log.Info("Press Ctrl+C to stop")
+
+	select {
+	case err := <-serveErr:
+		if !errors.Is(err, http.ErrServerClosed) {
+			return fmt.Errorf("failed to serve the gateway: %v", err)
+		}
+	case <-ctx.Done():
+	}
+
+	// Streaming MCP responses never finish by themselves, so they are cut off after a grace period
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	server.Shutdown(shutdownCtx)
+	internal.Log.Info("Gateway stopped")
+	return nil
+}
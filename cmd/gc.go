@@ -0,0 +1,151 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"graphsense-cli/internal"
+
+	"github.com/nicksnyder/go-i18n/v2/i18n"
+	"github.com/spf13/cobra"
+)
+
+var (
+	gcUnusedFor time.Duration
+	gcAction    string
+	gcWarning   time.Duration
+	gcDryRun    bool
+	gcYes       bool
+)
+
+var gcCmd = &cobra.Command{
+	Use:   "gc",
+	Short: "Stop or remove instances past their TTL or unused for long",
+	Long: `Collect the instances that expired, because the TTL given with deploy --ttl or set-ttl ran
+out, or were not used for --unused-for, measured from when they were last deployed, started,
+upgraded or queried. They are stopped, or removed with all their data with --action remove.
+
+Every instance due within --warning is listed first, so the owners of instances about to
+be collected can extend them with set-ttl or use them again. Collecting asks for
+confirmation unless --yes is given, and --dry-run only lists them.
+
+The defaults of --unused-for, --action and --warning come from the gc section of
+~/.graphsense/config.yaml, which 'supervise' also applies every 15 minutes while it runs.
+Instances that were never used are left alone.`,
+	Example: `  graphsense-cli gc --dry-run
+  graphsense-cli gc --unused-for 336h
+  graphsense-cli gc --action remove --yes`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		policy, err := gcPolicy(cmd)
+		if err != nil {
+			return err
+		}
+		return collectInstances(policy)
+	},
+}
+
+func init() {
+	gcCmd.Flags().DurationVar(&gcUnusedFor, "unused-for", 0, "Also collect instances not used for this long, e.g. 336h (default: gc.unused_for)")
+	gcCmd.Flags().StringVar(&gcAction, "action", internal.GCStop, "What to do with instances that are due: stop or remove (default: gc.action)")
+	gcCmd.Flags().DurationVar(&gcWarning, "warning", internal.DefaultGCWarning, "List instances due within this long (default: gc.warning)")
+	gcCmd.Flags().BoolVar(&gcDryRun, "dry-run", false, "Only list the instances that are due")
+	gcCmd.Flags().BoolVarP(&gcYes, "yes", "y", false, "Collect without asking for confirmation")
+	gcCmd.RegisterFlagCompletionFunc("action", func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+		return internal.GCActions, cobra.ShellCompDirectiveNoFileComp
+	})
+}
+
+// gcPolicy returns the policy of the gc section of the config file, overridden by the flags
+// given on the command line
+func gcPolicy(cmd *cobra.Command) (internal.GCPolicy, error) {
+	settings, err := internal.LoadConfig()
+	if err != nil {
+		return internal.GCPolicy{}, err
+	}
+	policy, err := settings.GC.Policy()
+	if err != nil {
+		return internal.GCPolicy{}, err
+	}
+	if cmd.Flags().Changed("unused-for") {
+		if gcUnusedFor < 0 {
+			return internal.GCPolicy{}, fmt.Errorf("--unused-for must not be negative")
+		}
+		policy.UnusedFor = gcUnusedFor
+	}
+	if cmd.Flags().Changed("action") {
+		if err := internal.ValidateGCAction(gcAction); err != nil {
+			return internal.GCPolicy{}, err
+		}
+		policy.Action = gcAction
+	}
+	if cmd.Flags().Changed("warning") {
+		if gcWarning < 0 {
+			return internal.GCPolicy{}, fmt.Errorf("--warning must not be negative")
+		}
+		policy.Warning = gcWarning
+	}
+	return policy, nil
+}
+
+func collectInstances(policy internal.GCPolicy) error {
+	now := time.Now()
+	candidates, err := internal.FindGCCandidates(policy, now)
+	if err != nil {
+		return err
+	}
+	if len(candidates) == 0 {
+		internal.Log.Success("No instances are due")
+		return nil
+	}
+
+	var due []string
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 3, ' ', 0)
+	fmt.Fprintln(w, internal.Localize(&i18n.Message{ID: "GCTableHeader", Other: "INSTANCE\tLAST USED\tREASON\tACTION"}, nil))
+	for _, candidate := range candidates {
+		action := "-"
+		if candidate.Due(now) {
+			action = policy.Action
+			due = append(due, candidate.Instance)
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", candidate.Instance, formatLastUsed(candidate.LastUsed), candidate.Describe(now), action)
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	fmt.Println()
+
+	if len(due) == 0 {
+		internal.Log.Info("No instances are due yet. Extend them with 'graphsense-cli set-ttl' or use them to keep them")
+		return nil
+	}
+	if gcDryRun {
+		internal.Log.Info("Dry run: instances are due", "instances", len(due), "action", internal.GCActionDone(policy.Action))
+		return nil
+	}
+	if !gcYes {
+		if policy.Action == internal.GCRemove {
+			internal.Log.Warning(removeEverything.warning(), "instances", strings.Join(due, ", "))
+		} else {
+			internal.Log.Warning("This will stop the instances.", "instances", strings.Join(due, ", "))
+		}
+		if !confirm(internal.Localize(areYouSure, nil)) {
+			internal.Log.Info("Cancelled.")
+			return nil
+		}
+	}
+	return runBulk(due, func(instanceName string) error {
+		return collectInstance(instanceName, policy.Action)
+	})
+}
+
+// collectInstance stops or removes an instance that is due
+func collectInstance(instanceName, action string) error {
+	if action == internal.GCRemove {
+		return removeInstance(instanceName, true, removeEverything, true)
+	}
+	return stopInstance(instanceName)
+}
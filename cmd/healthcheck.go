@@ -0,0 +1,85 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"graphsense-cli/internal"
+
+	"github.com/nicksnyder/go-i18n/v2/i18n"
+	"github.com/spf13/cobra"
+)
+
+var (
+	healthcheckDeep       bool
+	healthcheckMaxLatency time.Duration
+)
+
+var healthcheckCmd = &cobra.Command{
+	Use:   "healthcheck <instance_name>",
+	Short: "Check that an instance is healthy",
+	Long: `Probe every service of an instance once and print a pass/fail report.
+
+With --deep the full query path is exercised as well: the MCP server answers an initialize
+request, a graph query returns data, PostgreSQL and Neo4j answer within --max-latency, and
+the embeddings provider is reachable with the keys the app runs with.
+
+The command exits non-zero when any check fails, and --output json|yaml prints the report
+in a form monitoring systems can consume.`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return healthcheck(args[0])
+	},
+}
+
+func init() {
+	healthcheckCmd.Flags().BoolVar(&healthcheckDeep, "deep", false, "Probe the full query path end to end")
+	healthcheckCmd.Flags().DurationVar(&healthcheckMaxLatency, "max-latency", internal.DefaultMaxLatency, "Fail database queries slower than this (with --deep)")
+	addOutputFlag(healthcheckCmd)
+}
+
+func healthcheck(instanceName string) error {
+	structured, err := structuredOutput()
+	if err != nil {
+		return err
+	}
+	if !internal.InstanceExists(instanceName) {
+		return fmt.Errorf("instance '%s' does not exist", instanceName)
+	}
+
+	config, err := internal.GetInstanceConfig(instanceName)
+	if err != nil {
+		return err
+	}
+
+	report := internal.RunHealthChecks(config, healthcheckDeep, healthcheckMaxLatency)
+
+	if structured {
+		if err := printStructured(report); err != nil {
+			return err
+		}
+	} else {
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 3, ' ', 0)
+		fmt.Fprintln(w, internal.Localize(&i18n.Message{ID: "HealthcheckTableHeader", Other: "CHECK\tRESULT\tLATENCY\tDETAIL"}, nil))
+		for _, check := range report.Checks {
+			latency := "-"
+			if check.LatencyMS > 0 {
+				latency = fmt.Sprintf("%dms", check.LatencyMS)
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", check.Name, check.Status, latency, check.Detail)
+		}
+		if err := w.Flush(); err != nil {
+			return err
+		}
+	}
+
+	if failed := report.Failed(); len(failed) > 0 {
+		return fmt.Errorf("%d of %d checks failed", len(failed), len(report.Checks))
+	}
+	if !structured {
+		internal.Log.Success("Instance is healthy", "instance", instanceName)
+	}
+	return nil
+}
@@ -0,0 +1,154 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"graphsense-cli/internal"
+
+	"github.com/spf13/cobra"
+)
+
+var importRepo string
+
+var importCmd = &cobra.Command{
+	Use:   "import <definition.yaml> [instance_name]",
+	Short: "Deploy an instance from a definition written by export",
+	Long: `Deploy a new instance from a YAML definition written by 'graphsense-cli export', with the
+definition's repository, mode, images, settings and labels. The instance is named as in the
+definition unless instance_name is given.
+
+The instance gets the definition's ports when they are free; otherwise the next free port
+set is used, keeping the distances between the ports. A repository path that does not exist
+on this machine is cloned from the definition's repository URL if it has one; --repo points
+the instance at another checkout.
+
+Use - as the file name to read the definition from stdin.`,
+	Example: `  graphsense-cli import my-analysis.yaml
+  graphsense-cli import my-analysis.yaml my-analysis-copy --repo /work/checkout`,
+	Args: cobra.RangeArgs(1, 2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		var instanceName string
+		if len(args) > 1 {
+			instanceName = args[1]
+		}
+		return importInstance(args[0], instanceName, importRepo)
+	},
+}
+
+func init() {
+	importCmd.Flags().StringVar(&importRepo, "repo", "", "Deploy this repository path or Git URL instead of the definition's")
+	importCmd.Flags().BoolVar(&noKeyCheck, "no-key-check", false, "Deploy without checking the API keys with their providers first")
+}
+
+func importInstance(file, instanceName, repo string) error {
+	var data []byte
+	var err error
+	if file == "-" {
+		data, err = io.ReadAll(os.Stdin)
+	} else {
+		data, err = os.ReadFile(file)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read instance definition: %v", err)
+	}
+	definition, err := internal.ParseInstanceDefinition(data)
+	if err != nil {
+		return err
+	}
+
+	if instanceName == "" {
+		instanceName = definition.Name
+	}
+	instanceName = internal.SanitizeInstanceName(instanceName)
+	if repo == "" {
+		repo = importedRepo(definition)
+	}
+
+	// The definition takes the place of the deploy flags
+	singleContainer = definition.Mode == internal.DeployModeSingle
+	embeddingModel = definition.EmbeddingModel
+	noSubmodules = definition.ExcludeSubmodules
+	autostart = definition.Autostart
+	if autostart == "" {
+		autostart = internal.AutostartUnlessStopped
+	}
+	deployLabels = nil
+	cpuset = definition.CPUSet
+	neo4jCPUSet = definition.Neo4jCPUSet
+	numaNode = -1
+	indexWorkers = definition.IndexWorkers
+	indexBatchSize = definition.IndexBatchSize
+	nice = definition.Nice
+	neo4jHeap, neo4jPageCache = definition.Neo4jHeap, definition.Neo4jPageCache
+	deployGPU = definition.GPU
+	memoryLimit, cpuLimit = "", ""
+	for _, service := range internal.LimitedServices {
+		*serviceMemoryLimits[service], *serviceCPULimits[service] = "", ""
+	}
+	if definition.Limits != nil {
+		memoryLimit, cpuLimit = definition.Limits.Memory, definition.Limits.CPUs
+		for service, limits := range definition.Limits.Services {
+			*serviceMemoryLimits[service], *serviceCPULimits[service] = limits.Memory, limits.CPUs
+		}
+	}
+	deployTLS = definition.TLS
+	tlsOptions = internal.TLSOptions{}
+
+	portSchemeFlags.BindAddress = definition.Ports.BindAddress
+	if portSchemeFlags.BindAddress == "" {
+		portSchemeFlags.BindAddress = "0.0.0.0"
+	}
+	if !singleContainer {
+		portSchemeFlags.PostgresOffset = definition.Ports.Postgres - definition.Ports.App
+		portSchemeFlags.Neo4jOffset = definition.Ports.Neo4jBolt - definition.Ports.App
+	}
+
+	internal.Log.Info("Importing instance", "definition", file, "instance", instanceName)
+	err = deployInstanceWith(repo, instanceName, definition.Ports.App, func(config *internal.DeployConfig) {
+		config.AppImage = definition.AppImage
+		config.PostgresImage = definition.PostgresImage
+		config.Neo4jImage = definition.Neo4jImage
+		config.LogLevel = definition.LogLevel
+		config.Labels = definition.Labels
+		config.ServiceEnv = definition.Env
+	}, false)
+	if err != nil {
+		return err
+	}
+
+	warnImportDifferences(definition, instanceName)
+	return nil
+}
+
+// importedRepo returns the repository to deploy a definition from: its path if it exists on
+// this machine, and otherwise its Git URL
+func importedRepo(definition *internal.InstanceDefinition) string {
+	if definition.RepoPath == "" {
+		return definition.RepoURL
+	}
+	if _, err := os.Stat(definition.RepoPath); err != nil && definition.RepoURL != "" {
+		internal.Log.Warning("Repository path does not exist on this machine, cloning it instead", "path", definition.RepoPath, "url", definition.RepoURL)
+		return definition.RepoURL
+	}
+	return definition.RepoPath
+}
+
+// warnImportDifferences warns about what the imported instance could not take over from the
+// definition: ports that were taken and database versions of other images
+func warnImportDifferences(definition *internal.InstanceDefinition, instanceName string) {
+	config, err := internal.GetInstanceConfig(instanceName)
+	if err != nil {
+		return
+	}
+	if config.AppPort != definition.Ports.App {
+		internal.Log.Warning("The definition's ports are in use, the instance got other ports", "app_port", config.AppPort, "definition_app_port", definition.Ports.App)
+	}
+	if definition.PostgresVersion != "" && config.PostgresVersion != "" && config.PostgresVersion != definition.PostgresVersion {
+		internal.Log.Warning("PostgreSQL version differs from the definition", "version", config.PostgresVersion, "definition", definition.PostgresVersion)
+	}
+	if definition.Neo4jVersion != "" && config.Neo4jVersion != "" && config.Neo4jVersion != definition.Neo4jVersion {
+		internal.Log.Warning("Neo4j version differs from the definition", "version", config.Neo4jVersion, "definition", definition.Neo4jVersion)
+	}
+}
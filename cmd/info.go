@@ -1,47 +1,130 @@
 package cmd
 
 import (
+	"context"
 	"fmt"
 	"os"
-	"os/exec"
+	"os/signal"
+	"sort"
+	"strconv"
 	"strings"
+	"text/tabwriter"
+	"time"
 
 	"graphsense-cli/internal"
 
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/filters"
+	"github.com/nicksnyder/go-i18n/v2/i18n"
 	"github.com/spf13/cobra"
 )
 
+var (
+	logsTail       string
+	logsSince      string
+	logsNoFollow   bool
+	logsTimestamps bool
+)
+
+var statusRepair bool
+
+var (
+	listSort      string
+	listUnusedFor time.Duration
+	listFilters   []string
+)
+
 var listCmd = &cobra.Command{
 	Use:   "list",
 	Short: "List all GraphSense instances",
-	Long:  "List all running and stopped GraphSense instances.",
+	Long: `List all running and stopped GraphSense instances.
+Instances record when they were last deployed, started or upgraded; use --sort last-used
+and --unused-for to find idle instances. --filter shows only instances matching key=pattern,
+e.g. label=team=backend for the labels given at deploy time.`,
 	RunE: func(cmd *cobra.Command, args []string) error {
-		return listInstances()
+		structured, err := structuredOutput()
+		if err != nil {
+			return err
+		}
+		filters, err := parseInstanceFilters(listFilters)
+		if err != nil {
+			return err
+		}
+		if structured {
+			return listInstancesStructured(listSort, listUnusedFor, filters)
+		}
+		return listInstances(listSort, listUnusedFor, filters)
 	},
 }
 
 var logsCmd = &cobra.Command{
 	Use:   "logs <instance_name> [service]",
 	Short: "Show logs for a GraphSense instance",
-	Long:  "Show logs for a GraphSense instance. Optionally specify a service (app, postgres, neo4j).",
-	Args:  cobra.RangeArgs(1, 2),
+	Long: `Show logs for a GraphSense instance. Optionally specify a service (app, postgres, neo4j).
+
+Logs are followed until interrupted unless --no-follow is given. --tail limits the output
+to the last lines of each service, and --since to lines newer than a duration (15m, 2h)
+or timestamp (2025-01-01T12:00:00).
+
+--export <dir> writes the logs of every service to <dir>/<instance_name>/<service>.log
+instead, rotating earlier exports to <service>.log.1 and so on. With --mirror it keeps
+appending to those files until interrupted, rotating them at --max-size, and reattaches
+to containers that are restarted or recreated.`,
+	Args: cobra.RangeArgs(1, 2),
 	RunE: func(cmd *cobra.Command, args []string) error {
 		instanceName := args[0]
 		var service string
 		if len(args) > 1 {
 			service = args[1]
 		}
+		if logsExport != "" {
+			return exportLogs(instanceName, service)
+		}
+		if logsMirror {
+			return fmt.Errorf("--mirror requires --export")
+		}
 		return showLogs(instanceName, service)
 	},
 }
 
 var statusCmd = &cobra.Command{
-	Use:   "status <instance_name>",
-	Short: "Show status of a GraphSense instance",
-	Long:  "Show the status and details of a GraphSense instance.",
-	Args:  cobra.ExactArgs(1),
+	Use:   "status <instance_name>... | --all",
+	Short: "Show status of GraphSense instances",
+	Long: `Show the status and details of GraphSense instances.
+
+With --repair, instances whose containers stopped without the stop command, typically
+because the Docker daemon or the host restarted, are started again and checked for health
+first. Each instance's autostart policy decides whether it is recovered: unless-stopped
+(the default) skips instances stopped with the stop command, always recovers them too
+and never leaves them alone. Change the policy with set-autostart.`,
+	Args: bulkArgs,
 	RunE: func(cmd *cobra.Command, args []string) error {
-		return showStatus(args[0])
+		structured, err := structuredOutput()
+		if err != nil {
+			return err
+		}
+		names, err := resolveInstances(args)
+		if err != nil {
+			return err
+		}
+		var repairErr error
+		if statusRepair {
+			repairErr = repairInstances(names)
+		}
+		if structured {
+			err = showStatusStructured(names)
+		} else if len(names) == 1 {
+			err = showStatus(names[0])
+		} else {
+			err = runBulk(names, func(instanceName string) error {
+				fmt.Printf("\n== %s ==\n", instanceName)
+				return showStatus(instanceName)
+			})
+		}
+		if err != nil {
+			return err
+		}
+		return repairErr
 	},
 }
 
@@ -50,40 +133,234 @@ var debugCmd = &cobra.Command{
 	Short: "Show debug information",
 	Long:  "Show port usage and debug information for troubleshooting.",
 	RunE: func(cmd *cobra.Command, args []string) error {
+		structured, err := structuredOutput()
+		if err != nil {
+			return err
+		}
+		if structured {
+			return debugPortsStructured()
+		}
 		return debugPorts()
 	},
 }
 
-func listInstances() error {
+func init() {
+	listCmd.Flags().StringVar(&listSort, "sort", "name", "Sort order: name or last-used")
+	listCmd.Flags().DurationVar(&listUnusedFor, "unused-for", 0, "Only show instances not used for at least this long (e.g. 72h)")
+	listCmd.Flags().StringArrayVar(&listFilters, "filter", nil, "Only show instances matching key=pattern (keys: name, repo, label; patterns may use * wildcards), e.g. label=team=backend")
+
+	logsCmd.Flags().StringVar(&logsTail, "tail", "all", "Number of lines to show from the end of each service's logs")
+	logsCmd.Flags().StringVar(&logsSince, "since", "", "Only show logs newer than a duration (e.g. 15m) or timestamp")
+	logsCmd.Flags().BoolVar(&logsNoFollow, "no-follow", false, "Print the logs and exit instead of following them")
+	logsCmd.Flags().BoolVar(&logsTimestamps, "timestamps", false, "Show the timestamp of every line")
+
+	addOutputFlag(listCmd)
+	statusCmd.Flags().BoolVar(&statusRepair, "repair", false, "Start instances stopped by a Docker or host restart, according to their autostart policy")
+	addOutputFlag(statusCmd)
+	addBulkFlags(statusCmd)
+	addOutputFlag(debugCmd)
+}
+
+// listedContainer is a container row shown by the list command
+type listedContainer struct {
+	instance string
+	line     string
+	lastUsed time.Time
+}
+
+func listInstances(sortBy string, unusedFor time.Duration, instanceFilters []instanceFilter) error {
+	if sortBy != "name" && sortBy != "last-used" {
+		return fmt.Errorf("invalid sort order '%s': must be name or last-used", sortBy)
+	}
+
 	internal.Log.Info("GraphSense Instances:")
 	fmt.Println()
 
-	// Get all containers with graphsense in their name
-	cmd := exec.Command("docker", "ps", "--format", "table {{.Names}}\t{{.Image}}\t{{.Status}}\t{{.Ports}}")
-	output, err := cmd.Output()
+	docker, err := internal.GetDockerClient()
 	if err != nil {
-		return fmt.Errorf("failed to list containers: %v", err)
+		return err
 	}
 
-	lines := strings.Split(string(output), "\n")
-	var graphsenseContainers []string
+	// Get all running compose containers
+	containers, err := docker.ListContainers(context.Background(), false, filters.NewArgs(filters.Arg("label", internal.ComposeProjectLabel)))
+	if err != nil {
+		return err
+	}
+
+	lastUsed, err := internal.GetLastUsed()
+	if err != nil {
+		internal.Log.Warning("Failed to load last-used times", "error", err)
+		lastUsed = map[string]time.Time{}
+	}
+
+	images, err := internal.GetDeployedImages()
+	if err != nil {
+		internal.Log.Warning("Failed to load image digests", "error", err)
+	}
+
+	commits, err := internal.GetIndexedCommits()
+	if err != nil {
+		internal.Log.Warning("Failed to load indexed commits", "error", err)
+	}
+
+	var graphsenseContainers []listedContainer
+	matches := make(map[string]bool)
 	
-	for _, line := range lines {
-		if strings.Contains(line, "graphsense-") {
-			graphsenseContainers = append(graphsenseContainers, line)
+	for _, c := range containers {
+		name := internal.ContainerName(c)
+		if !strings.Contains(name, "graphsense-") {
+			continue
+		}
+
+		instance := c.Labels[internal.ComposeProjectLabel]
+		if len(instanceFilters) > 0 {
+			matched, ok := matches[instance]
+			if !ok {
+				matched = matchesInstanceFilters(instance, instanceFilters)
+				matches[instance] = matched
+			}
+			if !matched {
+				continue
+			}
+		}
+		digest := images[instance][c.Labels[internal.ComposeServiceLabel]].Digest
+		line := strings.Join([]string{name, c.Image, formatDigest(digest), c.Status, internal.FormatPorts(c.Ports), formatRevision(commits, instance)}, "\t")
+		container := listedContainer{instance: instance, line: line, lastUsed: lastUsed[instance]}
+		if unusedFor > 0 && !container.lastUsed.IsZero() && time.Since(container.lastUsed) < unusedFor {
+			continue
 		}
+		graphsenseContainers = append(graphsenseContainers, container)
 	}
 
+	internal.WarnLegacyArtifacts()
+
 	if len(graphsenseContainers) == 0 {
 		internal.Log.Info("No instances found.")
 		return nil
 	}
 
+	sort.SliceStable(graphsenseContainers, func(i, j int) bool {
+		a, b := graphsenseContainers[i], graphsenseContainers[j]
+		if sortBy == "last-used" && !a.lastUsed.Equal(b.lastUsed) {
+			// Most recently used first, never used last
+			return a.lastUsed.After(b.lastUsed)
+		}
+		return a.line < b.line
+	})
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 3, ' ', 0)
+	fmt.Fprintln(w, internal.Localize(&i18n.Message{ID: "ListTableHeader", Other: "NAMES\tIMAGE\tDIGEST\tSTATUS\tPORTS\tREVISION\tLAST USED"}, nil))
 	for _, container := range graphsenseContainers {
-		fmt.Println(container)
+		fmt.Fprintf(w, "%s\t%s\n", container.line, formatLastUsed(container.lastUsed))
 	}
 
-	return nil
+	return w.Flush()
+}
+
+// formatDigest shortens the recorded digest of an image for tables, or shows - if none is
+// recorded, as for instances deployed before digests were
+func formatDigest(digest string) string {
+	if digest == "" {
+		return "-"
+	}
+	return internal.ShortDigest(digest)
+}
+
+// formatRevision shows the branch and commit an instance last indexed, or - if none is
+// recorded, as for repositories that are not git checkouts
+func formatRevision(commits map[string]internal.IndexedCommit, instanceName string) string {
+	commit, ok := commits[instanceName]
+	if !ok {
+		return "-"
+	}
+	return commit.Revision()
+}
+
+// formatLastUsed renders a last-used time relative to now
+func formatLastUsed(lastUsed time.Time) string {
+	if lastUsed.IsZero() {
+		return "never"
+	}
+	return fmt.Sprintf("%s ago", time.Since(lastUsed).Round(time.Minute))
+}
+
+// formatExpiry renders when an instance expires relative to now
+func formatExpiry(expiresAt time.Time) string {
+	if remaining := time.Until(expiresAt); remaining > 0 {
+		return fmt.Sprintf("in %s (%s)", remaining.Round(time.Minute), expiresAt.Local().Format("2006-01-02 15:04"))
+	}
+	return fmt.Sprintf("%s ago; gc stops or removes it", time.Since(expiresAt).Round(time.Minute))
+}
+
+// listInstancesStructured prints every known instance with its live state as JSON or YAML
+func listInstancesStructured(sortBy string, unusedFor time.Duration, instanceFilters []instanceFilter) error {
+	instances, err := collectInstanceStatuses(sortBy, unusedFor)
+	if err != nil {
+		return err
+	}
+	matching := []*internal.InstanceStatus{}
+	for _, instance := range instances {
+		if matchesInstanceFilters(instance.Name, instanceFilters) {
+			matching = append(matching, instance)
+		}
+	}
+	return printStructured(matching)
+}
+
+// collectInstanceStatuses returns every known instance with its live state
+func collectInstanceStatuses(sortBy string, unusedFor time.Duration) ([]*internal.InstanceStatus, error) {
+	if sortBy != "name" && sortBy != "last-used" {
+		return nil, fmt.Errorf("invalid sort order '%s': must be name or last-used", sortBy)
+	}
+
+	names, err := internal.GetInstanceNames()
+	if err != nil {
+		return nil, err
+	}
+
+	projects, err := internal.GetGraphsenseProjects()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list containers: %v", err)
+	}
+
+	seen := make(map[string]bool)
+	for _, name := range names {
+		seen[name] = true
+	}
+	for _, project := range projects {
+		if !seen[project] {
+			seen[project] = true
+			names = append(names, project)
+		}
+	}
+
+	lastUsed, err := internal.GetLastUsed()
+	if err != nil {
+		lastUsed = map[string]time.Time{}
+	}
+
+	instances := []*internal.InstanceStatus{}
+	for _, name := range names {
+		if unusedFor > 0 && !lastUsed[name].IsZero() && time.Since(lastUsed[name]) < unusedFor {
+			continue
+		}
+
+		status, err := internal.GetInstanceStatus(name)
+		if err != nil {
+			return nil, err
+		}
+		instances = append(instances, status)
+	}
+
+	sort.SliceStable(instances, func(i, j int) bool {
+		a, b := lastUsed[instances[i].Name], lastUsed[instances[j].Name]
+		if sortBy == "last-used" && !a.Equal(b) {
+			return a.After(b)
+		}
+		return instances[i].Name < instances[j].Name
+	})
+
+	return instances, nil
 }
 
 func showLogs(instanceName, service string) error {
@@ -91,19 +368,66 @@ func showLogs(instanceName, service string) error {
 		return fmt.Errorf("instance '%s' does not exist", instanceName)
 	}
 
-	envVars := map[string]string{
-		"COMPOSE_PROJECT_NAME": instanceName,
+	options, err := logOptions()
+	if err != nil {
+		return err
 	}
 
-	args := []string{
-		"logs", "-f",
+	// Following ends with Ctrl+C, which reaches docker as well; catch it here so that
+	// stopping the logs is not reported as a failure
+	interrupted := make(chan os.Signal, 1)
+	signal.Notify(interrupted, os.Interrupt)
+	defer signal.Stop(interrupted)
+
+	// A single-container instance has no compose project to read logs from
+	if config, err := internal.GetInstanceConfig(instanceName); err == nil && config.IsSingleContainer() {
+		if service != "" && service != "app" {
+			return fmt.Errorf("instance '%s' runs in single-container mode and only has the app service", instanceName)
+		}
+		args := append(append([]string{"logs"}, options...), instanceName+"-app")
+		cmd := internal.Command("docker", args...)
+		cmd.Stdout = os.Stdout
+		cmd.Stderr = os.Stderr
+		err = cmd.Run()
+	} else {
+		envVars := map[string]string{
+			"COMPOSE_PROJECT_NAME": instanceName,
+		}
+
+		args := append([]string{"logs"}, options...)
+		if service != "" {
+			args = append(args, service)
+		}
+		err = internal.RunDockerCompose(args, envVars)
 	}
 
-	if service != "" {
-		args = append(args, service)
+	select {
+	case <-interrupted:
+		return nil
+	default:
+		return err
 	}
+}
 
-	return internal.RunDockerCompose(args, envVars)
+// logOptions returns the docker logs options selected with the logs flags
+func logOptions() ([]string, error) {
+	var options []string
+	if !logsNoFollow {
+		options = append(options, "--follow")
+	}
+	if logsTail != "all" {
+		if n, err := strconv.Atoi(logsTail); err != nil || n < 0 {
+			return nil, fmt.Errorf("invalid --tail '%s': must be a number of lines or all", logsTail)
+		}
+		options = append(options, "--tail", logsTail)
+	}
+	if logsSince != "" {
+		options = append(options, "--since", logsSince)
+	}
+	if logsTimestamps {
+		options = append(options, "--timestamps")
+	}
+	return options, nil
 }
 
 func showStatus(instanceName string) error {
@@ -113,86 +437,408 @@ func showStatus(instanceName string) error {
 
 	internal.Log.Info("Container details:")
 	
-	cmd := exec.Command("docker", "ps", "--filter", fmt.Sprintf("label=com.docker.compose.project=%s", instanceName), "--format", "table {{.Names}}\t{{.Status}}\t{{.Ports}}")
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
-	
-	return cmd.Run()
+	docker, err := internal.GetDockerClient()
+	if err != nil {
+		return err
+	}
+
+	filter := filters.NewArgs(filters.Arg("label", fmt.Sprintf("%s=%s", internal.ComposeProjectLabel, instanceName)))
+	containers, err := docker.ListContainers(context.Background(), false, filter)
+	if err != nil {
+		return err
+	}
+
+	images, err := internal.GetInstanceImages(instanceName)
+	if err != nil {
+		internal.Log.Warning("Failed to load image digests", "error", err)
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 3, ' ', 0)
+	fmt.Fprintln(w, internal.Localize(&i18n.Message{ID: "StatusTableHeader", Other: "NAMES\tSTATUS\tPORTS\tIMAGE\tDIGEST"}, nil))
+	for _, c := range containers {
+		digest := images[c.Labels[internal.ComposeServiceLabel]].Digest
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", internal.ContainerName(c), c.Status, internal.FormatPorts(c.Ports), c.Image, formatDigest(digest))
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	config, err := internal.GetInstanceConfig(instanceName)
+	if err == nil {
+		var details []string
+		if len(config.Labels) > 0 {
+			details = append(details, internal.Localize(&i18n.Message{ID: "StatusLabels", Other: "Labels: {{.Value}}"}, map[string]any{"Value": internal.FormatLabels(config.Labels)}))
+		}
+		if config.CPUSet != "" {
+			details = append(details, internal.Localize(&i18n.Message{ID: "StatusCPUs", Other: "CPUs: {{.Value}}"}, map[string]any{"Value": config.CPUSet}))
+		}
+		if config.Neo4jCPUSet != "" {
+			details = append(details, internal.Localize(&i18n.Message{ID: "StatusNeo4jCPUs", Other: "Neo4j CPUs: {{.Value}}"}, map[string]any{"Value": config.Neo4jCPUSet}))
+		}
+		if limits := config.DescribeLimits(); limits != "" {
+			details = append(details, internal.Localize(&i18n.Message{ID: "StatusLimits", Other: "Limits: {{.Value}}"}, map[string]any{"Value": limits}))
+		}
+		if memory := config.DescribeNeo4jMemory(); memory != "" {
+			details = append(details, internal.Localize(&i18n.Message{ID: "StatusNeo4jMemory", Other: "Neo4j memory: {{.Value}}"}, map[string]any{"Value": memory}))
+		}
+		if config.GPU != "" {
+			details = append(details, internal.Localize(&i18n.Message{ID: "StatusGPUs", Other: "GPUs: {{.Value}}"}, map[string]any{"Value": config.GPU}))
+		}
+		if env := config.DescribeServiceEnv(); env != "" {
+			details = append(details, internal.Localize(&i18n.Message{ID: "StatusEnvironment", Other: "Environment: {{.Value}}"}, map[string]any{"Value": env}))
+		}
+		if indexing := config.DescribeIndexing(); indexing != "" {
+			details = append(details, internal.Localize(&i18n.Message{ID: "StatusIndexing", Other: "Indexing: {{.Value}}"}, map[string]any{"Value": indexing}))
+		}
+		if config.TLS {
+			details = append(details, internal.Localize(&i18n.Message{ID: "StatusMCPServer", Other: "MCP Server: {{.Value}}"}, map[string]any{"Value": config.AppURL()}))
+		}
+		if !config.ExpiresAt.IsZero() {
+			details = append(details, internal.Localize(&i18n.Message{ID: "StatusExpires", Other: "Expires: {{.Value}}"}, map[string]any{"Value": formatExpiry(config.ExpiresAt)}))
+		}
+		if commits, err := internal.GetIndexedCommits(); err == nil {
+			if commit, ok := commits[instanceName]; ok {
+				details = append(details, internal.Localize(&i18n.Message{ID: "StatusIndexed", Other: "Indexed: {{.Revision}}, {{.When}}"}, map[string]any{"Revision": commit.Revision(), "When": formatLastUsed(commit.IndexedAt)}))
+			}
+		}
+		if len(details) > 0 {
+			fmt.Printf("\n%s\n", strings.Join(details, "\n"))
+		}
+		showIndexProgress(config)
+	}
+
+	// The all-in-one image keeps Neo4j internal, so there is no neo4j container to check
+	if err == nil && config.IsSingleContainer() {
+		return nil
+	}
+
+	fmt.Println()
+	report, err := internal.VerifyIndexes(instanceName)
+	switch {
+	case err != nil:
+		internal.Log.Warning("Could not check Neo4j indexes", "error", err)
+	case report.Degraded:
+		internal.Log.Warning("DEGRADED: Neo4j indexes are not all ONLINE. Graph queries will be much slower until they are.", "indexes", report.Summary())
+	default:
+		internal.Log.Success("Neo4j indexes: all expected indexes ONLINE")
+	}
+	return nil
+}
+
+// showIndexProgress prints the indexing progress the app of an instance reports, if it reports any
+func showIndexProgress(config *internal.DeployConfig) {
+	if running, err := internal.AppRunning(config.InstanceName); err != nil || !running {
+		return
+	}
+	progress, err := internal.GetIndexProgress(config)
+	if err != nil {
+		internal.Log.Verbose("Indexing progress not available", "error", err)
+		return
+	}
+
+	fmt.Println()
+	if progress.Complete() {
+		internal.Log.Success("Indexing complete", "files", progress.FilesProcessed, "nodes", progress.NodesCreated, "edges", progress.EdgesCreated)
+		return
+	}
+
+	internal.Log.Info("Indexing progress:")
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 3, ' ', 0)
+	fmt.Fprintln(w, internal.Localize(&i18n.Message{ID: "ProgressPhase", Other: "  Phase:\t{{.Phase}}"}, map[string]any{"Phase": progress.Phase}))
+	if percent := progress.Percent(); percent >= 0 {
+		fmt.Fprintln(w, internal.Localize(&i18n.Message{ID: "ProgressFilesOfTotal", Other: "  Files:\t{{.Processed}} / {{.Total}} ({{.Percent}}%)"}, map[string]any{"Processed": progress.FilesProcessed, "Total": progress.FilesTotal, "Percent": fmt.Sprintf("%.1f", percent)}))
+	} else {
+		fmt.Fprintln(w, internal.Localize(&i18n.Message{ID: "ProgressFiles", Other: "  Files:\t{{.Processed}}"}, map[string]any{"Processed": progress.FilesProcessed}))
+	}
+	fmt.Fprintln(w, internal.Localize(&i18n.Message{ID: "ProgressGraph", Other: "  Graph:\t{{.Nodes}} nodes, {{.Edges}} edges"}, map[string]any{"Nodes": progress.NodesCreated, "Edges": progress.EdgesCreated}))
+	if !progress.StartedAt.IsZero() {
+		fmt.Fprintln(w, internal.Localize(&i18n.Message{ID: "ProgressRunningFor", Other: "  Running for:\t{{.Duration}}"}, map[string]any{"Duration": time.Since(progress.StartedAt).Round(time.Second)}))
+	}
+	if eta := progress.ETA(); eta > 0 {
+		fmt.Fprintln(w, internal.Localize(&i18n.Message{ID: "ProgressETA", Other: "  ETA:\t{{.Duration}}"}, map[string]any{"Duration": eta.Round(time.Second)}))
+	}
+	w.Flush()
+}
+
+// showStatusStructured prints the status of one instance as an object, or of several as a list
+func showStatusStructured(instanceNames []string) error {
+	var statuses []*internal.InstanceStatus
+	failed := 0
+	for _, instanceName := range instanceNames {
+		status, err := getStatus(instanceName)
+		if err != nil {
+			if len(instanceNames) == 1 {
+				return err
+			}
+			internal.Log.Error("Failed", "instance", instanceName, "error", err)
+			failed++
+			continue
+		}
+		statuses = append(statuses, status)
+	}
+
+	if len(instanceNames) == 1 {
+		return printStructured(statuses[0])
+	}
+	if err := printStructured(statuses); err != nil {
+		return err
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d instances failed", failed, len(instanceNames))
+	}
+	return nil
+}
+
+// getStatus returns the status of an existing instance
+// repairInstances recovers the instances stopped by a Docker or host restart and logs the outcome
+func repairInstances(instanceNames []string) error {
+	failed := 0
+	for _, instanceName := range instanceNames {
+		result := internal.RecoverInstance(context.Background(), instanceName)
+		switch result.Outcome {
+		case internal.RecoveryRunning:
+			internal.Log.Verbose("All containers running", "instance", instanceName)
+		case internal.RecoveryRecovered:
+			internal.Log.Success("Instance recovered", "instance", instanceName, "stopped", strings.Join(result.Stopped, ", "))
+		case internal.RecoverySkipped:
+			internal.Log.Info("Instance left stopped", "instance", instanceName, "reason", result.Detail)
+		default:
+			internal.Log.Error("Failed to recover instance", "instance", instanceName, "error", result.Detail)
+			failed++
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d instances could not be recovered", failed, len(instanceNames))
+	}
+	return nil
+}
+
+func getStatus(instanceName string) (*internal.InstanceStatus, error) {
+	if !internal.InstanceExists(instanceName) {
+		return nil, fmt.Errorf("instance '%s' does not exist", instanceName)
+	}
+	return internal.GetInstanceStatus(instanceName)
+}
+
+// portSetStatus is the availability of the ports derived from one base port
+type portSetStatus struct {
+	BasePort      int      `json:"base_port" yaml:"base_port"`
+	AppPort       int      `json:"app_port" yaml:"app_port"`
+	PostgresPort  int      `json:"postgres_port" yaml:"postgres_port"`
+	Neo4jBoltPort int      `json:"neo4j_bolt_port" yaml:"neo4j_bolt_port"`
+	Available     bool     `json:"available" yaml:"available"`
+	Conflicts     []string `json:"conflicts,omitempty" yaml:"conflicts,omitempty"`
+}
+
+// debugInfo is the structured form of the debug command output
+type debugInfo struct {
+	ListeningPorts      []internal.ListeningPort   `json:"listening_ports" yaml:"listening_ports"`
+	PortSets            []portSetStatus            `json:"port_sets" yaml:"port_sets"`
+	RecommendedBasePort int                        `json:"recommended_base_port" yaml:"recommended_base_port"`
+	Instances           []*internal.InstanceStatus `json:"instances" yaml:"instances"`
+}
+
+// checkPortSet reports which ports derived from basePort are already in use or reserved
+func checkPortSet(scheme internal.PortScheme, reserved map[int]string, basePort int) portSetStatus {
+	ports := scheme.PortSet(basePort)
+	set := portSetStatus{
+		BasePort:      basePort,
+		AppPort:       ports.App,
+		PostgresPort:  ports.Postgres,
+		Neo4jBoltPort: ports.Neo4jBolt,
+	}
+
+	for _, port := range []struct {
+		label string
+		port  int
+	}{{"APP", set.AppPort}, {"PG", set.PostgresPort}, {"NEO4J-BOLT", set.Neo4jBoltPort}} {
+		switch owner, ok := reserved[port.port]; {
+		case internal.IsPortInUse(port.port):
+			set.Conflicts = append(set.Conflicts, fmt.Sprintf("%s:%d", port.label, port.port))
+		case ok:
+			set.Conflicts = append(set.Conflicts, fmt.Sprintf("%s:%d(reserved:%s)", port.label, port.port, owner))
+		}
+	}
+	set.Available = len(set.Conflicts) == 0
+
+	return set
+}
+
+// debugBasePortCount is how many base ports of the port scheme the debug command reports on
+const debugBasePortCount = 5
+
+// debugBasePorts returns the first base ports of the port scheme
+func debugBasePorts(scheme internal.PortScheme) []int {
+	ports := make([]int, debugBasePortCount)
+	for i := range ports {
+		ports[i] = scheme.Base + i*scheme.Step
+	}
+	return ports
+}
+
+// graphsenseListeningPorts lists the listening ports an instance has or could be given: reserved
+// ports, the ports of the port sets debug reports on and the default database ports
+func graphsenseListeningPorts(scheme internal.PortScheme, reserved map[int]string) ([]internal.ListeningPort, error) {
+	relevant := map[int]bool{internal.DefaultPostgresPort: true, internal.DefaultNeo4jPort: true}
+	for port := range reserved {
+		relevant[port] = true
+	}
+	for _, basePort := range debugBasePorts(scheme) {
+		set := scheme.PortSet(basePort)
+		relevant[set.App], relevant[set.Postgres], relevant[set.Neo4jBolt] = true, true, true
+	}
+
+	listening, err := internal.GetListeningPorts()
+	if err != nil {
+		return nil, err
+	}
+	ports := []internal.ListeningPort{}
+	for _, listener := range listening {
+		if relevant[listener.Port] {
+			ports = append(ports, listener)
+		}
+	}
+	return ports, nil
+}
+
+// debugPortsStructured prints port availability and GraphSense containers as JSON or YAML
+func debugPortsStructured() error {
+	info := debugInfo{Instances: []*internal.InstanceStatus{}}
+
+	scheme, err := internal.LoadPortScheme(internal.PortScheme{})
+	if err != nil {
+		return err
+	}
+	reserved, err := internal.GetReservedPorts()
+	if err != nil {
+		return err
+	}
+	if info.ListeningPorts, err = graphsenseListeningPorts(scheme, reserved); err != nil {
+		return err
+	}
+	for _, basePort := range debugBasePorts(scheme) {
+		info.PortSets = append(info.PortSets, checkPortSet(scheme, reserved, basePort))
+	}
+
+	nextPorts, err := internal.FindAvailablePortSet(scheme, "")
+	if err != nil {
+		return fmt.Errorf("failed to find available port: %v", err)
+	}
+	info.RecommendedBasePort = nextPorts.App
+
+	projects, err := internal.GetGraphsenseProjects()
+	if err != nil {
+		return fmt.Errorf("failed to list containers: %v", err)
+	}
+	for _, project := range projects {
+		status, err := internal.GetInstanceStatus(project)
+		if err != nil {
+			return err
+		}
+		info.Instances = append(info.Instances, status)
+	}
+
+	return printStructured(info)
 }
 
 func debugPorts() error {
 	internal.Log.Info("Port Usage Debug Information")
 	fmt.Println()
 
+	scheme, err := internal.LoadPortScheme(internal.PortScheme{})
+	if err != nil {
+		return err
+	}
+	reserved, err := internal.GetReservedPorts()
+	if err != nil {
+		return err
+	}
+
 	// Show currently listening ports (GraphSense related)
 	internal.Log.Info("Currently listening ports (GraphSense related):")
-	cmd := exec.Command("sh", "-c", "netstat -an 2>/dev/null | grep LISTEN | grep -E ':(808[0-9]|5[0-9][0-9][0-9]|74[0-9][0-9]|76[0-9][0-9])' | sort -n -k4 -t:")
-	output, err := cmd.Output()
-	if err != nil || len(output) == 0 {
-		fmt.Println("No GraphSense ports detected")
+	if internal.IsRemoteDocker() {
+		fmt.Println(internal.Localize(&i18n.Message{ID: "DebugPortsRemote", Other: "  Ports of this machine; the instances run on {{.Host}}"}, map[string]any{"Host": internal.DockerHostAddress()}))
+	}
+	listening, err := graphsenseListeningPorts(scheme, reserved)
+	if err != nil {
+		internal.Log.Warning("Failed to detect listening ports", "error", err)
+	} else if len(listening) == 0 {
+		fmt.Println(internal.Localize(&i18n.Message{ID: "DebugNoPorts", Other: "No GraphSense ports detected"}, nil))
 	} else {
-		fmt.Print(string(output))
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 3, ' ', 0)
+		fmt.Fprintln(w, internal.Localize(&i18n.Message{ID: "DebugPortsTableHeader", Other: "ADDRESS\tPORT\tPROCESS\tRESERVED BY"}, nil))
+		for _, listener := range listening {
+			fmt.Fprintf(w, "%s\t%d\t%s\t%s\n", listener.Address, listener.Port, listener.Process, reserved[listener.Port])
+		}
+		w.Flush()
 	}
 
 	fmt.Println()
 	internal.Log.Info("Docker containers with port mappings:")
-	cmd = exec.Command("sh", "-c", "docker ps --format 'table {{.Names}}\t{{.Image}}\t{{.Ports}}' | grep -E '(graphsense|neo4j|postgres)'")
-	output, err = cmd.Output()
-	if err != nil || len(output) == 0 {
-		fmt.Println("No GraphSense containers running")
-	} else {
-		fmt.Print(string(output))
+	var containers []types.Container
+	if docker, err := internal.GetDockerClient(); err == nil {
+		containers, _ = docker.ListContainers(context.Background(), false, filters.NewArgs())
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 3, ' ', 0)
+	found := false
+	for _, c := range containers {
+		name := internal.ContainerName(c)
+		if !strings.Contains(name, "graphsense") && !strings.Contains(name, "neo4j") && !strings.Contains(name, "postgres") {
+			continue
+		}
+		if !found {
+			fmt.Fprintln(w, internal.Localize(&i18n.Message{ID: "DebugContainersTableHeader", Other: "NAMES\tIMAGE\tPORTS"}, nil))
+			found = true
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\n", name, c.Image, internal.FormatPorts(c.Ports))
+	}
+	w.Flush()
+	if !found {
+		fmt.Println(internal.Localize(&i18n.Message{ID: "DebugNoContainers", Other: "No GraphSense containers running"}, nil))
 	}
 
 	fmt.Println()
 	internal.Log.Info("GraphSense Docker Compose projects:")
-	cmd = exec.Command("sh", "-c", "docker ps --filter 'label=com.docker.compose.project' --format 'table {{.Names}}\t{{.Label \"com.docker.compose.project\"}}\t{{.Ports}}' | grep graphsense")
-	output, err = cmd.Output()
-	if err != nil || len(output) == 0 {
-		fmt.Println("No GraphSense compose projects detected")
-	} else {
-		fmt.Print(string(output))
+	w = tabwriter.NewWriter(os.Stdout, 0, 0, 3, ' ', 0)
+	found = false
+	for _, c := range containers {
+		project := c.Labels[internal.ComposeProjectLabel]
+		name := internal.ContainerName(c)
+		if project == "" || !strings.Contains(name+project, "graphsense") {
+			continue
+		}
+		if !found {
+			fmt.Fprintln(w, internal.Localize(&i18n.Message{ID: "DebugProjectsTableHeader", Other: "NAMES\tPROJECT\tPORTS"}, nil))
+			found = true
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\n", name, project, internal.FormatPorts(c.Ports))
+	}
+	w.Flush()
+	if !found {
+		fmt.Println(internal.Localize(&i18n.Message{ID: "DebugNoProjects", Other: "No GraphSense compose projects detected"}, nil))
 	}
 
 	fmt.Println()
 	internal.Log.Info("Available port ranges starting from common bases:")
 	
-	basePorts := []int{8080, 8090, 8100, 8110, 8120}
-	for _, basePort := range basePorts {
-		appPort := basePort
-		postgresPort := basePort + 100
-		neo4jBoltPort := basePort + 200
-
-		conflicts := ""
-		if internal.IsPortInUse(appPort) {
-			conflicts += fmt.Sprintf(" APP:%d", appPort)
-		}
-		if internal.IsPortInUse(postgresPort) {
-			conflicts += fmt.Sprintf(" PG:%d", postgresPort)
-		}
-		if internal.IsPortInUse(neo4jBoltPort) {
-			conflicts += fmt.Sprintf(" NEO4J-BOLT:%d", neo4jBoltPort)
-		}
-
-		if conflicts == "" {
-			fmt.Printf("  Base %d: ✅ AVAILABLE (App:%d, PG:%d, Neo4j:%d)\n", basePort, appPort, postgresPort, neo4jBoltPort)
+	for _, basePort := range debugBasePorts(scheme) {
+		set := checkPortSet(scheme, reserved, basePort)
+		if set.Available {
+			fmt.Println(internal.Localize(&i18n.Message{ID: "DebugBaseAvailable", Other: "  Base {{.Base}}: {{.Symbol}}AVAILABLE (App:{{.App}}, PG:{{.Postgres}}, Neo4j:{{.Neo4j}})"}, map[string]any{"Base": basePort, "Symbol": internal.Symbol("✅ ", ""), "App": set.AppPort, "Postgres": set.PostgresPort, "Neo4j": set.Neo4jBoltPort}))
 		} else {
-			fmt.Printf("  Base %d: ❌ CONFLICTS -%s\n", basePort, conflicts)
+			fmt.Println(internal.Localize(&i18n.Message{ID: "DebugBaseConflicts", Other: "  Base {{.Base}}: {{.Symbol}}CONFLICTS - {{.Conflicts}}"}, map[string]any{"Base": basePort, "Symbol": internal.Symbol("❌ ", ""), "Conflicts": strings.Join(set.Conflicts, " ")}))
 		}
 	}
 
 	fmt.Println()
 	internal.Log.Info("Next available base port:")
-	nextPort, err := internal.FindAvailablePortSet(8080)
+	nextPorts, err := internal.FindAvailablePortSet(scheme, "")
 	if err != nil {
 		return fmt.Errorf("failed to find available port: %v", err)
 	}
 	
-	fmt.Printf("  Recommended base port: %d\n", nextPort)
-	fmt.Println("  Ports that will be used:")
-	fmt.Printf("    - MCP Server: %d\n", nextPort)
-	fmt.Printf("    - PostgreSQL: %d\n", nextPort+100)
-	fmt.Printf("    - Neo4j Bolt: %d\n", nextPort+200)
+	fmt.Println(internal.Localize(&i18n.Message{ID: "DebugRecommendedPorts", Other: "  Recommended base port: {{.App}}\n  Ports that will be used:\n    - MCP Server: {{.App}}\n    - PostgreSQL: {{.Postgres}}\n    - Neo4j Bolt: {{.Neo4j}}"}, map[string]any{"App": nextPorts.App, "Postgres": nextPorts.Postgres, "Neo4j": nextPorts.Neo4jBolt}))
 
 	return nil
 }
@@ -0,0 +1,428 @@
+package cmd
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"graphsense-cli/internal"
+
+	"github.com/nicksnyder/go-i18n/v2/i18n"
+	"github.com/spf13/cobra"
+)
+
+var (
+	rotateCoAPIKey        string
+	rotateAnthropicAPIKey string
+	rotateApply           bool
+	rotateYes             bool
+	setKeyNoValidate      bool
+)
+
+var keysCmd = &cobra.Command{
+	Use:   "keys",
+	Short: "Manage provider API keys",
+	Long: `Manage the provider API keys instances are deployed with, CO_API_KEY and ANTHROPIC_API_KEY.
+
+Keys are stored in the OS keyring: the macOS Keychain, the Secret Service (GNOME Keyring,
+KWallet) on Linux or the Windows Credential Manager. Where no keyring is available they are
+kept in ~/.graphsense/.env, which is also read for keys the keyring does not hold. Keys are
+mounted into the app container as compose secrets at /run/secrets/<key>, with <key>_FILE
+naming the file, so they are neither written to disk nor shown by docker inspect.`,
+}
+
+var keysSetCmd = &cobra.Command{
+	Use:   "set <key> [value]",
+	Short: "Store an API key in the OS keyring",
+	Long: `Store an API key in the OS keyring and remove any clear-text copy from ~/.graphsense/.env.
+Without a value it is read from stdin, which keeps it out of the shell history.
+
+The key is checked with its provider first and not stored if the provider refuses it. If
+the provider cannot be reached, it is stored anyway; --no-validate skips the check.
+
+Running instances keep their old key until 'keys rotate --apply'.`,
+	Example: `  graphsense-cli keys set CO_API_KEY
+  pass show cohere | graphsense-cli keys set CO_API_KEY`,
+	Args: cobra.RangeArgs(1, 2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		var value string
+		if len(args) > 1 {
+			value = args[1]
+		}
+		return setKey(args[0], value)
+	},
+}
+
+var keysGetCmd = &cobra.Command{
+	Use:   "get <key>",
+	Short: "Print an API key",
+	Long:  `Print an API key from the OS keyring, or from ~/.graphsense/.env if the keyring does not hold it.`,
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return getKey(args[0])
+	},
+}
+
+var keysShowCmd = &cobra.Command{
+	Use:   "show",
+	Short: "Show which API keys are stored and where",
+	Long: `Show every API key with where it is read from, the OS keyring or ~/.graphsense/.env,
+and its first and last characters. Use 'keys get' to print a whole key.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return showKeys()
+	},
+}
+
+var keysValidateCmd = &cobra.Command{
+	Use:   "validate [key...]",
+	Short: "Check the stored API keys with their providers",
+	Long: `Check that the stored API keys are set and well-formed, and ask Cohere and Anthropic
+whether they accept them. The checks spend no quota. Without key names every key is
+checked; the command fails if any key is missing, malformed or refused.`,
+	ValidArgs: internal.APIKeyNames,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return validateKeys(args)
+	},
+}
+
+var keysDeleteCmd = &cobra.Command{
+	Use:   "delete <key>",
+	Short: "Remove an API key from the OS keyring",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return deleteKey(args[0])
+	},
+}
+
+var keysRotateCmd = &cobra.Command{
+	Use:   "rotate [instance_name...]",
+	Short: "Replace API keys and propagate them to running instances",
+	Long: `Replace provider API keys in the OS keyring, or ~/.graphsense/.env without one.
+
+With --apply the keys in the store are pushed to running instances by recreating only
+their app containers; databases and volumes are left untouched, so no data is lost.
+Without instance names every running instance is updated. --apply without new keys
+propagates the keys already in the store, e.g. after editing the file by hand.
+
+The configuration change of every instance is shown before it is applied and needs
+confirmation, unless --yes is given.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return rotateKeys(args)
+	},
+}
+
+func init() {
+	keysRotateCmd.Flags().StringVar(&rotateCoAPIKey, "co-api-key", "", "New Cohere API key")
+	keysRotateCmd.Flags().StringVar(&rotateAnthropicAPIKey, "anthropic-api-key", "", "New Anthropic API key")
+	keysRotateCmd.Flags().BoolVar(&rotateApply, "apply", false, "Restart the app containers of running instances with the new keys")
+	keysRotateCmd.Flags().BoolVarP(&rotateYes, "yes", "y", false, "Apply configuration changes without asking for confirmation")
+
+	keysSetCmd.Flags().BoolVar(&setKeyNoValidate, "no-validate", false, "Store the key without checking it with its provider")
+	addOutputFlag(keysShowCmd)
+	addOutputFlag(keysValidateCmd)
+
+	keysCmd.AddCommand(keysRotateCmd)
+	keysCmd.AddCommand(keysSetCmd)
+	keysCmd.AddCommand(keysGetCmd)
+	keysCmd.AddCommand(keysShowCmd)
+	keysCmd.AddCommand(keysValidateCmd)
+	keysCmd.AddCommand(keysDeleteCmd)
+}
+
+func setKey(name, value string) error {
+	name, err := internal.ParseAPIKeyName(name)
+	if err != nil {
+		return err
+	}
+	if value == "" {
+		if isTerminal(os.Stdin) {
+			fmt.Fprintf(os.Stderr, "%s: ", name)
+		}
+		line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+		if err != nil && line == "" {
+			return fmt.Errorf("failed to read %s from stdin: %v", name, err)
+		}
+		value = strings.TrimSpace(line)
+	}
+	if value == "" {
+		return fmt.Errorf("%s must not be empty", name)
+	}
+	if setKeyNoValidate {
+		if err := internal.CheckAPIKeyFormat(name, value); err != nil {
+			return err
+		}
+	} else if err := internal.ValidateAPIKey(context.Background(), name, value); errors.Is(err, internal.ErrProviderUnreachable) {
+		internal.Log.Warning("Could not validate the key, storing it anyway", "key", name, "error", err)
+	} else if err != nil {
+		return err
+	}
+
+	store, err := internal.StoreAPIKeys(map[string]string{name: value})
+	if err != nil {
+		return err
+	}
+	internal.Log.Success("API key stored", "key", name, "store", store)
+	return nil
+}
+
+func getKey(name string) error {
+	name, err := internal.ParseAPIKeyName(name)
+	if err != nil {
+		return err
+	}
+	coAPIKey, anthropicAPIKey, err := internal.LoadAPIKeys()
+	if err != nil {
+		return err
+	}
+	value := coAPIKey
+	if name == internal.AnthropicAPIKeyName {
+		value = anthropicAPIKey
+	}
+	if value == "" {
+		return fmt.Errorf("%s is not set", name)
+	}
+	fmt.Println(value)
+	return nil
+}
+
+// keyValidation is the result of checking one API key
+type keyValidation struct {
+	Name   string `json:"name" yaml:"name"`
+	Status string `json:"status" yaml:"status"`
+	Detail string `json:"detail,omitempty" yaml:"detail,omitempty"`
+}
+
+func showKeys() error {
+	structured, err := structuredOutput()
+	if err != nil {
+		return err
+	}
+	stored, err := internal.StoredAPIKeys()
+	if err != nil {
+		return err
+	}
+	if structured {
+		return printStructured(stored)
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 3, ' ', 0)
+	fmt.Fprintln(w, internal.Localize(&i18n.Message{ID: "KeysTableHeader", Other: "KEY\tSTORED IN\tVALUE"}, nil))
+	for _, key := range stored {
+		location := internal.Localize(&i18n.Message{ID: "KeyNotSet", Other: "not set"}, nil)
+		switch key.Source {
+		case internal.APIKeySourceKeyring:
+			location = internal.Localize(&i18n.Message{ID: "KeyInKeyring", Other: "OS keyring"}, nil)
+		case internal.APIKeySourceFile:
+			location = "~/.graphsense/.env"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\n", key.Name, location, maskKey(key.Value))
+	}
+	return w.Flush()
+}
+
+// maskKey shows only the first and last characters of an API key
+func maskKey(value string) string {
+	switch {
+	case value == "":
+		return "-"
+	case len(value) < 16:
+		return "********"
+	default:
+		return value[:4] + "..." + value[len(value)-4:]
+	}
+}
+
+func validateKeys(names []string) error {
+	structured, err := structuredOutput()
+	if err != nil {
+		return err
+	}
+	if len(names) == 0 {
+		names = internal.APIKeyNames
+	}
+	for i, name := range names {
+		if names[i], err = internal.ParseAPIKeyName(name); err != nil {
+			return err
+		}
+	}
+
+	stored, err := internal.StoredAPIKeys()
+	if err != nil {
+		return err
+	}
+	values := make(map[string]string)
+	for _, key := range stored {
+		values[key.Name] = key.Value
+	}
+
+	var results []keyValidation
+	failed := 0
+	for _, name := range names {
+		result := keyValidation{Name: name, Status: internal.CheckPass}
+		err := internal.ValidateAPIKey(context.Background(), name, values[name])
+		switch {
+		case err == nil:
+			result.Detail = "accepted by " + internal.APIKeyProvider(name)
+		case errors.Is(err, internal.ErrProviderUnreachable):
+			result.Status = internal.CheckWarn
+			result.Detail = err.Error()
+		default:
+			result.Status = internal.CheckFail
+			result.Detail = err.Error()
+			failed++
+		}
+		results = append(results, result)
+	}
+
+	if structured {
+		if err := printStructured(results); err != nil {
+			return err
+		}
+	} else {
+		for _, result := range results {
+			switch result.Status {
+			case internal.CheckPass:
+				internal.Log.Success("API key valid", "key", result.Name, "detail", result.Detail)
+			case internal.CheckWarn:
+				internal.Log.Warning("API key could not be checked", "key", result.Name, "detail", result.Detail)
+			default:
+				internal.Log.Error("API key invalid", "key", result.Name, "detail", result.Detail)
+			}
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d API keys failed validation", failed, len(results))
+	}
+	return nil
+}
+
+func deleteKey(name string) error {
+	name, err := internal.ParseAPIKeyName(name)
+	if err != nil {
+		return err
+	}
+	if err := internal.KeyringDelete(name); err != nil {
+		if errors.Is(err, internal.ErrKeyNotFound) {
+			return fmt.Errorf("%s is not in the OS keyring", name)
+		}
+		return err
+	}
+	internal.Log.Success("API key removed from the OS keyring", "key", name)
+	return nil
+}
+
+func rotateKeys(instanceNames []string) error {
+	keys := make(map[string]string)
+	if rotateCoAPIKey != "" {
+		keys[internal.CoAPIKeyName] = rotateCoAPIKey
+	}
+	if rotateAnthropicAPIKey != "" {
+		keys[internal.AnthropicAPIKeyName] = rotateAnthropicAPIKey
+	}
+
+	if len(keys) == 0 && !rotateApply {
+		return fmt.Errorf("nothing to do: pass --co-api-key and/or --anthropic-api-key, or --apply")
+	}
+	if len(instanceNames) > 0 && !rotateApply {
+		return fmt.Errorf("instance names require --apply")
+	}
+
+	if len(keys) > 0 {
+		store, err := internal.StoreAPIKeys(keys)
+		if err != nil {
+			return err
+		}
+		internal.Log.Success("API keys updated", "keys", len(keys), "store", store)
+	}
+
+	if !rotateApply {
+		internal.Log.Info("Run 'graphsense-cli keys rotate --apply' to push the new keys to running instances")
+		return nil
+	}
+
+	return applyKeys(instanceNames)
+}
+
+// applyKeys recreates the app containers of running instances with the keys from the store
+func applyKeys(instanceNames []string) error {
+	coAPIKey, anthropicAPIKey, err := internal.LoadAPIKeys()
+	if err != nil {
+		return fmt.Errorf("failed to load API keys: %v", err)
+	}
+
+	explicit := len(instanceNames) > 0
+	if !explicit {
+		instanceNames, err = internal.GetGraphsenseProjects()
+		if err != nil {
+			return fmt.Errorf("failed to list instances: %v", err)
+		}
+	}
+
+	var failed []string
+	for _, instanceName := range instanceNames {
+		if !applyInstanceKeys(instanceName, coAPIKey, anthropicAPIKey, explicit) {
+			failed = append(failed, instanceName)
+		}
+	}
+
+	if len(failed) > 0 {
+		return fmt.Errorf("failed to apply keys to %d instance(s): %v", len(failed), failed)
+	}
+	return nil
+}
+
+// applyInstanceKeys recreates the app container of an instance with the keys, if it is
+// running, holding the instance's lock so that no other command changes it meanwhile. It
+// reports failures and returns whether the instance is left as asked.
+func applyInstanceKeys(instanceName, coAPIKey, anthropicAPIKey string, explicit bool) bool {
+	release, err := internal.LockInstance(instanceName)
+	if err != nil {
+		internal.Log.Error("Failed to apply keys", "instance", instanceName, "error", err)
+		return false
+	}
+	defer release()
+
+	running, err := internal.AppRunning(instanceName)
+	if err != nil {
+		internal.Log.Error("Failed to check instance", "instance", instanceName, "error", err)
+		return false
+	}
+	if !running {
+		// Stopped instances read the store when they are next deployed or upgraded
+		if explicit {
+			internal.Log.Warning("Instance is not running, skipping", "instance", instanceName)
+		}
+		return true
+	}
+
+	config, err := internal.GetInstanceConfig(instanceName)
+	if err != nil {
+		internal.Log.Error("Failed to load instance configuration", "instance", instanceName, "error", err)
+		return false
+	}
+	config.CoAPIKey = coAPIKey
+	config.AnthropicAPIKey = anthropicAPIKey
+
+	proceed, err := reviewConfigChanges(config, rotateYes)
+	if err != nil {
+		internal.Log.Error("Failed to review configuration changes", "instance", instanceName, "error", err)
+		return false
+	}
+	if !proceed {
+		internal.Log.Info("Skipped", "instance", instanceName)
+		return true
+	}
+
+	internal.Log.Info("Restarting app with new keys", "instance", instanceName)
+	if err := internal.RecreateApp(config); err != nil {
+		internal.Log.Error("Failed to apply keys", "instance", instanceName, "error", err)
+		return false
+	}
+	internal.Log.Success("Keys applied", "instance", instanceName)
+	return true
+}
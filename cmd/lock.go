@@ -0,0 +1,31 @@
+package cmd
+
+import (
+	"strings"
+
+	"graphsense-cli/internal"
+
+	"github.com/spf13/cobra"
+)
+
+// machineWideCommands act on every instance or on Docker as a whole, by their path below the
+// root. They hold the global lock exclusively, so they wait for operations on single instances
+// to finish and keep new ones from starting. Commands changing one instance lock it instead.
+var machineWideCommands = map[string]bool{
+	"uninstall":      true,
+	"cleanup":        true,
+	"reconcile":      true,
+	"migrate-legacy": true,
+}
+
+// lockMachine acquires the global lock for machine-wide commands. It is held until the
+// process exits.
+func lockMachine(cmd *cobra.Command) error {
+	path := strings.TrimPrefix(strings.TrimPrefix(cmd.CommandPath(), cmd.Root().Name()), " ")
+	internal.LockOwner = cmd.CommandPath()
+	if !machineWideCommands[path] {
+		return nil
+	}
+	_, err := internal.LockGlobal()
+	return err
+}
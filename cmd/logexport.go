@@ -0,0 +1,98 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"syscall"
+
+	"graphsense-cli/internal"
+)
+
+var (
+	logsExport   string
+	logsMirror   bool
+	logsMaxSize  string
+	logsMaxFiles int
+)
+
+func init() {
+	logsCmd.Flags().StringVar(&logsExport, "export", "", "Write the logs of every service to files in this directory")
+	logsCmd.Flags().BoolVar(&logsMirror, "mirror", false, "Keep appending to the exported files until interrupted")
+	logsCmd.Flags().StringVar(&logsMaxSize, "max-size", "10MB", "Size at which mirrored log files are rotated")
+	logsCmd.Flags().IntVar(&logsMaxFiles, "max-files", internal.DefaultLogExportMaxFiles, "Number of files kept per service, including the current one")
+}
+
+// exportLogs snapshots or mirrors the logs of an instance's services to files
+func exportLogs(instanceName, service string) error {
+	if !internal.InstanceExists(instanceName) {
+		return fmt.Errorf("instance '%s' does not exist", instanceName)
+	}
+	if logsMaxFiles < 1 {
+		return fmt.Errorf("--max-files must be at least 1")
+	}
+	maxSize, err := internal.ParseSize(logsMaxSize)
+	if err != nil {
+		return err
+	}
+	if _, err := logOptions(); err != nil {
+		return err
+	}
+
+	dir, err := filepath.Abs(logsExport)
+	if err != nil {
+		return fmt.Errorf("failed to get absolute path: %v", err)
+	}
+	options := internal.LogExportOptions{
+		Dir:        dir,
+		Since:      logsSince,
+		Tail:       logsTail,
+		Timestamps: logsTimestamps,
+		MaxSize:    maxSize,
+		MaxFiles:   logsMaxFiles,
+	}
+
+	sources, err := internal.GetLogSources([]string{instanceName})
+	if err != nil {
+		return err
+	}
+	if service != "" {
+		var selected []internal.LogSource
+		for _, source := range sources {
+			if source.Service == service {
+				selected = append(selected, source)
+			}
+		}
+		if len(selected) == 0 {
+			return fmt.Errorf("instance '%s' has no '%s' service", instanceName, service)
+		}
+		sources = selected
+	}
+	if len(sources) == 0 {
+		return fmt.Errorf("instance '%s' has no containers", instanceName)
+	}
+
+	if !logsMirror {
+		files, err := internal.ExportLogs(context.Background(), sources, options)
+		for _, file := range files {
+			fmt.Println(file)
+		}
+		if err != nil {
+			return err
+		}
+		internal.Log.Success("Logs exported", "instance", instanceName, "dir", filepath.Join(dir, instanceName))
+		return nil
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	internal.Log.Info("Mirroring logs, press Ctrl+C to stop", "instance", instanceName, "dir", filepath.Join(dir, instanceName))
+	if err := internal.MirrorLogs(ctx, sources, options); err != nil {
+		return err
+	}
+	internal.Log.Info("Stopped mirroring logs", "instance", instanceName)
+	return nil
+}
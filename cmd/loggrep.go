@@ -0,0 +1,92 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"time"
+
+	"graphsense-cli/internal"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	grepInstances  []string
+	grepSince      time.Duration
+	grepIgnoreCase bool
+)
+
+var logsGrepCmd = &cobra.Command{
+	Use:   "grep <pattern>",
+	Short: "Search the logs of several instances",
+	Long: `Search the container logs of every instance, or of the instances given with --instances,
+for a regular expression. Logs are searched concurrently and matching lines are printed with
+the instance and service they came from.`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return grepLogs(args[0])
+	},
+}
+
+func init() {
+	logsGrepCmd.Flags().StringSliceVar(&grepInstances, "instances", nil, "Comma-separated instances to search (default: all)")
+	logsGrepCmd.Flags().DurationVar(&grepSince, "since", 24*time.Hour, "Only search log lines from this long ago")
+	logsGrepCmd.Flags().BoolVarP(&grepIgnoreCase, "ignore-case", "i", false, "Match the pattern case-insensitively")
+	addOutputFlag(logsGrepCmd)
+	logsGrepCmd.RegisterFlagCompletionFunc("instances", completeInstanceNamesRepeated)
+
+	logsCmd.AddCommand(logsGrepCmd)
+}
+
+func grepLogs(expr string) error {
+	structured, err := structuredOutput()
+	if err != nil {
+		return err
+	}
+
+	if grepIgnoreCase {
+		expr = "(?i)" + expr
+	}
+	pattern, err := regexp.Compile(expr)
+	if err != nil {
+		return fmt.Errorf("invalid pattern: %v", err)
+	}
+
+	instanceNames := grepInstances
+	if len(instanceNames) == 0 {
+		instanceNames, err = internal.GetGraphsenseProjects()
+		if err != nil {
+			return fmt.Errorf("failed to list instances: %v", err)
+		}
+	} else {
+		for _, instanceName := range instanceNames {
+			if !internal.InstanceExists(instanceName) {
+				return fmt.Errorf("instance '%s' does not exist", instanceName)
+			}
+		}
+	}
+
+	sources, err := internal.GetLogSources(instanceNames)
+	if err != nil {
+		return err
+	}
+
+	matches, failures := internal.GrepLogs(context.Background(), sources, pattern, grepSince)
+	for _, err := range failures {
+		internal.Log.Warning("Skipped container", "error", err)
+	}
+
+	if structured {
+		if matches == nil {
+			matches = []internal.LogMatch{}
+		}
+		return printStructured(matches)
+	}
+
+	for _, match := range matches {
+		fmt.Printf("%s %s\n", internal.Colorize(internal.ColorCyan, match.Instance+"/"+match.Service), match.Line)
+	}
+	internal.Log.Info("Search finished", "matches", len(matches), "containers", len(sources))
+	return nil
+}
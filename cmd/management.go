@@ -2,139 +2,483 @@ package cmd
 
 import (
 	"bufio"
+	"context"
 	"fmt"
 	"os"
 	"strings"
 
 	"graphsense-cli/internal"
 
+	"github.com/nicksnyder/go-i18n/v2/i18n"
 	"github.com/spf13/cobra"
 )
 
 var stopCmd = &cobra.Command{
-	Use:   "stop <instance_name>",
-	Short: "Stop a GraphSense instance",
-	Long:  "Stop a running GraphSense instance without removing it.",
-	Args:  cobra.ExactArgs(1),
+	Use:   "stop <instance_name>... | --all",
+	Short: "Stop GraphSense instances",
+	Long:  "Stop running GraphSense instances without removing them.",
+	Args:  bulkArgs,
 	RunE: func(cmd *cobra.Command, args []string) error {
-		return stopInstance(args[0])
+		names, err := resolveInstances(args)
+		if err != nil {
+			return err
+		}
+		return runBulk(names, stopInstance)
 	},
 }
 
 var startCmd = &cobra.Command{
-	Use:   "start <instance_name>",
-	Short: "Start a GraphSense instance",
-	Long:  "Start a stopped GraphSense instance.",
-	Args:  cobra.ExactArgs(1),
+	Use:   "start <instance_name>... | --all",
+	Short: "Start GraphSense instances",
+	Long:  "Start stopped GraphSense instances.",
+	Args:  bulkArgs,
 	RunE: func(cmd *cobra.Command, args []string) error {
-		return startInstance(args[0])
+		names, err := resolveInstances(args)
+		if err != nil {
+			return err
+		}
+		return runBulk(names, startInstance)
 	},
 }
 
 var removeCmd = &cobra.Command{
-	Use:   "remove <instance_name>",
-	Short: "Remove a GraphSense instance",
-	Long:  "Permanently remove a GraphSense instance and all its data.",
-	Args:  cobra.ExactArgs(1),
+	Use:   "remove <instance_name>... | --all",
+	Short: "Remove GraphSense instances",
+	Long: `Permanently remove GraphSense instances and all their data.
+
+With --keep-data only the containers and networks are removed. The named volumes holding
+the databases are kept, so deploying again with the same instance name reuses the indexed
+data instead of reindexing.
+
+The other scopes remove only part of an instance:
+
+  --containers-only  remove the containers and networks but keep the data volumes and the
+                     definition in instances.db; 'deploy --resume' brings the instance back
+  --data-only        remove the containers and data volumes but keep the definition, so
+                     'deploy --resume' deploys the instance again with empty databases
+  --config-only      forget an instance whose containers were already removed with docker
+                     commands, without touching Docker. Its reserved ports and repository
+                     clone are released; its database credentials are kept if data volumes
+                     are left
+
+Scripts the repository declares under scripts.pre_remove in its .graphsense.yaml run
+before anything is removed, and a failing script stops the removal. --skip-scripts
+removes the instance without running them. --config-only never runs them.`,
+	Example: `  graphsense-cli remove my-analysis
+  graphsense-cli remove my-analysis --containers-only
+  graphsense-cli remove my-analysis --data-only && graphsense-cli deploy --resume my-analysis
+  graphsense-cli remove my-analysis --config-only`,
+	Args: bulkArgs,
 	RunE: func(cmd *cobra.Command, args []string) error {
-		return removeInstance(args[0])
+		scope := selectedRemoveScope()
+		var names []string
+		var err error
+		if scope == removeConfig {
+			// The instances have no containers left to resolve names from
+			names, err = resolveRecordedInstances(args)
+		} else {
+			names, err = resolveInstances(args)
+		}
+		if err != nil {
+			return err
+		}
+		if len(names) == 1 {
+			return removeInstance(names[0], removeYes, scope, !removeSkipScripts)
+		}
+
+		// Ask once for the whole batch rather than once per instance
+		if !removeYes {
+			internal.Log.Warning(scope.warning(), "instances", strings.Join(names, ", "))
+			if !confirm(internal.Localize(areYouSure, nil)) {
+				internal.Log.Info("Cancelled.")
+				return nil
+			}
+		}
+		return runBulk(names, func(instanceName string) error {
+			return removeInstance(instanceName, true, scope, !removeSkipScripts)
+		})
 	},
 }
 
+var (
+	removeYes            bool
+	removeKeepData       bool
+	removeContainersOnly bool
+	removeDataOnly       bool
+	removeConfigOnly     bool
+	removeSkipScripts    bool
+)
+
+// removeScope selects what remove deletes of an instance
+type removeScope int
+
+const (
+	// removeEverything deletes the containers, data and definition of an instance
+	removeEverything removeScope = iota
+	// removeKeepVolumes deletes the containers and definition but keeps the data volumes
+	removeKeepVolumes
+	// removeContainers deletes the containers and networks only
+	removeContainers
+	// removeData deletes the containers and data volumes but keeps the definition
+	removeData
+	// removeConfig deletes the definition only, leaving Docker alone
+	removeConfig
+)
+
+// selectedRemoveScope returns the scope chosen with remove's flags
+func selectedRemoveScope() removeScope {
+	switch {
+	case removeKeepData:
+		return removeKeepVolumes
+	case removeContainersOnly:
+		return removeContainers
+	case removeDataOnly:
+		return removeData
+	case removeConfigOnly:
+		return removeConfig
+	}
+	return removeEverything
+}
+
+// removeScopeFor is the scope of a removal requested with only a keep-data option, as the
+// API and MCP server offer
+func removeScopeFor(keepData bool) removeScope {
+	if keepData {
+		return removeKeepVolumes
+	}
+	return removeEverything
+}
+
+// keepsVolumes reports whether the data volumes survive the removal
+func (s removeScope) keepsVolumes() bool {
+	return s == removeKeepVolumes || s == removeContainers || s == removeConfig
+}
+
+// keepsDefinition reports whether the instance stays recorded in instances.db
+func (s removeScope) keepsDefinition() bool {
+	return s == removeContainers || s == removeData
+}
+
+// warning describes what removing instances with the scope deletes, for the confirmation prompt.
+// The instances go in the record's fields.
+func (s removeScope) warning() string {
+	switch s {
+	case removeKeepVolumes:
+		return internal.LogMessage("This will remove the containers. The data volumes are kept.")
+	case removeContainers:
+		return internal.LogMessage("This will remove the containers. The data volumes and definition are kept.")
+	case removeData:
+		return internal.LogMessage("This will permanently delete the containers and data. The definition is kept for redeploying.")
+	case removeConfig:
+		return internal.LogMessage("This will forget the instance in instances.db. Nothing is removed from Docker.")
+	}
+	return internal.LogMessage("This will permanently remove the instance and all its data.")
+}
+
+func init() {
+	removeCmd.Flags().BoolVarP(&removeYes, "yes", "y", false, "Remove without asking for confirmation")
+	removeCmd.Flags().BoolVar(&removeKeepData, "keep-data", false, "Keep the instance's data volumes")
+	removeCmd.Flags().BoolVar(&removeContainersOnly, "containers-only", false, "Remove only the containers, keeping the data volumes and the definition")
+	removeCmd.Flags().BoolVar(&removeDataOnly, "data-only", false, "Remove the containers and data volumes, keeping the definition for redeploying")
+	removeCmd.Flags().BoolVar(&removeConfigOnly, "config-only", false, "Only forget an instance whose containers were already removed")
+	removeCmd.Flags().BoolVar(&removeSkipScripts, "skip-scripts", false, "Do not run the repository's pre_remove scripts")
+	removeCmd.MarkFlagsMutuallyExclusive("keep-data", "containers-only", "data-only", "config-only")
+
+	addBulkFlags(stopCmd)
+	addBulkFlags(startCmd)
+	addBulkFlags(removeCmd)
+}
+
 func stopInstance(instanceName string) error {
+	release, err := internal.LockInstance(instanceName)
+	if err != nil {
+		return err
+	}
+	defer release()
+
 	if !internal.InstanceExists(instanceName) {
 		return fmt.Errorf("instance '%s' does not exist", instanceName)
 	}
 
-	internal.Log.Info(fmt.Sprintf("Stopping instance: %s", instanceName))
+	internal.Log.Info("Stopping instance", "instance", instanceName)
 
-	envVars := map[string]string{
-		"COMPOSE_PROJECT_NAME": instanceName,
+	docker, err := internal.GetDockerClient()
+	if err != nil {
+		return err
 	}
 
-	// Find the docker-compose.yml in any existing container for this instance
-	// We'll use docker-compose without specifying -f since the project name is set
-	err := internal.RunDockerCompose([]string{
-		"stop",
-	}, envVars)
-	if err != nil {
+	if err := docker.StopProject(context.Background(), instanceName); err != nil {
 		return fmt.Errorf("failed to stop instance %s: %v", instanceName, err)
 	}
 
-	internal.Log.Success(fmt.Sprintf("Instance '%s' stopped.", instanceName))
+	// Keep status --repair from starting the instance again
+	if err := internal.SetInstanceStopped(instanceName, true); err != nil {
+		internal.Log.Warning("Failed to record instance state", "error", err)
+	}
+
+	internal.Log.Success("Instance stopped", "instance", instanceName)
 	return nil
 }
 
 func startInstance(instanceName string) error {
+	release, err := internal.LockInstance(instanceName)
+	if err != nil {
+		return err
+	}
+	defer release()
+
 	if !internal.InstanceExists(instanceName) {
 		return fmt.Errorf("instance '%s' does not exist", instanceName)
 	}
 
-	internal.Log.Info(fmt.Sprintf("Starting instance: %s", instanceName))
+	internal.Log.Info("Starting instance", "instance", instanceName)
 
-	envVars := map[string]string{
-		"COMPOSE_PROJECT_NAME": instanceName,
+	docker, err := internal.GetDockerClient()
+	if err != nil {
+		return err
 	}
 
-	// Use docker-compose without specifying -f since the project name is set
-	err := internal.RunDockerCompose([]string{
-		"start",
-	}, envVars)
-	if err != nil {
+	if err := docker.StartProject(context.Background(), instanceName); err != nil {
 		return fmt.Errorf("failed to start instance %s: %v", instanceName, err)
 	}
 
-	internal.Log.Success(fmt.Sprintf("Instance '%s' started.", instanceName))
+	if err := internal.TouchInstance(instanceName, "started"); err != nil {
+		internal.Log.Warning("Failed to record activity", "error", err)
+	}
+	if err := internal.SetInstanceStopped(instanceName, false); err != nil {
+		internal.Log.Warning("Failed to record instance state", "error", err)
+	}
+	if config, err := internal.GetInstanceConfig(instanceName); err == nil {
+		internal.RecordIndexedCommit(config)
+	}
+
+	internal.Log.Success("Instance started", "instance", instanceName)
 	return nil
 }
 
-func removeInstance(instanceName string) error {
+func removeInstance(instanceName string, yes bool, scope removeScope, runScripts bool) error {
+	release, err := internal.LockInstance(instanceName)
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	if scope == removeConfig {
+		return forgetInstance(instanceName, yes)
+	}
 	if !internal.InstanceExists(instanceName) {
 		return fmt.Errorf("instance '%s' does not exist", instanceName)
 	}
 
-	internal.Log.Warning(fmt.Sprintf("This will permanently remove instance '%s' and all its data.", instanceName))
-	fmt.Print("Are you sure? (y/N): ")
-	
-	reader := bufio.NewReader(os.Stdin)
-	response, err := reader.ReadString('\n')
-	if err != nil {
+	// Refuse to tear down a compose project that graphsense-cli did not create
+	if foreign, err := internal.IsForeignProject(instanceName); err != nil {
 		return err
+	} else if foreign {
+		return fmt.Errorf("compose project '%s' contains containers not created by graphsense-cli, refusing to remove it", instanceName)
 	}
 
-	response = strings.TrimSpace(strings.ToLower(response))
-	if response != "y" && response != "yes" {
-		internal.Log.Info("Cancelled.")
-		return nil
+	// The definition is read while the containers it may be reconstructed from still exist
+	var kept *internal.DeployConfig
+	if scope.keepsDefinition() {
+		var err error
+		if kept, err = internal.GetInstanceConfig(instanceName); err != nil {
+			return fmt.Errorf("cannot keep the definition of '%s': %v", instanceName, err)
+		}
 	}
 
-	internal.Log.Info(fmt.Sprintf("Removing instance: %s", instanceName))
+	if !yes {
+		internal.Log.Warning(scope.warning(), "instance", instanceName)
+		if !confirm(internal.Localize(areYouSure, nil)) {
+			internal.Log.Info("Cancelled.")
+			return nil
+		}
+	}
+
+	if runScripts {
+		if config, err := internal.GetInstanceConfig(instanceName); err != nil {
+			internal.Log.Warning("Could not load instance configuration, skipping pre_remove scripts", "error", err)
+		} else {
+			// Only a removal that asked for confirmation can ask about the scripts too
+			config.AllowHostScripts, err = approveHostScripts(config.RepoPath, config.IsManagedRepo(), !yes, internal.HookPreRemove)
+			if err == nil {
+				err = internal.RunLifecycleScripts(context.Background(), config, internal.HookPreRemove)
+			}
+			if err != nil {
+				return fmt.Errorf("%v. Use --skip-scripts to remove the instance anyway", err)
+			}
+		}
+	}
+
+	internal.Log.Info("Removing instance", "instance", instanceName)
 
 	envVars := map[string]string{
 		"COMPOSE_PROJECT_NAME": instanceName,
 	}
 
+	// The notebook container is not part of the compose project but holds on to its network
+	if err := internal.RemoveNotebook(instanceName); err != nil {
+		internal.Log.Warning("Failed to remove notebook container", "error", err)
+	}
+
 	// Stop and remove containers
-	err = internal.RunDockerCompose([]string{
-		"down", "-v", "--remove-orphans",
-	}, envVars)
+	downArgs := []string{"down", "--remove-orphans"}
+	if !scope.keepsVolumes() {
+		downArgs = append(downArgs, "-v")
+	}
+	err = internal.RunDockerCompose(downArgs, envVars)
 	if err != nil {
 		internal.Log.Warning("Failed to cleanly remove instance with docker-compose, trying manual cleanup...")
-		
-		// Manual cleanup as fallback
-		if err := internal.RunDockerCompose([]string{
-			"ps", "-a", "--filter", fmt.Sprintf("label=com.docker.compose.project=%s", instanceName), "-q",
-		}, nil); err == nil {
-			internal.RunDockerCompose([]string{"rm", "-f"}, nil)
+	}
+
+	docker, err := internal.GetDockerClient()
+	if err != nil {
+		return err
+	}
+	if scope.keepsVolumes() {
+		// Remove whatever compose left behind, but not the named volumes
+		internal.Log.Info("Removing associated containers and networks...")
+		err = docker.RemoveProjectContainers(context.Background(), instanceName)
+	} else {
+		// Remove whatever compose left behind, including the named volumes
+		internal.Log.Info("Removing associated containers, networks and volumes...")
+		err = docker.RemoveProject(context.Background(), instanceName)
+	}
+	if err != nil {
+		internal.Log.Warning("Manual cleanup incomplete", "error", err)
+	}
+
+	internal.UnregisterMCP(instanceName)
+
+	if scope.keepsDefinition() {
+		return keepDefinition(kept, scope)
+	}
+
+	// Keep the clone of a Git URL deploy and the database credentials along with the data so
+	// the instance can be deployed again
+	if !scope.keepsVolumes() {
+		if config, _, err := internal.GetDeployment(instanceName); err == nil && config != nil {
+			if err := internal.RemoveManagedRepo(config); err != nil {
+				internal.Log.Warning("Failed to remove repository clone", "error", err)
+			}
+			if err := internal.DeleteInstanceCredentials(instanceName, config.CredentialStore); err != nil {
+				internal.Log.Warning("Failed to delete database credentials", "error", err)
+			}
+		}
+	}
+
+	if err := internal.DeleteInstanceTLS(instanceName); err != nil {
+		internal.Log.Warning("Failed to delete TLS certificate", "error", err)
+	}
+	if err := internal.RemoveDeployment(instanceName); err != nil {
+		internal.Log.Warning("Failed to remove deployment record", "error", err)
+	}
+
+	syncProxyRoutes()
+	internal.Log.Success("Instance removed", "instance", instanceName)
+	if scope.keepsVolumes() {
+		internal.Log.Info("Data volumes kept; deploy again with the same instance name to reuse them", "instance", instanceName)
+	}
+	return nil
+}
+
+// keepDefinition records an instance whose containers remove deleted as removed, so that
+// deploy --resume deploys it again with its recorded configuration, ports and credentials
+func keepDefinition(config *internal.DeployConfig, scope removeScope) error {
+	instanceName := config.InstanceName
+	if err := internal.RemoveInstanceContainers(instanceName); err != nil {
+		internal.Log.Warning("Failed to remove container information", "error", err)
+	}
+	// Every stage runs again, since the containers they set up are gone
+	if err := internal.ClearCheckpoints(instanceName); err != nil {
+		return err
+	}
+	if err := internal.SaveDeployment(config, internal.DeployStatusRemoved); err != nil {
+		return err
+	}
+	syncProxyRoutes()
+
+	if scope == removeData {
+		internal.Log.Success("Instance containers and data removed", "instance", instanceName)
+	} else {
+		internal.Log.Success("Instance containers removed", "instance", instanceName)
+	}
+	internal.Log.Info("Definition kept. Run 'graphsense-cli deploy --resume' to deploy it again", "instance", instanceName)
+	return nil
+}
+
+// forgetInstance removes an instance from instances.db whose containers were already removed
+// with docker commands. Its reserved ports and repository clone are released; credentials are
+// kept while data volumes of the instance are left, as remove --keep-data keeps them.
+func forgetInstance(instanceName string, yes bool) error {
+	config, _, err := internal.GetDeployment(instanceName)
+	if err != nil {
+		return err
+	}
+	containers, err := internal.GetInstanceContainers(instanceName)
+	if err != nil {
+		return err
+	}
+	if config == nil && len(containers) == 0 {
+		return fmt.Errorf("instance '%s' is not recorded in instances.db", instanceName)
+	}
+	if internal.InstanceExists(instanceName) {
+		return fmt.Errorf("instance '%s' still has containers. Remove them with 'graphsense-cli remove %s' or '--containers-only'", instanceName, instanceName)
+	}
+
+	if !yes {
+		internal.Log.Warning(removeConfig.warning(), "instance", instanceName)
+		if !confirm(internal.Localize(areYouSure, nil)) {
+			internal.Log.Info("Cancelled.")
+			return nil
 		}
 	}
 
-	// Remove associated volumes
-	internal.Log.Info("Removing associated volumes...")
-	internal.RunDockerCompose([]string{
-		"volume", "ls", "-q", "|", "grep", fmt.Sprintf("^%s_", instanceName), "|", "xargs", "-r", "docker", "volume", "rm",
-	}, nil)
+	volumes, err := internal.InstanceVolumes(instanceName)
+	if err != nil {
+		return err
+	}
+	if config != nil {
+		if err := internal.RemoveManagedRepo(config); err != nil {
+			internal.Log.Warning("Failed to remove repository clone", "error", err)
+		}
+		if len(volumes) == 0 {
+			if err := internal.DeleteInstanceCredentials(instanceName, config.CredentialStore); err != nil {
+				internal.Log.Warning("Failed to delete database credentials", "error", err)
+			}
+		}
+	}
+	if err := internal.DeleteInstanceTLS(instanceName); err != nil {
+		internal.Log.Warning("Failed to delete TLS certificate", "error", err)
+	}
+	if err := internal.RemoveInstanceContainers(instanceName); err != nil {
+		internal.Log.Warning("Failed to remove container information", "error", err)
+	}
+	internal.UnregisterMCP(instanceName)
+	if err := internal.RemoveDeployment(instanceName); err != nil {
+		return err
+	}
 
-	internal.Log.Success(fmt.Sprintf("Instance '%s' removed.", instanceName))
+	syncProxyRoutes()
+	internal.Log.Success("Instance forgotten", "instance", instanceName)
+	if len(volumes) > 0 {
+		internal.Log.Info("Data volumes are left in Docker; deploy again with the same instance name to reuse them or remove them with 'docker volume rm'", "volumes", strings.Join(volumes, ", "))
+	}
 	return nil
 }
+
+// areYouSure is the question confirming a change that cannot be undone
+var areYouSure = &i18n.Message{ID: "AreYouSure", Other: "Are you sure? (y/N): "}
+
+// confirm asks a yes/no question on stdin, defaulting to no
+func confirm(prompt string) bool {
+	fmt.Print(prompt)
+
+	reader := bufio.NewReader(os.Stdin)
+	response, err := reader.ReadString('\n')
+	if err != nil {
+		return false
+	}
+
+	response = strings.TrimSpace(strings.ToLower(response))
+	return response == "y" || response == "yes"
+}
@@ -0,0 +1,96 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	"graphsense-cli/internal"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	mcpConfigClient string
+	mcpConfigWrite  bool
+	mcpConfigName   string
+	mcpConfigPath   string
+)
+
+var mcpConfigCmd = &cobra.Command{
+	Use:   "mcp-config <instance_name>",
+	Short: "Print or write the MCP client configuration for an instance",
+	Long: `Print the MCP server entry that connects a client to an instance, or with --write merge it
+into the client's config file, keeping the other servers and settings in it.
+
+Clients and the files --write updates:
+  claude-desktop  claude_desktop_config.json in Claude's settings directory. Claude Desktop
+                  only starts local servers, so the entry runs mcp-remote with npx.
+  cursor          ~/.cursor/mcp.json
+  vscode          .vscode/mcp.json in the current directory
+
+The entry is named after the instance unless --name says otherwise, and an entry of that name
+is replaced. --path writes to another file. For instances deployed with --tls the Claude
+Desktop entry trusts the instance's certificate; point the other clients at it yourself.`,
+	Example: `  graphsense-cli mcp-config my-analysis --client cursor
+  graphsense-cli mcp-config my-analysis --client claude-desktop --write
+  graphsense-cli mcp-config my-analysis --client vscode --write --name graphsense`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return mcpConfig(args[0])
+	},
+}
+
+func init() {
+	mcpConfigCmd.Flags().StringVar(&mcpConfigClient, "client", "", "MCP client to configure: "+strings.Join(internal.MCPClients, ", "))
+	mcpConfigCmd.Flags().BoolVar(&mcpConfigWrite, "write", false, "Merge the entry into the client's config file instead of printing it")
+	mcpConfigCmd.Flags().StringVar(&mcpConfigName, "name", "", "Name of the server entry (default: the instance name)")
+	mcpConfigCmd.Flags().StringVar(&mcpConfigPath, "path", "", "Config file to write with --write (default: the client's)")
+	mcpConfigCmd.MarkFlagRequired("client")
+	mcpConfigCmd.RegisterFlagCompletionFunc("client", func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+		return internal.MCPClients, cobra.ShellCompDirectiveNoFileComp
+	})
+}
+
+func mcpConfig(instanceName string) error {
+	if mcpConfigPath != "" && !mcpConfigWrite {
+		return fmt.Errorf("--path needs --write")
+	}
+	config, err := internal.GetInstanceConfig(instanceName)
+	if err != nil {
+		return err
+	}
+	name := mcpConfigName
+	if name == "" {
+		name = instanceName
+	}
+
+	if !mcpConfigWrite {
+		snippet, err := internal.MCPConfigSnippet(mcpConfigClient, name, config)
+		if err != nil {
+			return err
+		}
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(snippet)
+	}
+
+	path := mcpConfigPath
+	if path == "" {
+		if path, err = internal.MCPConfigPath(mcpConfigClient); err != nil {
+			return err
+		}
+	}
+	replaced, err := internal.MergeMCPConfig(path, mcpConfigClient, name, config)
+	if err != nil {
+		return err
+	}
+	if replaced {
+		internal.Log.Success("Updated MCP server", "instance", name, "config", path, "url", config.AppURL())
+	} else {
+		internal.Log.Success("Added MCP server", "instance", name, "config", path, "url", config.AppURL())
+	}
+	internal.Log.Info("Restart the client or reload its MCP servers to connect", "client", mcpConfigClient)
+	return nil
+}
@@ -0,0 +1,92 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"strconv"
+	"syscall"
+	"time"
+
+	"graphsense-cli/internal"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	metricsPort    int
+	metricsAddress string
+)
+
+var metricsCmd = &cobra.Command{
+	Use:   "metrics",
+	Short: "Export instance metrics",
+}
+
+var metricsServeCmd = &cobra.Command{
+	Use:   "serve",
+	Short: "Serve Prometheus metrics for all instances",
+	Long: `Serve per-instance metrics in the Prometheus text format on /metrics.
+
+Every scrape reads the current state from the Docker API: whether each instance and
+container is running, container restarts, CPU time and memory, the size of each named
+volume and the port of each MCP server. Runs until interrupted.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return serveMetrics(metricsAddress, metricsPort)
+	},
+}
+
+func init() {
+	metricsServeCmd.Flags().IntVar(&metricsPort, "port", internal.DefaultMetricsPort, "Port to serve metrics on")
+	metricsServeCmd.Flags().StringVar(&metricsAddress, "address", "127.0.0.1", "Address to listen on (0.0.0.0 for all interfaces)")
+	metricsCmd.AddCommand(metricsServeCmd)
+}
+
+func serveMetrics(address string, port int) error {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/metrics", func(w http.ResponseWriter, r *http.Request) {
+		// Collect into a buffer so a failed scrape returns an error instead of partial metrics
+		var body bytes.Buffer
+		if err := internal.WriteMetrics(r.Context(), &body); err != nil {
+			internal.Log.Error("Failed to collect metrics", "error", err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		w.Write(body.Bytes())
+	})
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/" {
+			http.NotFound(w, r)
+			return
+		}
+		fmt.Fprintln(w, "GraphSense metrics exporter. Metrics are served on /metrics.")
+	})
+
+	server := &http.Server{
+		Addr:              net.JoinHostPort(address, strconv.Itoa(port)),
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		server.Shutdown(shutdownCtx)
+	}()
+
+	internal.Log.Info("Serving metrics", "url", "http://"+server.Addr+"/metrics")
+	if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return fmt.Errorf("failed to serve metrics: %v", err)
+	}
+	return nil
+}
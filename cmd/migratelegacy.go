@@ -0,0 +1,105 @@
+package cmd
+
+import (
+	"fmt"
+	"sort"
+
+	"graphsense-cli/internal"
+
+	"github.com/nicksnyder/go-i18n/v2/i18n"
+	"github.com/spf13/cobra"
+)
+
+var migrateLegacyDryRun bool
+
+var migrateLegacyCmd = &cobra.Command{
+	Use:   "migrate-legacy",
+	Short: "Adopt deployments made before graphsense-cli managed them",
+	Long: `Find what older ways of deploying GraphSense left behind and bring it under the management
+of this CLI:
+
+  - GraphSense compose projects instances.db does not know whose containers have compose's
+    default names (<project>_<service>_1 or <project>-<service>-1) instead of
+    <instance>-<service>. Their containers are recreated with the current names and labels
+    and recorded in instances.db. Data in volumes that are not named <instance>_<volume> is
+    copied to volumes that are; the old volumes are kept until you remove them. Instances
+    that were stopped stay stopped.
+  - Env files in ~/.graphsense other than .env, which the deploy scripts wrote per instance.
+    API keys that are not stored yet are stored in the OS keyring, and the file is renamed
+    to <file>.migrated.
+
+Projects get an instance name starting with graphsense-, as the other commands expect.
+With --dry-run the artifacts are only printed.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return migrateLegacy(migrateLegacyDryRun)
+	},
+}
+
+func init() {
+	migrateLegacyCmd.Flags().BoolVar(&migrateLegacyDryRun, "dry-run", false, "Show what would be migrated without changing anything")
+	addOutputFlag(migrateLegacyCmd)
+}
+
+func migrateLegacy(dryRun bool) error {
+	structured, err := structuredOutput()
+	if err != nil {
+		return err
+	}
+
+	artifacts, err := internal.FindLegacyArtifacts()
+	if err != nil {
+		return fmt.Errorf("failed to look for legacy deployments: %v", err)
+	}
+	if !dryRun {
+		if err := internal.MigrateLegacy(artifacts); err != nil {
+			return err
+		}
+	}
+
+	if structured {
+		if artifacts == nil {
+			artifacts = []internal.LegacyArtifact{}
+		}
+		return printStructured(artifacts)
+	}
+
+	if len(artifacts) == 0 {
+		internal.Log.Success("No legacy deployments found")
+		return nil
+	}
+	var legacyVolumes []string
+	for _, artifact := range artifacts {
+		if artifact.Kind == internal.LegacyProject {
+			project := &i18n.Message{ID: "MigratedLegacyProject", Other: "  Migrated project {{.Project}} to {{.Instance}}: {{.Detail}}"}
+			if dryRun {
+				project = &i18n.Message{ID: "WouldMigrateLegacyProject", Other: "  Would migrate project {{.Project}} to {{.Instance}}: {{.Detail}}"}
+			}
+			fmt.Println(internal.Localize(project, map[string]any{"Project": artifact.Name, "Instance": artifact.Instance, "Detail": artifact.Detail}))
+			volumes := make([]string, 0, len(artifact.Volumes))
+			for volume := range artifact.Volumes {
+				volumes = append(volumes, volume)
+			}
+			sort.Strings(volumes)
+			for _, volume := range volumes {
+				fmt.Println(internal.Localize(&i18n.Message{ID: "MigratedLegacyVolume", Other: "    volume {{.From}} -> {{.To}}"}, map[string]any{"From": volume, "To": artifact.Volumes[volume]}))
+			}
+			legacyVolumes = append(legacyVolumes, volumes...)
+		} else {
+			envFile := &i18n.Message{ID: "MigratedLegacyEnvFile", Other: "  Migrated env file {{.File}}: {{.Detail}}"}
+			if dryRun {
+				envFile = &i18n.Message{ID: "WouldMigrateLegacyEnvFile", Other: "  Would migrate env file {{.File}}: {{.Detail}}"}
+			}
+			fmt.Println(internal.Localize(envFile, map[string]any{"File": artifact.Name, "Detail": artifact.Detail}))
+		}
+	}
+	if dryRun {
+		internal.Log.Info("Dry run, nothing was changed", "artifacts", len(artifacts))
+		return nil
+	}
+	internal.Log.Success("Legacy deployments migrated", "artifacts", len(artifacts))
+	if len(legacyVolumes) > 0 {
+		internal.Log.Info("The legacy volumes were kept. Once the migrated instances work, remove them with 'docker volume rm'", "volumes", len(legacyVolumes))
+	}
+	return nil
+}
@@ -0,0 +1,146 @@
+package cmd
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"graphsense-cli/internal"
+
+	"github.com/nicksnyder/go-i18n/v2/i18n"
+	"github.com/spf13/cobra"
+)
+
+var (
+	notebookPort  int
+	notebookImage string
+	notebookDir   string
+	notebookPrint bool
+	notebookStop  bool
+)
+
+var notebookCmd = &cobra.Command{
+	Use:   "notebook <instance_name>",
+	Short: "Launch a Jupyter notebook connected to an instance",
+	Long: `Launch a Jupyter container on an instance's Docker network with NEO4J_URI and
+POSTGRES_URL preset, and example notebooks for exploring the code graph with
+py2neo and pandas. Notebooks are kept in ~/.graphsense/notebooks/<instance>.
+
+Use --print to show the docker run command instead of running it, and --stop to
+remove the notebook container.`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if notebookStop {
+			return stopNotebook(args[0])
+		}
+		return launchNotebook(args[0])
+	},
+}
+
+func init() {
+	notebookCmd.Flags().IntVar(&notebookPort, "port", internal.DefaultNotebookPort, "Host port for Jupyter")
+	notebookCmd.Flags().StringVar(&notebookImage, "image", internal.DefaultNotebookImage, "Jupyter image to run")
+	notebookCmd.Flags().StringVar(&notebookDir, "dir", "", "Directory to mount as the notebook workspace (default ~/.graphsense/notebooks/<instance>)")
+	notebookCmd.Flags().BoolVar(&notebookPrint, "print", false, "Print the docker run command instead of running it")
+	notebookCmd.Flags().BoolVar(&notebookStop, "stop", false, "Remove the notebook container")
+}
+
+func launchNotebook(instanceName string) error {
+	if !internal.InstanceExists(instanceName) {
+		return fmt.Errorf("instance '%s' does not exist", instanceName)
+	}
+
+	dir := notebookDir
+	if dir == "" {
+		var err error
+		dir, err = internal.GetNotebookDir(instanceName)
+		if err != nil {
+			return err
+		}
+	}
+
+	written, err := internal.WriteExampleNotebooks(dir)
+	if err != nil {
+		return err
+	}
+	for _, name := range written {
+		internal.Log.Info("Added example notebook", "notebook", name)
+	}
+
+	token, err := internal.NewNotebookToken()
+	if err != nil {
+		return err
+	}
+
+	network, err := internal.GetInstanceNetwork(instanceName)
+	if err != nil {
+		return err
+	}
+
+	config, err := internal.GetInstanceConfig(instanceName)
+	if err != nil {
+		return err
+	}
+	credentials, err := config.Credentials()
+	if err != nil {
+		return err
+	}
+
+	opts := internal.NotebookOptions{Image: notebookImage, Port: notebookPort, Dir: dir, Token: token, Credentials: credentials}
+	if notebookPrint {
+		fmt.Println(internal.Localize(&i18n.Message{ID: "NotebookRunWith", Other: "Run Jupyter on the instance network with:"}, nil))
+		fmt.Println()
+		secrets := internal.NotebookSecretEnv(instanceName, credentials)
+		names := make([]string, 0, len(secrets))
+		for name := range secrets {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			fmt.Printf("  export %s=%s\n", name, shellJoin([]string{secrets[name]}))
+		}
+		fmt.Printf("  docker %s\n", shellJoin(internal.NotebookRunArgs(instanceName, network, opts)))
+		fmt.Println()
+		fmt.Println(internal.Localize(&i18n.Message{ID: "NotebookThenOpen", Other: "Then open {{.URL}}"}, map[string]any{"URL": fmt.Sprintf("http://%s:%d/lab?token=%s", internal.DockerHostAddress(), notebookPort, token)}))
+		return nil
+	}
+
+	if internal.IsPortInUse(notebookPort) {
+		return fmt.Errorf("port %d is already in use, pick another with --port", notebookPort)
+	}
+
+	internal.Log.Info("Starting Jupyter...", "instance", instanceName, "image", notebookImage)
+	if err := internal.StartNotebook(instanceName, network, opts); err != nil {
+		return err
+	}
+
+	internal.Log.Success("Jupyter is starting", "url", fmt.Sprintf("http://%s:%d/lab?token=%s", internal.DockerHostAddress(), notebookPort, token))
+	internal.Log.Info("Notebooks are saved in the instance's notebook directory", "path", dir)
+	internal.Log.Info("Stop it with 'graphsense-cli notebook --stop'", "instance", instanceName)
+	return nil
+}
+
+func stopNotebook(instanceName string) error {
+	if err := internal.RemoveNotebook(instanceName); err != nil {
+		return err
+	}
+	internal.Log.Success("Notebook stopped.", "instance", instanceName)
+	return nil
+}
+
+// shellSafe matches arguments that need no quoting in a POSIX shell
+var shellSafe = regexp.MustCompile(`^[A-Za-z0-9_@%+=:,./-]+$`)
+
+// shellJoin joins args into a command line that can be pasted into a shell
+func shellJoin(args []string) string {
+	quoted := make([]string, len(args))
+	for i, arg := range args {
+		if shellSafe.MatchString(arg) {
+			quoted[i] = arg
+		} else {
+			quoted[i] = "'" + strings.ReplaceAll(arg, "'", `'\''`) + "'"
+		}
+	}
+	return strings.Join(quoted, " ")
+}
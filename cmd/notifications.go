@@ -0,0 +1,67 @@
+package cmd
+
+import (
+	"fmt"
+
+	"graphsense-cli/internal"
+
+	"github.com/spf13/cobra"
+)
+
+var notificationsCmd = &cobra.Command{
+	Use:   "notifications",
+	Short: "Check the notification sinks in the config file",
+	Long: `Notifications tell you when 'supervise' finds a service of an instance unhealthy, restarts
+it, fails to or gives up, when the service recovers, and when a deploy fails. They are sent
+to every sink in the notifications section of ~/.graphsense/config.yaml:
+
+  webhook  POSTs the event as JSON to url
+  slack    posts a message to the Slack incoming webhook at url
+  email    mails the message through smtp_host, with STARTTLS where the server offers it,
+           or TLS from the start on port 465
+
+A sink with events only receives those, e.g. [gave-up, deploy-failed]. Sinks that cannot be
+reached are logged as warnings and never fail the operation they report on.`,
+}
+
+var notificationsTestCmd = &cobra.Command{
+	Use:   "test",
+	Short: "Send a test notification to every sink",
+	Long: `Send a test notification to every sink in the config file, whatever events it is limited
+to, and report which of them could not be reached.`,
+	Example: `  graphsense-cli notifications test`,
+	Args:    cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return testNotifications()
+	},
+}
+
+func init() {
+	notificationsCmd.AddCommand(notificationsTestCmd)
+}
+
+func testNotifications() error {
+	settings, err := internal.LoadConfig()
+	if err != nil {
+		return err
+	}
+	if len(settings.Notifications) == 0 {
+		configPath, _ := internal.GetConfigPath()
+		return fmt.Errorf("no notifications are configured; add sinks to the notifications section of %s", configPath)
+	}
+
+	notification := internal.NewNotification(internal.NotifyTest, "", "", "")
+	failed := 0
+	for _, sink := range settings.Notifications {
+		if err := internal.SendNotification(sink, notification); err != nil {
+			internal.Log.Error("Failed to send test notification", "sink", sink.Name(), "error", err)
+			failed++
+			continue
+		}
+		internal.Log.Success("Sent test notification", "sink", sink.Name())
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d notification sinks failed", failed, len(settings.Notifications))
+	}
+	return nil
+}
@@ -0,0 +1,47 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v3"
+)
+
+// outputFormat holds the --output value of the commands that support structured output
+var outputFormat string
+
+// addOutputFlag registers --output on a command that can print JSON or YAML
+func addOutputFlag(cmd *cobra.Command) {
+	cmd.Flags().StringVarP(&outputFormat, "output", "o", "text", "Output format: text, json or yaml")
+}
+
+// structuredOutput reports whether --output asks for JSON or YAML, validating its value
+func structuredOutput() (bool, error) {
+	switch outputFormat {
+	case "", "text":
+		return false, nil
+	case "json", "yaml":
+		return true, nil
+	default:
+		return false, fmt.Errorf("invalid output format '%s': must be text, json or yaml", outputFormat)
+	}
+}
+
+// printStructured writes v to stdout in the format selected with --output
+func printStructured(v interface{}) error {
+	switch outputFormat {
+	case "json":
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(v)
+	case "yaml":
+		encoder := yaml.NewEncoder(os.Stdout)
+		encoder.SetIndent(2)
+		defer encoder.Close()
+		return encoder.Encode(v)
+	default:
+		return fmt.Errorf("invalid output format '%s': must be json or yaml", outputFormat)
+	}
+}
@@ -0,0 +1,26 @@
+package cmd
+
+import (
+	"graphsense-cli/internal"
+
+	"github.com/spf13/cobra"
+)
+
+// portSchemeFlags holds the port scheme flags of the commands that assign ports
+var portSchemeFlags internal.PortScheme
+
+// addPortSchemeFlags registers the flags overriding the port scheme from ~/.graphsense/config.yaml
+func addPortSchemeFlags(cmd *cobra.Command) {
+	cmd.Flags().IntVar(&portSchemeFlags.PostgresOffset, "postgres-offset", 0, "PostgreSQL port offset from the app port (default 100)")
+	cmd.Flags().IntVar(&portSchemeFlags.Neo4jOffset, "neo4j-offset", 0, "Neo4j Bolt port offset from the app port (default 200)")
+	cmd.Flags().IntVar(&portSchemeFlags.Step, "port-step", 0, "Distance between the base ports tried for a free port set (default 10)")
+	cmd.Flags().StringVar(&portSchemeFlags.Range, "port-range", "", "Allowed host port range, as min-max (default 1024-65535)")
+}
+
+// portScheme returns the port scheme with the flags applied, starting the search at basePort
+// when it is set
+func portScheme(basePort int) (internal.PortScheme, error) {
+	overrides := portSchemeFlags
+	overrides.Base = basePort
+	return internal.LoadPortScheme(overrides)
+}
@@ -0,0 +1,179 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"graphsense-cli/internal"
+
+	"github.com/nicksnyder/go-i18n/v2/i18n"
+	"github.com/spf13/cobra"
+)
+
+var (
+	proxyPort        int
+	proxyBindAddress string
+)
+
+var proxyCmd = &cobra.Command{
+	Use:   "proxy",
+	Short: "Route instances by host name through a reverse proxy",
+	Long: `Run a Caddy reverse proxy that serves every instance at
+https://<instance_name>.graphsense.localhost on port 443, instead of on its own port.
+
+The proxy runs in the graphsense-proxy container. App containers join its network, and deploy,
+clone, rename, upgrade and remove keep its routes up to date. Certificates are issued by
+Caddy's local certificate authority; clients have to trust its root certificate, which
+'proxy status' tells how to export.`,
+}
+
+var proxyEnableCmd = &cobra.Command{
+	Use:   "enable",
+	Short: "Start the reverse proxy",
+	Long: `Start the reverse proxy and route every deployed instance through it. Ports below 1024
+cannot be published by rootless Docker; use --port to pick another port.`,
+	Example: `  graphsense-cli proxy enable
+  graphsense-cli proxy enable --port 8443`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return enableProxy()
+	},
+}
+
+var proxyDisableCmd = &cobra.Command{
+	Use:   "disable",
+	Short: "Stop and remove the reverse proxy",
+	Long: `Remove the reverse proxy and its network. Instances stay reachable on their own ports.
+The proxy's certificate authority is kept for the next 'proxy enable'.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if err := internal.DisableProxy(); err != nil {
+			return err
+		}
+		internal.Log.Success("Proxy disabled")
+		return nil
+	},
+}
+
+var proxyStatusCmd = &cobra.Command{
+	Use:   "status",
+	Short: "Show the reverse proxy and its routes",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return showProxy()
+	},
+}
+
+func init() {
+	proxyEnableCmd.Flags().IntVar(&proxyPort, "port", internal.DefaultProxyPort, "Host port to serve HTTPS on")
+	proxyEnableCmd.Flags().StringVar(&proxyBindAddress, "bind-address", "", "Host address to publish the proxy on, IPv4 or IPv6; 0.0.0.0 for all interfaces (default 127.0.0.1)")
+
+	proxyCmd.AddCommand(proxyEnableCmd)
+	proxyCmd.AddCommand(proxyDisableCmd)
+	proxyCmd.AddCommand(proxyStatusCmd)
+}
+
+func enableProxy() error {
+	proxy, err := internal.GetProxy()
+	if err != nil {
+		return err
+	}
+	if proxy != nil {
+		return fmt.Errorf("the proxy is already enabled on port %d. Disable it first to change its port", proxy.Port)
+	}
+
+	if proxyPort < 1 || proxyPort > 65535 {
+		return fmt.Errorf("invalid port %d", proxyPort)
+	}
+	bindAddress := proxyBindAddress
+	if bindAddress == "" {
+		bindAddress = internal.DefaultBindAddress()
+	}
+	if err := internal.ValidateBindAddress(bindAddress); err != nil {
+		return err
+	}
+	if internal.IsPortInUse(proxyPort) {
+		return fmt.Errorf("port %d is already in use, pick another with --port", proxyPort)
+	}
+
+	internal.Log.Info("Starting the proxy...", "image", internal.ProxyImage)
+	if err := internal.EnableProxy(proxyPort, bindAddress); err != nil {
+		return err
+	}
+
+	internal.Log.Success("Proxy enabled", "port", proxyPort)
+	proxy = &internal.ProxyInfo{Running: true, Port: proxyPort, BindAddress: bindAddress}
+	routes, err := internal.ProxyRoutes()
+	if err != nil {
+		return err
+	}
+	for _, route := range routes {
+		internal.Log.Info("Route", "url", proxy.URL(route.Instance), "instance", route.Instance)
+	}
+	printProxyCAHint()
+	return nil
+}
+
+func showProxy() error {
+	proxy, err := internal.GetProxy()
+	if err != nil {
+		return err
+	}
+	if proxy == nil {
+		internal.Log.Info("The proxy is not enabled. Start it with 'graphsense-cli proxy enable'")
+		return nil
+	}
+
+	state := internal.Localize(&i18n.Message{ID: "StateStopped", Other: "stopped"}, nil)
+	if proxy.Running {
+		state = internal.Localize(&i18n.Message{ID: "StateRunning", Other: "running"}, nil)
+	}
+	address := proxy.BindAddress
+	if address == "" {
+		address = internal.Localize(&i18n.Message{ID: "AllInterfaces", Other: "all interfaces"}, nil)
+	}
+	fmt.Println(internal.Localize(&i18n.Message{ID: "ProxyState", Other: "Proxy: {{.State}}, port {{.Port}} on {{.Address}}"}, map[string]any{"State": state, "Port": proxy.Port, "Address": address}))
+	fmt.Println()
+
+	routes, err := internal.ProxyRoutes()
+	if err != nil {
+		return err
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 3, ' ', 0)
+	fmt.Fprintln(w, internal.Localize(&i18n.Message{ID: "ProxyTableHeader", Other: "INSTANCE\tURL\tUPSTREAM"}, nil))
+	for _, route := range routes {
+		upstream := "http://" + route.Upstream
+		if route.TLS {
+			upstream = "https://" + route.Upstream
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\n", route.Instance, proxy.URL(route.Instance), upstream)
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	fmt.Println()
+	printProxyCAHint()
+	return nil
+}
+
+// printProxyCAHint tells how to export the root certificate clients of the proxy have to trust
+func printProxyCAHint() {
+	internal.Log.Info("Clients have to trust the proxy's root certificate. Export it with docker cp", "command", fmt.Sprintf("docker cp %s:%s graphsense-proxy-root.crt", internal.ProxyContainerName, internal.ProxyRootCertificate))
+}
+
+// syncProxyRoutes updates the proxy's routes after an instance was added, renamed or
+// removed. A failure only leaves the routes stale, so it is a warning.
+func syncProxyRoutes() {
+	if err := internal.SyncProxyRoutes(); err != nil {
+		internal.Log.Warning("Failed to update the proxy's routes", "error", err)
+	}
+}
+
+// printProxyURL prints the address the proxy serves an instance at, if it is enabled
+func printProxyURL(instanceName string) {
+	if proxy, err := internal.GetProxy(); err == nil && proxy != nil {
+		internal.Log.Info("Proxy", "url", proxy.URL(instanceName))
+	}
+}
@@ -0,0 +1,67 @@
+package cmd
+
+import (
+	"fmt"
+	"strings"
+
+	"graphsense-cli/internal"
+
+	"github.com/spf13/cobra"
+)
+
+var psqlCommand string
+
+var psqlCmd = &cobra.Command{
+	Use:   "psql <instance_name> [-- sql]",
+	Short: "Open psql connected to an instance's database",
+	Long: `Open an interactive psql session in the postgres container of an instance, connected to
+its database as its user. With -c, or SQL after --, the query is run once and psql exits.`,
+	Example: `  graphsense-cli psql my-analysis
+  graphsense-cli psql my-analysis -c "SELECT count(*) FROM files"
+  graphsense-cli psql my-analysis -- SELECT now()`,
+	Args: func(cmd *cobra.Command, args []string) error {
+		before := len(args)
+		if dash := cmd.ArgsLenAtDash(); dash >= 0 {
+			before = dash
+		}
+		if before != 1 {
+			return fmt.Errorf("requires an instance name before --, got %d argument(s)", before)
+		}
+		return nil
+	},
+	RunE: func(cmd *cobra.Command, args []string) error {
+		query := psqlCommand
+		if len(args) > 1 {
+			if query != "" {
+				return fmt.Errorf("give the query either with -c or after --, not both")
+			}
+			query = strings.Join(args[1:], " ")
+		}
+		return runPsql(args[0], query)
+	},
+}
+
+func init() {
+	psqlCmd.Flags().StringVarP(&psqlCommand, "command", "c", "", "Run this SQL and exit instead of starting an interactive session")
+}
+
+// runPsql runs psql in the postgres container of an instance, interactively or for one query
+func runPsql(instanceName, query string) error {
+	config, err := internal.GetInstanceConfig(instanceName)
+	if err != nil {
+		return err
+	}
+	if config.IsSingleContainer() {
+		return fmt.Errorf("instance '%s' runs in single-container mode, which does not expose PostgreSQL", instanceName)
+	}
+
+	// psql connects over the container's local socket, which needs no password
+	command := []string{"psql", "-U", internal.PostgresUser, "-d", internal.PostgresDB}
+	if readOnly {
+		command = append([]string{"env", "PGOPTIONS=-c default_transaction_read_only=on"}, command...)
+	}
+	if query != "" {
+		command = append(command, "-c", query)
+	}
+	return runExec(instanceName, "postgres", command)
+}
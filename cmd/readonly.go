@@ -0,0 +1,108 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"graphsense-cli/internal"
+
+	"github.com/spf13/cobra"
+)
+
+// readOnlyEnv turns on read-only mode when set to any value, e.g. from a profile script an
+// administrator installs for the other users of a shared host
+const readOnlyEnv = "GRAPHSENSE_READ_ONLY"
+
+// readOnly is set by --read-only and, once the command runs, also by readOnlyEnv and the
+// read_only setting
+var readOnly bool
+
+// readOnlyCommands are the commands that only read state, by their path below the root.
+// Every other command changes instances or the machine and is refused in read-only mode, as
+// are keys get and credentials, whose secrets would allow changing them.
+var readOnlyCommands = map[string]bool{
+	"list":                  true,
+	"status":                true,
+	"status serve":          true,
+	"logs":                  true,
+	"logs grep":             true,
+	"access-log":            true,
+	"tips":                  true,
+	"conninfo":              true,
+	"mcp-config":            true,
+	"debug":                 true,
+	"doctor":                true,
+	"du":                    true,
+	"stats":                 true,
+	"events":                true,
+	"supervise history":     true,
+	"notifications test":    true,
+	"healthcheck":           true,
+	"compare":               true,
+	"compose-config":        true,
+	"export":                true,
+	"repos":                 true,
+	"keys show":             true,
+	"keys validate":         true,
+	"proxy status":          true,
+	"gateway start":         true,
+	"slowlog":               true,
+	"metrics":               true,
+	"metrics serve":         true,
+	"translations":          true,
+	"translations template": true,
+	"version":               true,
+	"completion":            true,
+	"help":                  true,
+	// Queries run in read-only sessions, and serve and rpc refuse the requests that change instances
+	"cypher": true,
+	"psql":   true,
+	"serve":  true,
+	"rpc":    true,
+	// Used by shell completion
+	cobra.ShellCompRequestCmd:       true,
+	cobra.ShellCompNoDescRequestCmd: true,
+}
+
+// readOnlyMutatingFlags are the flags that make an otherwise read-only command change state
+var readOnlyMutatingFlags = map[string][]string{
+	"status":  {"repair"},
+	"slowlog": {"enable", "disable"},
+}
+
+// enforceReadOnly refuses commands that change state when read-only mode is on. If the
+// config file cannot be read, only read-only commands are allowed.
+func enforceReadOnly(cmd *cobra.Command) error {
+	path := strings.TrimPrefix(strings.TrimPrefix(cmd.CommandPath(), cmd.Root().Name()), " ")
+	allowed := readOnlyCommands[path]
+	if allowed {
+		for _, flag := range readOnlyMutatingFlags[path] {
+			if cmd.Flags().Changed(flag) {
+				allowed = false
+				path += " --" + flag
+			}
+		}
+	}
+
+	if os.Getenv(readOnlyEnv) != "" {
+		readOnly = true
+	}
+	if !readOnly {
+		settings, err := internal.LoadConfig()
+		if err != nil && !allowed {
+			return fmt.Errorf("failed to check for read-only mode: %v", err)
+		}
+		readOnly = err == nil && settings.ReadOnly
+	}
+
+	if readOnly && !allowed {
+		return fmt.Errorf("'%s' is not available in read-only mode, which only allows commands that do not change instances", path)
+	}
+	return nil
+}
+
+// errReadOnly is returned by serve and rpc for requests that would change instances
+func errReadOnly(action string) error {
+	return fmt.Errorf("%s is not available in read-only mode", action)
+}
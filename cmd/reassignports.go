@@ -0,0 +1,146 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+
+	"graphsense-cli/internal"
+
+	"github.com/spf13/cobra"
+)
+
+var reassignBase int
+
+var reassignPortsCmd = &cobra.Command{
+	Use:   "reassign-ports <instance_name>",
+	Short: "Move an instance to a new set of free ports",
+	Long: `Move an instance to a new set of free host ports, for when another application has claimed
+its ports. The containers are recreated with the new port mappings; named volumes are
+kept, so no data is lost. An instance that was stopped stays stopped.
+
+The new app port is the first free one from --base (default: the first free port set
+other than the current one), with PostgreSQL and Neo4j Bolt on the offsets of the port
+scheme (+100 and +200 by default).`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return reassignPorts(args[0], reassignBase)
+	},
+}
+
+func init() {
+	reassignPortsCmd.Flags().IntVar(&reassignBase, "base", 0, "Base port to search for a free port set from")
+	addPortSchemeFlags(reassignPortsCmd)
+}
+
+func reassignPorts(instanceName string, basePort int) error {
+	release, err := internal.LockInstance(instanceName)
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	if !internal.InstanceExists(instanceName) {
+		return fmt.Errorf("instance '%s' does not exist", instanceName)
+	}
+
+	config, status, err := internal.GetDeployment(instanceName)
+	if err != nil {
+		return err
+	}
+	if config == nil {
+		if config, err = internal.GetInstanceConfig(instanceName); err != nil {
+			return err
+		}
+	} else if status != internal.DeployStatusComplete {
+		return fmt.Errorf("the deploy of '%s' did not complete. Finish it with 'deploy --resume %s' first", instanceName, instanceName)
+	}
+
+	coAPIKey, anthropicAPIKey, err := internal.LoadAPIKeys()
+	if err != nil {
+		if config.LocalEmbeddings() == nil {
+			return fmt.Errorf("failed to load API keys: %v", err)
+		}
+		internal.Log.Warning("No API keys loaded", "error", err)
+	}
+	config.CoAPIKey = coAPIKey
+	config.AnthropicAPIKey = anthropicAPIKey
+
+	running, err := internal.AppRunning(instanceName)
+	if err != nil {
+		return err
+	}
+
+	scheme, err := portScheme(basePort)
+	if err != nil {
+		return err
+	}
+	scheme.BindAddress = config.BindAddress
+	ports, err := internal.ReservePortSet(scheme, instanceName)
+	if err == nil && ports.App == config.AppPort {
+		// A stopped instance leaves its own ports free
+		scheme.Base = ports.App + scheme.Step
+		ports, err = internal.ReservePortSet(scheme, instanceName)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to find available ports: %v", err)
+	}
+
+	oldPorts := internal.PortSet{App: config.AppPort, Postgres: config.PostgresPort, Neo4jBolt: config.Neo4jBoltPort}
+	ports.Apply(config)
+	internal.Log.Info("Reassigning ports", "instance", instanceName, "old_port", oldPorts.App, "new_port", ports.App)
+
+	// Port mappings are fixed when a container is created, so the containers are recreated
+	if config.IsSingleContainer() {
+		docker, err := internal.GetDockerClient()
+		if err != nil {
+			return err
+		}
+		if err := docker.RemoveContainer(context.Background(), instanceName+"-app"); err != nil {
+			return err
+		}
+		err = internal.RunSingleContainer(config)
+	} else {
+		err = internal.StartServices(config)
+	}
+	if err != nil {
+		internal.ReleasePorts(instanceName, oldPorts.App, oldPorts.Postgres, oldPorts.Neo4jBolt)
+		return fmt.Errorf("%v. Fix the problem and run 'graphsense-cli reassign-ports %s' again", err, instanceName)
+	}
+
+	if err := internal.SaveDeployment(config, internal.DeployStatusComplete); err != nil {
+		internal.Log.Warning("Failed to record deployment", "error", err)
+	} else if err := internal.ReleasePorts(instanceName, ports.App, ports.Postgres, ports.Neo4jBolt); err != nil {
+		internal.Log.Warning("Failed to release the old ports", "error", err)
+	}
+	if err := internal.StoreInstanceContainers(config); err != nil {
+		internal.Log.Warning("Failed to store container information", "error", err)
+	}
+	if running {
+		internal.RecordIndexedCommit(config)
+	}
+
+	if running {
+		if _, err := internal.WaitForHealthy(context.Background(), config, internal.DefaultHealthOptions); err != nil {
+			internal.Log.Warning("Health check failed, but continuing", "error", err)
+		}
+	} else {
+		docker, err := internal.GetDockerClient()
+		if err != nil {
+			return err
+		}
+		if err := docker.StopProject(context.Background(), instanceName); err != nil {
+			internal.Log.Warning("Failed to stop instance again", "error", err)
+		}
+	}
+
+	syncProxyRoutes()
+	internal.RefreshMCPRegistrations(instanceName, config)
+	internal.Log.Success("Ports reassigned", "instance", instanceName)
+	host := config.HostAddress()
+	internal.Log.Info("MCP server", "url", config.AppURL())
+	if !config.IsSingleContainer() {
+		internal.Log.Info("PostgreSQL", "address", fmt.Sprintf("%s:%d", host, config.PostgresPort))
+		internal.Log.Info("Neo4j Bolt", "url", fmt.Sprintf("bolt://%s:%d", host, config.Neo4jBoltPort))
+	}
+	return nil
+}
@@ -0,0 +1,84 @@
+package cmd
+
+import (
+	"fmt"
+
+	"graphsense-cli/internal"
+
+	"github.com/spf13/cobra"
+)
+
+var reconcileDryRun bool
+
+var reconcileCmd = &cobra.Command{
+	Use:   "reconcile",
+	Short: "Sync instances.db with the containers Docker actually runs",
+	Long: `Compare the instances recorded in ~/.graphsense/instances.db with the containers of
+'docker ps -a' and fix the differences:
+
+  - Instances whose containers were all removed outside the CLI, e.g. with docker rm, are
+    removed from the database and their ports released. Deploys that did not complete are
+    kept, so they can still be resumed.
+  - GraphSense containers the database does not know, e.g. created before it tracked
+    instances, are adopted: their ports, repository and mode are read from the containers.
+
+With --dry-run the changes are only printed.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return reconcile(reconcileDryRun)
+	},
+}
+
+func init() {
+	reconcileCmd.Flags().BoolVar(&reconcileDryRun, "dry-run", false, "Show what would change without changing anything")
+	addOutputFlag(reconcileCmd)
+}
+
+func reconcile(dryRun bool) error {
+	structured, err := structuredOutput()
+	if err != nil {
+		return err
+	}
+
+	changes, err := internal.PlanReconcile()
+	if err != nil {
+		return fmt.Errorf("failed to compare instances.db with Docker: %v", err)
+	}
+	if !dryRun {
+		if err := internal.ApplyReconcile(changes); err != nil {
+			return err
+		}
+	}
+
+	if structured {
+		if changes == nil {
+			changes = []internal.ReconcileChange{}
+		}
+		return printStructured(changes)
+	}
+
+	if len(changes) == 0 {
+		internal.Log.Success("instances.db matches Docker")
+		return nil
+	}
+	for _, change := range changes {
+		var verb string
+		switch {
+		case change.Action == internal.ReconcileRemove && dryRun:
+			verb = "Would remove"
+		case change.Action == internal.ReconcileRemove:
+			verb = "Removed"
+		case dryRun:
+			verb = "Would adopt"
+		default:
+			verb = "Adopted"
+		}
+		fmt.Printf("  %s %s: %s\n", verb, change.Instance, change.Detail)
+	}
+	if dryRun {
+		internal.Log.Info("Dry run, nothing was changed", "changes", len(changes))
+	} else {
+		internal.Log.Success("instances.db reconciled", "changes", len(changes))
+	}
+	return nil
+}
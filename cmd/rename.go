@@ -0,0 +1,175 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+
+	"graphsense-cli/internal"
+
+	"github.com/spf13/cobra"
+)
+
+var renameCmd = &cobra.Command{
+	Use:   "rename <instance_name> <new_name>",
+	Short: "Rename a GraphSense instance",
+	Long: `Rename an instance without losing its indexed data.
+
+The instance is taken down, its volumes are copied to volumes carrying the new name and its
+records in ~/.graphsense/instances.db are moved over. It is then started again under the new
+name on the same ports, and the old volumes are removed. Copying needs as much free disk
+space as the instance's volumes use.`,
+	Args: cobra.ExactArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return renameInstance(args[0], args[1])
+	},
+}
+
+func renameInstance(oldName, newName string) error {
+	newName = internal.SanitizeInstanceName(newName)
+	if newName == oldName {
+		return fmt.Errorf("instance is already named '%s'", oldName)
+	}
+	for _, name := range []string{oldName, newName} {
+		release, err := internal.LockInstance(name)
+		if err != nil {
+			return err
+		}
+		defer release()
+	}
+
+	if !internal.InstanceExists(oldName) {
+		return fmt.Errorf("instance '%s' does not exist", oldName)
+	}
+	if foreign, err := internal.IsForeignProject(oldName); err != nil {
+		return err
+	} else if foreign {
+		return fmt.Errorf("compose project '%s' contains containers not created by graphsense-cli, refusing to rename it", oldName)
+	}
+	if err := checkNameAvailable(newName); err != nil {
+		return err
+	}
+
+	config, status, err := internal.GetDeployment(oldName)
+	if err != nil {
+		return err
+	}
+	if config == nil {
+		if config, err = internal.GetInstanceConfig(oldName); err != nil {
+			return err
+		}
+	} else if status != internal.DeployStatusComplete {
+		return fmt.Errorf("the deploy of '%s' did not complete. Finish it with 'deploy --resume %s' first", oldName, oldName)
+	}
+
+	coAPIKey, anthropicAPIKey, err := internal.LoadAPIKeys()
+	if err != nil {
+		if config.LocalEmbeddings() == nil {
+			return fmt.Errorf("failed to load API keys: %v", err)
+		}
+		internal.Log.Warning("No API keys loaded", "error", err)
+	}
+	config.CoAPIKey = coAPIKey
+	config.AnthropicAPIKey = anthropicAPIKey
+	// Fail before anything is stopped if the database credentials cannot be read
+	if _, err := config.Credentials(); err != nil {
+		return err
+	}
+
+	internal.Log.Info("Renaming instance", "instance", oldName, "new_name", newName)
+
+	if err := takeDown(oldName); err != nil {
+		return err
+	}
+
+	oldVolumes, err := internal.InstanceVolumes(oldName)
+	if err != nil {
+		return err
+	}
+	if _, err := internal.CopyInstanceVolumes(oldName, newName); err != nil {
+		internal.Log.Warning("Copying volumes failed, starting the instance again under its old name", "instance", oldName)
+		if startErr := internal.StartServices(config); startErr != nil {
+			internal.Log.Error("Failed to restart instance", "instance", oldName, "error", startErr)
+		}
+		return err
+	}
+
+	if err := internal.RenameInstanceRecords(oldName, newName); err != nil {
+		return err
+	}
+
+	// The managed clone of a Git URL deploy, the database credentials and the TLS
+	// certificate are stored under the instance name
+	if err := internal.MoveManagedRepo(config, newName); err != nil {
+		internal.Log.Warning("Failed to move the repository clone", "error", err)
+	}
+	if err := internal.MoveInstanceTLS(config, newName); err != nil {
+		internal.Log.Warning("Failed to move the TLS certificate", "error", err)
+	}
+	credentialStore := config.CredentialStore
+	if err := internal.MoveInstanceCredentials(config, newName); err != nil {
+		return fmt.Errorf("failed to move database credentials: %v", err)
+	}
+	config.InstanceName = newName
+	if config.RepoURL != "" || config.CredentialStore != credentialStore {
+		if err := internal.SaveDeployment(config, internal.DeployStatusComplete); err != nil {
+			internal.Log.Warning("Failed to record the new repository path and credential store", "error", err)
+		}
+	}
+	internal.Log.Info("Starting instance", "instance", newName)
+	if err := internal.StartServices(config); err != nil {
+		return fmt.Errorf("%v. The data is in the volumes of '%s'; fix the problem and run 'graphsense-cli upgrade %s'", err, newName, newName)
+	}
+
+	internal.RemoveVolumes(oldVolumes)
+
+	if _, err := internal.WaitForHealthy(context.Background(), config, internal.DefaultHealthOptions); err != nil {
+		internal.Log.Warning("Health check failed, but continuing", "error", err)
+	}
+
+	syncProxyRoutes()
+	internal.RefreshMCPRegistrations(oldName, config)
+	internal.Log.Success("Instance renamed", "instance", newName, "old_name", oldName)
+	return nil
+}
+
+// checkNameAvailable fails if an instance, record or volume already uses instanceName
+func checkNameAvailable(instanceName string) error {
+	if internal.InstanceExists(instanceName) {
+		return fmt.Errorf("instance '%s' already exists", instanceName)
+	}
+	if existing, _, err := internal.GetDeployment(instanceName); err != nil {
+		return err
+	} else if existing != nil {
+		return fmt.Errorf("instance '%s' is already recorded in instances.db", instanceName)
+	}
+	if volumes, err := internal.InstanceVolumes(instanceName); err != nil {
+		return err
+	} else if len(volumes) > 0 {
+		return fmt.Errorf("volumes of an instance named '%s' already exist", instanceName)
+	}
+	return nil
+}
+
+// takeDown removes the containers and networks of an instance, keeping its volumes
+func takeDown(instanceName string) error {
+	// The notebook container is not part of the compose project but holds on to its network
+	if err := internal.RemoveNotebook(instanceName); err != nil {
+		internal.Log.Warning("Failed to remove notebook container", "error", err)
+	}
+
+	envVars := map[string]string{
+		"COMPOSE_PROJECT_NAME": instanceName,
+	}
+	if err := internal.RunDockerCompose([]string{"down", "--remove-orphans"}, envVars); err != nil {
+		internal.Log.Warning("Failed to cleanly stop instance with docker-compose, trying manual cleanup...")
+	}
+
+	docker, err := internal.GetDockerClient()
+	if err != nil {
+		return err
+	}
+	if err := docker.RemoveProjectContainers(context.Background(), instanceName); err != nil {
+		return fmt.Errorf("failed to remove containers of %s: %v", instanceName, err)
+	}
+	return nil
+}
@@ -0,0 +1,69 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"graphsense-cli/internal"
+
+	"github.com/nicksnyder/go-i18n/v2/i18n"
+	"github.com/spf13/cobra"
+)
+
+var reposCmd = &cobra.Command{
+	Use:   "repos",
+	Short: "List the repositories indexed by instances",
+	Long: `List the repositories known to the CLI with the number of instances indexing each, the
+most recently indexed commit, the disk space their instances use and their MCP endpoints.
+
+Instances deployed from a Git URL are grouped by URL, all others by repository path.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return listRepos()
+	},
+}
+
+func init() {
+	addOutputFlag(reposCmd)
+}
+
+func listRepos() error {
+	structured, err := structuredOutput()
+	if err != nil {
+		return err
+	}
+
+	names, err := internal.GetInstanceNames()
+	if err != nil {
+		return err
+	}
+	repos, err := internal.GetRepositories(names)
+	if err != nil {
+		return err
+	}
+	if structured {
+		return printStructured(repos)
+	}
+
+	if len(repos) == 0 {
+		internal.Log.Info("No repositories found. Deploy one with 'graphsense-cli deploy <repo_path>'.")
+		return nil
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 3, ' ', 0)
+	fmt.Fprintln(w, internal.Localize(&i18n.Message{ID: "ReposTableHeader", Other: "REPOSITORY\tINSTANCES\tINDEXED COMMIT\tDISK\tENDPOINTS"}, nil))
+	for _, repo := range repos {
+		commit := "-"
+		if repo.LatestCommit != nil {
+			commit = fmt.Sprintf("%s (%s)", repo.LatestCommit.Revision(), formatLastUsed(repo.LatestCommit.IndexedAt))
+		}
+		var endpoints []string
+		for _, instance := range repo.Instances {
+			endpoints = append(endpoints, fmt.Sprintf("%s=%s", instance.Name, instance.MCPURL))
+		}
+		fmt.Fprintf(w, "%s\t%d\t%s\t%s\t%s\n", repo.Repository, len(repo.Instances), commit, internal.FormatSize(repo.DiskUsage), strings.Join(endpoints, ", "))
+	}
+	return w.Flush()
+}
@@ -0,0 +1,126 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"graphsense-cli/internal"
+
+	"github.com/spf13/cobra"
+)
+
+var restoreAs string
+
+var restoreCmd = &cobra.Command{
+	Use:   "restore <instance_name> <backup_file> | restore <backup_file> --as <new_instance_name>",
+	Short: "Restore a GraphSense instance from a backup archive",
+	Long: `Load the PostgreSQL and Neo4j dumps from a backup archive into an existing instance,
+replacing its data. With --as, a new instance is deployed for the backed up repository
+and the backup is restored into it, cloning the original instance.`,
+	Args: cobra.RangeArgs(1, 2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if restoreAs != "" {
+			if len(args) != 1 {
+				return fmt.Errorf("--as takes only the backup file as argument")
+			}
+			return restoreAsNewInstance(args[0], restoreAs)
+		}
+
+		if len(args) != 2 {
+			return fmt.Errorf("requires an instance name and a backup file")
+		}
+		return restoreInstance(args[0], args[1])
+	},
+}
+
+func init() {
+	restoreCmd.Flags().StringVar(&restoreAs, "as", "", "Deploy a new instance with this name and restore the backup into it")
+}
+
+func restoreInstance(instanceName, backupFile string) error {
+	release, err := internal.LockInstance(instanceName)
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	if !internal.InstanceExists(instanceName) {
+		return fmt.Errorf("instance '%s' does not exist", instanceName)
+	}
+
+	workDir, err := internal.NewBackupWorkDir("graphsense-restore-*")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(workDir)
+
+	metadata, err := internal.ExtractBackup(backupFile, workDir)
+	if err != nil {
+		return err
+	}
+
+	internal.Log.Warning("This will replace all data of the instance with the backup.", "instance", instanceName, "backup_of", metadata.InstanceName, "taken", metadata.CreatedAt)
+	if !confirm(internal.Localize(areYouSure, nil)) {
+		internal.Log.Info("Cancelled.")
+		return nil
+	}
+
+	return runRestore(instanceName, workDir, metadata)
+}
+
+func restoreAsNewInstance(backupFile, newName string) error {
+	workDir, err := internal.NewBackupWorkDir("graphsense-restore-*")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(workDir)
+
+	metadata, err := internal.ExtractBackup(backupFile, workDir)
+	if err != nil {
+		return err
+	}
+
+	newName = internal.SanitizeInstanceName(newName)
+	// The new instance stays locked between its deploy and the restore
+	release, err := internal.LockInstance(newName)
+	if err != nil {
+		return err
+	}
+	defer release()
+	internal.Log.Info("Cloning backup into new instance", "instance", newName, "backup_of", metadata.InstanceName)
+
+	if err := deployInstance(metadata.RepoPath, newName, 0); err != nil {
+		return err
+	}
+
+	return runRestore(newName, workDir, metadata)
+}
+
+// runRestore loads an extracted backup into an instance and waits for it to come back up
+func runRestore(instanceName, workDir string, metadata *internal.BackupMetadata) error {
+	config, err := internal.GetInstanceConfig(instanceName)
+	if err != nil {
+		return err
+	}
+	if config.IsSingleContainer() {
+		return fmt.Errorf("instance '%s' runs in single-container mode, which does not support restores", instanceName)
+	}
+
+	if err := internal.CheckRestorable(instanceName, workDir); err != nil {
+		return err
+	}
+
+	internal.Log.Info("Restoring instance", "instance", instanceName)
+
+	if err := internal.RestoreBackup(instanceName, workDir, metadata); err != nil {
+		return fmt.Errorf("failed to restore instance %s: %v", instanceName, err)
+	}
+
+	if _, err := internal.WaitForHealthy(context.Background(), config, internal.DefaultHealthOptions); err != nil {
+		internal.Log.Warning("Health check failed, but continuing", "error", err)
+	}
+
+	internal.Log.Success("Instance restored", "instance", instanceName)
+	return nil
+}
@@ -1,6 +1,11 @@
 package cmd
 
 import (
+	"log/slog"
+	"time"
+
+	"graphsense-cli/internal"
+
 	"github.com/spf13/cobra"
 )
 
@@ -9,14 +14,73 @@ var rootCmd = &cobra.Command{
 	Short: "GraphSense Multi-Instance Deployment CLI",
 	Long: `GraphSense CLI for managing multiple GraphSense instances using Docker Compose.
 This tool allows you to deploy, manage, and monitor GraphSense instances for different repositories.`,
+	PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+		if plain {
+			internal.SetPlainOutput(true)
+		} else if settings, err := internal.LoadConfig(); err == nil && settings.Plain {
+			internal.SetPlainOutput(true)
+		}
+		if err := internal.SetLogFormat(logFormat); err != nil {
+			return err
+		}
+		switch {
+		case quiet:
+			internal.SetLogLevel(slog.LevelWarn)
+		case verbose:
+			internal.SetLogLevel(internal.LevelVerbose)
+		case debug:
+			internal.SetLogLevel(slog.LevelDebug)
+		}
+		if err := enforceReadOnly(cmd); err != nil {
+			return err
+		}
+		internal.LockWait = lockWait
+		if err := lockMachine(cmd); err != nil {
+			return err
+		}
+		return internal.SetDockerTarget(dockerHost, dockerContext)
+	},
+	PersistentPostRun: func(cmd *cobra.Command, args []string) {
+		notifyUpdates(cmd)
+	},
 }
 
+var (
+	dockerHost    string
+	dockerContext string
+	logFormat     string
+	quiet         bool
+	verbose       bool
+	debug         bool
+	plain         bool
+	lockWait      time.Duration
+	allowScripts  bool
+)
+
 func Execute() error {
+	if err := internal.SetLanguage(internal.DetectLanguage()); err != nil {
+		internal.Log.Warning("Failed to load translations, showing messages in English", "error", err)
+	}
+	localizeCommand(rootCmd)
+	defer internal.ReleaseLocks()
 	return rootCmd.Execute()
 }
 
 func init() {
+	rootCmd.PersistentFlags().StringVar(&dockerHost, "host", "", "Docker engine to use, e.g. ssh://user@host or tcp://host:2376")
+	rootCmd.PersistentFlags().StringVar(&dockerContext, "context", "", "Docker context to use")
+	rootCmd.PersistentFlags().StringVar(&logFormat, "log-format", internal.LogFormatText, "Log format: text or json (JSON records are written to stderr)")
+	rootCmd.PersistentFlags().BoolVarP(&quiet, "quiet", "q", false, "Only log warnings and errors")
+	rootCmd.PersistentFlags().BoolVarP(&verbose, "verbose", "v", false, "Log additional detail")
+	rootCmd.PersistentFlags().BoolVar(&debug, "debug", false, "Log additional detail and every command run, with its arguments and environment overrides")
+	rootCmd.PersistentFlags().BoolVar(&plain, "plain", false, "Plain output without colors, emojis or other symbols, for screen readers and dumb terminals")
+	rootCmd.PersistentFlags().BoolVar(&readOnly, "read-only", false, "Refuse commands that change instances, as the read_only setting and "+readOnlyEnv+" do")
+	rootCmd.PersistentFlags().BoolVar(&allowScripts, "allow-scripts", false, "Run the lifecycle scripts repositories declare to run on this machine without asking, as the allow_scripts setting does")
+	rootCmd.PersistentFlags().DurationVar(&lockWait, "wait", 0, "How long to wait for another operation on the same instance to finish, e.g. 5m (default: fail right away)")
+	rootCmd.MarkFlagsMutuallyExclusive("quiet", "verbose", "debug")
+
 	rootCmd.AddCommand(deployCmd)
+	rootCmd.AddCommand(deployBatchCmd)
 	rootCmd.AddCommand(stopCmd)
 	rootCmd.AddCommand(startCmd)
 	rootCmd.AddCommand(removeCmd)
@@ -25,4 +89,76 @@ func init() {
 	rootCmd.AddCommand(statusCmd)
 	rootCmd.AddCommand(debugCmd)
 	rootCmd.AddCommand(cleanupCmd)
+	rootCmd.AddCommand(upgradeCmd)
+	rootCmd.AddCommand(backupCmd)
+	rootCmd.AddCommand(restoreCmd)
+	rootCmd.AddCommand(doctorCmd)
+	rootCmd.AddCommand(tipsCmd)
+	rootCmd.AddCommand(accessLogCmd)
+	rootCmd.AddCommand(conninfoCmd)
+	rootCmd.AddCommand(notebookCmd)
+	rootCmd.AddCommand(completionCmd)
+	rootCmd.AddCommand(slowlogCmd)
+	rootCmd.AddCommand(setLogLevelCmd)
+	rootCmd.AddCommand(keysCmd)
+	rootCmd.AddCommand(renameCmd)
+	rootCmd.AddCommand(cloneCmd)
+	rootCmd.AddCommand(duCmd)
+	rootCmd.AddCommand(metricsCmd)
+	rootCmd.AddCommand(healthcheckCmd)
+	rootCmd.AddCommand(serveCmd)
+	rootCmd.AddCommand(sandboxCmd)
+	rootCmd.AddCommand(composeConfigCmd)
+	rootCmd.AddCommand(execCmd)
+	rootCmd.AddCommand(shellCmd)
+	rootCmd.AddCommand(psqlCmd)
+	rootCmd.AddCommand(composeCmd)
+	rootCmd.AddCommand(cypherCmd)
+	rootCmd.AddCommand(reassignPortsCmd)
+	rootCmd.AddCommand(setAutostartCmd)
+	rootCmd.AddCommand(setTTLCmd)
+	rootCmd.AddCommand(setIndexingCmd)
+	rootCmd.AddCommand(reposCmd)
+	rootCmd.AddCommand(watchCmd)
+	rootCmd.AddCommand(translationsCmd)
+	rootCmd.AddCommand(compareCmd)
+	rootCmd.AddCommand(selftestCmd)
+	rootCmd.AddCommand(rpcCmd)
+	rootCmd.AddCommand(reconcileCmd)
+	rootCmd.AddCommand(exportCmd)
+	rootCmd.AddCommand(importCmd)
+	rootCmd.AddCommand(migrateLegacyCmd)
+	rootCmd.AddCommand(credentialsCmd)
+	rootCmd.AddCommand(proxyCmd)
+	rootCmd.AddCommand(versionCmd)
+	rootCmd.AddCommand(selfUpdateCmd)
+	rootCmd.AddCommand(uninstallCmd)
+	rootCmd.AddCommand(mcpConfigCmd)
+	rootCmd.AddCommand(gatewayCmd)
+	rootCmd.AddCommand(statsCmd)
+	rootCmd.AddCommand(eventsCmd)
+	rootCmd.AddCommand(superviseCmd)
+	rootCmd.AddCommand(notificationsCmd)
+	rootCmd.AddCommand(gcCmd)
+
+	// Commands whose only argument is an instance name
+	for _, cmd := range []*cobra.Command{
+		upgradeCmd, backupCmd, tipsCmd, accessLogCmd, conninfoCmd, notebookCmd, slowlogCmd, renameCmd,
+		cloneCmd, duCmd, statsCmd, eventsCmd, healthcheckCmd, composeConfigCmd, psqlCmd, composeCmd,
+		cypherCmd, reassignPortsCmd, watchCmd, exportCmd, setIndexingCmd, credentialsCmd,
+		mcpConfigCmd, setTTLCmd,
+	} {
+		cmd.ValidArgsFunction = completeInstanceNames
+	}
+	// Commands taking any number of instance names
+	for _, cmd := range []*cobra.Command{
+		stopCmd, startCmd, removeCmd, statusCmd, keysRotateCmd, compareCmd,
+	} {
+		cmd.ValidArgsFunction = completeInstanceNamesRepeated
+	}
+	for _, cmd := range []*cobra.Command{logsCmd, execCmd, shellCmd} {
+		cmd.ValidArgsFunction = completeLogsArgs
+	}
+	setLogLevelCmd.ValidArgsFunction = completeSetLogLevelArgs
+	setAutostartCmd.ValidArgsFunction = completeSetAutostartArgs
 }
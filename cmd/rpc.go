@@ -0,0 +1,323 @@
+package cmd
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"graphsense-cli/internal"
+
+	"github.com/spf13/cobra"
+)
+
+var rpcCmd = &cobra.Command{
+	Use:   "rpc",
+	Short: "Drive instances with JSON-RPC 2.0 over stdin and stdout",
+	Long: `Read JSON-RPC 2.0 requests from stdin, one per line, and write one response per line to
+stdout, so that infrastructure-as-code tools can manage instances with structured requests
+and responses instead of parsing CLI output. Logs and command output go to stderr.
+
+Requests are handled one at a time, in order; deploys answer once the instance is healthy.
+The session ends when stdin is closed.
+
+Methods:
+  rpc.methods            List the supported methods
+  instances.list         List instances with their status
+  instances.get          Show an instance's status {"name"}
+  instances.deploy       Deploy an instance {"repo_path", "name", "port"}
+  instances.start        Start an instance {"name"}
+  instances.stop         Stop an instance {"name"}
+  instances.remove       Remove an instance {"name", "keep_data"}
+  instances.logs         Last log lines {"name", "service", "tail"}
+  instances.connection   Connection details of an instance {"name"}
+
+Errors use the JSON-RPC codes for malformed requests, plus -32001 for an instance that
+does not exist, -32002 for one that already exists, -32003 for methods refused in
+read-only mode and -32000 for failed operations.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return serveRPC()
+	},
+}
+
+// JSON-RPC 2.0 error codes
+const (
+	rpcParseError     = -32700
+	rpcInvalidRequest = -32600
+	rpcMethodNotFound = -32601
+	rpcInvalidParams  = -32602
+	rpcFailed         = -32000
+	rpcNotFound       = -32001
+	rpcConflict       = -32002
+	rpcForbidden      = -32003
+)
+
+// rpcRequest is a JSON-RPC 2.0 request; requests without an id are notifications
+type rpcRequest struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id,omitempty"`
+	Method  string          `json:"method"`
+	Params  json.RawMessage `json:"params,omitempty"`
+}
+
+// rpcResponse is a JSON-RPC 2.0 response carrying either a result or an error
+type rpcResponse struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id"`
+	Result  interface{}     `json:"result,omitempty"`
+	Error   *rpcError       `json:"error,omitempty"`
+}
+
+// rpcError is a JSON-RPC 2.0 error object
+type rpcError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *rpcError) Error() string {
+	return e.Message
+}
+
+// rpcParams holds the parameters any method takes
+type rpcParams struct {
+	Name     string `json:"name"`
+	RepoPath string `json:"repo_path"`
+	Port     int    `json:"port"`
+	KeepData bool   `json:"keep_data"`
+	Service  string `json:"service"`
+	Tail     int    `json:"tail"`
+}
+
+// rpcMethods maps method names to their handlers
+var rpcMethods = map[string]func(params rpcParams) (interface{}, error){
+	"instances.list": func(params rpcParams) (interface{}, error) {
+		return collectInstanceStatuses("name", 0)
+	},
+	"instances.get":        rpcInstanceStatus,
+	"instances.deploy":     rpcDeploy,
+	"instances.start":      rpcLifecycle(startInstance),
+	"instances.stop":       rpcLifecycle(stopInstance),
+	"instances.remove":     rpcRemove,
+	"instances.logs":       rpcLogs,
+	"instances.connection": rpcConnection,
+}
+
+// rpcMutatingMethods are the methods refused in read-only mode
+var rpcMutatingMethods = map[string]bool{
+	"instances.deploy": true,
+	"instances.start":  true,
+	"instances.stop":   true,
+	"instances.remove": true,
+}
+
+func init() {
+	// Registered here, as it lists rpcMethods itself
+	rpcMethods["rpc.methods"] = func(params rpcParams) (interface{}, error) {
+		names := make([]string, 0, len(rpcMethods))
+		for name := range rpcMethods {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		return names, nil
+	}
+}
+
+func serveRPC() error {
+	// Everything but the responses goes to stderr, and nothing may read the requests
+	// meant for the session, such as a confirmation prompt
+	requests, responses := os.Stdin, os.Stdout
+	os.Stdout = os.Stderr
+	defer func() { os.Stdout = responses }()
+	if devNull, err := os.Open(os.DevNull); err == nil {
+		os.Stdin = devNull
+		defer func() {
+			os.Stdin = requests
+			devNull.Close()
+		}()
+	}
+	if err := internal.SetLogFormat(logFormat); err != nil {
+		return err
+	}
+
+	encoder := json.NewEncoder(responses)
+	reader := bufio.NewReader(requests)
+	for {
+		line, err := reader.ReadBytes('\n')
+		if len(line) > 0 {
+			if response := handleRPCLine(line); response != nil {
+				if err := encoder.Encode(response); err != nil {
+					return fmt.Errorf("failed to write response: %v", err)
+				}
+			}
+		}
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read request: %v", err)
+		}
+	}
+}
+
+// handleRPCLine answers one request line, returning nil for notifications and blank lines
+func handleRPCLine(line []byte) *rpcResponse {
+	if len(bytes.TrimSpace(line)) == 0 {
+		return nil
+	}
+
+	var request rpcRequest
+	if err := json.Unmarshal(line, &request); err != nil {
+		return &rpcResponse{JSONRPC: "2.0", ID: json.RawMessage("null"), Error: &rpcError{Code: rpcParseError, Message: fmt.Sprintf("invalid JSON: %v", err)}}
+	}
+	id := request.ID
+	if id == nil {
+		id = json.RawMessage("null")
+	}
+	if request.JSONRPC != "2.0" || request.Method == "" {
+		return &rpcResponse{JSONRPC: "2.0", ID: id, Error: &rpcError{Code: rpcInvalidRequest, Message: `requests need "jsonrpc": "2.0" and a method`}}
+	}
+
+	internal.Log.Verbose("RPC request", "method", request.Method)
+	result, err := callRPC(request)
+	if request.ID == nil {
+		if err != nil {
+			internal.Log.Error("RPC notification failed", "method", request.Method, "error", err)
+		}
+		return nil
+	}
+
+	response := &rpcResponse{JSONRPC: "2.0", ID: id, Result: result}
+	if err != nil {
+		var rpcErr *rpcError
+		if !errors.As(err, &rpcErr) {
+			rpcErr = &rpcError{Code: rpcFailed, Message: err.Error()}
+		}
+		response.Result = nil
+		response.Error = rpcErr
+	}
+	return response
+}
+
+// callRPC runs the method of a request
+func callRPC(request rpcRequest) (interface{}, error) {
+	method, ok := rpcMethods[request.Method]
+	if !ok {
+		return nil, &rpcError{Code: rpcMethodNotFound, Message: fmt.Sprintf("unknown method '%s'", request.Method)}
+	}
+	if readOnly && rpcMutatingMethods[request.Method] {
+		return nil, &rpcError{Code: rpcForbidden, Message: errReadOnly(request.Method).Error()}
+	}
+
+	var params rpcParams
+	if len(request.Params) > 0 && string(request.Params) != "null" {
+		if err := json.Unmarshal(request.Params, &params); err != nil {
+			return nil, &rpcError{Code: rpcInvalidParams, Message: fmt.Sprintf("invalid params: %v", err)}
+		}
+	}
+	return method(params)
+}
+
+// rpcExistingInstance checks that params name an existing instance
+func rpcExistingInstance(params rpcParams) error {
+	if params.Name == "" {
+		return &rpcError{Code: rpcInvalidParams, Message: "name is required"}
+	}
+	if !internal.InstanceExists(params.Name) {
+		return &rpcError{Code: rpcNotFound, Message: fmt.Sprintf("instance '%s' does not exist", params.Name)}
+	}
+	return nil
+}
+
+func rpcInstanceStatus(params rpcParams) (interface{}, error) {
+	if err := rpcExistingInstance(params); err != nil {
+		return nil, err
+	}
+	return internal.GetInstanceStatus(params.Name)
+}
+
+func rpcDeploy(params rpcParams) (interface{}, error) {
+	if !filepath.IsAbs(params.RepoPath) {
+		return nil, &rpcError{Code: rpcInvalidParams, Message: "repo_path must be an absolute path"}
+	}
+
+	name := params.Name
+	if name == "" {
+		name = internal.GenerateInstanceName(params.RepoPath)
+	}
+	name = internal.SanitizeInstanceName(name)
+	if internal.InstanceExists(name) {
+		return nil, &rpcError{Code: rpcConflict, Message: fmt.Sprintf("instance '%s' already exists", name)}
+	}
+
+	if err := deployInstance(params.RepoPath, name, params.Port); err != nil {
+		return nil, err
+	}
+	return internal.GetInstanceStatus(name)
+}
+
+// rpcLifecycle wraps a start or stop of an instance, answering with its new status
+func rpcLifecycle(action func(instanceName string) error) func(params rpcParams) (interface{}, error) {
+	return func(params rpcParams) (interface{}, error) {
+		if err := rpcExistingInstance(params); err != nil {
+			return nil, err
+		}
+		if err := action(params.Name); err != nil {
+			return nil, err
+		}
+		return internal.GetInstanceStatus(params.Name)
+	}
+}
+
+func rpcRemove(params rpcParams) (interface{}, error) {
+	if err := rpcExistingInstance(params); err != nil {
+		return nil, err
+	}
+	if err := removeInstance(params.Name, true, removeScopeFor(params.KeepData), true); err != nil {
+		return nil, err
+	}
+	return map[string]string{"instance": params.Name, "action": "remove", "status": operationSucceeded}, nil
+}
+
+func rpcLogs(params rpcParams) (interface{}, error) {
+	if err := rpcExistingInstance(params); err != nil {
+		return nil, err
+	}
+	tail := params.Tail
+	if tail < 0 {
+		return nil, &rpcError{Code: rpcInvalidParams, Message: "tail must be positive"}
+	}
+	if tail == 0 {
+		tail = defaultLogTail
+	}
+
+	lines, err := instanceLogLines(context.Background(), params.Name, params.Service, tail)
+	if errors.Is(err, errNoSuchService) {
+		return nil, &rpcError{Code: rpcNotFound, Message: err.Error()}
+	}
+	return lines, err
+}
+
+func rpcConnection(params rpcParams) (interface{}, error) {
+	if err := rpcExistingInstance(params); err != nil {
+		return nil, err
+	}
+	config, err := internal.GetInstanceConfig(params.Name)
+	if err != nil {
+		return nil, err
+	}
+	info, err := internal.GetConnInfo(config)
+	if err != nil {
+		return nil, err
+	}
+	if readOnly {
+		info = info.WithoutPasswords()
+	}
+	return info, nil
+}
@@ -0,0 +1,136 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"graphsense-cli/internal"
+
+	"github.com/spf13/cobra"
+)
+
+var sandboxCmd = &cobra.Command{
+	Use:   "sandbox <backup_file | instance_name>",
+	Short: "Explore a backup in a temporary instance",
+	Long: `Start a temporary instance from a backup archive, or from the newest recorded backup
+of an instance, for read-only exploration of a historical snapshot.
+
+The sandbox gets its own containers, volumes and ports and is removed, data included, when
+the command exits (Ctrl+C). The original instance, its backups and its repository are never
+touched: the sandbox indexes an empty directory before the backup is loaded, so no
+repository lifecycle scripts run. Its app stays stopped so nothing reindexes the snapshot,
+and PostgreSQL sessions are read-only. Query the data with cypher-shell, psql or the
+connection details printed on start.`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return runSandbox(args[0])
+	},
+}
+
+func runSandbox(source string) error {
+	backupFile, err := sandboxBackupFile(source)
+	if err != nil {
+		return err
+	}
+
+	workDir, err := internal.NewBackupWorkDir("graphsense-sandbox-*")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(workDir)
+
+	metadata, err := internal.ExtractBackup(backupFile, workDir)
+	if err != nil {
+		return err
+	}
+
+	// The sandbox indexes an empty repository; its graph comes from the backup
+	repoDir, err := os.MkdirTemp("", "graphsense-sandbox-repo-*")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(repoDir)
+
+	name := internal.SandboxName(metadata.InstanceName)
+	if err := checkNameAvailable(name); err != nil {
+		return err
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	internal.Log.Info("Starting sandbox from the backup", "instance", name, "backup_of", metadata.InstanceName, "taken", metadata.CreatedAt)
+	defer teardownSandbox(name)
+
+	if err := deployInstance(repoDir, name, 0); err != nil {
+		return err
+	}
+	// The app stays stopped so nothing reindexes over the snapshot
+	if err := internal.StopContainer(name + "-app"); err != nil {
+		return err
+	}
+	if err := internal.RestoreBackupData(name, workDir, metadata); err != nil {
+		return fmt.Errorf("failed to load backup into sandbox: %v", err)
+	}
+	if err := internal.SetPostgresReadOnly(name); err != nil {
+		internal.Log.Warning("Failed to make PostgreSQL read-only", "error", err)
+	}
+
+	config, err := internal.GetInstanceConfig(name)
+	if err != nil {
+		return err
+	}
+	info, err := internal.GetConnInfo(config)
+	if err != nil {
+		return err
+	}
+	internal.Log.Success("Sandbox is ready", "instance", name)
+	internal.Log.Info("PostgreSQL", "url", info.WithoutPasswords().PostgresURL)
+	internal.Log.Info("Neo4j", "url", info.Neo4jURI)
+	internal.Log.Info("Shell", "command", "graphsense-cli cypher "+name)
+	internal.Log.Info("Passwords", "command", "graphsense-cli credentials "+name)
+	internal.Log.Info("Press Ctrl+C to remove the sandbox.")
+
+	<-ctx.Done()
+	fmt.Println()
+	return nil
+}
+
+// sandboxBackupFile returns source if it is a file, otherwise the newest recorded backup of the instance it names
+func sandboxBackupFile(source string) (string, error) {
+	if info, err := os.Stat(source); err == nil && !info.IsDir() {
+		return source, nil
+	}
+
+	backups, err := internal.GetBackups(source)
+	if err != nil {
+		return "", err
+	}
+	for _, backup := range backups {
+		if _, err := os.Stat(backup.Path); err == nil {
+			internal.Log.Info("Using backup", "path", backup.Path)
+			return backup.Path, nil
+		}
+	}
+	return "", fmt.Errorf("'%s' is neither a backup file nor an instance with a backup on disk", source)
+}
+
+// teardownSandbox removes a sandbox instance with its data, whether or not it finished starting
+func teardownSandbox(name string) {
+	if !internal.InstanceExists(name) {
+		if config, _, err := internal.GetDeployment(name); err == nil && config != nil {
+			internal.DeleteInstanceCredentials(name, config.CredentialStore)
+		}
+		internal.DeleteInstanceTLS(name)
+		internal.RemoveDeployment(name)
+		return
+	}
+	internal.Log.Info("Removing sandbox", "instance", name)
+	if err := removeInstance(name, true, removeEverything, false); err != nil {
+		internal.Log.Error("Failed to remove sandbox", "instance", name, "error", err)
+		internal.Log.Info("Remove it with 'graphsense-cli remove'", "instance", name)
+	}
+}
@@ -0,0 +1,75 @@
+package cmd
+
+import (
+	"fmt"
+	"time"
+
+	"graphsense-cli/internal"
+
+	"github.com/spf13/cobra"
+)
+
+var selftestCmd = &cobra.Command{
+	Use:   "selftest",
+	Short: "Check the Docker integration end to end with stand-in services",
+	Long: `Run the deploy pipeline against tiny alpine-based stand-ins for the app, PostgreSQL and
+Neo4j services: allocate and reserve ports, render the compose override and environment file,
+record the instance in instances.db, bring the project up with docker compose, probe its
+published ports and take everything down again. No GraphSense image is pulled, so the test
+finishes in well under a minute.
+
+Everything the test creates is removed afterwards, also when a stage fails. Exits with a
+non-zero status if any stage fails.`,
+	Args:         cobra.NoArgs,
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return runSelfTest()
+	},
+}
+
+func init() {
+	addOutputFlag(selftestCmd)
+}
+
+func runSelfTest() error {
+	structured, err := structuredOutput()
+	if err != nil {
+		return err
+	}
+
+	if !structured {
+		internal.Log.Info("Running self test...")
+		fmt.Println()
+	}
+	start := time.Now()
+	steps := internal.RunSelfTest()
+
+	failed := 0
+	for _, step := range steps {
+		if step.Status == internal.CheckFail {
+			failed++
+		}
+	}
+	if structured {
+		if err := printStructured(steps); err != nil {
+			return err
+		}
+	} else {
+		for _, step := range steps {
+			symbol := internal.Symbol("✅", internal.Localize(checkPassLabel, nil))
+			if step.Status == internal.CheckFail {
+				symbol = internal.Symbol("❌", internal.Localize(checkFailLabel, nil))
+			}
+			fmt.Printf("  %s %s (%s): %s\n", symbol, step.Name, step.Duration.Round(10*time.Millisecond), step.Detail)
+		}
+		fmt.Println()
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("%d of %d self test stages failed", failed, len(steps))
+	}
+	if !structured {
+		internal.Log.Success("Self test passed.", "duration", time.Since(start).Round(time.Second))
+	}
+	return nil
+}
@@ -0,0 +1,86 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+
+	"graphsense-cli/internal"
+
+	"github.com/nicksnyder/go-i18n/v2/i18n"
+	"github.com/spf13/cobra"
+)
+
+var (
+	selfUpdateYes      bool
+	selfUpdateForce    bool
+	selfUpdateInsecure bool
+)
+
+var selfUpdateCmd = &cobra.Command{
+	Use:   "self-update",
+	Short: "Update graphsense-cli to the latest release",
+	Long: `Download the latest release of graphsense-cli for this OS and architecture from GitHub,
+verify it and replace the running binary with it.
+
+The download is checked against the SHA-256 checksums published with the release, whose
+signature is verified with the release signing key built into graphsense-cli. Builds without
+that key refuse to update unless --insecure is given, which trusts the checksums unverified.
+The new binary is written next to the old one and renamed over it, so an interrupted update
+leaves the old binary in place.
+
+Development builds are not replaced unless --force is given, which also reinstalls the
+latest release when it is already installed.`,
+	Example: `  graphsense-cli self-update
+  sudo graphsense-cli self-update --yes`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return selfUpdate()
+	},
+}
+
+func init() {
+	selfUpdateCmd.Flags().BoolVarP(&selfUpdateYes, "yes", "y", false, "Update without asking for confirmation")
+	selfUpdateCmd.Flags().BoolVar(&selfUpdateForce, "force", false, "Install the latest release even if it is already installed or this is a development build")
+	selfUpdateCmd.Flags().BoolVar(&selfUpdateInsecure, "insecure", false, "Install the latest release with only its checksum verified when this build has no release signing key")
+}
+
+func selfUpdate() error {
+	// Refuse before asking anything; the download would fail the same way
+	if internal.ReleaseSigningKey == "" && !selfUpdateInsecure {
+		return internal.ErrNoReleaseSigningKey
+	}
+
+	ctx := context.Background()
+	release, err := internal.LatestRelease(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to look up the latest release: %v", err)
+	}
+
+	check := internal.NewReleaseCheck(release.TagName)
+	switch {
+	case selfUpdateForce:
+	case check.Development:
+		return fmt.Errorf("this is a development build (%s); use --force to replace it with release %s", internal.Version, release.TagName)
+	case !check.Newer:
+		internal.Log.Success("graphsense-cli is up to date", "version", internal.Version, "latest", release.TagName)
+		return nil
+	}
+
+	if !selfUpdateYes {
+		if !confirm(internal.Localize(&i18n.Message{ID: "ConfirmSelfUpdate", Other: "Update graphsense-cli from {{.Current}} to {{.Latest}}? (y/N): "}, map[string]any{"Current": internal.Version, "Latest": release.TagName})) {
+			internal.Log.Info("Cancelled.")
+			return nil
+		}
+	}
+
+	binary, err := internal.DownloadReleaseBinary(ctx, release, selfUpdateInsecure)
+	if err != nil {
+		return err
+	}
+	path, err := internal.ReplaceExecutable(binary)
+	if err != nil {
+		return err
+	}
+	internal.Log.Success("Updated graphsense-cli", "version", release.TagName, "path", path)
+	return nil
+}
@@ -0,0 +1,404 @@
+package cmd
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"graphsense-cli/internal"
+
+	"github.com/spf13/cobra"
+)
+
+// defaultLogTail is how many lines per container the logs endpoint returns by default
+const defaultLogTail = 100
+
+var serveListen string
+
+var serveCmd = &cobra.Command{
+	Use:   "serve",
+	Short: "Serve the management API over HTTP",
+	Long: `Serve an authenticated HTTP+JSON API for managing instances, so other tools can list,
+deploy, stop, start and remove instances and read their status and logs without running
+the CLI.
+
+Every request needs an "Authorization: Bearer <token>" header. The token is read from
+GRAPHSENSE_API_TOKEN, or from ~/.graphsense/api-token, which is generated on first use.
+
+Endpoints:
+  GET    /v1/instances                  List instances
+  POST   /v1/instances                  Deploy {"repo_path", "name", "port"} (asynchronous)
+  GET    /v1/instances/<name>           Show instance status
+  DELETE /v1/instances/<name>           Remove an instance (?keep_data=true keeps its volumes)
+  POST   /v1/instances/<name>/stop      Stop an instance
+  POST   /v1/instances/<name>/start     Start an instance
+  GET    /v1/instances/<name>/logs      Last log lines (?service=app&tail=100)
+  GET    /v1/operations/<id>            Progress of an asynchronous operation
+
+In read-only mode only GET requests are served; the others get 403 Forbidden.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return serveAPI(serveListen)
+	},
+}
+
+func init() {
+	serveCmd.Flags().StringVar(&serveListen, "listen", "127.0.0.1:7700", "Address to listen on, e.g. :7700 for all interfaces")
+}
+
+// apiOperation is a long-running operation started through the API
+type apiOperation struct {
+	ID         string     `json:"id"`
+	Action     string     `json:"action"`
+	Instance   string     `json:"instance"`
+	Status     string     `json:"status"`
+	Error      string     `json:"error,omitempty"`
+	StartedAt  time.Time  `json:"started_at"`
+	FinishedAt *time.Time `json:"finished_at,omitempty"`
+}
+
+// Statuses of an apiOperation
+const (
+	operationRunning   = "running"
+	operationSucceeded = "succeeded"
+	operationFailed    = "failed"
+)
+
+// apiServer serializes operations per instance and tracks asynchronous ones
+type apiServer struct {
+	token string
+
+	mu         sync.Mutex
+	busy       map[string]bool
+	operations map[string]*apiOperation
+	nextID     int
+}
+
+func serveAPI(listen string) error {
+	token, created, err := internal.LoadAPIToken()
+	if err != nil {
+		return err
+	}
+	if created {
+		path, _ := internal.APITokenFile()
+		internal.Log.Info("Generated an API token", "path", path)
+	}
+
+	api := &apiServer{
+		token:      token,
+		busy:       make(map[string]bool),
+		operations: make(map[string]*apiOperation),
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/v1/instances", api.authenticated(api.handleInstances))
+	mux.HandleFunc("/v1/instances/", api.authenticated(api.handleInstance))
+	mux.HandleFunc("/v1/operations/", api.authenticated(api.handleOperation))
+
+	server := &http.Server{
+		Addr:              listen,
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		server.Shutdown(shutdownCtx)
+	}()
+
+	internal.Log.Info("Serving the management API", "url", "http://"+listen+"/v1")
+	if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return fmt.Errorf("failed to serve API: %v", err)
+	}
+	return nil
+}
+
+// authenticated rejects requests without the API token
+func (a *apiServer) authenticated(handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(token), []byte(a.token)) != 1 {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			writeAPIError(w, http.StatusUnauthorized, fmt.Errorf("missing or invalid API token"))
+			return
+		}
+		internal.Log.Verbose("API request", "method", r.Method, "path", r.URL.Path, "remote", r.RemoteAddr)
+		handler(w, r)
+	}
+}
+
+// handleInstances serves /v1/instances
+func (a *apiServer) handleInstances(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		instances, err := collectInstanceStatuses("name", 0)
+		if err != nil {
+			writeAPIError(w, http.StatusInternalServerError, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, instances)
+	case http.MethodPost:
+		if readOnly {
+			writeAPIError(w, http.StatusForbidden, errReadOnly("deploy"))
+			return
+		}
+		a.deploy(w, r)
+	default:
+		writeAPIError(w, http.StatusMethodNotAllowed, fmt.Errorf("method %s not allowed", r.Method))
+	}
+}
+
+// deploy starts a deploy in the background and returns its operation
+func (a *apiServer) deploy(w http.ResponseWriter, r *http.Request) {
+	var request struct {
+		RepoPath string `json:"repo_path"`
+		Name     string `json:"name"`
+		Port     int    `json:"port"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		writeAPIError(w, http.StatusBadRequest, fmt.Errorf("invalid request body: %v", err))
+		return
+	}
+	if !filepath.IsAbs(request.RepoPath) {
+		writeAPIError(w, http.StatusBadRequest, fmt.Errorf("repo_path must be an absolute path"))
+		return
+	}
+
+	name := request.Name
+	if name == "" {
+		name = internal.GenerateInstanceName(request.RepoPath)
+	}
+	name = internal.SanitizeInstanceName(name)
+	if internal.InstanceExists(name) {
+		writeAPIError(w, http.StatusConflict, fmt.Errorf("instance '%s' already exists", name))
+		return
+	}
+
+	operation, err := a.start("deploy", name, func() error {
+		return deployInstance(request.RepoPath, name, request.Port)
+	})
+	if err != nil {
+		writeAPIError(w, http.StatusConflict, err)
+		return
+	}
+	writeJSON(w, http.StatusAccepted, operation)
+}
+
+// handleInstance serves /v1/instances/<name> and its actions
+func (a *apiServer) handleInstance(w http.ResponseWriter, r *http.Request) {
+	name, action, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/v1/instances/"), "/")
+	if name == "" || strings.Contains(action, "/") {
+		writeAPIError(w, http.StatusNotFound, fmt.Errorf("not found"))
+		return
+	}
+	if !internal.InstanceExists(name) {
+		writeAPIError(w, http.StatusNotFound, fmt.Errorf("instance '%s' does not exist", name))
+		return
+	}
+	if readOnly && r.Method != http.MethodGet {
+		writeAPIError(w, http.StatusForbidden, errReadOnly(fmt.Sprintf("%s %s", r.Method, r.URL.Path)))
+		return
+	}
+
+	switch {
+	case action == "" && r.Method == http.MethodGet:
+		status, err := internal.GetInstanceStatus(name)
+		if err != nil {
+			writeAPIError(w, http.StatusInternalServerError, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, status)
+	case action == "" && r.Method == http.MethodDelete:
+		keepData := r.URL.Query().Get("keep_data") == "true"
+		a.runNow(w, "remove", name, func() error {
+			return removeInstance(name, true, removeScopeFor(keepData), true)
+		})
+	case action == "stop" && r.Method == http.MethodPost:
+		a.runNow(w, "stop", name, func() error { return stopInstance(name) })
+	case action == "start" && r.Method == http.MethodPost:
+		a.runNow(w, "start", name, func() error { return startInstance(name) })
+	case action == "logs" && r.Method == http.MethodGet:
+		a.logs(w, r, name)
+	case action == "" || action == "stop" || action == "start" || action == "logs":
+		writeAPIError(w, http.StatusMethodNotAllowed, fmt.Errorf("method %s not allowed", r.Method))
+	default:
+		writeAPIError(w, http.StatusNotFound, fmt.Errorf("unknown action '%s'", action))
+	}
+}
+
+// logs returns the last lines of an instance's container logs
+func (a *apiServer) logs(w http.ResponseWriter, r *http.Request, name string) {
+	tail := defaultLogTail
+	if value := r.URL.Query().Get("tail"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n <= 0 {
+			writeAPIError(w, http.StatusBadRequest, fmt.Errorf("invalid tail '%s'", value))
+			return
+		}
+		tail = n
+	}
+
+	lines, err := instanceLogLines(r.Context(), name, r.URL.Query().Get("service"), tail)
+	if errors.Is(err, errNoSuchService) {
+		writeAPIError(w, http.StatusNotFound, err)
+		return
+	}
+	if err != nil {
+		writeAPIError(w, http.StatusInternalServerError, err)
+		return
+	}
+	if lines == nil {
+		lines = []internal.LogMatch{}
+	}
+	writeJSON(w, http.StatusOK, lines)
+}
+
+// errNoSuchService is returned for logs of a service an instance does not have
+var errNoSuchService = errors.New("no such service")
+
+// instanceLogLines returns the last tail lines of an instance's container logs, only those
+// of service when it is set
+func instanceLogLines(ctx context.Context, name, service string, tail int) ([]internal.LogMatch, error) {
+	sources, err := internal.GetLogSources([]string{name})
+	if err != nil {
+		return nil, err
+	}
+	if service != "" {
+		var selected []internal.LogSource
+		for _, source := range sources {
+			if source.Service == service {
+				selected = append(selected, source)
+			}
+		}
+		if len(selected) == 0 {
+			return nil, fmt.Errorf("instance '%s' has no service '%s': %w", name, service, errNoSuchService)
+		}
+		sources = selected
+	}
+
+	lines, err := internal.TailLogs(ctx, sources, tail)
+	if err != nil {
+		return nil, err
+	}
+	if lines == nil {
+		lines = []internal.LogMatch{}
+	}
+	return lines, nil
+}
+
+// handleOperation serves /v1/operations/<id>
+func (a *apiServer) handleOperation(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeAPIError(w, http.StatusMethodNotAllowed, fmt.Errorf("method %s not allowed", r.Method))
+		return
+	}
+
+	id := strings.TrimPrefix(r.URL.Path, "/v1/operations/")
+	a.mu.Lock()
+	operation, ok := a.operations[id]
+	var snapshot apiOperation
+	if ok {
+		snapshot = *operation
+	}
+	a.mu.Unlock()
+
+	if !ok {
+		writeAPIError(w, http.StatusNotFound, fmt.Errorf("operation '%s' does not exist", id))
+		return
+	}
+	writeJSON(w, http.StatusOK, snapshot)
+}
+
+// start runs action in the background, refusing to run two operations on one instance at once
+func (a *apiServer) start(action, instanceName string, run func() error) (apiOperation, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.busy[instanceName] {
+		return apiOperation{}, fmt.Errorf("another operation is running on instance '%s'", instanceName)
+	}
+	a.busy[instanceName] = true
+
+	a.nextID++
+	operation := &apiOperation{
+		ID:        strconv.Itoa(a.nextID),
+		Action:    action,
+		Instance:  instanceName,
+		Status:    operationRunning,
+		StartedAt: time.Now().UTC(),
+	}
+	a.operations[operation.ID] = operation
+
+	go func() {
+		err := run()
+
+		a.mu.Lock()
+		defer a.mu.Unlock()
+		finished := time.Now().UTC()
+		operation.FinishedAt = &finished
+		operation.Status = operationSucceeded
+		if err != nil {
+			operation.Status = operationFailed
+			operation.Error = err.Error()
+			internal.Log.Error("API operation failed", "action", action, "instance", instanceName, "error", err)
+		}
+		delete(a.busy, instanceName)
+	}()
+
+	return *operation, nil
+}
+
+// runNow runs action while the request waits and answers with its result
+func (a *apiServer) runNow(w http.ResponseWriter, action, instanceName string, run func() error) {
+	a.mu.Lock()
+	if a.busy[instanceName] {
+		a.mu.Unlock()
+		writeAPIError(w, http.StatusConflict, fmt.Errorf("another operation is running on instance '%s'", instanceName))
+		return
+	}
+	a.busy[instanceName] = true
+	a.mu.Unlock()
+
+	defer func() {
+		a.mu.Lock()
+		delete(a.busy, instanceName)
+		a.mu.Unlock()
+	}()
+
+	if err := run(); err != nil {
+		writeAPIError(w, http.StatusInternalServerError, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"instance": instanceName, "action": action, "status": operationSucceeded})
+}
+
+// writeJSON writes v as the JSON response body
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(v); err != nil {
+		internal.Log.Warning("Failed to write API response", "error", err)
+	}
+}
+
+// writeAPIError writes err as a JSON error response
+func writeAPIError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, map[string]string{"error": err.Error()})
+}
@@ -0,0 +1,111 @@
+package cmd
+
+import (
+	"fmt"
+
+	"graphsense-cli/internal"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	setIndexingWorkers   int
+	setIndexingBatchSize int
+	setIndexingNice      bool
+	setIndexingReset     bool
+)
+
+var setIndexingCmd = &cobra.Command{
+	Use:   "set-indexing <instance_name>",
+	Short: "Throttle how hard an instance indexes",
+	Long: `Change the indexing parallelism of an instance's app: the number of files indexed in
+parallel (--workers) and per batch (--batch-size). --nice keeps indexing in the background
+with one worker, small batches and a low CPU weight, so a laptop stays responsive while a
+large repository is indexed; --nice=false turns it off again. --reset returns to the app's
+defaults.
+
+Only the app service is recreated with the new settings; the databases keep running. The
+settings are recorded with the instance, so later upgrades and restarts keep them.`,
+	Example: `  graphsense-cli set-indexing my-analysis --nice
+  graphsense-cli set-indexing my-analysis --workers 2 --batch-size 50
+  graphsense-cli set-indexing my-analysis --reset`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		flags := cmd.Flags()
+		if !setIndexingReset && !flags.Changed("workers") && !flags.Changed("batch-size") && !flags.Changed("nice") {
+			return fmt.Errorf("nothing to change: use --workers, --batch-size, --nice or --reset")
+		}
+		return setIndexing(args[0], func(config *internal.DeployConfig) {
+			if setIndexingReset {
+				config.IndexWorkers, config.IndexBatchSize, config.Nice = 0, 0, false
+			}
+			if flags.Changed("workers") {
+				config.IndexWorkers = setIndexingWorkers
+			}
+			if flags.Changed("batch-size") {
+				config.IndexBatchSize = setIndexingBatchSize
+			}
+			if flags.Changed("nice") {
+				config.Nice = setIndexingNice
+			}
+		})
+	},
+}
+
+func init() {
+	setIndexingCmd.Flags().IntVar(&setIndexingWorkers, "workers", 0, "Number of files the app indexes in parallel, 0 for the app's default")
+	setIndexingCmd.Flags().IntVar(&setIndexingBatchSize, "batch-size", 0, "Number of files the app indexes per batch, 0 for the app's default")
+	setIndexingCmd.Flags().BoolVar(&setIndexingNice, "nice", false, "Index in the background: one worker, small batches and a low CPU weight")
+	setIndexingCmd.Flags().BoolVar(&setIndexingReset, "reset", false, "Return to the app's default indexing settings")
+}
+
+func setIndexing(instanceName string, change func(config *internal.DeployConfig)) error {
+	release, err := internal.LockInstance(instanceName)
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	if !internal.InstanceExists(instanceName) {
+		return fmt.Errorf("instance '%s' does not exist", instanceName)
+	}
+
+	config, err := internal.GetInstanceConfig(instanceName)
+	if err != nil {
+		return err
+	}
+	before := *config
+	change(config)
+	if err := internal.ValidateIndexing(config.IndexWorkers, config.IndexBatchSize); err != nil {
+		return err
+	}
+	if config.IndexWorkers == before.IndexWorkers && config.IndexBatchSize == before.IndexBatchSize && config.Nice == before.Nice {
+		internal.Log.Info("Indexing settings unchanged", "instance", instanceName)
+		return nil
+	}
+
+	coAPIKey, anthropicAPIKey, err := internal.LoadAPIKeys()
+	if err != nil {
+		if config.LocalEmbeddings() == nil {
+			return fmt.Errorf("failed to load API keys: %v", err)
+		}
+		internal.Log.Warning("No API keys loaded", "error", err)
+	}
+	config.CoAPIKey = coAPIKey
+	config.AnthropicAPIKey = anthropicAPIKey
+
+	internal.Log.Info("Recreating app service with the new indexing settings", "instance", instanceName)
+	if err := internal.RecreateApp(config); err != nil {
+		return err
+	}
+	if err := internal.SaveDeployment(config, internal.DeployStatusComplete); err != nil {
+		return fmt.Errorf("failed to record indexing settings: %v", err)
+	}
+
+	description := config.DescribeIndexing()
+	if description == "" {
+		description = "app defaults"
+	}
+	internal.Log.Success("Indexing settings changed", "instance", instanceName, "indexing", description)
+	return nil
+}
@@ -0,0 +1,81 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"graphsense-cli/internal"
+
+	"github.com/spf13/cobra"
+)
+
+var setLogLevelCmd = &cobra.Command{
+	Use:   "set-log-level <instance_name> <level>",
+	Short: "Change the log level of an instance's app",
+	Long: `Change the LOG_LEVEL of an instance's app to debug, info or warn without a redeploy.
+
+The level is applied through the app's admin API when it has one. Otherwise only the app
+service is recreated with the new level; the databases keep running. The level is recorded
+with the instance, so later upgrades and restarts keep it.`,
+	Args: cobra.ExactArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return setLogLevel(args[0], strings.ToLower(args[1]))
+	},
+}
+
+func setLogLevel(instanceName, level string) error {
+	release, err := internal.LockInstance(instanceName)
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	if err := internal.ValidateAppLogLevel(level); err != nil {
+		return err
+	}
+
+	if !internal.InstanceExists(instanceName) {
+		return fmt.Errorf("instance '%s' does not exist", instanceName)
+	}
+
+	config, err := internal.GetInstanceConfig(instanceName)
+	if err != nil {
+		return err
+	}
+	if config.AppLogLevel() == level {
+		internal.Log.Info("Log level unchanged", "instance", instanceName, "level", level)
+		return nil
+	}
+	config.LogLevel = level
+
+	err = internal.SetAppLogLevelAPI(config, level)
+	if err != nil {
+		if errors.Is(err, internal.ErrNoAdminAPI) {
+			internal.Log.Info("App has no admin API, recreating app service", "instance", instanceName)
+		} else {
+			internal.Log.Warning("Could not change log level through the admin API, recreating app service", "instance", instanceName, "error", err)
+		}
+
+		coAPIKey, anthropicAPIKey, err := internal.LoadAPIKeys()
+		if err != nil {
+			if config.LocalEmbeddings() == nil {
+				return fmt.Errorf("failed to load API keys: %v", err)
+			}
+			internal.Log.Warning("No API keys loaded", "error", err)
+		}
+		config.CoAPIKey = coAPIKey
+		config.AnthropicAPIKey = anthropicAPIKey
+
+		if err := internal.RecreateApp(config); err != nil {
+			return err
+		}
+	}
+
+	if err := internal.SaveDeployment(config, internal.DeployStatusComplete); err != nil {
+		return fmt.Errorf("failed to record log level: %v", err)
+	}
+
+	internal.Log.Success("Log level changed", "instance", instanceName, "level", level)
+	return nil
+}
@@ -0,0 +1,63 @@
+package cmd
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"graphsense-cli/internal"
+
+	"github.com/spf13/cobra"
+)
+
+var setTTLCmd = &cobra.Command{
+	Use:   "set-ttl <instance_name> <ttl|none>",
+	Short: "Change when an instance expires",
+	Long: `Let an instance expire this long from now, e.g. 72h, for 'gc' and 'supervise' to stop or
+remove it, or never with none. It replaces the TTL given with deploy --ttl, so it also
+extends the life of an instance gc warned about.`,
+	Example: `  graphsense-cli set-ttl my-analysis 168h
+  graphsense-cli set-ttl my-analysis none`,
+	Args: cobra.ExactArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return setTTL(args[0], strings.ToLower(args[1]))
+	},
+}
+
+func setTTL(instanceName, value string) error {
+	var ttl time.Duration
+	if value != "none" {
+		var err error
+		if ttl, err = time.ParseDuration(value); err != nil || ttl <= 0 {
+			return fmt.Errorf("invalid TTL '%s': must be a positive duration, e.g. 72h, or none", value)
+		}
+	}
+
+	release, err := internal.LockInstance(instanceName)
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	if !internal.InstanceExists(instanceName) {
+		return fmt.Errorf("instance '%s' does not exist", instanceName)
+	}
+	config, err := internal.GetInstanceConfig(instanceName)
+	if err != nil {
+		return err
+	}
+	config.ExpiresAt = time.Time{}
+	if ttl > 0 {
+		config.ExpiresAt = time.Now().Add(ttl)
+	}
+	if err := internal.SaveDeployment(config, internal.DeployStatusComplete); err != nil {
+		return fmt.Errorf("failed to record TTL: %v", err)
+	}
+
+	if config.ExpiresAt.IsZero() {
+		internal.Log.Success("Instance no longer expires", "instance", instanceName)
+	} else {
+		internal.Log.Success("TTL changed", "instance", instanceName, "expires", config.ExpiresAt.Local().Format(time.RFC3339))
+	}
+	return nil
+}
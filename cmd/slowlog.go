@@ -0,0 +1,124 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"graphsense-cli/internal"
+
+	"github.com/nicksnyder/go-i18n/v2/i18n"
+	"github.com/spf13/cobra"
+)
+
+var (
+	slowlogEnable    bool
+	slowlogDisable   bool
+	slowlogThreshold time.Duration
+	slowlogSince     time.Duration
+	slowlogTop       int
+)
+
+var slowlogCmd = &cobra.Command{
+	Use:   "slowlog <instance_name>",
+	Short: "Capture and summarize slow database queries",
+	Long: `Capture slow queries of an instance's databases and summarize the worst offenders.
+
+Run with --enable first to turn on PostgreSQL slow-statement logging and the Neo4j query
+log (written to the neo4j logs volume), reproduce the sluggish MCP requests, then run
+without flags to see which queries took the most time. Turn logging off with --disable.`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return slowlog(args[0])
+	},
+}
+
+func init() {
+	slowlogCmd.Flags().BoolVar(&slowlogEnable, "enable", false, "Turn on slow-query logging")
+	slowlogCmd.Flags().BoolVar(&slowlogDisable, "disable", false, "Turn off slow-query logging")
+	slowlogCmd.Flags().DurationVar(&slowlogThreshold, "threshold", 500*time.Millisecond, "Log queries slower than this")
+	slowlogCmd.Flags().DurationVar(&slowlogSince, "since", 24*time.Hour, "Only summarize queries logged this long ago")
+	slowlogCmd.Flags().IntVar(&slowlogTop, "top", 10, "Number of queries to show")
+	addOutputFlag(slowlogCmd)
+}
+
+func slowlog(instanceName string) error {
+	if slowlogEnable && slowlogDisable {
+		return fmt.Errorf("--enable and --disable cannot be used together")
+	}
+	if !internal.InstanceExists(instanceName) {
+		return fmt.Errorf("instance '%s' does not exist", instanceName)
+	}
+
+	if slowlogEnable || slowlogDisable {
+		versions, err := internal.GetEngineVersions(instanceName)
+		if err != nil {
+			return err
+		}
+
+		if slowlogDisable {
+			if err := internal.DisableSlowLog(instanceName, versions.Neo4j); err != nil {
+				return err
+			}
+			internal.Log.Success("Slow-query logging disabled.", "instance", instanceName)
+			return nil
+		}
+
+		if err := internal.EnableSlowLog(instanceName, versions.Neo4j, slowlogThreshold); err != nil {
+			return err
+		}
+		internal.Log.Success("Logging slow queries.", "instance", instanceName, "threshold", slowlogThreshold)
+		internal.Log.Info("Summarize them with 'graphsense-cli slowlog'", "instance", instanceName)
+		return nil
+	}
+
+	return showSlowQueries(instanceName)
+}
+
+func showSlowQueries(instanceName string) error {
+	structured, err := structuredOutput()
+	if err != nil {
+		return err
+	}
+
+	queries, err := internal.CollectSlowQueries(instanceName, slowlogSince)
+	if err != nil {
+		return err
+	}
+
+	summaries := internal.SummarizeSlowQueries(queries)
+	if slowlogTop > 0 && len(summaries) > slowlogTop {
+		summaries = summaries[:slowlogTop]
+	}
+
+	if structured {
+		return printStructured(summaries)
+	}
+
+	if len(summaries) == 0 {
+		internal.Log.Info("No slow queries logged. Is logging on? Turn it on with 'graphsense-cli slowlog --enable'", "instance", instanceName, "since", slowlogSince)
+		return nil
+	}
+
+	internal.Log.Info("Slowest queries by total time:", "instance", instanceName, "since", slowlogSince)
+	fmt.Println()
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 3, ' ', 0)
+	fmt.Fprintln(w, internal.Localize(&i18n.Message{ID: "SlowlogTableHeader", Other: "ENGINE\tCOUNT\tTOTAL\tMEAN\tMAX\tQUERY"}, nil))
+	for _, summary := range summaries {
+		fmt.Fprintf(w, "%s\t%d\t%.0fms\t%.0fms\t%.0fms\t%s\n",
+			summary.Engine, summary.Count, summary.TotalMs, summary.MeanMs, summary.MaxMs, truncate(summary.Query, 80))
+	}
+	return w.Flush()
+}
+
+// truncate shortens s to at most n runes, marking the cut with an ellipsis
+func truncate(s string, n int) string {
+	runes := []rune(s)
+	if len(runes) <= n {
+		return s
+	}
+	ellipsis := internal.Symbol("…", "...")
+	return string(runes[:n-len([]rune(ellipsis))]) + ellipsis
+}
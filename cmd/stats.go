@@ -0,0 +1,134 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+	"text/tabwriter"
+	"time"
+
+	"graphsense-cli/internal"
+
+	"github.com/docker/go-units"
+	"github.com/nicksnyder/go-i18n/v2/i18n"
+	"github.com/spf13/cobra"
+)
+
+var (
+	statsWatch    bool
+	statsInterval time.Duration
+)
+
+var statsCmd = &cobra.Command{
+	Use:   "stats [instance_name]",
+	Short: "Show the live CPU, memory and I/O usage of instances",
+	Long: `Show the CPU, memory, network and block I/O usage of instances, as docker stats does,
+with each instance's total followed by its app, postgres and neo4j containers. Without an
+instance name every instance is shown.
+
+Usage is read from the Docker stats API. CPU is measured over a second or two, and as with
+docker stats 100% is one CPU. Memory excludes the page cache and is shown against the
+container's memory limit, or the memory of the Docker host without one.
+
+With --watch the usage is refreshed every --interval until interrupted. With --output json or
+yaml every refresh prints a document of its own.`,
+	Example: `  graphsense-cli stats
+  graphsense-cli stats my-analysis --watch
+  graphsense-cli stats -o json`,
+	Args: cobra.MaximumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return showStats(args)
+	},
+}
+
+func init() {
+	statsCmd.Flags().BoolVarP(&statsWatch, "watch", "w", false, "Refresh the usage until interrupted")
+	statsCmd.Flags().DurationVar(&statsInterval, "interval", 2*time.Second, "How often --watch refreshes the usage")
+	addOutputFlag(statsCmd)
+}
+
+func showStats(args []string) error {
+	structured, err := structuredOutput()
+	if err != nil {
+		return err
+	}
+	if statsInterval <= 0 {
+		return fmt.Errorf("--interval must be positive")
+	}
+
+	names := args
+	if len(names) == 0 {
+		if names, err = internal.GetGraphsenseProjects(); err != nil {
+			return fmt.Errorf("failed to list instances: %v", err)
+		}
+	} else if !internal.InstanceExists(names[0]) {
+		return fmt.Errorf("instance '%s' does not exist", names[0])
+	}
+	if len(names) == 0 && !structured {
+		internal.Log.Info("No GraphSense instances found.")
+		return nil
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	// Redrawing in place needs a terminal that understands ANSI escapes
+	redraw := statsWatch && !structured && !internal.PlainOutput() && isTerminal(os.Stdout)
+	for {
+		report, err := internal.GetInstanceStats(ctx, names)
+		if ctx.Err() != nil {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		if structured {
+			err = printStructured(report)
+		} else {
+			if redraw {
+				fmt.Print("\033[H\033[2J")
+			} else if statsWatch {
+				fmt.Println(time.Now().Format(time.RFC3339))
+			}
+			err = printStats(report)
+		}
+		if err != nil || !statsWatch {
+			return err
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(statsInterval):
+		}
+		if !redraw && !structured {
+			fmt.Println()
+		}
+	}
+}
+
+// printStats prints the usage of instances as a table, each instance followed by its services
+func printStats(report []internal.InstanceStats) error {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 3, ' ', 0)
+	fmt.Fprintln(w, internal.Localize(&i18n.Message{ID: "StatsTableHeader", Other: "NAME\tCPU %\tMEM USAGE / LIMIT\tMEM %\tNET I/O\tBLOCK I/O"}, nil))
+	for _, instance := range report {
+		if !instance.Running {
+			fmt.Fprintf(w, "%s\t%s\t\t\t\t\n", instance.Instance, internal.Localize(&i18n.Message{ID: "StateStopped", Other: "stopped"}, nil))
+			continue
+		}
+		total := instance.Total
+		fmt.Fprintf(w, "%s\t%.2f%%\t%s\t\t%s\t%s\n", instance.Instance, total.CPUPercent, units.BytesSize(float64(total.MemoryBytes)), formatIO(total.NetworkRx, total.NetworkTx), formatIO(total.BlockRead, total.BlockWrite))
+		for _, service := range instance.Services {
+			fmt.Fprintf(w, "  %s\t%.2f%%\t%s / %s\t%.2f%%\t%s\t%s\n", service.Service, service.CPUPercent, units.BytesSize(float64(service.MemoryBytes)), units.BytesSize(float64(service.MemoryLimit)), service.MemoryPercent, formatIO(service.NetworkRx, service.NetworkTx), formatIO(service.BlockRead, service.BlockWrite))
+		}
+	}
+	return w.Flush()
+}
+
+// formatIO renders bytes in and out like docker stats, e.g. 1.2MB / 340kB
+func formatIO(in, out uint64) string {
+	return internal.FormatSize(int64(in)) + " / " + internal.FormatSize(int64(out))
+}
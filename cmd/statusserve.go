@@ -0,0 +1,143 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"strconv"
+	"sync"
+	"syscall"
+	"time"
+
+	"graphsense-cli/internal"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	statusServePort    int
+	statusServeAddress string
+	statusServeOnce    bool
+	statusServeTimeout time.Duration
+)
+
+var statusServeCmd = &cobra.Command{
+	Use:   "serve [instance_name...]",
+	Short: "Serve the status of instances as JSON over HTTP",
+	Long: `Serve the status of instances as JSON on / and /status, in the format of
+'status -o json', for uptime checkers and scripts that would rather use curl than run the
+CLI. Without instance names every instance is served, as by 'list -o json'.
+
+Every request reads the current state. With --once the command exits after answering the
+first request, so cron jobs and one-off checks need no daemon; --timeout makes it give up
+if no request arrives in time.`,
+	Example: `  graphsense-cli status serve --once --port 9401 &
+  curl -s http://127.0.0.1:9401/status`,
+	ValidArgsFunction: completeInstanceNamesRepeated,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return serveStatus(args, statusServeAddress, statusServePort, statusServeOnce, statusServeTimeout)
+	},
+}
+
+func init() {
+	statusServeCmd.Flags().IntVar(&statusServePort, "port", internal.DefaultStatusPort, "Port to serve the status on")
+	statusServeCmd.Flags().StringVar(&statusServeAddress, "address", "127.0.0.1", "Address to listen on (0.0.0.0 for all interfaces)")
+	statusServeCmd.Flags().BoolVar(&statusServeOnce, "once", false, "Exit after answering the first request")
+	statusServeCmd.Flags().DurationVar(&statusServeTimeout, "timeout", 0, "Give up if no request arrives within this long (e.g. 5m, 0 waits forever)")
+	statusCmd.AddCommand(statusServeCmd)
+}
+
+func serveStatus(instanceNames []string, address string, port int, once bool, timeout time.Duration) error {
+	for _, instanceName := range instanceNames {
+		if !internal.InstanceExists(instanceName) {
+			return fmt.Errorf("instance '%s' does not exist", instanceName)
+		}
+	}
+
+	served := make(chan struct{})
+	var servedOnce sync.Once
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/" && r.URL.Path != "/status" {
+			http.NotFound(w, r)
+			return
+		}
+		defer servedOnce.Do(func() { close(served) })
+
+		statuses, err := currentStatuses(instanceNames)
+		if err != nil {
+			internal.Log.Error("Failed to collect status", "error", err)
+			writeAPIError(w, http.StatusInternalServerError, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, statuses)
+	})
+
+	server := &http.Server{
+		Addr:              net.JoinHostPort(address, strconv.Itoa(port)),
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	// Listening first reports a port in use before anything waits for requests
+	listener, err := net.Listen("tcp", server.Addr)
+	if err != nil {
+		return fmt.Errorf("failed to serve status: %v", err)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	if !once {
+		served = nil
+	}
+
+	serveErr := make(chan error, 1)
+	go func() {
+		serveErr <- server.Serve(listener)
+	}()
+	internal.Log.Info("Serving status", "url", "http://"+server.Addr+"/status")
+
+	var result error
+	select {
+	case err := <-serveErr:
+		if !errors.Is(err, http.ErrServerClosed) {
+			return fmt.Errorf("failed to serve status: %v", err)
+		}
+	case <-served:
+	case <-ctx.Done():
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			result = fmt.Errorf("no request arrived within %s", timeout)
+		}
+	}
+
+	// Lets a response that is still being written finish
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	server.Shutdown(shutdownCtx)
+	return result
+}
+
+// currentStatuses returns the status of the given instances, or of every instance if none
+// are given
+func currentStatuses(instanceNames []string) ([]*internal.InstanceStatus, error) {
+	if len(instanceNames) == 0 {
+		return collectInstanceStatuses("name", 0)
+	}
+	statuses := []*internal.InstanceStatus{}
+	for _, instanceName := range instanceNames {
+		status, err := getStatus(instanceName)
+		if err != nil {
+			return nil, err
+		}
+		statuses = append(statuses, status)
+	}
+	return statuses, nil
+}
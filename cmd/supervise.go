@@ -0,0 +1,243 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"strconv"
+	"syscall"
+	"text/tabwriter"
+	"time"
+
+	"graphsense-cli/internal"
+
+	"github.com/nicksnyder/go-i18n/v2/i18n"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+var (
+	supervisorOptions = internal.DefaultSupervisorOptions
+	superviseDetach   bool
+	superviseSince    time.Duration
+	superviseLimit    int
+	superviseNoGC     bool
+)
+
+var superviseCmd = &cobra.Command{
+	Use:   "supervise",
+	Short: "Restart failing services of instances automatically",
+	Long: `Probe the services of every instance each --interval, as status does, and restart the
+container of a service that failed --failure-threshold probes in a row.
+
+A service restarted again waits --backoff after its first restart, doubling with every
+further restart up to --max-backoff. After --max-restarts restarts within --restart-window
+it is left alone until the window has passed, so a service that cannot start does not
+restart forever. Instances follow their autostart policy: those stopped with the stop
+command are not restarted unless their policy is always, and those with policy never are
+not supervised. Services of an instance another command is working on are skipped.
+
+Every 15 minutes the supervisor also stops or removes the instances that expired or were
+not used for long, as 'gc' does with the settings of the gc section of the config file,
+after warning about them. --no-gc leaves them alone.
+
+Everything the supervisor finds and does is recorded in instances.db; 'supervise history'
+shows it. Only one supervisor runs at a time. It runs until interrupted, or with --detach in
+the background, logging to ~/.graphsense/logs/supervise.log until 'supervise stop'.`,
+	Example: `  graphsense-cli supervise
+  graphsense-cli supervise --detach --interval 1m
+  graphsense-cli supervise history --since 168h`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if err := supervisorOptions.Validate(); err != nil {
+			return err
+		}
+		if superviseDetach {
+			return detachSupervisor(cmd)
+		}
+		return supervise()
+	},
+}
+
+var superviseStopCmd = &cobra.Command{
+	Use:   "stop",
+	Short: "Stop the running supervisor",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return stopSupervisor()
+	},
+}
+
+var superviseHistoryCmd = &cobra.Command{
+	Use:   "history [instance_name]",
+	Short: "Show what the supervisor found and did",
+	Long: `Show the supervisor's events, newest first: services that became unhealthy, were
+restarted or failed to restart, reached the restart limit and recovered, and instances that
+were about to be collected, were collected or could not be.`,
+	Args: cobra.MaximumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		var instanceName string
+		if len(args) > 0 {
+			instanceName = args[0]
+		}
+		return showSupervisorHistory(instanceName)
+	},
+}
+
+func init() {
+	superviseCmd.Flags().DurationVar(&supervisorOptions.Interval, "interval", internal.DefaultSupervisorOptions.Interval, "How often to probe every instance")
+	superviseCmd.Flags().IntVar(&supervisorOptions.FailureThreshold, "failure-threshold", internal.DefaultSupervisorOptions.FailureThreshold, "Number of failed probes in a row after which a service is restarted")
+	superviseCmd.Flags().DurationVar(&supervisorOptions.Backoff, "backoff", internal.DefaultSupervisorOptions.Backoff, "How long to wait after a service's first restart before restarting it again; doubles with every restart")
+	superviseCmd.Flags().DurationVar(&supervisorOptions.MaxBackoff, "max-backoff", internal.DefaultSupervisorOptions.MaxBackoff, "Longest wait between two restarts of a service")
+	superviseCmd.Flags().IntVar(&supervisorOptions.MaxRestarts, "max-restarts", internal.DefaultSupervisorOptions.MaxRestarts, "Number of restarts of a service within --restart-window after which it is left alone")
+	superviseCmd.Flags().DurationVar(&supervisorOptions.RestartWindow, "restart-window", internal.DefaultSupervisorOptions.RestartWindow, "Period --max-restarts counts restarts in")
+	superviseCmd.Flags().BoolVar(&superviseNoGC, "no-gc", false, "Do not stop or remove instances past their TTL or unused for long")
+	superviseCmd.Flags().BoolVarP(&superviseDetach, "detach", "d", false, "Run in the background, logging to ~/.graphsense/logs/supervise.log")
+
+	superviseHistoryCmd.Flags().DurationVar(&superviseSince, "since", 24*time.Hour, "Only include events from this long ago")
+	superviseHistoryCmd.Flags().IntVar(&superviseLimit, "limit", 50, "Number of events to show (0 for all)")
+	addOutputFlag(superviseHistoryCmd)
+
+	superviseCmd.AddCommand(superviseStopCmd)
+	superviseCmd.AddCommand(superviseHistoryCmd)
+}
+
+func supervise() error {
+	supervisor := internal.NewSupervisor(supervisorOptions)
+	if !superviseNoGC {
+		settings, err := internal.LoadConfig()
+		if err != nil {
+			return err
+		}
+		policy, err := settings.GC.Policy()
+		if err != nil {
+			return err
+		}
+		supervisor.GC = &policy
+		supervisor.Collect = collectInstance
+	}
+
+	release, err := internal.LockSupervisor()
+	if err != nil {
+		var locked *internal.LockedError
+		if errors.As(err, &locked) {
+			return fmt.Errorf("the supervisor is already running (%s); stop it with 'graphsense-cli supervise stop'", locked.Holder)
+		}
+		return err
+	}
+	defer release()
+
+	pidFile, err := internal.SupervisorPIDFile()
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(pidFile, []byte(strconv.Itoa(os.Getpid())), 0644); err != nil {
+		return fmt.Errorf("failed to write %s: %v", pidFile, err)
+	}
+	defer os.Remove(pidFile)
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	internal.Log.Info("Supervising instances", "interval", supervisorOptions.Interval.String(), "failure_threshold", supervisorOptions.FailureThreshold, "max_restarts", supervisorOptions.MaxRestarts, "restart_window", supervisorOptions.RestartWindow.String())
+	supervisor.Run(ctx)
+	internal.Log.Info("Supervisor stopped")
+	return nil
+}
+
+// detachSupervisor starts the supervisor in the background with the flags given to this
+// command and returns once it is running
+func detachSupervisor(cmd *cobra.Command) error {
+	pid, err := internal.RunningSupervisor()
+	if err != nil {
+		return err
+	}
+	if pid != 0 {
+		return fmt.Errorf("the supervisor is already running (pid %d); stop it with 'graphsense-cli supervise stop'", pid)
+	}
+	logFile, err := internal.SupervisorLogFile()
+	if err != nil {
+		return err
+	}
+
+	// The log file gets JSON records, which carry their time, unless --log-format says otherwise
+	args := []string{"supervise"}
+	if !cmd.Flags().Changed("log-format") {
+		args = append(args, "--log-format="+internal.LogFormatJSON)
+	}
+	cmd.Flags().Visit(func(flag *pflag.Flag) {
+		if flag.Name != "detach" {
+			args = append(args, fmt.Sprintf("--%s=%s", flag.Name, flag.Value.String()))
+		}
+	})
+
+	child, err := internal.StartDetached(args, logFile)
+	if err != nil {
+		return err
+	}
+	exited := make(chan error, 1)
+	go func() {
+		exited <- child.Wait()
+	}()
+	select {
+	case err := <-exited:
+		return fmt.Errorf("the supervisor exited right away (%v); see %s", err, logFile)
+	case <-time.After(time.Second):
+	}
+
+	internal.Log.Success("Supervisor started in the background", "pid", child.Process.Pid, "log", logFile)
+	internal.Log.Info("Stop it with 'graphsense-cli supervise stop'")
+	return nil
+}
+
+func stopSupervisor() error {
+	pid, err := internal.RunningSupervisor()
+	if err != nil {
+		return err
+	}
+	if pid == 0 {
+		internal.Log.Info("The supervisor is not running")
+		return nil
+	}
+	if err := internal.StopProcess(pid); err != nil {
+		return err
+	}
+
+	// The supervisor releases its lock once its current round of probes is done
+	deadline := time.Now().Add(30 * time.Second)
+	for time.Now().Before(deadline) {
+		if running, err := internal.RunningSupervisor(); err == nil && running == 0 {
+			internal.Log.Success("Supervisor stopped", "pid", pid)
+			return nil
+		}
+		time.Sleep(250 * time.Millisecond)
+	}
+	return fmt.Errorf("the supervisor (pid %d) did not stop within 30s", pid)
+}
+
+func showSupervisorHistory(instanceName string) error {
+	structured, err := structuredOutput()
+	if err != nil {
+		return err
+	}
+	events, err := internal.GetSupervisorEvents(instanceName, time.Now().Add(-superviseSince), superviseLimit)
+	if err != nil {
+		return err
+	}
+	if structured {
+		return printStructured(events)
+	}
+
+	if len(events) == 0 {
+		internal.Log.Info("No supervisor events.", "since", superviseSince)
+		return nil
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 3, ' ', 0)
+	fmt.Fprintln(w, internal.Localize(&i18n.Message{ID: "SupervisorTableHeader", Other: "TIME\tINSTANCE\tSERVICE\tACTION\tDETAIL"}, nil))
+	for _, event := range events {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", event.CreatedAt.Local().Format("2006-01-02 15:04:05"), event.Instance, event.Service, event.Action, event.Detail)
+	}
+	return w.Flush()
+}
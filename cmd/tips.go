@@ -0,0 +1,39 @@
+package cmd
+
+import (
+	"fmt"
+
+	"graphsense-cli/internal"
+
+	"github.com/spf13/cobra"
+)
+
+var tipsCmd = &cobra.Command{
+	Use:   "tips <instance_name>",
+	Short: "Show starter queries for a GraphSense instance",
+	Long:  "Show example MCP prompts and Cypher queries tailored to the languages of the instance's repository.",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return showTips(args[0])
+	},
+}
+
+func showTips(instanceName string) error {
+	config, err := internal.GetInstanceConfig(instanceName)
+	if err != nil {
+		return err
+	}
+
+	return printTips(config)
+}
+
+// printTips prints the onboarding tips for an instance
+func printTips(config *internal.DeployConfig) error {
+	tips, err := internal.RenderTips(config, internal.DetectLanguages(config.RepoPath))
+	if err != nil {
+		return err
+	}
+
+	fmt.Print(tips)
+	return nil
+}
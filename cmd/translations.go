@@ -0,0 +1,130 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"sort"
+
+	"graphsense-cli/internal"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	"gopkg.in/yaml.v3"
+)
+
+var translationsCmd = &cobra.Command{
+	Use:   "translations",
+	Short: "Work with translations of the CLI's messages",
+	Long: `Messages are shown in the language selected with GRAPHSENSE_LANG, the language setting in
+~/.graphsense/config.yaml or the LANG locale variable. Catalogs in ~/.graphsense/locales take
+precedence over the ones built into the CLI; messages a catalog lacks are shown in English.`,
+}
+
+var translationsTemplateCmd = &cobra.Command{
+	Use:   "template [language]",
+	Short: "Print a translation catalog to fill in",
+	Long: `Print a catalog of every message in YAML, keyed by message ID. Log messages, command
+descriptions and flag help are their own IDs; other messages show their English text in a
+comment. Translations already in the language's catalog are filled in; the others are empty.
+Save the output as ~/.graphsense/locales/<language>.yaml and translate the empty entries.`,
+	Args: cobra.MaximumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		language := internal.SourceLanguage
+		if len(args) == 1 {
+			language = args[0]
+		}
+		return printTranslationTemplate(language)
+	},
+}
+
+func init() {
+	translationsCmd.AddCommand(translationsTemplateCmd)
+}
+
+// sourceMessages are the English texts of the command tree, collected as it is localized
+var sourceMessages = make(map[string]bool)
+
+// localizeCommand translates the descriptions and flag help of a command and its subcommands
+func localizeCommand(cmd *cobra.Command) {
+	for _, text := range []*string{&cmd.Short, &cmd.Long} {
+		if *text != "" {
+			sourceMessages[*text] = true
+			*text = internal.T(*text)
+		}
+	}
+	localizeFlag := func(flag *pflag.Flag) {
+		if flag.Usage != "" {
+			sourceMessages[flag.Usage] = true
+			flag.Usage = internal.T(flag.Usage)
+		}
+	}
+	cmd.LocalFlags().VisitAll(localizeFlag)
+	cmd.PersistentFlags().VisitAll(localizeFlag)
+
+	for _, child := range cmd.Commands() {
+		localizeCommand(child)
+	}
+}
+
+// printTranslationTemplate prints the catalog of a language with every source message: the
+// messages of the English catalog and the descriptions and flag help of the command tree.
+// Messages whose ID is not their English text get that text as a comment.
+func printTranslationTemplate(language string) error {
+	source := make(map[string]string, len(sourceMessages))
+	for message := range sourceMessages {
+		source[message] = message
+	}
+	english, err := internal.LoadMessageFile(internal.SourceLanguage)
+	if err != nil {
+		return err
+	}
+	if english != nil {
+		for _, message := range english.Messages {
+			source[message.ID] = message.Other
+		}
+	}
+
+	translated := make(map[string]string)
+	if language == internal.SourceLanguage {
+		translated = source
+	} else {
+		existing, err := internal.LoadMessageFile(language)
+		if err != nil {
+			return err
+		}
+		if existing != nil {
+			for _, message := range existing.Messages {
+				translated[message.ID] = message.Other
+				// Translations of messages the CLI no longer has are kept
+				if _, ok := source[message.ID]; !ok {
+					source[message.ID] = message.Other
+				}
+			}
+		}
+	}
+
+	ids := make([]string, 0, len(source))
+	for id := range source {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	catalog := &yaml.Node{Kind: yaml.MappingNode}
+	for _, id := range ids {
+		key := &yaml.Node{Kind: yaml.ScalarNode, Value: id}
+		if source[id] != id {
+			key.HeadComment = source[id]
+		}
+		value := &yaml.Node{Kind: yaml.ScalarNode, Value: translated[id]}
+		if value.Value == "" {
+			// An empty string rather than null, which is no message
+			value.Style = yaml.DoubleQuotedStyle
+		}
+		catalog.Content = append(catalog.Content, key, value)
+	}
+
+	fmt.Printf("# Translations of graphsense-cli messages into %s, by message ID\n", language)
+	encoder := yaml.NewEncoder(os.Stdout)
+	encoder.SetIndent(2)
+	defer encoder.Close()
+	return encoder.Encode(catalog)
+}
@@ -0,0 +1,169 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"graphsense-cli/internal"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	uninstallYes         bool
+	uninstallPurge       bool
+	uninstallSkipScripts bool
+)
+
+var uninstallCmd = &cobra.Command{
+	Use:   "uninstall",
+	Short: "Remove every instance and the reverse proxy from this machine",
+	Long: `Tear down everything graphsense-cli created in Docker: every instance with its containers,
+networks and data volumes, including instances removed with --keep-data or --containers-only
+whose volumes were kept, and the reverse proxy. Database credentials stored in the OS keyring
+for the instances are deleted as well.
+
+With --purge, ~/.graphsense is deleted afterwards: instances.db, the config file, logs,
+backups, repository clones and certificates. It is kept if any instance failed to be
+removed, so uninstall can be run again.
+
+API keys stored with 'keys set' and the downloaded images are left alone. Remove them with
+'keys delete' and 'cleanup --images --keep 0'.`,
+	Example: `  graphsense-cli uninstall
+  graphsense-cli uninstall --purge --yes`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return uninstall()
+	},
+}
+
+func init() {
+	uninstallCmd.Flags().BoolVarP(&uninstallYes, "yes", "y", false, "Uninstall without asking for confirmation")
+	uninstallCmd.Flags().BoolVar(&uninstallPurge, "purge", false, "Also delete ~/.graphsense with instances.db, logs, backups and repository clones")
+	uninstallCmd.Flags().BoolVar(&uninstallSkipScripts, "skip-scripts", false, "Remove instances without running their pre_remove scripts")
+}
+
+func uninstall() error {
+	names, err := uninstallInstanceNames()
+	if err != nil {
+		return err
+	}
+	graphsenseDir, err := internal.GetGraphsenseDir()
+	if err != nil {
+		return err
+	}
+
+	if !uninstallYes {
+		if len(names) > 0 {
+			internal.Log.Warning(removeEverything.warning(), "instances", strings.Join(names, ", "))
+		}
+		internal.Log.Warning("The reverse proxy is removed.")
+		if uninstallPurge {
+			internal.Log.Warning("The GraphSense directory is deleted, including instances.db, logs, backups and repository clones.", "path", graphsenseDir)
+		}
+		if !confirm(internal.Localize(areYouSure, nil)) {
+			internal.Log.Info("Cancelled.")
+			return nil
+		}
+	}
+
+	var removeErr error
+	if len(names) > 0 {
+		removeErr = runBulk(names, uninstallInstance)
+	}
+
+	if err := internal.DisableProxy(); err != nil {
+		internal.Log.Warning("Failed to remove the reverse proxy", "error", err)
+	}
+
+	if removeErr != nil {
+		if uninstallPurge {
+			internal.Log.Warning("Keeping the GraphSense directory since not every instance was removed; run uninstall again", "path", graphsenseDir)
+		}
+		return removeErr
+	}
+
+	if uninstallPurge {
+		// The lock files are deleted along with the rest
+		internal.ReleaseLocks()
+		if err := os.RemoveAll(graphsenseDir); err != nil {
+			return fmt.Errorf("failed to delete %s: %v", graphsenseDir, err)
+		}
+		internal.Log.Info("Deleted the GraphSense directory", "path", graphsenseDir)
+	}
+
+	internal.Log.Success("graphsense-cli uninstalled", "instances", len(names))
+	internal.Log.Info("API keys in the OS keyring and downloaded images are kept. Remove them with 'graphsense-cli keys delete' and 'graphsense-cli cleanup --images --keep 0'")
+	return nil
+}
+
+// uninstallInstanceNames returns every instance graphsense-cli knows of: the compose projects
+// running its containers and the instances recorded in instances.db
+func uninstallInstanceNames() ([]string, error) {
+	projects, err := internal.GetGraphsenseProjects()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list instances: %v", err)
+	}
+	recorded, err := internal.GetInstanceNames()
+	if err != nil {
+		return nil, err
+	}
+
+	seen := make(map[string]bool)
+	var names []string
+	for _, name := range append(projects, recorded...) {
+		if !seen[name] {
+			seen[name] = true
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// uninstallInstance removes an instance and all its data. Instances whose containers are
+// already gone are removed from instances.db along with the volumes they kept.
+func uninstallInstance(instanceName string) error {
+	release, err := internal.LockInstance(instanceName)
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	if internal.InstanceExists(instanceName) {
+		return removeInstance(instanceName, true, removeEverything, !uninstallSkipScripts)
+	}
+
+	internal.Log.Info("Removing instance", "instance", instanceName)
+	docker, err := internal.GetDockerClient()
+	if err != nil {
+		return err
+	}
+	if err := docker.RemoveProject(context.Background(), instanceName); err != nil {
+		return fmt.Errorf("failed to remove data volumes: %v", err)
+	}
+
+	if config, _, err := internal.GetDeployment(instanceName); err == nil && config != nil {
+		if err := internal.RemoveManagedRepo(config); err != nil {
+			internal.Log.Warning("Failed to remove repository clone", "error", err)
+		}
+		if err := internal.DeleteInstanceCredentials(instanceName, config.CredentialStore); err != nil {
+			internal.Log.Warning("Failed to delete database credentials", "error", err)
+		}
+	}
+	if err := internal.DeleteInstanceTLS(instanceName); err != nil {
+		internal.Log.Warning("Failed to delete TLS certificate", "error", err)
+	}
+	if err := internal.RemoveInstanceContainers(instanceName); err != nil {
+		internal.Log.Warning("Failed to remove container information", "error", err)
+	}
+	internal.UnregisterMCP(instanceName)
+	if err := internal.RemoveDeployment(instanceName); err != nil {
+		return err
+	}
+	internal.Log.Success("Instance removed", "instance", instanceName)
+	return nil
+}
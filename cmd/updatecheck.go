@@ -0,0 +1,38 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"graphsense-cli/internal"
+
+	"github.com/nicksnyder/go-i18n/v2/i18n"
+	"github.com/spf13/cobra"
+)
+
+// notifyUpdates prints a notice to stderr when the CLI or an instance's app image is
+// significantly outdated. It stays silent for machine-readable output and completions.
+func notifyUpdates(cmd *cobra.Command) {
+	switch {
+	case quiet, logFormat == "json", outputFormat == "json", outputFormat == "yaml":
+		return
+	case cmd == versionCmd && versionCheck, cmd == selfUpdateCmd:
+		return
+	case cmd.Name() == "completion", cmd.Name() == cobra.ShellCompRequestCmd, cmd.Name() == cobra.ShellCompNoDescRequestCmd:
+		return
+	case internal.UpdateChecksDisabled():
+		return
+	}
+
+	notices := internal.CheckForUpdates(context.Background())
+	if len(notices) == 0 {
+		return
+	}
+
+	fmt.Fprintln(os.Stderr)
+	for _, notice := range notices {
+		fmt.Fprintln(os.Stderr, internal.Localize(&i18n.Message{ID: "UpdateAvailable", Other: "Update available for {{.Subject}}: {{.Current}} {{.Arrow}} {{.Latest}}. {{.Hint}}"}, map[string]any{"Subject": notice.Subject, "Current": notice.Current, "Arrow": internal.Arrow(), "Latest": notice.Latest, "Hint": notice.Hint}))
+	}
+	fmt.Fprintln(os.Stderr, internal.Localize(&i18n.Message{ID: "UpdateNoticesDisable", Other: "Disable these notices with 'update_check: {disabled: true}' in ~/.graphsense/config.yaml."}, nil))
+}
@@ -0,0 +1,341 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"graphsense-cli/internal"
+
+	"github.com/nicksnyder/go-i18n/v2/i18n"
+	"github.com/spf13/cobra"
+)
+
+var (
+	imageTag     string
+	migrateStore bool
+	upgradeYes   bool
+)
+
+var upgradeCmd = &cobra.Command{
+	Use:   "upgrade <instance_name>",
+	Short: "Upgrade a GraphSense instance to new images",
+	Long: `Pull the latest GraphSense images (or the tag given with --image-tag) and recreate
+the instance's containers. Named volumes are preserved, so the indexed graph survives the upgrade.
+
+The PostgreSQL and Neo4j versions of every instance are recorded at deploy time. Upgrades that
+would cross a major version of either engine change its on-disk store format and are refused
+unless --migrate-store is given, which backs up both databases, recreates them empty on the new
+version and loads the backup into them.
+
+Before anything is changed, the environment and images the upgrade would apply are compared
+with what the instance runs now. Differences are shown as a diff and need confirmation,
+unless --yes is given.`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return upgradeInstance(args[0], imageTag, migrateStore)
+	},
+}
+
+func init() {
+	upgradeCmd.Flags().StringVar(&imageTag, "image-tag", "", "Pin the GraphSense app image to this tag (default: keep current tag and pull latest)")
+	upgradeCmd.Flags().BoolVar(&migrateStore, "migrate-store", false, "Dump and reload the databases when the upgrade crosses a major engine version")
+	upgradeCmd.Flags().BoolVarP(&upgradeYes, "yes", "y", false, "Apply configuration changes without asking for confirmation")
+}
+
+func upgradeInstance(instanceName, tag string, migrate bool) error {
+	release, err := internal.LockInstance(instanceName)
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	if !internal.InstanceExists(instanceName) {
+		return fmt.Errorf("instance '%s' does not exist", instanceName)
+	}
+
+	config, err := internal.GetInstanceConfig(instanceName)
+	if err != nil {
+		return err
+	}
+
+	oldImages, err := internal.GetContainerImages(instanceName)
+	if err != nil {
+		return err
+	}
+
+	if tag != "" {
+		current, ok := oldImages["app"]
+		if !ok {
+			return fmt.Errorf("cannot pin image tag: no app container found for instance '%s'", instanceName)
+		}
+		config.AppImage = internal.ImageWithTag(current.Image, tag)
+		internal.Log.Info("Pinning app image", "image", config.AppImage)
+	}
+
+	coAPIKey, anthropicAPIKey, err := internal.LoadAPIKeys()
+	if err != nil {
+		if config.LocalEmbeddings() == nil {
+			return fmt.Errorf("failed to load API keys: %v", err)
+		}
+		internal.Log.Warning("No API keys loaded", "error", err)
+	}
+	config.CoAPIKey = coAPIKey
+	config.AnthropicAPIKey = anthropicAPIKey
+
+	proceed, err := reviewConfigChanges(config, upgradeYes)
+	if err != nil {
+		return err
+	}
+	if !proceed {
+		internal.Log.Info("Cancelled.")
+		return nil
+	}
+
+	if config.IsSingleContainer() {
+		err = upgradeSingleContainer(config)
+	} else {
+		err = upgradeCompose(config, migrate)
+	}
+	if err != nil {
+		return err
+	}
+
+	if err := internal.SaveDeployment(config, internal.DeployStatusComplete); err != nil {
+		internal.Log.Warning("Failed to record deployment", "error", err)
+	}
+	internal.RecordIndexedCommit(config)
+	// Single-container apps are recreated without the proxy's network
+	syncProxyRoutes()
+
+	if _, err := internal.WaitForHealthy(context.Background(), config, internal.DefaultHealthOptions); err != nil {
+		internal.Log.Warning("Health check failed, but continuing", "error", err)
+	}
+
+	if err := internal.TouchInstance(instanceName, "upgraded"); err != nil {
+		internal.Log.Warning("Failed to record activity", "error", err)
+	}
+	if err := internal.SetInstanceStopped(instanceName, false); err != nil {
+		internal.Log.Warning("Failed to record instance state", "error", err)
+	}
+
+	newImages, err := internal.GetContainerImages(instanceName)
+	if err != nil {
+		return err
+	}
+	if err := internal.SaveDeployedImages(instanceName, internal.DeployedImagesOf(newImages)); err != nil {
+		internal.Log.Warning("Failed to record image digests", "error", err)
+	}
+
+	internal.Log.Info("Image changes:")
+	printImageChanges(oldImages, newImages)
+
+	internal.Log.Success("Instance upgraded", "instance", instanceName)
+	return nil
+}
+
+// upgradeEngineVersions returns the database engine versions of the images a compose configuration will run
+func upgradeEngineVersions(files *internal.ComposeFiles, envVars map[string]string) (internal.EngineVersions, error) {
+	var versions internal.EngineVersions
+
+	images, err := internal.GetComposeImages(files, envVars)
+	if err != nil {
+		return versions, err
+	}
+
+	if image := images["postgres"]; image != "" {
+		if versions.Postgres, err = internal.GetImageEngineVersion("postgres", image); err != nil {
+			return versions, err
+		}
+	}
+	if image := images["neo4j"]; image != "" {
+		if versions.Neo4j, err = internal.GetImageEngineVersion("neo4j", image); err != nil {
+			return versions, err
+		}
+	}
+
+	return versions, nil
+}
+
+// upgradeCompose pulls new images for a compose instance and recreates its containers,
+// migrating the database stores when the new images cross a store format boundary
+func upgradeCompose(config *internal.DeployConfig, migrate bool) error {
+	instanceName := config.InstanceName
+
+	files, err := internal.PrepareComposeFiles(config)
+	if err != nil {
+		return err
+	}
+	defer files.Cleanup()
+
+	envVars := map[string]string{
+		"COMPOSE_PROJECT_NAME": instanceName,
+	}
+
+	internal.Log.Info("Pulling images for instance", "instance", instanceName)
+	if err := internal.RunDockerCompose(files.Args("pull"), files.Env(envVars)); err != nil {
+		return fmt.Errorf("failed to pull images for instance %s: %v", instanceName, err)
+	}
+
+	// Guard against engine upgrades that change the on-disk store format
+	oldVersions := internal.EngineVersions{Postgres: config.PostgresVersion, Neo4j: config.Neo4jVersion}
+	if oldVersions.Postgres == "" || oldVersions.Neo4j == "" {
+		if live, err := internal.GetEngineVersions(instanceName); err == nil {
+			oldVersions = live
+		}
+	}
+
+	newVersions, err := upgradeEngineVersions(files, envVars)
+	if err != nil {
+		return err
+	}
+
+	crossed := internal.StoreBoundaries(oldVersions, newVersions)
+	if len(crossed) > 0 && !migrate {
+		return fmt.Errorf("upgrade crosses an incompatible storage format boundary (%s). Re-run with --migrate-store to dump and reload the data", strings.Join(crossed, ", "))
+	}
+
+	if len(crossed) > 0 {
+		internal.Log.Warning("Migrating stores across storage format boundaries", "boundaries", strings.Join(crossed, ", "))
+		if err := migrateStores(config, files, envVars); err != nil {
+			return fmt.Errorf("failed to migrate stores of instance %s: %v", instanceName, err)
+		}
+	} else {
+		// up -d only recreates containers whose image or configuration changed and keeps named volumes
+		internal.Log.Info("Recreating containers for instance", "instance", instanceName)
+		if err := internal.RunDockerCompose(files.Args("up", "-d"), files.Env(envVars)); err != nil {
+			return fmt.Errorf("failed to recreate instance %s: %v", instanceName, err)
+		}
+	}
+
+	if newVersions.Postgres != "" {
+		config.PostgresVersion = newVersions.Postgres
+	}
+	if newVersions.Neo4j != "" {
+		config.Neo4jVersion = newVersions.Neo4j
+	}
+	internal.Log.Info("Database versions", "from", oldVersions.String(), "to", newVersions.String())
+
+	return nil
+}
+
+// upgradeSingleContainer pulls the image of a single-container instance and recreates its container.
+// The data volume is kept.
+func upgradeSingleContainer(config *internal.DeployConfig) error {
+	image := internal.SingleContainerImage(config)
+	internal.Log.Info("Pulling image", "image", image)
+	pull := internal.Command("docker", "pull", image)
+	pull.Stdout = os.Stdout
+	pull.Stderr = os.Stderr
+	if err := pull.Run(); err != nil {
+		return fmt.Errorf("failed to pull %s: %v", image, err)
+	}
+
+	docker, err := internal.GetDockerClient()
+	if err != nil {
+		return err
+	}
+
+	internal.Log.Info("Recreating container for instance", "instance", config.InstanceName)
+	if err := docker.RemoveContainer(context.Background(), config.InstanceName+"-app"); err != nil {
+		return err
+	}
+	return internal.RunSingleContainer(config)
+}
+
+// migrateStores moves an instance's data to new database engine versions by backing up both
+// databases, recreating their volumes empty on the new images and loading the backup
+func migrateStores(config *internal.DeployConfig, files *internal.ComposeFiles, envVars map[string]string) error {
+	instanceName := config.InstanceName
+
+	backupDir, err := internal.GetBackupDir()
+	if err != nil {
+		return err
+	}
+
+	internal.Log.Info("Backing up databases before migration...")
+	archivePath, err := internal.CreateBackup(config, backupDir)
+	if err != nil {
+		return err
+	}
+	if info, err := os.Stat(archivePath); err == nil {
+		if err := internal.StoreBackup(instanceName, archivePath, info.Size()); err != nil {
+			internal.Log.Warning("Failed to record backup", "error", err)
+		}
+	}
+	internal.Log.Info("Pre-migration backup written", "path", archivePath)
+
+	workDir, err := internal.NewBackupWorkDir("graphsense-migrate-*")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(workDir)
+
+	metadata, err := internal.ExtractBackup(archivePath, workDir)
+	if err != nil {
+		return err
+	}
+	// The data volumes are removed next, so the backup must be loadable
+	if err := internal.CheckRestorable(instanceName, workDir); err != nil {
+		return fmt.Errorf("cannot migrate, the data volumes were left alone: %v", err)
+	}
+
+	// Containers must be gone before their data volumes can be removed
+	if err := internal.RunDockerCompose(files.Args("down"), files.Env(envVars)); err != nil {
+		return err
+	}
+
+	docker, err := internal.GetDockerClient()
+	if err != nil {
+		return err
+	}
+	for _, volume := range []string{instanceName + "_postgres_data", instanceName + "_neo4j_data"} {
+		if err := docker.RemoveVolume(context.Background(), volume); err != nil {
+			return fmt.Errorf("failed to remove data volumes: %v", err)
+		}
+	}
+
+	internal.Log.Info("Starting instance on new database versions", "instance", instanceName)
+	if err := internal.RunDockerCompose(files.Args("up", "-d"), files.Env(envVars)); err != nil {
+		return err
+	}
+
+	if _, err := internal.WaitForHealthy(context.Background(), config, internal.DefaultHealthOptions); err != nil {
+		internal.Log.Warning("Health check failed, but continuing", "error", err)
+	}
+
+	return internal.RestoreBackup(instanceName, workDir, metadata)
+}
+
+// printImageChanges prints the old and new image digest of every service
+func printImageChanges(oldImages, newImages map[string]internal.ContainerImage) {
+	var services []string
+	for service := range newImages {
+		services = append(services, service)
+	}
+	sort.Strings(services)
+
+	for _, service := range services {
+		newImage := newImages[service]
+		oldImage, ok := oldImages[service]
+
+		switch {
+		case !ok:
+			fmt.Println(internal.Localize(&i18n.Message{ID: "UpgradeImageNew", Other: "  {{.Service}}: (new) {{.Arrow}} {{.Digest}}"}, map[string]any{"Service": service, "Arrow": internal.Arrow(), "Digest": imageDigest(newImage)}))
+		case oldImage.ID == newImage.ID:
+			fmt.Println(internal.Localize(&i18n.Message{ID: "UpgradeImageUnchanged", Other: "  {{.Service}}: unchanged ({{.Digest}})"}, map[string]any{"Service": service, "Digest": imageDigest(newImage)}))
+		default:
+			fmt.Printf("  %s: %s %s %s\n", service, imageDigest(oldImage), internal.Arrow(), imageDigest(newImage))
+		}
+	}
+}
+
+// imageDigest returns the most specific identifier available for an image
+func imageDigest(image internal.ContainerImage) string {
+	if image.Digest != "" {
+		return image.Digest
+	}
+	return fmt.Sprintf("%s (%s)", image.Image, image.ID)
+}
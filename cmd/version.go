@@ -0,0 +1,95 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"graphsense-cli/internal"
+
+	"github.com/nicksnyder/go-i18n/v2/i18n"
+	"github.com/spf13/cobra"
+)
+
+var versionCheck bool
+
+var versionCmd = &cobra.Command{
+	Use:   "version",
+	Short: "Show the version of the CLI and of Docker",
+	Long: `Show the version, commit and build date of graphsense-cli along with the versions of the
+Docker engine and Docker Compose it found.
+
+--check also asks GitHub for the latest release and reports whether a newer one is
+available. Development builds without a stamped version are never reported as outdated.`,
+	Example: `  graphsense-cli version
+  graphsense-cli version --check
+  graphsense-cli version -o json`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return showVersion()
+	},
+}
+
+func init() {
+	versionCmd.Flags().BoolVar(&versionCheck, "check", false, "Check GitHub for a newer release")
+	addOutputFlag(versionCmd)
+}
+
+// versionReport is the output of the version command
+type versionReport struct {
+	internal.BuildInfo `yaml:",inline"`
+	Release            *internal.ReleaseCheck `json:"release,omitempty" yaml:"release,omitempty"`
+}
+
+func showVersion() error {
+	structured, err := structuredOutput()
+	if err != nil {
+		return err
+	}
+
+	report := versionReport{BuildInfo: internal.GetBuildInfo(context.Background())}
+	if versionCheck {
+		check, err := internal.CheckLatestRelease(context.Background())
+		if err != nil {
+			return err
+		}
+		report.Release = &check
+	}
+
+	if structured {
+		return printStructured(report)
+	}
+
+	fmt.Printf("graphsense-cli %s\n", report.Version)
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 1, ' ', 0)
+	fmt.Fprintf(w, "  %s\t%s\n", internal.Localize(&i18n.Message{ID: "VersionCommit", Other: "Commit:"}, nil), orUnknown(report.Commit))
+	fmt.Fprintf(w, "  %s\t%s\n", internal.Localize(&i18n.Message{ID: "VersionBuilt", Other: "Built:"}, nil), orUnknown(report.BuildDate))
+	fmt.Fprintf(w, "  %s\t%s (%s)\n", internal.Localize(&i18n.Message{ID: "VersionGo", Other: "Go:"}, nil), report.GoVersion, report.Platform)
+	fmt.Fprintf(w, "  %s\t%s\n", internal.Localize(&i18n.Message{ID: "VersionDocker", Other: "Docker:"}, nil), report.Docker)
+	fmt.Fprintf(w, "  %s\t%s\n", internal.Localize(&i18n.Message{ID: "VersionCompose", Other: "Compose:"}, nil), report.Compose)
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	if report.Release != nil {
+		fmt.Println()
+		switch {
+		case report.Release.Newer:
+			fmt.Println(internal.Localize(&i18n.Message{ID: "VersionNewerRelease", Other: "A newer release is available: {{.Current}} {{.Arrow}} {{.Latest}}. Download it from {{.URL}}"}, map[string]any{"Current": report.Version, "Arrow": internal.Arrow(), "Latest": report.Release.Latest, "URL": internal.ReleasesURL}))
+		case report.Release.Development:
+			fmt.Println(internal.Localize(&i18n.Message{ID: "VersionDevelopmentBuild", Other: "This is a development build; the latest release is {{.Latest}}"}, map[string]any{"Latest": report.Release.Latest}))
+		default:
+			fmt.Println(internal.Localize(&i18n.Message{ID: "VersionUpToDate", Other: "graphsense-cli is up to date (latest release {{.Latest}})"}, map[string]any{"Latest": report.Release.Latest}))
+		}
+	}
+	return nil
+}
+
+// orUnknown returns value, or "unknown" if it is empty
+func orUnknown(value string) string {
+	if value == "" {
+		return "unknown"
+	}
+	return value
+}
@@ -0,0 +1,74 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"graphsense-cli/internal"
+
+	"github.com/spf13/cobra"
+)
+
+var watchCmd = &cobra.Command{
+	Use:   "watch <instance_name>",
+	Short: "Reindex changed files as the repository is edited",
+	Long: `Watch the working tree of an instance and send changed files to its app for incremental
+reindexing, so the graph follows the code as it is edited.
+
+Changes are picked up from file system notifications as files are saved, collected until the
+tree has been quiet for --debounce and then sent in one batch. .git and node_modules are
+ignored, as are submodules hidden with --no-submodules. Runs until interrupted.
+
+On Linux every directory of the tree takes an inotify watch; for very large repositories
+raise fs.inotify.max_user_watches if watch says there are too many directories.`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return watchInstance(args[0])
+	},
+}
+
+var watchOptions internal.WatchOptions
+
+func init() {
+	watchCmd.Flags().DurationVar(&watchOptions.Debounce, "debounce", internal.DefaultWatchDebounce, "How long the tree must be quiet before changes are reindexed")
+}
+
+func watchInstance(instanceName string) error {
+	if err := watchOptions.Validate(); err != nil {
+		return err
+	}
+	if !internal.InstanceExists(instanceName) {
+		return fmt.Errorf("instance '%s' does not exist", instanceName)
+	}
+	config, err := internal.GetInstanceConfig(instanceName)
+	if err != nil {
+		return err
+	}
+	running, err := internal.AppRunning(instanceName)
+	if err != nil {
+		return err
+	}
+	if !running {
+		return fmt.Errorf("instance '%s' is not running; start it first", instanceName)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	internal.Log.Info("Watching for changes, press Ctrl+C to stop", "instance", instanceName, "repo", config.RepoPath)
+	err = internal.WatchRepository(ctx, config, watchOptions, func(result internal.ReindexResult) {
+		if result.Err != nil {
+			internal.Log.Warning("Failed to reindex changed files", "files", len(result.Paths), "error", result.Err)
+			return
+		}
+		internal.Log.Info("Reindexing changed files", "files", len(result.Paths), "paths", internal.SummarizePaths(result.Paths, 3))
+	})
+	if err != nil {
+		return err
+	}
+	internal.Log.Info("Stopped watching", "instance", instanceName)
+	return nil
+}
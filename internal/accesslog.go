@@ -0,0 +1,257 @@
+package internal
+
+import (
+	"database/sql"
+	"encoding/json"
+	"math"
+	"net"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+// AccessEntry is one request proxied to an instance's MCP endpoint
+type AccessEntry struct {
+	InstanceName string    `json:"instance_name" yaml:"instance_name"`
+	Client       string    `json:"client" yaml:"client"`
+	RemoteAddr   string    `json:"remote_addr" yaml:"remote_addr"`
+	Method       string    `json:"method" yaml:"method"`
+	Path         string    `json:"path" yaml:"path"`
+	Status       int       `json:"status" yaml:"status"`
+	LatencyMs    float64   `json:"latency_ms" yaml:"latency_ms"`
+	CreatedAt    time.Time `json:"created_at" yaml:"created_at"`
+}
+
+// AccessSummary aggregates the access log of an instance
+type AccessSummary struct {
+	Requests     int            `json:"requests" yaml:"requests"`
+	Errors       int            `json:"errors" yaml:"errors"`
+	Clients      map[string]int `json:"clients" yaml:"clients"`
+	P50LatencyMs float64        `json:"p50_latency_ms" yaml:"p50_latency_ms"`
+	P95LatencyMs float64        `json:"p95_latency_ms" yaml:"p95_latency_ms"`
+	MaxLatencyMs float64        `json:"max_latency_ms" yaml:"max_latency_ms"`
+}
+
+// statusRecorder captures the status code written by a handler
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+// Flush keeps streaming responses (MCP uses server-sent events) working through the recorder
+func (r *statusRecorder) Flush() {
+	if flusher, ok := r.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// accessLogBuffer is how many entries an AccessRecorder holds before requests drop theirs
+const accessLogBuffer = 1024
+
+// accessLogBatch is the most entries an AccessRecorder writes in one transaction
+const accessLogBatch = 256
+
+// AccessRecorder writes access log entries in the background, so requests never wait for the
+// database. Entries that arrive while a batch is written go into the next one, on a database
+// connection shared by every request.
+type AccessRecorder struct {
+	db      *sql.DB
+	entries chan AccessEntry
+	stop    chan struct{}
+	done    chan struct{}
+}
+
+// NewAccessRecorder opens the database and starts writing the entries recorded with it
+func NewAccessRecorder() (*AccessRecorder, error) {
+	db, err := InitDB()
+	if err != nil {
+		return nil, err
+	}
+	r := &AccessRecorder{
+		db:      db,
+		entries: make(chan AccessEntry, accessLogBuffer),
+		stop:    make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+	go r.run()
+	return r, nil
+}
+
+// Record queues an entry to be written. A full buffer drops it rather than holding up the request.
+func (r *AccessRecorder) Record(entry AccessEntry) {
+	select {
+	case r.entries <- entry:
+	default:
+		Log.Debug("Access log buffer is full, dropping request", "instance", entry.InstanceName)
+	}
+}
+
+// Close writes the entries still buffered and closes the database. Entries recorded after
+// Close are not written.
+func (r *AccessRecorder) Close() error {
+	close(r.stop)
+	<-r.done
+	return r.db.Close()
+}
+
+func (r *AccessRecorder) run() {
+	defer close(r.done)
+	for {
+		select {
+		case entry := <-r.entries:
+			r.write(r.drain([]AccessEntry{entry}))
+		case <-r.stop:
+			for batch := r.drain(nil); len(batch) > 0; batch = r.drain(nil) {
+				r.write(batch)
+			}
+			return
+		}
+	}
+}
+
+// drain adds the entries waiting in the buffer to batch, up to accessLogBatch
+func (r *AccessRecorder) drain(batch []AccessEntry) []AccessEntry {
+	for len(batch) < accessLogBatch {
+		select {
+		case entry := <-r.entries:
+			batch = append(batch, entry)
+		default:
+			return batch
+		}
+	}
+	return batch
+}
+
+func (r *AccessRecorder) write(batch []AccessEntry) {
+	if err := recordAccess(r.db, batch); err != nil {
+		Log.Warning("Failed to record access", "requests", len(batch), "error", err)
+	}
+}
+
+// AccessLogHandler wraps a handler serving an instance's MCP endpoint so that recorder records
+// every request in the access log, where it counts as use of the instance
+func AccessLogHandler(recorder *AccessRecorder, instanceName string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		start := time.Now()
+		status := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+
+		next.ServeHTTP(status, req)
+
+		recorder.Record(AccessEntry{
+			InstanceName: instanceName,
+			Client:       clientIdentity(req.Header, req.RemoteAddr),
+			RemoteAddr:   req.RemoteAddr,
+			Method:       req.Method,
+			Path:         req.URL.Path,
+			Status:       status.status,
+			LatencyMs:    float64(time.Since(start).Microseconds()) / 1000,
+			CreatedAt:    start,
+		})
+	})
+}
+
+// clientIdentity names the client of a request, preferring an explicit client id header
+func clientIdentity(header http.Header, remoteAddr string) string {
+	if client := header.Get("X-Client-Id"); client != "" {
+		return client
+	}
+	if agent := header.Get("User-Agent"); agent != "" {
+		return agent
+	}
+	if host, _, err := net.SplitHostPort(remoteAddr); err == nil {
+		return host
+	}
+	return remoteAddr
+}
+
+// proxyAccessLine is the part of a line of the reverse proxy's JSON access log that the access
+// log keeps
+type proxyAccessLine struct {
+	Timestamp float64 `json:"ts"`
+	Request   struct {
+		RemoteIP   string      `json:"remote_ip"`
+		RemotePort string      `json:"remote_port"`
+		Method     string      `json:"method"`
+		Host       string      `json:"host"`
+		URI        string      `json:"uri"`
+		Headers    http.Header `json:"headers"`
+	} `json:"request"`
+	// Duration is in seconds
+	Duration float64 `json:"duration"`
+	Status   int     `json:"status"`
+}
+
+// parseProxyAccessLine turns a line of the reverse proxy's access log into an entry of the
+// instance it routes the request's host to. Lines of other hosts are skipped.
+func parseProxyAccessLine(data []byte) (AccessEntry, bool) {
+	var line proxyAccessLine
+	if err := json.Unmarshal(data, &line); err != nil {
+		return AccessEntry{}, false
+	}
+	host := line.Request.Host
+	if name, _, err := net.SplitHostPort(host); err == nil {
+		host = name
+	}
+	instanceName, ok := strings.CutSuffix(host, "."+ProxyDomain)
+	if !ok || instanceName == "" {
+		return AccessEntry{}, false
+	}
+
+	path, _, _ := strings.Cut(line.Request.URI, "?")
+	remoteAddr := line.Request.RemoteIP
+	if line.Request.RemotePort != "" {
+		remoteAddr = net.JoinHostPort(line.Request.RemoteIP, line.Request.RemotePort)
+	}
+	seconds, fraction := math.Modf(line.Timestamp)
+	return AccessEntry{
+		InstanceName: instanceName,
+		Client:       clientIdentity(line.Request.Headers, remoteAddr),
+		RemoteAddr:   remoteAddr,
+		Method:       line.Request.Method,
+		Path:         path,
+		Status:       line.Status,
+		LatencyMs:    line.Duration * 1000,
+		CreatedAt:    time.Unix(int64(seconds), int64(fraction*1e9)),
+	}, true
+}
+
+// SummarizeAccess computes request counts, clients and latency percentiles of access log entries
+func SummarizeAccess(entries []AccessEntry) AccessSummary {
+	summary := AccessSummary{Clients: make(map[string]int)}
+
+	var latencies []float64
+	for _, entry := range entries {
+		summary.Requests++
+		if entry.Status >= 400 {
+			summary.Errors++
+		}
+		summary.Clients[entry.Client]++
+		latencies = append(latencies, entry.LatencyMs)
+	}
+
+	if len(latencies) == 0 {
+		return summary
+	}
+
+	sort.Float64s(latencies)
+	summary.P50LatencyMs = percentile(latencies, 50)
+	summary.P95LatencyMs = percentile(latencies, 95)
+	summary.MaxLatencyMs = latencies[len(latencies)-1]
+
+	return summary
+}
+
+// percentile returns the nearest-rank percentile of sorted values
+func percentile(sorted []float64, p int) float64 {
+	rank := (p*len(sorted) + 99) / 100
+	if rank < 1 {
+		rank = 1
+	}
+	return sorted[rank-1]
+}
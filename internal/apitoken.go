@@ -0,0 +1,55 @@
+package internal
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// APITokenEnv overrides the token the management API accepts
+const APITokenEnv = "GRAPHSENSE_API_TOKEN"
+
+// APITokenFile returns the path of the management API token
+func APITokenFile() (string, error) {
+	graphsenseDir, err := GetGraphsenseDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(graphsenseDir, "api-token"), nil
+}
+
+// LoadAPIToken returns the bearer token the management API accepts. GRAPHSENSE_API_TOKEN wins;
+// otherwise the token is read from ~/.graphsense/api-token, which is generated with a random
+// token readable only by the user if it does not exist yet. created reports whether it was.
+func LoadAPIToken() (token string, created bool, err error) {
+	if token := strings.TrimSpace(os.Getenv(APITokenEnv)); token != "" {
+		return token, false, nil
+	}
+
+	path, err := APITokenFile()
+	if err != nil {
+		return "", false, err
+	}
+
+	data, err := os.ReadFile(path)
+	if err == nil {
+		if token := strings.TrimSpace(string(data)); token != "" {
+			return token, false, nil
+		}
+	} else if !os.IsNotExist(err) {
+		return "", false, fmt.Errorf("failed to read API token: %v", err)
+	}
+
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return "", false, fmt.Errorf("failed to generate API token: %v", err)
+	}
+	token = hex.EncodeToString(secret)
+	if err := os.WriteFile(path, []byte(token+"\n"), 0600); err != nil {
+		return "", false, fmt.Errorf("failed to write API token: %v", err)
+	}
+	return token, true, nil
+}
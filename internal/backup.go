@@ -0,0 +1,412 @@
+package internal
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Names of the files stored inside a backup archive
+const (
+	BackupMetadataFile = "metadata.json"
+	BackupPostgresFile = "postgres.dump"
+	BackupNeo4jFile    = "neo4j.dump"
+)
+
+// BackupMetadata describes the instance a backup archive was taken from
+type BackupMetadata struct {
+	InstanceName    string            `json:"instance_name"`
+	RepoPath        string            `json:"repo_path"`
+	AppPort         int               `json:"app_port"`
+	PostgresPort    int               `json:"postgres_port"`
+	Neo4jBoltPort   int               `json:"neo4j_bolt_port"`
+	AppImage        string            `json:"app_image,omitempty"`
+	PostgresVersion string            `json:"postgres_version,omitempty"`
+	Neo4jVersion    string            `json:"neo4j_version,omitempty"`
+	Images          map[string]string `json:"images"`
+	CreatedAt       string            `json:"created_at"`
+}
+
+// GetBackupDir returns the default backup directory, ~/.graphsense/backups
+func GetBackupDir() (string, error) {
+	graphsenseDir, err := GetGraphsenseDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(graphsenseDir, "backups"), nil
+}
+
+// NewBackupWorkDir creates a temporary directory for dumps mounted into the neo4j image. The
+// image drops privileges before running neo4j-admin, so everyone may read and write it.
+func NewBackupWorkDir(pattern string) (string, error) {
+	dir, err := os.MkdirTemp("", pattern)
+	if err != nil {
+		return "", err
+	}
+	if err := os.Chmod(dir, 0777); err != nil {
+		os.RemoveAll(dir)
+		return "", err
+	}
+	return dir, nil
+}
+
+// CreateBackup dumps the Postgres and Neo4j data of an instance and bundles it with
+// the instance metadata into a timestamped tar.gz in outputDir
+func CreateBackup(config *DeployConfig, outputDir string) (string, error) {
+	if err := os.MkdirAll(outputDir, 0755); err != nil {
+		return "", fmt.Errorf("failed to create backup directory: %v", err)
+	}
+
+	workDir, err := NewBackupWorkDir("graphsense-backup-*")
+	if err != nil {
+		return "", err
+	}
+	defer os.RemoveAll(workDir)
+
+	now := time.Now()
+	metadata := BackupMetadata{
+		InstanceName:    config.InstanceName,
+		RepoPath:        config.RepoPath,
+		AppPort:         config.AppPort,
+		PostgresPort:    config.PostgresPort,
+		Neo4jBoltPort:   config.Neo4jBoltPort,
+		AppImage:        config.AppImage,
+		PostgresVersion: config.PostgresVersion,
+		Neo4jVersion:    config.Neo4jVersion,
+		Images:          make(map[string]string),
+		CreatedAt:       now.UTC().Format(time.RFC3339),
+	}
+
+	images, err := GetContainerImages(config.InstanceName)
+	if err != nil {
+		return "", err
+	}
+	for service, image := range images {
+		metadata.Images[service] = image.Image
+	}
+
+	Log.Info("Dumping PostgreSQL database", "instance", config.InstanceName)
+	if err := dumpPostgres(config.InstanceName, filepath.Join(workDir, BackupPostgresFile)); err != nil {
+		return "", err
+	}
+
+	Log.Info("Dumping Neo4j database", "instance", config.InstanceName)
+	neo4jImage := images["neo4j"].Image
+	if metadata.Neo4jVersion == "" && neo4jImage != "" {
+		metadata.Neo4jVersion, _ = GetImageEngineVersion("neo4j", neo4jImage)
+	}
+	if err := dumpNeo4j(config.InstanceName, neo4jImage, metadata.Neo4jVersion, workDir); err != nil {
+		return "", err
+	}
+
+	metadataJSON, err := json.MarshalIndent(metadata, "", "  ")
+	if err != nil {
+		return "", fmt.Errorf("failed to encode backup metadata: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(workDir, BackupMetadataFile), metadataJSON, 0644); err != nil {
+		return "", fmt.Errorf("failed to write backup metadata: %v", err)
+	}
+
+	archivePath := filepath.Join(outputDir, fmt.Sprintf("%s-%s.tar.gz", config.InstanceName, now.Format("20060102-150405")))
+	if err := writeTarGz(archivePath, workDir, []string{BackupMetadataFile, BackupPostgresFile, BackupNeo4jFile}); err != nil {
+		os.Remove(archivePath)
+		return "", err
+	}
+
+	return archivePath, nil
+}
+
+// dumpPostgres runs pg_dump inside the instance's postgres container and writes the custom-format dump to path
+func dumpPostgres(instanceName, path string) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	cmd := Command("docker", "exec", instanceName+"-postgres", "pg_dump", "-U", PostgresUser, "-Fc", PostgresDB)
+	cmd.Stdout = file
+	cmd.Stderr = os.Stderr
+
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("pg_dump failed: %v", err)
+	}
+	return nil
+}
+
+// dumpNeo4j runs neo4j-admin dump against the instance's neo4j volumes, writing neo4j.dump into dir.
+// Neo4j community edition can only dump an offline database, so the container is stopped for the duration
+// of the dump and the dump runs in a throwaway container sharing its image and volumes.
+func dumpNeo4j(instanceName, image, version, dir string) error {
+	container := instanceName + "-neo4j"
+	if image == "" {
+		return fmt.Errorf("no neo4j container found for instance '%s'", instanceName)
+	}
+
+	if err := StopContainer(container); err != nil {
+		return err
+	}
+	defer func() {
+		if err := StartContainer(container); err != nil {
+			Log.Warning("Failed to restart container", "container", container, "error", err)
+		}
+	}()
+
+	if err := runNeo4jAdmin(container, image, dir, neo4jDumpArgs(version)); err != nil {
+		return fmt.Errorf("neo4j-admin dump failed: %v", err)
+	}
+	return nil
+}
+
+// runNeo4jAdmin runs neo4j-admin in a throwaway container sharing the image and volumes of
+// a stopped neo4j container, with dir mounted at /backups
+func runNeo4jAdmin(container, image, dir string, args []string) error {
+	runArgs := append([]string{"run", "--rm",
+		"--volumes-from", container,
+		"-v", dir + ":/backups",
+		image,
+	}, args...)
+
+	cmd := Command("docker", runArgs...)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+
+	return cmd.Run()
+}
+
+// writeTarGz bundles the named files from dir into a gzipped tar archive at path
+func writeTarGz(path, dir string, names []string) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("failed to create archive: %v", err)
+	}
+	defer file.Close()
+
+	gzipWriter := gzip.NewWriter(file)
+	tarWriter := tar.NewWriter(gzipWriter)
+
+	for _, name := range names {
+		if err := addFileToTar(tarWriter, filepath.Join(dir, name), name); err != nil {
+			return err
+		}
+	}
+
+	if err := tarWriter.Close(); err != nil {
+		return fmt.Errorf("failed to write archive: %v", err)
+	}
+	if err := gzipWriter.Close(); err != nil {
+		return fmt.Errorf("failed to write archive: %v", err)
+	}
+	return nil
+}
+
+func addFileToTar(tarWriter *tar.Writer, path, name string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed to open %s: %v", name, err)
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return err
+	}
+
+	header, err := tar.FileInfoHeader(info, "")
+	if err != nil {
+		return err
+	}
+	header.Name = name
+
+	if err := tarWriter.WriteHeader(header); err != nil {
+		return fmt.Errorf("failed to add %s to archive: %v", name, err)
+	}
+	if _, err := io.Copy(tarWriter, file); err != nil {
+		return fmt.Errorf("failed to add %s to archive: %v", name, err)
+	}
+	return nil
+}
+
+// ExtractBackup extracts a backup archive into dir and returns its metadata
+func ExtractBackup(archivePath, dir string) (*BackupMetadata, error) {
+	file, err := os.Open(archivePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open backup: %v", err)
+	}
+	defer file.Close()
+
+	gzipReader, err := gzip.NewReader(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read backup: %v", err)
+	}
+	defer gzipReader.Close()
+
+	tarReader := tar.NewReader(gzipReader)
+	for {
+		header, err := tarReader.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read backup: %v", err)
+		}
+
+		// Backups only ever contain top-level files
+		name := filepath.Base(header.Name)
+		if header.Typeflag != tar.TypeReg || name != header.Name || strings.HasPrefix(name, ".") {
+			continue
+		}
+
+		out, err := os.OpenFile(filepath.Join(dir, name), os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := io.Copy(out, tarReader); err != nil {
+			out.Close()
+			return nil, fmt.Errorf("failed to extract %s: %v", name, err)
+		}
+		out.Close()
+	}
+
+	data, err := os.ReadFile(filepath.Join(dir, BackupMetadataFile))
+	if err != nil {
+		return nil, fmt.Errorf("backup is missing %s", BackupMetadataFile)
+	}
+
+	var metadata BackupMetadata
+	if err := json.Unmarshal(data, &metadata); err != nil {
+		return nil, fmt.Errorf("failed to parse backup metadata: %v", err)
+	}
+
+	return &metadata, nil
+}
+
+// CheckRestorable verifies that the dumps extracted into dir are complete and that the
+// instance's neo4j image can read them, before a restore replaces anything
+func CheckRestorable(instanceName, dir string) error {
+	for _, name := range []string{BackupPostgresFile, BackupNeo4jFile} {
+		if _, err := os.Stat(filepath.Join(dir, name)); err != nil {
+			return fmt.Errorf("backup is missing %s", name)
+		}
+	}
+
+	images, err := GetContainerImages(instanceName)
+	if err != nil {
+		return err
+	}
+	image := images["neo4j"].Image
+	if image == "" {
+		return fmt.Errorf("no neo4j container found for instance '%s'", instanceName)
+	}
+	if err := runNeo4jAdmin(instanceName+"-neo4j", image, dir, []string{"test", "-r", "/backups/" + BackupNeo4jFile}); err != nil {
+		return fmt.Errorf("neo4j cannot read %s in %s: %v", BackupNeo4jFile, dir, err)
+	}
+	return nil
+}
+
+// RestoreBackup loads the Postgres and Neo4j dumps extracted into dir into an instance.
+// The app is stopped while the databases are replaced and started again afterwards, also
+// when the restore fails.
+func RestoreBackup(instanceName, dir string, metadata *BackupMetadata) (err error) {
+	appContainer := instanceName + "-app"
+
+	Log.Info("Stopping app service", "instance", instanceName)
+	if err := StopContainer(appContainer); err != nil {
+		return err
+	}
+	defer func() {
+		Log.Info("Starting app service", "instance", instanceName)
+		if startErr := StartContainer(appContainer); startErr != nil {
+			if err == nil {
+				err = startErr
+			} else {
+				Log.Warning("Failed to restart container", "container", appContainer, "error", startErr)
+			}
+		}
+	}()
+
+	return RestoreBackupData(instanceName, dir, metadata)
+}
+
+// RestoreBackupData loads the database dumps extracted to dir into an instance whose app is stopped
+func RestoreBackupData(instanceName, dir string, metadata *BackupMetadata) error {
+	Log.Info("Restoring PostgreSQL database", "instance", instanceName)
+	if err := restorePostgres(instanceName, filepath.Join(dir, BackupPostgresFile)); err != nil {
+		return err
+	}
+
+	Log.Info("Restoring Neo4j database", "instance", instanceName)
+	if err := restoreNeo4j(instanceName, dir, metadata.Neo4jVersion); err != nil {
+		return err
+	}
+	return nil
+}
+
+// restorePostgres streams a custom-format dump into pg_restore inside the instance's postgres container
+func restorePostgres(instanceName, path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed to open postgres dump: %v", err)
+	}
+	defer file.Close()
+
+	cmd := Command("docker", "exec", "-i", instanceName+"-postgres",
+		"pg_restore", "-U", PostgresUser, "-d", PostgresDB, "--clean", "--if-exists", "--no-owner")
+	cmd.Stdin = file
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("pg_restore failed: %v", err)
+	}
+	return nil
+}
+
+// restoreNeo4j loads neo4j.dump from dir into the instance's neo4j volumes while the container is stopped.
+// Dumps taken with an older major version are migrated to the current store format after loading.
+func restoreNeo4j(instanceName, dir, dumpVersion string) error {
+	container := instanceName + "-neo4j"
+
+	images, err := GetContainerImages(instanceName)
+	if err != nil {
+		return err
+	}
+	image := images["neo4j"].Image
+	if image == "" {
+		return fmt.Errorf("no neo4j container found for instance '%s'", instanceName)
+	}
+
+	version, err := GetImageEngineVersion("neo4j", image)
+	if err != nil {
+		return err
+	}
+
+	if err := StopContainer(container); err != nil {
+		return err
+	}
+	defer func() {
+		if err := StartContainer(container); err != nil {
+			Log.Warning("Failed to restart container", "container", container, "error", err)
+		}
+	}()
+
+	if err := runNeo4jAdmin(container, image, dir, neo4jLoadArgs(version)); err != nil {
+		return fmt.Errorf("neo4j-admin load failed: %v", err)
+	}
+
+	if dumpVersion != "" && MajorVersion(dumpVersion) < MajorVersion(version) {
+		Log.Info("Migrating Neo4j store", "instance", instanceName, "from", dumpVersion, "to", version)
+		migrateArgs := []string{"neo4j-admin", "database", "migrate", Neo4jDB, "--force-btree-indexes-to-range"}
+		if err := runNeo4jAdmin(container, image, dir, migrateArgs); err != nil {
+			return fmt.Errorf("neo4j-admin database migrate failed: %v", err)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,100 @@
+package internal
+
+import (
+	"bytes"
+	"fmt"
+	"path/filepath"
+
+	"gopkg.in/yaml.v3"
+)
+
+// DefaultBatchParallel is how many instances deploy-batch deploys at once unless told otherwise
+const DefaultBatchParallel = 3
+
+// BatchManifest lists the repositories deploy-batch deploys
+type BatchManifest struct {
+	// Parallel is how many instances are deployed at once; --parallel overrides it
+	Parallel int          `yaml:"parallel,omitempty"`
+	Repos    []BatchEntry `yaml:"repos"`
+}
+
+// BatchEntry is one repository of a batch manifest: a path or Git URL, and optionally the
+// instance name, base port and labels of its instance
+type BatchEntry struct {
+	Repo   string            `yaml:"repo"`
+	Name   string            `yaml:"name,omitempty"`
+	Port   int               `yaml:"port,omitempty"`
+	Labels map[string]string `yaml:"labels,omitempty"`
+}
+
+// ParseBatchManifest parses and validates a batch manifest. Relative repository paths are
+// resolved against dir, the directory of the manifest.
+func ParseBatchManifest(data []byte, dir string) (*BatchManifest, error) {
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+
+	var manifest BatchManifest
+	if err := decoder.Decode(&manifest); err != nil {
+		return nil, fmt.Errorf("failed to parse batch manifest: %v", err)
+	}
+	for i := range manifest.Repos {
+		entry := &manifest.Repos[i]
+		if entry.Repo != "" && !IsGitURL(entry.Repo) && !filepath.IsAbs(entry.Repo) {
+			entry.Repo = filepath.Join(dir, entry.Repo)
+		}
+	}
+	if err := manifest.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid batch manifest: %v", err)
+	}
+	return &manifest, nil
+}
+
+// Validate checks that the manifest can be deployed: every repository is named, the instance
+// names and ports do not collide and the labels are valid
+func (m *BatchManifest) Validate() error {
+	if len(m.Repos) == 0 {
+		return fmt.Errorf("repos lists no repositories")
+	}
+	if m.Parallel < 0 {
+		return fmt.Errorf("parallel must be at least 1")
+	}
+	names := make(map[string]int)
+	ports := make(map[int]int)
+	for i, entry := range m.Repos {
+		if entry.Repo == "" {
+			return fmt.Errorf("repos[%d]: repo is required", i)
+		}
+		if entry.Port < 0 || entry.Port > 65535 {
+			return fmt.Errorf("repos[%d]: invalid port %d", i, entry.Port)
+		}
+		for key := range entry.Labels {
+			if err := ValidateLabelKey(key); err != nil {
+				return fmt.Errorf("repos[%d]: %v", i, err)
+			}
+		}
+		name := entry.InstanceName()
+		if other, ok := names[name]; ok {
+			return fmt.Errorf("repos[%d] and repos[%d] would both be deployed as '%s'; give one of them a name", other, i, name)
+		}
+		names[name] = i
+		if entry.Port != 0 {
+			if other, ok := ports[entry.Port]; ok {
+				return fmt.Errorf("repos[%d] and repos[%d] both ask for port %d", other, i, entry.Port)
+			}
+			ports[entry.Port] = i
+		}
+	}
+	return nil
+}
+
+// InstanceName returns the name the entry's instance is deployed as: its name, or one
+// generated from the repository as deploy does
+func (e BatchEntry) InstanceName() string {
+	if e.Name != "" {
+		return SanitizeInstanceName(e.Name)
+	}
+	if IsGitURL(e.Repo) {
+		return GenerateURLInstanceName(e.Repo)
+	}
+	return GenerateInstanceName(e.Repo)
+}
@@ -0,0 +1,129 @@
+package internal
+
+import (
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+)
+
+// LoopbackBindAddress is where local instances publish their ports unless told otherwise
+const LoopbackBindAddress = "127.0.0.1"
+
+// DefaultBindAddress returns the address new instances publish their ports on. Ports on a
+// remote Docker host are published on all interfaces, since the CLI has to reach them.
+func DefaultBindAddress() string {
+	if IsRemoteDocker() {
+		return ""
+	}
+	return LoopbackBindAddress
+}
+
+// ValidateBindAddress checks that address is an IPv4 or IPv6 address
+func ValidateBindAddress(address string) error {
+	if address == "" {
+		return nil
+	}
+	if net.ParseIP(address) == nil {
+		return fmt.Errorf("invalid bind address '%s': must be an IPv4 or IPv6 address", address)
+	}
+	return nil
+}
+
+// isWildcard reports whether address publishes on all interfaces
+func isWildcard(address string) bool {
+	ip := net.ParseIP(address)
+	return address == "" || (ip != nil && ip.IsUnspecified())
+}
+
+// BindsAllInterfaces reports whether the instance publishes its ports on all interfaces
+func (c *DeployConfig) BindsAllInterfaces() bool {
+	return isWildcard(c.BindAddress)
+}
+
+// PublishedPort returns the host side of a port mapping, e.g. 127.0.0.1:8080 or [::1]:8080
+func (c *DeployConfig) PublishedPort(port int) string {
+	if c.BindsAllInterfaces() {
+		return fmt.Sprintf("%d", port)
+	}
+	return net.JoinHostPort(c.BindAddress, fmt.Sprintf("%d", port))
+}
+
+// HostAddress returns the address the published ports of an instance are reached at, ready
+// to be followed by :port. Ports bound to one interface are reached at that address; loopback
+// and wildcard bindings at the Docker host.
+func (c *DeployConfig) HostAddress() string {
+	ip := net.ParseIP(c.BindAddress)
+	if ip == nil || ip.IsUnspecified() || ip.IsLoopback() {
+		return DockerHostAddress()
+	}
+	if ip.To4() == nil {
+		return "[" + ip.String() + "]"
+	}
+	return ip.String()
+}
+
+// CheckBindAddressSupport checks that Compose can publish ports on address. Binding to one
+// address replaces the port mappings of the GraphSense compose file with !override.
+func CheckBindAddressSupport(address string) error {
+	if isWildcard(address) {
+		return nil
+	}
+	runner, err := GetComposeRunner()
+	if err != nil {
+		return err
+	}
+	if !runner.SupportsOverrideTag() {
+		return fmt.Errorf("publishing ports on %s needs Docker Compose 2.24.4 or later, found %s", address, runner)
+	}
+	return nil
+}
+
+// hostOnly strips the brackets HostAddress puts around IPv6 addresses
+func hostOnly(address string) string {
+	return strings.TrimSuffix(strings.TrimPrefix(address, "["), "]")
+}
+
+var (
+	ipv6Supported     bool
+	ipv6SupportedOnce sync.Once
+)
+
+// ipv6Available reports whether this machine can listen on IPv6 at all
+func ipv6Available() bool {
+	ipv6SupportedOnce.Do(func() {
+		if listener, err := net.Listen("tcp6", "[::1]:0"); err == nil {
+			listener.Close()
+			ipv6Supported = true
+		}
+	})
+	return ipv6Supported
+}
+
+// isLocalPortInUse tries to listen on a port of this machine the way Docker would publish it
+// on bindAddress: on both the IPv4 and the IPv6 wildcard for all interfaces, otherwise on the
+// address itself
+func isLocalPortInUse(bindAddress string, port int) bool {
+	type probe struct{ network, address string }
+	var probes []probe
+	switch ip := net.ParseIP(bindAddress); {
+	case isWildcard(bindAddress):
+		probes = []probe{{"tcp4", "0.0.0.0"}, {"tcp6", "::"}}
+	case ip.To4() != nil:
+		probes = []probe{{"tcp4", bindAddress}}
+	default:
+		probes = []probe{{"tcp6", bindAddress}}
+	}
+
+	for _, p := range probes {
+		if p.network == "tcp6" && !ipv6Available() {
+			continue
+		}
+		listener, err := net.Listen(p.network, net.JoinHostPort(p.address, fmt.Sprintf("%d", port)))
+		if err != nil {
+			return true
+		}
+		listener.Close()
+	}
+	return false
+}
@@ -0,0 +1,199 @@
+package internal
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Sections of an instance comparison, in display order
+const (
+	CompareSectionPorts     = "ports"
+	CompareSectionImages    = "images"
+	CompareSectionVersions  = "versions"
+	CompareSectionEnv       = "env"
+	CompareSectionResources = "resources"
+	CompareSectionVolumes   = "volumes"
+)
+
+var compareSections = []string{
+	CompareSectionPorts,
+	CompareSectionImages,
+	CompareSectionVersions,
+	CompareSectionEnv,
+	CompareSectionResources,
+	CompareSectionVolumes,
+}
+
+// instanceNamePlaceholder replaces the instance name in compared values, so that settings
+// derived from the name, such as container hostnames, compare equal
+const instanceNamePlaceholder = "<instance>"
+
+// CompareRow is one setting of two compared instances. An empty value means the instance
+// does not have the setting.
+type CompareRow struct {
+	Section string `json:"section" yaml:"section"`
+	Key     string `json:"key" yaml:"key"`
+	A       string `json:"a" yaml:"a"`
+	B       string `json:"b" yaml:"b"`
+}
+
+// Differs reports whether the two instances disagree on the setting
+func (r CompareRow) Differs() bool {
+	return r.A != r.B
+}
+
+// instanceFacts holds the comparable settings of one instance by section and key
+type instanceFacts map[string]map[string]string
+
+func (f instanceFacts) set(section, key, value string) {
+	if f[section] == nil {
+		f[section] = make(map[string]string)
+	}
+	f[section][key] = value
+}
+
+// CompareInstances lists the ports, images, engine versions, environment, resource limits
+// and volume sizes of two instances side by side, ordered by section and key. Secrets in the
+// environment are redacted.
+func CompareInstances(a, b string) ([]CompareRow, error) {
+	factsA, err := collectFacts(a)
+	if err != nil {
+		return nil, err
+	}
+	factsB, err := collectFacts(b)
+	if err != nil {
+		return nil, err
+	}
+
+	var rows []CompareRow
+	for _, section := range compareSections {
+		keys := make(map[string]bool)
+		for key := range factsA[section] {
+			keys[key] = true
+		}
+		for key := range factsB[section] {
+			keys[key] = true
+		}
+
+		sectionRows := make([]CompareRow, 0, len(keys))
+		for key := range keys {
+			sectionRows = append(sectionRows, CompareRow{
+				Section: section,
+				Key:     key,
+				A:       factsA[section][key],
+				B:       factsB[section][key],
+			})
+		}
+		sort.Slice(sectionRows, func(i, j int) bool {
+			return sectionRows[i].Key < sectionRows[j].Key
+		})
+		rows = append(rows, sectionRows...)
+	}
+	return rows, nil
+}
+
+// collectFacts gathers the comparable settings of one instance
+func collectFacts(instanceName string) (instanceFacts, error) {
+	config, err := GetInstanceConfig(instanceName)
+	if err != nil {
+		return nil, err
+	}
+
+	facts := make(instanceFacts)
+	facts.set(CompareSectionPorts, "app", strconv.Itoa(config.AppPort))
+	if !config.IsSingleContainer() {
+		facts.set(CompareSectionPorts, "postgres", strconv.Itoa(config.PostgresPort))
+		facts.set(CompareSectionPorts, "neo4j bolt", strconv.Itoa(config.Neo4jBoltPort))
+	}
+	bindAddress := config.BindAddress
+	if config.BindsAllInterfaces() {
+		bindAddress = "all interfaces"
+	}
+	facts.set(CompareSectionPorts, "bind address", bindAddress)
+	facts.set(CompareSectionPorts, "tls", strconv.FormatBool(config.TLS))
+
+	running, err := RunningConfig(instanceName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to inspect %s: %v", instanceName, err)
+	}
+	for service, serviceConfig := range running {
+		facts.set(CompareSectionImages, service, serviceConfig.Image)
+		for key, value := range serviceConfig.Env {
+			value = strings.ReplaceAll(value, instanceName, instanceNamePlaceholder)
+			facts.set(CompareSectionEnv, service+"."+key, displayValue(key, value))
+		}
+	}
+
+	if err := collectContainerFacts(facts, instanceName); err != nil {
+		return nil, err
+	}
+
+	facts.set(CompareSectionVersions, "postgres", config.PostgresVersion)
+	facts.set(CompareSectionVersions, "neo4j", config.Neo4jVersion)
+	if !config.IsSingleContainer() {
+		// The engines only answer while their containers run
+		if versions, err := GetEngineVersions(instanceName); err == nil {
+			facts.set(CompareSectionVersions, "postgres", versions.Postgres)
+			facts.set(CompareSectionVersions, "neo4j", versions.Neo4j)
+		}
+	}
+
+	report, err := GetDiskUsageReport([]string{instanceName})
+	if err != nil {
+		return nil, err
+	}
+	for _, item := range report[0].Items {
+		if item.Kind == DiskItemVolume {
+			facts.set(CompareSectionVolumes, strings.TrimPrefix(item.Name, instanceName+"_"), FormatSize(item.Size))
+		}
+	}
+
+	return facts, nil
+}
+
+// collectContainerFacts adds the image digests and resource limits of an instance's containers
+func collectContainerFacts(facts instanceFacts, instanceName string) error {
+	docker, err := GetDockerClient()
+	if err != nil {
+		return err
+	}
+	ctx := context.Background()
+
+	containers, err := docker.ProjectContainers(ctx, instanceName)
+	if err != nil {
+		return err
+	}
+	for _, c := range containers {
+		info, err := docker.InspectContainer(ctx, c.ID)
+		if err != nil {
+			return err
+		}
+		if info.Config == nil || info.HostConfig == nil {
+			continue
+		}
+		service := info.Config.Labels[ComposeServiceLabel]
+
+		// Two instances can run different builds of the same tag
+		if digest, err := docker.ImageDigest(ctx, info.Image); err == nil && digest != "" {
+			facts.set(CompareSectionImages, service+" digest", digest)
+		}
+
+		cpus, cpuset, memory := "unlimited", "any", "unlimited"
+		if info.HostConfig.NanoCPUs > 0 {
+			cpus = strconv.FormatFloat(float64(info.HostConfig.NanoCPUs)/1e9, 'f', -1, 64)
+		}
+		if info.HostConfig.CpusetCpus != "" {
+			cpuset = info.HostConfig.CpusetCpus
+		}
+		if info.HostConfig.Memory > 0 {
+			memory = FormatSize(info.HostConfig.Memory)
+		}
+		facts.set(CompareSectionResources, service+" cpus", cpus)
+		facts.set(CompareSectionResources, service+" cpuset", cpuset)
+		facts.set(CompareSectionResources, service+" memory", memory)
+	}
+	return nil
+}
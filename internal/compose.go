@@ -0,0 +1,242 @@
+package internal
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// ComposeRunner runs Docker Compose commands through whichever implementation is installed:
+// the v2 `docker compose` plugin or the legacy v1 `docker-compose` binary
+type ComposeRunner struct {
+	// Command is the executable followed by any leading arguments, e.g. ["docker", "compose"]
+	Command []string
+	Version string
+	V2      bool
+}
+
+var (
+	composeRunner     *ComposeRunner
+	composeRunnerErr  error
+	composeRunnerOnce sync.Once
+)
+
+// composeV2OnlyFlags lists flags, per subcommand, that only Compose v2 understands.
+// They are dropped when running through the v1 binary.
+var composeV2OnlyFlags = map[string]map[string]bool{
+	"up":   {"--wait": true, "--quiet-pull": true},
+	"ps":   {"--format": true, "--status": true},
+	"logs": {"--no-log-prefix": true},
+}
+
+// composeFlagsWithValue lists v2-only flags that take a separate value argument
+var composeFlagsWithValue = map[string]bool{
+	"--format": true,
+	"--status": true,
+}
+
+// GetComposeRunner returns the Compose implementation to use, preferring the v2 plugin.
+// Detection runs once per process.
+func GetComposeRunner() (*ComposeRunner, error) {
+	composeRunnerOnce.Do(func() {
+		composeRunner, composeRunnerErr = DetectComposeRunner()
+	})
+	return composeRunner, composeRunnerErr
+}
+
+// DetectComposeRunner probes for `docker compose` first and falls back to `docker-compose`
+func DetectComposeRunner() (*ComposeRunner, error) {
+	if output, err := Command("docker", "compose", "version", "--short").Output(); err == nil {
+		return &ComposeRunner{
+			Command: []string{"docker", "compose"},
+			Version: strings.TrimPrefix(strings.TrimSpace(string(output)), "v"),
+			V2:      true,
+		}, nil
+	}
+
+	if output, err := Command("docker-compose", "version", "--short").Output(); err == nil {
+		version := strings.TrimPrefix(strings.TrimSpace(string(output)), "v")
+		return &ComposeRunner{
+			Command: []string{"docker-compose"},
+			Version: version,
+			// docker-compose 2.x is the v2 binary installed standalone
+			V2: MajorVersion(version) >= 2,
+		}, nil
+	}
+
+	return nil, fmt.Errorf("neither the docker compose plugin nor docker-compose was found")
+}
+
+// String describes the runner, e.g. "docker compose 2.24.5"
+func (r *ComposeRunner) String() string {
+	return fmt.Sprintf("%s %s", strings.Join(r.Command, " "), r.Version)
+}
+
+// overrideTagVersion is the first Compose release that understands the !override YAML tag
+var overrideTagVersion = [3]int{2, 24, 4}
+
+// SupportsOverrideTag reports whether the runner can replace lists such as ports from an
+// override file with !override, instead of appending to them
+func (r *ComposeRunner) SupportsOverrideTag() bool {
+	return r.atLeast(overrideTagVersion)
+}
+
+// environmentSecretsVersion is the first Compose release that reads secrets from its environment
+var environmentSecretsVersion = [3]int{2, 23, 1}
+
+// SupportsEnvironmentSecrets reports whether the runner can create secrets from variables of
+// its environment, instead of only from files
+func (r *ComposeRunner) SupportsEnvironmentSecrets() bool {
+	return r.atLeast(environmentSecretsVersion)
+}
+
+// atLeast reports whether the runner is Compose v2 of the given release or later
+func (r *ComposeRunner) atLeast(release [3]int) bool {
+	match := versionPattern.FindStringSubmatch(r.Version)
+	if !r.V2 || match == nil {
+		return false
+	}
+	var version [3]int
+	for i := range version {
+		version[i], _ = strconv.Atoi(match[i+1])
+	}
+	return compareReleases(version, release) >= 0
+}
+
+// NormalizeArgs adapts compose arguments to the detected implementation
+func (r *ComposeRunner) NormalizeArgs(args []string) []string {
+	if r.V2 {
+		return args
+	}
+
+	// Flags are only dropped after the subcommand, never from the global -f/--env-file flags
+	var normalized []string
+	var unsupported map[string]bool
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		if unsupported == nil {
+			if flags, ok := composeV2OnlyFlags[arg]; ok {
+				unsupported = flags
+			}
+			normalized = append(normalized, arg)
+			continue
+		}
+
+		name := strings.SplitN(arg, "=", 2)[0]
+		if !unsupported[name] {
+			normalized = append(normalized, arg)
+			continue
+		}
+		if composeFlagsWithValue[name] && !strings.Contains(arg, "=") {
+			i++
+		}
+	}
+	return normalized
+}
+
+// command builds the exec.Cmd for a compose invocation with envVars added to the environment
+func (r *ComposeRunner) command(args []string, envVars map[string]string) *exec.Cmd {
+	args = r.NormalizeArgs(args)
+
+	// v2 can operate on an existing project without its compose files, but only
+	// when the project is named with -p rather than through the environment
+	if project := envVars["COMPOSE_PROJECT_NAME"]; r.V2 && project != "" && !hasComposeFile(args) {
+		args = append([]string{"-p", project}, args...)
+	}
+
+	// Compose draws colored, redrawn progress bars unless told otherwise
+	if PlainOutput() {
+		plainEnv := map[string]string{"COMPOSE_ANSI": "never", "COMPOSE_PROGRESS": "plain"}
+		for key, value := range envVars {
+			plainEnv[key] = value
+		}
+		envVars = plainEnv
+	}
+
+	full := append(append([]string{}, r.Command[1:]...), args...)
+	return CommandEnv(envVars, r.Command[0], full...)
+}
+
+// Run runs a compose command, streaming its output to the terminal
+func (r *ComposeRunner) Run(args []string, envVars map[string]string) error {
+	cmd := r.command(args, envVars)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	return cmd.Run()
+}
+
+// Stream runs a compose command and passes every line of its output to handle instead of
+// the terminal. Compose writes its progress as plain lines when it is not attached to one.
+func (r *ComposeRunner) Stream(args []string, envVars map[string]string, handle func(line string)) error {
+	streamEnv := map[string]string{"COMPOSE_ANSI": "never", "COMPOSE_PROGRESS": "plain"}
+	for key, value := range envVars {
+		streamEnv[key] = value
+	}
+	cmd := r.command(args, streamEnv)
+
+	reader, writer := io.Pipe()
+	cmd.Stdout = writer
+	cmd.Stderr = writer
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		scanner := bufio.NewScanner(reader)
+		scanner.Split(scanOutputLines)
+		for scanner.Scan() {
+			if line := strings.TrimRight(scanner.Text(), " "); line != "" {
+				handle(line)
+			}
+		}
+		// Keep draining so compose never blocks on a line too long to scan
+		io.Copy(io.Discard, reader)
+	}()
+
+	err := cmd.Run()
+	writer.Close()
+	<-done
+	return err
+}
+
+// scanOutputLines splits output into lines ended by a newline or a carriage return, which
+// progress output uses to redraw a line
+func scanOutputLines(data []byte, atEOF bool) (advance int, token []byte, err error) {
+	if i := bytes.IndexAny(data, "\r\n"); i >= 0 {
+		return i + 1, data[:i], nil
+	}
+	if atEOF && len(data) > 0 {
+		return len(data), data, nil
+	}
+	return 0, nil, nil
+}
+
+// RunInteractive runs a compose command attached to the terminal, including its input
+func (r *ComposeRunner) RunInteractive(args []string, envVars map[string]string) error {
+	cmd := r.command(args, envVars)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	return cmd.Run()
+}
+
+// Output runs a compose command and returns its standard output
+func (r *ComposeRunner) Output(args []string, envVars map[string]string) ([]byte, error) {
+	cmd := r.command(args, envVars)
+	cmd.Stderr = os.Stderr
+	return cmd.Output()
+}
+
+// hasComposeFile reports whether args select compose files with -f
+func hasComposeFile(args []string) bool {
+	for _, arg := range args {
+		if arg == "-f" || arg == "--file" || strings.HasPrefix(arg, "--file=") {
+			return true
+		}
+	}
+	return false
+}
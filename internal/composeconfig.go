@@ -0,0 +1,56 @@
+package internal
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// composeEnvLine matches the KEY: value and - KEY=value environment entries of resolved compose YAML
+var composeEnvLine = regexp.MustCompile(`^(\s*(?:- )?)([A-Za-z_][A-Za-z0-9_]*)(: |=)(.+)$`)
+
+// ResolveComposeConfig renders an instance's compose files and environment the way deploy
+// and upgrade do and returns the configuration docker compose resolves from them.
+// Unless showSecrets is set, the values of secret environment variables are masked.
+func ResolveComposeConfig(config *DeployConfig, showSecrets bool) (string, error) {
+	if config.IsSingleContainer() {
+		return "", fmt.Errorf("instance '%s' runs in single-container mode and has no compose configuration", config.InstanceName)
+	}
+
+	files, err := PrepareComposeFiles(config)
+	if err != nil {
+		return "", err
+	}
+	defer files.Cleanup()
+
+	envVars := map[string]string{
+		"COMPOSE_PROJECT_NAME": config.InstanceName,
+	}
+	output, err := DockerComposeOutput(files.Args("config"), files.Env(envVars))
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve compose configuration: %v", err)
+	}
+	if showSecrets {
+		return string(output), nil
+	}
+	return maskComposeSecrets(string(output)), nil
+}
+
+// maskComposeSecrets masks the values of secret environment variables in resolved compose YAML
+func maskComposeSecrets(yaml string) string {
+	lines := strings.Split(yaml, "\n")
+	for i, line := range lines {
+		match := composeEnvLine.FindStringSubmatch(line)
+		if match == nil {
+			continue
+		}
+		if masked := displayValue(match[2], match[4]); masked != match[4] {
+			value := masked
+			if match[3] == ": " {
+				value = fmt.Sprintf("%q", masked)
+			}
+			lines[i] = match[1] + match[2] + match[3] + value
+		}
+	}
+	return strings.Join(lines, "\n")
+}
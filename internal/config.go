@@ -0,0 +1,73 @@
+package internal
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Config holds user settings read from ~/.graphsense/config.yaml
+type Config struct {
+	Quotas      QuotaConfig       `yaml:"quotas"`
+	UpdateCheck UpdateCheckConfig `yaml:"update_check"`
+	Ports       PortScheme        `yaml:"ports"`
+	// Plain turns off colors, emojis and other symbols, as --plain does
+	Plain bool `yaml:"plain"`
+	// Language selects the catalog messages are translated with, e.g. de or pt-BR
+	Language string `yaml:"language"`
+	// ReadOnly refuses commands that change instances, for users of a shared host who should
+	// only look at the instances someone else deploys
+	ReadOnly bool `yaml:"read_only"`
+	// Profiles are named sets of deploy settings, selected with deploy --profile
+	Profiles map[string]DeployProfile `yaml:"profiles"`
+	// Notifications are the sinks told when an instance becomes unhealthy, is restarted by
+	// supervise or fails to deploy
+	Notifications []NotificationConfig `yaml:"notifications"`
+	// GC decides what gc and supervise do with instances past their TTL or not used for long
+	GC GCConfig `yaml:"gc"`
+	// AllowScripts lets the lifecycle scripts of repositories run on this machine without
+	// asking, as --allow-scripts does
+	AllowScripts bool `yaml:"allow_scripts"`
+}
+
+// QuotaConfig limits how many resources GraphSense instances may use on this machine.
+// Zero values mean unlimited.
+type QuotaConfig struct {
+	MaxInstances int    `yaml:"max_instances"`
+	MaxTotalDisk string `yaml:"max_total_disk"`
+}
+
+// GetConfigPath returns the path of the user config file
+func GetConfigPath() (string, error) {
+	graphsenseDir, err := GetGraphsenseDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(graphsenseDir, "config.yaml"), nil
+}
+
+// LoadConfig reads ~/.graphsense/config.yaml, returning defaults if it does not exist
+func LoadConfig() (*Config, error) {
+	config := &Config{}
+
+	configPath, err := GetConfigPath()
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := os.ReadFile(configPath)
+	if os.IsNotExist(err) {
+		return config, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config file: %v", err)
+	}
+
+	if err := yaml.Unmarshal(data, config); err != nil {
+		return nil, fmt.Errorf("failed to parse config file %s: %v", configPath, err)
+	}
+
+	return config, nil
+}
@@ -0,0 +1,85 @@
+package internal
+
+import (
+	"fmt"
+	"net/url"
+)
+
+// ConnInfo holds what an external tool needs to connect to an instance's databases from the host
+type ConnInfo struct {
+	Instance         string `json:"instance" yaml:"instance"`
+	PostgresURL      string `json:"postgres_url" yaml:"postgres_url"`
+	PostgresHost     string `json:"postgres_host" yaml:"postgres_host"`
+	PostgresPort     int    `json:"postgres_port" yaml:"postgres_port"`
+	PostgresUser     string `json:"postgres_user" yaml:"postgres_user"`
+	PostgresPassword string `json:"postgres_password" yaml:"postgres_password"`
+	PostgresDB       string `json:"postgres_db" yaml:"postgres_db"`
+	Neo4jURI         string `json:"neo4j_uri" yaml:"neo4j_uri"`
+	Neo4jUser        string `json:"neo4j_user" yaml:"neo4j_user"`
+	Neo4jPassword    string `json:"neo4j_password" yaml:"neo4j_password"`
+	Neo4jDB          string `json:"neo4j_db" yaml:"neo4j_db"`
+	MCPURL           string `json:"mcp_url" yaml:"mcp_url"`
+}
+
+// GetConnInfo returns the host-side connection details of an instance
+func GetConnInfo(config *DeployConfig) (ConnInfo, error) {
+	credentials, err := config.Credentials()
+	if err != nil {
+		return ConnInfo{}, err
+	}
+	host := config.HostAddress()
+
+	postgresURL := url.URL{
+		Scheme: "postgresql",
+		User:   url.UserPassword(credentials.PostgresUser, credentials.PostgresPassword),
+		Host:   fmt.Sprintf("%s:%d", host, config.PostgresPort),
+		Path:   "/" + PostgresDB,
+	}
+
+	// Instances with the legacy credentials run Neo4j without authentication, so their
+	// Neo4j password is empty and any password is accepted
+	return ConnInfo{
+		Instance:         config.InstanceName,
+		PostgresURL:      postgresURL.String(),
+		PostgresHost:     hostOnly(host),
+		PostgresPort:     config.PostgresPort,
+		PostgresUser:     credentials.PostgresUser,
+		PostgresPassword: credentials.PostgresPassword,
+		PostgresDB:       PostgresDB,
+		Neo4jURI:         fmt.Sprintf("bolt://%s:%d", host, config.Neo4jBoltPort),
+		Neo4jUser:        credentials.Neo4jUser,
+		Neo4jPassword:    credentials.Neo4jPassword,
+		Neo4jDB:          Neo4jDB,
+		MCPURL:           config.AppURL(),
+	}, nil
+}
+
+// WithoutPasswords returns the connection details with the passwords left out, for callers
+// that may read but not change an instance
+func (c ConnInfo) WithoutPasswords() ConnInfo {
+	postgresURL, err := url.Parse(c.PostgresURL)
+	if err == nil {
+		postgresURL.User = url.User(c.PostgresUser)
+		c.PostgresURL = postgresURL.String()
+	}
+	c.PostgresPassword = ""
+	c.Neo4jPassword = ""
+	return c
+}
+
+// EnvVars returns the connection details as environment variables understood by
+// psql (PG*) and the GraphSense app (POSTGRES_URL, NEO4J_*)
+func (c ConnInfo) EnvVars() [][2]string {
+	return [][2]string{
+		{"POSTGRES_URL", c.PostgresURL},
+		{"PGHOST", c.PostgresHost},
+		{"PGPORT", fmt.Sprintf("%d", c.PostgresPort)},
+		{"PGUSER", c.PostgresUser},
+		{"PGPASSWORD", c.PostgresPassword},
+		{"PGDATABASE", c.PostgresDB},
+		{"NEO4J_URI", c.Neo4jURI},
+		{"NEO4J_USERNAME", c.Neo4jUser},
+		{"NEO4J_PASSWORD", c.Neo4jPassword},
+		{"NEO4J_DATABASE", c.Neo4jDB},
+	}
+}
@@ -0,0 +1,97 @@
+package internal
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// ParseCPUSet validates a CPU list such as 0-3,8,10-11 and returns it in canonical form
+func ParseCPUSet(cpuset string) (string, error) {
+	if _, err := cpuSetCPUs(cpuset); err != nil {
+		return "", fmt.Errorf("invalid CPU list '%s': %v", cpuset, err)
+	}
+	return strings.ReplaceAll(cpuset, " ", ""), nil
+}
+
+// cpuSetCPUs returns the CPUs of a CPU list in the order given
+func cpuSetCPUs(cpuset string) ([]int, error) {
+	cpuset = strings.ReplaceAll(cpuset, " ", "")
+	if cpuset == "" {
+		return nil, fmt.Errorf("no CPUs given")
+	}
+
+	var cpus []int
+	for _, part := range strings.Split(cpuset, ",") {
+		first, last, isRange := strings.Cut(part, "-")
+		low, err := strconv.Atoi(first)
+		if err != nil || low < 0 {
+			return nil, fmt.Errorf("'%s' is not a CPU number or range", part)
+		}
+		high := low
+		if isRange {
+			high, err = strconv.Atoi(last)
+			if err != nil || high < low {
+				return nil, fmt.Errorf("'%s' is not a CPU number or range", part)
+			}
+		}
+		for cpu := low; cpu <= high; cpu++ {
+			cpus = append(cpus, cpu)
+		}
+	}
+	return cpus, nil
+}
+
+// NUMANodeCPUSet returns the CPU list of a NUMA node of this machine. Only local Docker
+// engines on Linux expose their topology, so remote hosts are rejected.
+func NUMANodeCPUSet(node int) (string, error) {
+	if IsRemoteDocker() {
+		return "", fmt.Errorf("--numa-node needs a local Docker engine; pass the node's CPUs with --cpuset instead")
+	}
+	if node < 0 {
+		return "", fmt.Errorf("invalid NUMA node %d", node)
+	}
+	data, err := os.ReadFile(filepath.Join("/sys/devices/system/node", fmt.Sprintf("node%d", node), "cpulist"))
+	if os.IsNotExist(err) {
+		return "", fmt.Errorf("NUMA node %d does not exist on this machine", node)
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to read the CPUs of NUMA node %d: %v", node, err)
+	}
+	return ParseCPUSet(strings.TrimSpace(string(data)))
+}
+
+// CheckCPUSetAvailable checks that the Docker host has every CPU of a CPU list. Online CPUs
+// are assumed to be numbered from 0, as they are on hosts without hot-unplugged CPUs.
+func CheckCPUSetAvailable(cpuset string) error {
+	cpus, err := cpuSetCPUs(cpuset)
+	if err != nil {
+		return err
+	}
+	docker, err := GetDockerClient()
+	if err != nil {
+		return err
+	}
+	count, err := docker.CPUCount(context.Background())
+	if err != nil {
+		return err
+	}
+	for _, cpu := range cpus {
+		if cpu >= count {
+			return fmt.Errorf("CPU %d does not exist: the Docker host has CPUs 0-%d", cpu, count-1)
+		}
+	}
+	return nil
+}
+
+// ServiceCPUSet returns the CPUs a service of the instance is pinned to, or "" if it is not
+// pinned. Neo4j may have CPUs of its own; every other service uses those of the instance.
+func (c *DeployConfig) ServiceCPUSet(service string) string {
+	if service == "neo4j" && c.Neo4jCPUSet != "" {
+		return c.Neo4jCPUSet
+	}
+	return c.CPUSet
+}
@@ -0,0 +1,338 @@
+package internal
+
+import (
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Places the database credentials of an instance are stored. Instances deployed before
+// credentials were generated have none recorded and keep the fixed legacy credentials.
+const (
+	CredentialStoreKeyring = "keyring"
+	CredentialStoreFile    = "file"
+)
+
+// Environment variables that carry the database credentials of an instance to compose and
+// docker run
+const (
+	PostgresPasswordEnv = "POSTGRES_PASSWORD"
+	Neo4jPasswordEnv    = "NEO4J_PASSWORD"
+	Neo4jAuthEnv        = "NEO4J_AUTH"
+)
+
+// CredentialEnvNames lists the credential variables every instance is started with
+var CredentialEnvNames = []string{Neo4jAuthEnv, Neo4jPasswordEnv, PostgresPasswordEnv}
+
+// LegacyPostgresPassword is the PostgreSQL password of instances deployed before credentials
+// were generated; their Neo4j runs without authentication
+const LegacyPostgresPassword = "postgres"
+
+// credentialAlphabet keeps generated passwords safe to embed in URLs and compose files
+const credentialAlphabet = "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789"
+
+// credentialLength is the length of generated passwords, about 142 bits of entropy
+const credentialLength = 24
+
+// InstanceCredentials are the database credentials of an instance
+type InstanceCredentials struct {
+	Instance string `json:"instance" yaml:"instance"`
+	// Store is where the credentials are kept, empty for the fixed legacy credentials
+	Store            string `json:"store" yaml:"store"`
+	PostgresUser     string `json:"postgres_user" yaml:"postgres_user"`
+	PostgresPassword string `json:"postgres_password" yaml:"postgres_password"`
+	Neo4jUser        string `json:"neo4j_user" yaml:"neo4j_user"`
+	// Neo4jPassword is empty if Neo4j runs without authentication
+	Neo4jPassword string `json:"neo4j_password" yaml:"neo4j_password"`
+}
+
+// legacyCredentials returns the credentials of an instance deployed before they were generated
+func legacyCredentials(instanceName string) InstanceCredentials {
+	return InstanceCredentials{
+		Instance:         instanceName,
+		PostgresUser:     PostgresUser,
+		PostgresPassword: LegacyPostgresPassword,
+		Neo4jUser:        Neo4jUser,
+	}
+}
+
+// Neo4jAuth returns the NEO4J_AUTH setting of the neo4j image for the credentials
+func (c InstanceCredentials) Neo4jAuth() string {
+	if c.Neo4jPassword == "" {
+		return "none"
+	}
+	return c.Neo4jUser + "/" + c.Neo4jPassword
+}
+
+// Env returns the credential environment variables the instance's containers are started with
+func (c InstanceCredentials) Env() map[string]string {
+	return map[string]string{
+		PostgresPasswordEnv: c.PostgresPassword,
+		Neo4jPasswordEnv:    c.Neo4jPassword,
+		Neo4jAuthEnv:        c.Neo4jAuth(),
+	}
+}
+
+// CypherShellEnv returns the environment cypher-shell reads its password from, so the
+// password never shows up on a command line
+func (c InstanceCredentials) CypherShellEnv() map[string]string {
+	// Without authentication Neo4j accepts any password, but cypher-shell insists on one
+	password := c.Neo4jPassword
+	if password == "" {
+		password = "none"
+	}
+	return map[string]string{Neo4jPasswordEnv: password}
+}
+
+// GenerateCredentials returns new random database passwords for an instance
+func GenerateCredentials(instanceName string) (InstanceCredentials, error) {
+	credentials := legacyCredentials(instanceName)
+	var err error
+	if credentials.PostgresPassword, err = randomPassword(); err != nil {
+		return InstanceCredentials{}, err
+	}
+	if credentials.Neo4jPassword, err = randomPassword(); err != nil {
+		return InstanceCredentials{}, err
+	}
+	return credentials, nil
+}
+
+// randomPassword returns a password of credentialLength characters from credentialAlphabet
+func randomPassword() (string, error) {
+	password := make([]byte, credentialLength)
+	max := big.NewInt(int64(len(credentialAlphabet)))
+	for i := range password {
+		n, err := rand.Int(rand.Reader, max)
+		if err != nil {
+			return "", fmt.Errorf("failed to generate password: %v", err)
+		}
+		password[i] = credentialAlphabet[n.Int64()]
+	}
+	return string(password), nil
+}
+
+// credentialKeyringName returns the name a credential of an instance is stored under in the
+// OS keyring
+func credentialKeyringName(instanceName, env string) string {
+	return instanceName + "/" + env
+}
+
+// CredentialsFile returns the file the credentials of an instance are kept in where no OS
+// keyring is available
+func CredentialsFile(instanceName string) (string, error) {
+	graphsenseDir, err := GetGraphsenseDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(graphsenseDir, "credentials", instanceName+".env"), nil
+}
+
+// LoadInstanceCredentials reads the credentials of an instance from store
+func LoadInstanceCredentials(instanceName, store string) (InstanceCredentials, error) {
+	credentials := legacyCredentials(instanceName)
+	credentials.Store = store
+	var err error
+	switch store {
+	case "":
+		return credentials, nil
+	case CredentialStoreKeyring:
+		if credentials.PostgresPassword, err = KeyringGet(credentialKeyringName(instanceName, PostgresPasswordEnv)); err != nil {
+			return InstanceCredentials{}, fmt.Errorf("failed to read credentials of %s: %v", instanceName, err)
+		}
+		if credentials.Neo4jPassword, err = KeyringGet(credentialKeyringName(instanceName, Neo4jPasswordEnv)); err != nil {
+			return InstanceCredentials{}, fmt.Errorf("failed to read credentials of %s: %v", instanceName, err)
+		}
+	case CredentialStoreFile:
+		path, err := CredentialsFile(instanceName)
+		if err != nil {
+			return InstanceCredentials{}, err
+		}
+		env, err := readEnvFile(path)
+		if err != nil {
+			return InstanceCredentials{}, fmt.Errorf("failed to read credentials of %s: %v", instanceName, err)
+		}
+		credentials.PostgresPassword, credentials.Neo4jPassword = env[PostgresPasswordEnv], env[Neo4jPasswordEnv]
+		if credentials.PostgresPassword == "" || credentials.Neo4jPassword == "" {
+			return InstanceCredentials{}, fmt.Errorf("credentials of %s are incomplete in %s", instanceName, path)
+		}
+	default:
+		return InstanceCredentials{}, fmt.Errorf("unknown credential store '%s' recorded for %s", store, instanceName)
+	}
+	return credentials, nil
+}
+
+// SaveInstanceCredentials stores the credentials of an instance in the OS keyring, or in a
+// file readable only by the user where no keyring is available. It returns the store used.
+func SaveInstanceCredentials(instanceName string, credentials InstanceCredentials) (string, error) {
+	err := KeyringSet(credentialKeyringName(instanceName, PostgresPasswordEnv), credentials.PostgresPassword)
+	if err == nil {
+		err = KeyringSet(credentialKeyringName(instanceName, Neo4jPasswordEnv), credentials.Neo4jPassword)
+	}
+	if err == nil {
+		return CredentialStoreKeyring, nil
+	}
+	if !errors.Is(err, ErrKeyringUnavailable) {
+		return "", err
+	}
+
+	Log.Warning("Storing database credentials in clear text", "instance", instanceName, "reason", err)
+	path, err := CredentialsFile(instanceName)
+	if err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return "", fmt.Errorf("failed to create credentials directory: %v", err)
+	}
+	content := fmt.Sprintf("%s=%s\n%s=%s\n", PostgresPasswordEnv, credentials.PostgresPassword, Neo4jPasswordEnv, credentials.Neo4jPassword)
+	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+		return "", fmt.Errorf("failed to write credentials of %s: %v", instanceName, err)
+	}
+	return CredentialStoreFile, nil
+}
+
+// DeleteInstanceCredentials removes the stored credentials of an instance. Credentials that
+// are already gone are not an error.
+func DeleteInstanceCredentials(instanceName, store string) error {
+	switch store {
+	case CredentialStoreKeyring:
+		for _, env := range []string{PostgresPasswordEnv, Neo4jPasswordEnv} {
+			if err := KeyringDelete(credentialKeyringName(instanceName, env)); err != nil && !errors.Is(err, ErrKeyNotFound) {
+				return fmt.Errorf("failed to delete credentials of %s: %v", instanceName, err)
+			}
+		}
+	case CredentialStoreFile:
+		path, err := CredentialsFile(instanceName)
+		if err != nil {
+			return err
+		}
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("failed to delete credentials of %s: %v", instanceName, err)
+		}
+	}
+	return nil
+}
+
+// findStoredCredentials returns credentials left behind under an instance name, e.g. by
+// 'remove --keep-data', or ok false if there are none
+func findStoredCredentials(instanceName string) (InstanceCredentials, bool) {
+	for _, store := range []string{CredentialStoreKeyring, CredentialStoreFile} {
+		credentials, err := LoadInstanceCredentials(instanceName, store)
+		if err == nil {
+			return credentials, true
+		}
+		Log.Debug("No stored credentials found", "instance", instanceName, "store", store, "reason", err)
+	}
+	return InstanceCredentials{}, false
+}
+
+// SetupCredentials gives a new instance its database credentials. Credentials kept along
+// with its data volumes are reused, since the databases were initialised with them; volumes
+// kept without credentials belong to an instance deployed before credentials were generated,
+// so the legacy credentials are kept. Otherwise new credentials are generated and stored.
+// created reports whether they were, so a failed deploy can delete them again.
+func SetupCredentials(config *DeployConfig) (created bool, err error) {
+	if credentials, ok := findStoredCredentials(config.InstanceName); ok {
+		Log.Info("Reusing the database credentials kept with the instance's data", "instance", config.InstanceName)
+		config.CredentialStore = credentials.Store
+		config.credentials = &credentials
+		return false, nil
+	}
+
+	if volumes, err := InstanceVolumes(config.InstanceName); err != nil {
+		return false, err
+	} else if len(volumes) > 0 {
+		Log.Warning("Keeping the default database credentials the existing data volumes were created with", "instance", config.InstanceName, "volumes", strings.Join(volumes, ", "))
+		config.CredentialStore = ""
+		credentials := legacyCredentials(config.InstanceName)
+		config.credentials = &credentials
+		return false, nil
+	}
+
+	credentials, err := GenerateCredentials(config.InstanceName)
+	if err != nil {
+		return false, err
+	}
+	store, err := SaveInstanceCredentials(config.InstanceName, credentials)
+	if err != nil {
+		return false, err
+	}
+	credentials.Store = store
+	config.CredentialStore = store
+	config.credentials = &credentials
+	return true, nil
+}
+
+// CopyInstanceCredentials stores the credentials of source under the name of target, whose
+// databases are copies of those of source
+func CopyInstanceCredentials(source, target *DeployConfig) error {
+	credentials, err := source.Credentials()
+	if err != nil {
+		return err
+	}
+	credentials.Instance = target.InstanceName
+	if source.CredentialStore != "" {
+		if credentials.Store, err = SaveInstanceCredentials(target.InstanceName, credentials); err != nil {
+			return err
+		}
+	}
+	target.CredentialStore = credentials.Store
+	target.credentials = &credentials
+	return nil
+}
+
+// MoveInstanceCredentials stores the credentials of an instance under newName and removes
+// them from its current name, which the caller then changes to newName
+func MoveInstanceCredentials(config *DeployConfig, newName string) error {
+	renamed := *config
+	renamed.InstanceName = newName
+	if err := CopyInstanceCredentials(config, &renamed); err != nil {
+		return err
+	}
+	if err := DeleteInstanceCredentials(config.InstanceName, config.CredentialStore); err != nil {
+		Log.Warning("Failed to delete the credentials stored under the old name", "instance", config.InstanceName, "error", err)
+	}
+	config.CredentialStore = renamed.CredentialStore
+	config.credentials = renamed.credentials
+	return nil
+}
+
+// Credentials returns the database credentials of the instance, reading them from their
+// store the first time
+func (c *DeployConfig) Credentials() (InstanceCredentials, error) {
+	if c.credentials == nil || c.credentials.Instance != c.InstanceName {
+		credentials, err := LoadInstanceCredentials(c.InstanceName, c.CredentialStore)
+		if err != nil {
+			return InstanceCredentials{}, err
+		}
+		c.credentials = &credentials
+	}
+	return *c.credentials, nil
+}
+
+// SecretEnv returns the API key and database credential environment variables of the
+// instance. They reach compose and docker run through their environment, so they are never
+// written to disk.
+func (c *DeployConfig) SecretEnv() (map[string]string, error) {
+	credentials, err := c.Credentials()
+	if err != nil {
+		return nil, err
+	}
+	env := c.APIKeyEnv()
+	for key, value := range credentials.Env() {
+		env[key] = value
+	}
+	return env, nil
+}
+
+// CypherShellEnv returns the environment cypher-shell needs to log in to the instance's Neo4j
+func (c *DeployConfig) CypherShellEnv() (map[string]string, error) {
+	credentials, err := c.Credentials()
+	if err != nil {
+		return nil, err
+	}
+	return credentials.CypherShellEnv(), nil
+}
@@ -0,0 +1,46 @@
+package internal
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+)
+
+// StartDetached runs graphsense-cli with args in the background, detached from the terminal,
+// appending its output to logPath
+func StartDetached(args []string, logPath string) (*exec.Cmd, error) {
+	executable, err := os.Executable()
+	if err != nil {
+		return nil, fmt.Errorf("failed to locate graphsense-cli: %v", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(logPath), 0755); err != nil {
+		return nil, fmt.Errorf("failed to create %s: %v", filepath.Dir(logPath), err)
+	}
+	logFile, err := os.OpenFile(logPath, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %s: %v", logPath, err)
+	}
+	defer logFile.Close()
+
+	cmd := exec.Command(executable, args...)
+	cmd.Stdout = logFile
+	cmd.Stderr = logFile
+	cmd.SysProcAttr = detachedProcAttr()
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("failed to start graphsense-cli in the background: %v", err)
+	}
+	return cmd, nil
+}
+
+// StopProcess asks the process with the given ID to exit
+func StopProcess(pid int) error {
+	process, err := os.FindProcess(pid)
+	if err != nil {
+		return fmt.Errorf("failed to find process %d: %v", pid, err)
+	}
+	if err := terminateProcess(process); err != nil {
+		return fmt.Errorf("failed to stop process %d: %v", pid, err)
+	}
+	return nil
+}
@@ -0,0 +1,19 @@
+//go:build !windows
+
+package internal
+
+import (
+	"os"
+	"syscall"
+)
+
+// detachedProcAttr starts a process in a session of its own, so that closing the terminal
+// does not stop it
+func detachedProcAttr() *syscall.SysProcAttr {
+	return &syscall.SysProcAttr{Setsid: true}
+}
+
+// terminateProcess asks a process to exit, letting it clean up
+func terminateProcess(process *os.Process) error {
+	return process.Signal(syscall.SIGTERM)
+}
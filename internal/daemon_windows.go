@@ -0,0 +1,23 @@
+//go:build windows
+
+package internal
+
+import (
+	"os"
+	"syscall"
+)
+
+// detachedProcess starts a process without a console
+const detachedProcess = 0x00000008
+
+// detachedProcAttr starts a process without a console in a process group of its own, so
+// that closing the terminal does not stop it
+func detachedProcAttr() *syscall.SysProcAttr {
+	return &syscall.SysProcAttr{CreationFlags: detachedProcess | syscall.CREATE_NEW_PROCESS_GROUP, HideWindow: true}
+}
+
+// terminateProcess stops a process. Windows cannot deliver signals to processes without a
+// console, so it is killed.
+func terminateProcess(process *os.Process) error {
+	return process.Kill()
+}
@@ -1,10 +1,14 @@
 package internal
 
 import (
+	"bufio"
 	"database/sql"
+	"errors"
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
+	"time"
 
 	_ "github.com/mattn/go-sqlite3"
 )
@@ -21,6 +25,30 @@ type Instance struct {
 	CreatedAt     string `json:"created_at"`
 }
 
+// Backup represents a backup archive of an instance
+type Backup struct {
+	ID           int    `json:"id"`
+	InstanceName string `json:"instance_name"`
+	Path         string `json:"path"`
+	SizeBytes    int64  `json:"size_bytes"`
+	CreatedAt    string `json:"created_at"`
+}
+
+// GetGraphsenseDir returns the ~/.graphsense directory, creating it if needed
+func GetGraphsenseDir() (string, error) {
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to get home directory: %v", err)
+	}
+
+	graphsenseDir := filepath.Join(homeDir, ".graphsense")
+	if err := os.MkdirAll(graphsenseDir, 0755); err != nil {
+		return "", fmt.Errorf("failed to create .graphsense directory: %v", err)
+	}
+
+	return graphsenseDir, nil
+}
+
 // InitDB initializes the SQLite database
 func InitDB() (*sql.DB, error) {
 	homeDir, err := os.UserHomeDir()
@@ -39,16 +67,18 @@ func InitDB() (*sql.DB, error) {
 	dbExists := true
 	if _, err := os.Stat(dbPath); os.IsNotExist(err) {
 		dbExists = false
-		Log.Info(fmt.Sprintf("Creating new database at: %s", dbPath))
+		Log.Verbose("Creating new database", "path", dbPath)
 	}
 	
-	db, err := sql.Open("sqlite3", dbPath)
+	// Concurrent CLI runs wait for each other's writes, and transactions take the write lock
+	// up front so two of them cannot both read a port as free and then reserve it
+	db, err := sql.Open("sqlite3", dbPath+"?_busy_timeout=5000&_txlock=immediate")
 	if err != nil {
 		return nil, fmt.Errorf("failed to open database: %v", err)
 	}
 	
 	if !dbExists {
-		Log.Info("Database file created successfully")
+		Log.Verbose("Database file created successfully")
 	}
 
 	// Create the instances table if it doesn't exist
@@ -70,9 +100,394 @@ func InitDB() (*sql.DB, error) {
 		return nil, fmt.Errorf("failed to create instances table: %v", err)
 	}
 
+	// Create the deployments table used to resume interrupted deploys
+	createDeploymentsSQL := `
+	CREATE TABLE IF NOT EXISTS deployments (
+		instance_name TEXT PRIMARY KEY,
+		repo_path TEXT NOT NULL,
+		app_port INTEGER NOT NULL,
+		postgres_port INTEGER NOT NULL,
+		neo4j_bolt_port INTEGER NOT NULL,
+		status TEXT NOT NULL,
+		updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+	);`
+
+	if _, err := db.Exec(createDeploymentsSQL); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to create deployments table: %v", err)
+	}
+
+	// Columns added to the deployments table after its first release
+	if err := ensureColumn(db, "deployments", "app_image", "TEXT NOT NULL DEFAULT ''"); err != nil {
+		db.Close()
+		return nil, err
+	}
+	if err := ensureColumn(db, "deployments", "postgres_version", "TEXT NOT NULL DEFAULT ''"); err != nil {
+		db.Close()
+		return nil, err
+	}
+	if err := ensureColumn(db, "deployments", "neo4j_version", "TEXT NOT NULL DEFAULT ''"); err != nil {
+		db.Close()
+		return nil, err
+	}
+	if err := ensureColumn(db, "deployments", "mode", "TEXT NOT NULL DEFAULT 'compose'"); err != nil {
+		db.Close()
+		return nil, err
+	}
+	if err := ensureColumn(db, "deployments", "embedding_model", "TEXT NOT NULL DEFAULT ''"); err != nil {
+		db.Close()
+		return nil, err
+	}
+	if err := ensureColumn(db, "deployments", "log_level", "TEXT NOT NULL DEFAULT ''"); err != nil {
+		db.Close()
+		return nil, err
+	}
+	if err := ensureColumn(db, "deployments", "exclude_submodules", "INTEGER NOT NULL DEFAULT 0"); err != nil {
+		db.Close()
+		return nil, err
+	}
+	if err := ensureColumn(db, "deployments", "repo_url", "TEXT NOT NULL DEFAULT ''"); err != nil {
+		db.Close()
+		return nil, err
+	}
+	if err := ensureColumn(db, "deployments", "autostart", "TEXT NOT NULL DEFAULT ''"); err != nil {
+		db.Close()
+		return nil, err
+	}
+	if err := ensureColumn(db, "deployments", "bind_address", "TEXT NOT NULL DEFAULT ''"); err != nil {
+		db.Close()
+		return nil, err
+	}
+	if err := ensureColumn(db, "deployments", "cpuset", "TEXT NOT NULL DEFAULT ''"); err != nil {
+		db.Close()
+		return nil, err
+	}
+	if err := ensureColumn(db, "deployments", "neo4j_cpuset", "TEXT NOT NULL DEFAULT ''"); err != nil {
+		db.Close()
+		return nil, err
+	}
+	if err := ensureColumn(db, "deployments", "index_workers", "INTEGER NOT NULL DEFAULT 0"); err != nil {
+		db.Close()
+		return nil, err
+	}
+	if err := ensureColumn(db, "deployments", "index_batch_size", "INTEGER NOT NULL DEFAULT 0"); err != nil {
+		db.Close()
+		return nil, err
+	}
+	if err := ensureColumn(db, "deployments", "nice", "INTEGER NOT NULL DEFAULT 0"); err != nil {
+		db.Close()
+		return nil, err
+	}
+	if err := ensureColumn(db, "deployments", "credential_store", "TEXT NOT NULL DEFAULT ''"); err != nil {
+		db.Close()
+		return nil, err
+	}
+	if err := ensureColumn(db, "deployments", "tls", "INTEGER NOT NULL DEFAULT 0"); err != nil {
+		db.Close()
+		return nil, err
+	}
+	if err := ensureColumn(db, "deployments", "memory_limit", "INTEGER NOT NULL DEFAULT 0"); err != nil {
+		db.Close()
+		return nil, err
+	}
+	if err := ensureColumn(db, "deployments", "cpu_limit", "REAL NOT NULL DEFAULT 0"); err != nil {
+		db.Close()
+		return nil, err
+	}
+	if err := ensureColumn(db, "deployments", "neo4j_heap", "INTEGER NOT NULL DEFAULT 0"); err != nil {
+		db.Close()
+		return nil, err
+	}
+	if err := ensureColumn(db, "deployments", "neo4j_pagecache", "INTEGER NOT NULL DEFAULT 0"); err != nil {
+		db.Close()
+		return nil, err
+	}
+	if err := ensureColumn(db, "deployments", "gpu", "TEXT NOT NULL DEFAULT ''"); err != nil {
+		db.Close()
+		return nil, err
+	}
+	if err := ensureColumn(db, "deployments", "postgres_image", "TEXT NOT NULL DEFAULT ''"); err != nil {
+		db.Close()
+		return nil, err
+	}
+	if err := ensureColumn(db, "deployments", "neo4j_image", "TEXT NOT NULL DEFAULT ''"); err != nil {
+		db.Close()
+		return nil, err
+	}
+	if err := ensureColumn(db, "deployments", "expires_at", "INTEGER NOT NULL DEFAULT 0"); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	// Create the backups table listing archives created by the backup command
+	createBackupsSQL := `
+	CREATE TABLE IF NOT EXISTS backups (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		instance_name TEXT NOT NULL,
+		path TEXT NOT NULL UNIQUE,
+		size_bytes INTEGER NOT NULL,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+	);`
+
+	if _, err := db.Exec(createBackupsSQL); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to create backups table: %v", err)
+	}
+
+	// Create the instance_activity table tracking when each instance was last used
+	createActivitySQL := `
+	CREATE TABLE IF NOT EXISTS instance_activity (
+		instance_name TEXT PRIMARY KEY,
+		last_used DATETIME NOT NULL,
+		last_event TEXT NOT NULL
+	);`
+
+	if _, err := db.Exec(createActivitySQL); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to create instance_activity table: %v", err)
+	}
+
+	// Create the access_log table recording requests proxied to instances
+	createAccessLogSQL := `
+	CREATE TABLE IF NOT EXISTS access_log (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		instance_name TEXT NOT NULL,
+		client TEXT NOT NULL,
+		remote_addr TEXT NOT NULL,
+		method TEXT NOT NULL,
+		path TEXT NOT NULL,
+		status INTEGER NOT NULL,
+		latency_ms REAL NOT NULL,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+	);
+	CREATE INDEX IF NOT EXISTS access_log_instance ON access_log(instance_name, created_at);`
+
+	if _, err := db.Exec(createAccessLogSQL); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to create access_log table: %v", err)
+	}
+
+	// Create the access_log_imports table tracking how far the reverse proxy's access log
+	// has been imported into access_log
+	createAccessLogImportsSQL := `
+	CREATE TABLE IF NOT EXISTS access_log_imports (
+		path TEXT PRIMARY KEY,
+		position INTEGER NOT NULL
+	);`
+
+	if _, err := db.Exec(createAccessLogImportsSQL); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to create access_log_imports table: %v", err)
+	}
+
+	// Create the supervisor_events table recording what supervise found and did
+	createSupervisorEventsSQL := `
+	CREATE TABLE IF NOT EXISTS supervisor_events (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		instance_name TEXT NOT NULL,
+		service TEXT NOT NULL,
+		action TEXT NOT NULL,
+		detail TEXT NOT NULL DEFAULT '',
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+	);
+	CREATE INDEX IF NOT EXISTS supervisor_events_instance ON supervisor_events(instance_name, created_at);`
+
+	if _, err := db.Exec(createSupervisorEventsSQL); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to create supervisor_events table: %v", err)
+	}
+
+	// Create the deploy_checkpoints table recording which stages of a deploy have completed
+	createCheckpointsSQL := `
+	CREATE TABLE IF NOT EXISTS deploy_checkpoints (
+		instance_name TEXT NOT NULL,
+		stage TEXT NOT NULL,
+		completed_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		PRIMARY KEY(instance_name, stage)
+	);`
+
+	if _, err := db.Exec(createCheckpointsSQL); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to create deploy_checkpoints table: %v", err)
+	}
+
+	// Create the instance_state table recording instances stopped on purpose
+	createStateSQL := `
+	CREATE TABLE IF NOT EXISTS instance_state (
+		instance_name TEXT PRIMARY KEY,
+		stopped INTEGER NOT NULL DEFAULT 0,
+		updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+	);`
+
+	if _, err := db.Exec(createStateSQL); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to create instance_state table: %v", err)
+	}
+
+	// Create the indexed_commits table recording the repository commit each instance last indexed
+	createIndexedCommitsSQL := `
+	CREATE TABLE IF NOT EXISTS indexed_commits (
+		instance_name TEXT PRIMARY KEY,
+		commit_sha TEXT NOT NULL,
+		indexed_at DATETIME NOT NULL
+	);`
+
+	if _, err := db.Exec(createIndexedCommitsSQL); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to create indexed_commits table: %v", err)
+	}
+	if err := ensureColumn(db, "indexed_commits", "branch", "TEXT NOT NULL DEFAULT ''"); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	// Create the port_reservations table holding the host ports allocated to each instance.
+	// When it is first created, it is filled with the ports of the instances deployed before it.
+	var reservationsExist int
+	if err := db.QueryRow(`SELECT count(*) FROM sqlite_master WHERE type = 'table' AND name = 'port_reservations'`).Scan(&reservationsExist); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to check for port_reservations table: %v", err)
+	}
+	createReservationsSQL := `
+	CREATE TABLE IF NOT EXISTS port_reservations (
+		port INTEGER PRIMARY KEY,
+		instance_name TEXT NOT NULL,
+		reserved_at DATETIME DEFAULT CURRENT_TIMESTAMP
+	);
+	CREATE INDEX IF NOT EXISTS port_reservations_instance ON port_reservations(instance_name);`
+
+	if _, err := db.Exec(createReservationsSQL); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to create port_reservations table: %v", err)
+	}
+	if reservationsExist == 0 {
+		backfillSQL := `
+		INSERT OR IGNORE INTO port_reservations (port, instance_name)
+		SELECT app_port, instance_name FROM deployments
+		UNION SELECT postgres_port, instance_name FROM deployments
+		UNION SELECT neo4j_bolt_port, instance_name FROM deployments
+		UNION SELECT app_port, instance_name FROM instances
+		UNION SELECT postgres_port, instance_name FROM instances
+		UNION SELECT neo4j_bolt_port, instance_name FROM instances`
+		if _, err := db.Exec(backfillSQL); err != nil {
+			db.Close()
+			return nil, fmt.Errorf("failed to reserve ports of existing instances: %v", err)
+		}
+	}
+
+	// Create the instance_labels table holding the key=value labels given at deploy time
+	createLabelsSQL := `
+	CREATE TABLE IF NOT EXISTS instance_labels (
+		instance_name TEXT NOT NULL,
+		key TEXT NOT NULL,
+		value TEXT NOT NULL,
+		PRIMARY KEY (instance_name, key)
+	);`
+
+	if _, err := db.Exec(createLabelsSQL); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to create instance_labels table: %v", err)
+	}
+
+	// Create the service_limits table holding limits deploy gave single services of an instance
+	createServiceLimitsSQL := `
+	CREATE TABLE IF NOT EXISTS service_limits (
+		instance_name TEXT NOT NULL,
+		service TEXT NOT NULL,
+		memory_limit INTEGER NOT NULL DEFAULT 0,
+		cpu_limit REAL NOT NULL DEFAULT 0,
+		PRIMARY KEY (instance_name, service)
+	);`
+
+	if _, err := db.Exec(createServiceLimitsSQL); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to create service_limits table: %v", err)
+	}
+
+	// Create the service_env table holding environment overrides of single services of an instance
+	createServiceEnvSQL := `
+	CREATE TABLE IF NOT EXISTS service_env (
+		instance_name TEXT NOT NULL,
+		service TEXT NOT NULL,
+		name TEXT NOT NULL,
+		value TEXT NOT NULL,
+		PRIMARY KEY (instance_name, service, name)
+	);`
+
+	if _, err := db.Exec(createServiceEnvSQL); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to create service_env table: %v", err)
+	}
+
+	// Create the deployed_images table holding the image and digest each service of an
+	// instance was last deployed or upgraded with
+	createDeployedImagesSQL := `
+	CREATE TABLE IF NOT EXISTS deployed_images (
+		instance_name TEXT NOT NULL,
+		service TEXT NOT NULL,
+		image TEXT NOT NULL,
+		digest TEXT NOT NULL DEFAULT '',
+		recorded_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		PRIMARY KEY (instance_name, service)
+	);`
+
+	if _, err := db.Exec(createDeployedImagesSQL); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to create deployed_images table: %v", err)
+	}
+
+	// Create the mcp_registrations table holding the MCP client config files deploy
+	// --register-mcp added an instance to
+	createMCPRegistrationsSQL := `
+	CREATE TABLE IF NOT EXISTS mcp_registrations (
+		instance_name TEXT NOT NULL,
+		client TEXT NOT NULL,
+		path TEXT NOT NULL,
+		PRIMARY KEY (instance_name, client)
+	);`
+
+	if _, err := db.Exec(createMCPRegistrationsSQL); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to create mcp_registrations table: %v", err)
+	}
+
 	return db, nil
 }
 
+// ensureColumn adds a column to an existing table if it is missing
+func ensureColumn(db *sql.DB, table, column, definition string) error {
+	rows, err := db.Query(fmt.Sprintf("PRAGMA table_info(%s)", table))
+	if err != nil {
+		return fmt.Errorf("failed to inspect %s table: %v", table, err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			cid        int
+			name       string
+			colType    string
+			notNull    int
+			defaultVal sql.NullString
+			primaryKey int
+		)
+		if err := rows.Scan(&cid, &name, &colType, &notNull, &defaultVal, &primaryKey); err != nil {
+			return fmt.Errorf("failed to scan row: %v", err)
+		}
+		if name == column {
+			return nil
+		}
+	}
+	rows.Close()
+
+	alterSQL := fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", table, column, definition)
+	if _, err := db.Exec(alterSQL); err != nil {
+		return fmt.Errorf("failed to add column %s to %s: %v", column, table, err)
+	}
+
+	return nil
+}
+
 // StoreInstanceContainers stores container names for a deployed instance
 func StoreInstanceContainers(config *DeployConfig) error {
 	db, err := InitDB()
@@ -82,11 +497,7 @@ func StoreInstanceContainers(config *DeployConfig) error {
 	defer db.Close()
 
 	// Container names based on the compose override pattern
-	containerNames := []string{
-		fmt.Sprintf("%s-app", config.InstanceName),
-		fmt.Sprintf("%s-postgres", config.InstanceName),
-		fmt.Sprintf("%s-neo4j", config.InstanceName),
-	}
+	containerNames := InstanceContainerNames(config.InstanceName)
 
 	// Insert each container
 	insertSQL := `
@@ -108,7 +519,7 @@ func StoreInstanceContainers(config *DeployConfig) error {
 		}
 	}
 
-	Log.Info(fmt.Sprintf("Stored %d containers for instance %s in database", len(containerNames), config.InstanceName))
+	Log.Verbose("Stored containers in database", "instance", config.InstanceName, "containers", len(containerNames))
 	return nil
 }
 
@@ -173,7 +584,7 @@ func RemoveInstanceContainers(instanceName string) error {
 		return fmt.Errorf("failed to get rows affected: %v", err)
 	}
 
-	Log.Info(fmt.Sprintf("Removed %d containers for instance %s from database", rowsAffected, instanceName))
+	Log.Verbose("Removed containers from database", "instance", instanceName, "containers", rowsAffected)
 	return nil
 }
 
@@ -217,3 +628,1010 @@ func GetAllInstances() ([]Instance, error) {
 
 	return instances, nil
 }
+
+
+// SaveDeployment records the configuration and status of a deploy so it can be resumed
+func SaveDeployment(config *DeployConfig, status string) error {
+	db, err := InitDB()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	upsertSQL := `
+	INSERT OR REPLACE INTO deployments
+	(instance_name, repo_path, app_port, postgres_port, neo4j_bolt_port, app_image, postgres_version, neo4j_version, mode, embedding_model, log_level, exclude_submodules, repo_url, autostart, bind_address, cpuset, neo4j_cpuset, index_workers, index_batch_size, nice, credential_store, tls, memory_limit, cpu_limit, neo4j_heap, neo4j_pagecache, gpu, postgres_image, neo4j_image, expires_at, status, updated_at)
+	VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, CURRENT_TIMESTAMP)`
+
+	// Expiry times are stored as Unix seconds, 0 for never
+	var expiresAt int64
+	if !config.ExpiresAt.IsZero() {
+		expiresAt = config.ExpiresAt.Unix()
+	}
+
+	_, err = db.Exec(upsertSQL,
+		config.InstanceName,
+		config.RepoPath,
+		config.AppPort,
+		config.PostgresPort,
+		config.Neo4jBoltPort,
+		config.AppImage,
+		config.PostgresVersion,
+		config.Neo4jVersion,
+		config.DeployMode(),
+		config.EmbeddingModel,
+		config.LogLevel,
+		config.ExcludeSubmodules,
+		config.RepoURL,
+		config.Autostart,
+		config.BindAddress,
+		config.CPUSet,
+		config.Neo4jCPUSet,
+		config.IndexWorkers,
+		config.IndexBatchSize,
+		config.Nice,
+		config.CredentialStore,
+		config.TLS,
+		config.Limits.Memory,
+		config.Limits.CPUs,
+		config.Neo4jHeap,
+		config.Neo4jPageCache,
+		config.GPU,
+		config.PostgresImage,
+		config.Neo4jImage,
+		expiresAt,
+		status,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to save deployment %s: %v", config.InstanceName, err)
+	}
+
+	if _, err := db.Exec(`DELETE FROM instance_labels WHERE instance_name = ?`, config.InstanceName); err != nil {
+		return fmt.Errorf("failed to save labels of %s: %v", config.InstanceName, err)
+	}
+	for key, value := range config.Labels {
+		if _, err := db.Exec(`INSERT INTO instance_labels (instance_name, key, value) VALUES (?, ?, ?)`, config.InstanceName, key, value); err != nil {
+			return fmt.Errorf("failed to save labels of %s: %v", config.InstanceName, err)
+		}
+	}
+
+	if _, err := db.Exec(`DELETE FROM service_limits WHERE instance_name = ?`, config.InstanceName); err != nil {
+		return fmt.Errorf("failed to save limits of %s: %v", config.InstanceName, err)
+	}
+	for service, limits := range config.ServiceLimits {
+		if limits.IsZero() {
+			continue
+		}
+		if _, err := db.Exec(`INSERT INTO service_limits (instance_name, service, memory_limit, cpu_limit) VALUES (?, ?, ?, ?)`, config.InstanceName, service, limits.Memory, limits.CPUs); err != nil {
+			return fmt.Errorf("failed to save limits of %s: %v", config.InstanceName, err)
+		}
+	}
+
+	if _, err := db.Exec(`DELETE FROM service_env WHERE instance_name = ?`, config.InstanceName); err != nil {
+		return fmt.Errorf("failed to save environment of %s: %v", config.InstanceName, err)
+	}
+	for service, vars := range config.ServiceEnv {
+		for name, value := range vars {
+			if _, err := db.Exec(`INSERT INTO service_env (instance_name, service, name, value) VALUES (?, ?, ?, ?)`, config.InstanceName, service, name, value); err != nil {
+				return fmt.Errorf("failed to save environment of %s: %v", config.InstanceName, err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// GetDeployment retrieves the recorded deploy configuration and status for an instance.
+// It returns a nil config if no deploy has been recorded.
+func GetDeployment(instanceName string) (*DeployConfig, string, error) {
+	db, err := InitDB()
+	if err != nil {
+		return nil, "", err
+	}
+	defer db.Close()
+
+	query := `
+	SELECT repo_path, app_port, postgres_port, neo4j_bolt_port, app_image, postgres_version, neo4j_version, mode, embedding_model, log_level, exclude_submodules, repo_url, autostart, bind_address, cpuset, neo4j_cpuset, index_workers, index_batch_size, nice, credential_store, tls, memory_limit, cpu_limit, neo4j_heap, neo4j_pagecache, gpu, postgres_image, neo4j_image, expires_at, status
+	FROM deployments
+	WHERE instance_name = ?`
+
+	config := &DeployConfig{InstanceName: instanceName}
+	var status string
+	var expiresAt int64
+	err = db.QueryRow(query, instanceName).Scan(
+		&config.RepoPath,
+		&config.AppPort,
+		&config.PostgresPort,
+		&config.Neo4jBoltPort,
+		&config.AppImage,
+		&config.PostgresVersion,
+		&config.Neo4jVersion,
+		&config.Mode,
+		&config.EmbeddingModel,
+		&config.LogLevel,
+		&config.ExcludeSubmodules,
+		&config.RepoURL,
+		&config.Autostart,
+		&config.BindAddress,
+		&config.CPUSet,
+		&config.Neo4jCPUSet,
+		&config.IndexWorkers,
+		&config.IndexBatchSize,
+		&config.Nice,
+		&config.CredentialStore,
+		&config.TLS,
+		&config.Limits.Memory,
+		&config.Limits.CPUs,
+		&config.Neo4jHeap,
+		&config.Neo4jPageCache,
+		&config.GPU,
+		&config.PostgresImage,
+		&config.Neo4jImage,
+		&expiresAt,
+		&status,
+	)
+	if err == sql.ErrNoRows {
+		return nil, "", nil
+	}
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to query deployment %s: %v", instanceName, err)
+	}
+	if expiresAt != 0 {
+		config.ExpiresAt = time.Unix(expiresAt, 0)
+	}
+
+	if config.Labels, err = queryInstanceLabels(db, instanceName); err != nil {
+		return nil, "", err
+	}
+	if config.ServiceLimits, err = queryServiceLimits(db, instanceName); err != nil {
+		return nil, "", err
+	}
+	if config.ServiceEnv, err = queryServiceEnv(db, instanceName); err != nil {
+		return nil, "", err
+	}
+
+	return config, status, nil
+}
+
+// GetInstanceLabels returns the labels of an instance, or nil if it has none
+func GetInstanceLabels(instanceName string) (map[string]string, error) {
+	db, err := InitDB()
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	return queryInstanceLabels(db, instanceName)
+}
+
+// queryInstanceLabels reads the labels of an instance from an open database
+func queryInstanceLabels(db *sql.DB, instanceName string) (map[string]string, error) {
+	rows, err := db.Query(`SELECT key, value FROM instance_labels WHERE instance_name = ?`, instanceName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query labels of %s: %v", instanceName, err)
+	}
+	defer rows.Close()
+
+	var labels map[string]string
+	for rows.Next() {
+		var key, value string
+		if err := rows.Scan(&key, &value); err != nil {
+			return nil, fmt.Errorf("failed to scan row: %v", err)
+		}
+		if labels == nil {
+			labels = make(map[string]string)
+		}
+		labels[key] = value
+	}
+	return labels, rows.Err()
+}
+
+// queryServiceLimits reads the limits of single services of an instance from an open database
+func queryServiceLimits(db *sql.DB, instanceName string) (map[string]ResourceLimits, error) {
+	rows, err := db.Query(`SELECT service, memory_limit, cpu_limit FROM service_limits WHERE instance_name = ?`, instanceName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query limits of %s: %v", instanceName, err)
+	}
+	defer rows.Close()
+
+	var limits map[string]ResourceLimits
+	for rows.Next() {
+		var service string
+		var serviceLimits ResourceLimits
+		if err := rows.Scan(&service, &serviceLimits.Memory, &serviceLimits.CPUs); err != nil {
+			return nil, fmt.Errorf("failed to scan row: %v", err)
+		}
+		if limits == nil {
+			limits = make(map[string]ResourceLimits)
+		}
+		limits[service] = serviceLimits
+	}
+	return limits, rows.Err()
+}
+
+// queryServiceEnv reads the environment overrides of single services of an instance from an
+// open database
+func queryServiceEnv(db *sql.DB, instanceName string) (map[string]map[string]string, error) {
+	rows, err := db.Query(`SELECT service, name, value FROM service_env WHERE instance_name = ?`, instanceName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query environment of %s: %v", instanceName, err)
+	}
+	defer rows.Close()
+
+	var env map[string]map[string]string
+	for rows.Next() {
+		var service, name, value string
+		if err := rows.Scan(&service, &name, &value); err != nil {
+			return nil, fmt.Errorf("failed to scan row: %v", err)
+		}
+		if env == nil {
+			env = make(map[string]map[string]string)
+		}
+		if env[service] == nil {
+			env[service] = make(map[string]string)
+		}
+		env[service][name] = value
+	}
+	return env, rows.Err()
+}
+
+// GetInstanceConfig returns the deploy configuration of an instance, falling back to
+// the container records for instances deployed before deploys were recorded
+func GetInstanceConfig(instanceName string) (*DeployConfig, error) {
+	config, _, err := GetDeployment(instanceName)
+	if err != nil {
+		return nil, err
+	}
+	if config != nil {
+		return config, nil
+	}
+
+	containers, err := GetInstanceContainers(instanceName)
+	if err != nil {
+		return nil, err
+	}
+	if len(containers) == 0 {
+		return nil, fmt.Errorf("no configuration recorded for instance '%s'", instanceName)
+	}
+
+	return &DeployConfig{
+		InstanceName:  instanceName,
+		RepoPath:      containers[0].RepoPath,
+		AppPort:       containers[0].AppPort,
+		PostgresPort:  containers[0].PostgresPort,
+		Neo4jBoltPort: containers[0].Neo4jBoltPort,
+	}, nil
+}
+
+// RemoveDeployment removes the recorded deploy for an instance
+func RemoveDeployment(instanceName string) error {
+	db, err := InitDB()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	if _, err := db.Exec(`DELETE FROM deployments WHERE instance_name = ?`, instanceName); err != nil {
+		return fmt.Errorf("failed to remove deployment %s: %v", instanceName, err)
+	}
+
+	if _, err := db.Exec(`DELETE FROM deploy_checkpoints WHERE instance_name = ?`, instanceName); err != nil {
+		return fmt.Errorf("failed to remove checkpoints for %s: %v", instanceName, err)
+	}
+
+	if _, err := db.Exec(`DELETE FROM instance_activity WHERE instance_name = ?`, instanceName); err != nil {
+		return fmt.Errorf("failed to remove activity for %s: %v", instanceName, err)
+	}
+
+	if _, err := db.Exec(`DELETE FROM access_log WHERE instance_name = ?`, instanceName); err != nil {
+		return fmt.Errorf("failed to remove access log for %s: %v", instanceName, err)
+	}
+
+	if _, err := db.Exec(`DELETE FROM supervisor_events WHERE instance_name = ?`, instanceName); err != nil {
+		return fmt.Errorf("failed to remove supervisor events for %s: %v", instanceName, err)
+	}
+
+	if _, err := db.Exec(`DELETE FROM instance_state WHERE instance_name = ?`, instanceName); err != nil {
+		return fmt.Errorf("failed to remove state for %s: %v", instanceName, err)
+	}
+
+	if _, err := db.Exec(`DELETE FROM indexed_commits WHERE instance_name = ?`, instanceName); err != nil {
+		return fmt.Errorf("failed to remove indexed commit for %s: %v", instanceName, err)
+	}
+
+	if _, err := db.Exec(`DELETE FROM port_reservations WHERE instance_name = ?`, instanceName); err != nil {
+		return fmt.Errorf("failed to release ports of %s: %v", instanceName, err)
+	}
+
+	if _, err := db.Exec(`DELETE FROM instance_labels WHERE instance_name = ?`, instanceName); err != nil {
+		return fmt.Errorf("failed to remove labels of %s: %v", instanceName, err)
+	}
+
+	if _, err := db.Exec(`DELETE FROM service_limits WHERE instance_name = ?`, instanceName); err != nil {
+		return fmt.Errorf("failed to remove limits of %s: %v", instanceName, err)
+	}
+
+	if _, err := db.Exec(`DELETE FROM service_env WHERE instance_name = ?`, instanceName); err != nil {
+		return fmt.Errorf("failed to remove environment of %s: %v", instanceName, err)
+	}
+
+	if _, err := db.Exec(`DELETE FROM deployed_images WHERE instance_name = ?`, instanceName); err != nil {
+		return fmt.Errorf("failed to remove images of %s: %v", instanceName, err)
+	}
+
+	if _, err := db.Exec(`DELETE FROM mcp_registrations WHERE instance_name = ?`, instanceName); err != nil {
+		return fmt.Errorf("failed to remove MCP registrations of %s: %v", instanceName, err)
+	}
+
+	return nil
+}
+
+// RenameInstanceRecords moves every record of an instance to a new name in one transaction
+func RenameInstanceRecords(oldName, newName string) error {
+	db, err := InitDB()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to start transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	// Container names start with the instance name
+	if _, err := tx.Exec(`UPDATE instances SET instance_name = ?, container_name = ? || substr(container_name, ?) WHERE instance_name = ?`,
+		newName, newName, len(oldName)+1, oldName); err != nil {
+		return fmt.Errorf("failed to rename containers of %s: %v", oldName, err)
+	}
+
+	for _, table := range []string{"deployments", "deploy_checkpoints", "instance_activity", "access_log", "backups", "instance_state", "indexed_commits", "port_reservations", "instance_labels", "service_limits", "service_env", "deployed_images", "mcp_registrations", "supervisor_events"} {
+		if _, err := tx.Exec(fmt.Sprintf(`UPDATE %s SET instance_name = ? WHERE instance_name = ?`, table), newName, oldName); err != nil {
+			return fmt.Errorf("failed to rename %s records of %s: %v", table, oldName, err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit rename: %v", err)
+	}
+	return nil
+}
+
+// SaveCheckpoint records that a deploy stage completed for an instance
+func SaveCheckpoint(instanceName, stage string) error {
+	db, err := InitDB()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	insertSQL := `
+	INSERT OR REPLACE INTO deploy_checkpoints (instance_name, stage, completed_at)
+	VALUES (?, ?, CURRENT_TIMESTAMP)`
+
+	if _, err := db.Exec(insertSQL, instanceName, stage); err != nil {
+		return fmt.Errorf("failed to save checkpoint %s for %s: %v", stage, instanceName, err)
+	}
+
+	return nil
+}
+
+// GetCheckpoints returns the completed deploy stages for an instance in completion order
+func GetCheckpoints(instanceName string) ([]string, error) {
+	db, err := InitDB()
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	query := `
+	SELECT stage
+	FROM deploy_checkpoints
+	WHERE instance_name = ?
+	ORDER BY completed_at, rowid`
+
+	rows, err := db.Query(query, instanceName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query checkpoints: %v", err)
+	}
+	defer rows.Close()
+
+	var stages []string
+	for rows.Next() {
+		var stage string
+		if err := rows.Scan(&stage); err != nil {
+			return nil, fmt.Errorf("failed to scan row: %v", err)
+		}
+		stages = append(stages, stage)
+	}
+
+	return stages, nil
+}
+
+// ClearCheckpoints removes all recorded deploy stages for an instance
+func ClearCheckpoints(instanceName string) error {
+	db, err := InitDB()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	if _, err := db.Exec(`DELETE FROM deploy_checkpoints WHERE instance_name = ?`, instanceName); err != nil {
+		return fmt.Errorf("failed to clear checkpoints for %s: %v", instanceName, err)
+	}
+
+	return nil
+}
+
+// StoreBackup records a backup archive for an instance
+func StoreBackup(instanceName, path string, sizeBytes int64) error {
+	db, err := InitDB()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	insertSQL := `
+	INSERT OR REPLACE INTO backups (instance_name, path, size_bytes)
+	VALUES (?, ?, ?)`
+
+	if _, err := db.Exec(insertSQL, instanceName, path, sizeBytes); err != nil {
+		return fmt.Errorf("failed to store backup %s: %v", path, err)
+	}
+
+	return nil
+}
+
+// GetBackups retrieves the recorded backups of an instance, newest first
+func GetBackups(instanceName string) ([]Backup, error) {
+	db, err := InitDB()
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	query := `
+	SELECT id, instance_name, path, size_bytes, created_at
+	FROM backups
+	WHERE instance_name = ?
+	ORDER BY created_at DESC, id DESC`
+
+	rows, err := db.Query(query, instanceName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query backups: %v", err)
+	}
+	defer rows.Close()
+
+	var backups []Backup
+	for rows.Next() {
+		var backup Backup
+		err := rows.Scan(
+			&backup.ID,
+			&backup.InstanceName,
+			&backup.Path,
+			&backup.SizeBytes,
+			&backup.CreatedAt,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan row: %v", err)
+		}
+		backups = append(backups, backup)
+	}
+
+	return backups, nil
+}
+
+// TouchInstance records that an instance was just used, e.g. started or queried
+func TouchInstance(instanceName, event string) error {
+	db, err := InitDB()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	upsertSQL := `
+	INSERT OR REPLACE INTO instance_activity (instance_name, last_used, last_event)
+	VALUES (?, CURRENT_TIMESTAMP, ?)`
+
+	if _, err := db.Exec(upsertSQL, instanceName, event); err != nil {
+		return fmt.Errorf("failed to record activity for %s: %v", instanceName, err)
+	}
+
+	return nil
+}
+
+// SetInstanceStopped records whether an instance was stopped on purpose, so that recovery
+// after a Docker restart leaves it stopped
+func SetInstanceStopped(instanceName string, stopped bool) error {
+	db, err := InitDB()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	upsertSQL := `
+	INSERT OR REPLACE INTO instance_state (instance_name, stopped, updated_at)
+	VALUES (?, ?, CURRENT_TIMESTAMP)`
+
+	if _, err := db.Exec(upsertSQL, instanceName, stopped); err != nil {
+		return fmt.Errorf("failed to record state of %s: %v", instanceName, err)
+	}
+
+	return nil
+}
+
+// InstanceStopped reports whether an instance was last stopped on purpose
+func InstanceStopped(instanceName string) (bool, error) {
+	db, err := InitDB()
+	if err != nil {
+		return false, err
+	}
+	defer db.Close()
+
+	var stopped bool
+	err = db.QueryRow(`SELECT stopped FROM instance_state WHERE instance_name = ?`, instanceName).Scan(&stopped)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to query state of %s: %v", instanceName, err)
+	}
+	return stopped, nil
+}
+
+// IndexedCommit is the repository commit an instance last indexed
+type IndexedCommit struct {
+	Commit string `json:"commit" yaml:"commit"`
+	// Branch is the branch checked out when the commit was indexed, or "" for a detached HEAD
+	Branch    string    `json:"branch,omitempty" yaml:"branch,omitempty"`
+	IndexedAt time.Time `json:"indexed_at" yaml:"indexed_at"`
+}
+
+// SaveIndexedCommit records that an instance just started indexing commit on branch
+func SaveIndexedCommit(instanceName, commit, branch string) error {
+	db, err := InitDB()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	upsertSQL := `
+	INSERT OR REPLACE INTO indexed_commits (instance_name, commit_sha, branch, indexed_at)
+	VALUES (?, ?, ?, CURRENT_TIMESTAMP)`
+
+	if _, err := db.Exec(upsertSQL, instanceName, commit, branch); err != nil {
+		return fmt.Errorf("failed to record indexed commit for %s: %v", instanceName, err)
+	}
+
+	return nil
+}
+
+// GetIndexedCommits returns the commit each instance last indexed, keyed by instance name
+func GetIndexedCommits() (map[string]IndexedCommit, error) {
+	db, err := InitDB()
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	rows, err := db.Query(`SELECT instance_name, commit_sha, branch, indexed_at FROM indexed_commits`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query indexed commits: %v", err)
+	}
+	defer rows.Close()
+
+	commits := make(map[string]IndexedCommit)
+	for rows.Next() {
+		var name string
+		var commit IndexedCommit
+		if err := rows.Scan(&name, &commit.Commit, &commit.Branch, &commit.IndexedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan row: %v", err)
+		}
+		commits[name] = commit
+	}
+	return commits, rows.Err()
+}
+
+// GetLastUsed returns the last time each instance was used, keyed by instance name. Requests
+// the reverse proxy logged since it was last read count as use.
+func GetLastUsed() (map[string]time.Time, error) {
+	db, err := InitDB()
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	if err := importProxyAccessLog(db); err != nil {
+		Log.Debug("Failed to import the proxy's access log", "error", err)
+	}
+
+	rows, err := db.Query(`SELECT instance_name, last_used FROM instance_activity`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query instance activity: %v", err)
+	}
+	defer rows.Close()
+
+	lastUsed := make(map[string]time.Time)
+	for rows.Next() {
+		var name string
+		var usedAt time.Time
+		if err := rows.Scan(&name, &usedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan row: %v", err)
+		}
+		lastUsed[name] = usedAt
+	}
+
+	return lastUsed, nil
+}
+
+// GetInstanceNames returns the names of all instances known to the database
+func GetInstanceNames() ([]string, error) {
+	db, err := InitDB()
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	query := `
+	SELECT instance_name FROM instances
+	UNION
+	SELECT instance_name FROM deployments
+	ORDER BY instance_name`
+
+	rows, err := db.Query(query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query instance names: %v", err)
+	}
+	defer rows.Close()
+
+	var names []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, fmt.Errorf("failed to scan row: %v", err)
+		}
+		names = append(names, name)
+	}
+
+	return names, nil
+}
+
+// recordAccess appends requests to the access log in one transaction and marks their
+// instances as used
+func recordAccess(db *sql.DB, entries []AccessEntry) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to start transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	if err := insertAccess(tx, entries); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit access log: %v", err)
+	}
+	return nil
+}
+
+// insertAccess appends requests to the access log. An instance's last use only moves forward,
+// as requests imported from the proxy's log may be older than what was recorded since.
+func insertAccess(tx *sql.Tx, entries []AccessEntry) error {
+	insertSQL := `
+	INSERT INTO access_log (instance_name, client, remote_addr, method, path, status, latency_ms, created_at)
+	VALUES (?, ?, ?, ?, ?, ?, ?, ?)`
+
+	touchSQL := `
+	INSERT INTO instance_activity (instance_name, last_used, last_event)
+	VALUES (?, ?, 'queried')
+	ON CONFLICT(instance_name) DO UPDATE SET last_used = excluded.last_used, last_event = excluded.last_event
+	WHERE excluded.last_used > instance_activity.last_used`
+
+	for _, entry := range entries {
+		// Stored like CURRENT_TIMESTAMP, so that entries compare with the other timestamps
+		createdAt := entry.CreatedAt.UTC().Format("2006-01-02 15:04:05")
+		_, err := tx.Exec(insertSQL,
+			entry.InstanceName,
+			entry.Client,
+			entry.RemoteAddr,
+			entry.Method,
+			entry.Path,
+			entry.Status,
+			entry.LatencyMs,
+			createdAt,
+		)
+		if err != nil {
+			return fmt.Errorf("failed to record access for %s: %v", entry.InstanceName, err)
+		}
+		if _, err := tx.Exec(touchSQL, entry.InstanceName, createdAt); err != nil {
+			return fmt.Errorf("failed to record activity for %s: %v", entry.InstanceName, err)
+		}
+	}
+	return nil
+}
+
+// importProxyAccessLog adds the requests the reverse proxy logged since the last import to the
+// access log. The import runs in one transaction with the position it got to, so concurrent
+// imports never add a request twice.
+func importProxyAccessLog(db *sql.DB) error {
+	path, err := GetProxyAccessLogPath()
+	if err != nil {
+		return err
+	}
+	file, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to open proxy access log: %v", err)
+	}
+	defer file.Close()
+
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to start transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	var position int64
+	err = tx.QueryRow(`SELECT position FROM access_log_imports WHERE path = ?`, path).Scan(&position)
+	if err != nil && err != sql.ErrNoRows {
+		return fmt.Errorf("failed to query access log imports: %v", err)
+	}
+	info, err := file.Stat()
+	if err != nil {
+		return fmt.Errorf("failed to read proxy access log: %v", err)
+	}
+	// The proxy rolls its log over once it grows large, starting a new one
+	if info.Size() < position {
+		position = 0
+	}
+	if info.Size() == position {
+		return nil
+	}
+	if _, err := file.Seek(position, io.SeekStart); err != nil {
+		return fmt.Errorf("failed to read proxy access log: %v", err)
+	}
+
+	var entries []AccessEntry
+	reader := bufio.NewReader(file)
+	for {
+		line, err := reader.ReadBytes('\n')
+		if err == io.EOF {
+			// A line without its newline is still being written; it is imported next time
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read proxy access log: %v", err)
+		}
+		position += int64(len(line))
+		if entry, ok := parseProxyAccessLine(line); ok {
+			entries = append(entries, entry)
+		}
+	}
+
+	if err := insertAccess(tx, entries); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`INSERT OR REPLACE INTO access_log_imports (path, position) VALUES (?, ?)`, path, position); err != nil {
+		return fmt.Errorf("failed to record access log import: %v", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit access log import: %v", err)
+	}
+	return nil
+}
+
+// GetAccessLog retrieves the access log entries of an instance since a point in time, newest
+// first, including the requests the reverse proxy logged since they were last read
+func GetAccessLog(instanceName string, since time.Time, limit int) ([]AccessEntry, error) {
+	db, err := InitDB()
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	if err := importProxyAccessLog(db); err != nil {
+		Log.Warning("Failed to import the proxy's access log", "error", err)
+	}
+
+	query := `
+	SELECT instance_name, client, remote_addr, method, path, status, latency_ms, created_at
+	FROM access_log
+	WHERE instance_name = ? AND created_at >= ?
+	ORDER BY created_at DESC, id DESC
+	LIMIT ?`
+
+	if limit <= 0 {
+		limit = -1
+	}
+
+	rows, err := db.Query(query, instanceName, since.UTC().Format("2006-01-02 15:04:05"), limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query access log: %v", err)
+	}
+	defer rows.Close()
+
+	var entries []AccessEntry
+	for rows.Next() {
+		var entry AccessEntry
+		err := rows.Scan(
+			&entry.InstanceName,
+			&entry.Client,
+			&entry.RemoteAddr,
+			&entry.Method,
+			&entry.Path,
+			&entry.Status,
+			&entry.LatencyMs,
+			&entry.CreatedAt,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan row: %v", err)
+		}
+		entries = append(entries, entry)
+	}
+
+	return entries, nil
+}
+
+// RecordSupervisorEvent appends an event to the supervisor's history
+func RecordSupervisorEvent(event SupervisorEvent) error {
+	db, err := InitDB()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	insertSQL := `
+	INSERT INTO supervisor_events (instance_name, service, action, detail)
+	VALUES (?, ?, ?, ?)`
+
+	if _, err := db.Exec(insertSQL, event.Instance, event.Service, event.Action, event.Detail); err != nil {
+		return fmt.Errorf("failed to record supervisor event for %s: %v", event.Instance, err)
+	}
+	return nil
+}
+
+// GetSupervisorEvents retrieves the supervisor's events since a point in time, newest first,
+// of one instance or of every instance if instanceName is empty
+func GetSupervisorEvents(instanceName string, since time.Time, limit int) ([]SupervisorEvent, error) {
+	db, err := InitDB()
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	query := `
+	SELECT instance_name, service, action, detail, created_at
+	FROM supervisor_events
+	WHERE (? = '' OR instance_name = ?) AND created_at >= ?
+	ORDER BY created_at DESC, id DESC
+	LIMIT ?`
+
+	if limit <= 0 {
+		limit = -1
+	}
+
+	rows, err := db.Query(query, instanceName, instanceName, since.UTC().Format("2006-01-02 15:04:05"), limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query supervisor events: %v", err)
+	}
+	defer rows.Close()
+
+	events := []SupervisorEvent{}
+	for rows.Next() {
+		var event SupervisorEvent
+		if err := rows.Scan(&event.Instance, &event.Service, &event.Action, &event.Detail, &event.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan row: %v", err)
+		}
+		events = append(events, event)
+	}
+	return events, rows.Err()
+}
+
+// ErrPortsReserved is returned when another instance has already reserved one of the requested ports
+var ErrPortsReserved = errors.New("ports already reserved by another instance")
+
+// ReservePorts reserves host ports for an instance in one transaction, so concurrent deploys
+// never get the same ports. Ports the instance already holds stay reserved; if another
+// instance holds any of them, nothing is reserved and ErrPortsReserved is returned.
+func ReservePorts(instanceName string, ports ...int) error {
+	db, err := InitDB()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to start transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	for _, port := range ports {
+		var owner string
+		err := tx.QueryRow(`SELECT instance_name FROM port_reservations WHERE port = ?`, port).Scan(&owner)
+		switch {
+		case err == sql.ErrNoRows:
+			if _, err := tx.Exec(`INSERT INTO port_reservations (port, instance_name) VALUES (?, ?)`, port, instanceName); err != nil {
+				return fmt.Errorf("failed to reserve port %d: %v", port, err)
+			}
+		case err != nil:
+			return fmt.Errorf("failed to query port reservations: %v", err)
+		case owner != instanceName:
+			return ErrPortsReserved
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit port reservation: %v", err)
+	}
+	return nil
+}
+
+// ReleasePorts releases the ports reserved for an instance, except the ones listed in keep
+func ReleasePorts(instanceName string, keep ...int) error {
+	db, err := InitDB()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	kept := make(map[int]bool)
+	for _, port := range keep {
+		kept[port] = true
+	}
+
+	rows, err := db.Query(`SELECT port FROM port_reservations WHERE instance_name = ?`, instanceName)
+	if err != nil {
+		return fmt.Errorf("failed to query port reservations: %v", err)
+	}
+	var release []int
+	for rows.Next() {
+		var port int
+		if err := rows.Scan(&port); err != nil {
+			rows.Close()
+			return fmt.Errorf("failed to scan row: %v", err)
+		}
+		if !kept[port] {
+			release = append(release, port)
+		}
+	}
+	rows.Close()
+
+	for _, port := range release {
+		if _, err := db.Exec(`DELETE FROM port_reservations WHERE port = ? AND instance_name = ?`, port, instanceName); err != nil {
+			return fmt.Errorf("failed to release port %d: %v", port, err)
+		}
+	}
+	return nil
+}
+
+// GetReservedPorts returns the instance each reserved host port belongs to
+func GetReservedPorts() (map[int]string, error) {
+	db, err := InitDB()
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	rows, err := db.Query(`SELECT port, instance_name FROM port_reservations`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query port reservations: %v", err)
+	}
+	defer rows.Close()
+
+	reserved := make(map[int]string)
+	for rows.Next() {
+		var port int
+		var instanceName string
+		if err := rows.Scan(&port, &instanceName); err != nil {
+			return nil, fmt.Errorf("failed to scan row: %v", err)
+		}
+		reserved[port] = instanceName
+	}
+	return reserved, nil
+}
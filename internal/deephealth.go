@@ -0,0 +1,210 @@
+package internal
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Results of a single health check
+const (
+	HealthPass = "pass"
+	HealthFail = "fail"
+	HealthSkip = "skip"
+)
+
+// DefaultMaxLatency is how long a database may take to answer a deep health check query.
+// It includes the overhead of docker exec.
+const DefaultMaxLatency = 5 * time.Second
+
+// HealthCheck is the result of one check of a health report
+type HealthCheck struct {
+	Name      string `json:"name" yaml:"name"`
+	Status    string `json:"status" yaml:"status"`
+	LatencyMS int64  `json:"latency_ms" yaml:"latency_ms"`
+	Detail    string `json:"detail,omitempty" yaml:"detail,omitempty"`
+}
+
+// HealthReport is the pass/fail report of all checks run against an instance
+type HealthReport struct {
+	Instance  string        `json:"instance" yaml:"instance"`
+	Healthy   bool          `json:"healthy" yaml:"healthy"`
+	Deep      bool          `json:"deep" yaml:"deep"`
+	CheckedAt time.Time     `json:"checked_at" yaml:"checked_at"`
+	Checks    []HealthCheck `json:"checks" yaml:"checks"`
+}
+
+// Failed returns the checks that did not pass
+func (r HealthReport) Failed() []HealthCheck {
+	var failed []HealthCheck
+	for _, check := range r.Checks {
+		if check.Status == HealthFail {
+			failed = append(failed, check)
+		}
+	}
+	return failed
+}
+
+// RunHealthChecks probes every service of an instance. With deep set it also exercises the
+// full query path: an MCP request, a graph query, a database round trip within maxLatency
+// and the embeddings provider with the keys the app runs with.
+func RunHealthChecks(config *DeployConfig, deep bool, maxLatency time.Duration) HealthReport {
+	report := HealthReport{Instance: config.InstanceName, Deep: deep, CheckedAt: time.Now().UTC()}
+
+	for _, result := range ProbeInstance(config) {
+		check := HealthCheck{Name: result.Service, Status: HealthPass}
+		if !result.Healthy {
+			check.Status = HealthFail
+			check.Detail = result.Detail
+		}
+		report.Checks = append(report.Checks, check)
+	}
+
+	if deep {
+		report.Checks = append(report.Checks,
+			runHealthCheck("mcp", 0, func() (string, error) { return "", ProbeMCP(config) }),
+		)
+		if config.IsSingleContainer() {
+			// The all-in-one image does not expose its databases
+			for _, name := range []string{"graph-query", "postgres-query"} {
+				report.Checks = append(report.Checks, HealthCheck{Name: name, Status: HealthSkip, Detail: "not available for single-container instances"})
+			}
+		} else {
+			report.Checks = append(report.Checks,
+				runHealthCheck("graph-query", maxLatency, func() (string, error) { return probeGraphQuery(config.InstanceName) }),
+				runHealthCheck("postgres-query", maxLatency, func() (string, error) { return "", probePostgresQuery(config.InstanceName) }),
+			)
+		}
+		report.Checks = append(report.Checks,
+			runHealthCheck("embeddings-provider", 0, func() (string, error) { return probeEmbeddingsProvider(config) }),
+		)
+	}
+
+	report.Healthy = len(report.Failed()) == 0
+	return report
+}
+
+// runHealthCheck times probe and fails it when it errors or, with a non-zero maxLatency, answers too slowly
+func runHealthCheck(name string, maxLatency time.Duration, probe func() (string, error)) HealthCheck {
+	start := time.Now()
+	detail, err := probe()
+	latency := time.Since(start)
+
+	check := HealthCheck{Name: name, Status: HealthPass, LatencyMS: latency.Milliseconds(), Detail: detail}
+	switch {
+	case err != nil:
+		check.Status = HealthFail
+		check.Detail = err.Error()
+	case maxLatency > 0 && latency > maxLatency:
+		check.Status = HealthFail
+		check.Detail = fmt.Sprintf("took %s, more than %s", latency.Round(time.Millisecond), maxLatency)
+	}
+	return check
+}
+
+// ProbeMCP sends an MCP initialize request to the app and checks for a JSON-RPC answer
+func ProbeMCP(config *DeployConfig) error {
+	body, err := json.Marshal(map[string]interface{}{
+		"jsonrpc": "2.0",
+		"id":      1,
+		"method":  "initialize",
+		"params": map[string]interface{}{
+			"protocolVersion": "2025-03-26",
+			"capabilities":    map[string]interface{}{},
+			"clientInfo":      map[string]string{"name": "graphsense-cli", "version": Version},
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), probeTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, config.AppURL()+"/", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json, text/event-stream")
+
+	resp, err := config.AppClient().Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("initialize returned HTTP %d", resp.StatusCode)
+	}
+	// Streamable HTTP servers may answer with a server-sent event on a stream that stays open,
+	// so stop at the first line carrying the response
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		if strings.Contains(scanner.Text(), `"jsonrpc"`) {
+			return nil
+		}
+	}
+	return fmt.Errorf("initialize did not return a JSON-RPC response")
+}
+
+// probeGraphQuery counts the nodes of the graph, failing when it is empty
+func probeGraphQuery(instanceName string) (string, error) {
+	output, err := RunCypher(instanceName, "MATCH (n) RETURN count(n) AS nodes")
+	if err != nil {
+		return "", err
+	}
+
+	lines := strings.Split(strings.TrimSpace(output), "\n")
+	nodes, err := strconv.Atoi(strings.TrimSpace(lines[len(lines)-1]))
+	if err != nil {
+		return "", fmt.Errorf("unexpected query output: %s", strings.TrimSpace(output))
+	}
+	if nodes == 0 {
+		return "", fmt.Errorf("graph is empty; indexing may not have finished")
+	}
+	return fmt.Sprintf("%d nodes", nodes), nil
+}
+
+// probePostgresQuery runs a trivial query in the instance's postgres database
+func probePostgresQuery(instanceName string) error {
+	output, err := Command("docker", "exec", instanceName+"-postgres", "psql", "-U", PostgresUser, "-d", PostgresDB, "-tAc", "SELECT 1").CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("psql failed: %s", strings.TrimSpace(string(output)))
+	}
+	if strings.TrimSpace(string(output)) != "1" {
+		return fmt.Errorf("unexpected query output: %s", strings.TrimSpace(string(output)))
+	}
+	return nil
+}
+
+// probeEmbeddingsProvider checks the local embedding server, or validates the Cohere API
+// key the running app was started with
+func probeEmbeddingsProvider(config *DeployConfig) (string, error) {
+	if model := config.LocalEmbeddings(); model != nil {
+		if err := ProbeEmbeddings(config.InstanceName); err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("local model %s", model), nil
+	}
+
+	running, err := RunningConfig(config.InstanceName)
+	if err != nil {
+		return "", err
+	}
+	key := running["app"].Env[CoAPIKeyName]
+	if key == "" {
+		return "", fmt.Errorf("the app runs without %s", CoAPIKeyName)
+	}
+
+	if err := ValidateAPIKey(context.Background(), CoAPIKeyName, key); err != nil {
+		return "", err
+	}
+	return "Cohere API key is valid", nil
+}
@@ -0,0 +1,261 @@
+package internal
+
+import (
+	"bytes"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// DefinitionVersion is the format version of the instance definitions written by export
+const DefinitionVersion = 1
+
+// InstanceDefinition is the portable description of an instance that export writes and import
+// deploys from. It holds everything needed to recreate the instance except its data and the
+// API keys, which stay in ~/.graphsense/.env.
+type InstanceDefinition struct {
+	Version int    `yaml:"version"`
+	Name    string `yaml:"name"`
+	// RepoPath is left out for clones managed by the CLI, which import clones from RepoURL again
+	RepoPath          string            `yaml:"repo_path,omitempty"`
+	RepoURL           string            `yaml:"repo_url,omitempty"`
+	Mode              string            `yaml:"mode"`
+	Ports             DefinitionPorts   `yaml:"ports"`
+	AppImage          string            `yaml:"app_image,omitempty"`
+	PostgresImage     string            `yaml:"postgres_image,omitempty"`
+	Neo4jImage        string            `yaml:"neo4j_image,omitempty"`
+	PostgresVersion   string            `yaml:"postgres_version,omitempty"`
+	Neo4jVersion      string            `yaml:"neo4j_version,omitempty"`
+	EmbeddingModel    string            `yaml:"embedding_model,omitempty"`
+	LogLevel          string            `yaml:"log_level,omitempty"`
+	ExcludeSubmodules bool              `yaml:"exclude_submodules,omitempty"`
+	Autostart         string            `yaml:"autostart,omitempty"`
+	Labels            map[string]string `yaml:"labels,omitempty"`
+	CPUSet            string            `yaml:"cpuset,omitempty"`
+	Neo4jCPUSet       string            `yaml:"neo4j_cpuset,omitempty"`
+	IndexWorkers      int               `yaml:"index_workers,omitempty"`
+	IndexBatchSize    int               `yaml:"index_batch_size,omitempty"`
+	Nice              bool              `yaml:"nice,omitempty"`
+	Limits            *DefinitionLimits `yaml:"limits,omitempty"`
+	Neo4jHeap         string            `yaml:"neo4j_heap,omitempty"`
+	Neo4jPageCache    string            `yaml:"neo4j_pagecache,omitempty"`
+	GPU               string            `yaml:"gpu,omitempty"`
+	// TLS is imported with a new self-signed certificate, since certificates stay on their host
+	TLS bool `yaml:"tls,omitempty"`
+
+	// Env overrides environment variables of single services, keyed by service name
+	Env map[string]map[string]string `yaml:"env,omitempty"`
+}
+
+// DefinitionPorts are the host ports of an instance definition
+type DefinitionPorts struct {
+	App       int `yaml:"app"`
+	Postgres  int `yaml:"postgres,omitempty"`
+	Neo4jBolt int `yaml:"neo4j_bolt,omitempty"`
+	// BindAddress is empty for ports published on all interfaces
+	BindAddress string `yaml:"bind_address,omitempty"`
+}
+
+// DefinitionLimits are the memory and CPU limits of an instance definition, in the format of
+// the deploy flags, e.g. memory: 4g
+type DefinitionLimits struct {
+	Memory   string                      `yaml:"memory,omitempty"`
+	CPUs     string                      `yaml:"cpus,omitempty"`
+	Services map[string]DefinitionLimits `yaml:"services,omitempty"`
+}
+
+// NewInstanceDefinition describes the recorded configuration of an instance
+func NewInstanceDefinition(config *DeployConfig) *InstanceDefinition {
+	definition := &InstanceDefinition{
+		Version:           DefinitionVersion,
+		Name:              config.InstanceName,
+		RepoURL:           config.RepoURL,
+		Mode:              config.DeployMode(),
+		Ports:             DefinitionPorts{App: config.AppPort, BindAddress: config.BindAddress},
+		AppImage:          config.AppImage,
+		PostgresImage:     config.PostgresImage,
+		Neo4jImage:        config.Neo4jImage,
+		PostgresVersion:   config.PostgresVersion,
+		Neo4jVersion:      config.Neo4jVersion,
+		EmbeddingModel:    config.EmbeddingModel,
+		LogLevel:          config.LogLevel,
+		ExcludeSubmodules: config.ExcludeSubmodules,
+		Autostart:         config.Autostart,
+		Labels:            config.Labels,
+		CPUSet:            config.CPUSet,
+		Neo4jCPUSet:       config.Neo4jCPUSet,
+		IndexWorkers:      config.IndexWorkers,
+		IndexBatchSize:    config.IndexBatchSize,
+		Nice:              config.Nice,
+		TLS:               config.TLS,
+		GPU:               config.GPU,
+		Env:               config.ServiceEnv,
+	}
+	if !config.IsManagedRepo() {
+		definition.RepoPath = config.RepoPath
+	}
+	if config.Neo4jHeap > 0 {
+		definition.Neo4jHeap = FormatMemoryLimit(config.Neo4jHeap)
+	}
+	if config.Neo4jPageCache > 0 {
+		definition.Neo4jPageCache = FormatMemoryLimit(config.Neo4jPageCache)
+	}
+	if config.HasLimits() {
+		definition.Limits = &DefinitionLimits{Memory: config.Limits.MemoryString(), CPUs: config.Limits.CPUsString()}
+		for _, service := range config.LimitedServiceNames() {
+			if definition.Limits.Services == nil {
+				definition.Limits.Services = make(map[string]DefinitionLimits)
+			}
+			limits := config.ServiceLimits[service]
+			definition.Limits.Services[service] = DefinitionLimits{Memory: limits.MemoryString(), CPUs: limits.CPUsString()}
+		}
+	}
+	if !config.IsSingleContainer() {
+		definition.Ports.Postgres = config.PostgresPort
+		definition.Ports.Neo4jBolt = config.Neo4jBoltPort
+	}
+	return definition
+}
+
+// ParseInstanceDefinition parses and validates an instance definition written by export
+func ParseInstanceDefinition(data []byte) (*InstanceDefinition, error) {
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+
+	var definition InstanceDefinition
+	if err := decoder.Decode(&definition); err != nil {
+		return nil, fmt.Errorf("failed to parse instance definition: %v", err)
+	}
+	if err := definition.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid instance definition: %v", err)
+	}
+	return &definition, nil
+}
+
+// Validate checks that the definition can be deployed
+func (d *InstanceDefinition) Validate() error {
+	if d.Version != DefinitionVersion {
+		return fmt.Errorf("unsupported version %d: this graphsense-cli reads version %d", d.Version, DefinitionVersion)
+	}
+	if d.Name == "" {
+		return fmt.Errorf("name is required")
+	}
+	if d.RepoPath == "" && d.RepoURL == "" {
+		return fmt.Errorf("repo_path or repo_url is required")
+	}
+	if d.RepoPath != "" && !filepath.IsAbs(d.RepoPath) {
+		return fmt.Errorf("repo_path must be an absolute path")
+	}
+	if d.Mode != DeployModeCompose && d.Mode != DeployModeSingle {
+		return fmt.Errorf("mode must be %s or %s", DeployModeCompose, DeployModeSingle)
+	}
+
+	ports := []int{d.Ports.App}
+	if d.Mode == DeployModeCompose {
+		ports = append(ports, d.Ports.Postgres, d.Ports.Neo4jBolt)
+	}
+	for _, port := range ports {
+		if port < 1 || port > 65535 {
+			return fmt.Errorf("every port of a %s instance must be between 1 and 65535", d.Mode)
+		}
+	}
+	if d.Mode == DeployModeCompose && (d.Ports.Postgres == d.Ports.App || d.Ports.Neo4jBolt == d.Ports.App || d.Ports.Postgres == d.Ports.Neo4jBolt) {
+		return fmt.Errorf("ports must differ from each other")
+	}
+	if err := ValidateBindAddress(d.Ports.BindAddress); err != nil {
+		return err
+	}
+
+	if d.LogLevel != "" {
+		if err := ValidateAppLogLevel(d.LogLevel); err != nil {
+			return err
+		}
+	}
+	if d.Autostart != "" {
+		if err := ValidateAutostart(d.Autostart); err != nil {
+			return err
+		}
+	}
+	if err := ValidateIndexing(d.IndexWorkers, d.IndexBatchSize); err != nil {
+		return err
+	}
+	for key := range d.Labels {
+		if err := ValidateLabelKey(key); err != nil {
+			return err
+		}
+	}
+	for _, cpuset := range []string{d.CPUSet, d.Neo4jCPUSet} {
+		if cpuset == "" {
+			continue
+		}
+		if _, err := ParseCPUSet(cpuset); err != nil {
+			return err
+		}
+	}
+	if d.Limits != nil {
+		if _, _, err := d.Limits.Parse(); err != nil {
+			return err
+		}
+	}
+	if _, err := ParseNeo4jMemory("heap", d.Neo4jHeap); err != nil {
+		return err
+	}
+	if _, err := ParseNeo4jMemory("page cache", d.Neo4jPageCache); err != nil {
+		return err
+	}
+	if d.GPU != "" {
+		if _, err := ParseGPURequest(d.GPU); err != nil {
+			return err
+		}
+	}
+	if err := ValidateServiceEnv(d.Env); err != nil {
+		return err
+	}
+	if d.Mode == DeployModeSingle {
+		if err := CheckSingleContainerEnv(d.Env); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Parse returns the limits of the instance and those of single services
+func (l *DefinitionLimits) Parse() (ResourceLimits, map[string]ResourceLimits, error) {
+	limits, err := l.parseLimits()
+	if err != nil {
+		return ResourceLimits{}, nil, err
+	}
+	var services map[string]ResourceLimits
+	for service, definition := range l.Services {
+		if !isLimitedService(service) {
+			return ResourceLimits{}, nil, fmt.Errorf("limits: unknown service '%s', expected one of %s", service, strings.Join(LimitedServices, ", "))
+		}
+		if len(definition.Services) > 0 {
+			return ResourceLimits{}, nil, fmt.Errorf("limits: services cannot be nested")
+		}
+		serviceLimits, err := definition.parseLimits()
+		if err != nil {
+			return ResourceLimits{}, nil, err
+		}
+		if services == nil {
+			services = make(map[string]ResourceLimits)
+		}
+		services[service] = serviceLimits
+	}
+	return limits, services, nil
+}
+
+// parseLimits parses the memory and CPU limits themselves
+func (l *DefinitionLimits) parseLimits() (ResourceLimits, error) {
+	var limits ResourceLimits
+	var err error
+	if limits.Memory, err = ParseMemoryLimit(l.Memory); err != nil {
+		return ResourceLimits{}, err
+	}
+	if limits.CPUs, err = ParseCPULimit(l.CPUs); err != nil {
+		return ResourceLimits{}, err
+	}
+	return limits, nil
+}
@@ -0,0 +1,14 @@
+//go:build !windows
+
+package internal
+
+import "syscall"
+
+// FreeDiskSpace returns the number of bytes available to unprivileged users on the filesystem holding path
+func FreeDiskSpace(path string) (uint64, error) {
+	var stat syscall.Statfs_t
+	if err := syscall.Statfs(path, &stat); err != nil {
+		return 0, err
+	}
+	return stat.Bavail * uint64(stat.Bsize), nil
+}
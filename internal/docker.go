@@ -2,15 +2,21 @@ package internal
 
 import (
 	"bufio"
+	"bytes"
+	"context"
+	"errors"
 	"fmt"
-	"net"
 	"os"
-	"os/exec"
 	"path/filepath"
 	"regexp"
+	"sort"
 	"strconv"
 	"strings"
+	"text/template"
 	"time"
+
+	"github.com/docker/docker/api/types/filters"
+	"gopkg.in/yaml.v3"
 )
 
 const (
@@ -19,73 +25,95 @@ const (
 	DefaultNeo4jPort    = 7687
 )
 
-type Logger struct{}
-
-func (l *Logger) Info(msg string) {
-	fmt.Printf("\033[0;34m[INFO]\033[0m %s\n", msg)
-}
-
-func (l *Logger) Success(msg string) {
-	fmt.Printf("\033[0;32m[SUCCESS]\033[0m %s\n", msg)
-}
-
-func (l *Logger) Warning(msg string) {
-	fmt.Printf("\033[1;33m[WARNING]\033[0m %s\n", msg)
-}
-
-func (l *Logger) Error(msg string) {
-	fmt.Printf("\033[0;31m[ERROR]\033[0m %s\n", msg)
-}
-
-var Log = &Logger{}
+// Database settings written into every instance's environment file. The passwords are
+// generated per instance, see InstanceCredentials.
+const (
+	PostgresDB   = "graphsense"
+	PostgresUser = "postgres"
+	Neo4jDB      = "neo4j"
+	Neo4jUser    = "neo4j"
+)
 
-// FindAvailablePortSet finds the next available base port where all required ports are free
-func FindAvailablePortSet(basePort int) (int, error) {
-	if basePort == 0 {
-		basePort = DefaultBasePort
+// FindAvailablePortSet finds the first port set of a scheme, from its base port on, where all
+// required ports are free and not reserved for another instance than instanceName
+func FindAvailablePortSet(scheme PortScheme, instanceName string) (PortSet, error) {
+	reserved, err := GetReservedPorts()
+	if err != nil {
+		return PortSet{}, err
+	}
+	available := func(port int) bool {
+		if owner, ok := reserved[port]; ok && owner != instanceName {
+			return false
+		}
+		return !isPortInUse(scheme.BindAddress, port)
 	}
 
-	port := basePort
-
-	for {
-		appPort := port
-		postgresPort := port + 100
-		neo4jBoltPort := port + 200
+	for port := scheme.Base; ; port += scheme.Step {
+		set := scheme.PortSet(port)
+		if !scheme.Contains(set) {
+			return PortSet{}, fmt.Errorf("unable to find available port set in range %s starting from %d", scheme.Range, scheme.Base)
+		}
 
 		// Check if any of the required ports are in use
-		if isPortInUse(appPort) || isPortInUse(postgresPort) || isPortInUse(neo4jBoltPort) {
-			port += 10 // Skip by 10 to avoid conflicts
-		} else {
-			break
+		if available(set.App) && available(set.Postgres) && available(set.Neo4jBolt) {
+			return set, nil
 		}
+	}
+}
 
-		// Safety check to avoid infinite loop
-		if port > 65000 {
-			return 0, fmt.Errorf("unable to find available port set starting from %d", basePort)
+// ReservePortSet finds a free port set for an instance like FindAvailablePortSet and reserves
+// it in instances.db. A set another deploy reserves between the two steps is skipped, so
+// concurrent deploys always get different ports. Callers release the set with ReleasePorts
+// if the instance is not deployed after all.
+func ReservePortSet(scheme PortScheme, instanceName string) (PortSet, error) {
+	for {
+		set, err := FindAvailablePortSet(scheme, instanceName)
+		if err != nil {
+			return PortSet{}, err
+		}
+		err = ReservePorts(instanceName, set.App, set.Postgres, set.Neo4jBolt)
+		if err == nil {
+			return set, nil
+		}
+		if !errors.Is(err, ErrPortsReserved) {
+			return PortSet{}, err
 		}
+		scheme.Base = set.App + scheme.Step
 	}
-
-	return port, nil
 }
 
-// isPortInUse checks if a port is currently in use
-func isPortInUse(port int) bool {
-	conn, err := net.Listen("tcp", fmt.Sprintf(":%d", port))
-	if err != nil {
-		return true
+// isPortInUse checks if a port is currently in use on the Docker host for publishing it on
+// bindAddress
+func isPortInUse(bindAddress string, port int) bool {
+	if IsRemoteDocker() {
+		return isRemotePortInUse(port)
 	}
-	conn.Close()
-	return false
+	return isLocalPortInUse(bindAddress, port)
 }
 
-// IsPortInUse checks if a port is currently in use (exported version)
+// IsPortInUse checks if a port is currently in use on any interface (exported version)
 func IsPortInUse(port int) bool {
-	return isPortInUse(port)
+	return isPortInUse("", port)
 }
 
-// GenerateInstanceName generates an instance name from a repository path
+// GenerateInstanceName generates an instance name from a repository path. A branch other
+// than the repository's default branch is appended, e.g. graphsense-myrepo-feature-x, so
+// that checkouts of several branches of a repository get instances of their own.
 func GenerateInstanceName(repoPath string) string {
-	repoName := filepath.Base(repoPath)
+	name := filepath.Base(repoPath)
+	if branch := featureBranch(repoPath); branch != "" {
+		name += "-" + branch
+	}
+	return instanceNameFrom(name)
+}
+
+// GenerateURLInstanceName generates an instance name from the repository name of a Git URL
+func GenerateURLInstanceName(url string) string {
+	return instanceNameFrom(RepoNameFromURL(url))
+}
+
+// instanceNameFrom turns a repository name into an instance name
+func instanceNameFrom(repoName string) string {
 	// Convert to lowercase and replace non-alphanumeric characters with hyphens
 	reg := regexp.MustCompile(`[^a-z0-9]+`)
 	sanitized := reg.ReplaceAllString(strings.ToLower(repoName), "-")
@@ -100,12 +128,93 @@ func SanitizeInstanceName(name string) string {
 
 // InstanceExists checks if a Docker Compose instance exists
 func InstanceExists(instanceName string) bool {
-	cmd := exec.Command("docker", "ps", "-a", "--filter", fmt.Sprintf("label=com.docker.compose.project=%s", instanceName), "--format", "{{.Names}}")
-	output, err := cmd.Output()
+	containers, err := GetProjectContainers(instanceName)
 	if err != nil {
 		return false
 	}
-	return strings.TrimSpace(string(output)) != ""
+	return len(containers) > 0
+}
+
+// InstanceContainerNames returns the names of the containers graphsense-cli creates for an instance
+func InstanceContainerNames(instanceName string) []string {
+	return []string{
+		fmt.Sprintf("%s-app", instanceName),
+		fmt.Sprintf("%s-postgres", instanceName),
+		fmt.Sprintf("%s-neo4j", instanceName),
+	}
+}
+
+// ServiceContainer returns the container running a service of an instance. Containers recorded
+// in instances.db are preferred; services that are not recorded, such as a local embedding
+// server, are looked up by their compose labels.
+func ServiceContainer(instanceName, service string) (string, error) {
+	recorded, err := GetInstanceContainers(instanceName)
+	if err != nil {
+		return "", err
+	}
+	for _, container := range recorded {
+		if container.ContainerName == fmt.Sprintf("%s-%s", instanceName, service) {
+			return container.ContainerName, nil
+		}
+	}
+
+	docker, err := GetDockerClient()
+	if err != nil {
+		return "", err
+	}
+	containers, err := docker.ProjectContainers(context.Background(), instanceName)
+	if err != nil {
+		return "", err
+	}
+	var services []string
+	for _, container := range containers {
+		if container.Labels[ComposeServiceLabel] == service {
+			return ContainerName(container), nil
+		}
+		services = append(services, container.Labels[ComposeServiceLabel])
+	}
+	if len(services) == 0 {
+		return "", fmt.Errorf("instance '%s' does not exist", instanceName)
+	}
+	sort.Strings(services)
+	return "", fmt.Errorf("instance '%s' has no '%s' service (services: %s)", instanceName, service, strings.Join(services, ", "))
+}
+
+// IsForeignProject reports whether a compose project with this name exists and
+// contains containers that were not created by graphsense-cli
+func IsForeignProject(instanceName string) (bool, error) {
+	containers, err := GetProjectContainers(instanceName)
+	if err != nil {
+		return false, fmt.Errorf("failed to inspect compose project %s: %v", instanceName, err)
+	}
+
+	ours := make(map[string]bool)
+	for _, name := range InstanceContainerNames(instanceName) {
+		ours[name] = true
+	}
+
+	for _, container := range containers {
+		if !ours[container] {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+// NextFreeInstanceName appends the lowest numeric suffix to instanceName that is not
+// used by any compose project or recorded deploy
+func NextFreeInstanceName(instanceName string) string {
+	for suffix := 2; ; suffix++ {
+		candidate := fmt.Sprintf("%s-%d", instanceName, suffix)
+		if InstanceExists(candidate) {
+			continue
+		}
+		if config, _, err := GetDeployment(candidate); err == nil && config != nil {
+			continue
+		}
+		return candidate
+	}
 }
 
 // CreateTempEnvFile creates a temporary environment file for Docker Compose
@@ -127,32 +236,30 @@ NEO4J_BOLT_PORT=%d
 # Database Configuration
 POSTGRES_DB=graphsense
 POSTGRES_USER=postgres
-POSTGRES_PASSWORD=postgres
 
 # Neo4j Configuration
-NEO4J_AUTH=none
 NEO4J_USERNAME=neo4j
-NEO4J_PASSWORD=
 
 # Application Configuration
 NODE_ENV=production
-LOG_LEVEL=info
+LOG_LEVEL=%s
 INDEX_FROM_SCRATCH=true
 
 # Security Configuration
 CORS_ORIGIN=*
 RATE_LIMIT_MAX=100
 RATE_LIMIT_WINDOW=900000
-`, config.RepoPath, config.AppPort, config.PostgresPort, config.Neo4jBoltPort)
+`, config.RepoPath, config.AppPort, config.PostgresPort, config.Neo4jBoltPort, config.AppLogLevel())
 
-	if config.CoAPIKey != "" {
-		content += fmt.Sprintf("CO_API_KEY=%s\n", config.CoAPIKey)
+	if workers := config.AppIndexWorkers(); workers > 0 {
+		content += fmt.Sprintf("INDEX_WORKERS=%d\n", workers)
 	}
-
-	if config.AnthropicAPIKey != "" {
-		content += fmt.Sprintf("ANTHROPIC_API_KEY=%s\n", config.AnthropicAPIKey)
+	if batchSize := config.AppIndexBatchSize(); batchSize > 0 {
+		content += fmt.Sprintf("INDEX_BATCH_SIZE=%d\n", batchSize)
 	}
 
+	// API keys and database passwords are left out: they reach compose and docker run
+	// through their environment, see SecretEnv, so they are never written to disk
 	if _, err := tmpFile.WriteString(content); err != nil {
 		return "", err
 	}
@@ -160,70 +267,257 @@ RATE_LIMIT_WINDOW=900000
 	return tmpFile.Name(), nil
 }
 
-// CreateComposeOverride creates a Docker Compose override file
-func CreateComposeOverride(config *DeployConfig) (string, error) {
-	tmpFile, err := os.CreateTemp("", "graphsense-compose-*.yml")
-	if err != nil {
-		return "", err
-	}
-	defer tmpFile.Close()
-
-	content := fmt.Sprintf(`version: "3.8"
+// composeOverrideTemplate renders the instance-specific Docker Compose override
+var composeOverrideTemplate = template.Must(template.New("override").Funcs(template.FuncMap{
+	"service": func(config *DeployConfig, service string) serviceConfig {
+		return serviceConfig{Config: config, Service: service}
+	},
+	// env quotes an environment override, escaping $ so that compose does not interpolate it
+	"env": func(name, value string) string {
+		return strconv.Quote(name + "=" + strings.ReplaceAll(value, "$", "$$"))
+	},
+}).Parse(`
+{{- define "labels"}}
+{{- with .Labels}}
+    labels:
+{{- range $key, $value := .}}
+      {{$key}}: {{printf "%q" $value}}
+{{- end}}
+{{- end}}
+{{- end}}
+{{- define "resources"}}
+{{- with .Config.ServiceCPUSet .Service}}
+    cpuset: "{{.}}"
+{{- end}}
+{{- $limits := .Config.ServiceResources .Service}}
+{{- $gpu := .Config.ServiceGPU .Service}}
+{{- if or $limits $gpu}}
+    deploy:
+      resources:
+{{- with $limits}}
+        limits:
+{{- with .CPUsString}}
+          cpus: "{{.}}"
+{{- end}}
+{{- with .MemoryString}}
+          memory: {{.}}
+{{- end}}
+{{- end}}
+{{- with $gpu}}
+        reservations:
+          devices:
+            - driver: nvidia
+{{- if .DeviceIDs}}
+              device_ids: [{{range $i, $id := .DeviceIDs}}{{if $i}}, {{end}}"{{$id}}"{{end}}]
+{{- else}}
+              count: {{.Count}}
+{{- end}}
+              capabilities: [gpu]
+{{- end}}
+{{- end}}
+{{- end -}}
+version: "3.8"
 
 services:
   postgres:
-    container_name: %s-postgres
+    container_name: {{.InstanceName}}-postgres
+{{- with .PostgresImage}}
+    image: {{.}}
+{{- end}}
+{{- template "labels" .}}
+{{- template "resources" (service . "postgres")}}
+{{- if not .BindsAllInterfaces}}
+    ports: !override
+      - "{{.PublishedPort .PostgresPort}}:5432"
+{{- end}}
+    environment:
+      - POSTGRES_PASSWORD=${POSTGRES_PASSWORD}
+{{- range $name, $value := .ServiceEnvironment "postgres"}}
+      - {{env $name $value}}
+{{- end}}
     volumes:
-      - %s_postgres_data:/var/lib/postgresql/data
+      - {{.InstanceName}}_postgres_data:/var/lib/postgresql/data
     networks:
-      - %s-network
+      - {{.InstanceName}}-network
 
   neo4j:
-    container_name: %s-neo4j
+    container_name: {{.InstanceName}}-neo4j
+{{- with .Neo4jImage}}
+    image: {{.}}
+{{- end}}
+{{- template "labels" .}}
+{{- template "resources" (service . "neo4j")}}
+{{- if not .BindsAllInterfaces}}
+    ports: !override
+      - "{{.PublishedPort .Neo4jBoltPort}}:7687"
+{{- end}}
+    environment:
+      - NEO4J_AUTH=${NEO4J_AUTH}
+{{- range $name, $value := .Neo4jMemoryEnv}}
+      - {{$name}}={{$value}}
+{{- end}}
+{{- range $name, $value := .ServiceEnvironment "neo4j"}}
+      - {{env $name $value}}
+{{- end}}
+    volumes:
+      - {{.InstanceName}}_neo4j_data:/data
+      - {{.InstanceName}}_neo4j_logs:/logs
+      - {{.InstanceName}}_neo4j_plugins:/plugins
+      - {{.InstanceName}}_neo4j_conf:/conf
+    networks:
+      - {{.InstanceName}}-network
+
+{{- with .LocalEmbeddings}}
+
+  embeddings:
+    image: {{.Image}}
+    container_name: {{$.InstanceName}}-embeddings
+{{- template "labels" $}}
+{{- template "resources" (service $ "embeddings")}}
+    command: ["--model-id", "{{.ModelID}}"]
+{{- if .Path}}
+    environment:
+      - HF_HUB_OFFLINE=1
     volumes:
-      - %s_neo4j_data:/data
-      - %s_neo4j_logs:/logs
-      - %s_neo4j_plugins:/plugins
-      - %s_neo4j_conf:/conf
+      - {{.Path}}:/model:ro
+{{- else}}
+    volumes:
+      - {{$.InstanceName}}_embedding_models:/data
+{{- end}}
     networks:
-      - %s-network
+      - {{$.InstanceName}}-network
+{{- end}}
 
   app:
-    container_name: %s-app
+    container_name: {{.InstanceName}}-app
+{{- template "labels" .}}
+{{- template "resources" (service . "app")}}
+{{- with .AppCPUShares}}
+    cpu_shares: {{.}}
+{{- end}}
+{{- if .AppImage}}
+    image: {{.AppImage}}
+{{- end}}
+{{- if .LocalEmbeddings}}
+    depends_on:
+      - embeddings
+{{- end}}
+{{- with .APIKeySecrets}}
+    secrets:
+{{- range .}}
+      - source: {{.ID}}
+        target: {{.Name}}
+{{- end}}
+{{- end}}
     volumes:
-      - %s_app_repos:/app/.graphsense
-      - %s:/home/repo:ro
+      - {{.InstanceName}}_app_repos:/app/.graphsense
+      - {{.RepoPath}}:/home/repo:ro
+{{- range .RepoGitMounts}}
+      - {{.}}:{{.}}:ro
+{{- end}}
+{{- if .TLS}}
+      - {{.TLSMount}}
+{{- end}}
+{{- with .ExcludedRepoPaths}}
+    tmpfs:
+{{- range .}}
+      - {{.}}
+{{- end}}
+{{- end}}
+{{- if .BindsAllInterfaces}}
     ports:
-      - "%d:8080"
+      - "{{.AppPort}}:8080"
+{{- else}}
+    ports: !override
+      - "{{.PublishedPort .AppPort}}:8080"
+{{- end}}
     networks:
-      - %s-network
+      - {{.InstanceName}}-network
+{{- with .ProxyNetworkName}}
+      - {{.}}
+{{- end}}
     environment:
-      - POSTGRES_URL=postgresql://postgres:postgres@%s-postgres:5432/${POSTGRES_DB}
-      - NEO4J_URI=bolt://%s-neo4j:7687
+      - POSTGRES_URL=postgresql://postgres:${POSTGRES_PASSWORD}@{{.InstanceName}}-postgres:5432/${POSTGRES_DB}
+      - NEO4J_URI=bolt://{{.InstanceName}}-neo4j:7687
+      - NEO4J_USERNAME=${NEO4J_USERNAME}
+      - NEO4J_PASSWORD=${NEO4J_PASSWORD}
       - LOCAL_REPO_PATH=/home/repo
+{{- range .APIKeySecrets}}
+      - {{.Name}}_FILE=/run/secrets/{{.Name}}
+{{- end}}
+{{- range $name, $value := .TLSEnv}}
+      - {{$name}}={{$value}}
+{{- end}}
+{{- if .LocalEmbeddings}}
+      - EMBEDDING_PROVIDER=tei
+      - EMBEDDING_API_URL=http://{{.InstanceName}}-embeddings:80
+{{- end}}
+{{- range $name, $value := .ServiceEnvironment "app"}}
+      - {{env $name $value}}
+{{- end}}
 
 networks:
-  %s-network:
+  {{.InstanceName}}-network:
     driver: bridge
+{{- with .ProxyNetworkName}}
+  {{.}}:
+    external: true
+{{- end}}
+{{- with .APIKeySecrets}}
+
+secrets:
+{{- range .}}
+  {{.ID}}:
+    environment: {{.Source}}
+{{- end}}
+{{- end}}
 
 volumes:
-  %s_postgres_data:
-    name: %s_postgres_data
-  %s_neo4j_data:
-    name: %s_neo4j_data
-  %s_neo4j_logs:
-    name: %s_neo4j_logs
-  %s_neo4j_plugins:
-    name: %s_neo4j_plugins
-  %s_neo4j_conf:
-    name: %s_neo4j_conf
-  %s_app_repos:
-    name: %s_app_repos
-`,
-		config.InstanceName, config.InstanceName, config.InstanceName,
-		config.InstanceName, config.InstanceName, config.InstanceName, config.InstanceName, config.InstanceName, config.InstanceName,
-		config.InstanceName, config.InstanceName, config.RepoPath, config.AppPort, config.InstanceName, config.InstanceName, config.InstanceName,
-		config.InstanceName, config.InstanceName, config.InstanceName, config.InstanceName, config.InstanceName, config.InstanceName, config.InstanceName, config.InstanceName, config.InstanceName, config.InstanceName, config.InstanceName, config.InstanceName, config.InstanceName)
+  {{.InstanceName}}_postgres_data:
+    name: {{.InstanceName}}_postgres_data
+  {{.InstanceName}}_neo4j_data:
+    name: {{.InstanceName}}_neo4j_data
+  {{.InstanceName}}_neo4j_logs:
+    name: {{.InstanceName}}_neo4j_logs
+  {{.InstanceName}}_neo4j_plugins:
+    name: {{.InstanceName}}_neo4j_plugins
+  {{.InstanceName}}_neo4j_conf:
+    name: {{.InstanceName}}_neo4j_conf
+  {{.InstanceName}}_app_repos:
+    name: {{.InstanceName}}_app_repos
+{{- with .LocalEmbeddings}}{{if not .Path}}
+  {{$.InstanceName}}_embedding_models:
+    name: {{$.InstanceName}}_embedding_models
+{{- end}}{{end}}
+`))
+
+// serviceConfig passes a service along with its instance to a template
+type serviceConfig struct {
+	Config  *DeployConfig
+	Service string
+}
+
+// RenderComposeOverride renders the Docker Compose override for an instance
+func RenderComposeOverride(config *DeployConfig) (string, error) {
+	var buf bytes.Buffer
+	if err := composeOverrideTemplate.Execute(&buf, config); err != nil {
+		return "", fmt.Errorf("failed to render compose override: %v", err)
+	}
+	return buf.String(), nil
+}
+
+// CreateComposeOverride creates a Docker Compose override file
+func CreateComposeOverride(config *DeployConfig) (string, error) {
+	content, err := RenderComposeOverride(config)
+	if err != nil {
+		return "", err
+	}
+
+	tmpFile, err := os.CreateTemp("", "graphsense-compose-*.yml")
+	if err != nil {
+		return "", err
+	}
+	defer tmpFile.Close()
 
 	if _, err := tmpFile.WriteString(content); err != nil {
 		return "", err
@@ -232,50 +526,169 @@ volumes:
 	return tmpFile.Name(), nil
 }
 
-// RunDockerCompose runs a docker-compose command
-func RunDockerCompose(args []string, envVars map[string]string) error {
-	cmd := exec.Command("docker-compose", args...)
+// GetComposeFile returns the path of the base docker-compose.yml shared by all instances
+func GetComposeFile() (string, error) {
+	// Use the docker-compose.yml from ~/oss/code-graph-rag/
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to get user home directory: %v", err)
+	}
 
-	// Set environment variables
-	cmd.Env = os.Environ()
-	for key, value := range envVars {
-		cmd.Env = append(cmd.Env, fmt.Sprintf("%s=%s", key, value))
+	composeFile := filepath.Join(homeDir, "oss", "code-graph-rag", "docker-compose.yml")
+	if _, err := os.Stat(composeFile); os.IsNotExist(err) {
+		return "", fmt.Errorf("docker-compose.yml not found at: %s", composeFile)
 	}
 
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
+	return composeFile, nil
+}
+
+// ComposeFiles holds the files passed to docker-compose for an instance
+type ComposeFiles struct {
+	ComposeFile string
+	Override    string
+	EnvFile     string
+	// Secrets are the API keys and database passwords, passed to compose through its
+	// environment; see ComposeSecretEnv
+	Secrets map[string]string
+}
 
-	return cmd.Run()
+// Env returns envVars with the instance's secrets added, for compose commands on the files
+func (f *ComposeFiles) Env(envVars map[string]string) map[string]string {
+	env := make(map[string]string, len(envVars)+len(f.Secrets))
+	for key, value := range f.Secrets {
+		env[key] = value
+	}
+	for key, value := range envVars {
+		env[key] = value
+	}
+	return env
 }
 
-// WaitForHealthy waits for services to become healthy
-func WaitForHealthy(instanceName string, maxAttempts int) error {
-	Log.Info("Waiting for services to be healthy...")
+// PrepareComposeFiles renders the env file and override for an instance.
+// Callers must call Cleanup once the files are no longer needed.
+func PrepareComposeFiles(config *DeployConfig) (*ComposeFiles, error) {
+	composeFile, err := GetComposeFile()
+	if err != nil {
+		return nil, err
+	}
 
-	for attempt := 0; attempt < maxAttempts; attempt++ {
-		cmd := exec.Command("docker-compose", "ps")
-		cmd.Env = append(os.Environ(), fmt.Sprintf("COMPOSE_PROJECT_NAME=%s", instanceName))
+	secrets, err := config.ComposeSecretEnv()
+	if err != nil {
+		return nil, err
+	}
+	files := &ComposeFiles{ComposeFile: composeFile, Secrets: secrets}
 
-		output, err := cmd.Output()
-		if err != nil {
-			time.Sleep(5 * time.Second)
-			continue
-		}
+	files.EnvFile, err = CreateTempEnvFile(config)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create environment file: %v", err)
+	}
+
+	files.Override, err = CreateComposeOverride(config)
+	if err != nil {
+		files.Cleanup()
+		return nil, fmt.Errorf("failed to create compose override: %v", err)
+	}
 
-		// Simple check - if we see "Up" or "healthy" in the output, consider it healthy
-		outputStr := string(output)
-		if strings.Contains(outputStr, "Up") {
-			return nil
+	if len(config.ImageTags) > 0 {
+		if err := pinComposeImageTags(config, files); err != nil {
+			files.Cleanup()
+			return nil, err
 		}
+	}
 
-		time.Sleep(5 * time.Second)
-		Log.Info(fmt.Sprintf("Waiting for health checks... (%d/%d)", attempt+1, maxAttempts))
+	return files, nil
+}
+
+// StartServices creates and starts the containers of an instance from its configuration
+func StartServices(config *DeployConfig) error {
+	if config.IsSingleContainer() {
+		return RunSingleContainer(config)
+	}
+
+	files, err := PrepareComposeFiles(config)
+	if err != nil {
+		return err
 	}
+	defer files.Cleanup()
 
-	Log.Warning("Not all services became healthy within timeout, but continuing...")
+	envVars := map[string]string{
+		"COMPOSE_PROJECT_NAME": config.InstanceName,
+	}
+	if err := RunDockerCompose(files.Args("up", "-d"), files.Env(envVars)); err != nil {
+		return fmt.Errorf("failed to start instance %s: %v", config.InstanceName, err)
+	}
 	return nil
 }
 
+// Args returns the docker-compose arguments selecting these files followed by args
+func (f *ComposeFiles) Args(args ...string) []string {
+	return append([]string{
+		"-f", f.ComposeFile,
+		"-f", f.Override,
+		"--env-file", f.EnvFile,
+	}, args...)
+}
+
+// Cleanup removes the rendered temporary files
+func (f *ComposeFiles) Cleanup() {
+	if f.EnvFile != "" {
+		os.Remove(f.EnvFile)
+	}
+	if f.Override != "" {
+		os.Remove(f.Override)
+	}
+}
+
+// DockerComposeOutput runs a docker compose command and returns its standard output
+func DockerComposeOutput(args []string, envVars map[string]string) ([]byte, error) {
+	runner, err := GetComposeRunner()
+	if err != nil {
+		return nil, err
+	}
+	return runner.Output(args, envVars)
+}
+
+// GetComposeImages returns the image each service of a compose configuration will run
+func GetComposeImages(files *ComposeFiles, envVars map[string]string) (map[string]string, error) {
+	output, err := DockerComposeOutput(files.Args("config"), files.Env(envVars))
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve compose configuration: %v", err)
+	}
+
+	var resolved struct {
+		Services map[string]struct {
+			Image string `yaml:"image"`
+		} `yaml:"services"`
+	}
+	if err := yaml.Unmarshal(output, &resolved); err != nil {
+		return nil, fmt.Errorf("failed to parse compose configuration: %v", err)
+	}
+
+	images := make(map[string]string)
+	for service, definition := range resolved.Services {
+		images[service] = definition.Image
+	}
+	return images, nil
+}
+
+// RunDockerCompose runs a docker compose command using the detected Compose implementation
+func RunDockerCompose(args []string, envVars map[string]string) error {
+	runner, err := GetComposeRunner()
+	if err != nil {
+		return err
+	}
+	return runner.Run(args, envVars)
+}
+
+// StreamDockerCompose runs a docker compose command, passing every line of its output to handle
+func StreamDockerCompose(args []string, envVars map[string]string, handle func(line string)) error {
+	runner, err := GetComposeRunner()
+	if err != nil {
+		return err
+	}
+	return runner.Stream(args, envVars, handle)
+}
+
 // DeployConfig holds configuration for deployment
 type DeployConfig struct {
 	RepoPath        string
@@ -285,67 +698,334 @@ type DeployConfig struct {
 	Neo4jBoltPort   int
 	CoAPIKey        string
 	AnthropicAPIKey string
+	AppImage        string
+	PostgresVersion string
+	Neo4jVersion    string
+	Mode            string
+	EmbeddingModel  string
+	LogLevel        string
+	// ExcludeSubmodules hides the repository's git submodules from the app
+	ExcludeSubmodules bool
+	// RepoURL is the remote the repository was cloned from when deployed from a Git URL.
+	// RepoPath is then a managed clone that is removed with the instance.
+	RepoURL string
+	// Autostart is the policy for bringing the instance back after a Docker restart
+	Autostart string
+	// BindAddress is the host address ports are published on; empty publishes them on all
+	// interfaces, as instances deployed before it was recorded do
+	BindAddress string
+	// Labels are the key=value labels given at deploy time, also set as Docker labels on
+	// the instance's containers
+	Labels map[string]string
+	// CPUSet pins the instance's containers to these CPUs, e.g. 0-3; empty leaves them unpinned
+	CPUSet string
+	// Neo4jCPUSet pins Neo4j to other CPUs than the rest of the instance
+	Neo4jCPUSet string
+	// IndexWorkers and IndexBatchSize throttle indexing; 0 leaves the app's defaults
+	IndexWorkers   int
+	IndexBatchSize int
+	// Nice keeps indexing in the background: fewer workers, smaller batches and a lower CPU weight
+	Nice bool
+	// Limits caps the memory and CPUs of each of the instance's containers
+	Limits ResourceLimits
+	// ServiceLimits overrides Limits for single services, keyed by service name
+	ServiceLimits map[string]ResourceLimits
+	// Neo4jHeap and Neo4jPageCache size Neo4j's memory in bytes; 0 leaves Neo4j's defaults
+	Neo4jHeap      int64
+	Neo4jPageCache int64
+	// GPU is the GPUs passed through to the app container in the format of docker run --gpus,
+	// e.g. all; empty for none
+	GPU string
+	// ServiceEnv overrides environment variables of single services, keyed by service name
+	ServiceEnv map[string]map[string]string
+	// PostgresImage and Neo4jImage pin the databases to other images than the compose file's,
+	// as AppImage does for the app
+	PostgresImage string
+	Neo4jImage    string
+	// ImageTags are the tags deploy --image-tag pins services to, keyed by service name. They
+	// are resolved into the services' images when the compose files are prepared.
+	ImageTags map[string]string
+	// CredentialStore is where the instance's database credentials are kept; empty for
+	// instances that still use the fixed legacy credentials
+	CredentialStore string
+	// TLS serves the MCP endpoint over HTTPS with the certificate in the instance's TLS directory
+	TLS bool
+	// ExpiresAt is when the TTL given at deploy time runs out and gc stops or removes the
+	// instance; zero for never
+	ExpiresAt time.Time
+	// AllowHostScripts lets the repository's lifecycle scripts run on the host. It is decided
+	// by each command running scripts and never recorded.
+	AllowHostScripts bool
+
+	// credentials caches the database credentials read by Credentials
+	credentials *InstanceCredentials
 }
 
 // GetRunningInstances returns a list of running GraphSense instances
 func GetRunningInstances() ([]string, error) {
-	cmd := exec.Command("docker", "ps", "--format", "{{.Names}}")
-	output, err := cmd.Output()
+	docker, err := GetDockerClient()
+	if err != nil {
+		return nil, err
+	}
+
+	containers, err := docker.ListContainers(context.Background(), false, filters.NewArgs())
 	if err != nil {
 		return nil, err
 	}
 
 	var instances []string
-	scanner := bufio.NewScanner(strings.NewReader(string(output)))
-	for scanner.Scan() {
-		line := scanner.Text()
-		if strings.Contains(line, "graphsense-") {
-			instances = append(instances, line)
+	for _, container := range containers {
+		if name := ContainerName(container); strings.Contains(name, "graphsense-") {
+			instances = append(instances, name)
 		}
 	}
 
 	return instances, nil
 }
 
-// GetPortsInUse returns a list of ports currently in use
-func GetPortsInUse() ([]int, error) {
-	cmd := exec.Command("netstat", "-an")
-	output, err := cmd.Output()
+// GetGraphsenseProjects returns the compose projects of all GraphSense containers, running or not
+func GetGraphsenseProjects() ([]string, error) {
+	docker, err := GetDockerClient()
 	if err != nil {
 		return nil, err
 	}
 
-	var ports []int
-	re := regexp.MustCompile(`:(\d+)\s`)
-	matches := re.FindAllStringSubmatch(string(output), -1)
+	containers, err := docker.ListContainers(context.Background(), true, filters.NewArgs(filters.Arg("label", ComposeProjectLabel)))
+	if err != nil {
+		return nil, err
+	}
+
+	seen := make(map[string]bool)
+	var projects []string
+	for _, container := range containers {
+		project := container.Labels[ComposeProjectLabel]
+		if project == "" || !isGraphsenseContainer(ContainerName(container)) {
+			continue
+		}
+		if !seen[project] {
+			seen[project] = true
+			projects = append(projects, project)
+		}
+	}
+
+	return projects, nil
+}
+
+// GetOrphanedProjects returns the compose projects of GraphSense containers that belong to no
+// instance recorded in instances.db, such as those left behind by deploys whose record was lost
+func GetOrphanedProjects() ([]string, error) {
+	projects, err := GetGraphsenseProjects()
+	if err != nil {
+		return nil, err
+	}
+	recorded, err := GetInstanceNames()
+	if err != nil {
+		return nil, err
+	}
 
-	for _, match := range matches {
-		if len(match) > 1 {
-			port, err := strconv.Atoi(match[1])
-			if err == nil {
-				ports = append(ports, port)
-			}
+	known := make(map[string]bool)
+	for _, name := range recorded {
+		known[name] = true
+	}
+	var orphaned []string
+	for _, project := range projects {
+		if !known[project] {
+			orphaned = append(orphaned, project)
 		}
 	}
+	sort.Strings(orphaned)
+	return orphaned, nil
+}
 
-	return ports, nil
+// isGraphsenseContainer reports whether a container of a compose project is one of a
+// GraphSense instance, by its name
+func isGraphsenseContainer(name string) bool {
+	return strings.Contains(name, "graphsense-")
 }
 
-// LoadAPIKeys loads API keys from ~/.graphsense/.env
+// GetProjectContainers returns the names of all containers, running or not, in a compose project
+func GetProjectContainers(instanceName string) ([]string, error) {
+	docker, err := GetDockerClient()
+	if err != nil {
+		return nil, err
+	}
+
+	containers, err := docker.ProjectContainers(context.Background(), instanceName)
+	if err != nil {
+		return nil, err
+	}
+
+	var names []string
+	for _, container := range containers {
+		names = append(names, ContainerName(container))
+	}
+
+	return names, nil
+}
+
+// ContainerImage describes the image a service container of an instance runs
+type ContainerImage struct {
+	Service string
+	Image   string
+	ID      string
+	Digest  string
+}
+
+// GetContainerImages returns the images used by an instance's containers, keyed by compose service
+func GetContainerImages(instanceName string) (map[string]ContainerImage, error) {
+	docker, err := GetDockerClient()
+	if err != nil {
+		return nil, err
+	}
+
+	ctx := context.Background()
+	containers, err := docker.ProjectContainers(ctx, instanceName)
+	if err != nil {
+		return nil, err
+	}
+
+	images := make(map[string]ContainerImage)
+	for _, container := range containers {
+		image := ContainerImage{
+			Service: container.Labels[ComposeServiceLabel],
+			Image:   container.Image,
+			ID:      container.ImageID,
+		}
+		if digest, err := docker.ImageDigest(ctx, image.ID); err == nil {
+			image.Digest = digest
+		}
+		images[image.Service] = image
+	}
+
+	return images, nil
+}
+
+// ImageWithTag replaces the tag (or digest) of an image reference
+func ImageWithTag(image, tag string) string {
+	if i := strings.Index(image, "@"); i >= 0 {
+		image = image[:i]
+	}
+	if i := strings.LastIndex(image, ":"); i > strings.LastIndex(image, "/") {
+		image = image[:i]
+	}
+	return image + ":" + tag
+}
+
+// GetVolumeSizes returns the disk usage in bytes of every Docker volume, keyed by volume name
+func GetVolumeSizes() (map[string]int64, error) {
+	docker, err := GetDockerClient()
+	if err != nil {
+		return nil, err
+	}
+	return docker.VolumeSizes(context.Background())
+}
+
+// GetInstanceDiskUsage returns the total size in bytes of an instance's named volumes
+func GetInstanceDiskUsage(instanceName string, volumeSizes map[string]int64) int64 {
+	var total int64
+	for volume, size := range volumeSizes {
+		if strings.HasPrefix(volume, instanceName+"_") {
+			total += size
+		}
+	}
+	return total
+}
+
+// ParseSize parses a human readable size such as "512MB", "1.5GB" or "4g" into bytes
+func ParseSize(value string) (int64, error) {
+	re := regexp.MustCompile(`^\s*([0-9]*\.?[0-9]+)\s*([a-zA-Z]*)\s*$`)
+	match := re.FindStringSubmatch(value)
+	if match == nil {
+		return 0, fmt.Errorf("invalid size: %s", value)
+	}
+
+	number, err := strconv.ParseFloat(match[1], 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid size: %s", value)
+	}
+
+	multipliers := map[string]float64{
+		"":    1,
+		"b":   1,
+		"k":   1e3,
+		"kb":  1e3,
+		"m":   1e6,
+		"mb":  1e6,
+		"g":   1e9,
+		"gb":  1e9,
+		"t":   1e12,
+		"tb":  1e12,
+		"kib": 1 << 10,
+		"mib": 1 << 20,
+		"gib": 1 << 30,
+		"tib": 1 << 40,
+	}
+
+	multiplier, ok := multipliers[strings.ToLower(match[2])]
+	if !ok {
+		return 0, fmt.Errorf("invalid size unit: %s", value)
+	}
+
+	return int64(number * multiplier), nil
+}
+
+// FormatSize renders a byte count in the same decimal units Docker uses
+func FormatSize(bytes int64) string {
+	units := []string{"B", "kB", "MB", "GB", "TB"}
+	size := float64(bytes)
+	unit := 0
+	for size >= 1000 && unit < len(units)-1 {
+		size /= 1000
+		unit++
+	}
+	if unit == 0 {
+		return fmt.Sprintf("%dB", bytes)
+	}
+	return fmt.Sprintf("%.1f%s", size, units[unit])
+}
+
+// LoadAPIKeys loads API keys from the OS keyring, falling back to ~/.graphsense/.env for keys
+// the keyring does not hold
 func LoadAPIKeys() (coAPIKey, anthropicAPIKey string, err error) {
-	homeDir, err := os.UserHomeDir()
+	stored, err := StoredAPIKeys()
 	if err != nil {
-		return "", "", fmt.Errorf("failed to get home directory: %v", err)
+		return "", "", err
 	}
 
-	envFile := filepath.Join(homeDir, ".graphsense", ".env")
-	if _, err := os.Stat(envFile); os.IsNotExist(err) {
-		return "", "", fmt.Errorf("API keys file not found: %s", envFile)
+	keys := make(map[string]string)
+	for _, key := range stored {
+		if key.Source != "" {
+			keys[key.Name] = key.Value
+		}
 	}
 
+	if len(keys) == 0 {
+		envFile, _ := APIKeysFile()
+		if _, err := os.Stat(envFile); os.IsNotExist(err) {
+			return "", "", fmt.Errorf("no API keys in the OS keyring and API keys file not found: %s", envFile)
+		}
+	}
+	return keys[CoAPIKeyName], keys[AnthropicAPIKeyName], nil
+}
+
+// loadAPIKeysFile reads the API keys in ~/.graphsense/.env, if it exists
+func loadAPIKeysFile() (map[string]string, error) {
+	envFile, err := APIKeysFile()
+	if err != nil {
+		return nil, err
+	}
+	return readAPIKeysFile(envFile)
+}
+
+// readAPIKeysFile reads the API keys in an env file, returning none if the file does not exist
+func readAPIKeysFile(envFile string) (map[string]string, error) {
+	keys := make(map[string]string)
 	file, err := os.Open(envFile)
+	if os.IsNotExist(err) {
+		return keys, nil
+	}
 	if err != nil {
-		return "", "", fmt.Errorf("failed to open API keys file: %v", err)
+		return nil, fmt.Errorf("failed to open API keys file: %v", err)
 	}
 	defer file.Close()
 
@@ -365,16 +1045,14 @@ func LoadAPIKeys() (coAPIKey, anthropicAPIKey string, err error) {
 		value := strings.TrimSpace(parts[1])
 
 		switch key {
-		case "CO_API_KEY":
-			coAPIKey = value
-		case "ANTHROPIC_API_KEY":
-			anthropicAPIKey = value
+		case CoAPIKeyName, AnthropicAPIKeyName:
+			keys[key] = value
 		}
 	}
 
 	if err := scanner.Err(); err != nil {
-		return "", "", fmt.Errorf("failed to read API keys file: %v", err)
+		return nil, fmt.Errorf("failed to read API keys file: %v", err)
 	}
 
-	return coAPIKey, anthropicAPIKey, nil
+	return keys, nil
 }
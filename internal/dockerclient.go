@@ -0,0 +1,608 @@
+package internal
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/events"
+	"github.com/docker/docker/api/types/filters"
+	"github.com/docker/docker/api/types/image"
+	"github.com/docker/docker/api/types/volume"
+	"github.com/docker/docker/client"
+)
+
+// Labels docker compose puts on every container it creates
+const (
+	ComposeProjectLabel = "com.docker.compose.project"
+	ComposeServiceLabel = "com.docker.compose.service"
+	ComposeVolumeLabel  = "com.docker.compose.volume"
+)
+
+// DockerClient talks to the Docker Engine API. Compose is still used to bring instances up
+// and down; everything else (listing, inspection, volumes, networks) goes through this client.
+type DockerClient struct {
+	api *client.Client
+}
+
+var (
+	dockerClient     *DockerClient
+	dockerClientErr  error
+	dockerClientOnce sync.Once
+)
+
+// GetDockerClient returns the shared Docker client, connecting on first use.
+// The connection honours DOCKER_HOST and the other standard Docker environment variables.
+func GetDockerClient() (*DockerClient, error) {
+	dockerClientOnce.Do(func() {
+		opts := []client.Opt{client.FromEnv, client.WithAPIVersionNegotiation()}
+
+		// The API client cannot speak ssh itself, so tunnel through the remote docker CLI
+		if host := os.Getenv("DOCKER_HOST"); strings.HasPrefix(host, "ssh://") {
+			dialer, err := sshDialer(host)
+			if err != nil {
+				dockerClientErr = err
+				return
+			}
+			opts = append(opts, client.WithHost("http://docker.example.com"), client.WithDialContext(dialer))
+		}
+
+		api, err := client.NewClientWithOpts(opts...)
+		if err != nil {
+			dockerClientErr = fmt.Errorf("failed to create docker client: %v", err)
+			return
+		}
+		dockerClient = &DockerClient{api: api}
+	})
+	return dockerClient, dockerClientErr
+}
+
+// emptyFilter matches every object
+func emptyFilter() filters.Args {
+	return filters.NewArgs()
+}
+
+// projectFilter selects the containers, volumes or networks of a compose project
+func projectFilter(project string) filters.Args {
+	return filters.NewArgs(filters.Arg("label", fmt.Sprintf("%s=%s", ComposeProjectLabel, project)))
+}
+
+// ContainerName returns the primary name of a listed container without its leading slash
+func ContainerName(c types.Container) string {
+	if len(c.Names) == 0 {
+		return c.ID[:12]
+	}
+	return strings.TrimPrefix(c.Names[0], "/")
+}
+
+// ServerVersion returns the version of the Docker daemon
+func (c *DockerClient) ServerVersion(ctx context.Context) (string, error) {
+	version, err := c.api.ServerVersion(ctx)
+	if err != nil {
+		return "", err
+	}
+	return version.Version, nil
+}
+
+// CPUCount returns the number of CPUs of the Docker host
+func (c *DockerClient) CPUCount(ctx context.Context) (int, error) {
+	info, err := c.api.Info(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("failed to get docker info: %v", err)
+	}
+	return info.NCPU, nil
+}
+
+// MemoryTotal returns the memory of the Docker host in bytes
+func (c *DockerClient) MemoryTotal(ctx context.Context) (int64, error) {
+	info, err := c.api.Info(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("failed to get docker info: %v", err)
+	}
+	return info.MemTotal, nil
+}
+
+// Runtimes returns the names of the container runtimes of the Docker host, e.g. runc and nvidia
+func (c *DockerClient) Runtimes(ctx context.Context) ([]string, error) {
+	info, err := c.api.Info(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get docker info: %v", err)
+	}
+	var runtimes []string
+	for name := range info.Runtimes {
+		runtimes = append(runtimes, name)
+	}
+	sort.Strings(runtimes)
+	return runtimes, nil
+}
+
+// ListContainers lists containers matching the filter, including stopped ones if all is set
+func (c *DockerClient) ListContainers(ctx context.Context, all bool, filter filters.Args) ([]types.Container, error) {
+	containers, err := c.api.ContainerList(ctx, container.ListOptions{All: all, Filters: filter})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list containers: %v", err)
+	}
+
+	sort.Slice(containers, func(i, j int) bool {
+		return ContainerName(containers[i]) < ContainerName(containers[j])
+	})
+	return containers, nil
+}
+
+// ProjectContainers lists all containers, running or not, of a compose project
+func (c *DockerClient) ProjectContainers(ctx context.Context, project string) ([]types.Container, error) {
+	return c.ListContainers(ctx, true, projectFilter(project))
+}
+
+// InspectContainer returns the full state of a container
+func (c *DockerClient) InspectContainer(ctx context.Context, name string) (types.ContainerJSON, error) {
+	info, err := c.api.ContainerInspect(ctx, name)
+	if err != nil {
+		return info, fmt.Errorf("failed to inspect %s: %v", name, err)
+	}
+	return info, nil
+}
+
+// StartContainer starts a stopped container
+func (c *DockerClient) StartContainer(ctx context.Context, name string) error {
+	if err := c.api.ContainerStart(ctx, name, container.StartOptions{}); err != nil {
+		return fmt.Errorf("failed to start %s: %v", name, err)
+	}
+	return nil
+}
+
+// StopContainer stops a running container
+func (c *DockerClient) StopContainer(ctx context.Context, name string) error {
+	if err := c.api.ContainerStop(ctx, name, container.StopOptions{}); err != nil {
+		return fmt.Errorf("failed to stop %s: %v", name, err)
+	}
+	return nil
+}
+
+// RestartContainer restarts a container, starting it if it is stopped
+func (c *DockerClient) RestartContainer(ctx context.Context, name string) error {
+	if err := c.api.ContainerRestart(ctx, name, container.StopOptions{}); err != nil {
+		return fmt.Errorf("failed to restart %s: %v", name, err)
+	}
+	return nil
+}
+
+// RemoveContainer force-removes a container and its anonymous volumes
+func (c *DockerClient) RemoveContainer(ctx context.Context, name string) error {
+	if err := c.api.ContainerRemove(ctx, name, container.RemoveOptions{Force: true, RemoveVolumes: true}); err != nil {
+		return fmt.Errorf("failed to remove %s: %v", name, err)
+	}
+	return nil
+}
+
+// ContainerUsage is the resource usage of a running container
+type ContainerUsage struct {
+	// CPUSeconds is the total CPU time the container has used
+	CPUSeconds float64
+	// MemoryBytes excludes the page cache, like docker stats
+	MemoryBytes uint64
+}
+
+// ContainerUsage returns the current resource usage of a running container
+func (c *DockerClient) ContainerUsage(ctx context.Context, name string) (ContainerUsage, error) {
+	var usage ContainerUsage
+
+	response, err := c.api.ContainerStatsOneShot(ctx, name)
+	if err != nil {
+		return usage, fmt.Errorf("failed to get stats of container %s: %v", name, err)
+	}
+	defer response.Body.Close()
+
+	var stats types.StatsJSON
+	if err := json.NewDecoder(response.Body).Decode(&stats); err != nil {
+		return usage, fmt.Errorf("failed to decode stats of container %s: %v", name, err)
+	}
+
+	usage.CPUSeconds = float64(stats.CPUStats.CPUUsage.TotalUsage) / 1e9
+	usage.MemoryBytes = memoryWithoutCache(stats.MemoryStats)
+	return usage, nil
+}
+
+// ContainerStats samples the resource usage of a running container the way docker stats
+// --no-stream does. The CPU share is measured between two samples, so this takes a second
+// or two.
+func (c *DockerClient) ContainerStats(ctx context.Context, name string) (ContainerStats, error) {
+	var result ContainerStats
+
+	response, err := c.api.ContainerStats(ctx, name, false)
+	if err != nil {
+		return result, fmt.Errorf("failed to get stats of container %s: %v", name, err)
+	}
+	defer response.Body.Close()
+
+	var stats types.StatsJSON
+	if err := json.NewDecoder(response.Body).Decode(&stats); err != nil {
+		return result, fmt.Errorf("failed to decode stats of container %s: %v", name, err)
+	}
+
+	cpuDelta := float64(stats.CPUStats.CPUUsage.TotalUsage) - float64(stats.PreCPUStats.CPUUsage.TotalUsage)
+	systemDelta := float64(stats.CPUStats.SystemUsage) - float64(stats.PreCPUStats.SystemUsage)
+	onlineCPUs := float64(stats.CPUStats.OnlineCPUs)
+	if onlineCPUs == 0 {
+		onlineCPUs = float64(len(stats.CPUStats.CPUUsage.PercpuUsage))
+	}
+	if cpuDelta > 0 && systemDelta > 0 {
+		result.CPUPercent = cpuDelta / systemDelta * onlineCPUs * 100
+	}
+
+	result.MemoryBytes = memoryWithoutCache(stats.MemoryStats)
+	result.MemoryLimit = stats.MemoryStats.Limit
+	if result.MemoryLimit > 0 {
+		result.MemoryPercent = float64(result.MemoryBytes) / float64(result.MemoryLimit) * 100
+	}
+	for _, network := range stats.Networks {
+		result.NetworkRx += network.RxBytes
+		result.NetworkTx += network.TxBytes
+	}
+	for _, entry := range stats.BlkioStats.IoServiceBytesRecursive {
+		switch strings.ToLower(entry.Op) {
+		case "read":
+			result.BlockRead += entry.Value
+		case "write":
+			result.BlockWrite += entry.Value
+		}
+	}
+	return result, nil
+}
+
+// memoryWithoutCache returns the memory a container uses excluding the page cache, like
+// docker stats
+func memoryWithoutCache(stats types.MemoryStats) uint64 {
+	// cgroup v2 reports the page cache as inactive_file, cgroup v1 as total_inactive_file
+	for _, key := range []string{"inactive_file", "total_inactive_file"} {
+		if cache, ok := stats.Stats[key]; ok && cache < stats.Usage {
+			return stats.Usage - cache
+		}
+	}
+	return stats.Usage
+}
+
+// ContainerEvents streams the events of the containers matching filter, starting with those
+// since the given time if it is not empty, until ctx is done or the connection fails
+func (c *DockerClient) ContainerEvents(ctx context.Context, filter filters.Args, since string) (<-chan events.Message, <-chan error) {
+	filter.Add("type", string(events.ContainerEventType))
+	return c.api.Events(ctx, types.EventsOptions{Filters: filter, Since: since})
+}
+
+// ImageDigest returns the first repository digest of an image, or an empty string for local images
+func (c *DockerClient) ImageDigest(ctx context.Context, imageID string) (string, error) {
+	image, _, err := c.api.ImageInspectWithRaw(ctx, imageID)
+	if err != nil {
+		return "", fmt.Errorf("failed to inspect image %s: %v", imageID, err)
+	}
+	if len(image.RepoDigests) == 0 {
+		return "", nil
+	}
+	return image.RepoDigests[0], nil
+}
+
+// ListImages lists the local top-level images, including untagged ones
+func (c *DockerClient) ListImages(ctx context.Context) ([]image.Summary, error) {
+	images, err := c.api.ImageList(ctx, types.ImageListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list images: %v", err)
+	}
+	return images, nil
+}
+
+// RemoveImage removes an image together with all of its tags. Force is needed to drop an
+// image with several tags by ID, so callers must make sure no container uses it.
+func (c *DockerClient) RemoveImage(ctx context.Context, imageID string) error {
+	if _, err := c.api.ImageRemove(ctx, imageID, types.ImageRemoveOptions{Force: true, PruneChildren: true}); err != nil {
+		return fmt.Errorf("failed to remove image %s: %v", imageID, err)
+	}
+	return nil
+}
+
+// ImageEnv returns the environment an image sets by default
+func (c *DockerClient) ImageEnv(ctx context.Context, imageID string) ([]string, error) {
+	image, _, err := c.api.ImageInspectWithRaw(ctx, imageID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to inspect image %s: %v", imageID, err)
+	}
+	if image.Config == nil {
+		return nil, nil
+	}
+	return image.Config.Env, nil
+}
+
+// VolumeSizes returns the disk usage in bytes of every volume, keyed by volume name
+func (c *DockerClient) VolumeSizes(ctx context.Context) (map[string]int64, error) {
+	usage, err := c.api.DiskUsage(ctx, types.DiskUsageOptions{Types: []types.DiskUsageObject{types.VolumeObject}})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get volume sizes: %v", err)
+	}
+
+	sizes := make(map[string]int64)
+	for _, v := range usage.Volumes {
+		if v.UsageData != nil && v.UsageData.Size >= 0 {
+			sizes[v.Name] = v.UsageData.Size
+		}
+	}
+	return sizes, nil
+}
+
+// ContainerLayerSizes returns the size in bytes of the writable layer of every container
+// belonging to a compose project, keyed by project and then container name
+func (c *DockerClient) ContainerLayerSizes(ctx context.Context) (map[string]map[string]int64, error) {
+	usage, err := c.api.DiskUsage(ctx, types.DiskUsageOptions{Types: []types.DiskUsageObject{types.ContainerObject}})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get container sizes: %v", err)
+	}
+
+	sizes := make(map[string]map[string]int64)
+	for _, container := range usage.Containers {
+		project := container.Labels[ComposeProjectLabel]
+		if project == "" {
+			continue
+		}
+		if sizes[project] == nil {
+			sizes[project] = make(map[string]int64)
+		}
+		sizes[project][ContainerName(*container)] = container.SizeRw
+	}
+	return sizes, nil
+}
+
+// ListVolumes returns the names of all volumes whose name starts with prefix
+func (c *DockerClient) ListVolumes(ctx context.Context, prefix string) ([]string, error) {
+	response, err := c.api.VolumeList(ctx, volume.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list volumes: %v", err)
+	}
+
+	var names []string
+	for _, v := range response.Volumes {
+		if strings.HasPrefix(v.Name, prefix) {
+			names = append(names, v.Name)
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// CreateVolume creates a named volume labelled as part of a compose project, so that compose
+// adopts it when the project's compose file declares a volume with that name
+func (c *DockerClient) CreateVolume(ctx context.Context, name, project string) error {
+	_, err := c.api.VolumeCreate(ctx, volume.CreateOptions{
+		Name: name,
+		Labels: map[string]string{
+			ComposeProjectLabel: project,
+			ComposeVolumeLabel:  name,
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create volume %s: %v", name, err)
+	}
+	return nil
+}
+
+// RemoveVolume removes a volume
+func (c *DockerClient) RemoveVolume(ctx context.Context, name string) error {
+	if err := c.api.VolumeRemove(ctx, name, false); err != nil {
+		return fmt.Errorf("failed to remove volume %s: %v", name, err)
+	}
+	return nil
+}
+
+// ProjectNetworks returns the names of the networks of a compose project
+func (c *DockerClient) ProjectNetworks(ctx context.Context, project string) ([]string, error) {
+	networks, err := c.api.NetworkList(ctx, types.NetworkListOptions{Filters: projectFilter(project)})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list networks: %v", err)
+	}
+
+	var names []string
+	for _, n := range networks {
+		names = append(names, n.Name)
+	}
+	return names, nil
+}
+
+// RemoveNetwork removes a network
+func (c *DockerClient) RemoveNetwork(ctx context.Context, name string) error {
+	if err := c.api.NetworkRemove(ctx, name); err != nil {
+		return fmt.Errorf("failed to remove network %s: %v", name, err)
+	}
+	return nil
+}
+
+// NetworkExists reports whether a network with exactly this name exists
+func (c *DockerClient) NetworkExists(ctx context.Context, name string) (bool, error) {
+	networks, err := c.api.NetworkList(ctx, types.NetworkListOptions{Filters: filters.NewArgs(filters.Arg("name", name))})
+	if err != nil {
+		return false, fmt.Errorf("failed to list networks: %v", err)
+	}
+	for _, n := range networks {
+		if n.Name == name {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// CreateNetwork creates a bridge network
+func (c *DockerClient) CreateNetwork(ctx context.Context, name string) error {
+	if _, err := c.api.NetworkCreate(ctx, name, types.NetworkCreate{Driver: "bridge"}); err != nil {
+		return fmt.Errorf("failed to create network %s: %v", name, err)
+	}
+	return nil
+}
+
+// NetworkContainers returns the names of the containers attached to a network
+func (c *DockerClient) NetworkContainers(ctx context.Context, name string) ([]string, error) {
+	resource, err := c.api.NetworkInspect(ctx, name, types.NetworkInspectOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to inspect network %s: %v", name, err)
+	}
+	var names []string
+	for _, endpoint := range resource.Containers {
+		names = append(names, endpoint.Name)
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// ConnectNetwork attaches a container to a network
+func (c *DockerClient) ConnectNetwork(ctx context.Context, name, containerName string) error {
+	if err := c.api.NetworkConnect(ctx, name, containerName, nil); err != nil {
+		return fmt.Errorf("failed to connect %s to network %s: %v", containerName, name, err)
+	}
+	return nil
+}
+
+// DisconnectNetwork detaches a container from a network
+func (c *DockerClient) DisconnectNetwork(ctx context.Context, name, containerName string) error {
+	if err := c.api.NetworkDisconnect(ctx, name, containerName, true); err != nil {
+		return fmt.Errorf("failed to disconnect %s from network %s: %v", containerName, name, err)
+	}
+	return nil
+}
+
+// PruneContainers removes the stopped containers of a compose project and returns the space
+// reclaimed
+func (c *DockerClient) PruneContainers(ctx context.Context, project string) (int, uint64, error) {
+	report, err := c.api.ContainersPrune(ctx, projectFilter(project))
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to prune containers: %v", err)
+	}
+	return len(report.ContainersDeleted), report.SpaceReclaimed, nil
+}
+
+// PruneVolumes removes the volumes of a compose project no container uses and returns the
+// space reclaimed
+func (c *DockerClient) PruneVolumes(ctx context.Context, project string) (int, uint64, error) {
+	// all=true also removes named volumes, which hold the data; only a project that no
+	// instance owns may be pruned this way
+	filter := projectFilter(project)
+	filter.Add("all", "true")
+	report, err := c.api.VolumesPrune(ctx, filter)
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to prune volumes: %v", err)
+	}
+	return len(report.VolumesDeleted), report.SpaceReclaimed, nil
+}
+
+// FormatPorts renders published ports the way docker ps does, e.g. 0.0.0.0:8080->8080/tcp
+func FormatPorts(ports []types.Port) string {
+	var parts []string
+	seen := make(map[string]bool)
+	for _, p := range ports {
+		var part string
+		if p.PublicPort != 0 {
+			part = fmt.Sprintf("%s:%d->%d/%s", p.IP, p.PublicPort, p.PrivatePort, p.Type)
+		} else {
+			part = fmt.Sprintf("%d/%s", p.PrivatePort, p.Type)
+		}
+		if !seen[part] {
+			seen[part] = true
+			parts = append(parts, part)
+		}
+	}
+	sort.Strings(parts)
+	return strings.Join(parts, ", ")
+}
+
+// StartContainer starts a container by name using the shared Docker client
+func StartContainer(name string) error {
+	docker, err := GetDockerClient()
+	if err != nil {
+		return err
+	}
+	return docker.StartContainer(context.Background(), name)
+}
+
+// StopContainer stops a container by name using the shared Docker client
+func StopContainer(name string) error {
+	docker, err := GetDockerClient()
+	if err != nil {
+		return err
+	}
+	return docker.StopContainer(context.Background(), name)
+}
+
+// StopProject stops every running container of a compose project
+func (c *DockerClient) StopProject(ctx context.Context, project string) error {
+	containers, err := c.ListContainers(ctx, false, projectFilter(project))
+	if err != nil {
+		return err
+	}
+	for _, container := range containers {
+		if err := c.StopContainer(ctx, container.ID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// StartProject starts every stopped container of a compose project
+func (c *DockerClient) StartProject(ctx context.Context, project string) error {
+	containers, err := c.ProjectContainers(ctx, project)
+	if err != nil {
+		return err
+	}
+	for _, container := range containers {
+		if container.State == "running" {
+			continue
+		}
+		if err := c.StartContainer(ctx, container.ID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// RemoveProject removes the containers, networks and named volumes of a compose project.
+// It is used as a fallback when docker-compose down fails, so it keeps going after errors
+// and returns the first one.
+func (c *DockerClient) RemoveProject(ctx context.Context, project string) error {
+	firstErr := c.RemoveProjectContainers(ctx, project)
+
+	volumes, err := c.ListVolumes(ctx, project+"_")
+	if err != nil && firstErr == nil {
+		firstErr = err
+	}
+	for _, volume := range volumes {
+		if err := c.RemoveVolume(ctx, volume); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+
+	return firstErr
+}
+
+// RemoveProjectContainers removes the containers and networks of a compose project but keeps
+// its named volumes. Like RemoveProject it keeps going after errors and returns the first one.
+func (c *DockerClient) RemoveProjectContainers(ctx context.Context, project string) error {
+	var firstErr error
+	record := func(err error) {
+		if err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+
+	containers, err := c.ProjectContainers(ctx, project)
+	record(err)
+	for _, container := range containers {
+		record(c.RemoveContainer(ctx, container.ID))
+	}
+
+	networks, err := c.ProjectNetworks(ctx, project)
+	record(err)
+	for _, network := range networks {
+		record(c.RemoveNetwork(ctx, network))
+	}
+
+	return firstErr
+}
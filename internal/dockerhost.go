@@ -0,0 +1,171 @@
+package internal
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// SetDockerTarget points the Engine API client, docker and docker compose at another Docker
+// engine, given either a host URL (tcp:// or ssh://) or the name of a docker context.
+// It must be called before the first Docker call of the process.
+func SetDockerTarget(host, contextName string) error {
+	if host != "" && contextName != "" {
+		return fmt.Errorf("--host and --context cannot be used together")
+	}
+
+	if contextName != "" {
+		output, err := Command("docker", "context", "inspect", contextName, "--format", "{{.Endpoints.docker.Host}}").Output()
+		if err != nil {
+			return fmt.Errorf("failed to resolve docker context '%s': %v", contextName, err)
+		}
+		host = strings.TrimSpace(string(output))
+	}
+
+	if host == "" {
+		return nil
+	}
+
+	parsed, err := url.Parse(host)
+	if err != nil || parsed.Scheme == "" {
+		return fmt.Errorf("invalid docker host '%s': expected e.g. ssh://user@host or tcp://host:2376", host)
+	}
+
+	// Child docker and compose processes inherit the target through the environment,
+	// and DOCKER_HOST takes precedence over any context selected in the docker config
+	os.Unsetenv("DOCKER_CONTEXT")
+	return os.Setenv("DOCKER_HOST", host)
+}
+
+// DockerHostAddress returns the hostname under which ports published by the Docker engine are reachable
+func DockerHostAddress() string {
+	host := os.Getenv("DOCKER_HOST")
+	if host == "" {
+		return "localhost"
+	}
+
+	parsed, err := url.Parse(host)
+	if err != nil {
+		return "localhost"
+	}
+
+	switch parsed.Scheme {
+	case "tcp", "ssh", "http", "https":
+		if hostname := parsed.Hostname(); hostname != "" {
+			return hostname
+		}
+	}
+	return "localhost"
+}
+
+// IsRemoteDocker reports whether the Docker engine runs on another machine
+func IsRemoteDocker() bool {
+	address := DockerHostAddress()
+	if address == "localhost" {
+		return false
+	}
+	if ip := net.ParseIP(address); ip != nil && ip.IsLoopback() {
+		return false
+	}
+	return true
+}
+
+// isRemotePortInUse checks a port on a remote Docker host. Ports published by containers are
+// read from the engine; other listeners are detected by trying to connect.
+func isRemotePortInUse(port int) bool {
+	if docker, err := GetDockerClient(); err == nil {
+		if containers, err := docker.ListContainers(context.Background(), false, emptyFilter()); err == nil {
+			for _, container := range containers {
+				for _, published := range container.Ports {
+					if int(published.PublicPort) == port {
+						return true
+					}
+				}
+			}
+		}
+	}
+
+	conn, err := net.DialTimeout("tcp", net.JoinHostPort(DockerHostAddress(), fmt.Sprintf("%d", port)), time.Second)
+	if err != nil {
+		return false
+	}
+	conn.Close()
+	return true
+}
+
+// sshDialer connects to the Docker engine of an ssh:// host through `docker system dial-stdio`,
+// the same mechanism the docker CLI uses
+func sshDialer(host string) (func(ctx context.Context, network, addr string) (net.Conn, error), error) {
+	parsed, err := url.Parse(host)
+	if err != nil {
+		return nil, fmt.Errorf("invalid docker host '%s': %v", host, err)
+	}
+
+	args := []string{"-o", "ConnectTimeout=30"}
+	if parsed.User != nil {
+		args = append(args, "-l", parsed.User.Username())
+	}
+	if port := parsed.Port(); port != "" {
+		args = append(args, "-p", port)
+	}
+	args = append(args, "--", parsed.Hostname(), "docker", "system", "dial-stdio")
+
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		cmd := CommandContext(ctx, "ssh", args...)
+		cmd.Stderr = os.Stderr
+
+		stdin, err := cmd.StdinPipe()
+		if err != nil {
+			return nil, err
+		}
+		stdout, err := cmd.StdoutPipe()
+		if err != nil {
+			return nil, err
+		}
+		if err := cmd.Start(); err != nil {
+			return nil, fmt.Errorf("failed to start ssh: %v", err)
+		}
+
+		return &commandConn{cmd: cmd, stdin: stdin, stdout: stdout, host: parsed.Hostname()}, nil
+	}, nil
+}
+
+// commandConn is a net.Conn over the standard input and output of a process
+type commandConn struct {
+	cmd    *exec.Cmd
+	stdin  io.WriteCloser
+	stdout io.ReadCloser
+	host   string
+}
+
+func (c *commandConn) Read(p []byte) (int, error)  { return c.stdout.Read(p) }
+func (c *commandConn) Write(p []byte) (int, error) { return c.stdin.Write(p) }
+
+func (c *commandConn) Close() error {
+	c.stdin.Close()
+	c.stdout.Close()
+	if c.cmd.Process != nil {
+		c.cmd.Process.Kill()
+	}
+	c.cmd.Wait()
+	return nil
+}
+
+func (c *commandConn) LocalAddr() net.Addr  { return commandAddr("local") }
+func (c *commandConn) RemoteAddr() net.Addr { return commandAddr(c.host) }
+
+// Deadlines are not supported on pipes; the HTTP client enforces its own timeouts
+func (c *commandConn) SetDeadline(t time.Time) error      { return nil }
+func (c *commandConn) SetReadDeadline(t time.Time) error  { return nil }
+func (c *commandConn) SetWriteDeadline(t time.Time) error { return nil }
+
+type commandAddr string
+
+func (a commandAddr) Network() string { return "ssh" }
+func (a commandAddr) String() string  { return string(a) }
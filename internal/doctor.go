@@ -0,0 +1,231 @@
+package internal
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Check statuses reported by the doctor command
+const (
+	CheckPass = "pass"
+	CheckWarn = "warn"
+	CheckFail = "fail"
+)
+
+// MinFreeDiskSpace is the free space below which doctor fails; images and volumes of a
+// single instance routinely take several gigabytes
+const MinFreeDiskSpace = 10 * 1000 * 1000 * 1000
+
+// CheckResult is the outcome of one environment preflight check
+type CheckResult struct {
+	Name   string `json:"name" yaml:"name"`
+	Status string `json:"status" yaml:"status"`
+	Detail string `json:"detail" yaml:"detail"`
+	Hint   string `json:"hint,omitempty" yaml:"hint,omitempty"`
+}
+
+// RunPreflightChecks verifies that this machine can deploy GraphSense instances
+func RunPreflightChecks() []CheckResult {
+	var results []CheckResult
+
+	dockerInstalled := checkDockerInstalled()
+	results = append(results, dockerInstalled)
+	if dockerInstalled.Status == CheckPass {
+		results = append(results, checkDockerRunning(), checkCompose())
+	}
+
+	results = append(results,
+		checkGraphsenseDir(),
+		checkAPIKeys(),
+		checkComposeTemplate(),
+		checkDiskSpace(),
+		checkLegacyDeployments(),
+	)
+
+	return results
+}
+
+func checkDockerInstalled() CheckResult {
+	result := CheckResult{Name: "docker installed"}
+	path, err := exec.LookPath("docker")
+	if err != nil {
+		result.Status = CheckFail
+		result.Detail = "docker not found in PATH"
+		result.Hint = "Install Docker: https://docs.docker.com/get-docker/"
+		return result
+	}
+	result.Status = CheckPass
+	result.Detail = path
+	return result
+}
+
+func checkDockerRunning() CheckResult {
+	result := CheckResult{Name: "docker daemon running"}
+	docker, err := GetDockerClient()
+	if err != nil {
+		result.Status = CheckFail
+		result.Detail = err.Error()
+		result.Hint = "Check that DOCKER_HOST and the other DOCKER_* environment variables are valid"
+		return result
+	}
+
+	version, err := docker.ServerVersion(context.Background())
+	if err != nil {
+		result.Status = CheckFail
+		result.Detail = err.Error()
+		result.Hint = "Start Docker Desktop or run 'sudo systemctl start docker', and make sure your user can access the docker socket"
+		return result
+	}
+	result.Status = CheckPass
+	result.Detail = "server version " + version
+	return result
+}
+
+func checkCompose() CheckResult {
+	result := CheckResult{Name: "docker compose"}
+
+	runner, err := DetectComposeRunner()
+	if err != nil {
+		result.Status = CheckFail
+		result.Detail = err.Error()
+		result.Hint = "Install Docker Compose: https://docs.docker.com/compose/install/"
+		return result
+	}
+
+	result.Status = CheckPass
+	result.Detail = "using " + runner.String()
+	if !runner.V2 {
+		result.Status = CheckWarn
+		result.Hint = "Compose v1 is end-of-life; install the docker compose plugin"
+	}
+
+	return result
+}
+
+func checkGraphsenseDir() CheckResult {
+	result := CheckResult{Name: "~/.graphsense permissions"}
+
+	graphsenseDir, err := GetGraphsenseDir()
+	if err != nil {
+		result.Status = CheckFail
+		result.Detail = err.Error()
+		result.Hint = "Make sure your home directory is writable"
+		return result
+	}
+
+	probe, err := os.CreateTemp(graphsenseDir, ".doctor-*")
+	if err != nil {
+		result.Status = CheckFail
+		result.Detail = fmt.Sprintf("%s is not writable: %v", graphsenseDir, err)
+		result.Hint = fmt.Sprintf("Run 'sudo chown -R $(id -u) %s'", graphsenseDir)
+		return result
+	}
+	probe.Close()
+	os.Remove(probe.Name())
+
+	result.Status = CheckPass
+	result.Detail = graphsenseDir + " is writable"
+	return result
+}
+
+func checkAPIKeys() CheckResult {
+	result := CheckResult{Name: "API keys"}
+
+	coAPIKey, anthropicAPIKey, err := LoadAPIKeys()
+	if err != nil {
+		result.Status = CheckFail
+		result.Detail = err.Error()
+		result.Hint = "Store them with 'graphsense-cli keys set CO_API_KEY' and 'graphsense-cli keys set ANTHROPIC_API_KEY'"
+		return result
+	}
+
+	var problems []string
+	for name, value := range map[string]string{CoAPIKeyName: coAPIKey, AnthropicAPIKeyName: anthropicAPIKey} {
+		if err := CheckAPIKeyFormat(name, value); err != nil {
+			problems = append(problems, err.Error())
+		}
+	}
+	if len(problems) > 0 {
+		sort.Strings(problems)
+		result.Status = CheckFail
+		result.Detail = strings.Join(problems, "; ")
+		result.Hint = "Store valid keys with 'graphsense-cli keys set <key>'"
+		return result
+	}
+
+	result.Status = CheckPass
+	result.Detail = "CO_API_KEY and ANTHROPIC_API_KEY set; run 'graphsense-cli keys validate' to check them with the providers"
+	return result
+}
+
+func checkLegacyDeployments() CheckResult {
+	result := CheckResult{Name: "legacy deployments"}
+	artifacts, err := FindLegacyArtifacts()
+	if err != nil {
+		result.Status = CheckWarn
+		result.Detail = fmt.Sprintf("could not look for legacy deployments: %v", err)
+		return result
+	}
+	if len(artifacts) > 0 {
+		names := make([]string, len(artifacts))
+		for i, artifact := range artifacts {
+			names[i] = filepath.Base(artifact.Name)
+		}
+		result.Status = CheckWarn
+		result.Detail = "found " + strings.Join(names, ", ")
+		result.Hint = "Run 'graphsense-cli migrate-legacy' to manage them with graphsense-cli"
+		return result
+	}
+	result.Status = CheckPass
+	result.Detail = "none found"
+	return result
+}
+
+func checkComposeTemplate() CheckResult {
+	result := CheckResult{Name: "compose template"}
+
+	composeFile, err := GetComposeFile()
+	if err != nil {
+		result.Status = CheckFail
+		result.Detail = err.Error()
+		result.Hint = "Clone the GraphSense application repository to ~/oss/code-graph-rag"
+		return result
+	}
+
+	result.Status = CheckPass
+	result.Detail = composeFile
+	return result
+}
+
+func checkDiskSpace() CheckResult {
+	result := CheckResult{Name: "free disk space"}
+
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		result.Status = CheckWarn
+		result.Detail = err.Error()
+		return result
+	}
+
+	free, err := FreeDiskSpace(filepath.Clean(homeDir))
+	if err != nil {
+		result.Status = CheckWarn
+		result.Detail = fmt.Sprintf("could not determine free space: %v", err)
+		return result
+	}
+
+	result.Detail = fmt.Sprintf("%s available", FormatSize(int64(free)))
+	if free < MinFreeDiskSpace {
+		result.Status = CheckFail
+		result.Hint = fmt.Sprintf("Free up at least %s, e.g. with 'graphsense-cli cleanup' or 'docker system prune'", FormatSize(MinFreeDiskSpace))
+		return result
+	}
+
+	result.Status = CheckPass
+	return result
+}
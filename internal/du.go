@@ -0,0 +1,74 @@
+package internal
+
+import (
+	"context"
+	"sort"
+	"strings"
+)
+
+// Kinds of disk usage items
+const (
+	DiskItemVolume    = "volume"
+	DiskItemContainer = "container"
+)
+
+// DiskItem is a volume or container writable layer and the space it uses
+type DiskItem struct {
+	Name string `json:"name" yaml:"name"`
+	Kind string `json:"kind" yaml:"kind"`
+	Size int64  `json:"size" yaml:"size"`
+}
+
+// InstanceDiskUsage is the space used by an instance, largest items first
+type InstanceDiskUsage struct {
+	Instance string     `json:"instance" yaml:"instance"`
+	Total    int64      `json:"total" yaml:"total"`
+	Items    []DiskItem `json:"items" yaml:"items"`
+}
+
+// GetDiskUsageReport returns the disk usage of each of the given instances, counting their
+// named volumes and the writable layers of their containers, largest instance first
+func GetDiskUsageReport(instanceNames []string) ([]InstanceDiskUsage, error) {
+	docker, err := GetDockerClient()
+	if err != nil {
+		return nil, err
+	}
+
+	volumeSizes, err := docker.VolumeSizes(context.Background())
+	if err != nil {
+		return nil, err
+	}
+	layerSizes, err := docker.ContainerLayerSizes(context.Background())
+	if err != nil {
+		return nil, err
+	}
+
+	report := make([]InstanceDiskUsage, 0, len(instanceNames))
+	for _, name := range instanceNames {
+		usage := InstanceDiskUsage{Instance: name, Items: []DiskItem{}}
+		for volume, size := range volumeSizes {
+			if strings.HasPrefix(volume, name+"_") {
+				usage.Items = append(usage.Items, DiskItem{Name: volume, Kind: DiskItemVolume, Size: size})
+			}
+		}
+		for container, size := range layerSizes[name] {
+			usage.Items = append(usage.Items, DiskItem{Name: container, Kind: DiskItemContainer, Size: size})
+		}
+
+		sort.Slice(usage.Items, func(i, j int) bool {
+			if usage.Items[i].Size == usage.Items[j].Size {
+				return usage.Items[i].Name < usage.Items[j].Name
+			}
+			return usage.Items[i].Size > usage.Items[j].Size
+		})
+		for _, item := range usage.Items {
+			usage.Total += item.Size
+		}
+		report = append(report, usage)
+	}
+
+	sort.SliceStable(report, func(i, j int) bool {
+		return report[i].Total > report[j].Total
+	})
+	return report, nil
+}
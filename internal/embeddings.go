@@ -0,0 +1,118 @@
+package internal
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// LocalEmbeddingPrefix marks an --embedding-model served from inside the instance
+const LocalEmbeddingPrefix = "local:"
+
+// EmbeddingServerImage is the text-embeddings-inference image serving local models
+const EmbeddingServerImage = "ghcr.io/huggingface/text-embeddings-inference:cpu-1.5"
+
+// embeddingModelMount is where a model directory from the host is mounted in the embedding server
+const embeddingModelMount = "/model"
+
+// LocalEmbeddingModel is an embedding model served by a container of the instance itself
+type LocalEmbeddingModel struct {
+	// Path is the model directory on the Docker host, empty for models referenced by name
+	Path string
+	// Name is the Hugging Face model id, empty for models loaded from Path
+	Name string
+}
+
+// ParseEmbeddingModel parses an --embedding-model value of the form local:<path-or-name>.
+// Values that look like a path, or name an existing directory, are mounted into the
+// embedding server; anything else is a model id downloaded once into an instance volume.
+func ParseEmbeddingModel(spec string) (*LocalEmbeddingModel, error) {
+	if !strings.HasPrefix(spec, LocalEmbeddingPrefix) {
+		return nil, fmt.Errorf("unsupported embedding model '%s': expected local:<path-or-name>", spec)
+	}
+
+	value := strings.TrimPrefix(spec, LocalEmbeddingPrefix)
+	if value == "" {
+		return nil, fmt.Errorf("embedding model '%s' does not name a model", spec)
+	}
+
+	isPath := filepath.IsAbs(value) || strings.HasPrefix(value, ".")
+	if info, err := os.Stat(value); err == nil && info.IsDir() {
+		isPath = true
+	}
+	if !isPath {
+		return &LocalEmbeddingModel{Name: value}, nil
+	}
+
+	path, err := filepath.Abs(value)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve embedding model path: %v", err)
+	}
+
+	// A remote engine mounts the path from its own filesystem, which cannot be checked from here
+	if !IsRemoteDocker() {
+		info, err := os.Stat(path)
+		if err != nil {
+			return nil, fmt.Errorf("embedding model directory not found: %s", path)
+		}
+		if !info.IsDir() {
+			return nil, fmt.Errorf("embedding model path is not a directory: %s", path)
+		}
+	}
+
+	return &LocalEmbeddingModel{Path: path}, nil
+}
+
+// String returns the model in --embedding-model form
+func (m *LocalEmbeddingModel) String() string {
+	if m.Path != "" {
+		return LocalEmbeddingPrefix + m.Path
+	}
+	return LocalEmbeddingPrefix + m.Name
+}
+
+// ModelID returns the --model-id passed to the embedding server
+func (m *LocalEmbeddingModel) ModelID() string {
+	if m.Path != "" {
+		return embeddingModelMount
+	}
+	return m.Name
+}
+
+// Image returns the image of the embedding server
+func (m *LocalEmbeddingModel) Image() string {
+	return EmbeddingServerImage
+}
+
+// LocalEmbeddings returns the local embedding model of the instance, or nil if it embeds through the Cohere API
+func (c *DeployConfig) LocalEmbeddings() *LocalEmbeddingModel {
+	if !strings.HasPrefix(c.EmbeddingModel, LocalEmbeddingPrefix) {
+		return nil
+	}
+
+	// Recorded models are already resolved to an absolute path or a model id
+	value := strings.TrimPrefix(c.EmbeddingModel, LocalEmbeddingPrefix)
+	if filepath.IsAbs(value) {
+		return &LocalEmbeddingModel{Path: value}
+	}
+	return &LocalEmbeddingModel{Name: value}
+}
+
+// ProbeEmbeddings checks that an instance's embedding server container is running
+func ProbeEmbeddings(instanceName string) error {
+	docker, err := GetDockerClient()
+	if err != nil {
+		return err
+	}
+
+	info, err := docker.InspectContainer(context.Background(), instanceName+"-embeddings")
+	if err != nil {
+		return err
+	}
+	if info.State == nil || !info.State.Running {
+		return fmt.Errorf("container is not running")
+	}
+	return nil
+}
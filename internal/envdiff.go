@@ -0,0 +1,317 @@
+package internal
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/nicksnyder/go-i18n/v2/i18n"
+	"gopkg.in/yaml.v3"
+)
+
+// ServiceConfig is the image and environment of one service of an instance
+type ServiceConfig struct {
+	Image string
+	Env   map[string]string
+}
+
+// ConfigChange is one difference between the running and the effective configuration of a service
+type ConfigChange struct {
+	Service string
+	Key     string
+	Old     string
+	New     string
+}
+
+// Added reports whether the change introduces a new key
+func (c ConfigChange) Added() bool {
+	return c.Old == "" && c.New != ""
+}
+
+// Removed reports whether the change drops a key
+func (c ConfigChange) Removed() bool {
+	return c.Old != "" && c.New == ""
+}
+
+// imageKey is the ConfigChange key used for image changes
+const imageKey = "image"
+
+// EffectiveComposeConfig returns the service configurations compose would apply for files
+func EffectiveComposeConfig(files *ComposeFiles, envVars map[string]string) (map[string]ServiceConfig, error) {
+	output, err := DockerComposeOutput(files.Args("config"), files.Env(envVars))
+	if err != nil {
+		return nil, fmt.Errorf("failed to render compose configuration: %v", err)
+	}
+
+	var rendered struct {
+		Services map[string]struct {
+			Image       string    `yaml:"image"`
+			Environment yaml.Node `yaml:"environment"`
+		} `yaml:"services"`
+	}
+	if err := yaml.Unmarshal(output, &rendered); err != nil {
+		return nil, fmt.Errorf("failed to parse compose configuration: %v", err)
+	}
+
+	configs := make(map[string]ServiceConfig)
+	for name, service := range rendered.Services {
+		env, err := composeEnvironment(&service.Environment)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse environment of %s: %v", name, err)
+		}
+		configs[name] = ServiceConfig{Image: service.Image, Env: env}
+	}
+	return configs, nil
+}
+
+// composeEnvironment reads a compose environment given either as a mapping or as a KEY=VALUE list
+func composeEnvironment(node *yaml.Node) (map[string]string, error) {
+	env := make(map[string]string)
+	switch node.Kind {
+	case 0:
+		return env, nil
+	case yaml.MappingNode:
+		var values map[string]*string
+		if err := node.Decode(&values); err != nil {
+			return nil, err
+		}
+		for key, value := range values {
+			if value != nil {
+				env[key] = *value
+			} else {
+				env[key] = ""
+			}
+		}
+	default:
+		var values []string
+		if err := node.Decode(&values); err != nil {
+			return nil, err
+		}
+		for _, value := range values {
+			key, val, _ := strings.Cut(value, "=")
+			env[key] = val
+		}
+	}
+	return env, nil
+}
+
+// EffectiveSingleConfig returns the configuration RunSingleContainer would apply
+func EffectiveSingleConfig(config *DeployConfig) (map[string]ServiceConfig, error) {
+	envFile, err := CreateTempEnvFile(config)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create environment file: %v", err)
+	}
+	defer os.Remove(envFile)
+
+	env, err := readEnvFile(envFile)
+	if err != nil {
+		return nil, err
+	}
+
+	secrets, err := config.SecretEnv()
+	if err != nil {
+		return nil, err
+	}
+
+	// Mirror the -e flags of SingleContainerRunArgs
+	args := SingleContainerRunArgs(config, envFile)
+	for i := 0; i < len(args)-1; i++ {
+		if args[i] == "-e" {
+			key, value, ok := strings.Cut(args[i+1], "=")
+			if !ok {
+				// A bare name is taken from the environment of docker run
+				value = secrets[key]
+			}
+			env[key] = value
+		}
+	}
+
+	return map[string]ServiceConfig{
+		"app": {Image: SingleContainerImage(config), Env: env},
+	}, nil
+}
+
+// readEnvFile reads the KEY=VALUE lines of an environment file
+func readEnvFile(path string) (map[string]string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	env := make(map[string]string)
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if key, value, ok := strings.Cut(line, "="); ok {
+			env[key] = value
+		}
+	}
+	return env, scanner.Err()
+}
+
+// RunningConfig returns the configuration of an instance's containers as they run now.
+// Variables the image sets by default are left out, as they are not part of the instance configuration.
+func RunningConfig(instanceName string) (map[string]ServiceConfig, error) {
+	docker, err := GetDockerClient()
+	if err != nil {
+		return nil, err
+	}
+	ctx := context.Background()
+
+	containers, err := docker.ProjectContainers(ctx, instanceName)
+	if err != nil {
+		return nil, err
+	}
+
+	configs := make(map[string]ServiceConfig)
+	for _, c := range containers {
+		info, err := docker.InspectContainer(ctx, c.ID)
+		if err != nil {
+			return nil, err
+		}
+		if info.Config == nil {
+			continue
+		}
+
+		defaults := make(map[string]bool)
+		if imageEnv, err := docker.ImageEnv(ctx, info.Image); err == nil {
+			for _, entry := range imageEnv {
+				defaults[entry] = true
+			}
+		}
+
+		env := make(map[string]string)
+		for _, entry := range info.Config.Env {
+			if defaults[entry] {
+				continue
+			}
+			key, value, _ := strings.Cut(entry, "=")
+			env[key] = value
+		}
+
+		service := info.Config.Labels[ComposeServiceLabel]
+		configs[service] = ServiceConfig{Image: info.Config.Image, Env: env}
+	}
+	return configs, nil
+}
+
+// DiffConfigs lists the differences between running and effective service configurations,
+// ordered by service and key. Services that are not running yet show up as all additions.
+func DiffConfigs(running, effective map[string]ServiceConfig) []ConfigChange {
+	var changes []ConfigChange
+
+	services := make(map[string]bool)
+	for name := range running {
+		services[name] = true
+	}
+	for name := range effective {
+		services[name] = true
+	}
+
+	for service := range services {
+		before, after := running[service], effective[service]
+
+		// Compose leaves the image out of the rendered config when the base file builds it
+		if after.Image != "" && before.Image != after.Image {
+			changes = append(changes, ConfigChange{Service: service, Key: imageKey, Old: before.Image, New: after.Image})
+		}
+
+		keys := make(map[string]bool)
+		for key := range before.Env {
+			keys[key] = true
+		}
+		for key := range after.Env {
+			keys[key] = true
+		}
+		for key := range keys {
+			// An unset variable and an empty one behave the same
+			if before.Env[key] == after.Env[key] {
+				continue
+			}
+			changes = append(changes, ConfigChange{Service: service, Key: key, Old: before.Env[key], New: after.Env[key]})
+		}
+	}
+
+	sort.Slice(changes, func(i, j int) bool {
+		if changes[i].Service != changes[j].Service {
+			return changes[i].Service < changes[j].Service
+		}
+		if (changes[i].Key == imageKey) != (changes[j].Key == imageKey) {
+			return changes[i].Key == imageKey
+		}
+		return changes[i].Key < changes[j].Key
+	})
+	return changes
+}
+
+// secretKeyMarkers identify environment variables whose values are never printed
+var secretKeyMarkers = []string{"KEY", "PASSWORD", "SECRET", "TOKEN", "AUTH"}
+
+// displayValue returns value for printing, masked if key holds a secret. Passwords in
+// connection URLs such as POSTGRES_URL are masked as well.
+func displayValue(key, value string) string {
+	for _, marker := range secretKeyMarkers {
+		if strings.Contains(strings.ToUpper(key), marker) {
+			return "********"
+		}
+	}
+	if u, err := url.Parse(value); err == nil && u.User != nil {
+		if _, ok := u.User.Password(); ok {
+			return u.Redacted()
+		}
+	}
+	return value
+}
+
+// FormatConfigDiff renders changes as a colored diff grouped by service
+func FormatConfigDiff(changes []ConfigChange) string {
+	var b strings.Builder
+	service := ""
+	for _, change := range changes {
+		if change.Service != service {
+			service = change.Service
+			fmt.Fprintf(&b, "%s:\n", service)
+		}
+
+		before, after := displayValue(change.Key, change.Old), displayValue(change.Key, change.New)
+		switch {
+		case change.Added():
+			fmt.Fprintln(&b, Colorize(ColorGreen, fmt.Sprintf("  + %s=%s", change.Key, after)))
+		case change.Removed():
+			fmt.Fprintln(&b, Colorize(ColorRed, fmt.Sprintf("  - %s=%s", change.Key, before)))
+		default:
+			if before == after {
+				// Both sides are masked secrets
+				fmt.Fprintln(&b, Colorize(ColorYellow, Localize(&i18n.Message{ID: "ConfigDiffSecretChanged", Other: "  ~ {{.Key}} changed"}, map[string]any{"Key": change.Key})))
+			} else {
+				fmt.Fprintln(&b, Colorize(ColorYellow, fmt.Sprintf("  ~ %s: %s %s %s", change.Key, before, Arrow(), after)))
+			}
+		}
+	}
+	return b.String()
+}
+
+// EffectiveConfig returns the service configurations a deploy of config would apply now
+func EffectiveConfig(config *DeployConfig) (map[string]ServiceConfig, error) {
+	if config.IsSingleContainer() {
+		return EffectiveSingleConfig(config)
+	}
+
+	files, err := PrepareComposeFiles(config)
+	if err != nil {
+		return nil, err
+	}
+	defer files.Cleanup()
+
+	return EffectiveComposeConfig(files, map[string]string{
+		"COMPOSE_PROJECT_NAME": config.InstanceName,
+	})
+}
@@ -0,0 +1,84 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/docker/docker/api/types/filters"
+)
+
+// InstanceEventActions are the container events events streams: containers starting and
+// stopping, exiting and being killed for running out of memory
+var InstanceEventActions = []string{"start", "stop", "restart", "die", "oom"}
+
+// InstanceEvent is an event of a container of an instance
+type InstanceEvent struct {
+	Time      time.Time `json:"time"`
+	Instance  string    `json:"instance"`
+	Service   string    `json:"service"`
+	Container string    `json:"container"`
+	Action    string    `json:"action"`
+	// ExitCode is the exit code of a container that died
+	ExitCode *int `json:"exit_code,omitempty"`
+}
+
+// String describes the event on one line, e.g. "die (exit code 137)"
+func (e InstanceEvent) String() string {
+	if e.ExitCode != nil {
+		return fmt.Sprintf("%s (exit code %d)", e.Action, *e.ExitCode)
+	}
+	return e.Action
+}
+
+// StreamInstanceEvents calls handle with every event of the containers of an instance, or of
+// every instance if instanceName is empty, until ctx is done. since replays the events after
+// that time first; zero only streams new events.
+func StreamInstanceEvents(ctx context.Context, instanceName string, since time.Time, handle func(InstanceEvent)) error {
+	docker, err := GetDockerClient()
+	if err != nil {
+		return err
+	}
+
+	project := ComposeProjectLabel
+	if instanceName != "" {
+		project = ComposeProjectLabel + "=" + instanceName
+	}
+	filter := filters.NewArgs(filters.Arg("label", project))
+	for _, action := range InstanceEventActions {
+		filter.Add("event", action)
+	}
+	var sinceArg string
+	if !since.IsZero() {
+		sinceArg = strconv.FormatInt(since.Unix(), 10)
+	}
+
+	messages, errs := docker.ContainerEvents(ctx, filter, sinceArg)
+	for {
+		select {
+		case message := <-messages:
+			attributes := message.Actor.Attributes
+			if !isGraphsenseContainer(attributes["name"]) {
+				continue
+			}
+			event := InstanceEvent{
+				Time:      time.Unix(0, message.TimeNano),
+				Instance:  attributes[ComposeProjectLabel],
+				Service:   attributes[ComposeServiceLabel],
+				Container: attributes["name"],
+				Action:    string(message.Action),
+			}
+			if code, err := strconv.Atoi(attributes["exitCode"]); err == nil && event.Action == "die" {
+				event.ExitCode = &code
+			}
+			handle(event)
+		case err := <-errs:
+			if ctx.Err() != nil || errors.Is(err, context.Canceled) {
+				return nil
+			}
+			return fmt.Errorf("failed to stream Docker events: %v", err)
+		}
+	}
+}
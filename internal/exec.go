@@ -0,0 +1,65 @@
+package internal
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"sort"
+	"strings"
+)
+
+// Command returns an exec.Cmd for name and args, echoing it at debug level
+func Command(name string, args ...string) *exec.Cmd {
+	cmd := exec.Command(name, args...)
+	logCommand(cmd, nil)
+	return cmd
+}
+
+// CommandContext is Command bound to ctx
+func CommandContext(ctx context.Context, name string, args ...string) *exec.Cmd {
+	cmd := exec.CommandContext(ctx, name, args...)
+	logCommand(cmd, nil)
+	return cmd
+}
+
+// CommandEnv is Command with env added to the inherited environment
+func CommandEnv(env map[string]string, name string, args ...string) *exec.Cmd {
+	cmd := exec.Command(name, args...)
+
+	overrides := make([]string, 0, len(env))
+	for key, value := range env {
+		overrides = append(overrides, fmt.Sprintf("%s=%s", key, value))
+	}
+	sort.Strings(overrides)
+	cmd.Env = append(os.Environ(), overrides...)
+
+	logCommand(cmd, overrides)
+	return cmd
+}
+
+// logCommand writes the full command line and environment overrides of cmd at debug level
+func logCommand(cmd *exec.Cmd, overrides []string) {
+	args := []any{"command", shellQuote(cmd.Args)}
+	if len(overrides) > 0 {
+		masked := make([]string, len(overrides))
+		for i, override := range overrides {
+			key, value, _ := strings.Cut(override, "=")
+			masked[i] = key + "=" + displayValue(key, value)
+		}
+		args = append(args, "env", strings.Join(masked, " "))
+	}
+	Log.Debug("exec", args...)
+}
+
+// shellQuote joins args into a command line, quoting the ones a shell would split or expand
+func shellQuote(args []string) string {
+	quoted := make([]string, len(args))
+	for i, arg := range args {
+		if arg == "" || strings.ContainsAny(arg, " \t\n'\"\\$`|&;<>(){}*?[]#~") {
+			arg = "'" + strings.ReplaceAll(arg, "'", `'\''`) + "'"
+		}
+		quoted[i] = arg
+	}
+	return strings.Join(quoted, " ")
+}
@@ -0,0 +1,161 @@
+package internal
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"strings"
+	"sync"
+)
+
+// DefaultGatewayPort is the port gateway start listens on unless --port is given
+const DefaultGatewayPort = 8000
+
+// gatewayPathPrefix is the path below which the gateway serves instances, /i/<instance>/...
+const gatewayPathPrefix = "/i/"
+
+// GatewayPath returns the path the gateway serves an instance's MCP endpoint at
+func GatewayPath(instanceName string) string {
+	return gatewayPathPrefix + instanceName + "/"
+}
+
+// GatewayRoute is an instance the gateway serves and the address of its app
+type GatewayRoute struct {
+	Instance string `json:"instance"`
+	Path     string `json:"path"`
+	Upstream string `json:"upstream"`
+}
+
+// Gateway is an HTTP reverse proxy serving the app of every instance below /i/<instance>/ on
+// one port. Instances are looked up on every request, so instances deployed, renamed or given
+// new ports after the gateway started are served without restarting it.
+type Gateway struct {
+	// recorder records the requests proxied to every instance in the access log
+	recorder *AccessRecorder
+
+	mu sync.Mutex
+	// proxies holds the reverse proxy of each instance served so far, by instance name
+	proxies map[string]*gatewayProxy
+}
+
+// gatewayProxy forwards requests to the app of one instance
+type gatewayProxy struct {
+	upstream string
+	handler  http.Handler
+}
+
+// NewGateway returns a gateway serving every deployed instance. Close it once it stopped
+// serving to record the last requests.
+func NewGateway() (*Gateway, error) {
+	recorder, err := NewAccessRecorder()
+	if err != nil {
+		return nil, err
+	}
+	return &Gateway{recorder: recorder, proxies: make(map[string]*gatewayProxy)}, nil
+}
+
+// Close writes the requests still waiting to be recorded in the access log
+func (g *Gateway) Close() error {
+	return g.recorder.Close()
+}
+
+// GatewayRoutes returns the routes of every deployed instance
+func GatewayRoutes() ([]GatewayRoute, error) {
+	names, err := GetInstanceNames()
+	if err != nil {
+		return nil, err
+	}
+	routes := []GatewayRoute{}
+	for _, name := range names {
+		config, status, err := GetDeployment(name)
+		if err != nil {
+			return nil, err
+		}
+		if config == nil || status != DeployStatusComplete {
+			continue
+		}
+		routes = append(routes, GatewayRoute{Instance: name, Path: GatewayPath(name), Upstream: config.AppURL()})
+	}
+	return routes, nil
+}
+
+func (g *Gateway) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if req.URL.Path == "/" {
+		routes, err := GatewayRoutes()
+		if err != nil {
+			gatewayError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		writeGatewayJSON(w, http.StatusOK, routes)
+		return
+	}
+	if !strings.HasPrefix(req.URL.Path, gatewayPathPrefix) {
+		gatewayError(w, http.StatusNotFound, fmt.Sprintf("not found; instances are served at %s<instance>/", gatewayPathPrefix))
+		return
+	}
+
+	instanceName, rest, _ := strings.Cut(strings.TrimPrefix(req.URL.Path, gatewayPathPrefix), "/")
+	config, status, err := GetDeployment(instanceName)
+	if err != nil {
+		gatewayError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if config == nil || status != DeployStatusComplete {
+		gatewayError(w, http.StatusNotFound, fmt.Sprintf("instance '%s' does not exist", instanceName))
+		return
+	}
+
+	// The app serves the instance at its root
+	req.URL.Path = "/" + rest
+	req.URL.RawPath = ""
+	g.proxy(config).ServeHTTP(w, req)
+}
+
+// proxy returns the reverse proxy of an instance, replacing it when the instance's app moved
+// to another address
+func (g *Gateway) proxy(config *DeployConfig) http.Handler {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	upstream := config.AppURL()
+	if proxy, ok := g.proxies[config.InstanceName]; ok && proxy.upstream == upstream {
+		return proxy.handler
+	}
+
+	target, _ := url.Parse(upstream)
+	instanceName := config.InstanceName
+	reverseProxy := &httputil.ReverseProxy{
+		Rewrite: func(r *httputil.ProxyRequest) {
+			r.SetURL(target)
+			r.SetXForwarded()
+			// Lets the app build links that lead back through the gateway
+			r.Out.Header.Set("X-Forwarded-Prefix", strings.TrimSuffix(GatewayPath(instanceName), "/"))
+		},
+		Transport: config.AppTransport(),
+		// MCP streams responses as server-sent events, which must not be buffered
+		FlushInterval: -1,
+		ErrorHandler: func(w http.ResponseWriter, r *http.Request, err error) {
+			Log.Debug("Gateway request failed", "instance", instanceName, "error", err)
+			gatewayError(w, http.StatusBadGateway, fmt.Sprintf("instance '%s' is not reachable at %s; is it running?", instanceName, upstream))
+		},
+	}
+	proxy := &gatewayProxy{upstream: upstream, handler: AccessLogHandler(g.recorder, instanceName, reverseProxy)}
+	g.proxies[instanceName] = proxy
+	return proxy.handler
+}
+
+// gatewayError writes an error response of the gateway
+func gatewayError(w http.ResponseWriter, status int, message string) {
+	writeGatewayJSON(w, status, map[string]string{"error": message})
+}
+
+// writeGatewayJSON writes a response of the gateway itself as JSON
+func writeGatewayJSON(w http.ResponseWriter, status int, value interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	encoder := json.NewEncoder(w)
+	encoder.SetEscapeHTML(false)
+	encoder.Encode(value)
+}
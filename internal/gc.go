@@ -0,0 +1,168 @@
+package internal
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Actions gc takes on instances that are due
+const (
+	GCStop   = "stop"
+	GCRemove = "remove"
+)
+
+// GCActions are the actions gc can take on instances that are due
+var GCActions = []string{GCStop, GCRemove}
+
+// gcActionsDone describe what was done to a collected instance, by action
+var gcActionsDone = map[string]string{GCStop: "stopped", GCRemove: "removed"}
+
+// Reasons instances are collected
+const (
+	// GCExpired instances were deployed with a TTL that ran out
+	GCExpired = "expired"
+	// GCUnused instances were not used for the unused_for setting
+	GCUnused = "unused"
+)
+
+// DefaultGCWarning is how long before an instance is due gc starts listing it
+const DefaultGCWarning = 24 * time.Hour
+
+// GCConfig is the gc section of the config file, deciding what gc and supervise do with
+// instances past their TTL or not used for long
+type GCConfig struct {
+	// UnusedFor collects instances not used for this long, e.g. 336h; empty only collects
+	// instances past their TTL
+	UnusedFor string `yaml:"unused_for"`
+	// Action is stop, the default, or remove
+	Action string `yaml:"action"`
+	// Warning is how long before an instance is due it is listed, 24h by default
+	Warning string `yaml:"warning"`
+}
+
+// GCPolicy decides which instances gc collects and what it does with them
+type GCPolicy struct {
+	UnusedFor time.Duration
+	Action    string
+	Warning   time.Duration
+}
+
+// Policy returns the policy the settings describe, filling in the defaults
+func (c GCConfig) Policy() (GCPolicy, error) {
+	policy := GCPolicy{Action: GCStop, Warning: DefaultGCWarning}
+	if c.Action != "" {
+		policy.Action = c.Action
+	}
+	if err := ValidateGCAction(policy.Action); err != nil {
+		return GCPolicy{}, fmt.Errorf("gc.action: %v", err)
+	}
+	var err error
+	if c.UnusedFor != "" {
+		if policy.UnusedFor, err = time.ParseDuration(c.UnusedFor); err != nil || policy.UnusedFor < 0 {
+			return GCPolicy{}, fmt.Errorf("gc.unused_for: invalid duration '%s', e.g. 336h", c.UnusedFor)
+		}
+	}
+	if c.Warning != "" {
+		if policy.Warning, err = time.ParseDuration(c.Warning); err != nil || policy.Warning < 0 {
+			return GCPolicy{}, fmt.Errorf("gc.warning: invalid duration '%s', e.g. 24h", c.Warning)
+		}
+	}
+	return policy, nil
+}
+
+// ValidateGCAction checks that action is stop or remove
+func ValidateGCAction(action string) error {
+	if _, ok := gcActionsDone[action]; !ok {
+		return fmt.Errorf("invalid action '%s': must be %s", action, strings.Join(GCActions, " or "))
+	}
+	return nil
+}
+
+// GCCandidate is an instance that is past its TTL or was not used for too long, or soon will be
+type GCCandidate struct {
+	Instance string `json:"instance" yaml:"instance"`
+	Reason   string `json:"reason" yaml:"reason"`
+	// DueAt is when the instance expires or reaches the unused limit
+	DueAt    time.Time `json:"due_at" yaml:"due_at"`
+	LastUsed time.Time `json:"last_used,omitempty" yaml:"last_used,omitempty"`
+}
+
+// Due reports whether the instance is to be collected at now
+func (c GCCandidate) Due(now time.Time) bool {
+	return !now.Before(c.DueAt)
+}
+
+// Describe explains why the instance is listed, e.g. "TTL expired 3h0m0s ago"
+func (c GCCandidate) Describe(now time.Time) string {
+	switch {
+	case c.Reason == GCExpired && c.Due(now):
+		return fmt.Sprintf("TTL expired %s ago", now.Sub(c.DueAt).Round(time.Minute))
+	case c.Reason == GCExpired:
+		return fmt.Sprintf("TTL expires in %s", c.DueAt.Sub(now).Round(time.Minute))
+	case c.Due(now):
+		return fmt.Sprintf("unused for %s", now.Sub(c.LastUsed).Round(time.Minute))
+	}
+	return fmt.Sprintf("unused for %s, due in %s", now.Sub(c.LastUsed).Round(time.Minute), c.DueAt.Sub(now).Round(time.Minute))
+}
+
+// FindGCCandidates returns the deployed instances that are due under the policy at now, or
+// will be within its warning period, ordered by when they are due. Instances that were never
+// used are left alone, and instances already stopped on purpose when the action is stop.
+func FindGCCandidates(policy GCPolicy, now time.Time) ([]GCCandidate, error) {
+	names, err := GetInstanceNames()
+	if err != nil {
+		return nil, err
+	}
+	lastUsed, err := GetLastUsed()
+	if err != nil {
+		return nil, err
+	}
+
+	var candidates []GCCandidate
+	for _, name := range names {
+		config, status, err := GetDeployment(name)
+		if err != nil {
+			return nil, err
+		}
+		if config == nil || status != DeployStatusComplete {
+			continue
+		}
+
+		var candidate *GCCandidate
+		if !config.ExpiresAt.IsZero() {
+			candidate = &GCCandidate{Instance: name, Reason: GCExpired, DueAt: config.ExpiresAt}
+		}
+		if usedAt, ok := lastUsed[name]; ok && policy.UnusedFor > 0 {
+			if due := usedAt.Add(policy.UnusedFor); candidate == nil || due.Before(candidate.DueAt) {
+				candidate = &GCCandidate{Instance: name, Reason: GCUnused, DueAt: due}
+			}
+		}
+		if candidate == nil || candidate.DueAt.After(now.Add(policy.Warning)) {
+			continue
+		}
+		candidate.LastUsed = lastUsed[name]
+
+		if policy.Action == GCStop {
+			stopped, err := InstanceStopped(name)
+			if err != nil {
+				return nil, err
+			}
+			if stopped {
+				continue
+			}
+		}
+		candidates = append(candidates, *candidate)
+	}
+
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return candidates[i].DueAt.Before(candidates[j].DueAt)
+	})
+	return candidates, nil
+}
+
+// GCActionDone describes what an action does to an instance, e.g. "stopped"
+func GCActionDone(action string) string {
+	return gcActionsDone[action]
+}
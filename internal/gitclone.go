@@ -0,0 +1,165 @@
+package internal
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// Git LFS fetch policies of a managed clone
+const (
+	// LFSFetch downloads the LFS objects of the checked out files
+	LFSFetch = "fetch"
+	// LFSSkip leaves LFS files as pointer files
+	LFSSkip = "skip"
+)
+
+// scpLikeURL matches the user@host:path form of SSH remotes
+var scpLikeURL = regexp.MustCompile(`^[A-Za-z0-9._-]+@[A-Za-z0-9.-]+:[^/]`)
+
+// CloneOptions controls how a repository deployed from a Git URL is cloned
+type CloneOptions struct {
+	// Depth truncates the history to that many commits; 0 clones all of it
+	Depth int
+	// Sparse limits the checkout to these directories
+	Sparse []string
+	// LFS is the Git LFS fetch policy, LFSFetch or LFSSkip
+	LFS string
+}
+
+// Validate checks the clone options for unsupported values
+func (o CloneOptions) Validate() error {
+	if o.Depth < 0 {
+		return fmt.Errorf("--depth must not be negative")
+	}
+	if o.LFS != LFSFetch && o.LFS != LFSSkip {
+		return fmt.Errorf("invalid LFS policy '%s': must be %s or %s", o.LFS, LFSFetch, LFSSkip)
+	}
+	for _, dir := range o.Sparse {
+		if filepath.IsAbs(dir) || strings.HasPrefix(filepath.Clean(dir), "..") {
+			return fmt.Errorf("sparse path '%s' must be relative to the repository root", dir)
+		}
+	}
+	return nil
+}
+
+// IsGitURL reports whether a deploy source is a remote repository rather than a local path
+func IsGitURL(source string) bool {
+	for _, scheme := range []string{"https://", "http://", "ssh://", "git://", "file://"} {
+		if strings.HasPrefix(source, scheme) {
+			return true
+		}
+	}
+	return scpLikeURL.MatchString(source)
+}
+
+// RepoNameFromURL returns the repository name of a Git URL, without any .git suffix
+func RepoNameFromURL(url string) string {
+	name := strings.TrimRight(url, "/")
+	if i := strings.LastIndexAny(name, "/:"); i >= 0 {
+		name = name[i+1:]
+	}
+	return strings.TrimSuffix(name, ".git")
+}
+
+// GetManagedRepoDir returns the directory of the clone managed for an instance
+func GetManagedRepoDir(instanceName string) (string, error) {
+	graphsenseDir, err := GetGraphsenseDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(graphsenseDir, "repos", instanceName), nil
+}
+
+// IsManagedRepo reports whether the repository of an instance is a clone managed by the CLI
+func (c *DeployConfig) IsManagedRepo() bool {
+	if c.RepoURL == "" {
+		return false
+	}
+	dir, err := GetManagedRepoDir(c.InstanceName)
+	return err == nil && dir == c.RepoPath
+}
+
+// CloneRepository clones url into dir. Sparse clones fetch only the blobs of the selected
+// directories, and LFS objects are fetched after the checkout so they are limited to it too.
+func CloneRepository(url, dir string, options CloneOptions) error {
+	if err := os.MkdirAll(filepath.Dir(dir), 0755); err != nil {
+		return fmt.Errorf("failed to create clone directory: %v", err)
+	}
+
+	args := []string{"clone"}
+	if options.Depth > 0 {
+		args = append(args, "--depth", fmt.Sprint(options.Depth))
+	}
+	if len(options.Sparse) > 0 {
+		args = append(args, "--filter=blob:none", "--sparse")
+	}
+	args = append(args, "--", url, dir)
+
+	// Without smudging, LFS files are checked out as pointers and fetched below, if at all
+	env := map[string]string{"GIT_LFS_SKIP_SMUDGE": "1"}
+	cmd := CommandEnv(env, "git", args...)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("failed to clone %s: %v", url, err)
+	}
+
+	if len(options.Sparse) > 0 {
+		cmd := CommandEnv(env, "git", append([]string{"-C", dir, "sparse-checkout", "set", "--"}, options.Sparse...)...)
+		cmd.Stdout = os.Stdout
+		cmd.Stderr = os.Stderr
+		if err := cmd.Run(); err != nil {
+			return fmt.Errorf("failed to set sparse checkout: %v", err)
+		}
+	}
+
+	if options.LFS == LFSFetch && usesLFS(dir) {
+		if err := Command("git", "lfs", "version").Run(); err != nil {
+			Log.Warning("Repository uses Git LFS but git-lfs is not installed; LFS files are left as pointers")
+			return nil
+		}
+		cmd := Command("git", "-C", dir, "lfs", "pull")
+		cmd.Stdout = os.Stdout
+		cmd.Stderr = os.Stderr
+		if err := cmd.Run(); err != nil {
+			return fmt.Errorf("failed to fetch LFS objects: %v", err)
+		}
+	}
+	return nil
+}
+
+// usesLFS reports whether the checkout tracks any files with Git LFS
+func usesLFS(dir string) bool {
+	data, err := os.ReadFile(filepath.Join(dir, ".gitattributes"))
+	return err == nil && strings.Contains(string(data), "filter=lfs")
+}
+
+// MoveManagedRepo moves the managed clone of an instance to the directory of newName
+func MoveManagedRepo(config *DeployConfig, newName string) error {
+	if !config.IsManagedRepo() {
+		return nil
+	}
+	dir, err := GetManagedRepoDir(newName)
+	if err != nil {
+		return err
+	}
+	if err := os.Rename(config.RepoPath, dir); err != nil {
+		return fmt.Errorf("failed to move clone %s: %v", config.RepoPath, err)
+	}
+	config.RepoPath = dir
+	return nil
+}
+
+// RemoveManagedRepo deletes the managed clone of an instance deployed from a Git URL
+func RemoveManagedRepo(config *DeployConfig) error {
+	if !config.IsManagedRepo() {
+		return nil
+	}
+	if err := os.RemoveAll(config.RepoPath); err != nil {
+		return fmt.Errorf("failed to remove clone %s: %v", config.RepoPath, err)
+	}
+	return nil
+}
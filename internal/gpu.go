@@ -0,0 +1,102 @@
+package internal
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// GPUAll gives a container every GPU of the Docker host, as deploy --gpu does without a value
+const GPUAll = "all"
+
+// gpuDevicePrefix selects GPUs by index or UUID, e.g. device=0,1
+const gpuDevicePrefix = "device="
+
+// GPURequest is the GPUs passed through to the app container: all of them, a number of them
+// or the devices with the given IDs
+type GPURequest struct {
+	Count     string
+	DeviceIDs []string
+}
+
+// ParseGPURequest parses the value of deploy --gpu in the format of docker run --gpus: all, a
+// number of GPUs or device=<id>,<id>. It returns the value in canonical form.
+func ParseGPURequest(value string) (string, error) {
+	request, err := parseGPURequest(value)
+	if err != nil {
+		return "", err
+	}
+	return request.String(), nil
+}
+
+// parseGPURequest parses a GPU request without checking that it is set
+func parseGPURequest(value string) (*GPURequest, error) {
+	value = strings.TrimSpace(value)
+	if value == GPUAll {
+		return &GPURequest{Count: GPUAll}, nil
+	}
+	if ids, ok := strings.CutPrefix(value, gpuDevicePrefix); ok {
+		var deviceIDs []string
+		for _, id := range strings.Split(ids, ",") {
+			if id = strings.TrimSpace(id); id != "" {
+				deviceIDs = append(deviceIDs, id)
+			}
+		}
+		if len(deviceIDs) == 0 {
+			return nil, fmt.Errorf("invalid GPU request '%s': name at least one device, e.g. device=0", value)
+		}
+		return &GPURequest{DeviceIDs: deviceIDs}, nil
+	}
+	if count, err := strconv.Atoi(value); err == nil && count > 0 {
+		return &GPURequest{Count: value}, nil
+	}
+	return nil, fmt.Errorf("invalid GPU request '%s': use all, a number of GPUs or device=<id>,<id>", value)
+}
+
+// String renders the request in the format of docker run --gpus
+func (r *GPURequest) String() string {
+	if len(r.DeviceIDs) > 0 {
+		return gpuDevicePrefix + strings.Join(r.DeviceIDs, ",")
+	}
+	return r.Count
+}
+
+// AppGPU returns the GPUs passed through to the app container, or nil if it has none
+func (c *DeployConfig) AppGPU() *GPURequest {
+	if c.GPU == "" {
+		return nil
+	}
+	request, err := parseGPURequest(c.GPU)
+	if err != nil {
+		return nil
+	}
+	return request
+}
+
+// ServiceGPU returns the GPUs passed through to a service of the instance, which only the
+// app gets
+func (c *DeployConfig) ServiceGPU(service string) *GPURequest {
+	if service != "app" {
+		return nil
+	}
+	return c.AppGPU()
+}
+
+// CheckGPUSupport checks that the Docker host can pass NVIDIA GPUs through to containers
+func CheckGPUSupport() error {
+	docker, err := GetDockerClient()
+	if err != nil {
+		return err
+	}
+	runtimes, err := docker.Runtimes(context.Background())
+	if err != nil {
+		return err
+	}
+	for _, runtime := range runtimes {
+		if runtime == "nvidia" {
+			return nil
+		}
+	}
+	return fmt.Errorf("the Docker host has no nvidia runtime; install the NVIDIA Container Toolkit and run 'nvidia-ctk runtime configure --runtime=docker'")
+}
@@ -0,0 +1,222 @@
+package internal
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+)
+
+// HealthOptions controls how long and how often WaitForHealthy probes an instance
+type HealthOptions struct {
+	Timeout  time.Duration
+	Interval time.Duration
+	// Report receives every change in a service's state instead of the log, if set
+	Report func(result ServiceHealth)
+}
+
+// DefaultHealthOptions matches the five minute window deploys have always waited for
+var DefaultHealthOptions = HealthOptions{
+	Timeout:  5 * time.Minute,
+	Interval: 5 * time.Second,
+}
+
+// ServiceHealth is the result of probing one service of an instance
+type ServiceHealth struct {
+	Service string `json:"service" yaml:"service"`
+	Healthy bool   `json:"healthy" yaml:"healthy"`
+	Detail  string `json:"detail,omitempty" yaml:"detail,omitempty"`
+}
+
+// probeTimeout bounds every single network probe
+const probeTimeout = 3 * time.Second
+
+// ProbeApp checks that the MCP server answers HTTP requests on its published port
+func ProbeApp(config *DeployConfig) error {
+	resp, err := config.AppClient().Get(config.AppURL() + "/")
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+
+	// Any non-5xx answer means the server is up, even if / itself is not routed
+	if resp.StatusCode >= 500 {
+		return fmt.Errorf("HTTP %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// ProbePostgres runs pg_isready inside the instance's postgres container
+func ProbePostgres(instanceName string) error {
+	cmd := Command("docker", "exec", instanceName+"-postgres", "pg_isready", "-U", PostgresUser, "-d", PostgresDB)
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		if detail := strings.TrimSpace(string(output)); detail != "" {
+			return fmt.Errorf("%s", detail)
+		}
+		return err
+	}
+	return nil
+}
+
+// ProbeNeo4j performs a Bolt handshake against the published Bolt port at host
+func ProbeNeo4j(host string, port int) error {
+	conn, err := net.DialTimeout("tcp", net.JoinHostPort(hostOnly(host), fmt.Sprintf("%d", port)), probeTimeout)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(probeTimeout))
+
+	// Magic preamble followed by four proposed protocol versions: 5.0, 4.4, 4.0, 3.0
+	handshake := []byte{
+		0x60, 0x60, 0xB0, 0x17,
+		0x00, 0x00, 0x00, 0x05,
+		0x00, 0x00, 0x04, 0x04,
+		0x00, 0x00, 0x00, 0x04,
+		0x00, 0x00, 0x00, 0x03,
+	}
+	if _, err := conn.Write(handshake); err != nil {
+		return err
+	}
+
+	agreed := make([]byte, 4)
+	if _, err := conn.Read(agreed); err != nil {
+		return fmt.Errorf("no Bolt handshake response: %v", err)
+	}
+	if agreed[0] == 0 && agreed[1] == 0 && agreed[2] == 0 && agreed[3] == 0 {
+		return fmt.Errorf("no supported Bolt protocol version")
+	}
+	return nil
+}
+
+// ProbeInstance probes every service of an instance once
+func ProbeInstance(config *DeployConfig) []ServiceHealth {
+	type serviceProbe struct {
+		service string
+		probe   func() error
+	}
+
+	probes := []serviceProbe{
+		{"app", func() error { return ProbeApp(config) }},
+		{"postgres", func() error { return ProbePostgres(config.InstanceName) }},
+		{"neo4j", func() error { return ProbeNeo4j(config.HostAddress(), config.Neo4jBoltPort) }},
+	}
+
+	// The all-in-one image supervises its storage internally and only exposes the app
+	if config.IsSingleContainer() {
+		probes = probes[:1]
+	}
+	if config.LocalEmbeddings() != nil {
+		probes = append(probes, serviceProbe{"embeddings", func() error { return ProbeEmbeddings(config.InstanceName) }})
+	}
+
+	var results []ServiceHealth
+	for _, p := range probes {
+		result := ServiceHealth{Service: p.service, Healthy: true}
+		if err := p.probe(); err != nil {
+			result.Healthy = false
+			result.Detail = err.Error()
+		}
+		results = append(results, result)
+	}
+	return results
+}
+
+// DiagnoseContainer explains why the container of a service is not running, e.g. "exited with
+// code 137: out of memory", followed by its last log line. It returns "" for a running
+// container or one that cannot be inspected.
+func DiagnoseContainer(instanceName, service string) string {
+	docker, err := GetDockerClient()
+	if err != nil {
+		return ""
+	}
+	name := instanceName + "-" + service
+	info, err := docker.InspectContainer(context.Background(), name)
+	if err != nil || info.State == nil {
+		return ""
+	}
+	state := info.State
+	if state.Running && !state.Restarting {
+		return ""
+	}
+
+	diagnosis := state.Status
+	if state.Status == "exited" || state.Restarting {
+		diagnosis = fmt.Sprintf("exited with code %d", state.ExitCode)
+		if state.Restarting {
+			diagnosis = fmt.Sprintf("restarting after it exited with code %d", state.ExitCode)
+		}
+	}
+	switch {
+	case state.OOMKilled:
+		diagnosis += ": out of memory"
+	case state.Error != "":
+		diagnosis += ": " + state.Error
+	}
+
+	output, err := Command("docker", "logs", "--tail", "1", name).CombinedOutput()
+	if line := strings.TrimSpace(string(output)); err == nil && line != "" {
+		diagnosis += ", last log line: " + line
+	}
+	return diagnosis
+}
+
+// WaitForHealthy probes an instance's services until all are healthy, the timeout expires
+// or ctx is cancelled, logging every change in a service's state. It returns the last results.
+func WaitForHealthy(ctx context.Context, config *DeployConfig, opts HealthOptions) ([]ServiceHealth, error) {
+	if opts.Report == nil {
+		Log.Info("Waiting for services to be healthy", "instance", config.InstanceName)
+	}
+
+	deadline := time.Now().Add(opts.Timeout)
+	reported := make(map[string]bool)
+
+	for {
+		results := ProbeInstance(config)
+
+		allHealthy := true
+		for _, result := range results {
+			if !result.Healthy {
+				allHealthy = false
+			}
+			if healthy, seen := reported[result.Service]; !seen || healthy != result.Healthy {
+				if opts.Report != nil {
+					opts.Report(result)
+				} else if result.Healthy {
+					Log.Info("Service is healthy", "instance", config.InstanceName, "service", result.Service)
+				} else {
+					Log.Info("Waiting for service", "instance", config.InstanceName, "service", result.Service, "detail", result.Detail)
+				}
+				reported[result.Service] = result.Healthy
+			}
+		}
+
+		if allHealthy {
+			return results, nil
+		}
+
+		if time.Now().After(deadline) {
+			var unhealthy []string
+			for i, result := range results {
+				if result.Healthy {
+					continue
+				}
+				// A crashed container explains more than the failed probe
+				if diagnosis := DiagnoseContainer(config.InstanceName, result.Service); diagnosis != "" {
+					result.Detail = diagnosis
+					results[i] = result
+				}
+				unhealthy = append(unhealthy, fmt.Sprintf("%s (%s)", result.Service, result.Detail))
+			}
+			return results, fmt.Errorf("services not healthy after %s: %s", opts.Timeout, strings.Join(unhealthy, ", "))
+		}
+
+		select {
+		case <-ctx.Done():
+			return results, ctx.Err()
+		case <-time.After(opts.Interval):
+		}
+	}
+}
@@ -0,0 +1,176 @@
+package internal
+
+import (
+	"embed"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/nicksnyder/go-i18n/v2/i18n"
+	"github.com/nicksnyder/go-i18n/v2/i18n/template"
+	"golang.org/x/text/language"
+	"gopkg.in/yaml.v3"
+)
+
+//go:generate go run ./locales/extract -o locales/en.yaml ../cmd .
+
+// SourceLanguage is the language messages are written in. Its catalog, locales/en.yaml, is
+// generated from the message IDs in the source with go generate.
+const SourceLanguage = "en"
+
+//go:embed locales/*.yaml
+var localesFS embed.FS
+
+// catalogFormats are the unmarshalers of the catalog files, by extension
+var catalogFormats = map[string]i18n.UnmarshalFunc{"yaml": unmarshalCatalog}
+
+// localizer picks messages from the catalog of the selected language, falling back to English.
+// Until SetLanguage runs it only knows the default messages of the call sites.
+var localizer = i18n.NewLocalizer(i18n.NewBundle(language.English), SourceLanguage)
+
+// DetectLanguage returns the language to show messages in: GRAPHSENSE_LANG, then the language
+// setting of ~/.graphsense/config.yaml, then the LC_ALL, LC_MESSAGES and LANG locale variables
+func DetectLanguage() string {
+	if language := os.Getenv("GRAPHSENSE_LANG"); language != "" {
+		return language
+	}
+	if settings, err := LoadConfig(); err == nil && settings.Language != "" {
+		return settings.Language
+	}
+	for _, variable := range []string{"LC_ALL", "LC_MESSAGES", "LANG"} {
+		if language := os.Getenv(variable); language != "" {
+			return language
+		}
+	}
+	return SourceLanguage
+}
+
+// normalizeLanguage turns a locale such as de_DE.UTF-8 into a language tag such as de-de
+func normalizeLanguage(language string) string {
+	language, _, _ = strings.Cut(language, ".")
+	language, _, _ = strings.Cut(language, "@")
+	return strings.ToLower(strings.ReplaceAll(language, "_", "-"))
+}
+
+// languageCandidates returns the catalog names to try for a language, most specific first
+func languageCandidates(language string) []string {
+	tag := normalizeLanguage(language)
+	if tag == "" || tag == "c" || tag == "posix" {
+		return nil
+	}
+	candidates := []string{tag}
+	if base, _, ok := strings.Cut(tag, "-"); ok {
+		candidates = append(candidates, base)
+	}
+	return candidates
+}
+
+// SetLanguage selects the catalog messages are translated with. Catalogs in
+// ~/.graphsense/locales take precedence over the ones built into the CLI, so translations can
+// be tried out or added without a rebuild. Unknown languages fall back to English.
+func SetLanguage(lang string) error {
+	bundle := i18n.NewBundle(language.English)
+	localizer = i18n.NewLocalizer(bundle, SourceLanguage)
+	source, err := LoadMessageFile(SourceLanguage)
+	if err != nil {
+		return err
+	}
+	if source != nil {
+		if err := bundle.AddMessages(source.Tag, source.Messages...); err != nil {
+			return err
+		}
+	}
+
+	for _, candidate := range languageCandidates(lang) {
+		if candidate == SourceLanguage {
+			return nil
+		}
+		file, err := LoadMessageFile(candidate)
+		if err != nil {
+			return err
+		}
+		if file != nil {
+			if err := bundle.AddMessages(file.Tag, file.Messages...); err != nil {
+				return fmt.Errorf("failed to load catalog %s: %v", file.Path, err)
+			}
+			localizer = i18n.NewLocalizer(bundle, candidate, SourceLanguage)
+			return nil
+		}
+	}
+	return nil
+}
+
+// LoadMessageFile reads the catalog of a language from ~/.graphsense/locales or the built-in
+// catalogs, returning nil if there is none
+func LoadMessageFile(language string) (*i18n.MessageFile, error) {
+	name := language + ".yaml"
+	graphsenseDir, err := GetGraphsenseDir()
+	if err != nil {
+		return nil, err
+	}
+	path := filepath.Join(graphsenseDir, "locales", name)
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		path = "built-in " + name
+		data, err = localesFS.ReadFile("locales/" + name)
+		if err != nil {
+			return nil, nil
+		}
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to read catalog %s: %v", path, err)
+	}
+
+	file, err := i18n.ParseMessageFileBytes(data, name, catalogFormats)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse catalog %s: %v", path, err)
+	}
+	file.Path = path
+	return file, nil
+}
+
+// unmarshalCatalog parses a YAML catalog, leaving out messages without a translation, which
+// YAML reads as null
+func unmarshalCatalog(data []byte, v any) error {
+	raw, ok := v.(*any)
+	if !ok {
+		return yaml.Unmarshal(data, v)
+	}
+	var messages map[string]any
+	if err := yaml.Unmarshal(data, &messages); err != nil {
+		return err
+	}
+	for id, message := range messages {
+		if message == nil {
+			delete(messages, id)
+		}
+	}
+	*raw = messages
+	return nil
+}
+
+// Localize renders a message in the selected language, filling its {{.Field}} placeholders
+// from data. The message's Other text is used where no catalog translates it.
+func Localize(message *i18n.Message, data map[string]any) string {
+	text, err := localizer.Localize(&i18n.LocalizeConfig{DefaultMessage: message, TemplateData: data})
+	if text == "" && err != nil {
+		return message.Other
+	}
+	return text
+}
+
+// T translates a text that is its own message ID: a log message, a command description or
+// flag help. Texts no catalog translates are returned unchanged.
+func T(text string) string {
+	translated, err := localizer.Localize(&i18n.LocalizeConfig{MessageID: text, TemplateParser: template.IdentityParser{}})
+	if err != nil || translated == "" {
+		return text
+	}
+	return translated
+}
+
+// LogMessage marks a log message kept outside the Log call that writes it, so that the catalog
+// extractor finds it. It returns message unchanged; the log handler translates it.
+func LogMessage(message string) string {
+	return message
+}
@@ -0,0 +1,191 @@
+package internal
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/docker/docker/api/types/image"
+)
+
+// DefaultKeepImages is how many of the most recent images of each repository cleanup keeps
+const DefaultKeepImages = 2
+
+// UnusedImage is a GraphSense-related image no container uses any more
+type UnusedImage struct {
+	ID      string    `json:"id" yaml:"id"`
+	Tags    []string  `json:"tags,omitempty" yaml:"tags,omitempty"`
+	Size    int64     `json:"size" yaml:"size"`
+	Created time.Time `json:"created" yaml:"created"`
+}
+
+// Name returns the first tag of the image, or its short ID if it is untagged
+func (i UnusedImage) Name() string {
+	if len(i.Tags) > 0 {
+		return i.Tags[0]
+	}
+	return strings.TrimPrefix(i.ID, "sha256:")[:12]
+}
+
+// imageRepository strips the tag or digest from an image reference
+func imageRepository(ref string) string {
+	if at := strings.Index(ref, "@"); at >= 0 {
+		ref = ref[:at]
+	}
+	// A colon after the last slash separates the tag; one before it belongs to a registry port
+	if colon := strings.LastIndex(ref, ":"); colon > strings.LastIndex(ref, "/") {
+		ref = ref[:colon]
+	}
+	return ref
+}
+
+// graphsenseRepositories returns the image repositories GraphSense instances run: the images of
+// the containers of registered instances, the images their configurations pin and the images
+// the CLI itself starts
+func graphsenseRepositories(ctx context.Context, docker *DockerClient) (map[string]bool, error) {
+	repos := map[string]bool{
+		imageRepository(AllInOneImage):        true,
+		imageRepository(EmbeddingServerImage): true,
+	}
+
+	names, err := GetInstanceNames()
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range names {
+		if config, err := GetInstanceConfig(name); err == nil && config.AppImage != "" {
+			repos[imageRepository(config.AppImage)] = true
+		}
+		containers, err := docker.ProjectContainers(ctx, name)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list containers of '%s': %v", name, err)
+		}
+		for _, container := range containers {
+			repos[imageRepository(container.Image)] = true
+		}
+	}
+	return repos, nil
+}
+
+// FindUnusedImages lists the GraphSense-related images that no container uses, apart from the
+// keep most recent images of each repository, which are kept for rolling back an upgrade.
+// Images count as GraphSense-related when their repository is one a registered instance runs
+// or when the repository name contains "graphsense".
+func FindUnusedImages(ctx context.Context, keep int) ([]UnusedImage, error) {
+	docker, err := GetDockerClient()
+	if err != nil {
+		return nil, err
+	}
+	repos, err := graphsenseRepositories(ctx, docker)
+	if err != nil {
+		return nil, err
+	}
+
+	// Images used by any container, GraphSense or not, are never removed
+	containers, err := docker.ListContainers(ctx, true, emptyFilter())
+	if err != nil {
+		return nil, err
+	}
+	inUse := make(map[string]bool)
+	for _, container := range containers {
+		inUse[container.ImageID] = true
+	}
+
+	images, err := docker.ListImages(ctx)
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(images, func(i, j int) bool {
+		return images[i].Created > images[j].Created
+	})
+
+	kept := make(map[string]int)
+	var unused []UnusedImage
+	for _, img := range images {
+		imageRepos := imageRepositories(img)
+		related := false
+		for _, repo := range imageRepos {
+			if repos[repo] || strings.Contains(repo, "graphsense") {
+				related = true
+			}
+		}
+		if !related || inUse[img.ID] {
+			// Images in use still count towards the images kept for their repositories
+			for _, repo := range imageRepos {
+				kept[repo]++
+			}
+			continue
+		}
+
+		// Untagged images are left over from a pull that moved their tag, so none are kept
+		tags := taggedReferences(img)
+		keepImage := false
+		if len(tags) > 0 {
+			for _, repo := range imageRepos {
+				if kept[repo] < keep {
+					keepImage = true
+				}
+				kept[repo]++
+			}
+		}
+		if keepImage {
+			continue
+		}
+
+		unused = append(unused, UnusedImage{
+			ID:      img.ID,
+			Tags:    tags,
+			Size:    img.Size,
+			Created: time.Unix(img.Created, 0),
+		})
+	}
+	return unused, nil
+}
+
+// RemoveImages removes the given images and returns how many were removed and the space reclaimed
+func RemoveImages(ctx context.Context, images []UnusedImage) (int, int64, error) {
+	docker, err := GetDockerClient()
+	if err != nil {
+		return 0, 0, err
+	}
+	removed := 0
+	var reclaimed int64
+	for _, img := range images {
+		if err := docker.RemoveImage(ctx, img.ID); err != nil {
+			Log.Warning("Failed to remove image", "image", img.Name(), "error", err)
+			continue
+		}
+		Log.Verbose("Removed image", "image", img.Name(), "size", FormatSize(img.Size))
+		removed++
+		reclaimed += img.Size
+	}
+	return removed, reclaimed, nil
+}
+
+// imageRepositories returns the repositories an image is tagged in or was pulled from
+func imageRepositories(img image.Summary) []string {
+	seen := make(map[string]bool)
+	var repos []string
+	for _, ref := range append(append([]string{}, img.RepoTags...), img.RepoDigests...) {
+		repo := imageRepository(ref)
+		if repo == "<none>" || seen[repo] {
+			continue
+		}
+		seen[repo] = true
+		repos = append(repos, repo)
+	}
+	return repos
+}
+
+// taggedReferences returns the tags of an image without the <none>:<none> placeholder
+func taggedReferences(img image.Summary) []string {
+	var tags []string
+	for _, tag := range img.RepoTags {
+		if tag != "<none>:<none>" {
+			tags = append(tags, tag)
+		}
+	}
+	return tags
+}
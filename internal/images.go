@@ -0,0 +1,208 @@
+package internal
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// PinnableServices are the services deploy can pin to an image tag
+var PinnableServices = []string{"app", "postgres", "neo4j"}
+
+// isPinnableService reports whether deploy can pin a service to an image tag
+func isPinnableService(service string) bool {
+	for _, pinnable := range PinnableServices {
+		if service == pinnable {
+			return true
+		}
+	}
+	return false
+}
+
+// imageTagPattern matches the tags Docker accepts
+var imageTagPattern = regexp.MustCompile(`^[A-Za-z0-9_][A-Za-z0-9_.-]{0,127}$`)
+
+// DeployedImage is the image a service of an instance was last deployed or upgraded with, and
+// the digest it resolved to
+type DeployedImage struct {
+	Image  string `json:"image" yaml:"image"`
+	Digest string `json:"digest,omitempty" yaml:"digest,omitempty"`
+}
+
+// ValidateImageTag checks that tag is a valid Docker image tag, e.g. v0.4.2
+func ValidateImageTag(tag string) error {
+	if !imageTagPattern.MatchString(tag) {
+		return fmt.Errorf("invalid image tag '%s': use letters, digits, '_', '.' and '-', e.g. v0.4.2", tag)
+	}
+	return nil
+}
+
+// ServiceImage returns the image a service of the instance is pinned to, or "" if it runs the
+// image of the compose file
+func (c *DeployConfig) ServiceImage(service string) string {
+	switch service {
+	case "app":
+		return c.AppImage
+	case "postgres":
+		return c.PostgresImage
+	case "neo4j":
+		return c.Neo4jImage
+	}
+	return ""
+}
+
+// setServiceImage pins a service of the instance to an image
+func (c *DeployConfig) setServiceImage(service, image string) {
+	switch service {
+	case "app":
+		c.AppImage = image
+	case "postgres":
+		c.PostgresImage = image
+	case "neo4j":
+		c.Neo4jImage = image
+	}
+}
+
+// PinImageTags pins the services of ImageTags to their tags of the images they would run
+// otherwise, given by service, and clears ImageTags
+func (c *DeployConfig) PinImageTags(images map[string]string) error {
+	for service, tag := range c.ImageTags {
+		image := images[service]
+		if image == "" {
+			return fmt.Errorf("cannot pin %s to tag %s: the compose file gives it no image", service, tag)
+		}
+		c.setServiceImage(service, ImageWithTag(image, tag))
+		Log.Info("Pinning image", "service", service, "image", c.ServiceImage(service))
+	}
+	c.ImageTags = nil
+	return nil
+}
+
+// pinComposeImageTags pins the services of ImageTags to tags of the images of the compose
+// configuration and renders the override again with them
+func pinComposeImageTags(config *DeployConfig, files *ComposeFiles) error {
+	images, err := GetComposeImages(files, map[string]string{"COMPOSE_PROJECT_NAME": config.InstanceName})
+	if err != nil {
+		return err
+	}
+	if err := config.PinImageTags(images); err != nil {
+		return err
+	}
+	os.Remove(files.Override)
+	files.Override, err = CreateComposeOverride(config)
+	if err != nil {
+		return fmt.Errorf("failed to create compose override: %v", err)
+	}
+	return nil
+}
+
+// ShortDigest abbreviates an image digest for tables, e.g. sha256:1a2b3c4d5e6f
+func ShortDigest(digest string) string {
+	algorithm, hex, ok := strings.Cut(digest, ":")
+	if !ok || len(hex) <= 12 {
+		return digest
+	}
+	return algorithm + ":" + hex[:12]
+}
+
+// RecordDeployedImages records the images the containers of an instance run and their
+// digests in instances.db
+func RecordDeployedImages(instanceName string) error {
+	containers, err := GetContainerImages(instanceName)
+	if err != nil {
+		return err
+	}
+	return SaveDeployedImages(instanceName, DeployedImagesOf(containers))
+}
+
+// DeployedImagesOf returns the images of containers as recorded in instances.db
+func DeployedImagesOf(containers map[string]ContainerImage) map[string]DeployedImage {
+	images := make(map[string]DeployedImage)
+	for service, container := range containers {
+		if service == "" {
+			continue
+		}
+		images[service] = DeployedImage{Image: container.Image, Digest: container.Digest}
+	}
+	return images
+}
+
+// SaveDeployedImages replaces the recorded images of an instance
+func SaveDeployedImages(instanceName string, images map[string]DeployedImage) error {
+	db, err := InitDB()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	if _, err := db.Exec(`DELETE FROM deployed_images WHERE instance_name = ?`, instanceName); err != nil {
+		return fmt.Errorf("failed to save images of %s: %v", instanceName, err)
+	}
+	for service, image := range images {
+		if _, err := db.Exec(`INSERT INTO deployed_images (instance_name, service, image, digest) VALUES (?, ?, ?, ?)`, instanceName, service, image.Image, image.Digest); err != nil {
+			return fmt.Errorf("failed to save images of %s: %v", instanceName, err)
+		}
+	}
+	return nil
+}
+
+// GetDeployedImages returns the recorded images of every instance, keyed by instance name
+// and service
+func GetDeployedImages() (map[string]map[string]DeployedImage, error) {
+	db, err := InitDB()
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	rows, err := db.Query(`SELECT instance_name, service, image, digest FROM deployed_images`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query deployed images: %v", err)
+	}
+	defer rows.Close()
+
+	images := make(map[string]map[string]DeployedImage)
+	for rows.Next() {
+		var name, service string
+		var image DeployedImage
+		if err := rows.Scan(&name, &service, &image.Image, &image.Digest); err != nil {
+			return nil, fmt.Errorf("failed to scan row: %v", err)
+		}
+		if images[name] == nil {
+			images[name] = make(map[string]DeployedImage)
+		}
+		images[name][service] = image
+	}
+	return images, rows.Err()
+}
+
+// GetInstanceImages returns the recorded images of an instance, keyed by service, or nil if
+// none are recorded
+func GetInstanceImages(instanceName string) (map[string]DeployedImage, error) {
+	db, err := InitDB()
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	rows, err := db.Query(`SELECT service, image, digest FROM deployed_images WHERE instance_name = ?`, instanceName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query images of %s: %v", instanceName, err)
+	}
+	defer rows.Close()
+
+	var images map[string]DeployedImage
+	for rows.Next() {
+		var service string
+		var image DeployedImage
+		if err := rows.Scan(&service, &image.Image, &image.Digest); err != nil {
+			return nil, fmt.Errorf("failed to scan row: %v", err)
+		}
+		if images == nil {
+			images = make(map[string]DeployedImage)
+		}
+		images[service] = image
+	}
+	return images, rows.Err()
+}
@@ -0,0 +1,148 @@
+package internal
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ExpectedIndex is a Neo4j index GraphSense relies on for fast graph queries
+type ExpectedIndex struct {
+	Label    string
+	Property string
+}
+
+func (i ExpectedIndex) String() string {
+	return fmt.Sprintf(":%s(%s)", i.Label, i.Property)
+}
+
+// ExpectedNeo4jIndexes lists the indexes every indexed repository should have.
+// Without them lookups by name or path fall back to label scans.
+var ExpectedNeo4jIndexes = []ExpectedIndex{
+	{Label: "File", Property: "path"},
+	{Label: "Function", Property: "name"},
+	{Label: "Class", Property: "name"},
+}
+
+// Neo4jIndex is one row of SHOW INDEXES
+type Neo4jIndex struct {
+	Name       string
+	Label      string
+	Properties []string
+	State      string
+}
+
+// IndexReport is the result of checking an instance's Neo4j indexes against ExpectedNeo4jIndexes
+type IndexReport struct {
+	Degraded  bool     `json:"degraded" yaml:"degraded"`
+	Missing   []string `json:"missing,omitempty" yaml:"missing,omitempty"`
+	NotOnline []string `json:"not_online,omitempty" yaml:"not_online,omitempty"`
+}
+
+// showIndexesQuery flattens SHOW INDEXES into one pipe-separated string per index
+const showIndexesQuery = `SHOW INDEXES YIELD name, labelsOrTypes, properties, state, type
+WHERE type <> 'LOOKUP'
+RETURN name + '|' + coalesce(labelsOrTypes[0], '') + '|' +
+  reduce(s = '', p IN coalesce(properties, []) | s + CASE s WHEN '' THEN '' ELSE ',' END + p) + '|' + state AS row`
+
+// RunCypher runs a query with cypher-shell inside an instance's neo4j container and returns the plain output
+func RunCypher(instanceName, query string) (string, error) {
+	config, err := GetInstanceConfig(instanceName)
+	if err != nil {
+		return "", err
+	}
+	env, err := config.CypherShellEnv()
+	if err != nil {
+		return "", err
+	}
+
+	// cypher-shell reads the password from NEO4J_PASSWORD
+	cmd := CommandEnv(env, "docker", "exec", "-e", Neo4jPasswordEnv, instanceName+"-neo4j",
+		"cypher-shell", "-u", Neo4jUser, "-d", Neo4jDB, "--format", "plain", query)
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		if detail := strings.TrimSpace(string(output)); detail != "" {
+			return "", fmt.Errorf("cypher-shell failed: %s", detail)
+		}
+		return "", fmt.Errorf("cypher-shell failed: %v", err)
+	}
+	return string(output), nil
+}
+
+// GetNeo4jIndexes lists the indexes of an instance's Neo4j database
+func GetNeo4jIndexes(instanceName string) ([]Neo4jIndex, error) {
+	output, err := RunCypher(instanceName, showIndexesQuery)
+	if err != nil {
+		return nil, err
+	}
+
+	var indexes []Neo4jIndex
+	for i, line := range strings.Split(output, "\n") {
+		// The first line is the column header
+		line = strings.Trim(strings.TrimSpace(line), `"`)
+		if i == 0 || line == "" {
+			continue
+		}
+
+		fields := strings.Split(line, "|")
+		if len(fields) != 4 {
+			continue
+		}
+		index := Neo4jIndex{Name: fields[0], Label: fields[1], State: fields[3]}
+		if fields[2] != "" {
+			index.Properties = strings.Split(fields[2], ",")
+		}
+		indexes = append(indexes, index)
+	}
+
+	return indexes, nil
+}
+
+// CheckIndexes compares indexes against ExpectedNeo4jIndexes. An expected index counts as present
+// when an index on its label has the property first, as composite indexes serve those lookups too.
+func CheckIndexes(indexes []Neo4jIndex) IndexReport {
+	var report IndexReport
+	for _, expected := range ExpectedNeo4jIndexes {
+		found := false
+		online := false
+		for _, index := range indexes {
+			if index.Label != expected.Label || len(index.Properties) == 0 || index.Properties[0] != expected.Property {
+				continue
+			}
+			found = true
+			if index.State == "ONLINE" {
+				online = true
+			}
+		}
+
+		switch {
+		case !found:
+			report.Missing = append(report.Missing, expected.String())
+		case !online:
+			report.NotOnline = append(report.NotOnline, expected.String())
+		}
+	}
+
+	report.Degraded = len(report.Missing) > 0 || len(report.NotOnline) > 0
+	return report
+}
+
+// VerifyIndexes checks that the expected indexes of an instance exist and are ONLINE
+func VerifyIndexes(instanceName string) (IndexReport, error) {
+	indexes, err := GetNeo4jIndexes(instanceName)
+	if err != nil {
+		return IndexReport{}, err
+	}
+	return CheckIndexes(indexes), nil
+}
+
+// Summary describes the problems of a degraded report in one line
+func (r IndexReport) Summary() string {
+	var parts []string
+	if len(r.Missing) > 0 {
+		parts = append(parts, "missing "+strings.Join(r.Missing, ", "))
+	}
+	if len(r.NotOnline) > 0 {
+		parts = append(parts, "not online "+strings.Join(r.NotOnline, ", "))
+	}
+	return strings.Join(parts, "; ")
+}
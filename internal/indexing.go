@@ -0,0 +1,69 @@
+package internal
+
+import "fmt"
+
+// Indexing settings of a nice instance, which indexes in the background without starving the
+// rest of the machine
+const (
+	NiceIndexWorkers   = 1
+	NiceIndexBatchSize = 25
+	// NiceCPUShares is the relative CPU weight of a nice instance's app; Docker's default is 1024
+	NiceCPUShares = 256
+)
+
+// AppIndexWorkers returns how many files the app indexes in parallel, or 0 for the app's default
+func (c *DeployConfig) AppIndexWorkers() int {
+	if c.IndexWorkers == 0 && c.Nice {
+		return NiceIndexWorkers
+	}
+	return c.IndexWorkers
+}
+
+// AppIndexBatchSize returns how many files the app indexes per batch, or 0 for the app's default
+func (c *DeployConfig) AppIndexBatchSize() int {
+	if c.IndexBatchSize == 0 && c.Nice {
+		return NiceIndexBatchSize
+	}
+	return c.IndexBatchSize
+}
+
+// AppCPUShares returns the relative CPU weight of the app container, or 0 for Docker's default
+func (c *DeployConfig) AppCPUShares() int {
+	if c.Nice {
+		return NiceCPUShares
+	}
+	return 0
+}
+
+// ValidateIndexing checks indexing settings, where 0 stands for the app's default
+func ValidateIndexing(workers, batchSize int) error {
+	if workers < 0 {
+		return fmt.Errorf("invalid number of index workers %d: must be positive", workers)
+	}
+	if batchSize < 0 {
+		return fmt.Errorf("invalid index batch size %d: must be positive", batchSize)
+	}
+	return nil
+}
+
+// DescribeIndexing summarizes the indexing settings of an instance, or returns "" if it uses
+// the app's defaults
+func (c *DeployConfig) DescribeIndexing() string {
+	var description string
+	if workers := c.AppIndexWorkers(); workers > 0 {
+		description = fmt.Sprintf("%d workers", workers)
+		if workers == 1 {
+			description = "1 worker"
+		}
+	}
+	if batchSize := c.AppIndexBatchSize(); batchSize > 0 {
+		if description != "" {
+			description += ", "
+		}
+		description += fmt.Sprintf("batches of %d files", batchSize)
+	}
+	if c.Nice {
+		description += " (nice)"
+	}
+	return description
+}
@@ -0,0 +1,77 @@
+package internal
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// Indexing phases reported by the app
+const (
+	IndexPhaseComplete = "complete"
+)
+
+// IndexProgress is the indexing state reported by an instance's app
+type IndexProgress struct {
+	Phase          string    `json:"phase" yaml:"phase"`
+	FilesProcessed int       `json:"files_processed" yaml:"files_processed"`
+	FilesTotal     int       `json:"files_total" yaml:"files_total"`
+	NodesCreated   int       `json:"nodes_created" yaml:"nodes_created"`
+	EdgesCreated   int       `json:"edges_created" yaml:"edges_created"`
+	StartedAt      time.Time `json:"started_at" yaml:"started_at"`
+	// ETASeconds is the app's own estimate; when it has none, ETA extrapolates from the files processed so far
+	ETASeconds float64 `json:"eta_seconds,omitempty" yaml:"eta_seconds,omitempty"`
+}
+
+// Complete reports whether indexing has finished
+func (p *IndexProgress) Complete() bool {
+	return p.Phase == IndexPhaseComplete
+}
+
+// Percent returns the share of files processed, or -1 if the total is not known yet
+func (p *IndexProgress) Percent() float64 {
+	if p.FilesTotal <= 0 {
+		return -1
+	}
+	return float64(p.FilesProcessed) * 100 / float64(p.FilesTotal)
+}
+
+// ETA returns the estimated time until indexing completes, or 0 if it cannot be estimated
+func (p *IndexProgress) ETA() time.Duration {
+	if p.Complete() {
+		return 0
+	}
+	if p.ETASeconds > 0 {
+		return time.Duration(p.ETASeconds * float64(time.Second))
+	}
+	if p.StartedAt.IsZero() || p.FilesProcessed == 0 || p.FilesTotal <= p.FilesProcessed {
+		return 0
+	}
+	elapsed := time.Since(p.StartedAt)
+	remaining := float64(p.FilesTotal-p.FilesProcessed) / float64(p.FilesProcessed)
+	return time.Duration(float64(elapsed) * remaining)
+}
+
+// GetIndexProgress asks an instance's app for its indexing state through the admin API.
+// It returns ErrNoAdminAPI when the app version does not report it.
+func GetIndexProgress(config *DeployConfig) (*IndexProgress, error) {
+	resp, err := config.AppClient().Get(config.AppURL() + "/admin/index-status")
+	if err != nil {
+		return nil, fmt.Errorf("failed to reach admin API: %v", err)
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusNotFound || resp.StatusCode == http.StatusMethodNotAllowed:
+		return nil, ErrNoAdminAPI
+	case resp.StatusCode >= 300:
+		return nil, fmt.Errorf("admin API returned HTTP %d", resp.StatusCode)
+	}
+
+	progress := &IndexProgress{}
+	if err := json.NewDecoder(resp.Body).Decode(progress); err != nil {
+		return nil, fmt.Errorf("unexpected index status from admin API: %v", err)
+	}
+	return progress, nil
+}
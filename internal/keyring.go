@@ -0,0 +1,149 @@
+package internal
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/zalando/go-keyring"
+)
+
+// KeyringService is the service API keys are stored under in the OS keyring
+const KeyringService = "graphsense-cli"
+
+var (
+	// ErrKeyNotFound is returned when the keyring holds no value for a key
+	ErrKeyNotFound = errors.New("not found in the keyring")
+	// ErrKeyringUnavailable is returned when the OS keyring cannot be used, in which case API
+	// keys are kept in ~/.graphsense/.env
+	ErrKeyringUnavailable = errors.New("OS keyring not available")
+)
+
+// APIKeyNames lists the API keys the CLI manages
+var APIKeyNames = []string{CoAPIKeyName, AnthropicAPIKeyName}
+
+// ParseAPIKeyName returns the API key called name, accepting any case
+func ParseAPIKeyName(name string) (string, error) {
+	for _, valid := range APIKeyNames {
+		if strings.EqualFold(name, valid) {
+			return valid, nil
+		}
+	}
+	return "", fmt.Errorf("unknown API key '%s': must be one of %s", name, strings.Join(APIKeyNames, ", "))
+}
+
+// Places an API key is read from
+const (
+	APIKeySourceKeyring = "keyring"
+	APIKeySourceFile    = "file"
+)
+
+// StoredAPIKey is an API key with the place it is read from, which is empty if it is not set
+type StoredAPIKey struct {
+	Name   string `json:"name" yaml:"name"`
+	Source string `json:"source" yaml:"source"`
+	Value  string `json:"-" yaml:"-"`
+}
+
+// StoredAPIKeys returns every API key the CLI manages. The OS keyring takes precedence over
+// ~/.graphsense/.env.
+func StoredAPIKeys() ([]StoredAPIKey, error) {
+	fileKeys, err := loadAPIKeysFile()
+	if err != nil {
+		return nil, err
+	}
+
+	stored := make([]StoredAPIKey, 0, len(APIKeyNames))
+	for _, name := range APIKeyNames {
+		key := StoredAPIKey{Name: name}
+		value, err := KeyringGet(name)
+		switch {
+		case err == nil:
+			key.Source, key.Value = APIKeySourceKeyring, value
+		case !errors.Is(err, ErrKeyNotFound):
+			Log.Debug("Not reading API key from the keyring", "key", name, "reason", err)
+		}
+		if key.Source == "" {
+			if value, ok := fileKeys[name]; ok {
+				key.Source, key.Value = APIKeySourceFile, value
+			}
+		}
+		stored = append(stored, key)
+	}
+	return stored, nil
+}
+
+// KeyringGet returns the value of an API key from the OS keyring
+func KeyringGet(name string) (string, error) {
+	value, err := keyring.Get(KeyringService, name)
+	if err != nil {
+		return "", keyringError(name, err)
+	}
+	return value, nil
+}
+
+// KeyringSet stores an API key in the OS keyring, replacing any previous value
+func KeyringSet(name, value string) error {
+	if err := keyring.Set(KeyringService, name, value); err != nil {
+		return keyringError(name, err)
+	}
+	return nil
+}
+
+// KeyringDelete removes an API key from the OS keyring
+func KeyringDelete(name string) error {
+	if err := keyring.Delete(KeyringService, name); err != nil {
+		return keyringError(name, err)
+	}
+	return nil
+}
+
+// keyringError maps an error of the keyring to ErrKeyNotFound or ErrKeyringUnavailable. Any
+// other failure, such as no Secret Service running on Linux, means the keyring cannot be used.
+func keyringError(name string, err error) error {
+	switch {
+	case errors.Is(err, keyring.ErrNotFound):
+		return fmt.Errorf("%s %w", name, ErrKeyNotFound)
+	case errors.Is(err, keyring.ErrSetDataTooBig):
+		return fmt.Errorf("failed to store %s in the keyring: %v", name, err)
+	case errors.Is(err, keyring.ErrUnsupportedPlatform):
+		return fmt.Errorf("%w on this platform", ErrKeyringUnavailable)
+	}
+	return fmt.Errorf("%w: %v", ErrKeyringUnavailable, err)
+}
+
+// StoreAPIKeys stores API keys in the OS keyring and removes them from ~/.graphsense/.env, so
+// no copy is left in clear text. Without a usable keyring they are written to the .env file
+// instead. It returns where the keys were stored.
+func StoreAPIKeys(keys map[string]string) (string, error) {
+	names := make([]string, 0, len(keys))
+	for name := range keys {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for i, name := range names {
+		err := KeyringSet(name, keys[name])
+		if i == 0 && errors.Is(err, ErrKeyringUnavailable) {
+			Log.Warning("Storing API keys in clear text", "reason", err)
+			envFile, err := APIKeysFile()
+			if err != nil {
+				return "", err
+			}
+			return envFile, UpdateAPIKeys(keys)
+		}
+		if err != nil {
+			return "", err
+		}
+	}
+
+	removed, err := RemoveAPIKeysFromFile(names...)
+	if err != nil {
+		return "", err
+	}
+	if len(removed) > 0 {
+		Log.Info("Removed the clear-text copies from ~/.graphsense/.env", "keys", strings.Join(removed, ", "))
+	}
+	return "the OS keyring", nil
+}
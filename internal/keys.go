@@ -0,0 +1,186 @@
+package internal
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// API key names in ~/.graphsense/.env
+const (
+	CoAPIKeyName        = "CO_API_KEY"
+	AnthropicAPIKeyName = "ANTHROPIC_API_KEY"
+)
+
+// APIKeysFile returns the path of the API keys file, ~/.graphsense/.env
+func APIKeysFile() (string, error) {
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to get home directory: %v", err)
+	}
+	return filepath.Join(homeDir, ".graphsense", ".env"), nil
+}
+
+// UpdateAPIKeys sets keys in ~/.graphsense/.env, keeping its other lines and comments.
+// The file is replaced atomically so a failed write never leaves it half written.
+func UpdateAPIKeys(keys map[string]string) error {
+	_, err := editAPIKeysFile(keys, nil)
+	return err
+}
+
+// RemoveAPIKeysFromFile removes keys from ~/.graphsense/.env, keeping its other lines and
+// comments, and returns the keys it held
+func RemoveAPIKeysFromFile(names ...string) ([]string, error) {
+	return editAPIKeysFile(nil, names)
+}
+
+// editAPIKeysFile sets and removes keys in ~/.graphsense/.env and returns the removed keys
+func editAPIKeysFile(keys map[string]string, remove []string) ([]string, error) {
+	envFile, err := APIKeysFile()
+	if err != nil {
+		return nil, err
+	}
+	if _, err := GetGraphsenseDir(); err != nil {
+		return nil, err
+	}
+
+	var lines []string
+	if content, err := os.ReadFile(envFile); err == nil {
+		lines = strings.Split(strings.TrimRight(string(content), "\n"), "\n")
+	} else if !os.IsNotExist(err) {
+		return nil, fmt.Errorf("failed to read API keys file: %v", err)
+	} else if len(keys) == 0 {
+		return nil, nil
+	}
+
+	removing := make(map[string]bool)
+	for _, name := range remove {
+		removing[name] = true
+	}
+
+	var removed []string
+	updated := make(map[string]bool)
+	kept := lines[:0]
+	for _, line := range lines {
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || strings.HasPrefix(trimmed, "#") {
+			kept = append(kept, line)
+			continue
+		}
+		parts := strings.SplitN(trimmed, "=", 2)
+		key := strings.TrimSpace(parts[0])
+		if removing[key] {
+			removed = append(removed, key)
+			continue
+		}
+		if value, ok := keys[key]; ok {
+			line = fmt.Sprintf("%s=%s", key, value)
+			updated[key] = true
+		}
+		kept = append(kept, line)
+	}
+	lines = kept
+	if len(keys) == 0 && len(removed) == 0 {
+		return nil, nil
+	}
+
+	var missing []string
+	for key := range keys {
+		if !updated[key] {
+			missing = append(missing, key)
+		}
+	}
+	sort.Strings(missing)
+	for _, key := range missing {
+		lines = append(lines, fmt.Sprintf("%s=%s", key, keys[key]))
+	}
+
+	tmpFile, err := os.CreateTemp(filepath.Dir(envFile), ".env-*")
+	if err != nil {
+		return nil, fmt.Errorf("failed to write API keys file: %v", err)
+	}
+	defer os.Remove(tmpFile.Name())
+
+	if _, err := tmpFile.WriteString(strings.Join(lines, "\n") + "\n"); err != nil {
+		tmpFile.Close()
+		return nil, fmt.Errorf("failed to write API keys file: %v", err)
+	}
+	if err := tmpFile.Close(); err != nil {
+		return nil, fmt.Errorf("failed to write API keys file: %v", err)
+	}
+	if err := os.Chmod(tmpFile.Name(), 0600); err != nil {
+		return nil, fmt.Errorf("failed to write API keys file: %v", err)
+	}
+	if err := os.Rename(tmpFile.Name(), envFile); err != nil {
+		return nil, fmt.Errorf("failed to write API keys file: %v", err)
+	}
+	return removed, nil
+}
+
+// APIKeyEnv returns the API key environment variables of the instance's app. Instances with
+// a local embedding model must not reach out to the Cohere API, so they get no Cohere key.
+func (c *DeployConfig) APIKeyEnv() map[string]string {
+	env := make(map[string]string)
+	if c.CoAPIKey != "" && c.LocalEmbeddings() == nil {
+		env[CoAPIKeyName] = c.CoAPIKey
+	}
+	if c.AnthropicAPIKey != "" {
+		env[AnthropicAPIKeyName] = c.AnthropicAPIKey
+	}
+	return env
+}
+
+// apiKeySecretPrefix prefixes the compose environment variables API key secrets are read
+// from, so that the GraphSense compose file cannot interpolate them into the app's environment
+const apiKeySecretPrefix = "GRAPHSENSE_SECRET_"
+
+// ComposeSecret is an API key handed to the app as a compose secret, mounted at
+// /run/secrets/<Name> with <Name>_FILE naming the file, for apps that read keys from files
+type ComposeSecret struct {
+	// Name is the API key, e.g. CO_API_KEY
+	Name string
+}
+
+// ID is the name of the secret in the compose file
+func (s ComposeSecret) ID() string {
+	return strings.ToLower(s.Name)
+}
+
+// Source is the variable of the compose environment the secret is read from
+func (s ComposeSecret) Source() string {
+	return apiKeySecretPrefix + s.Name
+}
+
+// APIKeySecrets returns the API keys the app also gets as compose secrets, or none if the
+// installed Compose cannot read secrets from its environment
+func (c *DeployConfig) APIKeySecrets() []ComposeSecret {
+	runner, err := GetComposeRunner()
+	if err != nil || !runner.SupportsEnvironmentSecrets() {
+		return nil
+	}
+	env := c.APIKeyEnv()
+	var secrets []ComposeSecret
+	for _, name := range APIKeyNames {
+		if _, ok := env[name]; ok {
+			secrets = append(secrets, ComposeSecret{Name: name})
+		}
+	}
+	return secrets
+}
+
+// ComposeSecretEnv returns the secrets compose commands on the instance take from their
+// environment. API keys mounted as compose secrets are also copied to the variables the
+// secrets read. Their own variables are kept: the app comes from the code-graph-rag compose
+// file and is not known to read <KEY>_FILE, so blanking them would start it without keys.
+func (c *DeployConfig) ComposeSecretEnv() (map[string]string, error) {
+	env, err := c.SecretEnv()
+	if err != nil {
+		return nil, err
+	}
+	for _, secret := range c.APIKeySecrets() {
+		env[secret.Source()] = env[secret.Name]
+	}
+	return env, nil
+}
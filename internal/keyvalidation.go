@@ -0,0 +1,135 @@
+package internal
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Provider endpoints that validate an API key without spending any quota
+const (
+	cohereCheckKeyURL  = "https://api.cohere.com/v1/check-api-key"
+	anthropicModelsURL = "https://api.anthropic.com/v1/models?limit=1"
+	anthropicVersion   = "2023-06-01"
+)
+
+// keyValidationTimeout bounds each validation request, so hosts without internet access do
+// not wait long before deploying anyway
+const keyValidationTimeout = 5 * time.Second
+
+var (
+	// ErrAPIKeyRejected is returned when a provider refuses an API key, e.g. because it was revoked
+	ErrAPIKeyRejected = errors.New("API key rejected")
+	// ErrProviderUnreachable is returned when a provider could not say whether a key is valid
+	ErrProviderUnreachable = errors.New("provider unreachable")
+)
+
+// APIKeyProvider returns the name of the provider an API key belongs to
+func APIKeyProvider(name string) string {
+	if name == AnthropicAPIKeyName {
+		return "Anthropic"
+	}
+	return "Cohere"
+}
+
+// CheckAPIKeyFormat reports API keys that are missing or cannot be valid, such as keys pasted
+// with surrounding quotes
+func CheckAPIKeyFormat(name, value string) error {
+	switch {
+	case value == "":
+		return fmt.Errorf("%s is not set", name)
+	case strings.ContainsAny(value, " \t\r\n\"'"):
+		return fmt.Errorf("%s is malformed: it contains whitespace or quotes", name)
+	case name == AnthropicAPIKeyName && !strings.HasPrefix(value, "sk-ant-"):
+		return fmt.Errorf("%s is malformed: Anthropic keys start with sk-ant-", name)
+	}
+	return nil
+}
+
+// ValidateAPIKey checks the format of an API key and then asks its provider whether it is
+// valid. Keys the provider refuses give ErrAPIKeyRejected; network failures and unexpected
+// responses give ErrProviderUnreachable.
+func ValidateAPIKey(ctx context.Context, name, value string) error {
+	if err := CheckAPIKeyFormat(name, value); err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, keyValidationTimeout)
+	defer cancel()
+
+	var req *http.Request
+	var err error
+	switch name {
+	case CoAPIKeyName:
+		req, err = http.NewRequestWithContext(ctx, http.MethodPost, cohereCheckKeyURL, nil)
+		if err == nil {
+			req.Header.Set("Authorization", "Bearer "+value)
+		}
+	case AnthropicAPIKeyName:
+		req, err = http.NewRequestWithContext(ctx, http.MethodGet, anthropicModelsURL, nil)
+		if err == nil {
+			req.Header.Set("x-api-key", value)
+			req.Header.Set("anthropic-version", anthropicVersion)
+		}
+	default:
+		_, err = ParseAPIKeyName(name)
+	}
+	if err != nil {
+		return err
+	}
+
+	provider := APIKeyProvider(name)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("%w: failed to reach %s: %v", ErrProviderUnreachable, provider, err)
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusUnauthorized, http.StatusForbidden:
+		return fmt.Errorf("%w: %s refused %s, it may have been revoked", ErrAPIKeyRejected, provider, name)
+	default:
+		return fmt.Errorf("%w: %s returned HTTP %d", ErrProviderUnreachable, provider, resp.StatusCode)
+	}
+
+	if name == CoAPIKeyName {
+		var result struct {
+			Valid bool `json:"valid"`
+		}
+		if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+			return fmt.Errorf("%w: unexpected response from %s: %v", ErrProviderUnreachable, provider, err)
+		}
+		if !result.Valid {
+			return fmt.Errorf("%w: %s refused %s, it may have been revoked", ErrAPIKeyRejected, provider, name)
+		}
+	}
+	return nil
+}
+
+// CheckDeployKeys validates the API keys an instance is about to be deployed with, so that a
+// missing, malformed or revoked key fails the deploy instead of leaving the app crash-looping.
+// Providers that cannot be reached are only warned about, so hosts without internet access
+// can still deploy. Instances with a local embedding model may run without keys.
+func CheckDeployKeys(ctx context.Context, config *DeployConfig) error {
+	keys := config.APIKeyEnv()
+	for _, name := range APIKeyNames {
+		if keys[name] == "" && config.LocalEmbeddings() != nil {
+			continue
+		}
+		err := ValidateAPIKey(ctx, name, keys[name])
+		switch {
+		case err == nil:
+			Log.Verbose("API key is valid", "key", name)
+		case errors.Is(err, ErrProviderUnreachable):
+			Log.Warning("Could not validate API key", "key", name, "error", err)
+		default:
+			return fmt.Errorf("%v. Store a valid key with 'graphsense-cli keys set %s'", err, name)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,66 @@
+package internal
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// labelKeyPattern is what instance label keys may look like, e.g. team or com.example.owner
+var labelKeyPattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]*$`)
+
+// reservedLabelPrefixes are label namespaces owned by Docker and Compose
+var reservedLabelPrefixes = []string{"com.docker.", "io.docker.", "org.dockerproject."}
+
+// ParseLabels parses key=value labels, as given to deploy --label
+func ParseLabels(values []string) (map[string]string, error) {
+	if len(values) == 0 {
+		return nil, nil
+	}
+	labels := make(map[string]string)
+	for _, value := range values {
+		key, val, ok := strings.Cut(value, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid label '%s': expected key=value", value)
+		}
+		if err := ValidateLabelKey(key); err != nil {
+			return nil, err
+		}
+		labels[key] = val
+	}
+	return labels, nil
+}
+
+// ValidateLabelKey checks that key can be used as an instance label and a Docker label
+func ValidateLabelKey(key string) error {
+	if !labelKeyPattern.MatchString(key) {
+		return fmt.Errorf("invalid label key '%s': use letters, digits, '.', '-' and '_'", key)
+	}
+	for _, prefix := range reservedLabelPrefixes {
+		if strings.HasPrefix(key, prefix) {
+			return fmt.Errorf("invalid label key '%s': the %s namespace is reserved for Docker", key, strings.TrimSuffix(prefix, "."))
+		}
+	}
+	return nil
+}
+
+// LabelKeys returns the keys of the instance's labels in order
+func (c *DeployConfig) LabelKeys() []string {
+	keys := make([]string, 0, len(c.Labels))
+	for key := range c.Labels {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// FormatLabels renders labels as key=value pairs in key order, e.g. "env=prod,team=backend"
+func FormatLabels(labels map[string]string) string {
+	config := DeployConfig{Labels: labels}
+	pairs := make([]string, 0, len(labels))
+	for _, key := range config.LabelKeys() {
+		pairs = append(pairs, key+"="+labels[key])
+	}
+	return strings.Join(pairs, ",")
+}
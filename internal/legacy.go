@@ -0,0 +1,369 @@
+package internal
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/filters"
+	"github.com/docker/docker/api/types/mount"
+)
+
+// Kinds of legacy artifacts
+const (
+	LegacyProject = "project"
+	LegacyEnvFile = "env-file"
+)
+
+// legacyVolumes maps the mount points of each service to the volume this CLI names
+// <instance>_<volume> for it
+var legacyVolumes = map[string]map[string]string{
+	"postgres": {"/var/lib/postgresql/data": "postgres_data"},
+	"neo4j": {
+		"/data":    "neo4j_data",
+		"/logs":    "neo4j_logs",
+		"/plugins": "neo4j_plugins",
+		"/conf":    "neo4j_conf",
+	},
+	"app": {"/app/.graphsense": "app_repos"},
+}
+
+// LegacyArtifact is something a deployment method older than this CLI left behind: a compose
+// project whose containers have compose's default names, or a per-instance env file the
+// deploy scripts wrote to ~/.graphsense
+type LegacyArtifact struct {
+	Kind string `json:"kind" yaml:"kind"`
+	// Name is the compose project or the path of the env file
+	Name string `json:"name" yaml:"name"`
+	// Instance is the name the project is migrated to
+	Instance string `json:"instance,omitempty" yaml:"instance,omitempty"`
+	Detail   string `json:"detail" yaml:"detail"`
+	// Volumes maps each legacy volume to the volume its data is copied to
+	Volumes map[string]string `json:"volumes,omitempty" yaml:"volumes,omitempty"`
+
+	config     *DeployConfig
+	containers []string
+	running    bool
+	keys       map[string]string
+}
+
+// FindLegacyArtifacts returns the legacy artifacts on this machine. Env files come first,
+// so their API keys are stored before the projects that need them are started again.
+func FindLegacyArtifacts() ([]LegacyArtifact, error) {
+	artifacts, err := findLegacyEnvFiles()
+	if err != nil {
+		return nil, err
+	}
+	projects, err := findLegacyProjects()
+	if err != nil {
+		return nil, err
+	}
+	return append(artifacts, projects...), nil
+}
+
+// WarnLegacyArtifacts logs a warning if legacy artifacts are found. Detection errors are
+// ignored, since the warning is only a hint.
+func WarnLegacyArtifacts() {
+	artifacts, err := FindLegacyArtifacts()
+	if err != nil || len(artifacts) == 0 {
+		return
+	}
+	Log.Warning("Found deployments from an older GraphSense setup, run 'graphsense-cli migrate-legacy' to manage them with this CLI", "artifacts", len(artifacts))
+}
+
+// findLegacyEnvFiles returns the env files in ~/.graphsense other than the API keys file
+func findLegacyEnvFiles() ([]LegacyArtifact, error) {
+	graphsenseDir, err := GetGraphsenseDir()
+	if err != nil {
+		return nil, err
+	}
+	paths, err := filepath.Glob(filepath.Join(graphsenseDir, "*.env"))
+	if err != nil {
+		return nil, err
+	}
+
+	var artifacts []LegacyArtifact
+	for _, path := range paths {
+		if filepath.Base(path) == ".env" {
+			continue
+		}
+		keys, err := readAPIKeysFile(path)
+		if err != nil {
+			return nil, err
+		}
+		detail := "no API keys"
+		if len(keys) > 0 {
+			names := make([]string, 0, len(keys))
+			for name := range keys {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+			detail = "API keys " + strings.Join(names, ", ")
+		}
+		artifacts = append(artifacts, LegacyArtifact{
+			Kind:   LegacyEnvFile,
+			Name:   path,
+			Detail: detail,
+			keys:   keys,
+		})
+	}
+	return artifacts, nil
+}
+
+// findLegacyProjects returns the GraphSense compose projects instances.db does not know whose
+// containers do not follow the <instance>-<service> naming of this CLI
+func findLegacyProjects() ([]LegacyArtifact, error) {
+	docker, err := GetDockerClient()
+	if err != nil {
+		return nil, err
+	}
+	containers, err := docker.ListContainers(context.Background(), true, filters.NewArgs(filters.Arg("label", ComposeProjectLabel)))
+	if err != nil {
+		return nil, err
+	}
+	projects := make(map[string][]types.Container)
+	for _, container := range containers {
+		project := container.Labels[ComposeProjectLabel]
+		if strings.Contains(project, "graphsense") || strings.Contains(ContainerName(container), "graphsense") {
+			projects[project] = append(projects[project], container)
+		}
+	}
+
+	names, err := GetInstanceNames()
+	if err != nil {
+		return nil, err
+	}
+	known := make(map[string]bool)
+	taken := make(map[string]bool)
+	for _, name := range names {
+		known[name] = true
+		taken[name] = true
+	}
+
+	var projectNames []string
+	for project, containers := range projects {
+		taken[project] = true
+		if !known[project] && isLegacyProject(project, containers) {
+			projectNames = append(projectNames, project)
+		}
+	}
+	sort.Strings(projectNames)
+
+	var artifacts []LegacyArtifact
+	for _, project := range projectNames {
+		artifact, err := legacyProjectArtifact(project, projects[project], taken)
+		if err != nil {
+			Log.Warning("Not migrating legacy compose project", "project", project, "reason", err)
+			continue
+		}
+		taken[artifact.Instance] = true
+		artifacts = append(artifacts, artifact)
+	}
+	return artifacts, nil
+}
+
+// isLegacyProject reports whether a compose project has containers that are not named
+// <project>-<service>, as every container this CLI creates is
+func isLegacyProject(project string, containers []types.Container) bool {
+	for _, container := range containers {
+		if ContainerName(container) != project+"-"+container.Labels[ComposeServiceLabel] {
+			return true
+		}
+	}
+	return false
+}
+
+// legacyProjectArtifact plans the migration of a legacy compose project
+func legacyProjectArtifact(project string, containers []types.Container, taken map[string]bool) (LegacyArtifact, error) {
+	// list and the other commands only pick up containers named graphsense-*
+	instanceName := strings.Trim(SanitizeInstanceName(project), "-")
+	if !strings.HasPrefix(instanceName, "graphsense-") {
+		suffix := strings.Trim(strings.TrimPrefix(instanceName, "graphsense"), "-")
+		if suffix == "" {
+			suffix = "legacy"
+		}
+		instanceName = "graphsense-" + suffix
+	}
+	if instanceName != project && taken[instanceName] {
+		instanceName = NextFreeInstanceName(instanceName)
+	}
+
+	config, err := adoptedConfig(instanceName, containers)
+	if err != nil {
+		return LegacyArtifact{}, err
+	}
+	if config.RepoPath == "" {
+		return LegacyArtifact{}, fmt.Errorf("the app container does not mount a repository at /home/repo")
+	}
+
+	artifact := LegacyArtifact{
+		Kind:     LegacyProject,
+		Name:     project,
+		Instance: instanceName,
+		Volumes:  make(map[string]string),
+		config:   config,
+	}
+	for _, container := range containers {
+		artifact.containers = append(artifact.containers, ContainerName(container))
+		if container.State == "running" {
+			artifact.running = true
+		}
+		targets := legacyVolumes[container.Labels[ComposeServiceLabel]]
+		for _, m := range container.Mounts {
+			volume, ok := targets[m.Destination]
+			if m.Type != mount.TypeVolume || !ok {
+				continue
+			}
+			if target := instanceName + "_" + volume; m.Name != target {
+				artifact.Volumes[m.Name] = target
+			}
+		}
+	}
+	sort.Strings(artifact.containers)
+
+	artifact.Detail = fmt.Sprintf("%d containers, %s mode, app port %d, repository %s", len(containers), config.DeployMode(), config.AppPort, config.RepoPath)
+	if len(artifact.Volumes) > 0 {
+		artifact.Detail += fmt.Sprintf(", %d volumes to copy", len(artifact.Volumes))
+	}
+	return artifact, nil
+}
+
+// MigrateLegacy adopts legacy artifacts, stopping at the first one that fails
+func MigrateLegacy(artifacts []LegacyArtifact) error {
+	for _, artifact := range artifacts {
+		var err error
+		switch artifact.Kind {
+		case LegacyEnvFile:
+			err = migrateLegacyEnvFile(artifact)
+		case LegacyProject:
+			err = migrateLegacyProject(artifact)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to migrate %s: %v", artifact.Name, err)
+		}
+	}
+	return nil
+}
+
+// migrateLegacyEnvFile stores the API keys of a legacy env file that are not stored yet and
+// renames the file to <file>.migrated, so it is no longer detected
+func migrateLegacyEnvFile(artifact LegacyArtifact) error {
+	current := make(map[string]string)
+	if coAPIKey, anthropicAPIKey, err := LoadAPIKeys(); err == nil {
+		current[CoAPIKeyName] = coAPIKey
+		current[AnthropicAPIKeyName] = anthropicAPIKey
+	}
+
+	store := make(map[string]string)
+	for name, value := range artifact.keys {
+		switch current[name] {
+		case "":
+			store[name] = value
+		case value:
+		default:
+			Log.Warning("Keeping the stored API key, the legacy env file has a different one", "key", name, "file", artifact.Name)
+		}
+	}
+	if len(store) > 0 {
+		location, err := StoreAPIKeys(store)
+		if err != nil {
+			return err
+		}
+		Log.Info("Stored API keys from legacy env file", "file", artifact.Name, "location", location)
+	}
+
+	if err := os.Chmod(artifact.Name, 0600); err != nil {
+		return err
+	}
+	return os.Rename(artifact.Name, artifact.Name+".migrated")
+}
+
+// migrateLegacyProject recreates the containers of a legacy compose project as an instance of
+// this CLI. Data in volumes with other names is copied to the volumes the instance uses; the
+// legacy volumes are kept, so nothing is lost if the new containers do not start.
+func migrateLegacyProject(artifact LegacyArtifact) error {
+	config := artifact.config
+	coAPIKey, anthropicAPIKey, err := LoadAPIKeys()
+	if err != nil {
+		return fmt.Errorf("failed to load API keys: %v", err)
+	}
+	config.CoAPIKey = coAPIKey
+	config.AnthropicAPIKey = anthropicAPIKey
+
+	docker, err := GetDockerClient()
+	if err != nil {
+		return err
+	}
+	ctx := context.Background()
+
+	Log.Info("Stopping legacy containers", "project", artifact.Name)
+	if err := docker.StopProject(ctx, artifact.Name); err != nil {
+		return err
+	}
+
+	sources := make([]string, 0, len(artifact.Volumes))
+	for source := range artifact.Volumes {
+		sources = append(sources, source)
+	}
+	sort.Strings(sources)
+	var created []string
+	for _, source := range sources {
+		target := artifact.Volumes[source]
+		existing, err := docker.ListVolumes(ctx, target)
+		if err != nil {
+			return err
+		}
+		for _, volume := range existing {
+			if volume == target {
+				RemoveVolumes(created)
+				return fmt.Errorf("volume %s already exists", target)
+			}
+		}
+		Log.Info("Copying volume", "from", source, "to", target)
+		if err := CopyVolume(source, target, config.InstanceName); err != nil {
+			RemoveVolumes(created)
+			return err
+		}
+		created = append(created, target)
+	}
+
+	// Recorded as failed until the new containers run, so a failed start can be retried
+	// with deploy --resume once the legacy containers are gone
+	if err := reserveAdoptedPorts(config); err != nil {
+		return err
+	}
+	if err := SaveDeployment(config, DeployStatusFailed); err != nil {
+		return err
+	}
+
+	for _, name := range artifact.containers {
+		if err := docker.RemoveContainer(ctx, name); err != nil {
+			return err
+		}
+	}
+	networks, err := docker.ProjectNetworks(ctx, artifact.Name)
+	if err != nil {
+		Log.Warning("Failed to list legacy networks", "error", err)
+	}
+	for _, network := range networks {
+		if err := docker.RemoveNetwork(ctx, network); err != nil {
+			Log.Warning("Failed to remove legacy network", "network", network, "error", err)
+		}
+	}
+
+	Log.Info("Starting migrated instance", "instance", config.InstanceName)
+	if err := StartServices(config); err != nil {
+		return fmt.Errorf("%v. Fix the problem and run 'graphsense-cli deploy --resume %s'", err, config.InstanceName)
+	}
+	if err := adoptInstance(config); err != nil {
+		return err
+	}
+	if !artifact.running {
+		return docker.StopProject(ctx, config.InstanceName)
+	}
+	return nil
+}
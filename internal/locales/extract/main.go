@@ -0,0 +1,270 @@
+// Command extract generates the English catalog from the messages in the CLI's source:
+// i18n.Message literals, log messages, command descriptions and flag help. It is run by
+// go generate in the internal package.
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// logMethods are the methods of internal.Logger whose first argument is a log message
+var logMethods = map[string]bool{
+	"Debug":   true,
+	"Verbose": true,
+	"Info":    true,
+	"Success": true,
+	"Warning": true,
+	"Error":   true,
+}
+
+// flagSets are the cobra methods returning the flag sets whose flags carry help
+var flagSets = map[string]bool{
+	"Flags":           true,
+	"PersistentFlags": true,
+	"LocalFlags":      true,
+}
+
+// extractor collects the messages of a set of Go files by message ID
+type extractor struct {
+	fset     *token.FileSet
+	messages map[string]string
+	errs     []string
+}
+
+func main() {
+	output := flag.String("o", "", "file to write the catalog to (default: stdout)")
+	flag.Parse()
+
+	e := &extractor{fset: token.NewFileSet(), messages: make(map[string]string)}
+	for _, dir := range flag.Args() {
+		if err := e.extractDir(dir); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+	}
+	if len(e.errs) > 0 {
+		fmt.Fprintln(os.Stderr, strings.Join(e.errs, "\n"))
+		os.Exit(1)
+	}
+
+	data, err := e.catalog()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	if *output == "" {
+		os.Stdout.Write(data)
+		return
+	}
+	if err := os.WriteFile(*output, data, 0644); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+// extractDir collects the messages of the non-test Go files of a directory
+func (e *extractor) extractDir(dir string) error {
+	paths, err := filepath.Glob(filepath.Join(dir, "*.go"))
+	if err != nil {
+		return err
+	}
+	for _, path := range paths {
+		if strings.HasSuffix(path, "_test.go") {
+			continue
+		}
+		file, err := parser.ParseFile(e.fset, path, nil, 0)
+		if err != nil {
+			return err
+		}
+		ast.Inspect(file, e.visit)
+	}
+	return nil
+}
+
+// visit collects the messages of one node of a syntax tree
+func (e *extractor) visit(node ast.Node) bool {
+	switch node := node.(type) {
+	case *ast.CompositeLit:
+		switch typeName(node.Type) {
+		case "i18n.Message":
+			var id, other string
+			for _, field := range keyedFields(node) {
+				switch field.name {
+				case "ID":
+					id, _ = stringValue(field.value)
+				case "Other":
+					other, _ = stringValue(field.value)
+				}
+			}
+			if id == "" || other == "" {
+				e.errs = append(e.errs, fmt.Sprintf("%s: i18n.Message needs a constant ID and Other", e.fset.Position(node.Pos())))
+				return true
+			}
+			e.add(node, id, other)
+		case "cobra.Command":
+			for _, field := range keyedFields(node) {
+				if field.name == "Short" || field.name == "Long" {
+					if text, ok := stringValue(field.value); ok {
+						e.add(node, text, text)
+					}
+				}
+			}
+		}
+	case *ast.CallExpr:
+		selector, ok := node.Fun.(*ast.SelectorExpr)
+		if !ok || len(node.Args) == 0 {
+			if ident, ok := node.Fun.(*ast.Ident); ok && ident.Name == "LogMessage" && len(node.Args) == 1 {
+				e.addText(node, node.Args[0])
+			}
+			return true
+		}
+		switch {
+		case selector.Sel.Name == "LogMessage":
+			e.addText(node, node.Args[0])
+		case logMethods[selector.Sel.Name] && isLog(selector.X):
+			e.addText(node, node.Args[0])
+		case isFlagSet(selector.X) && len(node.Args) >= 3:
+			// Flags are defined with their name, default value and help, in that order
+			e.addText(node, node.Args[len(node.Args)-1])
+		}
+	}
+	return true
+}
+
+// addText adds a message that is its own ID, if it is a constant
+func (e *extractor) addText(node ast.Node, expr ast.Expr) {
+	if text, ok := stringValue(expr); ok && text != "" {
+		e.add(node, text, text)
+	}
+}
+
+// add adds a message, reporting IDs used for two different texts
+func (e *extractor) add(node ast.Node, id, text string) {
+	if existing, ok := e.messages[id]; ok && existing != text {
+		e.errs = append(e.errs, fmt.Sprintf("%s: message %s already has another text", e.fset.Position(node.Pos()), id))
+		return
+	}
+	e.messages[id] = text
+}
+
+// catalog renders the messages as a go-i18n YAML catalog, sorted by ID
+func (e *extractor) catalog() ([]byte, error) {
+	ids := make([]string, 0, len(e.messages))
+	for id := range e.messages {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	messages := &yaml.Node{Kind: yaml.MappingNode}
+	for _, id := range ids {
+		messages.Content = append(messages.Content,
+			&yaml.Node{Kind: yaml.ScalarNode, Value: id},
+			&yaml.Node{Kind: yaml.ScalarNode, Value: e.messages[id]})
+	}
+
+	var b bytes.Buffer
+	b.WriteString("# Code generated by go generate; DO NOT EDIT.\n")
+	b.WriteString("# English messages of graphsense-cli by message ID, the source of every translation\n")
+	encoder := yaml.NewEncoder(&b)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(messages); err != nil {
+		return nil, err
+	}
+	if err := encoder.Close(); err != nil {
+		return nil, err
+	}
+	return b.Bytes(), nil
+}
+
+// keyedField is a field of a composite literal
+type keyedField struct {
+	name  string
+	value ast.Expr
+}
+
+// keyedFields returns the fields of a composite literal written as Name: value
+func keyedFields(lit *ast.CompositeLit) []keyedField {
+	var fields []keyedField
+	for _, elt := range lit.Elts {
+		kv, ok := elt.(*ast.KeyValueExpr)
+		if !ok {
+			continue
+		}
+		if key, ok := kv.Key.(*ast.Ident); ok {
+			fields = append(fields, keyedField{name: key.Name, value: kv.Value})
+		}
+	}
+	return fields
+}
+
+// typeName returns a type written as pkg.Name, or ""
+func typeName(expr ast.Expr) string {
+	selector, ok := expr.(*ast.SelectorExpr)
+	if !ok {
+		return ""
+	}
+	pkg, ok := selector.X.(*ast.Ident)
+	if !ok {
+		return ""
+	}
+	return pkg.Name + "." + selector.Sel.Name
+}
+
+// isLog reports whether expr is the Log logger, as Log or internal.Log
+func isLog(expr ast.Expr) bool {
+	switch expr := expr.(type) {
+	case *ast.Ident:
+		return expr.Name == "Log"
+	case *ast.SelectorExpr:
+		return expr.Sel.Name == "Log"
+	}
+	return false
+}
+
+// isFlagSet reports whether expr is a call returning a command's flag set, as in
+// cmd.Flags().StringVar(...)
+func isFlagSet(expr ast.Expr) bool {
+	call, ok := expr.(*ast.CallExpr)
+	if !ok {
+		return false
+	}
+	selector, ok := call.Fun.(*ast.SelectorExpr)
+	return ok && flagSets[selector.Sel.Name]
+}
+
+// stringValue returns the value of a string literal or a concatenation of string literals
+func stringValue(expr ast.Expr) (string, bool) {
+	switch expr := expr.(type) {
+	case *ast.BasicLit:
+		if expr.Kind != token.STRING {
+			return "", false
+		}
+		value, err := strconv.Unquote(expr.Value)
+		return value, err == nil
+	case *ast.BinaryExpr:
+		if expr.Op != token.ADD {
+			return "", false
+		}
+		left, ok := stringValue(expr.X)
+		if !ok {
+			return "", false
+		}
+		right, ok := stringValue(expr.Y)
+		return left + right, ok
+	case *ast.ParenExpr:
+		return stringValue(expr.X)
+	}
+	return "", false
+}
@@ -0,0 +1,186 @@
+package internal
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// globalLockName is the lock every operation on an instance holds shared and operations on
+// the whole machine, such as uninstall and cleanup, hold exclusively
+const globalLockName = "global"
+
+// lockPollInterval is how often a busy lock is tried again while waiting for it
+const lockPollInterval = 250 * time.Millisecond
+
+var (
+	// LockWait is how long acquiring a lock held by another process waits before giving up,
+	// set with --wait. Zero fails right away.
+	LockWait time.Duration
+	// LockOwner describes this process to others waiting for its locks, e.g. "graphsense-cli deploy"
+	LockOwner = "graphsense-cli"
+)
+
+// LockedError is returned when another process holds a lock and it did not become free in time
+type LockedError struct {
+	// Instance is the instance the lock protects, or "" for the global lock
+	Instance string
+	// Holder describes the process holding the lock, if it is known
+	Holder string
+}
+
+func (e *LockedError) Error() string {
+	subject := "another graphsense-cli operation is in progress"
+	if e.Instance != "" {
+		subject = fmt.Sprintf("another operation is in progress on instance '%s'", e.Instance)
+	}
+	if e.Holder != "" {
+		subject += " (" + e.Holder + ")"
+	}
+	return subject + ". Wait for it to finish or retry with --wait, e.g. --wait 5m"
+}
+
+// heldLock is a lock file this process holds, shared by every caller that acquired it
+type heldLock struct {
+	file      *os.File
+	exclusive bool
+	count     int
+}
+
+var (
+	heldLocksMu sync.Mutex
+	heldLocks   = make(map[string]*heldLock)
+)
+
+// LockInstance acquires the lock of an instance, and the global lock shared, so that no other
+// process changes the instance or runs a machine-wide operation until release is called.
+// Acquiring a lock this process already holds succeeds right away.
+func LockInstance(instanceName string) (release func(), err error) {
+	releaseGlobal, err := acquireLock(globalLockName, false, "")
+	if err != nil {
+		return nil, err
+	}
+	releaseInstance, err := acquireLock("instance-"+instanceName, true, instanceName)
+	if err != nil {
+		releaseGlobal()
+		return nil, err
+	}
+	return func() {
+		releaseInstance()
+		releaseGlobal()
+	}, nil
+}
+
+// LockGlobal acquires the global lock exclusively, waiting for every operation on an instance
+// to finish and keeping new ones from starting until release is called
+func LockGlobal() (release func(), err error) {
+	return acquireLock(globalLockName, true, "")
+}
+
+// ReleaseLocks releases every lock this process still holds
+func ReleaseLocks() {
+	heldLocksMu.Lock()
+	defer heldLocksMu.Unlock()
+	for name, held := range heldLocks {
+		unlockFile(held)
+		delete(heldLocks, name)
+	}
+}
+
+// acquireLock locks ~/.graphsense/locks/<name>.lock, waiting up to LockWait while another
+// process holds it. instance names the instance the lock protects in errors.
+func acquireLock(name string, exclusive bool, instance string) (func(), error) {
+	heldLocksMu.Lock()
+	defer heldLocksMu.Unlock()
+
+	if held, ok := heldLocks[name]; ok {
+		if exclusive && !held.exclusive {
+			return nil, fmt.Errorf("cannot lock %s exclusively while holding it shared", name)
+		}
+		held.count++
+		return releaseFunc(name, held), nil
+	}
+
+	graphsenseDir, err := GetGraphsenseDir()
+	if err != nil {
+		return nil, err
+	}
+	dir := filepath.Join(graphsenseDir, "locks")
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create lock directory: %v", err)
+	}
+	file, err := os.OpenFile(filepath.Join(dir, name+".lock"), os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open lock file: %v", err)
+	}
+
+	deadline := time.Now().Add(LockWait)
+	waiting := false
+	for {
+		locked, err := tryLockFile(file, exclusive)
+		if err != nil {
+			file.Close()
+			return nil, fmt.Errorf("failed to lock %s: %v", file.Name(), err)
+		}
+		if locked {
+			break
+		}
+		holder := lockHolder(file)
+		if !time.Now().Before(deadline) {
+			file.Close()
+			return nil, &LockedError{Instance: instance, Holder: holder}
+		}
+		if !waiting {
+			waiting = true
+			Log.Info("Waiting for another operation to finish", "lock", name, "holder", holder)
+		}
+		time.Sleep(lockPollInterval)
+	}
+
+	// Exclusive holders say who they are; shared holders cannot all write the file at once
+	if exclusive {
+		file.Truncate(0)
+		file.WriteAt([]byte(fmt.Sprintf("%s, pid %d, since %s", LockOwner, os.Getpid(), time.Now().Format(time.RFC3339))), 0)
+	}
+
+	held := &heldLock{file: file, exclusive: exclusive, count: 1}
+	heldLocks[name] = held
+	return releaseFunc(name, held), nil
+}
+
+// releaseFunc returns the function that gives up one acquisition of a held lock, unlocking it
+// with the last one
+func releaseFunc(name string, held *heldLock) func() {
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			heldLocksMu.Lock()
+			defer heldLocksMu.Unlock()
+			held.count--
+			if held.count == 0 && heldLocks[name] == held {
+				unlockFile(held)
+				delete(heldLocks, name)
+			}
+		})
+	}
+}
+
+// unlockFile clears the holder of an exclusive lock and unlocks and closes its file
+func unlockFile(held *heldLock) {
+	if held.exclusive {
+		held.file.Truncate(0)
+	}
+	unlockLockFile(held.file)
+	held.file.Close()
+}
+
+// lockHolder returns the description the exclusive holder of a lock file left, or "" if it is
+// held shared
+func lockHolder(file *os.File) string {
+	data := make([]byte, 256)
+	n, _ := file.ReadAt(data, 0)
+	return strings.TrimSpace(string(data[:n]))
+}
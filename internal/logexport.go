@@ -0,0 +1,228 @@
+package internal
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultLogExportMaxFiles is how many files, including the current one, are kept per service
+	DefaultLogExportMaxFiles = 5
+
+	// logMirrorRetry is how long a mirror waits before reattaching to a stopped or recreated container
+	logMirrorRetry = 2 * time.Second
+)
+
+// LogExportOptions controls where and how service logs are exported
+type LogExportOptions struct {
+	// Dir receives a directory per instance with a <service>.log file per service
+	Dir        string
+	Since      string
+	Tail       string
+	Timestamps bool
+	// MaxSize and MaxFiles bound the files kept per service
+	MaxSize  int64
+	MaxFiles int
+}
+
+// logPath returns the export file of a source
+func (o LogExportOptions) logPath(source LogSource) string {
+	return filepath.Join(o.Dir, source.Instance, source.Service+".log")
+}
+
+// dockerLogArgs returns the docker logs arguments for a source
+func (o LogExportOptions) dockerLogArgs(source LogSource, follow bool, since string) []string {
+	args := []string{"logs"}
+	if follow {
+		args = append(args, "--follow")
+	}
+	if since != "" {
+		args = append(args, "--since", since)
+	}
+	if o.Tail != "" && o.Tail != "all" {
+		args = append(args, "--tail", o.Tail)
+	}
+	if o.Timestamps {
+		args = append(args, "--timestamps")
+	}
+	return append(args, source.Container)
+}
+
+// ExportLogs writes a snapshot of the logs of every source to its export file and returns
+// the files written. Earlier exports are rotated rather than overwritten.
+func ExportLogs(ctx context.Context, sources []LogSource, options LogExportOptions) ([]string, error) {
+	var files []string
+	for _, source := range sources {
+		path := options.logPath(source)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			return files, fmt.Errorf("failed to create log directory: %v", err)
+		}
+		if err := rotateLogFiles(path, options.MaxFiles); err != nil {
+			return files, err
+		}
+
+		file, err := os.Create(path)
+		if err != nil {
+			return files, fmt.Errorf("failed to create %s: %v", path, err)
+		}
+		// docker logs replays the container's stdout and stderr on the matching streams
+		cmd := CommandContext(ctx, "docker", options.dockerLogArgs(source, false, options.Since)...)
+		cmd.Stdout = file
+		cmd.Stderr = file
+		err = cmd.Run()
+		file.Close()
+		if err != nil {
+			return files, fmt.Errorf("failed to read logs of %s: %v", source.Container, err)
+		}
+		files = append(files, path)
+	}
+	return files, nil
+}
+
+// MirrorLogs follows the logs of every source into its export file, rotating files that grow
+// past MaxSize, until ctx is done. A container that stops or is recreated is reattached to,
+// continuing from where its previous stream ended.
+func MirrorLogs(ctx context.Context, sources []LogSource, options LogExportOptions) error {
+	writers := make([]*rotatingWriter, len(sources))
+	for i, source := range sources {
+		path := options.logPath(source)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			return fmt.Errorf("failed to create log directory: %v", err)
+		}
+		writer, err := openRotatingWriter(path, options.MaxSize, options.MaxFiles)
+		if err != nil {
+			return err
+		}
+		defer writer.Close()
+		writers[i] = writer
+	}
+
+	var wg sync.WaitGroup
+	for i, source := range sources {
+		wg.Add(1)
+		go func(source LogSource, writer *rotatingWriter) {
+			defer wg.Done()
+			since := options.Since
+			for ctx.Err() == nil {
+				if err := copyLogStream(ctx, source, options.dockerLogArgs(source, true, since), writer); err != nil && ctx.Err() == nil {
+					Log.Debug("Log stream ended", "container", source.Container, "error", err)
+				}
+				since = time.Now().UTC().Format(time.RFC3339Nano)
+				select {
+				case <-ctx.Done():
+				case <-time.After(logMirrorRetry):
+				}
+			}
+		}(source, writers[i])
+	}
+	wg.Wait()
+	return nil
+}
+
+// copyLogStream runs docker logs and writes its output to writer line by line
+func copyLogStream(ctx context.Context, source LogSource, args []string, writer *rotatingWriter) error {
+	reader, pipe, err := os.Pipe()
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+
+	cmd := CommandContext(ctx, "docker", args...)
+	cmd.Stdout = pipe
+	cmd.Stderr = pipe
+	if err := cmd.Start(); err != nil {
+		pipe.Close()
+		return err
+	}
+	pipe.Close()
+
+	scanner := bufio.NewScanner(reader)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		if _, err := writer.WriteLine(scanner.Bytes()); err != nil {
+			Log.Warning("Failed to write log export", "file", writer.path, "error", err)
+		}
+	}
+	return cmd.Wait()
+}
+
+// rotatingWriter appends lines to a file, rotating it once it reaches maxSize
+type rotatingWriter struct {
+	path     string
+	maxSize  int64
+	maxFiles int
+	file     *os.File
+	size     int64
+}
+
+func openRotatingWriter(path string, maxSize int64, maxFiles int) (*rotatingWriter, error) {
+	w := &rotatingWriter{path: path, maxSize: maxSize, maxFiles: maxFiles}
+	if err := w.open(); err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+func (w *rotatingWriter) open() error {
+	file, err := os.OpenFile(w.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to open %s: %v", w.path, err)
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+	w.file, w.size = file, info.Size()
+	return nil
+}
+
+// WriteLine writes line with a trailing newline, rotating first if it would not fit
+func (w *rotatingWriter) WriteLine(line []byte) (int, error) {
+	if w.maxSize > 0 && w.size > 0 && w.size+int64(len(line))+1 > w.maxSize {
+		w.file.Close()
+		if err := rotateLogFiles(w.path, w.maxFiles); err != nil {
+			return 0, err
+		}
+		if err := w.open(); err != nil {
+			return 0, err
+		}
+	}
+	n, err := w.file.Write(append(append([]byte{}, line...), '\n'))
+	w.size += int64(n)
+	return n, err
+}
+
+func (w *rotatingWriter) Close() error {
+	return w.file.Close()
+}
+
+// rotateLogFiles shifts path to path.1, path.1 to path.2 and so on, keeping maxFiles files
+// including path itself
+func rotateLogFiles(path string, maxFiles int) error {
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		return nil
+	}
+	if maxFiles <= 1 {
+		return os.Remove(path)
+	}
+
+	os.Remove(fmt.Sprintf("%s.%d", path, maxFiles-1))
+	for i := maxFiles - 2; i >= 1; i-- {
+		older := fmt.Sprintf("%s.%d", path, i)
+		if _, err := os.Stat(older); err == nil {
+			if err := os.Rename(older, fmt.Sprintf("%s.%d", path, i+1)); err != nil {
+				return fmt.Errorf("failed to rotate %s: %v", older, err)
+			}
+		}
+	}
+	if err := os.Rename(path, path+".1"); err != nil {
+		return fmt.Errorf("failed to rotate %s: %v", path, err)
+	}
+	return nil
+}
@@ -0,0 +1,207 @@
+package internal
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+	"sync"
+)
+
+// Log formats accepted by --log-format
+const (
+	LogFormatText = "text"
+	LogFormatJSON = "json"
+)
+
+// LevelSuccess sits between info and warning so success messages survive the same filters as info
+const LevelSuccess = slog.Level(2)
+
+// LevelVerbose sits between debug and info for detail shown with --verbose
+const LevelVerbose = slog.Level(-2)
+
+// logLevel is the minimum level written by Log, shared by the text and JSON handlers
+var logLevel = new(slog.LevelVar)
+
+// Logger writes leveled, structured log records through a slog handler.
+// Messages are plain text; details go in key/value fields such as "instance", name.
+type Logger struct {
+	logger *slog.Logger
+}
+
+// NewLogger returns a Logger writing records to handler
+func NewLogger(handler slog.Handler) *Logger {
+	return &Logger{logger: slog.New(handler)}
+}
+
+// With returns a Logger that adds fields to every record
+func (l *Logger) With(args ...any) *Logger {
+	return &Logger{logger: l.logger.With(args...)}
+}
+
+func (l *Logger) Debug(msg string, args ...any) {
+	l.logger.Log(context.Background(), slog.LevelDebug, msg, args...)
+}
+
+func (l *Logger) Verbose(msg string, args ...any) {
+	l.logger.Log(context.Background(), LevelVerbose, msg, args...)
+}
+
+func (l *Logger) Info(msg string, args ...any) {
+	l.logger.Log(context.Background(), slog.LevelInfo, msg, args...)
+}
+
+func (l *Logger) Success(msg string, args ...any) {
+	l.logger.Log(context.Background(), LevelSuccess, msg, args...)
+}
+
+func (l *Logger) Warning(msg string, args ...any) {
+	l.logger.Log(context.Background(), slog.LevelWarn, msg, args...)
+}
+
+func (l *Logger) Error(msg string, args ...any) {
+	l.logger.Log(context.Background(), slog.LevelError, msg, args...)
+}
+
+var Log = NewLogger(NewTextHandler(os.Stdout, logLevel))
+
+// SetLogLevel sets the minimum level of records written by Log
+func SetLogLevel(level slog.Level) {
+	logLevel.Set(level)
+}
+
+// SetLogFormat switches Log to the text or JSON format. JSON records go to stderr
+// so they never mix with machine-readable command output on stdout.
+func SetLogFormat(format string) error {
+	switch format {
+	case "", LogFormatText:
+		Log.logger = slog.New(NewTextHandler(os.Stdout, logLevel))
+	case LogFormatJSON:
+		Log.logger = slog.New(slog.NewJSONHandler(os.Stderr, &slog.HandlerOptions{Level: logLevel, ReplaceAttr: replaceLevel}))
+	default:
+		return fmt.Errorf("invalid log format '%s': must be text or json", format)
+	}
+	return nil
+}
+
+// replaceLevel names LevelSuccess and LevelVerbose in JSON records instead of slog's default "INFO+2" and "DEBUG+2"
+func replaceLevel(groups []string, attr slog.Attr) slog.Attr {
+	if attr.Key == slog.LevelKey && len(groups) == 0 {
+		if level, ok := attr.Value.Any().(slog.Level); ok {
+			switch level {
+			case LevelSuccess:
+				attr.Value = slog.StringValue("SUCCESS")
+			case LevelVerbose:
+				attr.Value = slog.StringValue("VERBOSE")
+			}
+		}
+	}
+	return attr
+}
+
+// TextHandler writes records in the colored "[LEVEL] message key=value" format, with messages
+// translated into the selected language
+type TextHandler struct {
+	mu     *sync.Mutex
+	out    io.Writer
+	level  slog.Leveler
+	attrs  []slog.Attr
+	prefix string
+}
+
+// NewTextHandler returns a TextHandler writing records of at least level to out
+func NewTextHandler(out io.Writer, level slog.Leveler) *TextHandler {
+	return &TextHandler{mu: &sync.Mutex{}, out: out, level: level}
+}
+
+// Enabled reports whether the handler handles records at level
+func (h *TextHandler) Enabled(_ context.Context, level slog.Level) bool {
+	return level >= h.level.Level()
+}
+
+// Handle writes one record
+func (h *TextHandler) Handle(_ context.Context, record slog.Record) error {
+	var b strings.Builder
+	b.WriteString(levelLabel(record.Level))
+	b.WriteString(" ")
+	b.WriteString(T(record.Message))
+
+	for _, attr := range h.attrs {
+		writeAttr(&b, "", attr)
+	}
+	record.Attrs(func(attr slog.Attr) bool {
+		writeAttr(&b, h.prefix, attr)
+		return true
+	})
+	b.WriteString("\n")
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	_, err := io.WriteString(h.out, b.String())
+	return err
+}
+
+// WithAttrs returns a handler that adds attrs to every record
+func (h *TextHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	clone := *h
+	clone.attrs = append([]slog.Attr{}, h.attrs...)
+	for _, attr := range attrs {
+		attr.Key = h.prefix + attr.Key
+		clone.attrs = append(clone.attrs, attr)
+	}
+	return &clone
+}
+
+// WithGroup returns a handler that qualifies the keys of later attrs with name
+func (h *TextHandler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
+	clone := *h
+	clone.prefix = h.prefix + name + "."
+	return &clone
+}
+
+// levelLabel returns the colored label of a level
+func levelLabel(level slog.Level) string {
+	switch {
+	case level >= slog.LevelError:
+		return Colorize(ColorRed, "[ERROR]")
+	case level >= slog.LevelWarn:
+		return Colorize(ColorYellow, "[WARNING]")
+	case level >= LevelSuccess:
+		return Colorize(ColorGreen, "[SUCCESS]")
+	case level >= slog.LevelInfo:
+		return Colorize(ColorBlue, "[INFO]")
+	case level >= LevelVerbose:
+		return Colorize(ColorCyan, "[VERBOSE]")
+	default:
+		return Colorize(ColorGray, "[DEBUG]")
+	}
+}
+
+// writeAttr appends " key=value" for attr, flattening groups into dotted keys
+func writeAttr(b *strings.Builder, prefix string, attr slog.Attr) {
+	attr.Value = attr.Value.Resolve()
+	if attr.Equal(slog.Attr{}) {
+		return
+	}
+
+	if attr.Value.Kind() == slog.KindGroup {
+		if attr.Key != "" {
+			prefix += attr.Key + "."
+		}
+		for _, member := range attr.Value.Group() {
+			writeAttr(b, prefix, member)
+		}
+		return
+	}
+
+	value := attr.Value.String()
+	if strings.ContainsAny(value, " \t\"=") || value == "" {
+		value = fmt.Sprintf("%q", value)
+	}
+	fmt.Fprintf(b, " %s%s=%s", prefix, attr.Key, value)
+}
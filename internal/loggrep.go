@@ -0,0 +1,157 @@
+package internal
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// logGrepWorkers bounds how many container logs are searched at once
+const logGrepWorkers = 8
+
+// LogSource is one container whose logs are searched
+type LogSource struct {
+	Instance  string
+	Service   string
+	Container string
+}
+
+// LogMatch is a log line that matched a search
+type LogMatch struct {
+	Instance string `json:"instance" yaml:"instance"`
+	Service  string `json:"service" yaml:"service"`
+	Line     string `json:"line" yaml:"line"`
+}
+
+// GetLogSources returns the containers, running or stopped, of the given instances
+func GetLogSources(instanceNames []string) ([]LogSource, error) {
+	docker, err := GetDockerClient()
+	if err != nil {
+		return nil, err
+	}
+
+	var sources []LogSource
+	for _, instanceName := range instanceNames {
+		containers, err := docker.ProjectContainers(context.Background(), instanceName)
+		if err != nil {
+			return nil, err
+		}
+		for _, c := range containers {
+			sources = append(sources, LogSource{
+				Instance:  instanceName,
+				Service:   c.Labels[ComposeServiceLabel],
+				Container: ContainerName(c),
+			})
+		}
+	}
+	return sources, nil
+}
+
+// GrepLogs searches the logs of sources written within since for pattern, several containers
+// at a time. Matches are grouped by instance and service, in log order within each container.
+// Containers whose logs cannot be read are reported in the returned errors and skipped.
+func GrepLogs(ctx context.Context, sources []LogSource, pattern *regexp.Regexp, since time.Duration) ([]LogMatch, []error) {
+	results := make([][]LogMatch, len(sources))
+	errs := make([]error, len(sources))
+
+	var wg sync.WaitGroup
+	slots := make(chan struct{}, logGrepWorkers)
+	for i, source := range sources {
+		wg.Add(1)
+		go func(i int, source LogSource) {
+			defer wg.Done()
+			slots <- struct{}{}
+			defer func() { <-slots }()
+			results[i], errs[i] = grepContainerLogs(ctx, source, pattern, since)
+		}(i, source)
+	}
+	wg.Wait()
+
+	order := make([]int, len(sources))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(a, b int) bool {
+		sa, sb := sources[order[a]], sources[order[b]]
+		if sa.Instance != sb.Instance {
+			return sa.Instance < sb.Instance
+		}
+		return sa.Service < sb.Service
+	})
+
+	var matches []LogMatch
+	var failures []error
+	for _, i := range order {
+		matches = append(matches, results[i]...)
+		if errs[i] != nil {
+			failures = append(failures, errs[i])
+		}
+	}
+	return matches, failures
+}
+
+// grepContainerLogs streams the logs of one container through pattern
+func grepContainerLogs(ctx context.Context, source LogSource, pattern *regexp.Regexp, since time.Duration) ([]LogMatch, error) {
+	reader, writer, err := os.Pipe()
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+
+	// docker logs replays the container's stdout and stderr on the matching streams
+	cmd := CommandContext(ctx, "docker", "logs", "--timestamps", "--since", since.String(), source.Container)
+	cmd.Stdout = writer
+	cmd.Stderr = writer
+	if err := cmd.Start(); err != nil {
+		writer.Close()
+		return nil, fmt.Errorf("failed to read logs of %s: %v", source.Container, err)
+	}
+	writer.Close()
+
+	var matches []LogMatch
+	scanner := bufio.NewScanner(reader)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if pattern.MatchString(line) {
+			matches = append(matches, LogMatch{Instance: source.Instance, Service: source.Service, Line: strings.TrimRight(line, "\r")})
+		}
+	}
+	scanErr := scanner.Err()
+
+	if err := cmd.Wait(); err != nil {
+		return matches, fmt.Errorf("failed to read logs of %s: %v", source.Container, err)
+	}
+	if scanErr != nil {
+		return matches, fmt.Errorf("failed to read logs of %s: %v", source.Container, scanErr)
+	}
+	return matches, nil
+}
+
+// TailLogs returns the last tail lines of each source, merged in timestamp order.
+// Every line starts with the RFC 3339 timestamp Docker recorded for it.
+func TailLogs(ctx context.Context, sources []LogSource, tail int) ([]LogMatch, error) {
+	var lines []LogMatch
+	for _, source := range sources {
+		output, err := CommandContext(ctx, "docker", "logs", "--timestamps", "--tail", fmt.Sprintf("%d", tail), source.Container).CombinedOutput()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read logs of %s: %v", source.Container, err)
+		}
+		for _, line := range strings.Split(strings.TrimRight(string(output), "\n"), "\n") {
+			if line != "" {
+				lines = append(lines, LogMatch{Instance: source.Instance, Service: source.Service, Line: line})
+			}
+		}
+	}
+
+	sort.SliceStable(lines, func(i, j int) bool {
+		return lines[i].Line < lines[j].Line
+	})
+	return lines, nil
+}
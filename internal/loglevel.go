@@ -0,0 +1,97 @@
+package internal
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// DefaultAppLogLevel is the LOG_LEVEL instances are deployed with
+const DefaultAppLogLevel = "info"
+
+// AppLogLevels are the LOG_LEVEL values the app accepts
+var AppLogLevels = []string{"debug", "info", "warn"}
+
+// ErrNoAdminAPI is returned when the app of an instance has no admin API to reconfigure it at runtime
+var ErrNoAdminAPI = errors.New("admin API not available")
+
+// AppLogLevel returns the LOG_LEVEL of the instance's app
+func (c *DeployConfig) AppLogLevel() string {
+	if c.LogLevel == "" {
+		return DefaultAppLogLevel
+	}
+	return c.LogLevel
+}
+
+// ValidateAppLogLevel checks that level is one of AppLogLevels
+func ValidateAppLogLevel(level string) error {
+	for _, valid := range AppLogLevels {
+		if level == valid {
+			return nil
+		}
+	}
+	return fmt.Errorf("invalid log level '%s': must be one of %s", level, strings.Join(AppLogLevels, ", "))
+}
+
+// SetAppLogLevelAPI changes the log level of a running app through its admin API.
+// It returns ErrNoAdminAPI when the app version does not serve the endpoint.
+func SetAppLogLevelAPI(config *DeployConfig, level string) error {
+	body, err := json.Marshal(map[string]string{"level": level})
+	if err != nil {
+		return err
+	}
+
+	url := config.AppURL() + "/admin/log-level"
+	req, err := http.NewRequest(http.MethodPut, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := config.AppClient().Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to reach admin API: %v", err)
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusNotFound || resp.StatusCode == http.StatusMethodNotAllowed:
+		return ErrNoAdminAPI
+	case resp.StatusCode >= 300:
+		return fmt.Errorf("admin API returned HTTP %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// RecreateApp recreates only the app container of an instance so it picks up a changed
+// configuration. The databases keep running.
+func RecreateApp(config *DeployConfig) error {
+	if config.IsSingleContainer() {
+		docker, err := GetDockerClient()
+		if err != nil {
+			return err
+		}
+		if err := docker.RemoveContainer(context.Background(), config.InstanceName+"-app"); err != nil {
+			return err
+		}
+		return RunSingleContainer(config)
+	}
+
+	files, err := PrepareComposeFiles(config)
+	if err != nil {
+		return err
+	}
+	defer files.Cleanup()
+
+	envVars := map[string]string{
+		"COMPOSE_PROJECT_NAME": config.InstanceName,
+	}
+	if err := RunDockerCompose(files.Args("up", "-d", "--no-deps", "--force-recreate", "app"), files.Env(envVars)); err != nil {
+		return fmt.Errorf("failed to recreate app service: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,243 @@
+package internal
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+// MCPClients are the MCP clients mcp-config writes server entries for
+var MCPClients = []string{"claude-desktop", "cursor", "vscode"}
+
+// mcpClientAliases are short names accepted for MCP clients
+var mcpClientAliases = map[string]string{"claude": "claude-desktop"}
+
+// mcpClient describes where an MCP client keeps its server entries and what they look like
+type mcpClient struct {
+	// serversKey is the top-level key of the config file mapping server names to entries
+	serversKey string
+	// path returns the config file the client reads
+	path func() (string, error)
+	// entry returns the server entry pointing at an instance's MCP endpoint
+	entry func(config *DeployConfig) (map[string]interface{}, error)
+}
+
+var mcpClients = map[string]mcpClient{
+	// Claude Desktop only starts local servers, so mcp-remote bridges to the HTTP endpoint
+	"claude-desktop": {
+		serversKey: "mcpServers",
+		path:       claudeDesktopConfigPath,
+		entry: func(config *DeployConfig) (map[string]interface{}, error) {
+			entry := map[string]interface{}{
+				"command": "npx",
+				"args":    []string{"-y", "mcp-remote", config.AppURL()},
+			}
+			if config.TLS {
+				dir, err := TLSDir(config.InstanceName)
+				if err != nil {
+					return nil, err
+				}
+				entry["env"] = map[string]string{"NODE_EXTRA_CA_CERTS": filepath.Join(dir, TLSCertFile)}
+			}
+			return entry, nil
+		},
+	},
+	"cursor": {
+		serversKey: "mcpServers",
+		path: func() (string, error) {
+			home, err := os.UserHomeDir()
+			if err != nil {
+				return "", fmt.Errorf("failed to get home directory: %v", err)
+			}
+			return filepath.Join(home, ".cursor", "mcp.json"), nil
+		},
+		entry: func(config *DeployConfig) (map[string]interface{}, error) {
+			return map[string]interface{}{"url": config.AppURL()}, nil
+		},
+	},
+	// VS Code reads MCP servers from .vscode/mcp.json in the workspace
+	"vscode": {
+		serversKey: "servers",
+		path: func() (string, error) {
+			dir, err := os.Getwd()
+			if err != nil {
+				return "", err
+			}
+			return filepath.Join(dir, ".vscode", "mcp.json"), nil
+		},
+		entry: func(config *DeployConfig) (map[string]interface{}, error) {
+			return map[string]interface{}{"type": "http", "url": config.AppURL()}, nil
+		},
+	},
+}
+
+// ResolveMCPClient returns the name of an MCP client given by name or alias, e.g. claude for
+// claude-desktop
+func ResolveMCPClient(name string) (string, error) {
+	if alias, ok := mcpClientAliases[name]; ok {
+		name = alias
+	}
+	if _, err := getMCPClient(name); err != nil {
+		return "", err
+	}
+	return name, nil
+}
+
+// getMCPClient returns the MCP client with the given name or alias
+func getMCPClient(name string) (mcpClient, error) {
+	if alias, ok := mcpClientAliases[name]; ok {
+		name = alias
+	}
+	client, ok := mcpClients[name]
+	if !ok {
+		return mcpClient{}, fmt.Errorf("unknown MCP client '%s', expected one of %s", name, strings.Join(MCPClients, ", "))
+	}
+	return client, nil
+}
+
+// MCPConfigSnippet returns the config of an MCP client holding only the server entry of an
+// instance, named serverName
+func MCPConfigSnippet(clientName, serverName string, config *DeployConfig) (map[string]interface{}, error) {
+	client, err := getMCPClient(clientName)
+	if err != nil {
+		return nil, err
+	}
+	entry, err := client.entry(config)
+	if err != nil {
+		return nil, err
+	}
+	return map[string]interface{}{client.serversKey: map[string]interface{}{serverName: entry}}, nil
+}
+
+// MCPConfigPath returns the config file an MCP client reads its servers from
+func MCPConfigPath(clientName string) (string, error) {
+	client, err := getMCPClient(clientName)
+	if err != nil {
+		return "", err
+	}
+	return client.path()
+}
+
+// MergeMCPConfig adds the server entry of an instance, named serverName, to the config file
+// of an MCP client at path, replacing an entry of that name and keeping everything else. The
+// file is created if it does not exist. It returns whether an entry was replaced.
+func MergeMCPConfig(path, clientName, serverName string, config *DeployConfig) (bool, error) {
+	client, err := getMCPClient(clientName)
+	if err != nil {
+		return false, err
+	}
+	entry, err := client.entry(config)
+	if err != nil {
+		return false, err
+	}
+
+	settings, servers, mode, err := readMCPConfig(path, client)
+	if err != nil {
+		return false, err
+	}
+	if servers == nil {
+		servers = make(map[string]interface{})
+	}
+	_, replaced := servers[serverName]
+	servers[serverName] = entry
+	settings[client.serversKey] = servers
+	return replaced, writeMCPConfig(path, settings, mode)
+}
+
+// RemoveMCPConfigEntry removes the server entry named serverName from the config file of an
+// MCP client at path, keeping everything else. It returns whether there was such an entry.
+func RemoveMCPConfigEntry(path, clientName, serverName string) (bool, error) {
+	client, err := getMCPClient(clientName)
+	if err != nil {
+		return false, err
+	}
+	settings, servers, mode, err := readMCPConfig(path, client)
+	if err != nil {
+		return false, err
+	}
+	if _, ok := servers[serverName]; !ok {
+		return false, nil
+	}
+	delete(servers, serverName)
+	return true, writeMCPConfig(path, settings, mode)
+}
+
+// readMCPConfig reads the config file of an MCP client, returning its settings, the server
+// entries in them and its permissions. A missing file has no settings.
+func readMCPConfig(path string, client mcpClient) (map[string]interface{}, map[string]interface{}, os.FileMode, error) {
+	settings := make(map[string]interface{})
+	mode := os.FileMode(0644)
+	if data, err := os.ReadFile(path); err == nil {
+		if len(strings.TrimSpace(string(data))) > 0 {
+			if err := json.Unmarshal(data, &settings); err != nil {
+				return nil, nil, 0, fmt.Errorf("failed to parse %s: %v. Files with comments cannot be merged; edit the entry by hand", path, err)
+			}
+		}
+		if info, err := os.Stat(path); err == nil {
+			mode = info.Mode().Perm()
+		}
+	} else if !os.IsNotExist(err) {
+		return nil, nil, 0, fmt.Errorf("failed to read %s: %v", path, err)
+	}
+
+	servers, ok := settings[client.serversKey].(map[string]interface{})
+	if !ok && settings[client.serversKey] != nil {
+		return nil, nil, 0, fmt.Errorf("%s in %s is not an object", client.serversKey, path)
+	}
+	return settings, servers, mode, nil
+}
+
+// writeMCPConfig replaces the config file of an MCP client with settings
+func writeMCPConfig(path string, settings map[string]interface{}, mode os.FileMode) error {
+	data, err := json.MarshalIndent(settings, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("failed to create %s: %v", filepath.Dir(path), err)
+	}
+	tmpFile, err := os.CreateTemp(filepath.Dir(path), ".mcp-*")
+	if err != nil {
+		return fmt.Errorf("failed to write %s: %v", path, err)
+	}
+	defer os.Remove(tmpFile.Name())
+
+	if _, err := tmpFile.Write(append(data, '\n')); err != nil {
+		tmpFile.Close()
+		return fmt.Errorf("failed to write %s: %v", path, err)
+	}
+	if err := tmpFile.Close(); err != nil {
+		return fmt.Errorf("failed to write %s: %v", path, err)
+	}
+	if err := os.Chmod(tmpFile.Name(), mode); err != nil {
+		return fmt.Errorf("failed to write %s: %v", path, err)
+	}
+	if err := os.Rename(tmpFile.Name(), path); err != nil {
+		return fmt.Errorf("failed to write %s: %v", path, err)
+	}
+	return nil
+}
+
+// claudeDesktopConfigPath returns the path of claude_desktop_config.json on this OS
+func claudeDesktopConfigPath() (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to get home directory: %v", err)
+	}
+	switch runtime.GOOS {
+	case "darwin":
+		return filepath.Join(home, "Library", "Application Support", "Claude", "claude_desktop_config.json"), nil
+	case "windows":
+		if appData := os.Getenv("APPDATA"); appData != "" {
+			return filepath.Join(appData, "Claude", "claude_desktop_config.json"), nil
+		}
+		return filepath.Join(home, "AppData", "Roaming", "Claude", "claude_desktop_config.json"), nil
+	}
+	if configHome := os.Getenv("XDG_CONFIG_HOME"); configHome != "" {
+		return filepath.Join(configHome, "Claude", "claude_desktop_config.json"), nil
+	}
+	return filepath.Join(home, ".config", "Claude", "claude_desktop_config.json"), nil
+}
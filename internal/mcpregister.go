@@ -0,0 +1,101 @@
+package internal
+
+import (
+	"fmt"
+)
+
+// MCPRegistration is an MCP client config file deploy --register-mcp added an instance to
+type MCPRegistration struct {
+	Client string
+	Path   string
+}
+
+// RegisterMCP adds an instance to the config file of an MCP client, under the instance's name,
+// and records it so that remove takes the entry out again. It returns the path of the file.
+func RegisterMCP(config *DeployConfig, clientName string) (string, error) {
+	clientName, err := ResolveMCPClient(clientName)
+	if err != nil {
+		return "", err
+	}
+	path, err := MCPConfigPath(clientName)
+	if err != nil {
+		return "", err
+	}
+	if _, err := MergeMCPConfig(path, clientName, config.InstanceName, config); err != nil {
+		return "", err
+	}
+
+	db, err := InitDB()
+	if err != nil {
+		return "", err
+	}
+	defer db.Close()
+	if _, err := db.Exec(`INSERT OR REPLACE INTO mcp_registrations (instance_name, client, path) VALUES (?, ?, ?)`, config.InstanceName, clientName, path); err != nil {
+		return "", fmt.Errorf("failed to record MCP registration of %s: %v", config.InstanceName, err)
+	}
+	return path, nil
+}
+
+// GetMCPRegistrations returns the MCP client config files an instance was added to
+func GetMCPRegistrations(instanceName string) ([]MCPRegistration, error) {
+	db, err := InitDB()
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	rows, err := db.Query(`SELECT client, path FROM mcp_registrations WHERE instance_name = ? ORDER BY client`, instanceName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query MCP registrations of %s: %v", instanceName, err)
+	}
+	defer rows.Close()
+
+	var registrations []MCPRegistration
+	for rows.Next() {
+		var registration MCPRegistration
+		if err := rows.Scan(&registration.Client, &registration.Path); err != nil {
+			return nil, fmt.Errorf("failed to scan row: %v", err)
+		}
+		registrations = append(registrations, registration)
+	}
+	return registrations, rows.Err()
+}
+
+// UnregisterMCP takes an instance out of the MCP client config files it was added to. Entries
+// that cannot be removed are logged and left for the user.
+func UnregisterMCP(instanceName string) {
+	registrations, err := GetMCPRegistrations(instanceName)
+	if err != nil {
+		Log.Warning("Failed to look up MCP registrations", "instance", instanceName, "error", err)
+		return
+	}
+	for _, registration := range registrations {
+		if removed, err := RemoveMCPConfigEntry(registration.Path, registration.Client, instanceName); err != nil {
+			Log.Warning("Failed to remove MCP server entry", "instance", instanceName, "path", registration.Path, "error", err)
+		} else if removed {
+			Log.Info("Removed MCP server entry", "instance", instanceName, "path", registration.Path)
+		}
+	}
+}
+
+// RefreshMCPRegistrations rewrites the entries of an instance in the MCP client config files
+// it was added to, after its name or ports changed. oldName is the name the entries were
+// written under.
+func RefreshMCPRegistrations(oldName string, config *DeployConfig) {
+	registrations, err := GetMCPRegistrations(config.InstanceName)
+	if err != nil {
+		Log.Warning("Failed to look up MCP registrations", "instance", config.InstanceName, "error", err)
+		return
+	}
+	for _, registration := range registrations {
+		if oldName != config.InstanceName {
+			if _, err := RemoveMCPConfigEntry(registration.Path, registration.Client, oldName); err != nil {
+				Log.Warning("Failed to remove MCP server entry", "instance", oldName, "path", registration.Path, "error", err)
+				continue
+			}
+		}
+		if _, err := MergeMCPConfig(registration.Path, registration.Client, config.InstanceName, config); err != nil {
+			Log.Warning("Failed to update MCP server entry", "instance", config.InstanceName, "path", registration.Path, "error", err)
+		}
+	}
+}
@@ -0,0 +1,163 @@
+package internal
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// DefaultMetricsPort is the port metrics serve listens on
+const DefaultMetricsPort = 9400
+
+// metricFamily is a metric in the Prometheus text exposition format
+type metricFamily struct {
+	name    string
+	help    string
+	kind    string
+	samples []metricSample
+}
+
+// metricSample is one labelled value of a metric family
+type metricSample struct {
+	labels [][2]string
+	value  float64
+}
+
+func (f *metricFamily) add(value float64, labels ...string) {
+	sample := metricSample{value: value}
+	for i := 0; i+1 < len(labels); i += 2 {
+		sample.labels = append(sample.labels, [2]string{labels[i], labels[i+1]})
+	}
+	f.samples = append(f.samples, sample)
+}
+
+// WriteMetrics collects per-instance metrics from the Docker API and writes them to w
+// in the Prometheus text exposition format
+func WriteMetrics(ctx context.Context, w io.Writer) error {
+	docker, err := GetDockerClient()
+	if err != nil {
+		return err
+	}
+
+	instanceUp := &metricFamily{name: "graphsense_instance_up", help: "Whether all containers of the instance are running.", kind: "gauge"}
+	appPort := &metricFamily{name: "graphsense_instance_app_port", help: "Host port of the instance's MCP server.", kind: "gauge"}
+	volumeBytes := &metricFamily{name: "graphsense_instance_volume_bytes", help: "Disk space used by a named volume of the instance.", kind: "gauge"}
+	running := &metricFamily{name: "graphsense_container_running", help: "Whether the container is running.", kind: "gauge"}
+	restarts := &metricFamily{name: "graphsense_container_restarts", help: "Number of times Docker restarted the container.", kind: "gauge"}
+	cpuSeconds := &metricFamily{name: "graphsense_container_cpu_seconds_total", help: "Total CPU time used by the container.", kind: "counter"}
+	memoryBytes := &metricFamily{name: "graphsense_container_memory_bytes", help: "Memory used by the container, excluding the page cache.", kind: "gauge"}
+	scrapeErrors := &metricFamily{name: "graphsense_scrape_errors", help: "Number of instances or containers that could not be fully inspected in this scrape.", kind: "gauge"}
+
+	projects, err := GetGraphsenseProjects()
+	if err != nil {
+		return err
+	}
+	sort.Strings(projects)
+
+	volumeSizes, err := docker.VolumeSizes(ctx)
+	if err != nil {
+		return err
+	}
+
+	failures := 0
+	for _, instanceName := range projects {
+		containers, err := docker.ProjectContainers(ctx, instanceName)
+		if err != nil {
+			Log.Warning("Failed to list containers", "instance", instanceName, "error", err)
+			failures++
+			continue
+		}
+
+		up := len(containers) > 0
+		for _, container := range containers {
+			name := ContainerName(container)
+			service := container.Labels[ComposeServiceLabel]
+			labels := []string{"instance", instanceName, "service", service, "container", name}
+
+			isRunning := container.State == "running"
+			if !isRunning {
+				up = false
+			}
+			running.add(boolValue(isRunning), labels...)
+
+			if info, err := docker.InspectContainer(ctx, name); err != nil {
+				Log.Warning("Failed to inspect container", "container", name, "error", err)
+				failures++
+			} else {
+				restarts.add(float64(info.RestartCount), labels...)
+			}
+
+			if !isRunning {
+				continue
+			}
+			usage, err := docker.ContainerUsage(ctx, name)
+			if err != nil {
+				Log.Warning("Failed to get container usage", "container", name, "error", err)
+				failures++
+				continue
+			}
+			cpuSeconds.add(usage.CPUSeconds, labels...)
+			memoryBytes.add(float64(usage.MemoryBytes), labels...)
+		}
+		instanceUp.add(boolValue(up), "instance", instanceName)
+
+		if config, err := GetInstanceConfig(instanceName); err == nil {
+			appPort.add(float64(config.AppPort), "instance", instanceName)
+		}
+
+		var volumes []string
+		for volume := range volumeSizes {
+			if strings.HasPrefix(volume, instanceName+"_") {
+				volumes = append(volumes, volume)
+			}
+		}
+		sort.Strings(volumes)
+		for _, volume := range volumes {
+			volumeBytes.add(float64(volumeSizes[volume]), "instance", instanceName, "volume", strings.TrimPrefix(volume, instanceName+"_"))
+		}
+	}
+	scrapeErrors.add(float64(failures))
+
+	for _, family := range []*metricFamily{instanceUp, appPort, volumeBytes, running, restarts, cpuSeconds, memoryBytes, scrapeErrors} {
+		if err := family.write(w); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// write writes the family with its HELP and TYPE lines
+func (f *metricFamily) write(w io.Writer) error {
+	if _, err := fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", f.name, f.help, f.name, f.kind); err != nil {
+		return err
+	}
+	for _, sample := range f.samples {
+		var labels []string
+		for _, label := range sample.labels {
+			labels = append(labels, fmt.Sprintf("%s=\"%s\"", label[0], escapeLabelValue(label[1])))
+		}
+		line := f.name
+		if len(labels) > 0 {
+			line += "{" + strings.Join(labels, ",") + "}"
+		}
+		if _, err := fmt.Fprintf(w, "%s %s\n", line, strconv.FormatFloat(sample.value, 'g', -1, 64)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// escapeLabelValue escapes a label value for the text exposition format
+func escapeLabelValue(value string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(value)
+}
+
+func boolValue(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,88 @@
+package internal
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/docker/go-units"
+)
+
+// minNeo4jMemory is the smallest heap or page cache deploy accepts; Neo4j does not start with less
+const minNeo4jMemory = 64 * units.MiB
+
+// ParseNeo4jMemory parses a Neo4j heap or page cache size such as 512m or 4g. An empty value
+// leaves Neo4j's default.
+func ParseNeo4jMemory(setting, value string) (int64, error) {
+	if value == "" {
+		return 0, nil
+	}
+	bytes, err := units.RAMInBytes(value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid Neo4j %s '%s': use a size such as 512m or 4g", setting, value)
+	}
+	if bytes < minNeo4jMemory {
+		return 0, fmt.Errorf("invalid Neo4j %s '%s': must be at least 64m", setting, value)
+	}
+	return bytes, nil
+}
+
+// CheckNeo4jMemory checks that the heap and page cache fit into the memory limit of the
+// neo4j container, leaving room for Neo4j's native memory
+func CheckNeo4jMemory(config *DeployConfig) error {
+	limits := config.ServiceResources("neo4j")
+	if limits == nil || limits.Memory == 0 {
+		return nil
+	}
+	if total := config.Neo4jHeap + config.Neo4jPageCache; total >= limits.Memory {
+		return fmt.Errorf("the Neo4j heap and page cache (%s) do not fit into its memory limit of %s", FormatMemoryLimit(total), limits.MemoryString())
+	}
+	return nil
+}
+
+// neo4jMemorySettings returns the names of the heap and page cache settings of a Neo4j
+// version. Neo4j 5 renamed the dbms.memory settings of 4.x to server.memory; instances whose
+// version is not recorded yet run the image of the compose file, which is Neo4j 5.
+func neo4jMemorySettings(version string) (heapInitial, heapMax, pageCache string) {
+	prefix := "server.memory"
+	if version != "" && MajorVersion(version) < 5 {
+		prefix = "dbms.memory"
+	}
+	return prefix + ".heap.initial_size", prefix + ".heap.max_size", prefix + ".pagecache.size"
+}
+
+// neo4jSettingEnv returns the environment variable the Neo4j image reads a setting from, e.g.
+// NEO4J_server_memory_heap_max__size for server.memory.heap.max_size
+func neo4jSettingEnv(setting string) string {
+	return "NEO4J_" + strings.ReplaceAll(strings.ReplaceAll(setting, "_", "__"), ".", "_")
+}
+
+// Neo4jMemoryEnv returns the environment sizing Neo4j's heap and page cache, or nil to leave
+// Neo4j's defaults. The heap is fixed at its maximum so that it is not resized under load.
+func (c *DeployConfig) Neo4jMemoryEnv() map[string]string {
+	if c.Neo4jHeap == 0 && c.Neo4jPageCache == 0 {
+		return nil
+	}
+	heapInitial, heapMax, pageCache := neo4jMemorySettings(c.Neo4jVersion)
+	env := make(map[string]string)
+	if c.Neo4jHeap > 0 {
+		env[neo4jSettingEnv(heapInitial)] = FormatMemoryLimit(c.Neo4jHeap)
+		env[neo4jSettingEnv(heapMax)] = FormatMemoryLimit(c.Neo4jHeap)
+	}
+	if c.Neo4jPageCache > 0 {
+		env[neo4jSettingEnv(pageCache)] = FormatMemoryLimit(c.Neo4jPageCache)
+	}
+	return env
+}
+
+// DescribeNeo4jMemory summarizes the Neo4j memory settings of an instance, e.g. "heap 2g,
+// page cache 1g", or returns "" if it uses Neo4j's defaults
+func (c *DeployConfig) DescribeNeo4jMemory() string {
+	var parts []string
+	if c.Neo4jHeap > 0 {
+		parts = append(parts, "heap "+FormatMemoryLimit(c.Neo4jHeap))
+	}
+	if c.Neo4jPageCache > 0 {
+		parts = append(parts, "page cache "+FormatMemoryLimit(c.Neo4jPageCache))
+	}
+	return strings.Join(parts, ", ")
+}
@@ -0,0 +1,174 @@
+package internal
+
+import (
+	"context"
+	"crypto/rand"
+	"embed"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// Defaults for the Jupyter container started by the notebook command
+const (
+	DefaultNotebookImage = "quay.io/jupyter/scipy-notebook:latest"
+	DefaultNotebookPort  = 8888
+)
+
+//go:embed notebooks/*.ipynb
+var notebooksFS embed.FS
+
+// NotebookOptions configures the Jupyter container of an instance
+type NotebookOptions struct {
+	Image       string
+	Port        int
+	Dir         string
+	Token       string
+	Credentials InstanceCredentials
+}
+
+// NotebookContainerName returns the name of the Jupyter container of an instance
+func NotebookContainerName(instanceName string) string {
+	return instanceName + "-notebook"
+}
+
+// GetNotebookDir returns the default directory mounted into an instance's Jupyter container
+func GetNotebookDir(instanceName string) (string, error) {
+	graphsenseDir, err := GetGraphsenseDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(graphsenseDir, "notebooks", instanceName), nil
+}
+
+// NewNotebookToken returns a random Jupyter access token
+func NewNotebookToken() (string, error) {
+	buf := make([]byte, 24)
+	if _, err := rand.Read(buf); err != nil {
+		return "", fmt.Errorf("failed to generate notebook token: %v", err)
+	}
+	return hex.EncodeToString(buf), nil
+}
+
+// WriteExampleNotebooks copies the bundled example notebooks into dir without overwriting
+// notebooks the user already has, and returns the names of the notebooks written
+func WriteExampleNotebooks(dir string) ([]string, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create notebook directory: %v", err)
+	}
+
+	entries, err := notebooksFS.ReadDir("notebooks")
+	if err != nil {
+		return nil, err
+	}
+
+	var written []string
+	for _, entry := range entries {
+		target := filepath.Join(dir, entry.Name())
+		if _, err := os.Stat(target); err == nil {
+			continue
+		} else if !errors.Is(err, fs.ErrNotExist) {
+			return nil, err
+		}
+
+		data, err := notebooksFS.ReadFile("notebooks/" + entry.Name())
+		if err != nil {
+			return nil, err
+		}
+		if err := os.WriteFile(target, data, 0644); err != nil {
+			return nil, fmt.Errorf("failed to write %s: %v", entry.Name(), err)
+		}
+		written = append(written, entry.Name())
+	}
+
+	return written, nil
+}
+
+// NotebookEnv returns the connection variables of an instance as seen from inside its Docker network
+func NotebookEnv(instanceName string, credentials InstanceCredentials) [][2]string {
+	return [][2]string{
+		{"POSTGRES_URL", fmt.Sprintf("postgresql://%s:%s@%s-postgres:5432/%s", credentials.PostgresUser, credentials.PostgresPassword, instanceName, PostgresDB)},
+		{"NEO4J_URI", fmt.Sprintf("bolt://%s-neo4j:7687", instanceName)},
+		{"NEO4J_USERNAME", credentials.Neo4jUser},
+		{"NEO4J_PASSWORD", credentials.Neo4jPassword},
+		{"NEO4J_DATABASE", Neo4jDB},
+	}
+}
+
+// notebookSecrets are the connection variables that hold a password. They are passed to
+// docker run through its environment, which keeps them off its command line.
+var notebookSecrets = map[string]bool{"POSTGRES_URL": true, "NEO4J_PASSWORD": true}
+
+// NotebookSecretEnv returns the connection variables of NotebookEnv that hold a password
+func NotebookSecretEnv(instanceName string, credentials InstanceCredentials) map[string]string {
+	env := make(map[string]string)
+	for _, variable := range NotebookEnv(instanceName, credentials) {
+		if notebookSecrets[variable[0]] {
+			env[variable[0]] = variable[1]
+		}
+	}
+	return env
+}
+
+// GetInstanceNetwork returns the Docker network the containers of an instance are attached to
+func GetInstanceNetwork(instanceName string) (string, error) {
+	docker, err := GetDockerClient()
+	if err != nil {
+		return "", err
+	}
+
+	networks, err := docker.ProjectNetworks(context.Background(), instanceName)
+	if err != nil {
+		return "", err
+	}
+	if len(networks) == 0 {
+		return "", fmt.Errorf("no network found for instance '%s'", instanceName)
+	}
+	return networks[0], nil
+}
+
+// NotebookRunArgs returns the docker run arguments that start the Jupyter container of an instance
+func NotebookRunArgs(instanceName, network string, opts NotebookOptions) []string {
+	args := []string{"run", "-d",
+		"--name", NotebookContainerName(instanceName),
+		"--network", network,
+		"-p", fmt.Sprintf("%d:8888", opts.Port),
+		"-v", opts.Dir + ":/home/jovyan/work",
+	}
+	for _, env := range NotebookEnv(instanceName, opts.Credentials) {
+		if notebookSecrets[env[0]] {
+			args = append(args, "-e", env[0])
+		} else {
+			args = append(args, "-e", env[0]+"="+env[1])
+		}
+	}
+	return append(args, opts.Image, "start-notebook.py", "--IdentityProvider.token="+opts.Token)
+}
+
+// StartNotebook starts a Jupyter container on the network of an instance
+func StartNotebook(instanceName, network string, opts NotebookOptions) error {
+	cmd := CommandEnv(NotebookSecretEnv(instanceName, opts.Credentials), "docker", NotebookRunArgs(instanceName, network, opts)...)
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("failed to start notebook container: %v", err)
+	}
+	return nil
+}
+
+// RemoveNotebook removes the Jupyter container of an instance if it exists
+func RemoveNotebook(instanceName string) error {
+	docker, err := GetDockerClient()
+	if err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+	name := NotebookContainerName(instanceName)
+	if _, err := docker.InspectContainer(ctx, name); err != nil {
+		return nil
+	}
+	return docker.RemoveContainer(ctx, name)
+}
@@ -0,0 +1,280 @@
+package internal
+
+import (
+	"bytes"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/smtp"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Types of notification sinks
+const (
+	NotifyWebhook = "webhook"
+	NotifySlack   = "slack"
+	NotifyEmail   = "email"
+)
+
+// Events notifications are sent for, besides the supervisor's actions
+const (
+	// NotifyDeployFailed is sent when a deploy fails
+	NotifyDeployFailed = "deploy-failed"
+	// NotifyTest is sent by 'notifications test'
+	NotifyTest = "test"
+)
+
+// NotificationEvents are the events sinks can be limited to
+var NotificationEvents = []string{
+	SupervisorUnhealthy, SupervisorRestarted, SupervisorRestartFailed, SupervisorGaveUp, SupervisorRecovered,
+	SupervisorExpiring, SupervisorCollected, SupervisorCollectFailed, NotifyDeployFailed,
+}
+
+// notifyTimeout bounds sending one notification
+const notifyTimeout = 10 * time.Second
+
+// defaultSMTPPort is the submission port, which upgrades to TLS with STARTTLS
+const defaultSMTPPort = 587
+
+// smtpsPort is the port of SMTP over implicit TLS
+const smtpsPort = 465
+
+// NotificationConfig is a place notifications are sent to, from the notifications section of
+// the config file
+type NotificationConfig struct {
+	// Type is webhook, slack or email
+	Type string `yaml:"type"`
+	// URL is the endpoint of a webhook or of a Slack incoming webhook
+	URL string `yaml:"url"`
+	// Events limits the sink to these events; all are sent without them
+	Events []string `yaml:"events"`
+	// SMTP server and addresses of email notifications. The password is read from the
+	// environment variable PasswordEnv names rather than the config file, if it is set.
+	SMTPHost    string   `yaml:"smtp_host"`
+	SMTPPort    int      `yaml:"smtp_port"`
+	Username    string   `yaml:"username"`
+	Password    string   `yaml:"password"`
+	PasswordEnv string   `yaml:"password_env"`
+	From        string   `yaml:"from"`
+	To          []string `yaml:"to"`
+}
+
+// Name describes the sink in messages, e.g. "slack" or "email to ops@example.com"
+func (c NotificationConfig) Name() string {
+	if c.Type == NotifyEmail {
+		return "email to " + strings.Join(c.To, ", ")
+	}
+	return c.Type
+}
+
+// Validate checks that the sink has the settings its type needs
+func (c NotificationConfig) Validate() error {
+	switch c.Type {
+	case NotifyWebhook, NotifySlack:
+		if c.URL == "" {
+			return fmt.Errorf("%s notification needs a url", c.Type)
+		}
+	case NotifyEmail:
+		if c.SMTPHost == "" || c.From == "" || len(c.To) == 0 {
+			return fmt.Errorf("email notification needs smtp_host, from and to")
+		}
+	default:
+		return fmt.Errorf("invalid notification type '%s': must be %s, %s or %s", c.Type, NotifyWebhook, NotifySlack, NotifyEmail)
+	}
+	for _, event := range c.Events {
+		if !slices.Contains(NotificationEvents, event) {
+			return fmt.Errorf("invalid notification event '%s': must be one of %s", event, strings.Join(NotificationEvents, ", "))
+		}
+	}
+	return nil
+}
+
+// wants reports whether the sink is sent an event
+func (c NotificationConfig) wants(event string) bool {
+	return len(c.Events) == 0 || event == NotifyTest || slices.Contains(c.Events, event)
+}
+
+// Notification is an event of an instance sent to the notification sinks
+type Notification struct {
+	Event    string    `json:"event"`
+	Instance string    `json:"instance"`
+	Service  string    `json:"service,omitempty"`
+	Detail   string    `json:"detail,omitempty"`
+	Host     string    `json:"host"`
+	Time     time.Time `json:"time"`
+	Summary  string    `json:"summary"`
+}
+
+// NewNotification returns the notification of an event, stamped with this host and the time
+func NewNotification(event, instanceName, service, detail string) Notification {
+	host, _ := os.Hostname()
+	n := Notification{Event: event, Instance: instanceName, Service: service, Detail: detail, Host: host, Time: time.Now().UTC()}
+	n.Summary = n.summarize()
+	return n
+}
+
+// summarize describes the event in one sentence
+func (n Notification) summarize() string {
+	switch n.Event {
+	case SupervisorUnhealthy:
+		return fmt.Sprintf("%s of instance '%s' is unhealthy", n.Service, n.Instance)
+	case SupervisorRestarted:
+		return fmt.Sprintf("Restarted %s of instance '%s'", n.Service, n.Instance)
+	case SupervisorRestartFailed:
+		return fmt.Sprintf("Failed to restart %s of instance '%s'", n.Service, n.Instance)
+	case SupervisorGaveUp:
+		return fmt.Sprintf("Gave up restarting %s of instance '%s'", n.Service, n.Instance)
+	case SupervisorRecovered:
+		return fmt.Sprintf("%s of instance '%s' recovered", n.Service, n.Instance)
+	case SupervisorExpiring:
+		return fmt.Sprintf("Instance '%s' will soon be collected", n.Instance)
+	case SupervisorCollected:
+		return fmt.Sprintf("Collected instance '%s'", n.Instance)
+	case SupervisorCollectFailed:
+		return fmt.Sprintf("Failed to collect instance '%s'", n.Instance)
+	case NotifyDeployFailed:
+		return fmt.Sprintf("Deploy of instance '%s' failed", n.Instance)
+	case NotifyTest:
+		return "Test notification from graphsense-cli"
+	}
+	return fmt.Sprintf("%s: %s", n.Instance, n.Event)
+}
+
+// Text renders the notification as a message, e.g. for Slack and email
+func (n Notification) Text() string {
+	text := n.Summary
+	if n.Detail != "" {
+		text += ": " + n.Detail
+	}
+	if n.Host != "" {
+		text += " (on " + n.Host + ")"
+	}
+	return text
+}
+
+// Notify sends a notification to every sink in the config file that wants its event. Sinks
+// that fail are logged, so notifications never fail the operation they report on.
+func Notify(n Notification) {
+	settings, err := LoadConfig()
+	if err != nil {
+		Log.Warning("Failed to load notification settings", "error", err)
+		return
+	}
+	for _, sink := range settings.Notifications {
+		if !sink.wants(n.Event) {
+			continue
+		}
+		if err := SendNotification(sink, n); err != nil {
+			Log.Warning("Failed to send notification", "sink", sink.Name(), "event", n.Event, "error", err)
+		}
+	}
+}
+
+// SendNotification sends a notification to one sink
+func SendNotification(sink NotificationConfig, n Notification) error {
+	if err := sink.Validate(); err != nil {
+		return err
+	}
+	switch sink.Type {
+	case NotifyWebhook:
+		return postNotification(sink.URL, n)
+	case NotifySlack:
+		return postNotification(sink.URL, map[string]string{"text": n.Text()})
+	default:
+		return sendEmail(sink, n)
+	}
+}
+
+// postNotification posts a JSON payload to a webhook
+func postNotification(url string, payload interface{}) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	client := &http.Client{Timeout: notifyTimeout}
+	resp, err := client.Post(url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook answered HTTP %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// sendEmail sends a notification by email. The connection is encrypted with STARTTLS where
+// the server offers it, or from the start on port 465.
+func sendEmail(sink NotificationConfig, n Notification) error {
+	port := sink.SMTPPort
+	if port == 0 {
+		port = defaultSMTPPort
+	}
+	address := net.JoinHostPort(sink.SMTPHost, strconv.Itoa(port))
+	dialer := &net.Dialer{Timeout: notifyTimeout}
+
+	var conn net.Conn
+	var err error
+	if port == smtpsPort {
+		conn, err = tls.DialWithDialer(dialer, "tcp", address, &tls.Config{ServerName: sink.SMTPHost})
+	} else {
+		conn, err = dialer.Dial("tcp", address)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to connect to %s: %v", address, err)
+	}
+	conn.SetDeadline(time.Now().Add(3 * notifyTimeout))
+
+	client, err := smtp.NewClient(conn, sink.SMTPHost)
+	if err != nil {
+		conn.Close()
+		return fmt.Errorf("failed to talk to %s: %v", address, err)
+	}
+	defer client.Close()
+
+	if port != smtpsPort {
+		if ok, _ := client.Extension("STARTTLS"); ok {
+			if err := client.StartTLS(&tls.Config{ServerName: sink.SMTPHost}); err != nil {
+				return fmt.Errorf("failed to start TLS with %s: %v", address, err)
+			}
+		}
+	}
+	if sink.Username != "" {
+		password := sink.Password
+		if sink.PasswordEnv != "" {
+			password = os.Getenv(sink.PasswordEnv)
+		}
+		// PlainAuth refuses to send the password over an unencrypted connection to another host
+		if err := client.Auth(smtp.PlainAuth("", sink.Username, password, sink.SMTPHost)); err != nil {
+			return fmt.Errorf("failed to log in to %s: %v", address, err)
+		}
+	}
+
+	if err := client.Mail(sink.From); err != nil {
+		return err
+	}
+	for _, to := range sink.To {
+		if err := client.Rcpt(to); err != nil {
+			return err
+		}
+	}
+	writer, err := client.Data()
+	if err != nil {
+		return err
+	}
+	message := fmt.Sprintf("From: %s\r\nTo: %s\r\nSubject: [graphsense] %s\r\nDate: %s\r\nContent-Type: text/plain; charset=UTF-8\r\n\r\n%s\r\n",
+		sink.From, strings.Join(sink.To, ", "), n.Summary, n.Time.Format(time.RFC1123Z), n.Text())
+	if _, err := writer.Write([]byte(message)); err != nil {
+		return err
+	}
+	if err := writer.Close(); err != nil {
+		return err
+	}
+	return client.Quit()
+}
@@ -0,0 +1,49 @@
+package internal
+
+import "os"
+
+// ANSI colors used in text output
+const (
+	ColorRed    = "\033[0;31m"
+	ColorGreen  = "\033[0;32m"
+	ColorYellow = "\033[1;33m"
+	ColorBlue   = "\033[0;34m"
+	ColorCyan   = "\033[0;36m"
+	ColorGray   = "\033[0;90m"
+	colorReset  = "\033[0m"
+)
+
+// plainOutput turns off colors and symbols for screen readers and dumb terminals
+var plainOutput = os.Getenv("TERM") == "dumb"
+
+// SetPlainOutput turns plain output on or off
+func SetPlainOutput(plain bool) {
+	plainOutput = plain
+}
+
+// PlainOutput reports whether output must be plain: no colors, emojis or other symbols,
+// only stable lines of text
+func PlainOutput() bool {
+	return plainOutput
+}
+
+// Colorize wraps s in an ANSI color, unless output is plain
+func Colorize(color, s string) string {
+	if plainOutput {
+		return s
+	}
+	return color + s + colorReset
+}
+
+// Symbol returns fancy, or its plain text replacement when output is plain
+func Symbol(fancy, plain string) string {
+	if plainOutput {
+		return plain
+	}
+	return fancy
+}
+
+// Arrow returns the arrow used for "from -> to" changes
+func Arrow() string {
+	return Symbol("→", "->")
+}
@@ -0,0 +1,149 @@
+package internal
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Defaults of the port scheme, used for any setting left out of ~/.graphsense/config.yaml
+const (
+	DefaultPostgresOffset = 100
+	DefaultNeo4jOffset    = 200
+	DefaultPortStep       = 10
+	DefaultPortRange      = "1024-65535"
+)
+
+// PortScheme decides which host ports a new instance gets. The app listens on a base port and
+// PostgreSQL and Neo4j Bolt on fixed offsets from it. Base ports are tried Step apart until a
+// set is free, and every port of a set must lie within Range. Zero values mean the default.
+type PortScheme struct {
+	Base           int `yaml:"base"`
+	PostgresOffset int `yaml:"postgres_offset"`
+	Neo4jOffset    int `yaml:"neo4j_offset"`
+	Step           int `yaml:"step"`
+	// Range is the allowed host port range, as min-max
+	Range string `yaml:"range"`
+	// BindAddress is the host address ports are published on, 127.0.0.1 by default for a local
+	// Docker engine; 0.0.0.0 publishes them on all interfaces
+	BindAddress string `yaml:"bind_address"`
+}
+
+// PortSet is the host ports of one instance
+type PortSet struct {
+	App       int
+	Postgres  int
+	Neo4jBolt int
+}
+
+// Apply records the ports of the set in an instance configuration
+func (p PortSet) Apply(config *DeployConfig) {
+	config.AppPort = p.App
+	config.PostgresPort = p.Postgres
+	config.Neo4jBoltPort = p.Neo4jBolt
+}
+
+// Merge returns the scheme with the settings of override that are set taking precedence
+func (s PortScheme) Merge(override PortScheme) PortScheme {
+	if override.Base != 0 {
+		s.Base = override.Base
+	}
+	if override.PostgresOffset != 0 {
+		s.PostgresOffset = override.PostgresOffset
+	}
+	if override.Neo4jOffset != 0 {
+		s.Neo4jOffset = override.Neo4jOffset
+	}
+	if override.Step != 0 {
+		s.Step = override.Step
+	}
+	if override.Range != "" {
+		s.Range = override.Range
+	}
+	if override.BindAddress != "" {
+		s.BindAddress = override.BindAddress
+	}
+	return s
+}
+
+// WithDefaults fills in the settings that are not set
+func (s PortScheme) WithDefaults() PortScheme {
+	return PortScheme{
+		Base:           DefaultBasePort,
+		PostgresOffset: DefaultPostgresOffset,
+		Neo4jOffset:    DefaultNeo4jOffset,
+		Step:           DefaultPortStep,
+		Range:          DefaultPortRange,
+		BindAddress:    DefaultBindAddress(),
+	}.Merge(s)
+}
+
+// PortSet returns the ports of the set based on appPort
+func (s PortScheme) PortSet(appPort int) PortSet {
+	return PortSet{App: appPort, Postgres: appPort + s.PostgresOffset, Neo4jBolt: appPort + s.Neo4jOffset}
+}
+
+// PortRange parses Range into its lowest and highest port
+func (s PortScheme) PortRange() (int, int, error) {
+	low, high, ok := strings.Cut(s.Range, "-")
+	min, err := strconv.Atoi(strings.TrimSpace(low))
+	if !ok || err != nil {
+		return 0, 0, fmt.Errorf("invalid port range '%s': must be min-max", s.Range)
+	}
+	max, err := strconv.Atoi(strings.TrimSpace(high))
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid port range '%s': must be min-max", s.Range)
+	}
+	if min < 1 || max > 65535 || min > max {
+		return 0, 0, fmt.Errorf("invalid port range '%s': ports must be between 1 and 65535, min first", s.Range)
+	}
+	return min, max, nil
+}
+
+// Contains reports whether every port of a set lies within Range
+func (s PortScheme) Contains(set PortSet) bool {
+	min, max, err := s.PortRange()
+	if err != nil {
+		return false
+	}
+	for _, port := range []int{set.App, set.Postgres, set.Neo4jBolt} {
+		if port < min || port > max {
+			return false
+		}
+	}
+	return true
+}
+
+// Validate checks that the scheme can produce a port set
+func (s PortScheme) Validate() error {
+	if _, _, err := s.PortRange(); err != nil {
+		return err
+	}
+	if err := ValidateBindAddress(s.BindAddress); err != nil {
+		return err
+	}
+	if s.Step <= 0 {
+		return fmt.Errorf("port step must be positive")
+	}
+	if s.PostgresOffset == 0 || s.Neo4jOffset == 0 || s.PostgresOffset == s.Neo4jOffset {
+		return fmt.Errorf("postgres and neo4j port offsets must be non-zero and differ from each other")
+	}
+	if !s.Contains(s.PortSet(s.Base)) {
+		return fmt.Errorf("base port %d puts ports outside the allowed range %s", s.Base, s.Range)
+	}
+	return nil
+}
+
+// LoadPortScheme returns the port scheme from ~/.graphsense/config.yaml with overrides, such as
+// command-line flags, applied on top and defaults for anything left unset
+func LoadPortScheme(overrides PortScheme) (PortScheme, error) {
+	settings, err := LoadConfig()
+	if err != nil {
+		return PortScheme{}, err
+	}
+	scheme := settings.Ports.Merge(overrides).WithDefaults()
+	if err := scheme.Validate(); err != nil {
+		return PortScheme{}, err
+	}
+	return scheme, nil
+}
@@ -0,0 +1,58 @@
+package internal
+
+import (
+	"fmt"
+	"sort"
+)
+
+// ListeningPort is a TCP port a process on this machine listens on
+type ListeningPort struct {
+	Address string `json:"address" yaml:"address"`
+	Port    int    `json:"port" yaml:"port"`
+	// Process names the listening process where the platform reports it, e.g. "postgres (412)"
+	Process string `json:"process,omitempty" yaml:"process,omitempty"`
+}
+
+// PortScanner lists the TCP ports listening on this machine. Each platform has its own
+// implementation, so no external tool such as netstat is needed.
+type PortScanner interface {
+	ListeningPorts() ([]ListeningPort, error)
+}
+
+// NewPortScanner returns the port scanner of the current platform
+func NewPortScanner() PortScanner {
+	return newPlatformPortScanner()
+}
+
+// GetListeningPorts lists the listening TCP ports of this machine, ordered by port
+func GetListeningPorts() ([]ListeningPort, error) {
+	ports, err := NewPortScanner().ListeningPorts()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list listening ports: %v", err)
+	}
+	sort.Slice(ports, func(i, j int) bool {
+		if ports[i].Port != ports[j].Port {
+			return ports[i].Port < ports[j].Port
+		}
+		return ports[i].Address < ports[j].Address
+	})
+	return ports, nil
+}
+
+// GetPortsInUse returns a list of ports currently in use
+func GetPortsInUse() ([]int, error) {
+	listening, err := GetListeningPorts()
+	if err != nil {
+		return nil, err
+	}
+
+	var ports []int
+	seen := make(map[int]bool)
+	for _, listener := range listening {
+		if !seen[listener.Port] {
+			seen[listener.Port] = true
+			ports = append(ports, listener.Port)
+		}
+	}
+	return ports, nil
+}
@@ -0,0 +1,66 @@
+//go:build darwin
+
+package internal
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"net"
+	"os/exec"
+	"strconv"
+	"strings"
+)
+
+// lsofScanner asks lsof, which ships with every macOS install, for listening sockets
+type lsofScanner struct{}
+
+func newPlatformPortScanner() PortScanner {
+	return lsofScanner{}
+}
+
+// ListeningPorts parses the field output of lsof: a p<pid> line and a c<command> line per
+// process, followed by an n<address>:<port> line per socket
+func (lsofScanner) ListeningPorts() ([]ListeningPort, error) {
+	output, err := Command("lsof", "-nP", "-iTCP", "-sTCP:LISTEN", "-Fpcn").Output()
+	if err != nil {
+		// lsof exits non-zero without output when nothing listens
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) && len(output) == 0 {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to run lsof: %v", err)
+	}
+
+	var ports []ListeningPort
+	var pid, command string
+	scanner := bufio.NewScanner(bytes.NewReader(output))
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == "" {
+			continue
+		}
+		switch value := line[1:]; line[0] {
+		case 'p':
+			pid, command = value, ""
+		case 'c':
+			command = value
+		case 'n':
+			host, portText, err := net.SplitHostPort(value)
+			if err != nil {
+				continue
+			}
+			port, err := strconv.Atoi(portText)
+			if err != nil {
+				continue
+			}
+			ports = append(ports, ListeningPort{
+				Address: strings.Trim(host, "[]"),
+				Port:    port,
+				Process: fmt.Sprintf("%s (%s)", command, pid),
+			})
+		}
+	}
+	return ports, nil
+}
@@ -0,0 +1,93 @@
+//go:build linux
+
+package internal
+
+import (
+	"bufio"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// procNetListen is the connection state of a listening socket in /proc/net/tcp
+const procNetListen = "0A"
+
+// procNetScanner reads the kernel's socket tables from /proc/net
+type procNetScanner struct{}
+
+func newPlatformPortScanner() PortScanner {
+	return procNetScanner{}
+}
+
+// ListeningPorts parses /proc/net/tcp and /proc/net/tcp6
+func (procNetScanner) ListeningPorts() ([]ListeningPort, error) {
+	var ports []ListeningPort
+	for _, table := range []string{"/proc/net/tcp", "/proc/net/tcp6"} {
+		listening, err := readProcNetTable(table)
+		if os.IsNotExist(err) {
+			// Kernels without IPv6 have no tcp6 table
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		ports = append(ports, listening...)
+	}
+	return ports, nil
+}
+
+// readProcNetTable returns the listening sockets of one /proc/net table
+func readProcNetTable(path string) ([]ListeningPort, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var ports []ListeningPort
+	scanner := bufio.NewScanner(file)
+	scanner.Scan() // header
+	for scanner.Scan() {
+		// sl local_address rem_address st ...
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 4 || fields[3] != procNetListen {
+			continue
+		}
+		address, port, err := parseProcNetAddress(fields[1])
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse %s: %v", path, err)
+		}
+		ports = append(ports, ListeningPort{Address: address, Port: port})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read %s: %v", path, err)
+	}
+	return ports, nil
+}
+
+// parseProcNetAddress decodes an address such as 0100007F:1F90. The IP is written as 32-bit
+// words in host byte order, which is little-endian on every platform Docker runs on.
+func parseProcNetAddress(field string) (string, int, error) {
+	hexIP, hexPort, ok := strings.Cut(field, ":")
+	if !ok {
+		return "", 0, fmt.Errorf("invalid address '%s'", field)
+	}
+	port, err := strconv.ParseUint(hexPort, 16, 16)
+	if err != nil {
+		return "", 0, fmt.Errorf("invalid port in '%s'", field)
+	}
+	raw, err := hex.DecodeString(hexIP)
+	if err != nil || (len(raw) != net.IPv4len && len(raw) != net.IPv6len) {
+		return "", 0, fmt.Errorf("invalid IP in '%s'", field)
+	}
+	ip := make(net.IP, len(raw))
+	for word := 0; word < len(raw); word += 4 {
+		for i := 0; i < 4; i++ {
+			ip[word+i] = raw[word+3-i]
+		}
+	}
+	return ip.String(), int(port), nil
+}
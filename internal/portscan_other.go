@@ -0,0 +1,45 @@
+//go:build !linux && !darwin && !windows
+
+package internal
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// netstatScanner parses netstat output on platforms without a native implementation
+type netstatScanner struct{}
+
+func newPlatformPortScanner() PortScanner {
+	return netstatScanner{}
+}
+
+// netstatAddress matches the local address column, e.g. 127.0.0.1.5432 or *.8080
+var netstatAddress = regexp.MustCompile(`^(.*)[.:](\d+)$`)
+
+// ListeningPorts parses the LISTEN lines of netstat -an
+func (netstatScanner) ListeningPorts() ([]ListeningPort, error) {
+	output, err := Command("netstat", "-an", "-p", "tcp").Output()
+	if err != nil {
+		return nil, err
+	}
+
+	var ports []ListeningPort
+	for _, line := range strings.Split(string(output), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 4 || fields[len(fields)-1] != "LISTEN" {
+			continue
+		}
+		match := netstatAddress.FindStringSubmatch(fields[3])
+		if match == nil {
+			continue
+		}
+		port, err := strconv.Atoi(match[2])
+		if err != nil {
+			continue
+		}
+		ports = append(ports, ListeningPort{Address: match[1], Port: port})
+	}
+	return ports, nil
+}
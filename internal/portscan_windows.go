@@ -0,0 +1,104 @@
+//go:build windows
+
+package internal
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net"
+	"syscall"
+	"unsafe"
+)
+
+// Arguments of GetExtendedTcpTable
+const (
+	afInet                   = 2
+	afInet6                  = 23
+	tcpTableOwnerPIDListener = 3
+	errorInsufficientBuffer  = 122
+)
+
+// Sizes of MIB_TCPROW_OWNER_PID and MIB_TCP6ROW_OWNER_PID
+const (
+	tcpRowSize  = 24
+	tcp6RowSize = 56
+)
+
+// tcpTableScanner reads the listening sockets from the IP Helper API
+type tcpTableScanner struct{}
+
+func newPlatformPortScanner() PortScanner {
+	return tcpTableScanner{}
+}
+
+// ListeningPorts calls GetExtendedTcpTable for IPv4 and IPv6
+func (tcpTableScanner) ListeningPorts() ([]ListeningPort, error) {
+	var ports []ListeningPort
+	for _, family := range []uint32{afInet, afInet6} {
+		table, err := extendedTCPTable(family)
+		if err != nil {
+			return nil, err
+		}
+		ports = append(ports, parseTCPTable(table, family)...)
+	}
+	return ports, nil
+}
+
+// extendedTCPTable returns the raw listener table of an address family
+func extendedTCPTable(family uint32) ([]byte, error) {
+	iphlpapi := syscall.NewLazyDLL("iphlpapi.dll")
+	getExtendedTCPTable := iphlpapi.NewProc("GetExtendedTcpTable")
+
+	var size uint32
+	for {
+		buffer := make([]byte, size)
+		var pointer uintptr
+		if size > 0 {
+			pointer = uintptr(unsafe.Pointer(&buffer[0]))
+		}
+		ret, _, _ := getExtendedTCPTable.Call(pointer, uintptr(unsafe.Pointer(&size)), 0, uintptr(family), tcpTableOwnerPIDListener, 0)
+		switch ret {
+		case 0:
+			return buffer, nil
+		case errorInsufficientBuffer:
+			// size now holds the required size; the table can grow before the next call
+			continue
+		default:
+			return nil, fmt.Errorf("GetExtendedTcpTable failed with error %d", ret)
+		}
+	}
+}
+
+// parseTCPTable decodes a MIB_TCPTABLE_OWNER_PID or MIB_TCP6TABLE_OWNER_PID. Ports are stored
+// in network byte order in the low 16 bits of a DWORD.
+func parseTCPTable(table []byte, family uint32) []ListeningPort {
+	if len(table) < 4 {
+		return nil
+	}
+	count := int(binary.LittleEndian.Uint32(table))
+	rowSize, offset := tcpRowSize, 4
+	if family == afInet6 {
+		rowSize = tcp6RowSize
+	}
+
+	var ports []ListeningPort
+	for i := 0; i < count && offset+rowSize <= len(table); i, offset = i+1, offset+rowSize {
+		row := table[offset : offset+rowSize]
+		var address net.IP
+		var port uint16
+		var pid uint32
+		if family == afInet6 {
+			// ucLocalAddr[16], dwLocalScopeId, dwLocalPort, ..., dwOwningPid
+			address = net.IP(append([]byte{}, row[0:16]...))
+			port = binary.BigEndian.Uint16(row[20:22])
+			pid = binary.LittleEndian.Uint32(row[52:56])
+		} else {
+			// dwState, dwLocalAddr, dwLocalPort, dwRemoteAddr, dwRemotePort, dwOwningPid
+			address = net.IP(append([]byte{}, row[4:8]...))
+			port = binary.BigEndian.Uint16(row[8:10])
+			pid = binary.LittleEndian.Uint32(row[20:24])
+		}
+		ports = append(ports, ListeningPort{Address: address.String(), Port: int(port), Process: fmt.Sprintf("pid %d", pid)})
+	}
+	return ports
+}
@@ -0,0 +1,140 @@
+package internal
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DeployProfile is a named set of deploy settings from the profiles section of
+// ~/.graphsense/config.yaml, selected with deploy --profile. Flags given on the command line
+// take precedence over the profile.
+type DeployProfile struct {
+	// Port is the base port of the instance, as deploy --port
+	Port        int    `yaml:"port,omitempty"`
+	BindAddress string `yaml:"bind_address,omitempty"`
+	// Limits are the memory and CPU limits in the format of the deploy flags, e.g. memory: 4g
+	Limits         *DefinitionLimits `yaml:"limits,omitempty"`
+	Neo4jHeap      string            `yaml:"neo4j_heap,omitempty"`
+	Neo4jPageCache string            `yaml:"neo4j_pagecache,omitempty"`
+	IndexWorkers   int               `yaml:"index_workers,omitempty"`
+	IndexBatchSize int               `yaml:"index_batch_size,omitempty"`
+	Nice           bool              `yaml:"nice,omitempty"`
+	// AppImage pins the app image, e.g. graphsense/graphsense:1.4
+	AppImage string `yaml:"app_image,omitempty"`
+	// TTL lets instances expire this long after they are deployed, e.g. 72h, as deploy --ttl
+	TTL string `yaml:"ttl,omitempty"`
+	// ImageTags pin services to tags of their images, keyed by service name, as
+	// --image-tag and --<service>-image-tag
+	ImageTags map[string]string `yaml:"image_tags,omitempty"`
+	// Env overrides environment variables of single services, keyed by service name
+	Env map[string]map[string]string `yaml:"env,omitempty"`
+}
+
+// DeployProfile returns the deploy profile with the given name
+func (c *Config) DeployProfile(name string) (*DeployProfile, error) {
+	profile, ok := c.Profiles[name]
+	if !ok {
+		if len(c.Profiles) == 0 {
+			return nil, fmt.Errorf("unknown profile '%s': no profiles are defined in the config file", name)
+		}
+		return nil, fmt.Errorf("unknown profile '%s', expected one of %s", name, strings.Join(c.ProfileNames(), ", "))
+	}
+	if err := profile.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid profile '%s': %v", name, err)
+	}
+	return &profile, nil
+}
+
+// ProfileNames returns the names of the deploy profiles, sorted
+func (c *Config) ProfileNames() []string {
+	names := make([]string, 0, len(c.Profiles))
+	for name := range c.Profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Validate checks the settings of the profile
+func (p *DeployProfile) Validate() error {
+	if p.Port < 0 || p.Port > 65535 {
+		return fmt.Errorf("invalid port %d", p.Port)
+	}
+	if err := ValidateBindAddress(p.BindAddress); err != nil {
+		return err
+	}
+	if p.Limits != nil {
+		if _, _, err := p.Limits.Parse(); err != nil {
+			return err
+		}
+	}
+	if _, err := ParseNeo4jMemory("heap", p.Neo4jHeap); err != nil {
+		return err
+	}
+	if _, err := ParseNeo4jMemory("page cache", p.Neo4jPageCache); err != nil {
+		return err
+	}
+	if err := ValidateIndexing(p.IndexWorkers, p.IndexBatchSize); err != nil {
+		return err
+	}
+	if p.TTL != "" {
+		if ttl, err := time.ParseDuration(p.TTL); err != nil || ttl < 0 {
+			return fmt.Errorf("invalid ttl '%s', e.g. 72h", p.TTL)
+		}
+	}
+	for service, tag := range p.ImageTags {
+		if !isPinnableService(service) {
+			return fmt.Errorf("image_tags: unknown service '%s', expected one of %s", service, strings.Join(PinnableServices, ", "))
+		}
+		if err := ValidateImageTag(tag); err != nil {
+			return err
+		}
+	}
+	return ValidateServiceEnv(p.Env)
+}
+
+// FlagValues returns the deploy flags the profile sets, by flag name, in the format they are
+// given on the command line
+func (p *DeployProfile) FlagValues() map[string]string {
+	values := make(map[string]string)
+	set := func(flag, value string) {
+		if value != "" {
+			values[flag] = value
+		}
+	}
+	if p.Port != 0 {
+		set("port", strconv.Itoa(p.Port))
+	}
+	set("bind-address", p.BindAddress)
+	if p.Limits != nil {
+		set("memory", p.Limits.Memory)
+		set("cpus", p.Limits.CPUs)
+		for service, limits := range p.Limits.Services {
+			set(service+"-memory", limits.Memory)
+			set(service+"-cpus", limits.CPUs)
+		}
+	}
+	set("neo4j-heap", p.Neo4jHeap)
+	set("neo4j-pagecache", p.Neo4jPageCache)
+	if p.IndexWorkers != 0 {
+		set("index-workers", strconv.Itoa(p.IndexWorkers))
+	}
+	if p.IndexBatchSize != 0 {
+		set("index-batch-size", strconv.Itoa(p.IndexBatchSize))
+	}
+	if p.Nice {
+		set("nice", "true")
+	}
+	set("ttl", p.TTL)
+	for service, tag := range p.ImageTags {
+		if service == "app" {
+			set("image-tag", tag)
+		} else {
+			set(service+"-image-tag", tag)
+		}
+	}
+	return values
+}
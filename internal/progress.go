@@ -0,0 +1,363 @@
+package internal
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Steps a service goes through while an instance is deployed
+const (
+	StepWaiting  = "waiting"
+	StepPulling  = "pulling"
+	StepPulled   = "pulled"
+	StepCreating = "creating"
+	StepCreated  = "created"
+	StepStarting = "starting"
+	StepStarted  = "started"
+	StepHealthy  = "healthy"
+	StepFailed   = "failed"
+)
+
+// spinnerFrames animate the services that are still in progress
+var spinnerFrames = []string{"⠋", "⠙", "⠹", "⠸", "⠼", "⠴", "⠦", "⠧", "⠇", "⠏"}
+
+// spinnerInterval is how often a live progress display is redrawn
+const spinnerInterval = 100 * time.Millisecond
+
+// maxFailureOutput is how many lines of compose output a failure without a known service shows
+const maxFailureOutput = 5
+
+// serviceProgress is the step one service of an instance is at
+type serviceProgress struct {
+	service string
+	step    string
+	detail  string
+}
+
+// DeployProgress shows the steps the services of an instance go through while it starts:
+// pulling, creating, starting and healthy. It reads them from the output of docker compose
+// and from health probes. A live display redraws one line per service with spinners; plain
+// progress logs every step instead, for CI logs and screen readers.
+type DeployProgress struct {
+	mu       sync.Mutex
+	out      io.Writer
+	live     bool
+	instance string
+	services []*serviceProgress
+	// output is the compose output that was not a progress event, kept to explain failures
+	output []string
+	drawn  int
+	frame  int
+	stop   chan struct{}
+	done   chan struct{}
+}
+
+// NewDeployProgress returns the progress of the services of an instance, drawn live to out
+// or logged line by line
+func NewDeployProgress(config *DeployConfig, out io.Writer, live bool) *DeployProgress {
+	p := &DeployProgress{out: out, live: live, instance: config.InstanceName}
+	names := []string{"app"}
+	if !config.IsSingleContainer() {
+		names = []string{"postgres", "neo4j"}
+		if config.LocalEmbeddings() != nil {
+			names = append(names, "embeddings")
+		}
+		names = append(names, "app")
+	}
+	for _, name := range names {
+		p.services = append(p.services, &serviceProgress{service: name, step: StepWaiting})
+	}
+	return p
+}
+
+// Start starts drawing a live display, unless it is already drawn
+func (p *DeployProgress) Start() {
+	if !p.live || p.stop != nil {
+		return
+	}
+	p.stop = make(chan struct{})
+	p.done = make(chan struct{})
+	go func() {
+		defer close(p.done)
+		ticker := time.NewTicker(spinnerInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-p.stop:
+				return
+			case <-ticker.C:
+				p.mu.Lock()
+				p.frame++
+				p.draw()
+				p.mu.Unlock()
+			}
+		}
+	}()
+	p.mu.Lock()
+	p.draw()
+	p.mu.Unlock()
+}
+
+// Stop stops a live display, leaving its final state on the screen
+func (p *DeployProgress) Stop() {
+	if p.stop == nil {
+		return
+	}
+	close(p.stop)
+	<-p.done
+	p.stop = nil
+	p.mu.Lock()
+	p.draw()
+	p.mu.Unlock()
+}
+
+// Set moves a service to a step. Services the instance does not have are ignored, and a
+// failed or healthy service stays so.
+func (p *DeployProgress) Set(service, step, detail string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	s := p.service(service)
+	if s == nil || s.step == StepFailed || (s.step == StepHealthy && step != StepFailed) {
+		return
+	}
+	if s.step == step && s.detail == detail {
+		return
+	}
+	s.step, s.detail = step, detail
+	if p.live {
+		p.draw()
+		return
+	}
+	if detail != "" {
+		Log.Info("Service "+step, "instance", p.instance, "service", service, "detail", detail)
+	} else {
+		Log.Info("Service "+step, "instance", p.instance, "service", service)
+	}
+}
+
+// SetAll moves every service that has not failed to a step, e.g. starting
+func (p *DeployProgress) SetAll(step string) {
+	for _, s := range p.services {
+		p.Set(s.service, step, "")
+	}
+}
+
+// Health records the result of probing a service
+func (p *DeployProgress) Health(result ServiceHealth) {
+	if result.Healthy {
+		p.Set(result.Service, StepHealthy, "")
+		return
+	}
+	p.Set(result.Service, StepStarted, result.Detail)
+}
+
+// ComposeLine reads a line of docker compose output, moving services to the steps it reports.
+// It understands the plain progress of Compose v2 and the output of docker-compose v1.
+func (p *DeployProgress) ComposeLine(line string) {
+	Log.Verbose(line)
+	fields := strings.Fields(line)
+	if len(fields) < 2 {
+		p.keepOutput(line)
+		return
+	}
+
+	// v2: " Container <name>  Started" and " <service> Pulling"
+	if fields[0] == "Container" && len(fields) >= 3 {
+		if step, ok := composeContainerSteps[fields[2]]; ok {
+			p.Set(p.containerService(fields[1]), step, composeDetail(fields[3:]))
+			return
+		}
+	}
+	if p.known(fields[0]) {
+		if step, ok := composePullSteps[fields[1]]; ok {
+			p.Set(fields[0], step, composeDetail(fields[2:]))
+			return
+		}
+	}
+
+	// v1: "Pulling postgres (postgres:15)...", "Creating <name> ... done" and
+	// "ERROR: for <name>  Cannot start service app: ..."
+	switch fields[0] {
+	case "Pulling":
+		p.Set(fields[1], StepPulling, "")
+		return
+	case "Creating", "Recreating", "Starting":
+		step := StepCreated
+		if fields[0] == "Starting" {
+			step = StepStarted
+		}
+		if strings.HasSuffix(line, "error") {
+			step = StepFailed
+		}
+		p.Set(p.containerService(fields[1]), step, "")
+		return
+	case "ERROR:":
+		if len(fields) >= 4 && fields[1] == "for" {
+			p.Set(p.containerService(fields[2]), StepFailed, strings.Join(fields[3:], " "))
+			return
+		}
+	}
+	p.keepOutput(line)
+}
+
+// composeContainerSteps maps the container events of Compose v2 to steps
+var composeContainerSteps = map[string]string{
+	"Creating":   StepCreating,
+	"Created":    StepCreated,
+	"Recreate":   StepCreating,
+	"Recreated":  StepCreated,
+	"Starting":   StepStarting,
+	"Started":    StepStarted,
+	"Running":    StepStarted,
+	"Error":      StepFailed,
+	"Unhealthy":  StepFailed,
+	"Restarting": StepStarting,
+}
+
+// composePullSteps maps the image events of Compose v2 to steps
+var composePullSteps = map[string]string{
+	"Pulling": StepPulling,
+	"Pulled":  StepPulled,
+	"Error":   StepFailed,
+}
+
+// composeDetail joins the words after an event, which are the error of failed services
+func composeDetail(words []string) string {
+	return strings.TrimSpace(strings.Join(words, " "))
+}
+
+// Fail explains a failed docker compose run, naming the service that failed and why
+func (p *DeployProgress) Fail(err error) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for _, s := range p.services {
+		if s.step != StepFailed {
+			continue
+		}
+		reason := s.detail
+		if reason == "" {
+			reason = p.outputAbout(s.service)
+		}
+		if reason == "" {
+			reason = err.Error()
+		}
+		return fmt.Errorf("service %s failed: %s", s.service, reason)
+	}
+
+	// Errors from the daemon name the container, not the service
+	for _, s := range p.services {
+		if reason := p.outputAbout(s.service); reason != "" {
+			s.step, s.detail = StepFailed, reason
+			return fmt.Errorf("service %s failed: %s", s.service, reason)
+		}
+	}
+
+	output := p.output
+	if len(output) > maxFailureOutput {
+		output = output[len(output)-maxFailureOutput:]
+	}
+	if len(output) == 0 {
+		return err
+	}
+	return fmt.Errorf("%v: %s", err, strings.Join(output, "; "))
+}
+
+// FailUnhealthy marks the services that never became healthy as failed
+func (p *DeployProgress) FailUnhealthy(results []ServiceHealth) {
+	for _, result := range results {
+		if !result.Healthy {
+			p.Set(result.Service, StepFailed, result.Detail)
+		}
+	}
+}
+
+// outputAbout returns the last line of kept compose output that mentions the container of a
+// service, or "" if none does
+func (p *DeployProgress) outputAbout(service string) string {
+	container := p.instance + "-" + service
+	for i := len(p.output) - 1; i >= 0; i-- {
+		if strings.Contains(p.output[i], container) {
+			return p.output[i]
+		}
+	}
+	return ""
+}
+
+// keepOutput keeps a line of compose output that was not a progress event
+func (p *DeployProgress) keepOutput(line string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.output = append(p.output, strings.TrimSpace(line))
+}
+
+// known reports whether the instance has a service
+func (p *DeployProgress) known(service string) bool {
+	return p.service(service) != nil
+}
+
+// service returns the progress of a service, or nil if the instance does not have it
+func (p *DeployProgress) service(name string) *serviceProgress {
+	for _, s := range p.services {
+		if s.service == name {
+			return s
+		}
+	}
+	return nil
+}
+
+// containerService returns the service of a container of the instance, <instance>-<service>
+func (p *DeployProgress) containerService(container string) string {
+	return strings.TrimPrefix(strings.Trim(container, `"`), p.instance+"-")
+}
+
+// draw redraws the live display over its previous frame
+func (p *DeployProgress) draw() {
+	if !p.live {
+		return
+	}
+	var b strings.Builder
+	if p.drawn > 0 {
+		fmt.Fprintf(&b, "\033[%dA", p.drawn)
+	}
+	for _, s := range p.services {
+		b.WriteString("\r\033[K  ")
+		b.WriteString(p.symbol(s.step))
+		fmt.Fprintf(&b, " %-10s %s", s.service, stepColor(s.step))
+		if s.detail != "" {
+			b.WriteString(Colorize(ColorGray, ": "+s.detail))
+		}
+		b.WriteString("\n")
+	}
+	p.drawn = len(p.services)
+	fmt.Fprint(p.out, b.String())
+}
+
+// symbol returns the mark drawn in front of a service at a step
+func (p *DeployProgress) symbol(step string) string {
+	switch step {
+	case StepHealthy:
+		return Colorize(ColorGreen, "✔")
+	case StepFailed:
+		return Colorize(ColorRed, "✖")
+	case StepWaiting:
+		return Colorize(ColorGray, "·")
+	}
+	return Colorize(ColorCyan, spinnerFrames[p.frame%len(spinnerFrames)])
+}
+
+// stepColor colors the name of a step
+func stepColor(step string) string {
+	switch step {
+	case StepHealthy:
+		return Colorize(ColorGreen, step)
+	case StepFailed:
+		return Colorize(ColorRed, step)
+	case StepWaiting:
+		return Colorize(ColorGray, step)
+	}
+	return step
+}
@@ -0,0 +1,88 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// Deployment statuses recorded in the deployments table
+const (
+	DeployStatusInProgress = "in-progress"
+	DeployStatusFailed     = "failed"
+	DeployStatusComplete   = "complete"
+	// DeployStatusRemoved marks an instance whose containers were removed while its
+	// definition was kept; deploy --resume deploys it again
+	DeployStatusRemoved = "removed"
+)
+
+// ErrInterrupted is returned when a deploy is stopped by a signal
+var ErrInterrupted = errors.New("deploy interrupted")
+
+// Stage is a single step of the deploy pipeline. Always marks stages that only
+// produce transient state (such as temp files) and must run again on resume.
+type Stage struct {
+	Name   string
+	Run    func(ctx context.Context) error
+	Always bool
+}
+
+// Provisioner runs deploy stages in order and only stops between stages,
+// so an interrupted deploy always ends at a known point
+type Provisioner struct {
+	Stages    []Stage
+	Completed []string
+	Current   string
+
+	// Checkpoint, when set, is called after each stage completes
+	Checkpoint func(stage string) error
+}
+
+// Run executes the stages in order until one fails or the context is cancelled.
+// Stages already listed in Completed are skipped unless they are marked Always.
+func (p *Provisioner) Run(ctx context.Context) error {
+	for i, stage := range p.Stages {
+		if ctx.Err() != nil {
+			return ErrInterrupted
+		}
+
+		done := p.isCompleted(stage.Name)
+		if done && !stage.Always {
+			Log.Verbose("Skipping completed stage", "stage", stage.Name, "step", fmt.Sprintf("%d/%d", i+1, len(p.Stages)))
+			continue
+		}
+
+		p.Current = stage.Name
+		Log.Info("Running stage", "stage", stage.Name, "step", fmt.Sprintf("%d/%d", i+1, len(p.Stages)))
+		if err := stage.Run(ctx); err != nil {
+			// A stage whose child process was killed by the same signal
+			// reports a generic failure, so prefer the interruption
+			if ctx.Err() != nil {
+				return ErrInterrupted
+			}
+			return fmt.Errorf("stage %s failed: %v", stage.Name, err)
+		}
+
+		if !done {
+			p.Completed = append(p.Completed, stage.Name)
+		}
+		p.Current = ""
+
+		if p.Checkpoint != nil {
+			if err := p.Checkpoint(stage.Name); err != nil {
+				Log.Warning("Failed to record checkpoint", "stage", stage.Name, "error", err)
+			}
+		}
+	}
+
+	return nil
+}
+
+func (p *Provisioner) isCompleted(name string) bool {
+	for _, completed := range p.Completed {
+		if completed == name {
+			return true
+		}
+	}
+	return false
+}
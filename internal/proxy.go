@@ -0,0 +1,353 @@
+package internal
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"text/template"
+)
+
+// The reverse proxy routes https://<instance>.graphsense.localhost to the app of every
+// instance. Rather than joining the proxy to each instance's network, which would keep
+// compose down from removing those networks, the apps join the proxy's network.
+const (
+	ProxyContainerName = "graphsense-proxy"
+	ProxyNetwork       = "graphsense-proxy"
+	ProxyImage         = "caddy:2"
+	ProxyDomain        = "graphsense.localhost"
+	DefaultProxyPort   = 443
+	// proxyDataVolume keeps Caddy's local certificate authority across restarts, so clients
+	// only have to trust its root certificate once
+	proxyDataVolume = "graphsense-proxy-data"
+	// ProxyRootCertificate is the root certificate of Caddy's local authority in its container
+	ProxyRootCertificate = "/data/caddy/pki/authorities/local/root.crt"
+	// proxyLogDir is where Caddy writes its access log, access.log, in its container. It is
+	// mounted from the logs directory of the proxy directory.
+	proxyLogDir = "/var/log/caddy"
+)
+
+// ProxyHost returns the host name the proxy routes to an instance
+func ProxyHost(instanceName string) string {
+	return instanceName + "." + ProxyDomain
+}
+
+// ProxyInfo describes the proxy container
+type ProxyInfo struct {
+	Running     bool
+	Port        int
+	BindAddress string
+}
+
+// URL returns the address the proxy serves an instance at
+func (p *ProxyInfo) URL(instanceName string) string {
+	if p.Port == DefaultProxyPort {
+		return "https://" + ProxyHost(instanceName)
+	}
+	return fmt.Sprintf("https://%s:%d", ProxyHost(instanceName), p.Port)
+}
+
+// GetProxy returns the proxy container, or nil if the proxy is not enabled
+func GetProxy() (*ProxyInfo, error) {
+	docker, err := GetDockerClient()
+	if err != nil {
+		return nil, err
+	}
+	exists, err := docker.NetworkExists(context.Background(), ProxyNetwork)
+	if err != nil || !exists {
+		return nil, err
+	}
+	info, err := docker.InspectContainer(context.Background(), ProxyContainerName)
+	if err != nil {
+		return nil, nil
+	}
+
+	proxy := &ProxyInfo{Running: info.State != nil && info.State.Running}
+	if info.HostConfig != nil {
+		for port, bindings := range info.HostConfig.PortBindings {
+			if port.Port() != "443" || len(bindings) == 0 {
+				continue
+			}
+			proxy.Port, _ = strconv.Atoi(bindings[0].HostPort)
+			proxy.BindAddress = bindings[0].HostIP
+		}
+	}
+	return proxy, nil
+}
+
+// ProxyRoute is a host name the proxy routes to the app of an instance
+type ProxyRoute struct {
+	Instance string
+	Host     string
+	Upstream string
+	// TLS is set for apps that serve HTTPS themselves
+	TLS bool
+}
+
+// ProxyRoutes returns the routes of every deployed instance
+func ProxyRoutes() ([]ProxyRoute, error) {
+	names, err := GetInstanceNames()
+	if err != nil {
+		return nil, err
+	}
+
+	var routes []ProxyRoute
+	for _, name := range names {
+		config, status, err := GetDeployment(name)
+		if err != nil {
+			return nil, err
+		}
+		if config == nil || status != DeployStatusComplete {
+			continue
+		}
+		routes = append(routes, ProxyRoute{
+			Instance: name,
+			Host:     ProxyHost(name),
+			Upstream: fmt.Sprintf("%s-app:8080", name),
+			TLS:      config.TLS,
+		})
+	}
+	return routes, nil
+}
+
+// caddyfileTemplate renders the proxy configuration. Certificates come from Caddy's local
+// authority, and port 80 is not published, so there is nothing to redirect. Requests are
+// logged for the access log, readable by the CLI outside the container.
+var caddyfileTemplate = template.Must(template.New("caddyfile").Parse(`# Generated by graphsense-cli, changes are overwritten
+{
+	local_certs
+	auto_https disable_redirects
+}
+{{range .}}
+{{.Host}} {
+	tls internal
+	log {
+		output file /var/log/caddy/access.log {
+			mode 644
+		}
+		format json
+	}
+{{- if .TLS}}
+	# The app's certificate is issued for the names clients use, not its container name
+	reverse_proxy https://{{.Upstream}} {
+		transport http {
+			tls_insecure_skip_verify
+		}
+	}
+{{- else}}
+	reverse_proxy {{.Upstream}}
+{{- end}}
+}
+{{end}}`))
+
+// RenderCaddyfile renders the proxy configuration for routes
+func RenderCaddyfile(routes []ProxyRoute) (string, error) {
+	var buf bytes.Buffer
+	if err := caddyfileTemplate.Execute(&buf, routes); err != nil {
+		return "", fmt.Errorf("failed to render proxy configuration: %v", err)
+	}
+	return buf.String(), nil
+}
+
+// GetProxyDir returns the directory holding the proxy configuration, ~/.graphsense/proxy
+func GetProxyDir() (string, error) {
+	graphsenseDir, err := GetGraphsenseDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(graphsenseDir, "proxy"), nil
+}
+
+// GetProxyAccessLogPath returns the access log the proxy writes, in ~/.graphsense/proxy/logs
+func GetProxyAccessLogPath() (string, error) {
+	dir, err := GetProxyDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "logs", "access.log"), nil
+}
+
+// writeCaddyfile writes the configuration for routes into the proxy directory
+func writeCaddyfile(routes []ProxyRoute) error {
+	content, err := RenderCaddyfile(routes)
+	if err != nil {
+		return err
+	}
+	dir, err := GetProxyDir()
+	if err != nil {
+		return err
+	}
+	// Docker would create a missing logs directory owned by root
+	if err := os.MkdirAll(filepath.Join(dir, "logs"), 0755); err != nil {
+		return fmt.Errorf("failed to create proxy directory: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "Caddyfile"), []byte(content), 0644); err != nil {
+		return fmt.Errorf("failed to write proxy configuration: %v", err)
+	}
+	return nil
+}
+
+// ProxyRunArgs returns the docker run arguments that start the proxy
+func ProxyRunArgs(dir string, port int, bindAddress string) []string {
+	published := strconv.Itoa(port)
+	if bindAddress != "" && !isWildcard(bindAddress) {
+		published = net.JoinHostPort(bindAddress, published)
+	}
+	return []string{"run", "-d",
+		"--name", ProxyContainerName,
+		"--network", ProxyNetwork,
+		"--restart", "unless-stopped",
+		"-p", published + ":443",
+		"-v", dir + ":/etc/caddy:ro",
+		"-v", filepath.Join(dir, "logs") + ":" + proxyLogDir,
+		"-v", proxyDataVolume + ":/data",
+		ProxyImage,
+	}
+}
+
+// EnableProxy starts the proxy on port of bindAddress and routes every deployed instance
+func EnableProxy(port int, bindAddress string) error {
+	docker, err := GetDockerClient()
+	if err != nil {
+		return err
+	}
+	ctx := context.Background()
+
+	exists, err := docker.NetworkExists(ctx, ProxyNetwork)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		if err := docker.CreateNetwork(ctx, ProxyNetwork); err != nil {
+			return err
+		}
+	}
+
+	routes, err := ProxyRoutes()
+	if err != nil {
+		return err
+	}
+	if err := writeCaddyfile(routes); err != nil {
+		return err
+	}
+	dir, err := GetProxyDir()
+	if err != nil {
+		return err
+	}
+
+	cmd := Command("docker", ProxyRunArgs(dir, port, bindAddress)...)
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("failed to start proxy container: %v", err)
+	}
+	return connectApps(routes)
+}
+
+// DisableProxy removes the proxy container and its network. The data volume with the local
+// certificate authority is kept, so clients that trust it keep working after enabling again.
+func DisableProxy() error {
+	docker, err := GetDockerClient()
+	if err != nil {
+		return err
+	}
+	ctx := context.Background()
+
+	if _, err := docker.InspectContainer(ctx, ProxyContainerName); err == nil {
+		if err := docker.RemoveContainer(ctx, ProxyContainerName); err != nil {
+			return err
+		}
+	}
+
+	exists, err := docker.NetworkExists(ctx, ProxyNetwork)
+	if err != nil || !exists {
+		return err
+	}
+	containers, err := docker.NetworkContainers(ctx, ProxyNetwork)
+	if err != nil {
+		return err
+	}
+	for _, name := range containers {
+		if err := docker.DisconnectNetwork(ctx, ProxyNetwork, name); err != nil {
+			return err
+		}
+	}
+	return docker.RemoveNetwork(ctx, ProxyNetwork)
+}
+
+// SyncProxyRoutes updates the proxy's routes to the deployed instances and reloads it. It
+// does nothing while the proxy is not enabled.
+func SyncProxyRoutes() error {
+	proxy, err := GetProxy()
+	if err != nil || proxy == nil {
+		return err
+	}
+
+	routes, err := ProxyRoutes()
+	if err != nil {
+		return err
+	}
+	if err := writeCaddyfile(routes); err != nil {
+		return err
+	}
+	if err := connectApps(routes); err != nil {
+		return err
+	}
+	if !proxy.Running {
+		return nil
+	}
+
+	output, err := Command("docker", "exec", ProxyContainerName, "caddy", "reload", "--config", "/etc/caddy/Caddyfile", "--adapter", "caddyfile").CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("failed to reload proxy: %v: %s", err, bytes.TrimSpace(output))
+	}
+	return nil
+}
+
+// connectApps attaches the app containers of routes to the proxy network, for apps created
+// before the proxy was enabled
+func connectApps(routes []ProxyRoute) error {
+	docker, err := GetDockerClient()
+	if err != nil {
+		return err
+	}
+	ctx := context.Background()
+
+	attached, err := docker.NetworkContainers(ctx, ProxyNetwork)
+	if err != nil {
+		return err
+	}
+	connected := make(map[string]bool)
+	for _, name := range attached {
+		connected[name] = true
+	}
+
+	for _, route := range routes {
+		app := route.Instance + "-app"
+		if connected[app] {
+			continue
+		}
+		if _, err := docker.InspectContainer(ctx, app); err != nil {
+			continue
+		}
+		if err := docker.ConnectNetwork(ctx, ProxyNetwork, app); err != nil {
+			Log.Warning("Failed to route instance through the proxy", "instance", route.Instance, "error", err)
+		}
+	}
+	return nil
+}
+
+// ProxyNetworkName returns the proxy network for the compose override to join apps to, or
+// an empty string while the proxy is not enabled
+func (c *DeployConfig) ProxyNetworkName() string {
+	docker, err := GetDockerClient()
+	if err != nil {
+		return ""
+	}
+	if exists, err := docker.NetworkExists(context.Background(), ProxyNetwork); err != nil || !exists {
+		return ""
+	}
+	return ProxyNetwork
+}
@@ -0,0 +1,98 @@
+package internal
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+// IdleInstance is an instance suggested for removal when a quota is reached
+type IdleInstance struct {
+	Name      string
+	LastUsed  time.Time
+	DiskUsage int64
+}
+
+// QuotaError is returned when deploying another instance would exceed a configured quota
+type QuotaError struct {
+	Reason      string
+	Suggestions []IdleInstance
+}
+
+func (e *QuotaError) Error() string {
+	return e.Reason
+}
+
+// CheckQuotas verifies that one more instance may be deployed under the configured quotas
+func CheckQuotas(quotas QuotaConfig) error {
+	if quotas.MaxInstances <= 0 && quotas.MaxTotalDisk == "" {
+		return nil
+	}
+
+	names, err := GetInstanceNames()
+	if err != nil {
+		return err
+	}
+
+	if quotas.MaxInstances > 0 && len(names) >= quotas.MaxInstances {
+		return &QuotaError{
+			Reason:      fmt.Sprintf("instance quota reached: %d of %d instances deployed (quotas.max_instances)", len(names), quotas.MaxInstances),
+			Suggestions: idleInstances(names, nil),
+		}
+	}
+
+	if quotas.MaxTotalDisk != "" {
+		maxDisk, err := ParseSize(quotas.MaxTotalDisk)
+		if err != nil {
+			return fmt.Errorf("invalid quotas.max_total_disk: %v", err)
+		}
+
+		volumeSizes, err := GetVolumeSizes()
+		if err != nil {
+			return err
+		}
+
+		var total int64
+		for _, name := range names {
+			total += GetInstanceDiskUsage(name, volumeSizes)
+		}
+
+		if total >= maxDisk {
+			return &QuotaError{
+				Reason:      fmt.Sprintf("disk quota reached: instances use %s of %s (quotas.max_total_disk)", FormatSize(total), FormatSize(maxDisk)),
+				Suggestions: idleInstances(names, volumeSizes),
+			}
+		}
+	}
+
+	return nil
+}
+
+// idleInstances returns up to three instances ordered from least to most recently used
+func idleInstances(names []string, volumeSizes map[string]int64) []IdleInstance {
+	lastUsed, err := GetLastUsed()
+	if err != nil {
+		lastUsed = map[string]time.Time{}
+	}
+
+	var idle []IdleInstance
+	for _, name := range names {
+		instance := IdleInstance{Name: name, LastUsed: lastUsed[name]}
+		if volumeSizes != nil {
+			instance.DiskUsage = GetInstanceDiskUsage(name, volumeSizes)
+		}
+		idle = append(idle, instance)
+	}
+
+	sort.SliceStable(idle, func(i, j int) bool {
+		if idle[i].LastUsed.Equal(idle[j].LastUsed) {
+			return idle[i].DiskUsage > idle[j].DiskUsage
+		}
+		return idle[i].LastUsed.Before(idle[j].LastUsed)
+	})
+
+	if len(idle) > 3 {
+		idle = idle[:3]
+	}
+	return idle
+}
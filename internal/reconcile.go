@@ -0,0 +1,213 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/filters"
+)
+
+// Actions of a reconcile change
+const (
+	ReconcileRemove = "remove"
+	ReconcileAdopt  = "adopt"
+)
+
+// ReconcileChange is one difference between instances.db and the containers Docker runs
+type ReconcileChange struct {
+	Action   string        `json:"action" yaml:"action"`
+	Instance string        `json:"instance" yaml:"instance"`
+	Detail   string        `json:"detail" yaml:"detail"`
+	Config   *DeployConfig `json:"-" yaml:"-"`
+}
+
+// PlanReconcile compares instances.db with the containers of `docker ps -a`. Instances whose
+// containers are all gone are to be removed from the database, except deploys that did not
+// complete, which stay resumable. GraphSense compose projects the database does not know,
+// such as ones created before it tracked instances, are to be adopted.
+func PlanReconcile() ([]ReconcileChange, error) {
+	docker, err := GetDockerClient()
+	if err != nil {
+		return nil, err
+	}
+	// Any error must stop the plan: an empty container list would mark every instance stale
+	containers, err := docker.ListContainers(context.Background(), true, filters.NewArgs(filters.Arg("label", ComposeProjectLabel)))
+	if err != nil {
+		return nil, err
+	}
+	projects := make(map[string][]types.Container)
+	for _, container := range containers {
+		project := container.Labels[ComposeProjectLabel]
+		projects[project] = append(projects[project], container)
+	}
+
+	names, err := GetInstanceNames()
+	if err != nil {
+		return nil, err
+	}
+	known := make(map[string]bool)
+
+	var changes []ReconcileChange
+	for _, name := range names {
+		known[name] = true
+		if len(projects[name]) > 0 {
+			continue
+		}
+		_, status, err := GetDeployment(name)
+		if err != nil {
+			return nil, err
+		}
+		if status != "" && status != DeployStatusComplete {
+			continue
+		}
+		changes = append(changes, ReconcileChange{
+			Action:   ReconcileRemove,
+			Instance: name,
+			Detail:   "no containers left",
+		})
+	}
+
+	graphsenseProjects, err := GetGraphsenseProjects()
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range graphsenseProjects {
+		if known[name] {
+			continue
+		}
+		// Adopting these as they are would keep containers no other command finds
+		if isLegacyProject(name, projects[name]) {
+			Log.Warning("Not adopting legacy compose project, run 'graphsense-cli migrate-legacy' instead", "project", name)
+			continue
+		}
+		config, err := adoptedConfig(name, projects[name])
+		if err != nil {
+			Log.Warning("Not adopting compose project", "project", name, "reason", err)
+			continue
+		}
+		detail := fmt.Sprintf("%s mode, app port %d", config.DeployMode(), config.AppPort)
+		if !config.IsSingleContainer() {
+			detail += fmt.Sprintf(", postgres %d, neo4j %d", config.PostgresPort, config.Neo4jBoltPort)
+		}
+		if config.RepoPath != "" {
+			detail += ", repository " + config.RepoPath
+		}
+		changes = append(changes, ReconcileChange{
+			Action:   ReconcileAdopt,
+			Instance: name,
+			Detail:   detail,
+			Config:   config,
+		})
+	}
+
+	return changes, nil
+}
+
+// adoptedConfig reconstructs the configuration of an untracked instance from its containers
+func adoptedConfig(instanceName string, containers []types.Container) (*DeployConfig, error) {
+	byService := make(map[string]types.Container)
+	for _, container := range containers {
+		byService[container.Labels[ComposeServiceLabel]] = container
+	}
+
+	app, ok := byService["app"]
+	if !ok {
+		return nil, fmt.Errorf("no app container")
+	}
+
+	config := &DeployConfig{InstanceName: instanceName}
+	for _, mount := range app.Mounts {
+		if mount.Destination == "/home/repo" {
+			config.RepoPath = mount.Source
+		}
+	}
+	config.AppPort, config.BindAddress = publishedPort(app, 8080)
+	if config.AppPort == 0 {
+		return nil, fmt.Errorf("the app container does not publish port 8080")
+	}
+
+	postgres, hasPostgres := byService["postgres"]
+	if !hasPostgres {
+		config.Mode = DeployModeSingle
+		if app.Image != AllInOneImage {
+			config.AppImage = app.Image
+		}
+		return config, nil
+	}
+	config.PostgresPort, _ = publishedPort(postgres, 5432)
+	if neo4j, ok := byService["neo4j"]; ok {
+		config.Neo4jBoltPort, _ = publishedPort(neo4j, 7687)
+	}
+	return config, nil
+}
+
+// publishedPort returns the host port and bind address a container publishes privatePort on,
+// with an empty address for all interfaces
+func publishedPort(container types.Container, privatePort uint16) (int, string) {
+	for _, port := range container.Ports {
+		if port.PrivatePort == privatePort && port.PublicPort != 0 {
+			if isWildcard(port.IP) {
+				return int(port.PublicPort), ""
+			}
+			return int(port.PublicPort), port.IP
+		}
+	}
+	return 0, ""
+}
+
+// ApplyReconcile carries out planned changes, stopping at the first one that fails
+func ApplyReconcile(changes []ReconcileChange) error {
+	for _, change := range changes {
+		switch change.Action {
+		case ReconcileRemove:
+			if err := RemoveInstanceContainers(change.Instance); err != nil {
+				return err
+			}
+			UnregisterMCP(change.Instance)
+			// Also releases the instance's ports
+			if err := RemoveDeployment(change.Instance); err != nil {
+				return err
+			}
+		case ReconcileAdopt:
+			if err := adoptInstance(change.Config); err != nil {
+				return fmt.Errorf("failed to adopt %s: %v", change.Instance, err)
+			}
+		}
+	}
+	return nil
+}
+
+// adoptInstance records an untracked instance as if it had been deployed by this CLI
+func adoptInstance(config *DeployConfig) error {
+	if err := reserveAdoptedPorts(config); err != nil {
+		return err
+	}
+	if err := SaveDeployment(config, DeployStatusComplete); err != nil {
+		return err
+	}
+	return StoreInstanceContainers(config)
+}
+
+// reserveAdoptedPorts reserves the ports an adopted instance publishes. Ports reserved for
+// another instance are only warned about, since the adopted containers already use them.
+func reserveAdoptedPorts(config *DeployConfig) error {
+	ports := []int{config.AppPort}
+	if !config.IsSingleContainer() {
+		ports = append(ports, config.PostgresPort, config.Neo4jBoltPort)
+	}
+	var reserved []int
+	for _, port := range ports {
+		if port != 0 {
+			reserved = append(reserved, port)
+		}
+	}
+	if err := ReservePorts(config.InstanceName, reserved...); errors.Is(err, ErrPortsReserved) {
+		Log.Warning("Ports of the adopted instance are reserved for another instance", "instance", config.InstanceName, "ports", strings.Trim(fmt.Sprint(reserved), "[]"))
+	} else if err != nil {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,152 @@
+package internal
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Autostart policies deciding whether an instance is brought back after its containers stop
+// because the Docker daemon or the host restarted
+const (
+	// AutostartUnlessStopped recovers instances that were not stopped with the stop command
+	AutostartUnlessStopped = "unless-stopped"
+	// AutostartAlways recovers instances even if they were stopped on purpose
+	AutostartAlways = "always"
+	// AutostartNever leaves stopped instances alone
+	AutostartNever = "never"
+)
+
+// AutostartPolicies lists the valid autostart policies
+var AutostartPolicies = []string{AutostartUnlessStopped, AutostartAlways, AutostartNever}
+
+// Outcomes of recovering an instance
+const (
+	RecoveryRunning   = "running"
+	RecoveryRecovered = "recovered"
+	RecoverySkipped   = "skipped"
+	RecoveryFailed    = "failed"
+)
+
+// AutostartPolicy returns the instance's autostart policy, defaulting to AutostartUnlessStopped
+func (c *DeployConfig) AutostartPolicy() string {
+	if c.Autostart == "" {
+		return AutostartUnlessStopped
+	}
+	return c.Autostart
+}
+
+// ValidateAutostart checks that policy is one of AutostartPolicies
+func ValidateAutostart(policy string) error {
+	for _, valid := range AutostartPolicies {
+		if policy == valid {
+			return nil
+		}
+	}
+	return fmt.Errorf("invalid autostart policy '%s': must be one of %s", policy, strings.Join(AutostartPolicies, ", "))
+}
+
+// RecoveryResult is what recovering one instance found and did
+type RecoveryResult struct {
+	Instance string `json:"instance" yaml:"instance"`
+	Policy   string `json:"policy" yaml:"policy"`
+	Outcome  string `json:"outcome" yaml:"outcome"`
+	// Stopped lists the containers found stopped, with when and how they exited
+	Stopped []string `json:"stopped,omitempty" yaml:"stopped,omitempty"`
+	Detail  string   `json:"detail,omitempty" yaml:"detail,omitempty"`
+}
+
+// RecoverInstance starts the stopped containers of an instance according to its autostart
+// policy and waits for it to become healthy again. Instances whose containers all run are
+// left alone.
+func RecoverInstance(ctx context.Context, instanceName string) RecoveryResult {
+	result := RecoveryResult{Instance: instanceName, Policy: AutostartUnlessStopped}
+
+	config, err := GetInstanceConfig(instanceName)
+	if err != nil {
+		result.Outcome, result.Detail = RecoveryFailed, err.Error()
+		return result
+	}
+	result.Policy = config.AutostartPolicy()
+
+	stopped, err := stoppedContainers(ctx, instanceName)
+	if err != nil {
+		result.Outcome, result.Detail = RecoveryFailed, err.Error()
+		return result
+	}
+	if len(stopped) == 0 {
+		result.Outcome = RecoveryRunning
+		return result
+	}
+	result.Stopped = stopped
+
+	switch result.Policy {
+	case AutostartNever:
+		result.Outcome, result.Detail = RecoverySkipped, "autostart policy is never"
+		return result
+	case AutostartUnlessStopped:
+		userStopped, err := InstanceStopped(instanceName)
+		if err != nil {
+			result.Outcome, result.Detail = RecoveryFailed, err.Error()
+			return result
+		}
+		if userStopped {
+			result.Outcome, result.Detail = RecoverySkipped, "stopped with the stop command"
+			return result
+		}
+	}
+
+	docker, err := GetDockerClient()
+	if err != nil {
+		result.Outcome, result.Detail = RecoveryFailed, err.Error()
+		return result
+	}
+	Log.Info("Recovering instance", "instance", instanceName, "stopped", len(stopped))
+	if err := docker.StartProject(ctx, instanceName); err != nil {
+		result.Outcome, result.Detail = RecoveryFailed, fmt.Sprintf("failed to start: %v", err)
+		return result
+	}
+	if _, err := WaitForHealthy(ctx, config, DefaultHealthOptions); err != nil {
+		result.Outcome, result.Detail = RecoveryFailed, fmt.Sprintf("started but not healthy: %v", err)
+		return result
+	}
+	if err := SetInstanceStopped(instanceName, false); err != nil {
+		Log.Warning("Failed to record instance state", "error", err)
+	}
+	RecordIndexedCommit(config)
+
+	result.Outcome = RecoveryRecovered
+	return result
+}
+
+// stoppedContainers describes the containers of an instance that are not running
+func stoppedContainers(ctx context.Context, instanceName string) ([]string, error) {
+	docker, err := GetDockerClient()
+	if err != nil {
+		return nil, err
+	}
+	containers, err := docker.ProjectContainers(ctx, instanceName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list containers: %v", err)
+	}
+	if len(containers) == 0 {
+		return nil, fmt.Errorf("instance '%s' has no containers", instanceName)
+	}
+
+	var stopped []string
+	for _, container := range containers {
+		if container.State == "running" {
+			continue
+		}
+		name := ContainerName(container)
+		description := fmt.Sprintf("%s (%s)", name, container.State)
+		if info, err := docker.InspectContainer(ctx, name); err == nil && info.State != nil {
+			if finished, err := time.Parse(time.RFC3339Nano, info.State.FinishedAt); err == nil && !finished.IsZero() {
+				description = fmt.Sprintf("%s (exited %d at %s)", name, info.State.ExitCode, finished.Local().Format("2006-01-02 15:04:05"))
+			}
+		}
+		stopped = append(stopped, description)
+	}
+	return stopped, nil
+}
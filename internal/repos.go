@@ -0,0 +1,160 @@
+package internal
+
+import (
+	"slices"
+	"sort"
+	"strings"
+)
+
+// Repository groups the instances that index the same repository
+type Repository struct {
+	// Repository is the Git URL of instances deployed from one, otherwise the local path
+	Repository string               `json:"repository" yaml:"repository"`
+	Instances  []RepositoryInstance `json:"instances" yaml:"instances"`
+	// LatestCommit is the most recently indexed commit of any of the instances
+	LatestCommit *IndexedCommit `json:"latest_commit,omitempty" yaml:"latest_commit,omitempty"`
+	DiskUsage    int64          `json:"disk_usage" yaml:"disk_usage"`
+}
+
+// RepositoryInstance is one instance of a repository and where to reach it
+type RepositoryInstance struct {
+	Name    string         `json:"name" yaml:"name"`
+	MCPURL  string         `json:"mcp_url" yaml:"mcp_url"`
+	Indexed *IndexedCommit `json:"indexed,omitempty" yaml:"indexed,omitempty"`
+}
+
+// GitHeadCommit returns the commit checked out in a repository, or "" if it is not a git checkout
+func GitHeadCommit(repoPath string) string {
+	output, err := Command("git", "-C", repoPath, "rev-parse", "HEAD").Output()
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(output))
+}
+
+// GitBranch returns the branch checked out in a repository, or "" for a detached HEAD or a
+// directory that is not a git checkout
+func GitBranch(repoPath string) string {
+	output, err := Command("git", "-C", repoPath, "symbolic-ref", "--quiet", "--short", "HEAD").Output()
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(output))
+}
+
+// defaultBranches are taken for the default branch of repositories whose origin does not
+// name one
+var defaultBranches = []string{"main", "master"}
+
+// gitDefaultBranch returns the branch origin/HEAD points at, or "" if it is not known
+func gitDefaultBranch(repoPath string) string {
+	output, err := Command("git", "-C", repoPath, "symbolic-ref", "--quiet", "--short", "refs/remotes/origin/HEAD").Output()
+	if err != nil {
+		return ""
+	}
+	return strings.TrimPrefix(strings.TrimSpace(string(output)), "origin/")
+}
+
+// featureBranch returns the branch checked out in a repository unless it is the repository's
+// default branch, or "" for the default branch, a detached HEAD or no git checkout
+func featureBranch(repoPath string) string {
+	branch := GitBranch(repoPath)
+	if branch == "" {
+		return ""
+	}
+	if defaultBranch := gitDefaultBranch(repoPath); defaultBranch != "" {
+		if branch == defaultBranch {
+			return ""
+		}
+		return branch
+	}
+	if slices.Contains(defaultBranches, branch) {
+		return ""
+	}
+	return branch
+}
+
+// RecordIndexedCommit records the commit an instance indexes as its app starts. The app
+// indexes the repository from scratch on every start, so callers record it whenever the
+// app container is started or recreated.
+func RecordIndexedCommit(config *DeployConfig) {
+	commit := GitHeadCommit(config.RepoPath)
+	if commit == "" {
+		return
+	}
+	if err := SaveIndexedCommit(config.InstanceName, commit, GitBranch(config.RepoPath)); err != nil {
+		Log.Warning("Failed to record indexed commit", "error", err)
+	}
+}
+
+// GetRepositories groups the given instances by repository, ordered by repository
+func GetRepositories(instanceNames []string) ([]*Repository, error) {
+	commits, err := GetIndexedCommits()
+	if err != nil {
+		return nil, err
+	}
+	usage, err := GetDiskUsageReport(instanceNames)
+	if err != nil {
+		return nil, err
+	}
+	diskUsage := make(map[string]int64)
+	for _, instance := range usage {
+		diskUsage[instance.Instance] = instance.Total
+	}
+
+	byRepo := make(map[string]*Repository)
+	for _, name := range instanceNames {
+		config, err := GetInstanceConfig(name)
+		if err != nil {
+			Log.Warning("Skipping instance without a recorded configuration", "instance", name, "error", err)
+			continue
+		}
+
+		// Every instance deployed from a URL has its own clone, so group those by URL
+		key := config.RepoPath
+		if config.RepoURL != "" {
+			key = config.RepoURL
+		}
+		repo, ok := byRepo[key]
+		if !ok {
+			repo = &Repository{Repository: key}
+			byRepo[key] = repo
+		}
+
+		instance := RepositoryInstance{Name: name, MCPURL: config.AppURL()}
+		if commit, ok := commits[name]; ok {
+			commit := commit
+			instance.Indexed = &commit
+			if repo.LatestCommit == nil || commit.IndexedAt.After(repo.LatestCommit.IndexedAt) {
+				repo.LatestCommit = &commit
+			}
+		}
+		repo.Instances = append(repo.Instances, instance)
+		repo.DiskUsage += diskUsage[name]
+	}
+
+	repos := make([]*Repository, 0, len(byRepo))
+	for _, repo := range byRepo {
+		repos = append(repos, repo)
+	}
+	sort.Slice(repos, func(i, j int) bool {
+		return repos[i].Repository < repos[j].Repository
+	})
+	return repos, nil
+}
+
+// Revision describes the commit with the branch it was indexed on, e.g. feature-x@1a2b3c4
+func (c IndexedCommit) Revision() string {
+	if c.Branch == "" {
+		return ShortCommit(c.Commit)
+	}
+	return c.Branch + "@" + ShortCommit(c.Commit)
+}
+
+// ShortCommit abbreviates a commit hash the way git log --oneline does
+func ShortCommit(commit string) string {
+	if len(commit) > 7 {
+		return commit[:7]
+	}
+	return commit
+}
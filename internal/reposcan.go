@@ -0,0 +1,333 @@
+package internal
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/docker/go-units"
+	"github.com/nicksnyder/go-i18n/v2/i18n"
+)
+
+const (
+	// LargeAssetSize is the size from which a binary file is reported as a large asset
+	LargeAssetSize = 20 * units.MB
+	// largeRepoFiles and largeRepoSize are the file count and size from which a repository is
+	// reported as too large to index comfortably
+	largeRepoFiles = 100000
+	largeRepoSize  = 2 * units.GB
+	// vendoredDirMinFiles is the number of files from which a vendored directory is reported
+	vendoredDirMinFiles = 100
+	// maxLineCountSize is the size up to which text files are read to count their lines;
+	// larger ones are usually generated data
+	maxLineCountSize = 1 * units.MB
+	// binarySniffSize is how much of a file is read to tell binary from text, as git does
+	binarySniffSize = 8000
+	// scanFileLimit and scanTimeLimit stop the scan of a huge repository early
+	scanFileLimit = 500000
+	scanTimeLimit = 30 * time.Second
+	// indexLinesPerSecond is roughly how many lines the app indexes per second with its
+	// default workers, including the embeddings
+	indexLinesPerSecond = 1500
+)
+
+// vendoredDirNames are directories holding dependencies or build output rather than code of
+// the repository
+var vendoredDirNames = map[string]bool{
+	"node_modules":     true,
+	"bower_components": true,
+	"vendor":           true,
+	"third_party":      true,
+	".venv":            true,
+	"venv":             true,
+	"site-packages":    true,
+	"Pods":             true,
+	"target":           true,
+	"dist":             true,
+	"build":            true,
+}
+
+// RepoFile is a file found by the repository scan
+type RepoFile struct {
+	// Path is relative to the repository
+	Path string `json:"path" yaml:"path"`
+	Size int64  `json:"size" yaml:"size"`
+}
+
+// RepoDir is a vendored directory found by the repository scan
+type RepoDir struct {
+	// Path is relative to the repository
+	Path  string `json:"path" yaml:"path"`
+	Files int    `json:"files" yaml:"files"`
+	Size  int64  `json:"size" yaml:"size"`
+}
+
+// RepoEstimate is a rough guess of what indexing a repository takes
+type RepoEstimate struct {
+	IndexTime time.Duration `json:"index_time" yaml:"index_time"`
+	// Memory is what the instance's containers need together, in bytes
+	Memory int64 `json:"memory" yaml:"memory"`
+	// Disk is what the instance's data volumes grow to, in bytes
+	Disk int64 `json:"disk" yaml:"disk"`
+}
+
+// RepoScan is what deploy found looking through a repository before indexing it
+type RepoScan struct {
+	Path string `json:"path" yaml:"path"`
+	// Commit is the checked-out commit, or "" if the path is not a git checkout
+	Commit    string `json:"commit,omitempty" yaml:"commit,omitempty"`
+	Branch    string `json:"branch,omitempty" yaml:"branch,omitempty"`
+	Files     int    `json:"files" yaml:"files"`
+	TextFiles int    `json:"text_files" yaml:"text_files"`
+	Lines     int64  `json:"lines" yaml:"lines"`
+	Size      int64  `json:"size" yaml:"size"`
+	TextSize  int64  `json:"text_size" yaml:"text_size"`
+	// LargeAssets are the binary files of at least LargeAssetSize, largest first
+	LargeAssets []RepoFile `json:"large_assets,omitempty" yaml:"large_assets,omitempty"`
+	// Vendored are the vendored directories of at least vendoredDirMinFiles files, largest first
+	Vendored []RepoDir `json:"vendored,omitempty" yaml:"vendored,omitempty"`
+	// Truncated is set when the scan stopped before it saw the whole repository
+	Truncated bool         `json:"truncated,omitempty" yaml:"truncated,omitempty"`
+	Estimate  RepoEstimate `json:"estimate" yaml:"estimate"`
+}
+
+// ScanRepository looks through a repository before it is deployed: whether it is a git
+// checkout, how many files and lines of text it holds, large binary assets and vendored
+// directories, and what indexing it will roughly take. Huge repositories are scanned for
+// at most scanTimeLimit.
+func ScanRepository(repoPath string) (*RepoScan, error) {
+	info, err := os.Stat(repoPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to scan repository: %v", err)
+	}
+	if !info.IsDir() {
+		return nil, fmt.Errorf("repository path is not a directory: %s", repoPath)
+	}
+
+	scan := &RepoScan{Path: repoPath, Commit: GitHeadCommit(repoPath)}
+	if scan.Commit != "" {
+		scan.Branch = GitBranch(repoPath)
+	}
+
+	deadline := time.Now().Add(scanTimeLimit)
+	vendored := make(map[string]*RepoDir)
+	var vendoredRoot *RepoDir
+
+	err = filepath.WalkDir(repoPath, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		rel, _ := filepath.Rel(repoPath, path)
+		if vendoredRoot != nil && !strings.HasPrefix(rel, vendoredRoot.Path+string(filepath.Separator)) {
+			vendoredRoot = nil
+		}
+		if d.IsDir() {
+			if d.Name() == ".git" {
+				return filepath.SkipDir
+			}
+			if vendoredRoot == nil && path != repoPath && vendoredDirNames[d.Name()] {
+				vendoredRoot = &RepoDir{Path: rel}
+				vendored[rel] = vendoredRoot
+			}
+			return nil
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		if scan.Files >= scanFileLimit || time.Now().After(deadline) {
+			scan.Truncated = true
+			return filepath.SkipAll
+		}
+
+		fileInfo, err := d.Info()
+		if err != nil {
+			return nil
+		}
+		size := fileInfo.Size()
+		scan.Files++
+		scan.Size += size
+		if vendoredRoot != nil {
+			vendoredRoot.Files++
+			vendoredRoot.Size += size
+		}
+
+		lines, binary, err := countLines(path, size)
+		if err != nil {
+			return nil
+		}
+		if binary {
+			if size >= LargeAssetSize {
+				scan.LargeAssets = append(scan.LargeAssets, RepoFile{Path: rel, Size: size})
+			}
+			return nil
+		}
+		scan.TextFiles++
+		scan.TextSize += size
+		scan.Lines += lines
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to scan repository: %v", err)
+	}
+
+	sort.Slice(scan.LargeAssets, func(i, j int) bool {
+		return scan.LargeAssets[i].Size > scan.LargeAssets[j].Size
+	})
+	for _, dir := range vendored {
+		if dir.Files >= vendoredDirMinFiles {
+			scan.Vendored = append(scan.Vendored, *dir)
+		}
+	}
+	sort.Slice(scan.Vendored, func(i, j int) bool {
+		return scan.Vendored[i].Size > scan.Vendored[j].Size
+	})
+	scan.Estimate = estimateIndexing(scan)
+	return scan, nil
+}
+
+// countLines counts the lines of a text file, reading only the start of files larger than
+// maxLineCountSize, whose lines are not counted
+func countLines(path string, size int64) (lines int64, binary bool, err error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return 0, false, err
+	}
+	defer file.Close()
+
+	limit := size
+	if limit > maxLineCountSize {
+		limit = binarySniffSize
+	}
+	data, err := io.ReadAll(io.LimitReader(file, limit))
+	if err != nil {
+		return 0, false, err
+	}
+	sniff := data
+	if len(sniff) > binarySniffSize {
+		sniff = sniff[:binarySniffSize]
+	}
+	if bytes.IndexByte(sniff, 0) >= 0 {
+		return 0, true, nil
+	}
+	if size > maxLineCountSize {
+		return 0, false, nil
+	}
+	lines = int64(bytes.Count(data, []byte{'\n'}))
+	if len(data) > 0 && data[len(data)-1] != '\n' {
+		lines++
+	}
+	return lines, false, nil
+}
+
+// estimateIndexing guesses from the lines of text how long indexing a repository takes and
+// how much memory and disk the instance needs. The guesses are rough: they vary with the
+// languages, the embedding provider and the machine.
+func estimateIndexing(scan *RepoScan) RepoEstimate {
+	return RepoEstimate{
+		IndexTime: time.Duration(scan.Lines/indexLinesPerSecond) * time.Second,
+		// The services start with about 2GB and the graph grows by about 1GB per 500k lines
+		Memory: 2*units.GB + scan.Lines*units.GB/500000,
+		// The graph, embeddings and full text search hold several copies of the text
+		Disk: 1*units.GB + 4*scan.TextSize,
+	}
+}
+
+// Checks reports what the scan found in the form of doctor's checks, warning about what makes
+// the repository slow or impossible to index
+func (s *RepoScan) Checks() []CheckResult {
+	var results []CheckResult
+
+	git := CheckResult{Name: Localize(&i18n.Message{ID: "ScanGitName", Other: "git repository"}, nil), Status: CheckPass}
+	if s.Commit == "" {
+		git.Status = CheckWarn
+		git.Detail = Localize(&i18n.Message{ID: "ScanGitNone", Other: "{{.Path}} is not a git checkout with a commit"}, map[string]any{"Path": s.Path})
+		git.Hint = Localize(&i18n.Message{ID: "ScanGitHint", Other: "Deploy a git checkout, so that the indexed commit is recorded and a directory such as your home is not indexed by mistake"}, nil)
+	} else if s.Branch != "" {
+		git.Detail = Localize(&i18n.Message{ID: "ScanGitBranch", Other: "{{.Branch}} at {{.Commit}}"}, map[string]any{"Branch": s.Branch, "Commit": ShortCommit(s.Commit)})
+	} else {
+		git.Detail = Localize(&i18n.Message{ID: "ScanGitDetached", Other: "detached at {{.Commit}}"}, map[string]any{"Commit": ShortCommit(s.Commit)})
+	}
+	results = append(results, git)
+
+	sizeDetail := &i18n.Message{ID: "ScanSizeDetail", Other: "{{.Files}} files ({{.TextFiles}} text files, {{.Lines}} lines), {{.Size}}"}
+	if s.Truncated {
+		sizeDetail = &i18n.Message{ID: "ScanSizeDetailTruncated", Other: "at least {{.Files}} files ({{.TextFiles}} text files, {{.Lines}} lines), {{.Size}}"}
+	}
+	size := CheckResult{
+		Name:   Localize(&i18n.Message{ID: "ScanSizeName", Other: "size"}, nil),
+		Status: CheckPass,
+		Detail: Localize(sizeDetail, map[string]any{"Files": s.Files, "TextFiles": s.TextFiles, "Lines": s.Lines, "Size": FormatSize(s.Size)}),
+	}
+	if s.Truncated || s.Files >= largeRepoFiles || s.Size >= largeRepoSize {
+		size.Status = CheckWarn
+		size.Detail = Localize(&i18n.Message{ID: "ScanSizeLarge", Other: "{{.Detail}}: a very large repository"}, map[string]any{"Detail": size.Detail})
+		size.Hint = Localize(&i18n.Message{ID: "ScanSizeHint", Other: "Deploy only the directories you need, e.g. a subdirectory or a Git URL with --sparse, and give Neo4j more memory with --neo4j-heap"}, nil)
+	}
+	results = append(results, size)
+
+	assets := CheckResult{Name: Localize(&i18n.Message{ID: "ScanAssetsName", Other: "large assets"}, nil), Status: CheckPass, Detail: Localize(&i18n.Message{ID: "ScanAssetsNone", Other: "no binary files of {{.Size}} or more"}, map[string]any{"Size": FormatSize(LargeAssetSize)})}
+	if len(s.LargeAssets) > 0 {
+		var total int64
+		var names []string
+		for i, asset := range s.LargeAssets {
+			total += asset.Size
+			if i < 5 {
+				names = append(names, fmt.Sprintf("%s (%s)", asset.Path, FormatSize(asset.Size)))
+			}
+		}
+		if len(s.LargeAssets) > len(names) {
+			names = append(names, Localize(&i18n.Message{ID: "ScanAssetsMore", Other: "and {{.Count}} more"}, map[string]any{"Count": len(s.LargeAssets) - len(names)}))
+		}
+		assets.Status = CheckWarn
+		assets.Detail = Localize(&i18n.Message{ID: "ScanAssetsDetail", Other: "binary files of {{.Size}} or more, {{.Total}} in total: {{.Files}}"}, map[string]any{"Size": FormatSize(LargeAssetSize), "Total": FormatSize(total), "Files": strings.Join(names, ", ")})
+		assets.Hint = Localize(&i18n.Message{ID: "ScanAssetsHint", Other: "Binary assets are mounted into the instance but not worth indexing; keep them in Git LFS and deploy the Git URL with --lfs skip"}, nil)
+	}
+	results = append(results, assets)
+
+	vendored := CheckResult{Name: Localize(&i18n.Message{ID: "ScanVendoredName", Other: "vendored directories"}, nil), Status: CheckPass, Detail: Localize(&i18n.Message{ID: "ScanVendoredNone", Other: "none"}, nil)}
+	if len(s.Vendored) > 0 {
+		var names []string
+		for _, dir := range s.Vendored {
+			names = append(names, Localize(&i18n.Message{ID: "ScanVendoredDir", Other: "{{.Path}} ({{.Files}} files, {{.Size}})"}, map[string]any{"Path": dir.Path, "Files": dir.Files, "Size": FormatSize(dir.Size)}))
+		}
+		vendored.Status = CheckWarn
+		vendored.Detail = strings.Join(names, ", ")
+		vendored.Hint = Localize(&i18n.Message{ID: "ScanVendoredHint", Other: "Dependencies and build output are indexed along with your code; delete them before deploying, or deploy a clean clone of the Git URL"}, nil)
+	}
+	results = append(results, vendored)
+
+	results = append(results, CheckResult{
+		Name:   Localize(&i18n.Message{ID: "ScanEstimateName", Other: "estimate"}, nil),
+		Status: CheckPass,
+		Detail: Localize(&i18n.Message{ID: "ScanEstimateDetail", Other: "indexing takes roughly {{.Time}} and needs about {{.Memory}} of memory and {{.Disk}} of disk"}, map[string]any{"Time": formatEstimate(s.Estimate.IndexTime), "Memory": FormatSize(s.Estimate.Memory), "Disk": FormatSize(s.Estimate.Disk)}),
+	})
+	return results
+}
+
+// Warnings returns how many of the scan's checks warn
+func (s *RepoScan) Warnings() int {
+	warnings := 0
+	for _, result := range s.Checks() {
+		if result.Status != CheckPass {
+			warnings++
+		}
+	}
+	return warnings
+}
+
+// formatEstimate renders an estimated duration without false precision
+func formatEstimate(d time.Duration) string {
+	if d < time.Minute {
+		return Localize(&i18n.Message{ID: "EstimateUnderAMinute", Other: "under a minute"}, nil)
+	}
+	if d < time.Hour {
+		return d.Round(time.Minute).String()
+	}
+	return d.Round(10 * time.Minute).String()
+}
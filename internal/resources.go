@@ -0,0 +1,245 @@
+package internal
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/docker/go-units"
+)
+
+// LimitedServices are the services deploy can give limits of their own, e.g. --neo4j-memory
+var LimitedServices = []string{"app", "postgres", "neo4j"}
+
+// minMemoryLimit is the smallest memory limit Docker accepts for a container
+const minMemoryLimit = 6 * 1024 * 1024
+
+// ResourceLimits caps the memory and CPUs of a container; zero leaves either unlimited
+type ResourceLimits struct {
+	// Memory is in bytes
+	Memory int64   `json:"memory,omitempty" yaml:"memory,omitempty"`
+	CPUs   float64 `json:"cpus,omitempty" yaml:"cpus,omitempty"`
+}
+
+// IsZero reports whether the limits leave the container unlimited
+func (l ResourceLimits) IsZero() bool {
+	return l.Memory == 0 && l.CPUs == 0
+}
+
+// MemoryString renders the memory limit for Docker, e.g. 4g, or "" without one
+func (l ResourceLimits) MemoryString() string {
+	if l.Memory == 0 {
+		return ""
+	}
+	return FormatMemoryLimit(l.Memory)
+}
+
+// CPUsString renders the CPU limit for Docker, e.g. 1.5, or "" without one
+func (l ResourceLimits) CPUsString() string {
+	if l.CPUs == 0 {
+		return ""
+	}
+	return strconv.FormatFloat(l.CPUs, 'f', -1, 64)
+}
+
+// String summarizes the limits, e.g. "memory 4g, 2 CPUs"
+func (l ResourceLimits) String() string {
+	var parts []string
+	if l.Memory > 0 {
+		parts = append(parts, "memory "+l.MemoryString())
+	}
+	if l.CPUs > 0 {
+		unit := "CPUs"
+		if l.CPUs == 1 {
+			unit = "CPU"
+		}
+		parts = append(parts, l.CPUsString()+" "+unit)
+	}
+	if len(parts) == 0 {
+		return "unlimited"
+	}
+	return strings.Join(parts, ", ")
+}
+
+// Or fills the limits that are not set from defaults
+func (l ResourceLimits) Or(defaults ResourceLimits) ResourceLimits {
+	if l.Memory == 0 {
+		l.Memory = defaults.Memory
+	}
+	if l.CPUs == 0 {
+		l.CPUs = defaults.CPUs
+	}
+	return l
+}
+
+// ParseMemoryLimit parses a memory limit the way Docker does, e.g. 512m or 4g in binary
+// units. An empty value is no limit.
+func ParseMemoryLimit(value string) (int64, error) {
+	if value == "" {
+		return 0, nil
+	}
+	bytes, err := units.RAMInBytes(value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid memory limit '%s': use a size such as 512m or 4g", value)
+	}
+	if bytes < minMemoryLimit {
+		return 0, fmt.Errorf("invalid memory limit '%s': Docker needs at least 6m", value)
+	}
+	return bytes, nil
+}
+
+// FormatMemoryLimit renders a memory limit in the largest binary unit that divides it, e.g. 4g
+func FormatMemoryLimit(bytes int64) string {
+	if bytes == 0 {
+		return "0"
+	}
+	for _, unit := range []struct {
+		suffix string
+		size   int64
+	}{{"t", units.TiB}, {"g", units.GiB}, {"m", units.MiB}, {"k", units.KiB}} {
+		if bytes%unit.size == 0 {
+			return fmt.Sprintf("%d%s", bytes/unit.size, unit.suffix)
+		}
+	}
+	return strconv.FormatInt(bytes, 10)
+}
+
+// ParseCPULimit parses a CPU limit such as 2 or 0.5. An empty value is no limit.
+func ParseCPULimit(value string) (float64, error) {
+	if value == "" {
+		return 0, nil
+	}
+	cpus, err := strconv.ParseFloat(value, 64)
+	if err != nil || cpus <= 0 {
+		return 0, fmt.Errorf("invalid CPU limit '%s': use a positive number such as 2 or 0.5", value)
+	}
+	// Docker counts CPUs in billionths
+	if cpus < 0.01 {
+		return 0, fmt.Errorf("invalid CPU limit '%s': must be at least 0.01", value)
+	}
+	return cpus, nil
+}
+
+// ServiceResources returns the limits of a service of the instance, or nil if it is
+// unlimited. Its own limits take precedence over those of the instance.
+func (c *DeployConfig) ServiceResources(service string) *ResourceLimits {
+	limits := c.ServiceLimits[service].Or(c.Limits)
+	if limits.IsZero() {
+		return nil
+	}
+	return &limits
+}
+
+// EffectiveLimits returns the limits of every limited service of the instance, or nil if
+// it is unlimited
+func (c *DeployConfig) EffectiveLimits() map[string]ResourceLimits {
+	services := []string{"app"}
+	if !c.IsSingleContainer() {
+		services = append(services, "postgres", "neo4j")
+		if c.LocalEmbeddings() != nil {
+			services = append(services, "embeddings")
+		}
+	}
+
+	var effective map[string]ResourceLimits
+	for _, service := range services {
+		limits := c.ServiceResources(service)
+		if limits == nil {
+			continue
+		}
+		if effective == nil {
+			effective = make(map[string]ResourceLimits)
+		}
+		effective[service] = *limits
+	}
+	return effective
+}
+
+// isLimitedService reports whether deploy can give a service limits of its own
+func isLimitedService(service string) bool {
+	for _, limited := range LimitedServices {
+		if service == limited {
+			return true
+		}
+	}
+	return false
+}
+
+// HasLimits reports whether any container of the instance is limited
+func (c *DeployConfig) HasLimits() bool {
+	if !c.Limits.IsZero() {
+		return true
+	}
+	for _, limits := range c.ServiceLimits {
+		if !limits.IsZero() {
+			return true
+		}
+	}
+	return false
+}
+
+// LimitedServiceNames returns the services with limits of their own, in order
+func (c *DeployConfig) LimitedServiceNames() []string {
+	var services []string
+	for service, limits := range c.ServiceLimits {
+		if !limits.IsZero() {
+			services = append(services, service)
+		}
+	}
+	sort.Strings(services)
+	return services
+}
+
+// DescribeLimits summarizes the limits of an instance, e.g. "memory 4g, 2 CPUs; neo4j:
+// memory 2g", or returns "" if it is unlimited
+func (c *DeployConfig) DescribeLimits() string {
+	if !c.HasLimits() {
+		return ""
+	}
+	var parts []string
+	if !c.Limits.IsZero() {
+		parts = append(parts, c.Limits.String())
+	}
+	for _, service := range c.LimitedServiceNames() {
+		parts = append(parts, service+": "+c.ServiceLimits[service].String())
+	}
+	return strings.Join(parts, "; ")
+}
+
+// CheckLimitsAvailable checks that no limit asks for more CPUs or memory than the Docker
+// host has
+func CheckLimitsAvailable(limits ResourceLimits, serviceLimits map[string]ResourceLimits) error {
+	config := DeployConfig{Limits: limits, ServiceLimits: serviceLimits}
+	if !config.HasLimits() {
+		return nil
+	}
+	all := []ResourceLimits{limits}
+	for _, service := range config.LimitedServiceNames() {
+		all = append(all, serviceLimits[service])
+	}
+
+	docker, err := GetDockerClient()
+	if err != nil {
+		return err
+	}
+	ctx := context.Background()
+	cpus, err := docker.CPUCount(ctx)
+	if err != nil {
+		return err
+	}
+	memory, err := docker.MemoryTotal(ctx)
+	if err != nil {
+		return err
+	}
+	for _, limits := range all {
+		if limits.CPUs > float64(cpus) {
+			return fmt.Errorf("CPU limit %s exceeds the %d CPUs of the Docker host", limits.CPUsString(), cpus)
+		}
+		if limits.Memory > memory {
+			return fmt.Errorf("memory limit %s exceeds the %s of memory of the Docker host", limits.MemoryString(), units.BytesSize(float64(memory)))
+		}
+	}
+	return nil
+}
@@ -0,0 +1,19 @@
+package internal
+
+import (
+	"fmt"
+	"time"
+)
+
+// SandboxPrefix starts the name of every sandbox instance
+const SandboxPrefix = "sandbox-"
+
+// SandboxName returns a fresh instance name for a sandbox of the given source instance
+func SandboxName(source string) string {
+	return SanitizeInstanceName(fmt.Sprintf("%s%s-%s", SandboxPrefix, source, time.Now().Format("150405")))
+}
+
+// SetPostgresReadOnly makes new sessions on the instance's postgres database read-only
+func SetPostgresReadOnly(instanceName string) error {
+	return runPsql(instanceName, fmt.Sprintf(`ALTER DATABASE "%s" SET default_transaction_read_only = on`, PostgresDB))
+}
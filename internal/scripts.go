@@ -0,0 +1,293 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// RepoConfigFile is the per-repository config file read from the root of an indexed repository
+const RepoConfigFile = ".graphsense.yaml"
+
+// Lifecycle hooks that repository scripts can run at
+const (
+	HookPreIndex   = "pre_index"
+	HookPostDeploy = "post_deploy"
+	HookPreRemove  = "pre_remove"
+)
+
+// Where a lifecycle script runs
+const (
+	ScriptInHost      = "host"
+	ScriptInContainer = "container"
+)
+
+// DefaultScriptTimeout bounds scripts that do not set a timeout
+const DefaultScriptTimeout = 10 * time.Minute
+
+// ErrHostScriptsNotAllowed is returned for repositories declaring host scripts that the
+// user has not allowed to run
+var ErrHostScriptsNotAllowed = errors.New(RepoConfigFile + " declares scripts that run on this machine; review them and allow them with --allow-scripts or allow_scripts: true in ~/.graphsense/config.yaml")
+
+// scriptEnv are the variables of the CLI's environment that host scripts get: enough to find
+// tools and a home directory, but none of the API keys and tokens it may hold
+var scriptEnv = []string{"PATH", "HOME", "USER", "LOGNAME", "SHELL", "LANG", "LC_ALL", "TMPDIR", "TZ", "TERM"}
+
+// RepoConfig holds the settings a repository declares in its .graphsense.yaml
+type RepoConfig struct {
+	Scripts LifecycleScripts `yaml:"scripts"`
+}
+
+// LifecycleScripts lists the scripts to run at each lifecycle hook, in order
+type LifecycleScripts struct {
+	PreIndex   []LifecycleScript `yaml:"pre_index"`
+	PostDeploy []LifecycleScript `yaml:"post_deploy"`
+	PreRemove  []LifecycleScript `yaml:"pre_remove"`
+}
+
+// LifecycleScript is a shell command run at a lifecycle hook. Host scripts run in the
+// repository directory; container scripts run in the app container, where the
+// repository is mounted read-only at /home/repo.
+type LifecycleScript struct {
+	Run     string `yaml:"run"`
+	In      string `yaml:"in"`
+	Timeout string `yaml:"timeout"`
+}
+
+// HookScript is a lifecycle script and the hook it runs at
+type HookScript struct {
+	Hook string
+	LifecycleScript
+}
+
+// ForHook returns the scripts declared for hook
+func (s LifecycleScripts) ForHook(hook string) []LifecycleScript {
+	switch hook {
+	case HookPreIndex:
+		return s.PreIndex
+	case HookPostDeploy:
+		return s.PostDeploy
+	case HookPreRemove:
+		return s.PreRemove
+	}
+	return nil
+}
+
+// LoadRepoConfig reads .graphsense.yaml from the root of repoPath, returning an empty
+// config if the repository has none
+func LoadRepoConfig(repoPath string) (*RepoConfig, error) {
+	config := &RepoConfig{}
+
+	configPath := filepath.Join(repoPath, RepoConfigFile)
+	data, err := os.ReadFile(configPath)
+	if os.IsNotExist(err) {
+		return config, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %v", configPath, err)
+	}
+
+	if err := yaml.Unmarshal(data, config); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %v", configPath, err)
+	}
+	if err := config.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid %s: %v", configPath, err)
+	}
+
+	return config, nil
+}
+
+// Validate checks every declared script
+func (c *RepoConfig) Validate() error {
+	for _, hook := range []string{HookPreIndex, HookPostDeploy, HookPreRemove} {
+		for i, script := range c.Scripts.ForHook(hook) {
+			if err := script.validate(hook); err != nil {
+				return fmt.Errorf("scripts.%s[%d]: %v", hook, i, err)
+			}
+		}
+	}
+	return nil
+}
+
+func (s LifecycleScript) validate(hook string) error {
+	if strings.TrimSpace(s.Run) == "" {
+		return fmt.Errorf("run is required")
+	}
+	switch s.In {
+	case "", ScriptInHost:
+	case ScriptInContainer:
+		// Indexing starts as soon as the app container does
+		if hook == HookPreIndex {
+			return fmt.Errorf("pre_index scripts run before the app container exists and must run on the host")
+		}
+	default:
+		return fmt.Errorf("invalid in '%s': must be %s or %s", s.In, ScriptInHost, ScriptInContainer)
+	}
+	if _, err := s.timeout(); err != nil {
+		return err
+	}
+	return nil
+}
+
+// timeout returns the configured timeout of the script, or DefaultScriptTimeout
+func (s LifecycleScript) timeout() (time.Duration, error) {
+	if s.Timeout == "" {
+		return DefaultScriptTimeout, nil
+	}
+	timeout, err := time.ParseDuration(s.Timeout)
+	if err != nil || timeout <= 0 {
+		return 0, fmt.Errorf("invalid timeout '%s'", s.Timeout)
+	}
+	return timeout, nil
+}
+
+// HostScripts returns the scripts a repository declares to run on the host at hooks, in the
+// order the hooks are given
+func HostScripts(repoPath string, hooks ...string) ([]HookScript, error) {
+	repoConfig, err := LoadRepoConfig(repoPath)
+	if err != nil {
+		return nil, err
+	}
+	var scripts []HookScript
+	for _, hook := range hooks {
+		for _, script := range repoConfig.Scripts.ForHook(hook) {
+			if script.where() == ScriptInHost {
+				scripts = append(scripts, HookScript{Hook: hook, LifecycleScript: script})
+			}
+		}
+	}
+	return scripts, nil
+}
+
+// GetScriptLogDir returns the directory lifecycle script output of an instance is written to
+func GetScriptLogDir(instanceName string) (string, error) {
+	graphsenseDir, err := GetGraphsenseDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(graphsenseDir, "scripts", instanceName), nil
+}
+
+// RunLifecycleScripts runs the scripts the instance's repository declares for hook, stopping
+// at the first one that fails. Host scripts only run if config.AllowHostScripts is set. The
+// output of each script is written to a log file under GetScriptLogDir and echoed at verbose
+// level.
+func RunLifecycleScripts(ctx context.Context, config *DeployConfig, hook string) error {
+	repoConfig, err := LoadRepoConfig(config.RepoPath)
+	if err != nil {
+		return err
+	}
+
+	scripts := repoConfig.Scripts.ForHook(hook)
+	if len(scripts) == 0 {
+		return nil
+	}
+	if !config.AllowHostScripts {
+		for _, script := range scripts {
+			if script.where() == ScriptInHost {
+				return fmt.Errorf("%s scripts: %w", hook, ErrHostScriptsNotAllowed)
+			}
+		}
+	}
+
+	logDir, err := GetScriptLogDir(config.InstanceName)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(logDir, 0755); err != nil {
+		return fmt.Errorf("failed to create script log directory: %v", err)
+	}
+
+	for i, script := range scripts {
+		logPath := filepath.Join(logDir, fmt.Sprintf("%s-%s-%d.log", hook, time.Now().Format("20060102-150405"), i+1))
+		Log.Info("Running lifecycle script", "hook", hook, "script", script.Run, "in", script.where())
+		if err := runLifecycleScript(ctx, config, hook, script, logPath); err != nil {
+			return fmt.Errorf("%s script '%s' failed: %v (output in %s)", hook, script.Run, err, logPath)
+		}
+	}
+	return nil
+}
+
+// where returns where the script runs
+func (s LifecycleScript) where() string {
+	if s.In == "" {
+		return ScriptInHost
+	}
+	return s.In
+}
+
+// runLifecycleScript runs a single script with its timeout, writing its output to logPath
+func runLifecycleScript(ctx context.Context, config *DeployConfig, hook string, script LifecycleScript, logPath string) error {
+	timeout, err := script.timeout()
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	logFile, err := os.Create(logPath)
+	if err != nil {
+		return fmt.Errorf("failed to create script log: %v", err)
+	}
+	defer logFile.Close()
+
+	env := map[string]string{
+		"GRAPHSENSE_INSTANCE": config.InstanceName,
+		"GRAPHSENSE_HOOK":     hook,
+		"GRAPHSENSE_APP_PORT": fmt.Sprintf("%d", config.AppPort),
+	}
+
+	var cmdName string
+	var args []string
+	if script.where() == ScriptInContainer {
+		running, err := AppRunning(config.InstanceName)
+		if err != nil {
+			return err
+		}
+		if !running {
+			return fmt.Errorf("app container is not running")
+		}
+		cmdName, args = "docker", []string{"exec", "-w", "/home/repo"}
+		for key, value := range env {
+			args = append(args, "-e", key+"="+value)
+		}
+		args = append(args, config.InstanceName+"-app", "sh", "-c", script.Run)
+	} else {
+		cmdName, args = "sh", []string{"-c", script.Run}
+	}
+
+	cmd := CommandContext(ctx, cmdName, args...)
+	if script.where() == ScriptInHost {
+		cmd.Dir = config.RepoPath
+		for _, key := range scriptEnv {
+			if value, ok := os.LookupEnv(key); ok {
+				cmd.Env = append(cmd.Env, key+"="+value)
+			}
+		}
+		for key, value := range env {
+			cmd.Env = append(cmd.Env, key+"="+value)
+		}
+	}
+
+	var output io.Writer = logFile
+	if logLevel.Level() <= LevelVerbose {
+		output = io.MultiWriter(logFile, os.Stderr)
+	}
+	cmd.Stdout = output
+	cmd.Stderr = output
+	// Do not wait on grandchildren that keep the output open once the script is killed
+	cmd.WaitDelay = 5 * time.Second
+
+	err = cmd.Run()
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return fmt.Errorf("timed out after %s", timeout)
+	}
+	return err
+}
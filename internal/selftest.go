@@ -0,0 +1,285 @@
+package internal
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// SelfTestImage is the small image every stand-in service of the self test runs. It is the
+// volume helper image, so it is usually present already.
+const SelfTestImage = VolumeHelperImage
+
+// selfTestProbeTimeout bounds how long the self test waits for the stand-in services to answer
+const selfTestProbeTimeout = 30 * time.Second
+
+// selfTestCompose stands in for the GraphSense compose file: each service is a busybox web
+// server listening on the container port of the service it replaces, published the same way
+var selfTestCompose = fmt.Sprintf(`services:
+  postgres:
+    image: %[1]s
+    command: ["httpd", "-f", "-p", "5432"]
+    ports:
+      - "${POSTGRES_PORT}:5432"
+
+  neo4j:
+    image: %[1]s
+    command: ["httpd", "-f", "-p", "7687"]
+    ports:
+      - "${NEO4J_BOLT_PORT}:7687"
+
+  app:
+    image: %[1]s
+    command: ["httpd", "-f", "-p", "8080"]
+`, SelfTestImage)
+
+// SelfTestStep is the outcome of one stage of the self test
+type SelfTestStep struct {
+	Name     string        `json:"name" yaml:"name"`
+	Status   string        `json:"status" yaml:"status"`
+	Detail   string        `json:"detail,omitempty" yaml:"detail,omitempty"`
+	Duration time.Duration `json:"duration" yaml:"duration"`
+}
+
+// selfTest is the state shared by the stages of one self test run
+type selfTest struct {
+	config  *DeployConfig
+	files   *ComposeFiles
+	tempDir string
+	envVars map[string]string
+	steps   []SelfTestStep
+}
+
+// run runs one stage and records its outcome
+func (t *selfTest) run(name string, stage func() (string, error)) error {
+	start := time.Now()
+	detail, err := stage()
+	step := SelfTestStep{Name: name, Status: CheckPass, Detail: detail, Duration: time.Since(start)}
+	if err != nil {
+		step.Status = CheckFail
+		step.Detail = err.Error()
+	}
+	t.steps = append(t.steps, step)
+	return err
+}
+
+// RunSelfTest exercises the deploy pipeline end to end with stand-in services built from
+// SelfTestImage: it allocates and reserves ports, renders the compose override and environment
+// file, records the instance in instances.db, brings the project up, probes its published ports
+// and tears everything down again. Cleanup runs even when a stage fails.
+func RunSelfTest() []SelfTestStep {
+	t := &selfTest{}
+	instanceName := fmt.Sprintf("graphsense-selftest-%d", os.Getpid())
+	t.envVars = map[string]string{"COMPOSE_PROJECT_NAME": instanceName}
+
+	stages := []struct {
+		name string
+		run  func() (string, error)
+	}{
+		{"docker engine", t.checkEngine},
+		{"allocate ports", func() (string, error) { return t.allocatePorts(instanceName) }},
+		{"pull stand-in image", t.pullImage},
+		{"render templates", t.renderTemplates},
+		{"register instance", t.register},
+		{"compose up", t.composeUp},
+		{"probe services", t.probeServices},
+		{"compose down", t.composeDown},
+	}
+	for _, stage := range stages {
+		if t.run(stage.name, stage.run) != nil {
+			break
+		}
+	}
+
+	t.run("cleanup", func() (string, error) { return t.cleanup(instanceName) })
+	return t.steps
+}
+
+func (t *selfTest) checkEngine() (string, error) {
+	docker, err := GetDockerClient()
+	if err != nil {
+		return "", err
+	}
+	version, err := docker.ServerVersion(context.Background())
+	if err != nil {
+		return "", err
+	}
+	runner, err := GetComposeRunner()
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("server %s, %s", version, runner), nil
+}
+
+func (t *selfTest) allocatePorts(instanceName string) (string, error) {
+	scheme, err := LoadPortScheme(PortScheme{})
+	if err != nil {
+		return "", err
+	}
+	if CheckBindAddressSupport(scheme.BindAddress) != nil {
+		scheme.BindAddress = ""
+	}
+	ports, err := ReservePortSet(scheme, instanceName)
+	if err != nil {
+		return "", err
+	}
+
+	t.tempDir, err = os.MkdirTemp("", "graphsense-selftest-*")
+	if err != nil {
+		return "", err
+	}
+	t.config = &DeployConfig{
+		InstanceName: instanceName,
+		RepoPath:     t.tempDir,
+		AppImage:     SelfTestImage,
+		BindAddress:  scheme.BindAddress,
+	}
+	ports.Apply(t.config)
+	return fmt.Sprintf("app %d, postgres %d, neo4j %d", ports.App, ports.Postgres, ports.Neo4jBolt), nil
+}
+
+func (t *selfTest) pullImage() (string, error) {
+	if output, err := Command("docker", "pull", "-q", SelfTestImage).CombinedOutput(); err != nil {
+		return "", fmt.Errorf("failed to pull %s: %s", SelfTestImage, strings.TrimSpace(string(output)))
+	}
+	return SelfTestImage, nil
+}
+
+func (t *selfTest) renderTemplates() (string, error) {
+	t.files = &ComposeFiles{ComposeFile: filepath.Join(t.tempDir, "docker-compose.yml")}
+	if err := os.WriteFile(t.files.ComposeFile, []byte(selfTestCompose), 0644); err != nil {
+		return "", err
+	}
+
+	var err error
+	if t.files.EnvFile, err = CreateTempEnvFile(t.config); err != nil {
+		return "", fmt.Errorf("failed to create environment file: %v", err)
+	}
+	if t.files.Override, err = CreateComposeOverride(t.config); err != nil {
+		return "", fmt.Errorf("failed to create compose override: %v", err)
+	}
+	// The override takes the database passwords from the environment of compose
+	if t.files.Secrets, err = t.config.SecretEnv(); err != nil {
+		return "", err
+	}
+	t.envVars = t.files.Env(t.envVars)
+
+	// Compose rejects a malformed override before anything is started
+	if _, err := DockerComposeOutput(t.files.Args("config", "--quiet"), t.envVars); err != nil {
+		return "", err
+	}
+	return "compose override and environment file", nil
+}
+
+func (t *selfTest) register() (string, error) {
+	if err := SaveDeployment(t.config, DeployStatusComplete); err != nil {
+		return "", err
+	}
+	if err := StoreInstanceContainers(t.config); err != nil {
+		return "", err
+	}
+
+	recorded, _, err := GetDeployment(t.config.InstanceName)
+	if err != nil {
+		return "", err
+	}
+	if recorded == nil || recorded.AppPort != t.config.AppPort {
+		return "", fmt.Errorf("instances.db did not return the recorded deployment")
+	}
+	return "instances.db", nil
+}
+
+func (t *selfTest) composeUp() (string, error) {
+	if err := RunDockerCompose(t.files.Args("up", "-d"), t.envVars); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("project %s", t.config.InstanceName), nil
+}
+
+// probeServices waits until every published port of the stand-in services answers
+func (t *selfTest) probeServices() (string, error) {
+	host := t.config.HostAddress()
+	probes := []struct {
+		service string
+		probe   func() error
+	}{
+		{"app", func() error { return ProbeApp(t.config) }},
+		{"postgres", func() error { return probePort(host, t.config.PostgresPort) }},
+		{"neo4j", func() error { return probePort(host, t.config.Neo4jBoltPort) }},
+	}
+
+	deadline := time.Now().Add(selfTestProbeTimeout)
+	for _, p := range probes {
+		for {
+			err := p.probe()
+			if err == nil {
+				break
+			}
+			if time.Now().After(deadline) {
+				return "", fmt.Errorf("%s did not answer: %v", p.service, err)
+			}
+			time.Sleep(500 * time.Millisecond)
+		}
+	}
+	return fmt.Sprintf("app, postgres and neo4j answer on %s", hostOnly(host)), nil
+}
+
+// probePort checks that a published port accepts TCP connections
+func probePort(host string, port int) error {
+	conn, err := net.DialTimeout("tcp", net.JoinHostPort(hostOnly(host), fmt.Sprintf("%d", port)), probeTimeout)
+	if err != nil {
+		return err
+	}
+	return conn.Close()
+}
+
+func (t *selfTest) composeDown() (string, error) {
+	if err := RunDockerCompose(t.files.Args("down", "--volumes", "--remove-orphans"), t.envVars); err != nil {
+		return "", err
+	}
+	return "containers, network and volumes removed", nil
+}
+
+// cleanup removes whatever the earlier stages left behind, tolerating stages that never ran
+func (t *selfTest) cleanup(instanceName string) (string, error) {
+	var problems []string
+
+	docker, err := GetDockerClient()
+	if err == nil {
+		ctx := context.Background()
+		if containers, err := docker.ProjectContainers(ctx, instanceName); err == nil && len(containers) > 0 {
+			if err := docker.RemoveProject(ctx, instanceName); err != nil {
+				problems = append(problems, err.Error())
+			}
+		}
+		if volumes, err := InstanceVolumes(instanceName); err == nil {
+			RemoveVolumes(volumes)
+		}
+	}
+
+	if err := RemoveInstanceContainers(instanceName); err != nil {
+		problems = append(problems, err.Error())
+	}
+	// Also releases the reserved ports
+	if err := RemoveDeployment(instanceName); err != nil {
+		problems = append(problems, err.Error())
+	}
+
+	if t.files != nil {
+		t.files.Cleanup()
+	}
+	if t.tempDir != "" {
+		if err := os.RemoveAll(t.tempDir); err != nil {
+			problems = append(problems, err.Error())
+		}
+	}
+
+	if len(problems) > 0 {
+		return "", fmt.Errorf("%s", strings.Join(problems, "; "))
+	}
+	return "nothing left behind", nil
+}
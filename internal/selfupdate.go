@@ -0,0 +1,248 @@
+package internal
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+// ReleaseSigningKey is the base64 Ed25519 public key the checksums of releases are signed
+// with, set with -ldflags "-X graphsense-cli/internal.ReleaseSigningKey=...". Builds without
+// it refuse to install releases unless told to trust the checksum of the download alone.
+var ReleaseSigningKey = ""
+
+const (
+	// checksumsAsset lists the SHA-256 checksum of every binary of a release
+	checksumsAsset = "checksums.txt"
+	// checksumsSignatureAsset is the base64 Ed25519 signature of checksumsAsset
+	checksumsSignatureAsset = "checksums.txt.sig"
+
+	maxReleaseBinarySize = 256 << 20
+	maxChecksumsSize     = 1 << 20
+)
+
+// ErrNoReleaseSigningKey is returned when a build without a ReleaseSigningKey is asked to
+// install a release it cannot verify the signature of
+var ErrNoReleaseSigningKey = errors.New("this build has no release signing key to verify releases with; use --insecure to install the latest release with only its checksum verified")
+
+// Release is a published CLI release and the files attached to it
+type Release struct {
+	TagName string         `json:"tag_name"`
+	Assets  []ReleaseAsset `json:"assets"`
+}
+
+// ReleaseAsset is a file attached to a release
+type ReleaseAsset struct {
+	Name string `json:"name"`
+	URL  string `json:"browser_download_url"`
+	Size int64  `json:"size"`
+}
+
+// LatestRelease returns the latest published CLI release
+func LatestRelease(ctx context.Context) (*Release, error) {
+	var release Release
+	if err := getJSON(ctx, latestReleaseAPI, &release); err != nil {
+		return nil, err
+	}
+	return &release, nil
+}
+
+// Asset returns the file of the release with the given name, or nil if it has none
+func (r *Release) Asset(name string) *ReleaseAsset {
+	for i := range r.Assets {
+		if r.Assets[i].Name == name {
+			return &r.Assets[i]
+		}
+	}
+	return nil
+}
+
+// ReleaseBinaryName returns the name of the release binary for this OS and architecture,
+// e.g. graphsense-cli_linux_amd64
+func ReleaseBinaryName() string {
+	name := fmt.Sprintf("graphsense-cli_%s_%s", runtime.GOOS, runtime.GOARCH)
+	if runtime.GOOS == "windows" {
+		name += ".exe"
+	}
+	return name
+}
+
+// DownloadReleaseBinary downloads the binary of a release for this OS and architecture and
+// verifies it against the signed checksums of the release. With insecure, builds without a
+// ReleaseSigningKey install the binary with only its checksum verified.
+func DownloadReleaseBinary(ctx context.Context, release *Release, insecure bool) ([]byte, error) {
+	name := ReleaseBinaryName()
+	binaryAsset := release.Asset(name)
+	if binaryAsset == nil {
+		return nil, fmt.Errorf("release %s has no binary for %s/%s", release.TagName, runtime.GOOS, runtime.GOARCH)
+	}
+	checksums, err := downloadReleaseChecksums(ctx, release, insecure)
+	if err != nil {
+		return nil, err
+	}
+	want, ok := checksums[name]
+	if !ok {
+		return nil, fmt.Errorf("%s of release %s lists no checksum for %s", checksumsAsset, release.TagName, name)
+	}
+
+	Log.Info("Downloading release binary", "file", name, "release", release.TagName, "size", FormatSize(binaryAsset.Size))
+	binary, err := download(ctx, binaryAsset.URL, maxReleaseBinarySize)
+	if err != nil {
+		return nil, fmt.Errorf("failed to download %s: %v", name, err)
+	}
+	sum := sha256.Sum256(binary)
+	if got := hex.EncodeToString(sum[:]); got != want {
+		return nil, fmt.Errorf("checksum mismatch for %s: expected %s, got %s", name, want, got)
+	}
+	return binary, nil
+}
+
+// downloadReleaseChecksums downloads the checksums of a release, keyed by file name, and
+// verifies their signature. Without a ReleaseSigningKey they are only used with insecure.
+func downloadReleaseChecksums(ctx context.Context, release *Release, insecure bool) (map[string]string, error) {
+	if ReleaseSigningKey == "" && !insecure {
+		return nil, ErrNoReleaseSigningKey
+	}
+	checksumsFile := release.Asset(checksumsAsset)
+	if checksumsFile == nil {
+		return nil, fmt.Errorf("release %s has no %s", release.TagName, checksumsAsset)
+	}
+	data, err := download(ctx, checksumsFile.URL, maxChecksumsSize)
+	if err != nil {
+		return nil, fmt.Errorf("failed to download %s: %v", checksumsAsset, err)
+	}
+
+	if ReleaseSigningKey == "" {
+		Log.Warning("This build has no release signing key; only the checksum of the download is verified")
+	} else if err := verifyChecksumsSignature(ctx, release, data); err != nil {
+		return nil, err
+	}
+	return parseChecksums(data), nil
+}
+
+// verifyChecksumsSignature checks the signature of the checksums of a release against
+// ReleaseSigningKey
+func verifyChecksumsSignature(ctx context.Context, release *Release, checksums []byte) error {
+	key, err := base64.StdEncoding.DecodeString(ReleaseSigningKey)
+	if err != nil || len(key) != ed25519.PublicKeySize {
+		return fmt.Errorf("invalid release signing key built into this binary")
+	}
+	signatureFile := release.Asset(checksumsSignatureAsset)
+	if signatureFile == nil {
+		return fmt.Errorf("release %s is not signed: it has no %s", release.TagName, checksumsSignatureAsset)
+	}
+	data, err := download(ctx, signatureFile.URL, maxChecksumsSize)
+	if err != nil {
+		return fmt.Errorf("failed to download %s: %v", checksumsSignatureAsset, err)
+	}
+	signature, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(data)))
+	if err != nil {
+		return fmt.Errorf("invalid signature of release %s: %v", release.TagName, err)
+	}
+	if !ed25519.Verify(ed25519.PublicKey(key), checksums, signature) {
+		return fmt.Errorf("the signature of release %s does not match; refusing to install it", release.TagName)
+	}
+	return nil
+}
+
+// parseChecksums parses checksum lines in the format of sha256sum, "<hex>  <file>"
+func parseChecksums(data []byte) map[string]string {
+	checksums := make(map[string]string)
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) != 2 {
+			continue
+		}
+		checksums[strings.TrimPrefix(fields[1], "*")] = strings.ToLower(fields[0])
+	}
+	return checksums
+}
+
+// download fetches url, failing if the body is larger than limit bytes
+func download(ctx context.Context, url string, limit int64) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s returned HTTP %d", url, resp.StatusCode)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, limit+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) > limit {
+		return nil, fmt.Errorf("%s is larger than %s", url, FormatSize(limit))
+	}
+	return data, nil
+}
+
+// ReplaceExecutable atomically replaces the running binary with binary and returns its path.
+// The new binary is written next to the old one and renamed over it, so the binary is never
+// left half written.
+func ReplaceExecutable(binary []byte) (string, error) {
+	path, err := os.Executable()
+	if err != nil {
+		return "", fmt.Errorf("failed to find the running binary: %v", err)
+	}
+	if path, err = filepath.EvalSymlinks(path); err != nil {
+		return "", fmt.Errorf("failed to find the running binary: %v", err)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to find the running binary: %v", err)
+	}
+
+	dir := filepath.Dir(path)
+	tmp, err := os.CreateTemp(dir, ".graphsense-cli-update-*")
+	if err != nil {
+		if os.IsPermission(err) {
+			return "", fmt.Errorf("no permission to replace %s: run self-update as a user who can write to %s", path, dir)
+		}
+		return "", fmt.Errorf("failed to write the new binary: %v", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(binary); err != nil {
+		tmp.Close()
+		return "", fmt.Errorf("failed to write the new binary: %v", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return "", fmt.Errorf("failed to write the new binary: %v", err)
+	}
+	if err := os.Chmod(tmp.Name(), info.Mode().Perm()|0111); err != nil {
+		return "", fmt.Errorf("failed to make the new binary executable: %v", err)
+	}
+
+	// Windows cannot replace a running executable, but it can rename it out of the way
+	if runtime.GOOS == "windows" {
+		old := path + ".old"
+		os.Remove(old)
+		if err := os.Rename(path, old); err != nil {
+			return "", fmt.Errorf("failed to move the old binary aside: %v", err)
+		}
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return "", fmt.Errorf("failed to replace %s: %v", path, err)
+	}
+	return path, nil
+}
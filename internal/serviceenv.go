@@ -0,0 +1,75 @@
+package internal
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// envNamePattern matches the environment variable names that can be set on a service
+var envNamePattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// managedServiceEnv are the environment variables the CLI sets on each service itself. They
+// wire the services together and cannot be overridden.
+var managedServiceEnv = map[string][]string{
+	"app":      {"POSTGRES_URL", "NEO4J_URI", "NEO4J_USERNAME", "NEO4J_PASSWORD", "LOCAL_REPO_PATH", TLSCertEnv, TLSKeyEnv},
+	"postgres": {"POSTGRES_PASSWORD"},
+	"neo4j":    {"NEO4J_AUTH"},
+}
+
+// ValidateServiceEnv checks environment overrides keyed by service name: the services exist
+// and the variables are valid names the CLI does not set itself
+func ValidateServiceEnv(env map[string]map[string]string) error {
+	for service, vars := range env {
+		if !isLimitedService(service) {
+			return fmt.Errorf("env: unknown service '%s', expected one of %s", service, strings.Join(LimitedServices, ", "))
+		}
+		for name := range vars {
+			if !envNamePattern.MatchString(name) {
+				return fmt.Errorf("env: invalid variable name '%s' for %s", name, service)
+			}
+			for _, managed := range managedServiceEnv[service] {
+				if name == managed {
+					return fmt.Errorf("env: %s of %s is set by graphsense-cli and cannot be overridden", name, service)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// CheckSingleContainerEnv checks that environment overrides only name the app, the one service
+// of a single-container instance
+func CheckSingleContainerEnv(env map[string]map[string]string) error {
+	for service, vars := range env {
+		if service != "app" && len(vars) > 0 {
+			return fmt.Errorf("env: single-container instances only take environment overrides for the app, not %s", service)
+		}
+	}
+	return nil
+}
+
+// ServiceEnvironment returns the environment overrides of a service, or nil if it has none
+func (c *DeployConfig) ServiceEnvironment(service string) map[string]string {
+	return c.ServiceEnv[service]
+}
+
+// DescribeServiceEnv lists the overridden variables of every service, e.g.
+// "app: HTTP_PROXY, NO_PROXY; neo4j: NEO4J_dbms_logs_query_enabled", or returns "" if there are none
+func (c *DeployConfig) DescribeServiceEnv() string {
+	var parts []string
+	for _, service := range LimitedServices {
+		vars := c.ServiceEnv[service]
+		if len(vars) == 0 {
+			continue
+		}
+		names := make([]string, 0, len(vars))
+		for name := range vars {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		parts = append(parts, service+": "+strings.Join(names, ", "))
+	}
+	return strings.Join(parts, "; ")
+}
@@ -0,0 +1,137 @@
+package internal
+
+import (
+	"fmt"
+	"os"
+	"sort"
+)
+
+// Deploy modes recorded in the deployments table
+const (
+	DeployModeCompose = "compose"
+	DeployModeSingle  = "single"
+)
+
+// AllInOneImage is the GraphSense image that supervises its own storage inside one container
+const AllInOneImage = "graphsense/graphsense-all-in-one:latest"
+
+// DeployMode returns how the instance runs, treating unrecorded modes as compose
+func (c *DeployConfig) DeployMode() string {
+	if c.Mode == "" {
+		return DeployModeCompose
+	}
+	return c.Mode
+}
+
+// IsSingleContainer reports whether the instance runs as one all-in-one container
+func (c *DeployConfig) IsSingleContainer() bool {
+	return c.DeployMode() == DeployModeSingle
+}
+
+// SingleContainerImage returns the image of a single-container instance
+func SingleContainerImage(config *DeployConfig) string {
+	if config.AppImage != "" {
+		return config.AppImage
+	}
+	return AllInOneImage
+}
+
+// SingleContainerRunArgs returns the docker run arguments of a single-container instance.
+// The container carries the compose project labels so that list, status, stop, start and
+// remove find it exactly like the containers of a compose deploy.
+func SingleContainerRunArgs(config *DeployConfig, envFile string) []string {
+	name := config.InstanceName
+	args := []string{"run", "-d",
+		"--name", name + "-app",
+		"--label", fmt.Sprintf("%s=%s", ComposeProjectLabel, name),
+		"--label", fmt.Sprintf("%s=app", ComposeServiceLabel),
+		"--restart", "unless-stopped",
+		"-p", config.PublishedPort(config.AppPort) + ":8080",
+		"-v", name + "_app_data:/app/.graphsense",
+		"-v", config.RepoPath + ":/home/repo:ro",
+	}
+	for _, key := range config.LabelKeys() {
+		args = append(args, "--label", key+"="+config.Labels[key])
+	}
+	if config.CPUSet != "" {
+		args = append(args, "--cpuset-cpus", config.CPUSet)
+	}
+	if shares := config.AppCPUShares(); shares > 0 {
+		args = append(args, "--cpu-shares", fmt.Sprint(shares))
+	}
+	if limits := config.ServiceResources("app"); limits != nil {
+		if limits.Memory > 0 {
+			args = append(args, "--memory", limits.MemoryString())
+		}
+		if limits.CPUs > 0 {
+			args = append(args, "--cpus", limits.CPUsString())
+		}
+	}
+	if gpu := config.AppGPU(); gpu != nil {
+		// docker run reads --gpus as CSV, so a list of devices has to be quoted
+		value := gpu.String()
+		if len(gpu.DeviceIDs) > 1 {
+			value = `"` + value + `"`
+		}
+		args = append(args, "--gpus", value)
+	}
+	for _, dir := range config.RepoGitMounts() {
+		args = append(args, "-v", dir+":"+dir+":ro")
+	}
+	for _, path := range config.ExcludedRepoPaths() {
+		args = append(args, "--tmpfs", path)
+	}
+	if config.TLS {
+		if mount, err := config.TLSMount(); err == nil {
+			args = append(args, "-v", mount)
+		}
+		env := config.TLSEnv()
+		for _, name := range []string{TLSCertEnv, TLSKeyEnv} {
+			args = append(args, "-e", name+"="+env[name])
+		}
+	}
+	appEnv := config.ServiceEnvironment("app")
+	names := make([]string, 0, len(appEnv))
+	for name := range appEnv {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		args = append(args, "-e", name+"="+appEnv[name])
+	}
+	// API keys and database passwords are taken from the environment of docker run rather
+	// than the env file
+	for _, name := range APIKeyNames {
+		if _, ok := config.APIKeyEnv()[name]; ok {
+			args = append(args, "-e", name)
+		}
+	}
+	for _, name := range CredentialEnvNames {
+		args = append(args, "-e", name)
+	}
+	return append(args,
+		"--env-file", envFile,
+		"-e", "LOCAL_REPO_PATH=/home/repo",
+		SingleContainerImage(config),
+	)
+}
+
+// RunSingleContainer starts the all-in-one container of an instance
+func RunSingleContainer(config *DeployConfig) error {
+	envFile, err := CreateTempEnvFile(config)
+	if err != nil {
+		return fmt.Errorf("failed to create environment file: %v", err)
+	}
+	defer os.Remove(envFile)
+
+	secrets, err := config.SecretEnv()
+	if err != nil {
+		return err
+	}
+	cmd := CommandEnv(secrets, "docker", SingleContainerRunArgs(config, envFile)...)
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("failed to start %s-app: %v", config.InstanceName, err)
+	}
+	return nil
+}
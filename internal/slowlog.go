@@ -0,0 +1,200 @@
+package internal
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Neo4jQueryLog is where Neo4j writes its query log inside the neo4j container (the logs volume)
+const Neo4jQueryLog = "/logs/query.log"
+
+// slowLogTailLines bounds how much of the Neo4j query log is read
+const slowLogTailLines = 20000
+
+// SlowQuery is one query that took longer than the slow-query threshold
+type SlowQuery struct {
+	Engine     string
+	DurationMs float64
+	Query      string
+}
+
+// SlowQuerySummary aggregates the executions of one query
+type SlowQuerySummary struct {
+	Engine  string  `json:"engine" yaml:"engine"`
+	Query   string  `json:"query" yaml:"query"`
+	Count   int     `json:"count" yaml:"count"`
+	TotalMs float64 `json:"total_ms" yaml:"total_ms"`
+	MaxMs   float64 `json:"max_ms" yaml:"max_ms"`
+	MeanMs  float64 `json:"mean_ms" yaml:"mean_ms"`
+}
+
+// neo4jQueryLogSettings returns the query log setting names of a Neo4j version and the values
+// that turn logging on and off
+func neo4jQueryLogSettings(version string) (enabled, threshold, on, off string) {
+	if MajorVersion(version) >= 5 {
+		return "db.logs.query.enabled", "db.logs.query.threshold", "INFO", "OFF"
+	}
+	return "dbms.logs.query.enabled", "dbms.logs.query.threshold", "true", "false"
+}
+
+// runPsql runs SQL statements with psql inside an instance's postgres container
+func runPsql(instanceName string, statements ...string) error {
+	args := []string{"exec", instanceName + "-postgres", "psql", "-U", PostgresUser, "-d", PostgresDB, "-v", "ON_ERROR_STOP=1", "-q"}
+	for _, statement := range statements {
+		args = append(args, "-c", statement)
+	}
+
+	output, err := Command("docker", args...).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("psql failed: %s", strings.TrimSpace(string(output)))
+	}
+	return nil
+}
+
+// EnableSlowLog turns on slow-query logging in both databases of an instance for queries slower than threshold
+func EnableSlowLog(instanceName, neo4jVersion string, threshold time.Duration) error {
+	ms := threshold.Milliseconds()
+
+	if err := runPsql(instanceName,
+		fmt.Sprintf("ALTER SYSTEM SET log_min_duration_statement = %d", ms),
+		"SELECT pg_reload_conf()",
+	); err != nil {
+		return fmt.Errorf("failed to enable postgres slow-query logging: %v", err)
+	}
+
+	enabled, thresholdSetting, on, _ := neo4jQueryLogSettings(neo4jVersion)
+	for _, query := range []string{
+		fmt.Sprintf("CALL dbms.setConfigValue('%s', '%dms')", thresholdSetting, ms),
+		fmt.Sprintf("CALL dbms.setConfigValue('%s', '%s')", enabled, on),
+	} {
+		if _, err := RunCypher(instanceName, query); err != nil {
+			return fmt.Errorf("failed to enable neo4j query logging: %v", err)
+		}
+	}
+
+	return nil
+}
+
+// DisableSlowLog turns slow-query logging off again in both databases of an instance
+func DisableSlowLog(instanceName, neo4jVersion string) error {
+	if err := runPsql(instanceName,
+		"ALTER SYSTEM RESET log_min_duration_statement",
+		"SELECT pg_reload_conf()",
+	); err != nil {
+		return fmt.Errorf("failed to disable postgres slow-query logging: %v", err)
+	}
+
+	enabled, _, _, off := neo4jQueryLogSettings(neo4jVersion)
+	if _, err := RunCypher(instanceName, fmt.Sprintf("CALL dbms.setConfigValue('%s', '%s')", enabled, off)); err != nil {
+		return fmt.Errorf("failed to disable neo4j query logging: %v", err)
+	}
+
+	return nil
+}
+
+// postgresDurationPattern matches statements logged by log_min_duration_statement
+var postgresDurationPattern = regexp.MustCompile(`duration: ([0-9.]+) ms\s+(?:statement|execute [^:]*|parse [^:]*|bind [^:]*): (.*)$`)
+
+// neo4jDurationPattern matches the elapsed time of a Neo4j query log entry
+var neo4jDurationPattern = regexp.MustCompile(`(?:^|\s)(\d+) ms: (.*)$`)
+
+// cypherPattern recognises the query field among the " - " separated fields of a query log entry
+var cypherPattern = regexp.MustCompile(`(?i)^(MATCH|OPTIONAL|CALL|CREATE|MERGE|WITH|UNWIND|RETURN|SHOW|EXPLAIN|PROFILE|USE|DETACH|DELETE|LOAD)\b`)
+
+// CollectSlowQueries reads the slow queries an instance's databases logged within the last since
+func CollectSlowQueries(instanceName string, since time.Duration) ([]SlowQuery, error) {
+	var queries []SlowQuery
+
+	// Postgres logs to stderr, which docker keeps with the container logs
+	output, err := Command("docker", "logs", "--since", since.String(), instanceName+"-postgres").CombinedOutput()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read postgres logs: %v", err)
+	}
+	for _, line := range strings.Split(string(output), "\n") {
+		match := postgresDurationPattern.FindStringSubmatch(line)
+		if match == nil {
+			continue
+		}
+		duration, err := strconv.ParseFloat(match[1], 64)
+		if err != nil {
+			continue
+		}
+		queries = append(queries, SlowQuery{Engine: "postgres", DurationMs: duration, Query: match[2]})
+	}
+
+	// A missing query log only means Neo4j has not logged a slow query yet
+	output, err = Command("docker", "exec", instanceName+"-neo4j", "tail", "-n", strconv.Itoa(slowLogTailLines), Neo4jQueryLog).Output()
+	if err != nil {
+		return queries, nil
+	}
+	cutoff := time.Now().Add(-since)
+	for _, line := range strings.Split(string(output), "\n") {
+		if logged, err := time.Parse("2006-01-02 15:04:05.000-0700", firstFields(line, 2)); err == nil && logged.Before(cutoff) {
+			continue
+		}
+
+		match := neo4jDurationPattern.FindStringSubmatch(line)
+		if match == nil {
+			continue
+		}
+		duration, err := strconv.ParseFloat(match[1], 64)
+		if err != nil {
+			continue
+		}
+		for _, field := range strings.Split(match[2], " - ") {
+			if cypherPattern.MatchString(strings.TrimSpace(field)) {
+				queries = append(queries, SlowQuery{Engine: "neo4j", DurationMs: duration, Query: field})
+				break
+			}
+		}
+	}
+
+	return queries, nil
+}
+
+// firstFields returns the first n space separated fields of line
+func firstFields(line string, n int) string {
+	fields := strings.Fields(line)
+	if len(fields) < n {
+		return ""
+	}
+	return strings.Join(fields[:n], " ")
+}
+
+// SummarizeSlowQueries groups queries by engine and normalized text, worst total time first
+func SummarizeSlowQueries(queries []SlowQuery) []SlowQuerySummary {
+	byKey := make(map[string]*SlowQuerySummary)
+	var order []string
+	for _, query := range queries {
+		text := strings.Join(strings.Fields(query.Query), " ")
+		key := query.Engine + "\x00" + text
+
+		summary, ok := byKey[key]
+		if !ok {
+			summary = &SlowQuerySummary{Engine: query.Engine, Query: text}
+			byKey[key] = summary
+			order = append(order, key)
+		}
+		summary.Count++
+		summary.TotalMs += query.DurationMs
+		if query.DurationMs > summary.MaxMs {
+			summary.MaxMs = query.DurationMs
+		}
+	}
+
+	summaries := make([]SlowQuerySummary, 0, len(order))
+	for _, key := range order {
+		summary := byKey[key]
+		summary.MeanMs = summary.TotalMs / float64(summary.Count)
+		summaries = append(summaries, *summary)
+	}
+
+	sort.SliceStable(summaries, func(i, j int) bool {
+		return summaries[i].TotalMs > summaries[j].TotalMs
+	})
+	return summaries
+}
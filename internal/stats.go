@@ -0,0 +1,110 @@
+package internal
+
+import (
+	"context"
+	"sort"
+	"sync"
+)
+
+// ContainerStats is the resource usage of a container, as docker stats shows it
+type ContainerStats struct {
+	CPUPercent float64 `json:"cpu_percent" yaml:"cpu_percent"`
+	// MemoryBytes excludes the page cache
+	MemoryBytes uint64 `json:"memory_bytes" yaml:"memory_bytes"`
+	// MemoryLimit is the container's memory limit, or the memory of the Docker host
+	MemoryLimit   uint64  `json:"memory_limit_bytes,omitempty" yaml:"memory_limit_bytes,omitempty"`
+	MemoryPercent float64 `json:"memory_percent,omitempty" yaml:"memory_percent,omitempty"`
+	NetworkRx     uint64  `json:"network_rx_bytes" yaml:"network_rx_bytes"`
+	NetworkTx     uint64  `json:"network_tx_bytes" yaml:"network_tx_bytes"`
+	BlockRead     uint64  `json:"block_read_bytes" yaml:"block_read_bytes"`
+	BlockWrite    uint64  `json:"block_write_bytes" yaml:"block_write_bytes"`
+}
+
+// add adds the CPU, memory and I/O of another container to the stats
+func (s *ContainerStats) add(other ContainerStats) {
+	s.CPUPercent += other.CPUPercent
+	s.MemoryBytes += other.MemoryBytes
+	s.NetworkRx += other.NetworkRx
+	s.NetworkTx += other.NetworkTx
+	s.BlockRead += other.BlockRead
+	s.BlockWrite += other.BlockWrite
+}
+
+// ServiceStats is the resource usage of the container of one service of an instance
+type ServiceStats struct {
+	Service        string `json:"service" yaml:"service"`
+	Container      string `json:"container" yaml:"container"`
+	ContainerStats `yaml:",inline"`
+}
+
+// InstanceStats is the resource usage of an instance, in total and per service
+type InstanceStats struct {
+	Instance string `json:"instance" yaml:"instance"`
+	// Running is set if any container of the instance is running
+	Running  bool           `json:"running" yaml:"running"`
+	Total    ContainerStats `json:"total" yaml:"total"`
+	Services []ServiceStats `json:"services" yaml:"services"`
+}
+
+// GetInstanceStats samples the resource usage of the running containers of instances, all
+// at once. Containers whose stats cannot be read are logged and left out.
+func GetInstanceStats(ctx context.Context, instanceNames []string) ([]InstanceStats, error) {
+	docker, err := GetDockerClient()
+	if err != nil {
+		return nil, err
+	}
+
+	report := make([]InstanceStats, len(instanceNames))
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for i, instanceName := range instanceNames {
+		report[i] = InstanceStats{Instance: instanceName, Services: []ServiceStats{}}
+		containers, err := docker.ProjectContainers(ctx, instanceName)
+		if err != nil {
+			return nil, err
+		}
+		for _, container := range containers {
+			if container.State != "running" {
+				continue
+			}
+			report[i].Running = true
+			name := ContainerName(container)
+			service := container.Labels[ComposeServiceLabel]
+
+			wg.Add(1)
+			go func(i int, name, service string) {
+				defer wg.Done()
+				stats, err := docker.ContainerStats(ctx, name)
+				if err != nil {
+					Log.Warning("Failed to get container stats", "container", name, "error", err)
+					return
+				}
+				mu.Lock()
+				defer mu.Unlock()
+				report[i].Services = append(report[i].Services, ServiceStats{Service: service, Container: name, ContainerStats: stats})
+				report[i].Total.add(stats)
+			}(i, name, service)
+		}
+	}
+	wg.Wait()
+
+	for i := range report {
+		sort.Slice(report[i].Services, func(a, b int) bool {
+			return serviceOrder(report[i].Services[a].Service) < serviceOrder(report[i].Services[b].Service)
+		})
+	}
+	return report, nil
+}
+
+// serviceOrder sorts the services of an instance as app, postgres, neo4j and the others by name
+func serviceOrder(service string) string {
+	switch service {
+	case "app":
+		return "0"
+	case "postgres":
+		return "1"
+	case "neo4j":
+		return "2"
+	}
+	return "3" + service
+}
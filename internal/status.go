@@ -0,0 +1,177 @@
+package internal
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// DefaultStatusPort is the port status serve listens on unless --port is given
+const DefaultStatusPort = 9401
+
+// ContainerStatus is the live Docker state of one container of an instance
+type ContainerStatus struct {
+	Name    string `json:"name" yaml:"name"`
+	Service string `json:"service" yaml:"service"`
+	State   string `json:"state" yaml:"state"`
+	Health  string `json:"health,omitempty" yaml:"health,omitempty"`
+}
+
+// InstanceStatus combines the recorded configuration of an instance with its live Docker state
+type InstanceStatus struct {
+	Name            string            `json:"name" yaml:"name"`
+	RepoPath        string            `json:"repo_path" yaml:"repo_path"`
+	Mode            string            `json:"mode,omitempty" yaml:"mode,omitempty"`
+	AppPort         int               `json:"app_port" yaml:"app_port"`
+	PostgresPort    int               `json:"postgres_port" yaml:"postgres_port"`
+	Neo4jBoltPort   int               `json:"neo4j_bolt_port" yaml:"neo4j_bolt_port"`
+	PostgresVersion string            `json:"postgres_version,omitempty" yaml:"postgres_version,omitempty"`
+	Neo4jVersion    string            `json:"neo4j_version,omitempty" yaml:"neo4j_version,omitempty"`
+	Autostart       string            `json:"autostart,omitempty" yaml:"autostart,omitempty"`
+	Labels          map[string]string `json:"labels,omitempty" yaml:"labels,omitempty"`
+	CPUSet          string            `json:"cpuset,omitempty" yaml:"cpuset,omitempty"`
+	Neo4jCPUSet     string            `json:"neo4j_cpuset,omitempty" yaml:"neo4j_cpuset,omitempty"`
+	IndexWorkers    int               `json:"index_workers,omitempty" yaml:"index_workers,omitempty"`
+	IndexBatchSize  int               `json:"index_batch_size,omitempty" yaml:"index_batch_size,omitempty"`
+	Nice            bool              `json:"nice,omitempty" yaml:"nice,omitempty"`
+	TLS             bool              `json:"tls,omitempty" yaml:"tls,omitempty"`
+	CreatedAt       string            `json:"created_at,omitempty" yaml:"created_at,omitempty"`
+	LastUsed        string            `json:"last_used,omitempty" yaml:"last_used,omitempty"`
+	ExpiresAt       string            `json:"expires_at,omitempty" yaml:"expires_at,omitempty"`
+	Indexed         *IndexedCommit    `json:"indexed,omitempty" yaml:"indexed,omitempty"`
+	Containers      []ContainerStatus `json:"containers" yaml:"containers"`
+	Degraded        bool              `json:"degraded" yaml:"degraded"`
+	Indexes         *IndexReport      `json:"indexes,omitempty" yaml:"indexes,omitempty"`
+	Indexing        *IndexProgress    `json:"indexing,omitempty" yaml:"indexing,omitempty"`
+
+	// Limits are the memory and CPU limits of every limited service
+	Limits map[string]ResourceLimits `json:"limits,omitempty" yaml:"limits,omitempty"`
+	// Neo4jHeap and Neo4jPageCache are in bytes
+	Neo4jHeap      int64  `json:"neo4j_heap,omitempty" yaml:"neo4j_heap,omitempty"`
+	Neo4jPageCache int64  `json:"neo4j_pagecache,omitempty" yaml:"neo4j_pagecache,omitempty"`
+	GPU            string `json:"gpu,omitempty" yaml:"gpu,omitempty"`
+	// Images are the images and digests the services were last deployed or upgraded with
+	Images map[string]DeployedImage `json:"images,omitempty" yaml:"images,omitempty"`
+}
+
+// GetContainerStatuses inspects the live state of every container in an instance's compose project
+func GetContainerStatuses(instanceName string) ([]ContainerStatus, error) {
+	containers, err := GetProjectContainers(instanceName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list containers: %v", err)
+	}
+
+	docker, err := GetDockerClient()
+	if err != nil {
+		return nil, err
+	}
+
+	statuses := []ContainerStatus{}
+	for _, name := range containers {
+		info, err := docker.InspectContainer(context.Background(), name)
+		if err != nil {
+			return nil, err
+		}
+
+		status := ContainerStatus{Name: name}
+		if info.Config != nil {
+			status.Service = info.Config.Labels[ComposeServiceLabel]
+		}
+		if info.State != nil {
+			status.State = info.State.Status
+			if info.State.Health != nil {
+				status.Health = info.State.Health.Status
+			}
+		}
+		statuses = append(statuses, status)
+	}
+
+	return statuses, nil
+}
+
+// AppRunning reports whether the app container of an instance is running
+func AppRunning(instanceName string) (bool, error) {
+	containers, err := GetContainerStatuses(instanceName)
+	if err != nil {
+		return false, err
+	}
+	for _, container := range containers {
+		if container.Service == "app" && container.State == "running" {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// GetInstanceStatus builds the status of an instance from instances.db and Docker
+func GetInstanceStatus(instanceName string) (*InstanceStatus, error) {
+	status := &InstanceStatus{Name: instanceName}
+
+	config, configErr := GetInstanceConfig(instanceName)
+	if configErr == nil {
+		status.RepoPath = config.RepoPath
+		status.Mode = config.DeployMode()
+		status.AppPort = config.AppPort
+		status.PostgresPort = config.PostgresPort
+		status.Neo4jBoltPort = config.Neo4jBoltPort
+		status.PostgresVersion = config.PostgresVersion
+		status.Neo4jVersion = config.Neo4jVersion
+		status.Autostart = config.AutostartPolicy()
+		status.Labels = config.Labels
+		status.CPUSet = config.CPUSet
+		status.Neo4jCPUSet = config.Neo4jCPUSet
+		status.IndexWorkers = config.AppIndexWorkers()
+		status.IndexBatchSize = config.AppIndexBatchSize()
+		status.Nice = config.Nice
+		status.Limits = config.EffectiveLimits()
+		status.Neo4jHeap = config.Neo4jHeap
+		status.Neo4jPageCache = config.Neo4jPageCache
+		status.GPU = config.GPU
+		status.TLS = config.TLS
+		if !config.ExpiresAt.IsZero() {
+			status.ExpiresAt = config.ExpiresAt.UTC().Format(time.RFC3339)
+		}
+	}
+
+	if images, err := GetInstanceImages(instanceName); err == nil {
+		status.Images = images
+	}
+
+	if containers, err := GetInstanceContainers(instanceName); err == nil && len(containers) > 0 {
+		status.CreatedAt = containers[0].CreatedAt
+	}
+
+	if lastUsed, err := GetLastUsed(); err == nil {
+		if usedAt, ok := lastUsed[instanceName]; ok {
+			status.LastUsed = usedAt.UTC().Format(time.RFC3339)
+		}
+	}
+	if commits, err := GetIndexedCommits(); err == nil {
+		if commit, ok := commits[instanceName]; ok {
+			status.Indexed = &commit
+		}
+	}
+
+	containers, err := GetContainerStatuses(instanceName)
+	if err != nil {
+		return nil, err
+	}
+	status.Containers = containers
+
+	// Index checks need a running neo4j container, and indexing progress a running app
+	for _, container := range containers {
+		if container.Service == "neo4j" && container.State == "running" {
+			if report, err := VerifyIndexes(instanceName); err == nil {
+				status.Indexes = &report
+				status.Degraded = report.Degraded
+			}
+		}
+		if container.Service == "app" && container.State == "running" && configErr == nil {
+			if progress, err := GetIndexProgress(config); err == nil {
+				status.Indexing = progress
+			}
+		}
+	}
+
+	return status, nil
+}
@@ -0,0 +1,104 @@
+package internal
+
+import (
+	"bufio"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// containerRepoPath is where the repository is mounted inside the app container
+const containerRepoPath = "/home/repo"
+
+// Submodule is a git submodule of an indexed repository
+type Submodule struct {
+	// Path is relative to the repository root, with forward slashes
+	Path        string
+	Initialized bool
+}
+
+// GetSubmodules lists the submodules of a repository, recursively. Repositories that are not
+// git checkouts, or hosts without git, have none.
+func GetSubmodules(repoPath string) []Submodule {
+	output, err := Command("git", "-C", repoPath, "submodule", "status", "--recursive").Output()
+	if err != nil {
+		return nil
+	}
+
+	var submodules []Submodule
+	scanner := bufio.NewScanner(strings.NewReader(string(output)))
+	for scanner.Scan() {
+		// Lines look like "-<sha> path" for uninitialized submodules and " <sha> path (describe)" otherwise
+		line := scanner.Text()
+		if len(line) < 2 {
+			continue
+		}
+		fields := strings.Fields(line[1:])
+		if len(fields) < 2 {
+			continue
+		}
+		submodules = append(submodules, Submodule{Path: fields[1], Initialized: line[0] != '-'})
+	}
+	return submodules
+}
+
+// gitCommonDir returns the absolute git directory shared by a checkout and its linked worktrees
+func gitCommonDir(repoPath string) string {
+	output, err := Command("git", "-C", repoPath, "rev-parse", "--git-common-dir").Output()
+	if err != nil {
+		return ""
+	}
+	dir := strings.TrimSpace(string(output))
+	if !filepath.IsAbs(dir) {
+		dir = filepath.Join(repoPath, dir)
+	}
+	return filepath.Clean(dir)
+}
+
+// RepoGitMounts returns host directories to mount read-only at the same path in the app
+// container so that git metadata outside the repository resolves. A linked worktree keeps its
+// objects, and the git directories of its submodules, in the main checkout's .git.
+func (c *DeployConfig) RepoGitMounts() []string {
+	commonDir := gitCommonDir(c.RepoPath)
+	if commonDir == "" {
+		return nil
+	}
+	if rel, err := filepath.Rel(c.RepoPath, commonDir); err == nil && !strings.HasPrefix(rel, "..") {
+		return nil
+	}
+	return []string{commonDir}
+}
+
+// ExcludedRepoPaths returns the container paths of the submodules hidden with ExcludeSubmodules
+func (c *DeployConfig) ExcludedRepoPaths() []string {
+	if !c.ExcludeSubmodules {
+		return nil
+	}
+
+	var paths []string
+	for _, submodule := range GetSubmodules(c.RepoPath) {
+		if submodule.Initialized {
+			paths = append(paths, path.Join(containerRepoPath, submodule.Path))
+		}
+	}
+	return paths
+}
+
+// WarnUninitializedSubmodules warns about submodules that are not checked out, which the
+// app would otherwise index as broken references
+func WarnUninitializedSubmodules(config *DeployConfig) {
+	if config.ExcludeSubmodules {
+		return
+	}
+
+	var missing []string
+	for _, submodule := range GetSubmodules(config.RepoPath) {
+		if !submodule.Initialized {
+			missing = append(missing, submodule.Path)
+		}
+	}
+	if len(missing) > 0 {
+		Log.Warning("Submodules are not checked out and will not be indexed", "submodules", strings.Join(missing, ", "))
+		Log.Info("Check them out with 'git submodule update --init --recursive', or deploy with --no-submodules")
+	}
+}
@@ -0,0 +1,422 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Actions of supervisor events
+const (
+	// SupervisorUnhealthy is recorded when a service failed enough probes in a row to be restarted
+	SupervisorUnhealthy = "unhealthy"
+	// SupervisorRestarted is recorded when a service was restarted
+	SupervisorRestarted = "restarted"
+	// SupervisorRestartFailed is recorded when restarting a service failed
+	SupervisorRestartFailed = "restart-failed"
+	// SupervisorGaveUp is recorded when a service reached the restart limit and is left alone
+	SupervisorGaveUp = "gave-up"
+	// SupervisorRecovered is recorded when an unhealthy service is healthy again
+	SupervisorRecovered = "recovered"
+	// SupervisorExpiring is recorded when an instance will soon be past its TTL or unused limit
+	SupervisorExpiring = "expiring"
+	// SupervisorCollected is recorded when an instance past its TTL or unused limit was
+	// stopped or removed
+	SupervisorCollected = "collected"
+	// SupervisorCollectFailed is recorded when stopping or removing such an instance failed
+	SupervisorCollectFailed = "collect-failed"
+)
+
+// supervisorMessages are the log messages of the supervisor's events, by action
+var supervisorMessages = map[string]string{
+	SupervisorUnhealthy:     LogMessage("Service is unhealthy"),
+	SupervisorRestarted:     LogMessage("Restarted service"),
+	SupervisorRestartFailed: LogMessage("Failed to restart service"),
+	SupervisorGaveUp:        LogMessage("Giving up on service until the restart window has passed"),
+	SupervisorRecovered:     LogMessage("Service recovered"),
+	SupervisorExpiring:      LogMessage("Instance will soon be collected"),
+	SupervisorCollected:     LogMessage("Collected instance"),
+	SupervisorCollectFailed: LogMessage("Failed to collect instance"),
+}
+
+// SupervisorEvent is something supervise found or did, kept in instances.db
+type SupervisorEvent struct {
+	Instance  string    `json:"instance" yaml:"instance"`
+	Service   string    `json:"service" yaml:"service"`
+	Action    string    `json:"action" yaml:"action"`
+	Detail    string    `json:"detail,omitempty" yaml:"detail,omitempty"`
+	CreatedAt time.Time `json:"created_at" yaml:"created_at"`
+}
+
+// SupervisorOptions controls how often supervise probes instances and how it restarts them
+type SupervisorOptions struct {
+	// Interval is the time between two probes of every instance
+	Interval time.Duration
+	// FailureThreshold is the number of failed probes in a row after which a service is restarted
+	FailureThreshold int
+	// Backoff is the time to wait after the first restart before restarting a service again;
+	// it doubles with every further restart within RestartWindow, up to MaxBackoff
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+	// MaxRestarts is the number of restarts of a service within RestartWindow after which it
+	// is left alone until the window has passed
+	MaxRestarts   int
+	RestartWindow time.Duration
+}
+
+// DefaultSupervisorOptions restarts a service after three failed probes 30 seconds apart, at
+// most five times an hour
+var DefaultSupervisorOptions = SupervisorOptions{
+	Interval:         30 * time.Second,
+	FailureThreshold: 3,
+	Backoff:          30 * time.Second,
+	MaxBackoff:       10 * time.Minute,
+	MaxRestarts:      5,
+	RestartWindow:    time.Hour,
+}
+
+// Validate checks that the options are usable
+func (o SupervisorOptions) Validate() error {
+	switch {
+	case o.Interval <= 0:
+		return fmt.Errorf("--interval must be positive")
+	case o.FailureThreshold < 1:
+		return fmt.Errorf("--failure-threshold must be at least 1")
+	case o.Backoff < 0 || o.MaxBackoff < o.Backoff:
+		return fmt.Errorf("--backoff must not be negative or exceed --max-backoff")
+	case o.MaxRestarts < 1:
+		return fmt.Errorf("--max-restarts must be at least 1")
+	case o.RestartWindow <= 0:
+		return fmt.Errorf("--restart-window must be positive")
+	}
+	return nil
+}
+
+// supervisedService is what the supervisor remembers about a service between probes
+type supervisedService struct {
+	// failures counts the failed probes in a row
+	failures int
+	// restarts holds the times the service was restarted within the restart window
+	restarts []time.Time
+	// unhealthy is set once the service failed FailureThreshold probes, until it is healthy
+	unhealthy bool
+	gaveUp    bool
+}
+
+// gcInterval is how often the supervisor looks for instances past their TTL or unused limit
+const gcInterval = 15 * time.Minute
+
+// Supervisor probes the services of every instance and restarts those that keep failing
+type Supervisor struct {
+	// GC is the policy instances past their TTL or unused limit are collected with, by
+	// calling Collect with the instance and the policy's action; nil leaves them alone
+	GC      *GCPolicy
+	Collect func(instanceName, action string) error
+
+	opts     SupervisorOptions
+	services map[string]*supervisedService
+	lastGC   time.Time
+	// gcEvents holds the last event recorded for each instance gc listed, so that an instance
+	// that stays due or keeps failing to be collected is not reported every round
+	gcEvents map[string]string
+}
+
+// NewSupervisor returns a supervisor with the given options
+func NewSupervisor(opts SupervisorOptions) *Supervisor {
+	return &Supervisor{opts: opts, services: make(map[string]*supervisedService), gcEvents: make(map[string]string)}
+}
+
+// Run probes every instance each interval until ctx is done
+func (s *Supervisor) Run(ctx context.Context) {
+	for {
+		s.Check(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(s.opts.Interval):
+		}
+	}
+}
+
+// Check probes every supervised instance once and restarts the services that are due, after
+// collecting the instances that are due
+func (s *Supervisor) Check(ctx context.Context) {
+	s.collect(time.Now())
+
+	names, err := GetInstanceNames()
+	if err != nil {
+		Log.Warning("Failed to list instances", "error", err)
+		return
+	}
+	for _, instanceName := range names {
+		if ctx.Err() != nil {
+			return
+		}
+		config, status, err := GetDeployment(instanceName)
+		if err != nil {
+			Log.Warning("Failed to load instance configuration", "instance", instanceName, "error", err)
+			continue
+		}
+		if config == nil || status != DeployStatusComplete || !s.supervises(config) {
+			s.forget(instanceName)
+			continue
+		}
+		for _, result := range ProbeInstance(config) {
+			s.handle(ctx, config, result)
+		}
+	}
+}
+
+// supervises reports whether the instance is to be kept running. Like 'status --repair' it
+// respects the instance's autostart policy, so instances stopped on purpose stay stopped.
+func (s *Supervisor) supervises(config *DeployConfig) bool {
+	switch config.AutostartPolicy() {
+	case AutostartNever:
+		return false
+	case AutostartAlways:
+		return true
+	}
+	stopped, err := InstanceStopped(config.InstanceName)
+	if err != nil {
+		Log.Warning("Failed to read instance state", "instance", config.InstanceName, "error", err)
+		return false
+	}
+	return !stopped
+}
+
+// forget drops what the supervisor remembers about the services of an instance
+func (s *Supervisor) forget(instanceName string) {
+	for key := range s.services {
+		if strings.HasPrefix(key, instanceName+"/") {
+			delete(s.services, key)
+		}
+	}
+}
+
+// handle acts on the result of probing a service
+func (s *Supervisor) handle(ctx context.Context, config *DeployConfig, result ServiceHealth) {
+	instanceName := config.InstanceName
+	key := instanceName + "/" + result.Service
+	state, ok := s.services[key]
+	if !ok {
+		state = &supervisedService{}
+		s.services[key] = state
+	}
+
+	now := time.Now()
+	var recent []time.Time
+	for _, restart := range state.restarts {
+		if now.Sub(restart) < s.opts.RestartWindow {
+			recent = append(recent, restart)
+		}
+	}
+	state.restarts = recent
+
+	if result.Healthy {
+		if state.unhealthy {
+			s.record(SupervisorEvent{Instance: instanceName, Service: result.Service, Action: SupervisorRecovered})
+		}
+		state.failures, state.unhealthy, state.gaveUp = 0, false, false
+		return
+	}
+
+	state.failures++
+	if state.failures < s.opts.FailureThreshold {
+		Log.Debug("Service failed a probe", "instance", instanceName, "service", result.Service, "failures", state.failures, "detail", result.Detail)
+		return
+	}
+	if !state.unhealthy {
+		state.unhealthy = true
+		detail := result.Detail
+		if diagnosis := DiagnoseContainer(instanceName, result.Service); diagnosis != "" {
+			detail += "; " + diagnosis
+		}
+		s.record(SupervisorEvent{Instance: instanceName, Service: result.Service, Action: SupervisorUnhealthy, Detail: detail})
+	}
+
+	if len(state.restarts) >= s.opts.MaxRestarts {
+		if !state.gaveUp {
+			state.gaveUp = true
+			s.record(SupervisorEvent{Instance: instanceName, Service: result.Service, Action: SupervisorGaveUp,
+				Detail: fmt.Sprintf("%d restarts within %s", len(state.restarts), s.opts.RestartWindow)})
+		}
+		return
+	}
+	state.gaveUp = false
+	if len(state.restarts) > 0 && now.Before(state.restarts[len(state.restarts)-1].Add(s.backoff(len(state.restarts)))) {
+		return
+	}
+
+	state.restarts = append(state.restarts, now)
+	if err := restartService(ctx, instanceName, result.Service); err != nil {
+		s.record(SupervisorEvent{Instance: instanceName, Service: result.Service, Action: SupervisorRestartFailed, Detail: err.Error()})
+		return
+	}
+	state.failures = 0
+	s.record(SupervisorEvent{Instance: instanceName, Service: result.Service, Action: SupervisorRestarted,
+		Detail: fmt.Sprintf("restart %d of at most %d within %s", len(state.restarts), s.opts.MaxRestarts, s.opts.RestartWindow)})
+}
+
+// collect stops or removes the instances past their TTL or unused limit, at most every
+// gcInterval, and warns about those that soon will be
+func (s *Supervisor) collect(now time.Time) {
+	if s.GC == nil || s.Collect == nil || now.Sub(s.lastGC) < gcInterval {
+		return
+	}
+	s.lastGC = now
+
+	candidates, err := FindGCCandidates(*s.GC, now)
+	if err != nil {
+		Log.Warning("Failed to look for instances to collect", "error", err)
+		return
+	}
+	listed := make(map[string]bool)
+	for _, candidate := range candidates {
+		instanceName := candidate.Instance
+		listed[instanceName] = true
+		if !candidate.Due(now) {
+			s.recordOnce(SupervisorEvent{Instance: instanceName, Action: SupervisorExpiring,
+				Detail: fmt.Sprintf("%s; it will be %s", candidate.Describe(now), GCActionDone(s.GC.Action))})
+			continue
+		}
+		if err := s.Collect(instanceName, s.GC.Action); err != nil {
+			s.recordOnce(SupervisorEvent{Instance: instanceName, Action: SupervisorCollectFailed, Detail: err.Error()})
+			continue
+		}
+		delete(s.gcEvents, instanceName)
+		s.record(SupervisorEvent{Instance: instanceName, Action: SupervisorCollected,
+			Detail: fmt.Sprintf("%s; %s", candidate.Describe(now), GCActionDone(s.GC.Action))})
+	}
+	// Instances given a new TTL or used again are reported afresh should they become due again
+	for instanceName := range s.gcEvents {
+		if !listed[instanceName] {
+			delete(s.gcEvents, instanceName)
+		}
+	}
+}
+
+// recordOnce records an event about an instance gc listed unless it is the last one recorded
+func (s *Supervisor) recordOnce(event SupervisorEvent) {
+	if s.gcEvents[event.Instance] == event.Action {
+		return
+	}
+	s.gcEvents[event.Instance] = event.Action
+	s.record(event)
+}
+
+// backoff returns how long to wait after the given number of recent restarts before
+// restarting a service again
+func (s *Supervisor) backoff(restarts int) time.Duration {
+	backoff := s.opts.Backoff
+	for i := 1; i < restarts && backoff < s.opts.MaxBackoff; i++ {
+		backoff *= 2
+	}
+	if backoff > s.opts.MaxBackoff {
+		backoff = s.opts.MaxBackoff
+	}
+	return backoff
+}
+
+// record logs an event and keeps it in instances.db
+func (s *Supervisor) record(event SupervisorEvent) {
+	args := []any{"instance", event.Instance}
+	if event.Service != "" {
+		args = append(args, "service", event.Service)
+	}
+	if event.Detail != "" {
+		args = append(args, "detail", event.Detail)
+	}
+	switch event.Action {
+	case SupervisorRecovered, SupervisorRestarted:
+		Log.Info(supervisorMessages[event.Action], args...)
+	default:
+		Log.Warning(supervisorMessages[event.Action], args...)
+	}
+	if err := RecordSupervisorEvent(event); err != nil {
+		Log.Warning("Failed to record supervisor event", "error", err)
+	}
+	Notify(NewNotification(event.Action, event.Instance, event.Service, event.Detail))
+}
+
+// restartService restarts the container of a service of an instance, unless another
+// operation on the instance is in progress
+func restartService(ctx context.Context, instanceName, service string) error {
+	release, err := LockInstance(instanceName)
+	if err != nil {
+		var locked *LockedError
+		if errors.As(err, &locked) {
+			return fmt.Errorf("skipped, another operation is in progress on the instance")
+		}
+		return err
+	}
+	defer release()
+
+	name, err := ServiceContainer(instanceName, service)
+	if err != nil {
+		return err
+	}
+	docker, err := GetDockerClient()
+	if err != nil {
+		return err
+	}
+	return docker.RestartContainer(ctx, name)
+}
+
+// supervisorLockName is the lock the running supervisor holds, so that only one runs
+const supervisorLockName = "supervisor"
+
+// LockSupervisor acquires the lock of the running supervisor. It fails with a LockedError if
+// another supervisor runs.
+func LockSupervisor() (release func(), err error) {
+	return acquireLock(supervisorLockName, true, "")
+}
+
+// SupervisorPIDFile returns the file the running supervisor writes its process ID to
+func SupervisorPIDFile() (string, error) {
+	graphsenseDir, err := GetGraphsenseDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(graphsenseDir, "supervise.pid"), nil
+}
+
+// SupervisorLogFile returns the file a supervisor started with --detach logs to
+func SupervisorLogFile() (string, error) {
+	graphsenseDir, err := GetGraphsenseDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(graphsenseDir, "logs", "supervise.log"), nil
+}
+
+// RunningSupervisor returns the process ID of the running supervisor, or 0 if none runs
+func RunningSupervisor() (int, error) {
+	release, err := LockSupervisor()
+	if err == nil {
+		release()
+		return 0, nil
+	}
+	var locked *LockedError
+	if !errors.As(err, &locked) {
+		return 0, err
+	}
+
+	path, err := SupervisorPIDFile()
+	if err != nil {
+		return 0, err
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return 0, fmt.Errorf("the supervisor is running (%s) but its process ID is unknown: %v", locked.Holder, err)
+	}
+	pid, err := strconv.Atoi(strings.TrimSpace(string(data)))
+	if err != nil {
+		return 0, fmt.Errorf("invalid process ID in %s", path)
+	}
+	return pid, nil
+}
@@ -0,0 +1,109 @@
+package internal
+
+import (
+	"bytes"
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/template"
+)
+
+//go:embed tips/*.tmpl
+var tipsFS embed.FS
+
+// languageExtensions maps source file extensions to the tips template of their language
+var languageExtensions = map[string]string{
+	".go":   "go",
+	".py":   "python",
+	".js":   "javascript",
+	".jsx":  "javascript",
+	".ts":   "javascript",
+	".tsx":  "javascript",
+	".mjs":  "javascript",
+	".java": "java",
+	".kt":   "java",
+	".rs":   "rust",
+}
+
+// skippedDirs are never scanned when detecting the languages of a repository
+var skippedDirs = map[string]bool{
+	".git":         true,
+	"node_modules": true,
+	"vendor":       true,
+	"target":       true,
+	"dist":         true,
+	"build":        true,
+	".venv":        true,
+	"venv":         true,
+}
+
+// DetectLanguages returns the languages that have tips, ordered by how many files of each the repository contains
+func DetectLanguages(repoPath string) []string {
+	counts := make(map[string]int)
+
+	filepath.WalkDir(repoPath, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		if d.IsDir() {
+			if skippedDirs[d.Name()] {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if language, ok := languageExtensions[strings.ToLower(filepath.Ext(path))]; ok {
+			counts[language]++
+		}
+		return nil
+	})
+
+	var languages []string
+	for language := range counts {
+		languages = append(languages, language)
+	}
+	sort.Slice(languages, func(i, j int) bool {
+		if counts[languages[i]] == counts[languages[j]] {
+			return languages[i] < languages[j]
+		}
+		return counts[languages[i]] > counts[languages[j]]
+	})
+
+	return languages
+}
+
+// RenderTips renders the onboarding tips for an instance, including the sections for the given languages
+func RenderTips(config *DeployConfig, languages []string) (string, error) {
+	names := []string{"common"}
+	names = append(names, languages...)
+
+	var buf bytes.Buffer
+	for _, name := range names {
+		content, err := tipsFS.ReadFile(fmt.Sprintf("tips/%s.tmpl", name))
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return "", err
+		}
+
+		tmpl, err := template.New(name).Parse(string(content))
+		if err != nil {
+			return "", fmt.Errorf("failed to parse %s tips: %v", name, err)
+		}
+
+		buf.WriteString("\n")
+		data := struct {
+			*DeployConfig
+			Host string
+		}{config, config.HostAddress()}
+		if err := tmpl.Execute(&buf, data); err != nil {
+			return "", fmt.Errorf("failed to render %s tips: %v", name, err)
+		}
+	}
+
+	return buf.String(), nil
+}
@@ -0,0 +1,331 @@
+package internal
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Files of an instance's certificate in its TLS directory
+const (
+	TLSCertFile = "tls.crt"
+	TLSKeyFile  = "tls.key"
+)
+
+// Environment variables that make the app serve HTTPS
+const (
+	TLSCertEnv = "TLS_CERT_FILE"
+	TLSKeyEnv  = "TLS_KEY_FILE"
+)
+
+// tlsContainerDir is where the TLS directory is mounted in the app container
+const tlsContainerDir = "/certs"
+
+// selfSignedValidity is how long generated certificates are valid
+const selfSignedValidity = 825 * 24 * time.Hour
+
+// TLSDir returns the directory holding the certificate and key of an instance,
+// ~/.graphsense/tls/<instance_name>
+func TLSDir(instanceName string) (string, error) {
+	graphsenseDir, err := GetGraphsenseDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(graphsenseDir, "tls", instanceName), nil
+}
+
+// TLSMount returns the volume that mounts the instance's TLS directory into the app container
+func (c *DeployConfig) TLSMount() (string, error) {
+	dir, err := TLSDir(c.InstanceName)
+	if err != nil {
+		return "", err
+	}
+	return dir + ":" + tlsContainerDir + ":ro", nil
+}
+
+// TLSEnv returns the environment telling the app to serve HTTPS with the mounted certificate
+func (c *DeployConfig) TLSEnv() map[string]string {
+	if !c.TLS {
+		return nil
+	}
+	return map[string]string{
+		TLSCertEnv: tlsContainerDir + "/" + TLSCertFile,
+		TLSKeyEnv:  tlsContainerDir + "/" + TLSKeyFile,
+	}
+}
+
+// AppURL returns the URL of the MCP server of an instance, https:// when it serves TLS
+func (c *DeployConfig) AppURL() string {
+	scheme := "http"
+	if c.TLS {
+		scheme = "https"
+	}
+	return fmt.Sprintf("%s://%s:%d", scheme, c.HostAddress(), c.AppPort)
+}
+
+// AppClient returns an HTTP client for the app's API. With TLS it accepts only the
+// instance's own certificate, whichever names it was issued for.
+func (c *DeployConfig) AppClient() *http.Client {
+	return &http.Client{Timeout: probeTimeout, Transport: c.AppTransport()}
+}
+
+// AppTransport returns the transport of requests to the app, which with TLS accepts only the
+// instance's own certificate
+func (c *DeployConfig) AppTransport() http.RoundTripper {
+	if !c.TLS {
+		return http.DefaultTransport
+	}
+	return &http.Transport{TLSClientConfig: &tls.Config{
+		// The certificate is compared with the instance's instead
+		InsecureSkipVerify: true,
+		VerifyPeerCertificate: func(rawCerts [][]byte, _ [][]*x509.Certificate) error {
+			return verifyInstanceCertificate(c.InstanceName, rawCerts)
+		},
+	}}
+}
+
+// verifyInstanceCertificate checks that the certificate a server presented is the instance's
+func verifyInstanceCertificate(instanceName string, rawCerts [][]byte) error {
+	cert, err := LoadInstanceCertificate(instanceName)
+	if err != nil {
+		return err
+	}
+	if len(rawCerts) == 0 || !bytes.Equal(rawCerts[0], cert.Raw) {
+		return fmt.Errorf("the server did not present the certificate of instance '%s'", instanceName)
+	}
+	return nil
+}
+
+// LoadInstanceCertificate returns the certificate the app of an instance serves
+func LoadInstanceCertificate(instanceName string) (*x509.Certificate, error) {
+	dir, err := TLSDir(instanceName)
+	if err != nil {
+		return nil, err
+	}
+	pair, err := tls.LoadX509KeyPair(filepath.Join(dir, TLSCertFile), filepath.Join(dir, TLSKeyFile))
+	if err != nil {
+		return nil, fmt.Errorf("failed to load the TLS certificate of '%s': %v", instanceName, err)
+	}
+	return x509.ParseCertificate(pair.Certificate[0])
+}
+
+// IsSelfSigned reports whether a certificate was issued by itself
+func IsSelfSigned(cert *x509.Certificate) bool {
+	return cert.CheckSignatureFrom(cert) == nil
+}
+
+// CheckCertificate checks that certPath and keyPath hold a matching PEM certificate and key
+// that have not expired
+func CheckCertificate(certPath, keyPath string) error {
+	pair, err := tls.LoadX509KeyPair(certPath, keyPath)
+	if err != nil {
+		return fmt.Errorf("invalid certificate or key: %v", err)
+	}
+	cert, err := x509.ParseCertificate(pair.Certificate[0])
+	if err != nil {
+		return fmt.Errorf("invalid certificate: %v", err)
+	}
+	if time.Now().After(cert.NotAfter) {
+		return fmt.Errorf("certificate %s expired on %s", certPath, cert.NotAfter.Format("2006-01-02"))
+	}
+	return nil
+}
+
+// InstallCertificate copies a certificate and its key into the TLS directory of an instance
+func InstallCertificate(instanceName, certPath, keyPath string) error {
+	if err := CheckCertificate(certPath, keyPath); err != nil {
+		return err
+	}
+	certPEM, err := os.ReadFile(certPath)
+	if err != nil {
+		return fmt.Errorf("failed to read certificate: %v", err)
+	}
+	keyPEM, err := os.ReadFile(keyPath)
+	if err != nil {
+		return fmt.Errorf("failed to read key: %v", err)
+	}
+	return writeInstanceTLS(instanceName, certPEM, keyPEM)
+}
+
+// GenerateSelfSignedCertificate creates a certificate for the names and addresses an instance
+// is reached at and stores it in the instance's TLS directory
+func GenerateSelfSignedCertificate(config *DeployConfig) error {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return fmt.Errorf("failed to generate key: %v", err)
+	}
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return fmt.Errorf("failed to generate serial number: %v", err)
+	}
+
+	now := time.Now()
+	template := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{CommonName: config.InstanceName, Organization: []string{"graphsense-cli"}},
+		NotBefore:             now.Add(-time.Hour),
+		NotAfter:              now.Add(selfSignedValidity),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	for _, host := range certificateHosts(config) {
+		if ip := net.ParseIP(host); ip != nil {
+			template.IPAddresses = append(template.IPAddresses, ip)
+		} else {
+			template.DNSNames = append(template.DNSNames, host)
+		}
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return fmt.Errorf("failed to create certificate: %v", err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return fmt.Errorf("failed to encode key: %v", err)
+	}
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+	return writeInstanceTLS(config.InstanceName, certPEM, keyPEM)
+}
+
+// certificateHosts returns the names and addresses a generated certificate is valid for:
+// localhost, the Docker host, the bind address and, for ports published on all interfaces,
+// the machine's host name
+func certificateHosts(config *DeployConfig) []string {
+	hosts := []string{"localhost", "127.0.0.1", "::1"}
+	hosts = append(hosts, strings.Trim(config.HostAddress(), "[]"))
+	if config.BindsAllInterfaces() && !IsRemoteDocker() {
+		if hostname, err := os.Hostname(); err == nil {
+			hosts = append(hosts, hostname)
+		}
+	}
+
+	seen := make(map[string]bool)
+	var unique []string
+	for _, host := range hosts {
+		if host != "" && !seen[host] {
+			seen[host] = true
+			unique = append(unique, host)
+		}
+	}
+	return unique
+}
+
+// writeInstanceTLS stores a certificate and key in the TLS directory of an instance. The
+// key is readable only by you.
+func writeInstanceTLS(instanceName string, certPEM, keyPEM []byte) error {
+	dir, err := TLSDir(instanceName)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return fmt.Errorf("failed to create TLS directory: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, TLSCertFile), certPEM, 0644); err != nil {
+		return fmt.Errorf("failed to write certificate: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, TLSKeyFile), keyPEM, 0600); err != nil {
+		return fmt.Errorf("failed to write key: %v", err)
+	}
+	return nil
+}
+
+// TLSOptions selects the certificate deploy --tls serves
+type TLSOptions struct {
+	CertPath   string
+	KeyPath    string
+	SelfSigned bool
+}
+
+// Validate checks that the options name one source of a certificate
+func (o TLSOptions) Validate() error {
+	if (o.CertPath == "") != (o.KeyPath == "") {
+		return fmt.Errorf("--cert and --key must be given together")
+	}
+	if o.CertPath != "" {
+		if o.SelfSigned {
+			return fmt.Errorf("--self-signed cannot be combined with --cert and --key")
+		}
+		return CheckCertificate(o.CertPath, o.KeyPath)
+	}
+	return nil
+}
+
+// SetupTLS provisions the certificate of an instance deployed with TLS: the given one, or a
+// generated self-signed one when none is given
+func SetupTLS(config *DeployConfig, opts TLSOptions) error {
+	config.TLS = true
+	if opts.CertPath != "" {
+		return InstallCertificate(config.InstanceName, opts.CertPath, opts.KeyPath)
+	}
+	return GenerateSelfSignedCertificate(config)
+}
+
+// DeleteInstanceTLS removes the certificate and key of an instance
+func DeleteInstanceTLS(instanceName string) error {
+	dir, err := TLSDir(instanceName)
+	if err != nil {
+		return err
+	}
+	return os.RemoveAll(dir)
+}
+
+// CopyInstanceTLS gives target the certificate of source, which stays valid for the same
+// names since the copy runs on the same host
+func CopyInstanceTLS(source, target *DeployConfig) error {
+	target.TLS = source.TLS
+	if !source.TLS {
+		return nil
+	}
+	sourceDir, err := TLSDir(source.InstanceName)
+	if err != nil {
+		return err
+	}
+	certPEM, err := os.ReadFile(filepath.Join(sourceDir, TLSCertFile))
+	if err != nil {
+		return fmt.Errorf("failed to read the certificate of '%s': %v", source.InstanceName, err)
+	}
+	keyPEM, err := os.ReadFile(filepath.Join(sourceDir, TLSKeyFile))
+	if err != nil {
+		return fmt.Errorf("failed to read the key of '%s': %v", source.InstanceName, err)
+	}
+	return writeInstanceTLS(target.InstanceName, certPEM, keyPEM)
+}
+
+// MoveInstanceTLS moves the certificate of an instance to its new name
+func MoveInstanceTLS(config *DeployConfig, newName string) error {
+	if !config.TLS {
+		return nil
+	}
+	oldDir, err := TLSDir(config.InstanceName)
+	if err != nil {
+		return err
+	}
+	newDir, err := TLSDir(newName)
+	if err != nil {
+		return err
+	}
+	if err := os.RemoveAll(newDir); err != nil {
+		return err
+	}
+	if err := os.Rename(oldDir, newDir); err != nil {
+		return fmt.Errorf("failed to move TLS certificate: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,345 @@
+package internal
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/docker/docker/api/types/filters"
+)
+
+const (
+	// ReleasesURL is where CLI releases are published
+	ReleasesURL = "https://github.com/faraazahmad/graphsense-cli/releases"
+
+	latestReleaseAPI   = "https://api.github.com/repos/faraazahmad/graphsense-cli/releases/latest"
+	dockerHubTagsAPI   = "https://hub.docker.com/v2/repositories/%s/tags?page_size=100"
+	updateCheckTimeout = 3 * time.Second
+)
+
+// UpdateCheckInterval is how often the update checker contacts the network and prints notices
+const UpdateCheckInterval = 24 * time.Hour
+
+// UpdateCheckConfig controls the update checker
+type UpdateCheckConfig struct {
+	Disabled bool `yaml:"disabled"`
+}
+
+// UpdateNotice describes a component that is significantly behind its latest release
+type UpdateNotice struct {
+	Subject string
+	Current string
+	Latest  string
+	Hint    string
+}
+
+// updateCheck is the cached result of the last update check, kept in ~/.graphsense/update-check.json
+type updateCheck struct {
+	CheckedAt  time.Time `json:"checked_at"`
+	NotifiedAt time.Time `json:"notified_at"`
+	LatestCLI  string    `json:"latest_cli,omitempty"`
+	// LatestTags maps image repositories to their newest release tag
+	LatestTags map[string]string `json:"latest_tags,omitempty"`
+	// AppImages maps instances to the image their app container runs
+	AppImages map[string]string `json:"app_images,omitempty"`
+}
+
+// UpdateChecksDisabled reports whether update checks are turned off in the user config
+// or with GRAPHSENSE_NO_UPDATE_CHECK
+func UpdateChecksDisabled() bool {
+	if os.Getenv("GRAPHSENSE_NO_UPDATE_CHECK") != "" {
+		return true
+	}
+	config, err := LoadConfig()
+	if err != nil {
+		return false
+	}
+	return config.UpdateCheck.Disabled
+}
+
+// CheckForUpdates returns notices for the CLI and instance app images that are a minor or
+// major release behind. The network is contacted and notices are returned at most once per
+// UpdateCheckInterval; in between it returns nothing.
+func CheckForUpdates(ctx context.Context) []UpdateNotice {
+	path, err := updateCheckPath()
+	if err != nil {
+		return nil
+	}
+	check := loadUpdateCheck(path)
+
+	now := time.Now()
+	if now.Sub(check.NotifiedAt) < UpdateCheckInterval {
+		return nil
+	}
+	if now.Sub(check.CheckedAt) >= UpdateCheckInterval {
+		ctx, cancel := context.WithTimeout(ctx, updateCheckTimeout)
+		defer cancel()
+		check.refresh(ctx)
+		check.CheckedAt = now
+	}
+
+	notices := check.notices()
+	check.NotifiedAt = now
+	if err := check.save(path); err != nil {
+		Log.Debug("Failed to save update check", "error", err)
+	}
+	return notices
+}
+
+// updateCheckPath returns the path of the update check cache
+func updateCheckPath() (string, error) {
+	graphsenseDir, err := GetGraphsenseDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(graphsenseDir, "update-check.json"), nil
+}
+
+// loadUpdateCheck reads the update check cache, starting over if it is missing or unreadable
+func loadUpdateCheck(path string) *updateCheck {
+	check := &updateCheck{}
+	if data, err := os.ReadFile(path); err == nil {
+		if err := json.Unmarshal(data, check); err != nil {
+			return &updateCheck{}
+		}
+	}
+	return check
+}
+
+func (u *updateCheck) save(path string) error {
+	data, err := json.MarshalIndent(u, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0644)
+}
+
+// refresh looks up the latest CLI release and the newest tags of the images instance apps
+// run. Lookups that fail keep their previous result.
+func (u *updateCheck) refresh(ctx context.Context) {
+	if _, ok := releaseVersion(Version); ok {
+		if latest, err := latestCLIRelease(ctx); err != nil {
+			Log.Debug("Failed to check for CLI updates", "error", err)
+		} else {
+			u.LatestCLI = latest
+		}
+	}
+
+	images, err := appImages(ctx)
+	if err != nil {
+		Log.Debug("Failed to list app images", "error", err)
+		return
+	}
+	u.AppImages = images
+
+	if u.LatestTags == nil {
+		u.LatestTags = make(map[string]string)
+	}
+	checked := make(map[string]bool)
+	for _, image := range images {
+		repository, tag := splitImageTag(image)
+		if _, ok := releaseVersion(tag); !ok || checked[repository] {
+			continue
+		}
+		checked[repository] = true
+		latest, err := latestImageTag(ctx, repository)
+		if err != nil {
+			Log.Debug("Failed to check for image updates", "image", repository, "error", err)
+			continue
+		}
+		u.LatestTags[repository] = latest
+	}
+}
+
+// notices compares the cached versions with the latest releases
+func (u *updateCheck) notices() []UpdateNotice {
+	var notices []UpdateNotice
+	if significantlyOutdated(Version, u.LatestCLI) {
+		notices = append(notices, UpdateNotice{
+			Subject: "graphsense-cli",
+			Current: Version,
+			Latest:  u.LatestCLI,
+			Hint:    fmt.Sprintf("Download it from %s", ReleasesURL),
+		})
+	}
+
+	instanceNames := make([]string, 0, len(u.AppImages))
+	for instanceName := range u.AppImages {
+		instanceNames = append(instanceNames, instanceName)
+	}
+	sort.Strings(instanceNames)
+
+	for _, instanceName := range instanceNames {
+		repository, tag := splitImageTag(u.AppImages[instanceName])
+		latest := u.LatestTags[repository]
+		if significantlyOutdated(tag, latest) {
+			notices = append(notices, UpdateNotice{
+				Subject: fmt.Sprintf("instance '%s' (%s)", instanceName, repository),
+				Current: tag,
+				Latest:  latest,
+				Hint:    fmt.Sprintf("Run 'graphsense-cli upgrade %s --image-tag %s'", instanceName, latest),
+			})
+		}
+	}
+	return notices
+}
+
+// significantlyOutdated reports whether latest is a newer major or minor release than current.
+// Patch releases alone are not worth a notice.
+func significantlyOutdated(current, latest string) bool {
+	currentVersion, ok := releaseVersion(current)
+	if !ok {
+		return false
+	}
+	latestVersion, ok := releaseVersion(latest)
+	if !ok {
+		return false
+	}
+	currentVersion[2], latestVersion[2] = 0, 0
+	return compareReleases(currentVersion, latestVersion) < 0
+}
+
+// latestCLIRelease returns the tag of the latest published CLI release
+func latestCLIRelease(ctx context.Context) (string, error) {
+	release, err := LatestRelease(ctx)
+	if err != nil {
+		return "", err
+	}
+	return release.TagName, nil
+}
+
+// latestImageTag returns the newest release tag of an image repository on Docker Hub
+func latestImageTag(ctx context.Context, repository string) (string, error) {
+	name, ok := dockerHubRepository(repository)
+	if !ok {
+		return "", fmt.Errorf("only Docker Hub images are checked")
+	}
+
+	var tags struct {
+		Results []struct {
+			Name string `json:"name"`
+		} `json:"results"`
+	}
+	if err := getJSON(ctx, fmt.Sprintf(dockerHubTagsAPI, name), &tags); err != nil {
+		return "", err
+	}
+
+	var latest string
+	var latestVersion [3]int
+	for _, tag := range tags.Results {
+		version, ok := releaseVersion(tag.Name)
+		if ok && (latest == "" || compareReleases(version, latestVersion) > 0) {
+			latest, latestVersion = tag.Name, version
+		}
+	}
+	if latest == "" {
+		return "", fmt.Errorf("no release tags found")
+	}
+	return latest, nil
+}
+
+// getJSON fetches url and decodes its JSON body into v
+func getJSON(ctx context.Context, url string, v interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s returned HTTP %d", url, resp.StatusCode)
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+// appImages returns the image every instance's app container runs, keyed by instance
+func appImages(ctx context.Context) (map[string]string, error) {
+	docker, err := GetDockerClient()
+	if err != nil {
+		return nil, err
+	}
+	containers, err := docker.ListContainers(ctx, true, filters.NewArgs(filters.Arg("label", ComposeServiceLabel+"=app")))
+	if err != nil {
+		return nil, err
+	}
+
+	images := make(map[string]string)
+	for _, container := range containers {
+		if project := container.Labels[ComposeProjectLabel]; project != "" {
+			images[project] = container.Image
+		}
+	}
+	return images, nil
+}
+
+// splitImageTag splits an image reference into its repository and tag
+func splitImageTag(image string) (string, string) {
+	if i := strings.Index(image, "@"); i >= 0 {
+		image = image[:i]
+	}
+	if i := strings.LastIndex(image, ":"); i > strings.LastIndex(image, "/") {
+		return image[:i], image[i+1:]
+	}
+	return image, "latest"
+}
+
+// dockerHubRepository returns the Docker Hub name of an image repository, or false
+// if the repository lives in another registry
+func dockerHubRepository(repository string) (string, bool) {
+	first, rest, found := strings.Cut(repository, "/")
+	if !found {
+		return "library/" + repository, true
+	}
+	if first == "docker.io" || first == "index.docker.io" {
+		return dockerHubRepository(rest)
+	}
+	if strings.ContainsAny(first, ".:") || first == "localhost" {
+		return "", false
+	}
+	return repository, true
+}
+
+// ReleaseCheck is the result of comparing this build with the latest CLI release
+type ReleaseCheck struct {
+	Current string `json:"current" yaml:"current"`
+	Latest  string `json:"latest" yaml:"latest"`
+	Newer   bool   `json:"newer" yaml:"newer"`
+	// Development is set for builds without a stamped release version, which are never
+	// compared with the latest release
+	Development bool `json:"development,omitempty" yaml:"development,omitempty"`
+}
+
+// CheckLatestRelease asks GitHub for the latest CLI release and compares it with this build
+func CheckLatestRelease(ctx context.Context) (ReleaseCheck, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	latest, err := latestCLIRelease(ctx)
+	if err != nil {
+		return ReleaseCheck{Current: Version}, fmt.Errorf("failed to check for a newer release: %v", err)
+	}
+	return NewReleaseCheck(latest), nil
+}
+
+// NewReleaseCheck compares this build with latest, the tag of the latest CLI release
+func NewReleaseCheck(latest string) ReleaseCheck {
+	check := ReleaseCheck{Current: Version, Latest: latest}
+	currentVersion, ok := releaseVersion(Version)
+	if !ok {
+		check.Development = true
+		return check
+	}
+	if latestVersion, ok := releaseVersion(latest); ok {
+		check.Newer = compareReleases(currentVersion, latestVersion) < 0
+	}
+	return check
+}
@@ -0,0 +1,77 @@
+package internal
+
+import (
+	"context"
+	"runtime"
+	"runtime/debug"
+	"time"
+)
+
+// Version is the release of this build, set with
+// -ldflags "-X graphsense-cli/internal.Version=v1.2.3"
+var Version = "dev"
+
+// Commit and BuildDate identify the source and time of this build, set with
+// -ldflags "-X graphsense-cli/internal.Commit=$(git rev-parse --short HEAD)
+// -X graphsense-cli/internal.BuildDate=$(date -u +%Y-%m-%dT%H:%M:%SZ)".
+// Builds without them fall back to the VCS information Go embeds.
+var (
+	Commit    = ""
+	BuildDate = ""
+)
+
+// BuildInfo describes this build of the CLI and the Docker tooling it found
+type BuildInfo struct {
+	Version   string `json:"version" yaml:"version"`
+	Commit    string `json:"commit,omitempty" yaml:"commit,omitempty"`
+	BuildDate string `json:"build_date,omitempty" yaml:"build_date,omitempty"`
+	GoVersion string `json:"go_version" yaml:"go_version"`
+	Platform  string `json:"platform" yaml:"platform"`
+	// Docker and Compose are the detected versions, or the reason they could not be detected
+	Docker  string `json:"docker" yaml:"docker"`
+	Compose string `json:"compose" yaml:"compose"`
+}
+
+// GetBuildInfo returns the metadata of this build and asks Docker for its versions
+func GetBuildInfo(ctx context.Context) BuildInfo {
+	info := BuildInfo{
+		Version:   Version,
+		Commit:    Commit,
+		BuildDate: BuildDate,
+		GoVersion: runtime.Version(),
+		Platform:  runtime.GOOS + "/" + runtime.GOARCH,
+	}
+	if embedded, ok := debug.ReadBuildInfo(); ok {
+		for _, setting := range embedded.Settings {
+			switch {
+			case setting.Key == "vcs.revision" && info.Commit == "":
+				info.Commit = setting.Value
+				if len(info.Commit) > 12 {
+					info.Commit = info.Commit[:12]
+				}
+			case setting.Key == "vcs.time" && info.BuildDate == "":
+				info.BuildDate = setting.Value
+			}
+		}
+	}
+
+	info.Docker = "not available"
+	if docker, err := GetDockerClient(); err != nil {
+		info.Docker += ": " + err.Error()
+	} else {
+		ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+		defer cancel()
+		if version, err := docker.ServerVersion(ctx); err != nil {
+			info.Docker += ": " + err.Error()
+		} else {
+			info.Docker = version
+		}
+	}
+
+	if runner, err := DetectComposeRunner(); err != nil {
+		info.Compose = "not available: " + err.Error()
+	} else {
+		info.Compose = runner.String()
+	}
+	return info
+}
@@ -0,0 +1,155 @@
+package internal
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// EngineVersions holds the database engine versions an instance runs
+type EngineVersions struct {
+	Postgres string
+	Neo4j    string
+}
+
+// engineVersionCommands are the commands printing the engine version of each database service
+var engineVersionCommands = map[string][]string{
+	"postgres": {"postgres", "--version"},
+	"neo4j":    {"neo4j", "--version"},
+}
+
+var versionPattern = regexp.MustCompile(`(\d+)\.(\d+)(?:\.(\d+))?`)
+
+// parseVersion extracts the first dotted version number from command output
+func parseVersion(output string) string {
+	return versionPattern.FindString(output)
+}
+
+// MajorVersion returns the major component of a dotted version, or 0 if it cannot be parsed
+func MajorVersion(version string) int {
+	match := versionPattern.FindStringSubmatch(version)
+	if match == nil {
+		return 0
+	}
+	major, _ := strconv.Atoi(match[1])
+	return major
+}
+
+// GetEngineVersions asks the running database containers of an instance for their versions
+func GetEngineVersions(instanceName string) (EngineVersions, error) {
+	var versions EngineVersions
+
+	for service, command := range engineVersionCommands {
+		args := append([]string{"exec", fmt.Sprintf("%s-%s", instanceName, service)}, command...)
+		output, err := Command("docker", args...).Output()
+		if err != nil {
+			return versions, fmt.Errorf("failed to get %s version: %v", service, err)
+		}
+		versions.set(service, parseVersion(string(output)))
+	}
+
+	return versions, nil
+}
+
+// GetImageEngineVersion returns the database engine version shipped in an image without
+// starting the service
+func GetImageEngineVersion(service, image string) (string, error) {
+	command, ok := engineVersionCommands[service]
+	if !ok {
+		return "", fmt.Errorf("unknown database service: %s", service)
+	}
+
+	args := append([]string{"run", "--rm", "--entrypoint", command[0], image}, command[1:]...)
+	output, err := Command("docker", args...).Output()
+	if err != nil {
+		return "", fmt.Errorf("failed to get %s version of %s: %v", service, image, err)
+	}
+
+	return parseVersion(string(output)), nil
+}
+
+func (v *EngineVersions) set(service, version string) {
+	switch service {
+	case "postgres":
+		v.Postgres = version
+	case "neo4j":
+		v.Neo4j = version
+	}
+}
+
+// StoreBoundaries lists the database engines whose on-disk storage format is incompatible
+// between two sets of versions. Both Postgres and Neo4j change their store format between
+// major versions, so data has to be dumped and reloaded to cross one.
+func StoreBoundaries(from, to EngineVersions) []string {
+	var crossed []string
+
+	if from.Postgres != "" && to.Postgres != "" && MajorVersion(from.Postgres) != MajorVersion(to.Postgres) {
+		crossed = append(crossed, fmt.Sprintf("postgres %s %s %s", from.Postgres, Arrow(), to.Postgres))
+	}
+	if from.Neo4j != "" && to.Neo4j != "" && MajorVersion(from.Neo4j) != MajorVersion(to.Neo4j) {
+		crossed = append(crossed, fmt.Sprintf("neo4j %s %s %s", from.Neo4j, Arrow(), to.Neo4j))
+	}
+
+	return crossed
+}
+
+// neo4jDumpArgs returns the neo4j-admin arguments dumping the database into /backups
+func neo4jDumpArgs(version string) []string {
+	if MajorVersion(version) >= 5 || version == "" {
+		return []string{"neo4j-admin", "database", "dump", Neo4jDB, "--to-path=/backups", "--overwrite-destination=true"}
+	}
+	return []string{"neo4j-admin", "dump", "--database=" + Neo4jDB, "--to=/backups/" + BackupNeo4jFile}
+}
+
+// neo4jLoadArgs returns the neo4j-admin arguments loading the database from /backups
+func neo4jLoadArgs(version string) []string {
+	if MajorVersion(version) >= 5 || version == "" {
+		return []string{"neo4j-admin", "database", "load", Neo4jDB, "--from-path=/backups", "--overwrite-destination=true"}
+	}
+	return []string{"neo4j-admin", "load", "--database=" + Neo4jDB, "--from=/backups/" + BackupNeo4jFile, "--force"}
+}
+
+// String renders the engine versions for log messages
+func (v EngineVersions) String() string {
+	var parts []string
+	if v.Postgres != "" {
+		parts = append(parts, "postgres "+v.Postgres)
+	}
+	if v.Neo4j != "" {
+		parts = append(parts, "neo4j "+v.Neo4j)
+	}
+	if len(parts) == 0 {
+		return "unknown"
+	}
+	return strings.Join(parts, ", ")
+}
+
+var releasePattern = regexp.MustCompile(`^v?(\d+)\.(\d+)(?:\.(\d+))?$`)
+
+// releaseVersion parses a release version or tag such as "v1.4.2" or "1.4" into its
+// major, minor and patch components. Pre-releases and other tags are rejected.
+func releaseVersion(version string) ([3]int, bool) {
+	var parts [3]int
+	match := releasePattern.FindStringSubmatch(strings.TrimSpace(version))
+	if match == nil {
+		return parts, false
+	}
+	for i := range parts {
+		parts[i], _ = strconv.Atoi(match[i+1])
+	}
+	return parts, true
+}
+
+// compareReleases returns -1, 0 or 1 when release version a is older than, equal to or newer than b
+func compareReleases(a, b [3]int) int {
+	for i := range a {
+		switch {
+		case a[i] < b[i]:
+			return -1
+		case a[i] > b[i]:
+			return 1
+		}
+	}
+	return 0
+}
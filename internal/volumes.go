@@ -0,0 +1,76 @@
+package internal
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// VolumeHelperImage is the small image used to copy data between volumes
+const VolumeHelperImage = "alpine:3.19"
+
+// InstanceVolumes returns the named volumes of an instance
+func InstanceVolumes(instanceName string) ([]string, error) {
+	docker, err := GetDockerClient()
+	if err != nil {
+		return nil, err
+	}
+	return docker.ListVolumes(context.Background(), instanceName+"_")
+}
+
+// CopyVolume copies the contents of volume src into a new volume dst owned by compose project project.
+// File ownership and permissions are preserved, so the databases can open the copy.
+func CopyVolume(src, dst, project string) error {
+	docker, err := GetDockerClient()
+	if err != nil {
+		return err
+	}
+	if err := docker.CreateVolume(context.Background(), dst, project); err != nil {
+		return err
+	}
+
+	cmd := Command("docker", "run", "--rm",
+		"-v", src+":/from:ro",
+		"-v", dst+":/to",
+		VolumeHelperImage, "cp", "-a", "/from/.", "/to/")
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("failed to copy volume %s to %s: %s", src, dst, strings.TrimSpace(string(output)))
+	}
+	return nil
+}
+
+// CopyInstanceVolumes copies every named volume of instance src to the matching volume of
+// instance dst and returns the volumes it created. On failure the volumes created so far are
+// removed again.
+func CopyInstanceVolumes(src, dst string) ([]string, error) {
+	volumes, err := InstanceVolumes(src)
+	if err != nil {
+		return nil, err
+	}
+
+	var created []string
+	for _, volume := range volumes {
+		target := dst + strings.TrimPrefix(volume, src)
+		Log.Info("Copying volume", "from", volume, "to", target)
+		if err := CopyVolume(volume, target, dst); err != nil {
+			RemoveVolumes(append(created, target))
+			return nil, err
+		}
+		created = append(created, target)
+	}
+	return created, nil
+}
+
+// RemoveVolumes removes volumes, logging the ones that could not be removed
+func RemoveVolumes(volumes []string) {
+	docker, err := GetDockerClient()
+	if err != nil {
+		Log.Warning("Failed to remove volumes", "error", err)
+		return
+	}
+	for _, volume := range volumes {
+		if err := docker.RemoveVolume(context.Background(), volume); err != nil {
+			Log.Warning("Failed to remove volume", "volume", volume, "error", err)
+		}
+	}
+}
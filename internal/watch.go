@@ -0,0 +1,244 @@
+package internal
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// DefaultWatchDebounce is how long the working tree must be quiet before changes are reindexed
+const DefaultWatchDebounce = 2 * time.Second
+
+// watchRetryDelay is the least time before a batch that failed to reindex is tried again
+const watchRetryDelay = time.Second
+
+// watchSkipDirs are directories whose changes never affect the index
+var watchSkipDirs = map[string]bool{".git": true, "node_modules": true}
+
+// WatchOptions controls how long the working tree must be quiet before the changes are sent
+// for reindexing
+type WatchOptions struct {
+	Debounce time.Duration
+}
+
+// Validate checks that the debounce period is usable
+func (o WatchOptions) Validate() error {
+	if o.Debounce < 0 {
+		return fmt.Errorf("debounce must not be negative")
+	}
+	return nil
+}
+
+// ReindexResult is one batch of changed files sent to the app
+type ReindexResult struct {
+	// Paths are the changed files relative to the repository root
+	Paths []string
+	Err   error
+}
+
+// treeWatcher watches every directory of a working tree, skipping watchSkipDirs and the
+// submodules hidden from the index. fsnotify only watches single directories, so directories
+// created later are added as they appear.
+type treeWatcher struct {
+	root     string
+	excluded map[string]bool
+	watcher  *fsnotify.Watcher
+}
+
+// relative returns a path of the tree relative to its root, with forward slashes, and whether
+// its changes may affect the index
+func (w *treeWatcher) relative(p string) (string, bool) {
+	rel, err := filepath.Rel(w.root, p)
+	if err != nil || rel == "." {
+		return "", false
+	}
+	rel = filepath.ToSlash(rel)
+	for _, part := range strings.Split(rel, "/") {
+		if watchSkipDirs[part] {
+			return "", false
+		}
+	}
+	for excluded := range w.excluded {
+		if rel == excluded || strings.HasPrefix(rel, excluded+"/") {
+			return "", false
+		}
+	}
+	return rel, true
+}
+
+// add watches dir and every directory below it. It returns the files found below it, relative
+// to the root, so that files moved into the tree with their directory are reindexed.
+func (w *treeWatcher) add(dir string) ([]string, error) {
+	var files []string
+	err := filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			// Files can disappear between listing a directory and reading them
+			if p != dir {
+				return nil
+			}
+			return err
+		}
+		rel, ok := w.relative(p)
+		if p != w.root && !ok {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !d.IsDir() {
+			files = append(files, rel)
+			return nil
+		}
+		if err := w.watcher.Add(p); err != nil {
+			if errors.Is(err, syscall.ENOSPC) {
+				return fmt.Errorf("too many directories to watch: raise fs.inotify.max_user_watches, e.g. sysctl fs.inotify.max_user_watches=524288")
+			}
+			return fmt.Errorf("failed to watch %s: %v", p, err)
+		}
+		return nil
+	})
+	return files, err
+}
+
+// WatchRepository watches the working tree of an instance for changes until ctx is cancelled.
+// Once the tree has been quiet for the debounce period, the changed files are sent to the app
+// for incremental reindexing and the outcome is passed to report. Batches that fail are
+// retried with the next one. It stops early when the app has no reindex endpoint.
+func WatchRepository(ctx context.Context, config *DeployConfig, opts WatchOptions, report func(ReindexResult)) error {
+	excluded := make(map[string]bool)
+	if config.ExcludeSubmodules {
+		for _, submodule := range GetSubmodules(config.RepoPath) {
+			excluded[filepath.ToSlash(submodule.Path)] = true
+		}
+	}
+
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return fmt.Errorf("failed to watch %s: %v", config.RepoPath, err)
+	}
+	defer watcher.Close()
+
+	tree := &treeWatcher{root: config.RepoPath, excluded: excluded, watcher: watcher}
+	if _, err := tree.add(config.RepoPath); err != nil {
+		return err
+	}
+
+	pending := make(map[string]bool)
+	// flush fires once the tree has been quiet for the debounce period
+	var flush <-chan time.Time
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return nil
+			}
+			if errors.Is(err, fsnotify.ErrEventOverflow) {
+				Log.Warning("Missed some file changes; save the files again to reindex them", "instance", config.InstanceName)
+				continue
+			}
+			return fmt.Errorf("failed to watch %s: %v", config.RepoPath, err)
+
+		case event, ok := <-watcher.Events:
+			if !ok {
+				return nil
+			}
+			rel, relevant := tree.relative(event.Name)
+			if !relevant || event.Op == fsnotify.Chmod {
+				continue
+			}
+			if event.Has(fsnotify.Create) {
+				if info, err := os.Stat(event.Name); err == nil && info.IsDir() {
+					files, err := tree.add(event.Name)
+					if err != nil {
+						return err
+					}
+					for _, name := range files {
+						pending[name] = true
+					}
+					flush = time.After(opts.Debounce)
+					continue
+				}
+			}
+			pending[rel] = true
+			flush = time.After(opts.Debounce)
+
+		case <-flush:
+			flush = nil
+			if len(pending) == 0 {
+				continue
+			}
+			paths := make([]string, 0, len(pending))
+			for name := range pending {
+				paths = append(paths, name)
+			}
+			sort.Strings(paths)
+			pending = make(map[string]bool)
+
+			err := TriggerReindex(config, paths)
+			if errors.Is(err, ErrNoAdminAPI) {
+				return fmt.Errorf("the app of instance '%s' does not support incremental reindexing; upgrade it first", config.InstanceName)
+			}
+			if err != nil {
+				// Keep the files for the next batch, tried again after another debounce period
+				for _, name := range paths {
+					pending[name] = true
+				}
+				flush = time.After(max(opts.Debounce, watchRetryDelay))
+			}
+			report(ReindexResult{Paths: paths, Err: err})
+		}
+	}
+}
+
+// TriggerReindex asks the app of an instance to reindex the given files, relative to the
+// repository root, through the admin API. Deleted files are removed from the graph.
+// It returns ErrNoAdminAPI when the app version does not serve the endpoint.
+func TriggerReindex(config *DeployConfig, paths []string) error {
+	containerPaths := make([]string, len(paths))
+	for i, p := range paths {
+		containerPaths[i] = path.Join(containerRepoPath, p)
+	}
+	body, err := json.Marshal(map[string][]string{"paths": containerPaths})
+	if err != nil {
+		return err
+	}
+
+	resp, err := config.AppClient().Post(config.AppURL()+"/admin/reindex", "application/json", bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to reach admin API: %v", err)
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusNotFound || resp.StatusCode == http.StatusMethodNotAllowed:
+		return ErrNoAdminAPI
+	case resp.StatusCode >= 300:
+		return fmt.Errorf("admin API returned HTTP %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// SummarizePaths lists up to max paths, followed by how many more there are
+func SummarizePaths(paths []string, max int) string {
+	if len(paths) <= max {
+		return strings.Join(paths, ", ")
+	}
+	return fmt.Sprintf("%s and %d more", strings.Join(paths[:max], ", "), len(paths)-max)
+}